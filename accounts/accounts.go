@@ -18,11 +18,13 @@
 package accounts
 
 import (
+	"fmt"
 	"math/big"
 
 	wiseplat "github.com/wiseplat/go-wiseplat"
 	"github.com/wiseplat/go-wiseplat/common"
 	"github.com/wiseplat/go-wiseplat/core/types"
+	"github.com/wiseplat/go-wiseplat/crypto"
 	"github.com/wiseplat/go-wiseplat/event"
 )
 
@@ -100,6 +102,27 @@ type Wallet interface {
 	// the account in a keystore).
 	SignHash(account Account, hash []byte) ([]byte, error)
 
+	// SignText requests the wallet to sign the hash of a given piece of text, as
+	// calculated by TextHash. Contrary to SignHash, this allows wallets which can't
+	// sign arbitrary hashes (e.g. hardware wallets) to display the text being signed.
+	//
+	// It looks up the account specified either solely via its address contained within,
+	// or optionally with the aid of any location metadata from the embedded URL field.
+	//
+	// If the wallet requires additional authentication to sign the request (e.g.
+	// a password to decrypt the account), an AuthNeededError instance will be
+	// returned. The user may retry by providing the needed details via
+	// SignTextWithPassphrase, or by other means (e.g. unlock the account in a keystore).
+	SignText(account Account, text []byte) ([]byte, error)
+
+	// SignTypedHash requests the wallet to sign an EIP-712 typed message, given the
+	// hash of its domain separator and the hash of the message struct, as combined
+	// by TypedHash.
+	//
+	// It looks up the account specified either solely via its address contained within,
+	// or optionally with the aid of any location metadata from the embedded URL field.
+	SignTypedHash(account Account, domain, message common.Hash) ([]byte, error)
+
 	// SignTx requests the wallet to sign the given transaction.
 	//
 	// It looks up the account specified either solely via its address contained within,
@@ -120,6 +143,13 @@ type Wallet interface {
 	// or optionally with the aid of any location metadata from the embedded URL field.
 	SignHashWithPassphrase(account Account, passphrase string, hash []byte) ([]byte, error)
 
+	// SignTextWithPassphrase requests the wallet to sign the hash of the given text
+	// with the given passphrase as extra authentication information.
+	//
+	// It looks up the account specified either solely via its address contained within,
+	// or optionally with the aid of any location metadata from the embedded URL field.
+	SignTextWithPassphrase(account Account, passphrase string, text []byte) ([]byte, error)
+
 	// SignTxWithPassphrase requests the wallet to sign the given transaction, with the
 	// given passphrase as extra authentication information.
 	//
@@ -128,6 +158,25 @@ type Wallet interface {
 	SignTxWithPassphrase(account Account, passphrase string, tx *types.Transaction, chainID *big.Int) (*types.Transaction, error)
 }
 
+// TextHash is a helper function that calculates a hash for the given message that
+// can be safely used to calculate a signature from.
+//
+// The hash is calculated as
+//   keccak256("\x19Wiseplat Signed Message:\n"${message length}${message}).
+//
+// This gives context to the signed message and prevents signing of transactions.
+func TextHash(data []byte) []byte {
+	msg := fmt.Sprintf("\x19Wiseplat Signed Message:\n%d%s", len(data), data)
+	return crypto.Keccak256([]byte(msg))
+}
+
+// TypedHash is a helper function that calculates the EIP-712 hash of a typed
+// message to sign, given the hashes of its domain separator and struct:
+//   keccak256("\x19\x01" ‖ domainSeparator ‖ hashStruct(message)).
+func TypedHash(domain, message common.Hash) []byte {
+	return crypto.Keccak256([]byte{0x19, 0x01}, domain[:], message[:])
+}
+
 // Backend is a "wallet provider" that may contain a batch of accounts they can
 // sign transactions with and upon request, do so.
 type Backend interface {
@@ -21,6 +21,7 @@ import (
 
 	wiseplat "github.com/wiseplat/go-wiseplat"
 	"github.com/wiseplat/go-wiseplat/accounts"
+	"github.com/wiseplat/go-wiseplat/common"
 	"github.com/wiseplat/go-wiseplat/core/types"
 )
 
@@ -94,6 +95,18 @@ func (w *keystoreWallet) SignHash(account accounts.Account, hash []byte) ([]byte
 	return w.keystore.SignHash(account, hash)
 }
 
+// SignText implements accounts.Wallet, attempting to sign the hash of the given
+// text with the given account.
+func (w *keystoreWallet) SignText(account accounts.Account, text []byte) ([]byte, error) {
+	return w.SignHash(account, accounts.TextHash(text))
+}
+
+// SignTypedHash implements accounts.Wallet, attempting to sign the EIP-712 hash
+// of a typed message with the given account.
+func (w *keystoreWallet) SignTypedHash(account accounts.Account, domain, message common.Hash) ([]byte, error) {
+	return w.SignHash(account, accounts.TypedHash(domain, message))
+}
+
 // SignTx implements accounts.Wallet, attempting to sign the given transaction
 // with the given account. If the wallet does not wrap this particular account,
 // an error is returned to avoid account leakage (even though in theory we may
@@ -124,6 +137,12 @@ func (w *keystoreWallet) SignHashWithPassphrase(account accounts.Account, passph
 	return w.keystore.SignHashWithPassphrase(account, passphrase, hash)
 }
 
+// SignTextWithPassphrase implements accounts.Wallet, attempting to sign the hash
+// of the given text with the given account using passphrase as extra authentication.
+func (w *keystoreWallet) SignTextWithPassphrase(account accounts.Account, passphrase string, text []byte) ([]byte, error) {
+	return w.SignHashWithPassphrase(account, passphrase, accounts.TextHash(text))
+}
+
 // SignTxWithPassphrase implements accounts.Wallet, attempting to sign the given
 // transaction with the given account using passphrase as extra authentication.
 func (w *keystoreWallet) SignTxWithPassphrase(account accounts.Account, passphrase string, tx *types.Transaction, chainID *big.Int) (*types.Transaction, error) {
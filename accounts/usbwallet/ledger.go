@@ -21,6 +21,7 @@
 package usbwallet
 
 import (
+	"bytes"
 	"encoding/binary"
 	"encoding/hex"
 	"errors"
@@ -51,11 +52,15 @@ const (
 	ledgerOpRetrieveAddress  ledgerOpcode = 0x02 // Returns the public key and Wiseplat address for a given BIP 32 path
 	ledgerOpSignTransaction  ledgerOpcode = 0x04 // Signs an Wiseplat transaction after having the user validate the parameters
 	ledgerOpGetConfiguration ledgerOpcode = 0x06 // Returns specific wallet application configuration
+	ledgerOpSignMessage      ledgerOpcode = 0x08 // Signs a personal message after having the user validate the content
+	ledgerOpSignTypedMessage ledgerOpcode = 0x0c // Signs the domain and message hashes of an EIP-712 typed message
 
 	ledgerP1DirectlyFetchAddress    ledgerParam1 = 0x00 // Return address directly from the wallet
 	ledgerP1ConfirmFetchAddress     ledgerParam1 = 0x01 // Require a user confirmation before returning the address
 	ledgerP1InitTransactionData     ledgerParam1 = 0x00 // First transaction data block for signing
 	ledgerP1ContTransactionData     ledgerParam1 = 0x80 // Subsequent transaction data block for signing
+	ledgerP1InitMessageData         ledgerParam1 = 0x00 // First message data block for signing
+	ledgerP1ContMessageData         ledgerParam1 = 0x80 // Subsequent message data block for signing
 	ledgerP2DiscardAddressChainCode ledgerParam2 = 0x00 // Do not return the chain code along with the address
 	ledgerP2ReturnAddressChainCode  ledgerParam2 = 0x01 // Require a user confirmation before returning the address
 )
@@ -107,6 +112,12 @@ func (w *ledgerDriver) offline() bool {
 	return w.version == [3]byte{0, 0, 0}
 }
 
+// atLeast returns whether the Wiseplat app running on the Ledger is of the given
+// version or newer.
+func (w *ledgerDriver) atLeast(major, minor, patch byte) bool {
+	return bytes.Compare(w.version[:], []byte{major, minor, patch}) >= 0
+}
+
 // Open implements usbwallet.driver, attempting to initialize the connection to the
 // Ledger hardware wallet. The Ledger does not require a user passphrase, so that
 // parameter is silently discarded.
@@ -163,13 +174,41 @@ func (w *ledgerDriver) SignTx(path accounts.DerivationPath, tx *types.Transactio
 		return common.Address{}, nil, accounts.ErrWalletClosed
 	}
 	// Ensure the wallet is capable of signing the given transaction
-	if chainID != nil && w.version[0] <= 1 && w.version[1] <= 0 && w.version[2] <= 2 {
+	if chainID != nil && !w.atLeast(1, 0, 3) {
 		return common.Address{}, nil, fmt.Errorf("Ledger v%d.%d.%d doesn't support signing this transaction, please update to v1.0.3 at least", w.version[0], w.version[1], w.version[2])
 	}
 	// All infos gathered and metadata checks out, request signing
 	return w.ledgerSign(path, tx, chainID)
 }
 
+// SignText implements usbwallet.driver, sending the text to the Ledger and
+// waiting for the user to confirm or deny signing it as a personal message.
+func (w *ledgerDriver) SignText(path accounts.DerivationPath, text []byte) ([]byte, error) {
+	// If the Wiseplat app doesn't run, abort
+	if w.offline() {
+		return nil, accounts.ErrWalletClosed
+	}
+	// Ensure the wallet is capable of signing personal messages
+	if !w.atLeast(1, 0, 8) {
+		return nil, fmt.Errorf("Ledger v%d.%d.%d doesn't support signing messages, please update to v1.0.8 at least", w.version[0], w.version[1], w.version[2])
+	}
+	return w.ledgerSignText(path, text)
+}
+
+// SignTypedHash implements usbwallet.driver, sending the hashes of the typed
+// message to the Ledger and waiting for the user to confirm or deny signing them.
+func (w *ledgerDriver) SignTypedHash(path accounts.DerivationPath, domain, message common.Hash) ([]byte, error) {
+	// If the Wiseplat app doesn't run, abort
+	if w.offline() {
+		return nil, accounts.ErrWalletClosed
+	}
+	// Ensure the wallet is capable of signing typed messages
+	if !w.atLeast(1, 5, 0) {
+		return nil, fmt.Errorf("Ledger v%d.%d.%d doesn't support signing typed messages, please update to v1.5.0 at least", w.version[0], w.version[1], w.version[2])
+	}
+	return w.ledgerSignTypedHash(path, domain, message)
+}
+
 // ledgerVersion retrieves the current version of the Wiseplat wallet app running
 // on the Ledger wallet.
 //
@@ -235,11 +274,8 @@ func (w *ledgerDriver) ledgerVersion() ([3]byte, error) {
 //   Chain code if requested | 32 bytes
 func (w *ledgerDriver) ledgerDerive(derivationPath []uint32) (common.Address, error) {
 	// Flatten the derivation path into the Ledger request
-	path := make([]byte, 1+4*len(derivationPath))
-	path[0] = byte(len(derivationPath))
-	for i, component := range derivationPath {
-		binary.BigEndian.PutUint32(path[1+4*i:], component)
-	}
+	path := ledgerPath(derivationPath)
+
 	// Send the request and wait for the response
 	reply, err := w.ledgerExchange(ledgerOpRetrieveAddress, ledgerP1DirectlyFetchAddress, ledgerP2DiscardAddressChainCode, path)
 	if err != nil {
@@ -299,11 +335,8 @@ func (w *ledgerDriver) ledgerDerive(derivationPath []uint32) (common.Address, er
 //   signature S | 32 bytes
 func (w *ledgerDriver) ledgerSign(derivationPath []uint32, tx *types.Transaction, chainID *big.Int) (common.Address, *types.Transaction, error) {
 	// Flatten the derivation path into the Ledger request
-	path := make([]byte, 1+4*len(derivationPath))
-	path[0] = byte(len(derivationPath))
-	for i, component := range derivationPath {
-		binary.BigEndian.PutUint32(path[1+4*i:], component)
-	}
+	path := ledgerPath(derivationPath)
+
 	// Create the transaction RLP based on whether legacy or EIP155 signing was requeste
 	var (
 		txrlp []byte
@@ -321,24 +354,9 @@ func (w *ledgerDriver) ledgerSign(derivationPath []uint32, tx *types.Transaction
 	payload := append(path, txrlp...)
 
 	// Send the request and wait for the response
-	var (
-		op    = ledgerP1InitTransactionData
-		reply []byte
-	)
-	for len(payload) > 0 {
-		// Calculate the size of the next data chunk
-		chunk := 255
-		if chunk > len(payload) {
-			chunk = len(payload)
-		}
-		// Send the chunk over, ensuring it's processed correctly
-		reply, err = w.ledgerExchange(ledgerOpSignTransaction, op, 0, payload[:chunk])
-		if err != nil {
-			return common.Address{}, nil, err
-		}
-		// Shift the payload and ensure subsequent chunks are marked as such
-		payload = payload[chunk:]
-		op = ledgerP1ContTransactionData
+	reply, err := w.ledgerStream(ledgerOpSignTransaction, ledgerP1InitTransactionData, ledgerP1ContTransactionData, payload)
+	if err != nil {
+		return common.Address{}, nil, err
 	}
 	// Extract the Wiseplat signature and do a sanity validation
 	if len(reply) != 65 {
@@ -346,13 +364,16 @@ func (w *ledgerDriver) ledgerSign(derivationPath []uint32, tx *types.Transaction
 	}
 	signature := append(reply[1:], reply[0])
 
-	// Create the correct signer and signature transform based on the chain ID
+	// Create the correct signer and signature transform based on the chain ID. The
+	// Ledger only returns the lowest byte of V, which still carries its parity for
+	// chain IDs not fitting into a byte: compute the recovery id modulo 256.
 	var signer types.Signer
 	if chainID == nil {
 		signer = new(types.HomesteadSigner)
 	} else {
 		signer = types.NewEIP155Signer(chainID)
-		signature[64] = signature[64] - byte(chainID.Uint64()*2+35)
+		offset := new(big.Int).Add(new(big.Int).Lsh(chainID, 1), big.NewInt(35))
+		signature[64] = signature[64] - byte(offset.Uint64())
 	}
 	signed, err := tx.WithSignature(signer, signature)
 	if err != nil {
@@ -365,6 +386,145 @@ func (w *ledgerDriver) ledgerSign(derivationPath []uint32, tx *types.Transaction
 	return sender, signed, nil
 }
 
+// ledgerSignText sends the text to the Ledger wallet, and waits for the user to
+// confirm or deny signing it as a personal message.
+//
+// The personal message signing protocol is defined as follows:
+//
+//   CLA | INS | P1 | P2 | Lc  | Le
+//   ----+-----+----+----+-----+---
+//    E0 | 08  | 00: first message data block
+//               80: subsequent message data block
+//                  | 00 | variable | variable
+//
+// Where the input for the first message block (first 255 bytes) is:
+//
+//   Description                                      | Length
+//   -------------------------------------------------+----------
+//   Number of BIP 32 derivations to perform (max 10) | 1 byte
+//   First derivation index (big endian)              | 4 bytes
+//   ...                                              | 4 bytes
+//   Last derivation index (big endian)               | 4 bytes
+//   Message length (big endian)                      | 4 bytes
+//   Message chunk                                    | arbitrary
+//
+// And the input for subsequent message blocks (first 255 bytes) are:
+//
+//   Description   | Length
+//   --------------+----------
+//   Message chunk | arbitrary
+//
+// And the output data is:
+//
+//   Description | Length
+//   ------------+---------
+//   signature V | 1 byte
+//   signature R | 32 bytes
+//   signature S | 32 bytes
+func (w *ledgerDriver) ledgerSignText(derivationPath []uint32, text []byte) ([]byte, error) {
+	// Flatten the derivation path and the message into the Ledger request
+	payload := ledgerPath(derivationPath)
+
+	var length [4]byte
+	binary.BigEndian.PutUint32(length[:], uint32(len(text)))
+	payload = append(append(payload, length[:]...), text...)
+
+	// Send the request and wait for the response
+	reply, err := w.ledgerStream(ledgerOpSignMessage, ledgerP1InitMessageData, ledgerP1ContMessageData, payload)
+	if err != nil {
+		return nil, err
+	}
+	return ledgerSignature(reply)
+}
+
+// ledgerSignTypedHash sends the hashes of an EIP-712 typed message to the Ledger
+// wallet, and waits for the user to confirm or deny signing them.
+//
+// The typed message signing protocol is defined as follows:
+//
+//   CLA | INS | P1 | P2 | Lc  | Le
+//   ----+-----+----+----+-----+---
+//    E0 | 0C  | 00 | 00 | variable | variable
+//
+// Where the input data is:
+//
+//   Description                                      | Length
+//   -------------------------------------------------+----------
+//   Number of BIP 32 derivations to perform (max 10) | 1 byte
+//   First derivation index (big endian)              | 4 bytes
+//   ...                                              | 4 bytes
+//   Last derivation index (big endian)               | 4 bytes
+//   Domain hash                                      | 32 bytes
+//   Message hash                                     | 32 bytes
+//
+// And the output data is:
+//
+//   Description | Length
+//   ------------+---------
+//   signature V | 1 byte
+//   signature R | 32 bytes
+//   signature S | 32 bytes
+func (w *ledgerDriver) ledgerSignTypedHash(derivationPath []uint32, domain, message common.Hash) ([]byte, error) {
+	// Flatten the derivation path and the hashes into the Ledger request
+	payload := ledgerPath(derivationPath)
+	payload = append(append(payload, domain[:]...), message[:]...)
+
+	// Send the request and wait for the response
+	reply, err := w.ledgerExchange(ledgerOpSignTypedMessage, 0, 0, payload)
+	if err != nil {
+		return nil, err
+	}
+	return ledgerSignature(reply)
+}
+
+// ledgerPath flattens a BIP 32 derivation path into the format expected by the
+// Ledger requests: the number of derivations followed by the big endian indices.
+func ledgerPath(derivationPath []uint32) []byte {
+	path := make([]byte, 1+4*len(derivationPath))
+	path[0] = byte(len(derivationPath))
+	for i, component := range derivationPath {
+		binary.BigEndian.PutUint32(path[1+4*i:], component)
+	}
+	return path
+}
+
+// ledgerSignature converts a V|R|S signature replied by the Ledger wallet for a
+// message into the R|S|V format, V being 0 or 1.
+func ledgerSignature(reply []byte) ([]byte, error) {
+	if len(reply) != 65 || (reply[0] != 27 && reply[0] != 28) {
+		return nil, errors.New("reply lacks signature")
+	}
+	signature := append(reply[1:], reply[0]-27)
+	return signature, nil
+}
+
+// ledgerStream sends a payload to the Ledger wallet split into 255 byte blocks,
+// the first one marked with init and the subsequent ones with cont, returning
+// the reply to the last block.
+func (w *ledgerDriver) ledgerStream(opcode ledgerOpcode, init, cont ledgerParam1, payload []byte) ([]byte, error) {
+	var (
+		op    = init
+		reply []byte
+		err   error
+	)
+	for len(payload) > 0 {
+		// Calculate the size of the next data chunk
+		chunk := 255
+		if chunk > len(payload) {
+			chunk = len(payload)
+		}
+		// Send the chunk over, ensuring it's processed correctly
+		reply, err = w.ledgerExchange(opcode, op, 0, payload[:chunk])
+		if err != nil {
+			return nil, err
+		}
+		// Shift the payload and ensure subsequent chunks are marked as such
+		payload = payload[chunk:]
+		op = cont
+	}
+	return reply, nil
+}
+
 // ledgerExchange performs a data exchange with the Ledger wallet, sending it a
 // message and retrieving the response.
 //
@@ -0,0 +1,148 @@
+// Copyright 2018 The go-wiseplat Authors
+// This file is part of the go-wiseplat library.
+//
+// The go-wiseplat library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-wiseplat library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-wiseplat library. If not, see <http://www.gnu.org/licenses/>.
+
+package usbwallet
+
+import (
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/wiseplat/go-wiseplat/accounts"
+	"github.com/wiseplat/go-wiseplat/common"
+	"github.com/wiseplat/go-wiseplat/core/types"
+	"github.com/wiseplat/go-wiseplat/crypto"
+	"github.com/wiseplat/go-wiseplat/log"
+)
+
+// Recorded exchange of a Ledger signing a personal message of 306 bytes, which
+// needs to be streamed in two data blocks.
+var ledgerSignTextScript = []string{
+	"> 01010500000104e0080000ff058000002c8000003c8000000000000000000000000000013248617264776172652077616c6c657473207368616c6c207369676e",
+	"> 010105000120706572736f6e616c206d6573736167657320746f6f212048617264776172652077616c6c657473207368616c6c207369676e20706572736f6e61",
+	"> 01010500026c206d6573736167657320746f6f212048617264776172652077616c6c657473207368616c6c207369676e20706572736f6e616c206d6573736167",
+	"> 0101050003657320746f6f212048617264776172652077616c6c657473207368616c6c207369676e20706572736f6e616c206d6573736167657320746f6f2120",
+	"> 010105000448617264776172652077616c6c657473207368616c6c20736967",
+	"< 01010500000002900000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000",
+	"> 01010500000051e00880004c6e20706572736f6e616c206d6573736167657320746f6f212048617264776172652077616c6c657473207368616c6c207369676e",
+	"> 010105000120706572736f6e616c206d6573736167657320746f6f2120",
+	"< 010105000000431b45bbcdff5bdd5730b809000c2b7a63e5354c3cd2405b80c406c8d7c311ac67df351c274e110159abfc8ece2094bcfd768c68335e05b4e400",
+	"< 01010500013a2f10f4bf6c4000900000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000",
+}
+
+// Recorded exchange of a Ledger signing the hashes of a typed message.
+var ledgerSignTypedHashScript = []string{
+	"> 0101050000005ae00c000055058000002c8000003c800000000000000000000000c5d3ba30d3ac69f3f095a61e99369d9450502ca0c2f4768b2c39ee277faa63",
+	"> 01010500011dc2baf6c66618acd49fb133cebc22f55bd907fe9f0d69a726d45b7539ba6bbe08",
+	"< 010105000000431ccd678dfdb7692346af37ef8427e9e59f22407112832b5c1059ac00fd926c1c701545ff96f3bae03e78752ef09ecfe3c0e23ab21324c77239",
+	"< 01010500011647b40bf7753956900000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000",
+}
+
+// Recorded exchange of a Ledger signing an EIP-155 transaction with a chain ID
+// not fitting into the single byte V replied by the device.
+var ledgerSignTxScript = []string{
+	"> 0101050000004ae004000045058000002c8000003c800000000000000000000000ef038504a817c8008252089412345678901234567890123456789012345678",
+	"> 010105000190880de0b6b3a764000080830f42408080",
+	"< 01010500000043a3526d69afedb731319fbd433d40118f7e15b56cd2587402c6e76f5452fcbf601f0ab9e46de65dc485ce9461800f0d8bd229d3cd49bee993f9",
+	"< 010105000143f451a74e392339900000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000",
+}
+
+// newTestLedger creates a Ledger driver running a given version of the Wiseplat
+// app, communicating through a replayed exchange.
+func newTestLedger(device *replayDevice, version [3]byte) *ledgerDriver {
+	return &ledgerDriver{
+		device:  device,
+		version: version,
+		log:     log.New(),
+	}
+}
+
+// Tests that personal messages are streamed to the Ledger and that the replied
+// signature is converted to the R|S|V format.
+func TestLedgerSignText(t *testing.T) {
+	device := &replayDevice{t: t, script: ledgerSignTextScript}
+	text := []byte(strings.Repeat("Hardware wallets shall sign personal messages too! ", 6))
+
+	signature, err := newTestLedger(device, [3]byte{1, 0, 8}).SignText(accounts.DefaultBaseDerivationPath, text)
+	if err != nil {
+		t.Fatalf("failed to sign text: %v", err)
+	}
+	device.done()
+
+	if err := checkSigner(accounts.Account{Address: testSigner}, accounts.TextHash(text), signature); err != nil {
+		t.Errorf("invalid signature: %v", err)
+	}
+}
+
+// Tests that the hashes of typed messages are sent to the Ledger and that the
+// replied signature is converted to the R|S|V format.
+func TestLedgerSignTypedHash(t *testing.T) {
+	device := &replayDevice{t: t, script: ledgerSignTypedHashScript}
+	domain, message := crypto.Keccak256Hash([]byte("domain")), crypto.Keccak256Hash([]byte("message"))
+
+	signature, err := newTestLedger(device, [3]byte{1, 5, 0}).SignTypedHash(accounts.DefaultBaseDerivationPath, domain, message)
+	if err != nil {
+		t.Fatalf("failed to sign typed hash: %v", err)
+	}
+	device.done()
+
+	if err := checkSigner(accounts.Account{Address: testSigner}, accounts.TypedHash(domain, message), signature); err != nil {
+		t.Errorf("invalid signature: %v", err)
+	}
+}
+
+// Tests that EIP-155 transactions are signed correctly even if the chain ID is
+// too large for the Ledger to reply the entire V value.
+func TestLedgerSignTxLargeChainID(t *testing.T) {
+	device := &replayDevice{t: t, script: ledgerSignTxScript}
+
+	chainID := big.NewInt(1000000)
+	tx := types.NewTransaction(3, common.HexToAddress("0x1234567890123456789012345678901234567890"), big.NewInt(1000000000000000000), big.NewInt(21000), big.NewInt(20000000000), nil)
+
+	sender, signed, err := newTestLedger(device, [3]byte{1, 0, 3}).SignTx(accounts.DefaultBaseDerivationPath, tx, chainID)
+	if err != nil {
+		t.Fatalf("failed to sign transaction: %v", err)
+	}
+	device.done()
+
+	if sender != testSigner {
+		t.Errorf("sender mismatch: have %x, want %x", sender, testSigner)
+	}
+	if v, _, _ := signed.RawSignatureValues(); v.Cmp(big.NewInt(2000035)) != 0 {
+		t.Errorf("signature V mismatch: have %v, want %v", v, 2000035)
+	}
+}
+
+// Tests that signing requests unsupported by the version of the Wiseplat app
+// running on the Ledger are rejected without contacting the device.
+func TestLedgerOutdatedSigning(t *testing.T) {
+	path := accounts.DefaultBaseDerivationPath
+
+	device := &replayDevice{t: t}
+	if _, err := newTestLedger(device, [3]byte{1, 0, 7}).SignText(path, []byte("Hello Wiseplat")); err == nil {
+		t.Errorf("personal message signed by v1.0.7")
+	}
+	if _, err := newTestLedger(device, [3]byte{1, 4, 9}).SignTypedHash(path, common.Hash{}, common.Hash{}); err == nil {
+		t.Errorf("typed message signed by v1.4.9")
+	}
+	tx := types.NewTransaction(0, common.Address{}, big.NewInt(0), big.NewInt(21000), big.NewInt(1), nil)
+	if _, _, err := newTestLedger(device, [3]byte{1, 0, 2}).SignTx(path, tx, big.NewInt(1)); err == nil {
+		t.Errorf("EIP-155 transaction signed by v1.0.2")
+	}
+	if _, err := newTestLedger(device, [3]byte{}).SignText(path, []byte("Hello Wiseplat")); err != accounts.ErrWalletClosed {
+		t.Errorf("offline signing error mismatch: have %v, want %v", err, accounts.ErrWalletClosed)
+	}
+}
@@ -25,6 +25,7 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"math"
 	"math/big"
 
 	"github.com/wiseplat/go-wiseplat/accounts"
@@ -159,6 +160,21 @@ func (w *trezorDriver) SignTx(path accounts.DerivationPath, tx *types.Transactio
 	return w.trezorSign(path, tx, chainID)
 }
 
+// SignText implements usbwallet.driver, sending the text to the Trezor and
+// waiting for the user to confirm or deny signing it as a personal message.
+func (w *trezorDriver) SignText(path accounts.DerivationPath, text []byte) ([]byte, error) {
+	if w.device == nil {
+		return nil, accounts.ErrWalletClosed
+	}
+	return w.trezorSignText(path, text)
+}
+
+// SignTypedHash implements usbwallet.driver, however the Trezor protocol has no
+// support for signing EIP-712 typed messages, so this method always fails.
+func (w *trezorDriver) SignTypedHash(path accounts.DerivationPath, domain, message common.Hash) ([]byte, error) {
+	return nil, accounts.ErrNotSupported
+}
+
 // trezorDerive sends a derivation request to the Trezor device and returns the
 // Wiseplat address located on that path.
 func (w *trezorDriver) trezorDerive(derivationPath []uint32) (common.Address, error) {
@@ -193,7 +209,10 @@ func (w *trezorDriver) trezorSign(derivationPath []uint32, tx *types.Transaction
 		request.DataInitialChunk, data = data, nil
 	}
 	if chainID != nil { // EIP-155 transaction, set chain ID explicitly (only 32 bit is supported!?)
-		id := uint32(chainID.Int64())
+		if !chainID.IsUint64() || chainID.Uint64() > math.MaxUint32 {
+			return common.Address{}, nil, fmt.Errorf("trezor: chain ID %v doesn't fit into 32 bits", chainID)
+		}
+		id := uint32(chainID.Uint64())
 		request.ChainId = &id
 	}
 	// Send the initiation message and stream content until a signature is returned
@@ -235,6 +254,23 @@ func (w *trezorDriver) trezorSign(derivationPath []uint32, tx *types.Transaction
 	return sender, signed, nil
 }
 
+// trezorSignText sends the text to the Trezor wallet, and waits for the user to
+// confirm or deny signing it as a personal message.
+func (w *trezorDriver) trezorSignText(derivationPath []uint32, text []byte) ([]byte, error) {
+	response := new(trezor.WiseplatMessageSignature)
+	if _, err := w.trezorExchange(&trezor.WiseplatSignMessage{AddressN: derivationPath, Message: text}, response); err != nil {
+		return nil, err
+	}
+	// Extract the Wiseplat signature and do a sanity validation
+	signature := response.GetSignature()
+	if len(signature) != 65 || (signature[64] != 27 && signature[64] != 28) {
+		return nil, errors.New("reply lacks signature")
+	}
+	signature = common.CopyBytes(signature)
+	signature[64] -= 27
+	return signature, nil
+}
+
 // trezorExchange performs a data exchange with the Trezor wallet, sending it a
 // message and retrieving the response. If multiple responses are possible, the
 // method will also return the index of the destination object used.
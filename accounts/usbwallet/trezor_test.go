@@ -0,0 +1,77 @@
+// Copyright 2018 The go-wiseplat Authors
+// This file is part of the go-wiseplat library.
+//
+// The go-wiseplat library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-wiseplat library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-wiseplat library. If not, see <http://www.gnu.org/licenses/>.
+
+package usbwallet
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/wiseplat/go-wiseplat/accounts"
+	"github.com/wiseplat/go-wiseplat/common"
+	"github.com/wiseplat/go-wiseplat/core/types"
+	"github.com/wiseplat/go-wiseplat/log"
+)
+
+// Recorded exchange of a Trezor signing a personal message, requesting the user
+// to confirm the operation in between.
+var trezorSignTextScript = []string{
+	"> 3f232300400000002408ac8080800808bc8080800808808080800808000800120c48656c6c6f205472657a6f7200000000000000000000000000000000000000",
+	"< 3f2323001a0000000208070000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000",
+	"> 3f2323001b0000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000",
+	"< 3f23230042000000590a1471562b71999873db5b286df957af199ec94617f712412bddafe926f7fd947673ae8e503ab4529d5c03d81f248f4f120ddd1abe1923",
+	"< 3ff77825f2f41a39abf1e926bfb52227db1fb9ffa4a0395dbb9abd0498862bafb5951b0000000000000000000000000000000000000000000000000000000000",
+}
+
+// newTestTrezor creates a Trezor driver communicating through a replayed exchange.
+func newTestTrezor(device *replayDevice) *trezorDriver {
+	return &trezorDriver{
+		device: device,
+		log:    log.New(),
+	}
+}
+
+// Tests that personal messages are signed by the Trezor, acknowledging the button
+// request, and that the replied signature is converted to have V as 0 or 1.
+func TestTrezorSignText(t *testing.T) {
+	device := &replayDevice{t: t, script: trezorSignTextScript}
+	text := []byte("Hello Trezor")
+
+	signature, err := newTestTrezor(device).SignText(accounts.DefaultBaseDerivationPath, text)
+	if err != nil {
+		t.Fatalf("failed to sign text: %v", err)
+	}
+	device.done()
+
+	if err := checkSigner(accounts.Account{Address: testSigner}, accounts.TextHash(text), signature); err != nil {
+		t.Errorf("invalid signature: %v", err)
+	}
+}
+
+// Tests that signing requests the Trezor protocol can't express are rejected
+// without contacting the device.
+func TestTrezorUnsupportedSigning(t *testing.T) {
+	path := accounts.DefaultBaseDerivationPath
+
+	device := &replayDevice{t: t}
+	if _, err := newTestTrezor(device).SignTypedHash(path, common.Hash{}, common.Hash{}); err != accounts.ErrNotSupported {
+		t.Errorf("typed signing error mismatch: have %v, want %v", err, accounts.ErrNotSupported)
+	}
+	tx := types.NewTransaction(0, common.Address{}, big.NewInt(0), big.NewInt(21000), big.NewInt(1), nil)
+	if _, _, err := newTestTrezor(device).SignTx(path, tx, new(big.Int).Lsh(big.NewInt(1), 32)); err == nil {
+		t.Errorf("transaction signed with a chain ID not fitting into 32 bits")
+	}
+}
@@ -29,6 +29,7 @@ import (
 	"github.com/wiseplat/go-wiseplat/accounts"
 	"github.com/wiseplat/go-wiseplat/common"
 	"github.com/wiseplat/go-wiseplat/core/types"
+	"github.com/wiseplat/go-wiseplat/crypto"
 	"github.com/wiseplat/go-wiseplat/log"
 	"github.com/karalabe/hid"
 )
@@ -66,6 +67,16 @@ type driver interface {
 	// SignTx sends the transaction to the USB device and waits for the user to confirm
 	// or deny the transaction.
 	SignTx(path accounts.DerivationPath, tx *types.Transaction, chainID *big.Int) (common.Address, *types.Transaction, error)
+
+	// SignText sends the text to the USB device and waits for the user to confirm
+	// or deny signing it as a personal message. The V of the returned signature is
+	// expected to be 0 or 1.
+	SignText(path accounts.DerivationPath, text []byte) ([]byte, error)
+
+	// SignTypedHash sends the domain and message hashes of an EIP-712 typed message
+	// to the USB device and waits for the user to confirm or deny signing them. The
+	// V of the returned signature is expected to be 0 or 1.
+	SignTypedHash(path accounts.DerivationPath, domain, message common.Hash) ([]byte, error)
 }
 
 // wallet represents the common functionality shared by all USB hardware
@@ -501,6 +512,45 @@ func (w *wallet) SignHash(account accounts.Account, hash []byte) ([]byte, error)
 	return nil, accounts.ErrNotSupported
 }
 
+// SignText implements accounts.Wallet. It sends the text over to the hardware
+// wallet to request a confirmation from the user. It returns either the signature
+// or a failure if the user denied signing.
+func (w *wallet) SignText(account accounts.Account, text []byte) ([]byte, error) {
+	var signature []byte
+	err := w.withDevice(account, func(path accounts.DerivationPath) (err error) {
+		signature, err = w.driver.SignText(path, text)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := checkSigner(account, accounts.TextHash(text), signature); err != nil {
+		return nil, err
+	}
+	return signature, nil
+}
+
+// SignTypedHash implements accounts.Wallet. It sends the hashes of the typed
+// message over to the hardware wallet to request a confirmation from the user.
+// It returns either the signature or a failure if the user denied signing.
+//
+// Note, not all hardware wallets are capable of signing typed messages, in which
+// case accounts.ErrNotSupported is returned.
+func (w *wallet) SignTypedHash(account accounts.Account, domain, message common.Hash) ([]byte, error) {
+	var signature []byte
+	err := w.withDevice(account, func(path accounts.DerivationPath) (err error) {
+		signature, err = w.driver.SignTypedHash(path, domain, message)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := checkSigner(account, accounts.TypedHash(domain, message), signature); err != nil {
+		return nil, err
+	}
+	return signature, nil
+}
+
 // SignTx implements accounts.Wallet. It sends the transaction over to the Ledger
 // wallet to request a confirmation from the user. It returns either the signed
 // transaction or a failure if the user denied the transaction.
@@ -509,17 +559,38 @@ func (w *wallet) SignHash(account accounts.Account, hash []byte) ([]byte, error)
 // too old to sign EIP-155 transactions, but such is requested nonetheless, an error
 // will be returned opposed to silently signing in Homestead mode.
 func (w *wallet) SignTx(account accounts.Account, tx *types.Transaction, chainID *big.Int) (*types.Transaction, error) {
+	var (
+		sender common.Address
+		signed *types.Transaction
+	)
+	err := w.withDevice(account, func(path accounts.DerivationPath) (err error) {
+		sender, signed, err = w.driver.SignTx(path, tx, chainID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	// Verify the sender to avoid hardware fault surprises
+	if sender != account.Address {
+		return nil, fmt.Errorf("signer mismatch: expected %s, got %s", account.Address.Hex(), sender.Hex())
+	}
+	return signed, nil
+}
+
+// withDevice looks up the derivation path of an account and runs a signing
+// operation on the device with it, holding exclusive access to the device.
+func (w *wallet) withDevice(account accounts.Account, sign func(path accounts.DerivationPath) error) error {
 	w.stateLock.RLock() // Comms have own mutex, this is for the state fields
 	defer w.stateLock.RUnlock()
 
 	// If the wallet is closed, abort
 	if w.device == nil {
-		return nil, accounts.ErrWalletClosed
+		return accounts.ErrWalletClosed
 	}
 	// Make sure the requested account is contained within
 	path, ok := w.paths[account.Address]
 	if !ok {
-		return nil, accounts.ErrUnknownAccount
+		return accounts.ErrUnknownAccount
 	}
 	// All infos gathered and metadata checks out, request signing
 	<-w.commsLock
@@ -536,15 +607,20 @@ func (w *wallet) SignTx(account accounts.Account, tx *types.Transaction, chainID
 		w.hub.commsPend--
 		w.hub.commsLock.Unlock()
 	}()
-	// Sign the transaction and verify the sender to avoid hardware fault surprises
-	sender, signed, err := w.driver.SignTx(path, tx, chainID)
+	return sign(path)
+}
+
+// checkSigner recovers the signer of a hash from a signature produced by the
+// device to avoid hardware fault surprises, ensuring it's the expected account.
+func checkSigner(account accounts.Account, hash []byte, signature []byte) error {
+	pubkey, err := crypto.SigToPub(hash, signature)
 	if err != nil {
-		return nil, err
+		return err
 	}
-	if sender != account.Address {
-		return nil, fmt.Errorf("signer mismatch: expected %s, got %s", account.Address.Hex(), sender.Hex())
+	if signer := crypto.PubkeyToAddress(*pubkey); signer != account.Address {
+		return fmt.Errorf("signer mismatch: expected %s, got %s", account.Address.Hex(), signer.Hex())
 	}
-	return signed, nil
+	return nil
 }
 
 // SignHashWithPassphrase implements accounts.Wallet, however signing arbitrary
@@ -554,6 +630,13 @@ func (w *wallet) SignHashWithPassphrase(account accounts.Account, passphrase str
 	return w.SignHash(account, hash)
 }
 
+// SignTextWithPassphrase implements accounts.Wallet, attempting to sign the given
+// text with the given account using passphrase as extra authentication. Since USB
+// wallets don't rely on passphrases, these are silently ignored.
+func (w *wallet) SignTextWithPassphrase(account accounts.Account, passphrase string, text []byte) ([]byte, error) {
+	return w.SignText(account, text)
+}
+
 // SignTxWithPassphrase implements accounts.Wallet, attempting to sign the given
 // transaction with the given account using passphrase as extra authentication.
 // Since USB wallets don't rely on passphrases, these are silently ignored.
@@ -0,0 +1,107 @@
+// Copyright 2018 The go-wiseplat Authors
+// This file is part of the go-wiseplat library.
+//
+// The go-wiseplat library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-wiseplat library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-wiseplat library. If not, see <http://www.gnu.org/licenses/>.
+
+package usbwallet
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/wiseplat/go-wiseplat/accounts"
+	"github.com/wiseplat/go-wiseplat/common"
+	"github.com/wiseplat/go-wiseplat/crypto"
+)
+
+// testSigner is the address of the key the recorded device exchanges were signed
+// with: b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291.
+var testSigner = common.HexToAddress("0x71562b71999873DB5b286dF957af199Ec94617F7")
+
+// replayDevice is a mock USB transport replaying a recorded exchange with a
+// hardware wallet. Each step of the script is a hex encoded 64 byte chunk either
+// prefixed with "> " if it's expected to be written by the driver, or with "< "
+// if it's to be read back by the driver as the reply of the wallet.
+type replayDevice struct {
+	t      *testing.T
+	script []string
+}
+
+// next pops the next step from the script, ensuring it's of the requested kind.
+func (d *replayDevice) next(kind string) ([]byte, error) {
+	if len(d.script) == 0 {
+		d.t.Errorf("unexpected %q step after the end of the script", kind)
+		return nil, fmt.Errorf("script exhausted")
+	}
+	step := d.script[0]
+	if !strings.HasPrefix(step, kind+" ") {
+		d.t.Errorf("unexpected %q step, script expects %q", kind, step)
+		return nil, fmt.Errorf("script mismatch")
+	}
+	d.script = d.script[1:]
+	return hex.DecodeString(step[len(kind)+1:])
+}
+
+// Write implements io.Writer, checking the chunk against the next recorded one.
+func (d *replayDevice) Write(chunk []byte) (int, error) {
+	want, err := d.next(">")
+	if err != nil {
+		return 0, err
+	}
+	if !bytes.Equal(chunk, want) {
+		d.t.Errorf("written chunk mismatch: have %x, want %x", chunk, want)
+		return 0, fmt.Errorf("chunk mismatch")
+	}
+	return len(chunk), nil
+}
+
+// Read implements io.Reader, returning the next recorded reply chunk.
+func (d *replayDevice) Read(chunk []byte) (int, error) {
+	reply, err := d.next("<")
+	if err != nil {
+		return 0, err
+	}
+	return copy(chunk, reply), nil
+}
+
+// done ensures the driver went through the entire recorded exchange.
+func (d *replayDevice) done() {
+	if len(d.script) > 0 {
+		d.t.Errorf("recorded exchange not finished, %d steps left", len(d.script))
+	}
+}
+
+// Tests that signatures replied by a device are checked to belong to the account
+// requesting them.
+func TestCheckSigner(t *testing.T) {
+	key, _ := crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+	hash := accounts.TextHash([]byte("Hello Wiseplat"))
+
+	signature, err := crypto.Sign(hash, key)
+	if err != nil {
+		t.Fatalf("failed to sign hash: %v", err)
+	}
+	if err := checkSigner(accounts.Account{Address: testSigner}, hash, signature); err != nil {
+		t.Errorf("valid signature rejected: %v", err)
+	}
+	if err := checkSigner(accounts.Account{Address: common.Address{0x01}}, hash, signature); err == nil {
+		t.Errorf("foreign signature accepted")
+	}
+	if err := checkSigner(accounts.Account{Address: testSigner}, accounts.TextHash([]byte("Hello")), signature); err == nil {
+		t.Errorf("signature of different message accepted")
+	}
+}
@@ -0,0 +1,120 @@
+// Copyright 2018 The go-wiseplat Authors
+// This file is part of go-wiseplat.
+//
+// go-wiseplat is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-wiseplat is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-wiseplat. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"io/ioutil"
+	"strings"
+
+	"github.com/wiseplat/go-wiseplat/accounts/keystore"
+	"github.com/wiseplat/go-wiseplat/cmd/utils"
+	"github.com/wiseplat/go-wiseplat/common"
+	"github.com/wiseplat/go-wiseplat/console"
+	"github.com/wiseplat/go-wiseplat/contracts/checkpointoracle"
+	"github.com/wiseplat/go-wiseplat/params"
+	"github.com/wiseplat/go-wiseplat/rpc"
+	"github.com/wiseplat/go-wiseplat/wshclient"
+	"gopkg.in/urfave/cli.v1"
+)
+
+// newRPCClient creates an rpc client with specified node URL.
+func newRPCClient(url string) *rpc.Client {
+	client, err := rpc.Dial(url)
+	if err != nil {
+		utils.Fatalf("Failed to connect to Wiseplat node: %v", err)
+	}
+	return client
+}
+
+// getContractAddr retrieves the address of the checkpoint oracle, either from
+// the command line or from the connected LES server.
+func getContractAddr(ctx *cli.Context, client *rpc.Client) common.Address {
+	if ctx.GlobalIsSet(oracleFlag.Name) {
+		addr := ctx.GlobalString(oracleFlag.Name)
+		if !common.IsHexAddress(addr) {
+			utils.Fatalf("Invalid oracle address %q", addr)
+		}
+		return common.HexToAddress(addr)
+	}
+	var addr common.Address
+	if err := client.Call(&addr, "les_getCheckpointContractAddress"); err != nil {
+		utils.Fatalf("Failed to fetch checkpoint oracle address: %v", err)
+	}
+	return addr
+}
+
+// getCheckpoint retrieves the locally generated checkpoint of the specified
+// section from the connected LES server.
+func getCheckpoint(ctx *cli.Context, client *rpc.Client) *params.TrustedCheckpoint {
+	index := ctx.Int64(indexFlag.Name)
+	if index < 0 {
+		utils.Fatalf("Missing checkpoint section index (--%s)", indexFlag.Name)
+	}
+	var checkpoint params.TrustedCheckpoint
+	if err := client.Call(&checkpoint, "les_getCheckpoint", uint64(index)); err != nil {
+		utils.Fatalf("Failed to fetch local checkpoint %d: %v", index, err)
+	}
+	return &checkpoint
+}
+
+// newContract binds the checkpoint oracle through the connected node.
+func newContract(ctx *cli.Context, client *rpc.Client) (common.Address, *checkpointoracle.CheckpointOracle) {
+	addr := getContractAddr(ctx, client)
+	contract, err := checkpointoracle.NewCheckpointOracle(addr, wshclient.NewClient(client))
+	if err != nil {
+		utils.Fatalf("Failed to setup registrar contract %s: %v", addr.Hex(), err)
+	}
+	return addr, contract
+}
+
+// getKey retrieves the user key through specified key file.
+func getKey(ctx *cli.Context) *keystore.Key {
+	// Read key from file.
+	keyFile := ctx.String(keyFileFlag.Name)
+	if keyFile == "" {
+		utils.Fatalf("Missing private key file (--%s)", keyFileFlag.Name)
+	}
+	keyJson, err := ioutil.ReadFile(keyFile)
+	if err != nil {
+		utils.Fatalf("Failed to read the keyfile at '%s': %v", keyFile, err)
+	}
+	// Decrypt key with passphrase.
+	passphrase := getPassphrase(ctx)
+	key, err := keystore.DecryptKey(keyJson, passphrase)
+	if err != nil {
+		utils.Fatalf("Failed to decrypt user key '%s': %v", keyFile, err)
+	}
+	return key
+}
+
+// getPassphrase obtains a passphrase given by the user. It first checks the
+// --password command line flag and ultimately prompts the user for a passphrase.
+func getPassphrase(ctx *cli.Context) string {
+	passphraseFile := ctx.String(passwordFileFlag.Name)
+	if passphraseFile != "" {
+		content, err := ioutil.ReadFile(passphraseFile)
+		if err != nil {
+			utils.Fatalf("Failed to read passphrase file '%s': %v", passphraseFile, err)
+		}
+		return strings.TrimRight(string(content), "\r\n")
+	}
+	passphrase, err := console.Stdin.PromptPassword("Passphrase: ")
+	if err != nil {
+		utils.Fatalf("Failed to read passphrase: %v", err)
+	}
+	return passphrase
+}
@@ -0,0 +1,277 @@
+// Copyright 2018 The go-wiseplat Authors
+// This file is part of go-wiseplat.
+//
+// go-wiseplat is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-wiseplat is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-wiseplat. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"math/big"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/wiseplat/go-wiseplat/accounts/abi/bind"
+	"github.com/wiseplat/go-wiseplat/cmd/utils"
+	"github.com/wiseplat/go-wiseplat/common"
+	"github.com/wiseplat/go-wiseplat/common/hexutil"
+	"github.com/wiseplat/go-wiseplat/contracts/checkpointoracle"
+	"github.com/wiseplat/go-wiseplat/contracts/checkpointoracle/contract"
+	"github.com/wiseplat/go-wiseplat/crypto"
+	"github.com/wiseplat/go-wiseplat/light"
+	"github.com/wiseplat/go-wiseplat/log"
+	"github.com/wiseplat/go-wiseplat/wshclient"
+	"gopkg.in/urfave/cli.v1"
+)
+
+var commandStatus = cli.Command{
+	Name:  "status",
+	Usage: "Fetches the signers and checkpoint status of the oracle contract",
+	Flags: []cli.Flag{
+		nodeURLFlag,
+	},
+	Action: utils.MigrateFlags(status),
+}
+
+var commandDeploy = cli.Command{
+	Name:  "deploy",
+	Usage: "Deploy a new checkpoint oracle contract",
+	Flags: []cli.Flag{
+		nodeURLFlag,
+		keyFileFlag,
+		passwordFileFlag,
+		signersFlag,
+		thresholdFlag,
+	},
+	Action: utils.MigrateFlags(deploy),
+}
+
+var commandSign = cli.Command{
+	Name:  "sign",
+	Usage: "Sign the checkpoint with the specified key",
+	Flags: []cli.Flag{
+		nodeURLFlag,
+		oracleFlag,
+		indexFlag,
+		keyFileFlag,
+		passwordFileFlag,
+	},
+	Action: utils.MigrateFlags(sign),
+}
+
+var commandPublish = cli.Command{
+	Name:  "publish",
+	Usage: "Publish a checkpoint into the oracle",
+	Flags: []cli.Flag{
+		nodeURLFlag,
+		oracleFlag,
+		indexFlag,
+		signaturesFlag,
+		keyFileFlag,
+		passwordFileFlag,
+	},
+	Action: utils.MigrateFlags(publish),
+}
+
+// status fetches the admin list and the latest checkpoint of the oracle.
+func status(ctx *cli.Context) error {
+	client := newRPCClient(ctx.GlobalString(nodeURLFlag.Name))
+	addr, oracle := newContract(ctx, client)
+	fmt.Printf("Oracle => %s\n", addr.Hex())
+	fmt.Println()
+
+	// Retrieve the list of authorized signers (admins)
+	admins, err := oracle.Contract().GetAllAdmin(nil)
+	if err != nil {
+		return err
+	}
+	for i, admin := range admins {
+		fmt.Printf("Admin %d => %s\n", i+1, admin.Hex())
+	}
+	fmt.Println()
+
+	// Retrieve the latest checkpoint
+	index, checkpoint, height, err := oracle.Contract().GetLatestCheckpoint(nil)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Checkpoint (published at #%d) %d => %s\n", height, index, common.Hash(checkpoint).Hex())
+	return nil
+}
+
+// deploy deploys the checkpoint oracle contract.
+//
+// Note the section size and processing confirmations of the oracle are those
+// used by the light client protocol for CHTs and BloomTries.
+func deploy(ctx *cli.Context) error {
+	// Gather all the addresses that should be permitted to sign
+	var addrs []common.Address
+	for _, account := range strings.Split(ctx.String(signersFlag.Name), ",") {
+		trimmed := strings.TrimSpace(account)
+		if !common.IsHexAddress(trimmed) {
+			utils.Fatalf("Invalid account in --signers: '%s'", trimmed)
+		}
+		addrs = append(addrs, common.HexToAddress(trimmed))
+	}
+	// Retrieve and validate the signing threshold
+	needed := ctx.Uint64(thresholdFlag.Name)
+	if needed == 0 || needed > uint64(len(addrs)) {
+		utils.Fatalf("Invalid signature threshold %d", needed)
+	}
+	// Print a summary to ensure the user understands what they're signing
+	fmt.Printf("Deploying new checkpoint oracle:\n\n")
+	for i, addr := range addrs {
+		fmt.Printf("Admin %d => %s\n", i+1, addr.Hex())
+	}
+	fmt.Printf("\nSignatures needed to publish: %d\n", needed)
+
+	// Deploy the checkpoint oracle
+	key := getKey(ctx)
+	client := wshclient.NewClient(newRPCClient(ctx.GlobalString(nodeURLFlag.Name)))
+
+	oracle, tx, _, err := contract.DeployCheckpointOracle(bind.NewKeyedTransactor(key.PrivateKey), client, addrs, big.NewInt(light.ChtFrequency), big.NewInt(light.HelperTrieProcessConfirmations), new(big.Int).SetUint64(needed))
+	if err != nil {
+		utils.Fatalf("Failed to deploy checkpoint oracle %v", err)
+	}
+	log.Info("Deployed checkpoint oracle", "address", oracle, "tx", tx.Hash().Hex())
+
+	timeout, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+	if _, err := bind.WaitDeployed(timeout, client, tx); err != nil {
+		utils.Fatalf("Checkpoint oracle deployment failed: %v", err)
+	}
+	return nil
+}
+
+// sign creates the signature for specific checkpoint with local key. The
+// checkpoint is taken from the connected LES server, which has to be fully
+// synced and have the requested section indexed.
+func sign(ctx *cli.Context) error {
+	client := newRPCClient(ctx.GlobalString(nodeURLFlag.Name))
+	addr := getContractAddr(ctx, client)
+	checkpoint := getCheckpoint(ctx, client)
+	hash := checkpoint.Hash()
+
+	fmt.Printf("Oracle     => %s\n", addr.Hex())
+	fmt.Printf("Index      => %d\n", checkpoint.SectionIndex)
+	fmt.Printf("Head       => %s\n", checkpoint.SectionHead.Hex())
+	fmt.Printf("CHT root   => %s\n", checkpoint.CHTRoot.Hex())
+	fmt.Printf("Bloom root => %s\n", checkpoint.BloomRoot.Hex())
+	fmt.Printf("Checkpoint => %s\n", hash.Hex())
+
+	key := getKey(ctx)
+	sig, err := crypto.Sign(checkpointoracle.SignHash(addr, checkpoint.SectionIndex, hash), key.PrivateKey)
+	if err != nil {
+		utils.Fatalf("Failed to sign checkpoint: %v", err)
+	}
+	sig[64] += 27 // Transform V from 0/1 to 27/28 according to the yellow paper
+	fmt.Printf("\nSigner     => %s\n", key.Address.Hex())
+	fmt.Printf("Signature  => %s\n", hexutil.Encode(sig))
+	return nil
+}
+
+// publish registers the checkpoint generated by the connected node in the oracle,
+// together with the admin signatures approving it.
+func publish(ctx *cli.Context) error {
+	client := newRPCClient(ctx.GlobalString(nodeURLFlag.Name))
+	addr, oracle := newContract(ctx, client)
+	checkpoint := getCheckpoint(ctx, client)
+	hash := checkpoint.Hash()
+
+	// Recover the signers and sort them in ascending order, as required by the oracle
+	admins, err := oracle.Contract().GetAllAdmin(nil)
+	if err != nil {
+		return err
+	}
+	var (
+		sigs    [][]byte
+		signers []common.Address
+	)
+	for _, encoded := range strings.Split(ctx.String(signaturesFlag.Name), ",") {
+		sig, err := hexutil.Decode(strings.TrimSpace(encoded))
+		if err != nil || len(sig) != 65 || sig[64] < 27 {
+			utils.Fatalf("Invalid signature '%s'", encoded)
+		}
+		recover := common.CopyBytes(sig)
+		recover[64] -= 27
+		pubkey, err := crypto.SigToPub(checkpointoracle.SignHash(addr, checkpoint.SectionIndex, hash), recover)
+		if err != nil {
+			utils.Fatalf("Failed to recover signer: %v", err)
+		}
+		signer := crypto.PubkeyToAddress(*pubkey)
+		admin := false
+		for _, a := range admins {
+			if a == signer {
+				admin = true
+				break
+			}
+		}
+		if !admin {
+			utils.Fatalf("Signature from unauthorized account %s", signer.Hex())
+		}
+		fmt.Printf("Signer => %s\n", signer.Hex())
+		sigs = append(sigs, sig)
+		signers = append(signers, signer)
+	}
+	sort.Sort(&sortedSigs{signers: signers, sigs: sigs})
+	for i := 1; i < len(signers); i++ {
+		if signers[i] == signers[i-1] {
+			utils.Fatalf("Duplicate signature from %s", signers[i].Hex())
+		}
+	}
+	// Reference a recent block for replay protection and publish the checkpoint
+	wshClient := wshclient.NewClient(client)
+	head, err := wshClient.HeaderByNumber(context.Background(), nil)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Publishing checkpoint %d => %s\n", checkpoint.SectionIndex, hash.Hex())
+
+	key := getKey(ctx)
+	tx, err := oracle.RegisterCheckpoint(bind.NewKeyedTransactor(key.PrivateKey), checkpoint.SectionIndex, hash.Bytes(), head.Number, head.Hash(), sigs)
+	if err != nil {
+		utils.Fatalf("Register contract failed %v", err)
+	}
+	log.Info("Successfully registered checkpoint", "tx", tx.Hash().Hex())
+
+	timeout, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+	receipt, err := bind.WaitMined(timeout, wshClient, tx)
+	if err != nil {
+		return err
+	}
+	if receipt.Status != 1 {
+		utils.Fatalf("Checkpoint registration was reverted")
+	}
+	log.Info("Checkpoint registration confirmed", "number", head.Number.Uint64()+1)
+	return nil
+}
+
+// sortedSigs sorts signatures by their signer address.
+type sortedSigs struct {
+	signers []common.Address
+	sigs    [][]byte
+}
+
+func (s *sortedSigs) Len() int { return len(s.signers) }
+func (s *sortedSigs) Less(i, j int) bool {
+	return bytes.Compare(s.signers[i].Bytes(), s.signers[j].Bytes()) < 0
+}
+func (s *sortedSigs) Swap(i, j int) {
+	s.signers[i], s.signers[j] = s.signers[j], s.signers[i]
+	s.sigs[i], s.sigs[j] = s.sigs[j], s.sigs[i]
+}
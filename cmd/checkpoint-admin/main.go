@@ -0,0 +1,106 @@
+// Copyright 2018 The go-wiseplat Authors
+// This file is part of go-wiseplat.
+//
+// go-wiseplat is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-wiseplat is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-wiseplat. If not, see <http://www.gnu.org/licenses/>.
+
+// checkpoint-admin is a utility that can be used to deploy the checkpoint oracle
+// contract and to sign and publish light client checkpoints through it.
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/wiseplat/go-wiseplat/cmd/utils"
+	"github.com/wiseplat/go-wiseplat/log"
+	"github.com/wiseplat/go-wiseplat/node"
+	"gopkg.in/urfave/cli.v1"
+)
+
+var (
+	// Git SHA1 commit hash of the release (set via linker flags)
+	gitCommit = ""
+)
+
+var app *cli.App
+
+func init() {
+	app = utils.NewApp(gitCommit, "checkpoint oracle administration tool")
+	app.Commands = []cli.Command{
+		commandStatus,
+		commandDeploy,
+		commandSign,
+		commandPublish,
+	}
+	app.Flags = []cli.Flag{
+		oracleFlag,
+		nodeURLFlag,
+		verbosityFlag,
+	}
+	app.Before = func(ctx *cli.Context) error {
+		log.Root().SetHandler(log.LvlFilterHandler(log.Lvl(ctx.GlobalInt(verbosityFlag.Name)), log.StreamHandler(os.Stderr, log.TerminalFormat(true))))
+		return nil
+	}
+}
+
+// Commonly used command line flags.
+var (
+	oracleFlag = cli.StringFlag{
+		Name:  "oracle",
+		Usage: "Address of the checkpoint oracle contract",
+	}
+	nodeURLFlag = cli.StringFlag{
+		Name:  "rpc",
+		Value: node.DefaultIPCEndpoint("gwsh"),
+		Usage: "The RPC endpoint of a local LES server with the checkpoint oracle enabled",
+	}
+	verbosityFlag = cli.IntFlag{
+		Name:  "verbosity",
+		Value: 3,
+		Usage: "Logging verbosity: 0=silent, 1=error, 2=warn, 3=info, 4=debug, 5=detail",
+	}
+	keyFileFlag = cli.StringFlag{
+		Name:  "keyfile",
+		Usage: "The private key file of an oracle admin",
+	}
+	passwordFileFlag = cli.StringFlag{
+		Name:  "password",
+		Usage: "The password file for the private key file",
+	}
+	indexFlag = cli.Int64Flag{
+		Name:  "index",
+		Value: -1,
+		Usage: "Section index of the checkpoint",
+	}
+	signersFlag = cli.StringFlag{
+		Name:  "signers",
+		Usage: "Comma separated list of checkpoint oracle admins",
+	}
+	thresholdFlag = cli.Uint64Flag{
+		Name:  "threshold",
+		Value: 1,
+		Usage: "Minimal number of admin signatures required to approve a checkpoint",
+	}
+	signaturesFlag = cli.StringFlag{
+		Name:  "signatures",
+		Usage: "Comma separated list of checkpoint signatures to publish",
+	}
+)
+
+func main() {
+	if err := app.Run(os.Args); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,135 @@
+// Copyright 2018 The go-wiseplat Authors
+// This file is part of go-wiseplat.
+//
+// go-wiseplat is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-wiseplat is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-wiseplat. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"time"
+
+	"github.com/wiseplat/go-wiseplat/log"
+	"github.com/wiseplat/go-wiseplat/p2p/discover"
+	"github.com/wiseplat/go-wiseplat/p2p/enr"
+)
+
+// nodeSet is the JSON file format of crawler results, keyed by node ID.
+type nodeSet map[discover.NodeID]nodeJSON
+
+type nodeJSON struct {
+	URL    string `json:"url"`
+	Seq    uint64 `json:"seq,omitempty"`    // sequence number of the node record
+	Record string `json:"record,omitempty"` // node record, if it was requested
+
+	FirstResponse time.Time `json:"firstResponse,omitempty"`
+	LastResponse  time.Time `json:"lastResponse,omitempty"`
+}
+
+func loadNodesJSON(file string) (nodeSet, error) {
+	var nodes nodeSet
+	if err := readJSON(file, &nodes); err != nil {
+		return nil, err
+	}
+	return nodes, nil
+}
+
+// nodes returns the nodes of the set.
+func (ns nodeSet) nodes() []*discover.Node {
+	result := make([]*discover.Node, 0, len(ns))
+	for _, n := range ns {
+		node, err := discover.ParseNode(n.URL)
+		if err != nil {
+			log.Warn("Skipping invalid node in set", "url", n.URL, "err", err)
+			continue
+		}
+		result = append(result, node)
+	}
+	return result
+}
+
+// crawler collects the nodes found by repeated random lookups.
+type crawler struct {
+	output nodeSet
+	seen   map[discover.NodeID]bool // nodes found in this run
+
+	lookup     func() []*discover.Node                   // performs a random lookup
+	requestENR func(*discover.Node) (*enr.Record, error) // optional, fetches node records
+}
+
+const crawlStatsInterval = 8 * time.Second
+
+func newCrawler(input nodeSet, lookup func() []*discover.Node) *crawler {
+	c := &crawler{
+		output: make(nodeSet, len(input)),
+		seen:   make(map[discover.NodeID]bool),
+		lookup: lookup,
+	}
+	for id, n := range input {
+		c.output[id] = n
+	}
+	return c
+}
+
+// run crawls until the timeout expires and returns the collected nodes.
+func (c *crawler) run(timeout time.Duration) nodeSet {
+	var (
+		deadline   = time.Now().Add(timeout)
+		statsTimer = time.NewTicker(crawlStatsInterval)
+		added      int
+		updated    int
+	)
+	defer statsTimer.Stop()
+
+	for time.Now().Before(deadline) {
+		for _, n := range c.lookup() {
+			if c.seen[n.ID] {
+				continue
+			}
+			c.seen[n.ID] = true
+			if c.update(n) {
+				added++
+			} else {
+				updated++
+			}
+		}
+		select {
+		case <-statsTimer.C:
+			log.Info("Crawling in progress", "added", added, "updated", updated, "total", len(c.output))
+		default:
+		}
+	}
+	return c.output
+}
+
+// update records a response of the given node and fetches its record. It returns
+// true if the node was not in the set before.
+func (c *crawler) update(n *discover.Node) bool {
+	entry, known := c.output[n.ID]
+	now := time.Now().UTC().Truncate(time.Second)
+	if !known {
+		entry.FirstResponse = now
+	}
+	entry.LastResponse = now
+	entry.URL = n.String()
+
+	if c.requestENR != nil {
+		if r, err := c.requestENR(n); err != nil {
+			log.Debug("Failed to request node record", "id", n.ID, "err", err)
+		} else if r.Seq() >= entry.Seq {
+			entry.Seq, entry.Record = r.Seq(), r.String()
+		}
+	}
+	c.output[n.ID] = entry
+	return !known
+}
@@ -0,0 +1,259 @@
+// Copyright 2018 The go-wiseplat Authors
+// This file is part of go-wiseplat.
+//
+// go-wiseplat is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-wiseplat is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-wiseplat. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"crypto/rand"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/wiseplat/go-wiseplat/common"
+	"github.com/wiseplat/go-wiseplat/crypto"
+	"github.com/wiseplat/go-wiseplat/p2p/discover"
+	"github.com/wiseplat/go-wiseplat/p2p/enr"
+	"github.com/wiseplat/go-wiseplat/params"
+	"gopkg.in/urfave/cli.v1"
+)
+
+var (
+	discv4Command = cli.Command{
+		Name:  "discv4",
+		Usage: "Node Discovery v4 tools",
+		Subcommands: []cli.Command{
+			discv4PingCommand,
+			discv4RequestRecordCommand,
+			discv4ResolveCommand,
+			discv4CrawlCommand,
+		},
+	}
+	discv4PingCommand = cli.Command{
+		Name:      "ping",
+		Usage:     "Sends ping to a node",
+		ArgsUsage: "<node>",
+		Action:    discv4Ping,
+		Flags:     []cli.Flag{listenAddrFlag},
+	}
+	discv4RequestRecordCommand = cli.Command{
+		Name:      "requestenr",
+		Usage:     "Requests a node record using EIP-868 enrRequest",
+		ArgsUsage: "<node>",
+		Action:    discv4RequestRecord,
+		Flags:     []cli.Flag{listenAddrFlag},
+	}
+	discv4ResolveCommand = cli.Command{
+		Name:      "resolve",
+		Usage:     "Finds a node in the DHT",
+		ArgsUsage: "<node>",
+		Action:    discv4Resolve,
+		Flags:     []cli.Flag{bootnodesFlag, listenAddrFlag},
+	}
+	discv4CrawlCommand = cli.Command{
+		Name:      "crawl",
+		Usage:     "Updates a nodes.json file with random nodes found in the DHT",
+		ArgsUsage: "<nodes.json>",
+		Action:    discv4Crawl,
+		Flags:     []cli.Flag{bootnodesFlag, listenAddrFlag, crawlTimeoutFlag, requestENRFlag},
+	}
+)
+
+var (
+	bootnodesFlag = cli.StringFlag{
+		Name:  "bootnodes",
+		Usage: "Comma separated nodes used for bootstrapping (defaults to the main network bootnodes)",
+	}
+	listenAddrFlag = cli.StringFlag{
+		Name:  "addr",
+		Usage: "Listening address",
+		Value: "0.0.0.0:0",
+	}
+	crawlTimeoutFlag = cli.DurationFlag{
+		Name:  "timeout",
+		Usage: "Time limit for the crawl",
+		Value: 30 * time.Minute,
+	}
+	requestENRFlag = cli.BoolFlag{
+		Name:  "requestenr",
+		Usage: "Request the node records of crawled nodes",
+	}
+)
+
+// discv4Ping performs discv4PingCommand.
+func discv4Ping(ctx *cli.Context) error {
+	n, err := getNodeArg(ctx)
+	if err != nil {
+		return err
+	}
+	tab, err := startV4(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tab.Close()
+
+	start := time.Now()
+	if err := tab.Ping(n); err != nil {
+		return fmt.Errorf("node didn't respond: %v", err)
+	}
+	fmt.Printf("node responded to ping (RTT %v).\n", time.Since(start))
+	return nil
+}
+
+// discv4RequestRecord performs discv4RequestRecordCommand.
+func discv4RequestRecord(ctx *cli.Context) error {
+	n, err := getNodeArg(ctx)
+	if err != nil {
+		return err
+	}
+	tab, err := startV4(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tab.Close()
+
+	r, err := requestENR(tab, n)
+	if err != nil {
+		return fmt.Errorf("can't retrieve record: %v", err)
+	}
+	fmt.Println(r.String())
+	return nil
+}
+
+// discv4Resolve performs discv4ResolveCommand.
+func discv4Resolve(ctx *cli.Context) error {
+	n, err := getNodeArg(ctx)
+	if err != nil {
+		return err
+	}
+	bootnodes, err := getBootnodes(ctx)
+	if err != nil {
+		return err
+	}
+	tab, err := startV4(ctx, append(bootnodes, n))
+	if err != nil {
+		return err
+	}
+	defer tab.Close()
+
+	result := tab.Resolve(n.ID)
+	if result == nil {
+		return fmt.Errorf("node %x not found", n.ID[:8])
+	}
+	fmt.Println(result.String())
+	return nil
+}
+
+// discv4Crawl performs discv4CrawlCommand.
+func discv4Crawl(ctx *cli.Context) error {
+	if ctx.NArg() < 1 {
+		return fmt.Errorf("need nodes file as argument")
+	}
+	var (
+		nodesFile = ctx.Args().First()
+		inputSet  = make(nodeSet)
+	)
+	if common.FileExist(nodesFile) {
+		set, err := loadNodesJSON(nodesFile)
+		if err != nil {
+			return err
+		}
+		inputSet = set
+	}
+	bootnodes, err := getBootnodes(ctx)
+	if err != nil {
+		return err
+	}
+	tab, err := startV4(ctx, append(bootnodes, inputSet.nodes()...))
+	if err != nil {
+		return err
+	}
+	defer tab.Close()
+
+	c := newCrawler(inputSet, func() []*discover.Node {
+		var target discover.NodeID
+		rand.Read(target[:])
+		return tab.Lookup(target)
+	})
+	if ctx.Bool(requestENRFlag.Name) {
+		c.requestENR = func(n *discover.Node) (*enr.Record, error) { return requestENR(tab, n) }
+	}
+	output := c.run(ctx.Duration(crawlTimeoutFlag.Name))
+	return writeJSON(nodesFile, output)
+}
+
+// requestENR requests the record of a node. The node only answers after it has
+// verified the endpoint of the requester, the request is retried to give it time
+// to do so.
+func requestENR(tab *discover.Table, n *discover.Node) (r *enr.Record, err error) {
+	for i := 0; i < 3; i++ {
+		if r, err = tab.RequestENR(n); err == nil {
+			return r, nil
+		}
+		if i == 0 {
+			tab.Ping(n)
+		}
+	}
+	return nil, err
+}
+
+// startV4 starts an ephemeral discovery v4 node.
+func startV4(ctx *cli.Context, bootnodes []*discover.Node) (*discover.Table, error) {
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		return nil, err
+	}
+	tab, err := discover.ListenUDP(key, ctx.String(listenAddrFlag.Name), nil, "", nil)
+	if err != nil {
+		return nil, err
+	}
+	if len(bootnodes) > 0 {
+		if err := tab.SetFallbackNodes(bootnodes); err != nil {
+			tab.Close()
+			return nil, err
+		}
+	}
+	return tab, nil
+}
+
+// getNodeArg parses the enode URL given as the first argument.
+func getNodeArg(ctx *cli.Context) (*discover.Node, error) {
+	if ctx.NArg() < 1 {
+		return nil, fmt.Errorf("need node as argument")
+	}
+	n, err := discover.ParseNode(ctx.Args().First())
+	if err != nil {
+		return nil, fmt.Errorf("invalid node: %v", err)
+	}
+	return n, nil
+}
+
+// getBootnodes parses the bootstrap nodes given on the command line, falling
+// back to the main network bootnodes.
+func getBootnodes(ctx *cli.Context) ([]*discover.Node, error) {
+	urls := params.MainnetBootnodes
+	if ctx.IsSet(bootnodesFlag.Name) {
+		urls = strings.Split(ctx.String(bootnodesFlag.Name), ",")
+	}
+	nodes := make([]*discover.Node, len(urls))
+	for i, url := range urls {
+		n, err := discover.ParseNode(url)
+		if err != nil {
+			return nil, fmt.Errorf("invalid bootstrap node %q: %v", url, err)
+		}
+		nodes[i] = n
+	}
+	return nodes, nil
+}
@@ -0,0 +1,126 @@
+// Copyright 2018 The go-wiseplat Authors
+// This file is part of go-wiseplat.
+//
+// go-wiseplat is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-wiseplat is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-wiseplat. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"crypto/rand"
+	"fmt"
+	"strings"
+
+	"github.com/wiseplat/go-wiseplat/common"
+	"github.com/wiseplat/go-wiseplat/crypto"
+	"github.com/wiseplat/go-wiseplat/log"
+	"github.com/wiseplat/go-wiseplat/p2p/discover"
+	"github.com/wiseplat/go-wiseplat/p2p/discv5"
+	"github.com/wiseplat/go-wiseplat/params"
+	"gopkg.in/urfave/cli.v1"
+)
+
+var (
+	discv5Command = cli.Command{
+		Name:  "discv5",
+		Usage: "Node Discovery v5 tools",
+		Subcommands: []cli.Command{
+			discv5CrawlCommand,
+		},
+	}
+	discv5CrawlCommand = cli.Command{
+		Name:      "crawl",
+		Usage:     "Updates a nodes.json file with random nodes found in the DHT",
+		ArgsUsage: "<nodes.json>",
+		Action:    discv5Crawl,
+		Flags:     []cli.Flag{bootnodesFlag, listenAddrFlag, crawlTimeoutFlag},
+	}
+)
+
+// discv5Crawl performs discv5CrawlCommand.
+func discv5Crawl(ctx *cli.Context) error {
+	if ctx.NArg() < 1 {
+		return fmt.Errorf("need nodes file as argument")
+	}
+	var (
+		nodesFile = ctx.Args().First()
+		inputSet  = make(nodeSet)
+	)
+	if common.FileExist(nodesFile) {
+		set, err := loadNodesJSON(nodesFile)
+		if err != nil {
+			return err
+		}
+		inputSet = set
+	}
+	net, err := startV5(ctx, inputSet)
+	if err != nil {
+		return err
+	}
+	defer net.Close()
+
+	c := newCrawler(inputSet, func() []*discover.Node {
+		var target discv5.NodeID
+		rand.Read(target[:])
+		return convertV5Nodes(net.Lookup(target))
+	})
+	output := c.run(ctx.Duration(crawlTimeoutFlag.Name))
+	return writeJSON(nodesFile, output)
+}
+
+// startV5 starts an ephemeral discovery v5 node, bootstrapping from the nodes
+// given on the command line and the nodes of the input set.
+func startV5(ctx *cli.Context, input nodeSet) (*discv5.Network, error) {
+	urls := append([]string{}, params.DiscoveryV5Bootnodes...)
+	if ctx.IsSet(bootnodesFlag.Name) {
+		urls = strings.Split(ctx.String(bootnodesFlag.Name), ",")
+	}
+	for _, n := range input {
+		urls = append(urls, n.URL)
+	}
+	var bootnodes []*discv5.Node
+	for _, url := range urls {
+		n, err := discv5.ParseNode(url)
+		if err != nil {
+			return nil, fmt.Errorf("invalid bootstrap node %q: %v", url, err)
+		}
+		bootnodes = append(bootnodes, n)
+	}
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		return nil, err
+	}
+	net, err := discv5.ListenUDP(key, ctx.String(listenAddrFlag.Name), nil, "", nil)
+	if err != nil {
+		return nil, err
+	}
+	if err := net.SetFallbackNodes(bootnodes); err != nil {
+		net.Close()
+		return nil, err
+	}
+	return net, nil
+}
+
+// convertV5Nodes converts discovery v5 nodes to the node type of the crawler.
+func convertV5Nodes(nodes []*discv5.Node) []*discover.Node {
+	result := make([]*discover.Node, 0, len(nodes))
+	for _, n := range nodes {
+		node, err := discover.ParseNode(n.String())
+		if err != nil {
+			log.Debug("Skipping invalid discovery v5 node", "id", n.ID, "err", err)
+			continue
+		}
+		result = append(result, node)
+	}
+	return result
+}
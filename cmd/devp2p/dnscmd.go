@@ -0,0 +1,295 @@
+// Copyright 2018 The go-wiseplat Authors
+// This file is part of go-wiseplat.
+//
+// go-wiseplat is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-wiseplat is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-wiseplat. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/wiseplat/go-wiseplat/accounts/keystore"
+	"github.com/wiseplat/go-wiseplat/cmd/utils"
+	"github.com/wiseplat/go-wiseplat/console"
+	"github.com/wiseplat/go-wiseplat/p2p/discover"
+	"github.com/wiseplat/go-wiseplat/p2p/dnsdisc"
+	"gopkg.in/urfave/cli.v1"
+)
+
+var (
+	dnsCommand = cli.Command{
+		Name:  "dns",
+		Usage: "DNS Discovery Commands",
+		Subcommands: []cli.Command{
+			dnsSyncCommand,
+			dnsSignCommand,
+			dnsTXTCommand,
+		},
+	}
+	dnsSyncCommand = cli.Command{
+		Name:      "sync",
+		Usage:     "Download a DNS discovery tree",
+		ArgsUsage: "<url> [ <directory> ]",
+		Action:    dnsSync,
+	}
+	dnsSignCommand = cli.Command{
+		Name:      "sign",
+		Usage:     "Sign a DNS discovery tree",
+		ArgsUsage: "<tree-directory>",
+		Action:    dnsSign,
+		Flags:     []cli.Flag{domainFlag, seqFlag, keyFileFlag, passwordFileFlag},
+	}
+	dnsTXTCommand = cli.Command{
+		Name:      "to-txt",
+		Usage:     "Create a DNS TXT records for a discovery tree",
+		ArgsUsage: "<tree-directory> [ <output-file> ]",
+		Action:    dnsToTXT,
+	}
+)
+
+var (
+	domainFlag = cli.StringFlag{
+		Name:  "domain",
+		Usage: "Domain name of the tree",
+	}
+	seqFlag = cli.UintFlag{
+		Name:  "seq",
+		Usage: "New sequence number of the tree",
+	}
+	keyFileFlag = cli.StringFlag{
+		Name:  "keyfile",
+		Usage: "The key file used for signing the tree",
+	}
+	passwordFileFlag = cli.StringFlag{
+		Name:  "password",
+		Usage: "The password file for the key file",
+	}
+)
+
+// dnsSync performs dnsSyncCommand.
+func dnsSync(ctx *cli.Context) error {
+	if ctx.NArg() < 1 {
+		return fmt.Errorf("need tree URL as argument")
+	}
+	var (
+		url    = ctx.Args().Get(0)
+		outdir = ctx.Args().Get(1)
+	)
+	domain, _, err := dnsdisc.ParseURL(url)
+	if err != nil {
+		return err
+	}
+	if outdir == "" {
+		outdir = domain
+	}
+	client, _ := dnsdisc.NewClient(dnsdisc.Config{})
+	t, err := client.SyncTree(url)
+	if err != nil {
+		return err
+	}
+	def := &dnsDefinition{
+		Meta:  dnsMetaJSON{URL: url, Seq: t.Seq(), Sig: t.Signature(), Links: t.Links()},
+		Nodes: t.Nodes(),
+	}
+	if err := writeTreeDefinition(outdir, def); err != nil {
+		return err
+	}
+	fmt.Printf("Synced %d nodes and %d links to %s\n", len(def.Nodes), len(def.Meta.Links), outdir)
+	return nil
+}
+
+// dnsSign performs dnsSignCommand.
+func dnsSign(ctx *cli.Context) error {
+	if ctx.NArg() < 1 {
+		return fmt.Errorf("need tree definition directory as argument")
+	}
+	defdir := ctx.Args().Get(0)
+	def, err := loadTreeDefinition(defdir)
+	if err != nil {
+		return err
+	}
+	domain := ctx.String(domainFlag.Name)
+	if domain == "" && def.Meta.URL != "" {
+		domain, _, _ = dnsdisc.ParseURL(def.Meta.URL)
+	}
+	if domain == "" {
+		return fmt.Errorf("missing tree domain (--%s)", domainFlag.Name)
+	}
+	seq := def.Meta.Seq + 1
+	if ctx.IsSet(seqFlag.Name) {
+		seq = ctx.Uint(seqFlag.Name)
+	}
+	t, err := dnsdisc.MakeTree(seq, def.Nodes, def.Meta.Links)
+	if err != nil {
+		return err
+	}
+	key := getKey(ctx)
+	url, err := t.Sign(key.PrivateKey, domain)
+	if err != nil {
+		return fmt.Errorf("can't sign: %v", err)
+	}
+	def.Meta.URL, def.Meta.Seq, def.Meta.Sig = url, t.Seq(), t.Signature()
+	if err := writeTreeMetadata(defdir, &def.Meta); err != nil {
+		return err
+	}
+	fmt.Println(url)
+	return nil
+}
+
+// dnsToTXT performs dnsTXTCommand.
+func dnsToTXT(ctx *cli.Context) error {
+	if ctx.NArg() < 1 {
+		return fmt.Errorf("need tree definition directory as argument")
+	}
+	defdir := ctx.Args().Get(0)
+	output := ctx.Args().Get(1)
+	if output == "" {
+		output = filepath.Join(defdir, "TXT.json")
+	}
+	def, err := loadTreeDefinition(defdir)
+	if err != nil {
+		return err
+	}
+	domain, t, err := makeSignedTree(def)
+	if err != nil {
+		return err
+	}
+	return writeJSON(output, t.ToTXT(domain))
+}
+
+// makeSignedTree rebuilds the tree of a definition and verifies its signature.
+func makeSignedTree(def *dnsDefinition) (string, *dnsdisc.Tree, error) {
+	if def.Meta.URL == "" || def.Meta.Sig == "" {
+		return "", nil, fmt.Errorf("tree is not signed")
+	}
+	domain, pubkey, err := dnsdisc.ParseURL(def.Meta.URL)
+	if err != nil {
+		return "", nil, fmt.Errorf("invalid tree URL: %v", err)
+	}
+	t, err := dnsdisc.MakeTree(def.Meta.Seq, def.Nodes, def.Meta.Links)
+	if err != nil {
+		return "", nil, err
+	}
+	if err := t.SetSignature(pubkey, def.Meta.Sig); err != nil {
+		return "", nil, fmt.Errorf("invalid tree signature: %v", err)
+	}
+	return domain, t, nil
+}
+
+// getKey retrieves the signing key through the specified key file.
+func getKey(ctx *cli.Context) *keystore.Key {
+	keyFile := ctx.String(keyFileFlag.Name)
+	if keyFile == "" {
+		utils.Fatalf("Missing private key file (--%s)", keyFileFlag.Name)
+	}
+	keyJSON, err := ioutil.ReadFile(keyFile)
+	if err != nil {
+		utils.Fatalf("Failed to read the keyfile at '%s': %v", keyFile, err)
+	}
+	key, err := keystore.DecryptKey(keyJSON, getPassphrase(ctx))
+	if err != nil {
+		utils.Fatalf("Failed to decrypt key '%s': %v", keyFile, err)
+	}
+	return key
+}
+
+// getPassphrase obtains a passphrase given by the user. It first checks the
+// --password command line flag and ultimately prompts the user for a passphrase.
+func getPassphrase(ctx *cli.Context) string {
+	if passphraseFile := ctx.String(passwordFileFlag.Name); passphraseFile != "" {
+		content, err := ioutil.ReadFile(passphraseFile)
+		if err != nil {
+			utils.Fatalf("Failed to read passphrase file '%s': %v", passphraseFile, err)
+		}
+		return strings.TrimRight(string(content), "\r\n")
+	}
+	passphrase, err := console.Stdin.PromptPassword("Passphrase: ")
+	if err != nil {
+		utils.Fatalf("Failed to read passphrase: %v", err)
+	}
+	return passphrase
+}
+
+// dnsDefinition is the content of a tree directory. The nodes are stored in
+// nodes.json, the remaining tree metadata in enrtree-info.json.
+type dnsDefinition struct {
+	Meta  dnsMetaJSON
+	Nodes []*discover.Node
+}
+
+type dnsMetaJSON struct {
+	URL   string   `json:"url,omitempty"`
+	Seq   uint     `json:"seq"`
+	Sig   string   `json:"signature,omitempty"`
+	Links []string `json:"links"`
+}
+
+// loadTreeDefinition loads a tree directory. The metadata file is optional.
+func loadTreeDefinition(directory string) (*dnsDefinition, error) {
+	def := new(dnsDefinition)
+	if err := readJSON(filepath.Join(directory, "enrtree-info.json"), &def.Meta); err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if err := readJSON(filepath.Join(directory, "nodes.json"), &def.Nodes); err != nil {
+		return nil, err
+	}
+	for _, l := range def.Meta.Links {
+		if _, _, err := dnsdisc.ParseURL(l); err != nil {
+			return nil, fmt.Errorf("invalid link %q: %v", l, err)
+		}
+	}
+	return def, nil
+}
+
+// writeTreeDefinition writes a tree definition to the given directory.
+func writeTreeDefinition(directory string, def *dnsDefinition) error {
+	if err := os.MkdirAll(directory, 0755); err != nil {
+		return err
+	}
+	if err := writeTreeMetadata(directory, &def.Meta); err != nil {
+		return err
+	}
+	return writeJSON(filepath.Join(directory, "nodes.json"), def.Nodes)
+}
+
+func writeTreeMetadata(directory string, meta *dnsMetaJSON) error {
+	if meta.Links == nil {
+		meta.Links = []string{}
+	}
+	return writeJSON(filepath.Join(directory, "enrtree-info.json"), meta)
+}
+
+func readJSON(file string, v interface{}) error {
+	content, err := ioutil.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(content, v); err != nil {
+		return fmt.Errorf("can't parse %s: %v", file, err)
+	}
+	return nil
+}
+
+func writeJSON(file string, v interface{}) error {
+	content, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(file, append(content, '\n'), 0644)
+}
@@ -0,0 +1,189 @@
+// Copyright 2018 The go-wiseplat Authors
+// This file is part of go-wiseplat.
+//
+// go-wiseplat is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-wiseplat is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-wiseplat. If not, see <http://www.gnu.org/licenses/>.
+
+package wshtest
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"strings"
+
+	"github.com/wiseplat/go-wiseplat/common"
+	"github.com/wiseplat/go-wiseplat/core"
+	"github.com/wiseplat/go-wiseplat/core/types"
+	"github.com/wiseplat/go-wiseplat/rlp"
+)
+
+// Chain is the canonical chain the target node is expected to have, starting at
+// the genesis block.
+type Chain struct {
+	blocks []*types.Block
+}
+
+// LoadChain reads the genesis specification and the blocks of the chain, as
+// written by 'gwsh export'. The file is decompressed if its name ends in ".gz".
+// The exported chain may or may not contain the genesis block.
+func LoadChain(chainfile, genesisfile string) (*Chain, error) {
+	genesis, err := loadGenesis(genesisfile)
+	if err != nil {
+		return nil, err
+	}
+	gblock, _ := genesis.ToBlock()
+	blocks, err := loadBlocks(chainfile)
+	if err != nil {
+		return nil, err
+	}
+	if len(blocks) > 0 && blocks[0].NumberU64() == 0 {
+		if blocks[0].Hash() != gblock.Hash() {
+			return nil, fmt.Errorf("genesis block mismatch: chain has %x, genesis.json %x", blocks[0].Hash(), gblock.Hash())
+		}
+		blocks = blocks[1:]
+	}
+	return NewChain(append([]*types.Block{gblock}, blocks...))
+}
+
+// NewChain creates a chain from a list of consecutive blocks starting at genesis.
+func NewChain(blocks []*types.Block) (*Chain, error) {
+	for i, b := range blocks {
+		if b.NumberU64() != uint64(i) {
+			return nil, fmt.Errorf("block %d has number %d", i, b.NumberU64())
+		}
+		if i > 0 && b.ParentHash() != blocks[i-1].Hash() {
+			return nil, fmt.Errorf("block %d is not a child of block %d", i, i-1)
+		}
+	}
+	if len(blocks) == 0 {
+		return nil, fmt.Errorf("empty chain")
+	}
+	return &Chain{blocks: blocks}, nil
+}
+
+func loadGenesis(file string) (*core.Genesis, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	genesis := new(core.Genesis)
+	if err := json.Unmarshal(data, genesis); err != nil {
+		return nil, fmt.Errorf("invalid genesis file %s: %v", file, err)
+	}
+	return genesis, nil
+}
+
+func loadBlocks(file string) ([]*types.Block, error) {
+	fh, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer fh.Close()
+
+	var reader io.Reader = fh
+	if strings.HasSuffix(file, ".gz") {
+		if reader, err = gzip.NewReader(reader); err != nil {
+			return nil, err
+		}
+	}
+	var (
+		stream = rlp.NewStream(reader, 0)
+		blocks []*types.Block
+	)
+	for {
+		b := new(types.Block)
+		if err := stream.Decode(b); err == io.EOF {
+			return blocks, nil
+		} else if err != nil {
+			return nil, fmt.Errorf("invalid block %d in %s: %v", len(blocks), file, err)
+		}
+		blocks = append(blocks, b)
+	}
+}
+
+// Len returns the number of blocks in the chain, including genesis.
+func (c *Chain) Len() int {
+	return len(c.blocks)
+}
+
+// Genesis returns the genesis block.
+func (c *Chain) Genesis() *types.Block {
+	return c.blocks[0]
+}
+
+// Head returns the last block of the chain.
+func (c *Chain) Head() *types.Block {
+	return c.blocks[len(c.blocks)-1]
+}
+
+// TD returns the total difficulty of the chain up to and including the block
+// with the given number.
+func (c *Chain) TD(number uint64) *big.Int {
+	td := new(big.Int)
+	for _, b := range c.blocks[:number+1] {
+		td.Add(td, b.Difficulty())
+	}
+	return td
+}
+
+// GetHeaders returns the headers a node holding the chain is expected to answer
+// the given query with.
+func (c *Chain) GetHeaders(req *GetBlockHeaders) []*types.Header {
+	var (
+		headers []*types.Header
+		number  uint64
+	)
+	if req.Origin.Hash != (common.Hash{}) {
+		b := c.blockByHash(req.Origin.Hash)
+		if b == nil {
+			return headers
+		}
+		number = b.NumberU64()
+	} else {
+		number = req.Origin.Number
+	}
+	for uint64(len(headers)) < req.Amount && len(headers) < maxHeaderFetch && number < uint64(len(c.blocks)) {
+		headers = append(headers, c.blocks[number].Header())
+
+		step := req.Skip + 1
+		if step == 0 {
+			break // skip overflow
+		}
+		if req.Reverse {
+			if number < step {
+				break
+			}
+			number -= step
+		} else {
+			if number+step < number {
+				break
+			}
+			number += step
+		}
+	}
+	return headers
+}
+
+func (c *Chain) blockByHash(hash common.Hash) *types.Block {
+	for _, b := range c.blocks {
+		if b.Hash() == hash {
+			return b
+		}
+	}
+	return nil
+}
@@ -0,0 +1,216 @@
+// Copyright 2018 The go-wiseplat Authors
+// This file is part of go-wiseplat.
+//
+// go-wiseplat is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-wiseplat is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-wiseplat. If not, see <http://www.gnu.org/licenses/>.
+
+// Package wshtest implements a conformance test suite for the wsh protocol. The
+// suite connects to a running node over RLPx and checks its responses against a
+// chain known to be imported by the node.
+package wshtest
+
+import (
+	"bytes"
+	"math"
+
+	"github.com/wiseplat/go-wiseplat/common"
+	"github.com/wiseplat/go-wiseplat/core/types"
+	"github.com/wiseplat/go-wiseplat/internal/utesting"
+	"github.com/wiseplat/go-wiseplat/p2p"
+	"github.com/wiseplat/go-wiseplat/p2p/discover"
+)
+
+// Suite represents a structure used to test the wsh protocol of a node.
+type Suite struct {
+	Dest  *discover.Node
+	chain *Chain
+}
+
+// NewSuite creates a suite testing the given node, which must have imported the
+// chain defined by the given chain and genesis files.
+func NewSuite(dest *discover.Node, chainfile string, genesisfile string) (*Suite, error) {
+	chain, err := LoadChain(chainfile, genesisfile)
+	if err != nil {
+		return nil, err
+	}
+	return &Suite{Dest: dest, chain: chain}, nil
+}
+
+// AllTests returns all tests of the suite.
+func (s *Suite) AllTests() []utesting.Test {
+	return []utesting.Test{
+		{Name: "Handshake", Fn: s.TestHandshake},
+		{Name: "Status", Fn: s.TestStatus},
+		{Name: "StatusGenesisMismatch", Fn: s.TestStatusGenesisMismatch},
+		{Name: "GetBlockHeaders", Fn: s.TestGetBlockHeaders},
+		{Name: "LargeMessage", Fn: s.TestLargeMessage},
+	}
+}
+
+// TestHandshake checks that the node completes the RLPx handshakes and offers the
+// wsh protocol.
+func (s *Suite) TestHandshake(t *utesting.T) {
+	conn, err := dial(s.Dest)
+	if err != nil {
+		t.Fatalf("could not connect: %v", err)
+	}
+	defer conn.Close(p2p.DiscQuitting)
+
+	if !conn.hasCap("wsh", wshVersion) {
+		t.Fatalf("node does not offer wsh/%d, capabilities: %v", wshVersion, conn.caps)
+	}
+}
+
+// TestStatus checks that the status announced by the node matches the test chain
+// and that the node keeps the connection after the status exchange.
+func (s *Suite) TestStatus(t *utesting.T) {
+	conn := s.dialStatus(t)
+	defer conn.Close(p2p.DiscQuitting)
+}
+
+// TestStatusGenesisMismatch checks that the node disconnects peers on a different
+// chain.
+func (s *Suite) TestStatusGenesisMismatch(t *utesting.T) {
+	conn, err := dial(s.Dest)
+	if err != nil {
+		t.Fatalf("could not connect: %v", err)
+	}
+	defer conn.Close(p2p.DiscQuitting)
+
+	their := new(Status)
+	if err := conn.readWsh(statusMsg, their); err != nil {
+		t.Fatalf("could not read status: %v", err)
+	}
+	our := *their
+	our.Genesis = common.Hash{1}
+	if err := conn.writeWsh(statusMsg, &our); err != nil {
+		t.Fatalf("could not write status: %v", err)
+	}
+	if _, err := conn.getBlockHeaders(&GetBlockHeaders{Origin: HashOrNumber{Number: 0}, Amount: 1}); err == nil {
+		t.Fatalf("node answered a peer with mismatching genesis")
+	}
+}
+
+// TestGetBlockHeaders checks the responses of the node to header queries in both
+// directions, with skips, past the chain endpoints, beyond the request limit and
+// with overflowing skips.
+func (s *Suite) TestGetBlockHeaders(t *utesting.T) {
+	conn := s.dialStatus(t)
+	defer conn.Close(p2p.DiscQuitting)
+
+	var (
+		head = s.chain.Head().NumberU64()
+		mid  = s.chain.blocks[head/2].Hash()
+	)
+	tests := []struct {
+		name  string
+		query GetBlockHeaders
+	}{
+		{"by number", GetBlockHeaders{Origin: HashOrNumber{Number: head / 2}, Amount: 3}},
+		{"by number reverse", GetBlockHeaders{Origin: HashOrNumber{Number: head / 2}, Amount: 3, Reverse: true}},
+		{"by hash", GetBlockHeaders{Origin: HashOrNumber{Hash: mid}, Amount: 3}},
+		{"by hash with skip", GetBlockHeaders{Origin: HashOrNumber{Hash: mid}, Amount: 3, Skip: 2}},
+		{"by hash reverse with skip", GetBlockHeaders{Origin: HashOrNumber{Hash: mid}, Amount: 3, Skip: 1, Reverse: true}},
+		{"past genesis", GetBlockHeaders{Origin: HashOrNumber{Number: 2}, Amount: 5, Reverse: true}},
+		{"past head", GetBlockHeaders{Origin: HashOrNumber{Number: head - 1}, Amount: 5}},
+		{"beyond head", GetBlockHeaders{Origin: HashOrNumber{Number: head + 1}, Amount: 1}},
+		{"unknown hash", GetBlockHeaders{Origin: HashOrNumber{Hash: common.Hash{1}}, Amount: 1}},
+		{"above limit", GetBlockHeaders{Origin: HashOrNumber{Number: 0}, Amount: maxHeaderFetch + 10}},
+		{"number skip overflow", GetBlockHeaders{Origin: HashOrNumber{Number: 1}, Amount: 2, Skip: math.MaxUint64}},
+		{"number reverse skip overflow", GetBlockHeaders{Origin: HashOrNumber{Number: 3}, Amount: 2, Skip: math.MaxUint64, Reverse: true}},
+		{"hash skip overflow", GetBlockHeaders{Origin: HashOrNumber{Hash: s.chain.blocks[1].Hash()}, Amount: 2, Skip: math.MaxUint64}},
+		{"hash skip overflow to start", GetBlockHeaders{Origin: HashOrNumber{Hash: mid}, Amount: 2, Skip: math.MaxUint64 - 1}},
+	}
+	for _, tt := range tests {
+		headers, err := conn.getBlockHeaders(&tt.query)
+		if err != nil {
+			t.Fatalf("%s: could not get headers: %v", tt.name, err)
+		}
+		if want := s.chain.GetHeaders(&tt.query); !sameHeaders(headers, want) {
+			t.Errorf("%s: wrong headers %v, want %v", tt.name, headerNumbers(headers), headerNumbers(want))
+		}
+	}
+}
+
+// TestLargeMessage checks that the node disconnects peers sending messages above
+// the protocol size limit.
+func (s *Suite) TestLargeMessage(t *utesting.T) {
+	conn := s.dialStatus(t)
+	defer conn.Close(p2p.DiscQuitting)
+
+	payload := make([]byte, maxMessageSize+1)
+	msg := p2p.Msg{
+		Code:    baseProtocolLength + getBlockHeadersMsg,
+		Size:    uint32(len(payload)),
+		Payload: bytes.NewReader(payload),
+	}
+	if err := conn.WriteMsg(msg); err != nil {
+		t.Fatalf("could not write large message: %v", err)
+	}
+	if _, err := conn.getBlockHeaders(&GetBlockHeaders{Origin: HashOrNumber{Number: 0}, Amount: 1}); err == nil {
+		t.Fatalf("node kept the connection after a message of %d bytes", len(payload))
+	}
+}
+
+// dialStatus connects to the node, performs the status exchange and verifies the
+// status of the node.
+func (s *Suite) dialStatus(t *utesting.T) *Conn {
+	conn, err := dial(s.Dest)
+	if err != nil {
+		t.Fatalf("could not connect: %v", err)
+	}
+	status, err := conn.statusExchange(s.chain)
+	if err != nil {
+		conn.Close(p2p.DiscQuitting)
+		t.Fatalf("status exchange failed: %v", err)
+	}
+	var (
+		head = s.chain.Head()
+		td   = s.chain.TD(head.NumberU64())
+	)
+	switch {
+	case status.ProtocolVersion != wshVersion:
+		t.Errorf("wrong protocol version %d, want %d", status.ProtocolVersion, wshVersion)
+	case status.Genesis != s.chain.Genesis().Hash():
+		t.Errorf("wrong genesis %x, want %x", status.Genesis, s.chain.Genesis().Hash())
+	case status.Head != head.Hash():
+		t.Errorf("wrong head %x, want %x (block %d)", status.Head, head.Hash(), head.NumberU64())
+	case status.TD == nil || status.TD.Cmp(td) != 0:
+		t.Errorf("wrong total difficulty %v, want %v", status.TD, td)
+	}
+	if t.Failed() {
+		conn.Close(p2p.DiscQuitting)
+		t.FailNow()
+	}
+	return conn
+}
+
+func sameHeaders(a, b []*types.Header) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].Hash() != b[i].Hash() {
+			return false
+		}
+	}
+	return true
+}
+
+func headerNumbers(headers []*types.Header) []uint64 {
+	numbers := make([]uint64, len(headers))
+	for i, h := range headers {
+		numbers[i] = h.Number.Uint64()
+	}
+	return numbers
+}
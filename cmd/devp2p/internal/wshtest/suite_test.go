@@ -0,0 +1,123 @@
+// Copyright 2018 The go-wiseplat Authors
+// This file is part of go-wiseplat.
+//
+// go-wiseplat is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-wiseplat is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-wiseplat. If not, see <http://www.gnu.org/licenses/>.
+
+package wshtest
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/wiseplat/go-wiseplat/core"
+	"github.com/wiseplat/go-wiseplat/core/types"
+	"github.com/wiseplat/go-wiseplat/internal/utesting"
+	"github.com/wiseplat/go-wiseplat/node"
+	"github.com/wiseplat/go-wiseplat/p2p"
+	"github.com/wiseplat/go-wiseplat/params"
+	"github.com/wiseplat/go-wiseplat/rlp"
+	"github.com/wiseplat/go-wiseplat/wsh"
+	"github.com/wiseplat/go-wiseplat/wshdb"
+)
+
+// Tests that an in-process node passes the whole suite.
+func TestWshSuite(t *testing.T) {
+	dir, err := ioutil.TempDir("", "wshtest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	genesis, blocks := makeTestChain(t, dir, 300)
+	stack := runTestNode(t, genesis, blocks)
+	defer stack.Stop()
+
+	suite, err := NewSuite(stack.Server().Self(), filepath.Join(dir, "chain.rlp"), filepath.Join(dir, "genesis.json"))
+	if err != nil {
+		t.Fatalf("could not create suite: %v", err)
+	}
+	if suite.chain.Len() != len(blocks)+1 {
+		t.Fatalf("wrong chain length %d, want %d", suite.chain.Len(), len(blocks)+1)
+	}
+	for _, result := range utesting.RunTests(suite.AllTests(), nil) {
+		if result.Failed {
+			t.Errorf("test %q failed:\n%s", result.Name, result.Output)
+		}
+	}
+}
+
+// makeTestChain generates a chain of n blocks and writes it to dir like
+// 'gwsh export' would, together with its genesis specification.
+func makeTestChain(t *testing.T, dir string, n int) (*core.Genesis, []*types.Block) {
+	genesis := &core.Genesis{Config: params.TestChainConfig, GasLimit: 4712388, Difficulty: big.NewInt(131072), Alloc: core.GenesisAlloc{}}
+	db, _ := wshdb.NewMemDatabase()
+	blocks, _ := core.GenerateChain(genesis.Config, genesis.MustCommit(db), db, n, nil)
+
+	spec, err := json.Marshal(genesis)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "genesis.json"), spec, 0644); err != nil {
+		t.Fatal(err)
+	}
+	var chain bytes.Buffer
+	for _, b := range blocks {
+		if err := rlp.Encode(&chain, b); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "chain.rlp"), chain.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return genesis, blocks
+}
+
+// runTestNode starts a node serving the given chain on a local port.
+func runTestNode(t *testing.T, genesis *core.Genesis, blocks []*types.Block) *node.Node {
+	stack, err := node.New(&node.Config{
+		Name: "wshtest",
+		P2P: p2p.Config{
+			ListenAddr:  "127.0.0.1:0",
+			NoDiscovery: true,
+			MaxPeers:    10,
+		},
+	})
+	if err != nil {
+		t.Fatalf("could not create node: %v", err)
+	}
+	config := wsh.DefaultConfig
+	config.Genesis = genesis
+	config.PowFake = true
+	if err := stack.Register(func(ctx *node.ServiceContext) (node.Service, error) { return wsh.New(ctx, &config) }); err != nil {
+		t.Fatalf("could not register wsh service: %v", err)
+	}
+	if err := stack.Start(); err != nil {
+		t.Fatalf("could not start node: %v", err)
+	}
+	var wiseplat *wsh.Wiseplat
+	if err := stack.Service(&wiseplat); err != nil {
+		stack.Stop()
+		t.Fatalf("could not get wsh service: %v", err)
+	}
+	if _, err := wiseplat.BlockChain().InsertChain(blocks); err != nil {
+		stack.Stop()
+		t.Fatalf("could not import chain: %v", err)
+	}
+	return stack
+}
@@ -0,0 +1,228 @@
+// Copyright 2018 The go-wiseplat Authors
+// This file is part of go-wiseplat.
+//
+// go-wiseplat is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-wiseplat is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-wiseplat. If not, see <http://www.gnu.org/licenses/>.
+
+package wshtest
+
+import (
+	"crypto/ecdsa"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"time"
+
+	"github.com/wiseplat/go-wiseplat/common"
+	"github.com/wiseplat/go-wiseplat/core/types"
+	"github.com/wiseplat/go-wiseplat/crypto"
+	"github.com/wiseplat/go-wiseplat/p2p"
+	"github.com/wiseplat/go-wiseplat/p2p/discover"
+	"github.com/wiseplat/go-wiseplat/rlp"
+)
+
+// The types and constants below mirror the wire protocol of package wsh. They are
+// duplicated here because the suite must test the protocol as it is specified,
+// not as it happens to be implemented.
+
+const (
+	wshVersion = 63
+
+	// baseProtocolLength is the number of message codes reserved by the devp2p
+	// base protocol. The codes of the first subprotocol start after it.
+	baseProtocolLength = 16
+
+	// devp2p base protocol message codes
+	discMsg = 0x01
+	pingMsg = 0x02
+	pongMsg = 0x03
+
+	// wsh protocol message codes
+	statusMsg          = 0x00
+	getBlockHeadersMsg = 0x03
+	blockHeadersMsg    = 0x04
+
+	maxMessageSize = 10 * 1024 * 1024 // maximum wsh message size accepted by nodes
+	maxHeaderFetch = 192              // maximum number of headers served per request
+
+	timeout = 20 * time.Second
+)
+
+var errDisconnected = errors.New("disconnected without reason")
+
+// Status is the network packet for the status message.
+type Status struct {
+	ProtocolVersion uint32
+	NetworkID       uint64
+	TD              *big.Int
+	Head            common.Hash
+	Genesis         common.Hash
+}
+
+// GetBlockHeaders represents a block header query.
+type GetBlockHeaders struct {
+	Origin  HashOrNumber
+	Amount  uint64
+	Skip    uint64
+	Reverse bool
+}
+
+// HashOrNumber is a combined field for specifying an origin block.
+type HashOrNumber struct {
+	Hash   common.Hash
+	Number uint64
+}
+
+// EncodeRLP encodes either the hash or the number of the origin.
+func (hn *HashOrNumber) EncodeRLP(w io.Writer) error {
+	if hn.Hash == (common.Hash{}) {
+		return rlp.Encode(w, hn.Number)
+	}
+	if hn.Number != 0 {
+		return fmt.Errorf("both origin hash (%x) and number (%d) provided", hn.Hash, hn.Number)
+	}
+	return rlp.Encode(w, hn.Hash)
+}
+
+// DecodeRLP decodes either a block hash or a block number.
+func (hn *HashOrNumber) DecodeRLP(s *rlp.Stream) error {
+	_, size, _ := s.Kind()
+	origin, err := s.Raw()
+	if err == nil {
+		switch {
+		case size == 32:
+			err = rlp.DecodeBytes(origin, &hn.Hash)
+		case size <= 8:
+			err = rlp.DecodeBytes(origin, &hn.Number)
+		default:
+			err = fmt.Errorf("invalid input size %d for origin", size)
+		}
+	}
+	return err
+}
+
+// Conn is an RLPx connection to the node under test which has negotiated the
+// wsh protocol.
+type Conn struct {
+	*p2p.RLPxConn
+	key  *ecdsa.PrivateKey
+	caps []p2p.Cap // capabilities of the remote node
+}
+
+// dial connects to the given node and performs the RLPx handshakes, announcing
+// the wsh protocol as the only capability.
+func dial(dest *discover.Node) (*Conn, error) {
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		return nil, err
+	}
+	fd, err := net.DialTimeout("tcp", fmt.Sprintf("%v:%d", dest.IP, dest.TCP), timeout)
+	if err != nil {
+		return nil, err
+	}
+	conn := &Conn{RLPxConn: p2p.NewRLPxConn(fd), key: key}
+	if err := conn.Handshake(key, dest); err != nil {
+		fd.Close()
+		return nil, fmt.Errorf("encryption handshake failed: %v", err)
+	}
+	caps := []p2p.Cap{{Name: "wsh", Version: wshVersion}}
+	if conn.caps, err = conn.ProtoHandshake(key, "devp2p-wshtest", caps); err != nil {
+		fd.Close()
+		return nil, fmt.Errorf("protocol handshake failed: %v", err)
+	}
+	return conn, nil
+}
+
+// hasCap reports whether the remote node announced the given capability.
+func (c *Conn) hasCap(name string, version uint) bool {
+	for _, cap := range c.caps {
+		if cap.Name == name && cap.Version == version {
+			return true
+		}
+	}
+	return false
+}
+
+// statusExchange reads the status message of the node and answers it with a
+// status describing the given chain.
+func (c *Conn) statusExchange(chain *Chain) (*Status, error) {
+	their := new(Status)
+	if err := c.readWsh(statusMsg, their); err != nil {
+		return nil, err
+	}
+	our := &Status{
+		ProtocolVersion: wshVersion,
+		NetworkID:       their.NetworkID,
+		TD:              chain.TD(chain.Head().NumberU64()),
+		Head:            chain.Head().Hash(),
+		Genesis:         chain.Genesis().Hash(),
+	}
+	if err := c.writeWsh(statusMsg, our); err != nil {
+		return nil, err
+	}
+	return their, nil
+}
+
+// getBlockHeaders sends a header query and waits for the response.
+func (c *Conn) getBlockHeaders(req *GetBlockHeaders) ([]*types.Header, error) {
+	if err := c.writeWsh(getBlockHeadersMsg, req); err != nil {
+		return nil, err
+	}
+	var headers []*types.Header
+	if err := c.readWsh(blockHeadersMsg, &headers); err != nil {
+		return nil, err
+	}
+	return headers, nil
+}
+
+// writeWsh sends a wsh protocol message.
+func (c *Conn) writeWsh(code uint64, data interface{}) error {
+	return p2p.Send(c, baseProtocolLength+code, data)
+}
+
+// readWsh waits for the wsh protocol message with the given code and decodes it
+// into val. Pings of the base protocol are answered and unrelated wsh messages,
+// like transaction and block announcements, are skipped. If the node disconnects,
+// the error is the reason it sent.
+func (c *Conn) readWsh(code uint64, val interface{}) error {
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		msg, err := c.ReadMsg()
+		if err != nil {
+			return err
+		}
+		switch {
+		case msg.Code == pingMsg:
+			msg.Discard()
+			if err := p2p.Send(c, pongMsg, []interface{}{}); err != nil {
+				return err
+			}
+		case msg.Code == discMsg:
+			var reason []p2p.DiscReason
+			if err := msg.Decode(&reason); err != nil || len(reason) == 0 {
+				return errDisconnected
+			}
+			return reason[0]
+		case msg.Code == baseProtocolLength+code:
+			if err := msg.Decode(val); err != nil {
+				return fmt.Errorf("invalid message %d: %v", code, err)
+			}
+			return nil
+		default:
+			msg.Discard()
+		}
+	}
+	return fmt.Errorf("timeout waiting for message %d", code)
+}
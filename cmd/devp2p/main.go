@@ -0,0 +1,67 @@
+// Copyright 2018 The go-wiseplat Authors
+// This file is part of go-wiseplat.
+//
+// go-wiseplat is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-wiseplat is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-wiseplat. If not, see <http://www.gnu.org/licenses/>.
+
+// devp2p is a utility for working with the devp2p networking stack.
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/wiseplat/go-wiseplat/cmd/utils"
+	"github.com/wiseplat/go-wiseplat/log"
+	"gopkg.in/urfave/cli.v1"
+)
+
+var (
+	// Git SHA1 commit hash of the release (set via linker flags)
+	gitCommit = ""
+)
+
+var app *cli.App
+
+func init() {
+	app = utils.NewApp(gitCommit, "go-wiseplat devp2p tool")
+	app.Commands = []cli.Command{
+		dnsCommand,
+		discv4Command,
+		discv5Command,
+		rlpxCommand,
+	}
+	app.Flags = []cli.Flag{
+		verbosityFlag,
+	}
+	app.Before = func(ctx *cli.Context) error {
+		log.Root().SetHandler(log.LvlFilterHandler(log.Lvl(ctx.GlobalInt(verbosityFlag.Name)), log.StreamHandler(os.Stderr, log.TerminalFormat(true))))
+		return nil
+	}
+}
+
+// Commonly used command line flags.
+var (
+	verbosityFlag = cli.IntFlag{
+		Name:  "verbosity",
+		Value: 3,
+		Usage: "Logging verbosity: 0=silent, 1=error, 2=warn, 3=info, 4=debug, 5=detail",
+	}
+)
+
+func main() {
+	if err := app.Run(os.Args); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
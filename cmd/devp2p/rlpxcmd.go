@@ -0,0 +1,111 @@
+// Copyright 2018 The go-wiseplat Authors
+// This file is part of go-wiseplat.
+//
+// go-wiseplat is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-wiseplat is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-wiseplat. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"fmt"
+	"net"
+	"os"
+
+	"github.com/wiseplat/go-wiseplat/cmd/devp2p/internal/wshtest"
+	"github.com/wiseplat/go-wiseplat/crypto"
+	"github.com/wiseplat/go-wiseplat/internal/utesting"
+	"github.com/wiseplat/go-wiseplat/p2p"
+	"gopkg.in/urfave/cli.v1"
+)
+
+var (
+	rlpxCommand = cli.Command{
+		Name:  "rlpx",
+		Usage: "RLPx Commands",
+		Subcommands: []cli.Command{
+			rlpxPingCommand,
+			rlpxWshTestCommand,
+		},
+	}
+	rlpxPingCommand = cli.Command{
+		Name:      "ping",
+		Usage:     "Performs the RLPx handshakes with a node and prints its capabilities",
+		ArgsUsage: "<node>",
+		Action:    rlpxPing,
+	}
+	rlpxWshTestCommand = cli.Command{
+		Name:      "wsh-test",
+		Usage:     "Runs the wsh protocol test suite against a node",
+		ArgsUsage: "<node> <chain.rlp> <genesis.json>",
+		Action:    rlpxWshTest,
+		Flags:     []cli.Flag{testPatternFlag},
+	}
+)
+
+var testPatternFlag = cli.StringFlag{
+	Name:  "run",
+	Usage: "Pattern of test names to run",
+}
+
+// rlpxPing performs rlpxPingCommand.
+func rlpxPing(ctx *cli.Context) error {
+	n, err := getNodeArg(ctx)
+	if err != nil {
+		return err
+	}
+	fd, err := net.Dial("tcp", fmt.Sprintf("%v:%d", n.IP, n.TCP))
+	if err != nil {
+		return err
+	}
+	conn := p2p.NewRLPxConn(fd)
+	defer conn.Close(p2p.DiscQuitting)
+
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		return err
+	}
+	if err := conn.Handshake(key, n); err != nil {
+		return fmt.Errorf("encryption handshake failed: %v", err)
+	}
+	caps, err := conn.ProtoHandshake(key, "devp2p", nil)
+	if err != nil {
+		return fmt.Errorf("protocol handshake failed: %v", err)
+	}
+	fmt.Printf("node capabilities: %v\n", caps)
+	return nil
+}
+
+// rlpxWshTest performs rlpxWshTestCommand.
+func rlpxWshTest(ctx *cli.Context) error {
+	if ctx.NArg() < 3 {
+		return fmt.Errorf("need node, chain file and genesis file as arguments")
+	}
+	n, err := getNodeArg(ctx)
+	if err != nil {
+		return err
+	}
+	suite, err := wshtest.NewSuite(n, ctx.Args().Get(1), ctx.Args().Get(2))
+	if err != nil {
+		return err
+	}
+	tests := suite.AllTests()
+	if ctx.IsSet(testPatternFlag.Name) {
+		tests = utesting.MatchTests(tests, ctx.String(testPatternFlag.Name))
+	}
+	results := utesting.RunTests(tests, os.Stdout)
+	if fails := utesting.CountFailures(results); fails > 0 {
+		return fmt.Errorf("%v of %v tests passed", len(tests)-fails, len(tests))
+	}
+	fmt.Printf("all tests passed\n")
+	return nil
+}
@@ -85,8 +85,13 @@ var (
 		utils.FastSyncFlag,
 		utils.LightModeFlag,
 		utils.SyncModeFlag,
+		utils.SyncFromFlag,
+		utils.SyncFromTdFlag,
+		utils.NoBackfillFlag,
 		utils.LightServFlag,
 		utils.LightPeersFlag,
+		utils.ULCServersFlag,
+		utils.ULCFractionFlag,
 		utils.LightKDFFlag,
 		utils.CacheFlag,
 		utils.TrieCacheGenFlag,
@@ -101,6 +106,7 @@ var (
 		utils.NATFlag,
 		utils.NoDiscoverFlag,
 		utils.DiscoveryV5Flag,
+		utils.DNSDiscoveryFlag,
 		utils.NetrestrictFlag,
 		utils.NodeKeyFileFlag,
 		utils.NodeKeyHexFlag,
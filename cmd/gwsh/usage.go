@@ -74,10 +74,15 @@ var AppHelpFlagGroups = []flagGroup{
 			utils.TestnetFlag,
 			utils.RinkebyFlag,
 			utils.SyncModeFlag,
+			utils.SyncFromFlag,
+			utils.SyncFromTdFlag,
+			utils.NoBackfillFlag,
 			utils.WshStatsURLFlag,
 			utils.IdentityFlag,
 			utils.LightServFlag,
 			utils.LightPeersFlag,
+			utils.ULCServersFlag,
+			utils.ULCFractionFlag,
 			utils.LightKDFFlag,
 		},
 	},
@@ -169,6 +174,7 @@ var AppHelpFlagGroups = []flagGroup{
 			utils.NATFlag,
 			utils.NoDiscoverFlag,
 			utils.DiscoveryV5Flag,
+			utils.DNSDiscoveryFlag,
 			utils.NetrestrictFlag,
 			utils.NodeKeyFileFlag,
 			utils.NodeKeyHexFlag,
@@ -0,0 +1,238 @@
+// Copyright 2018 The go-wiseplat Authors
+// This file is part of go-wiseplat.
+//
+// go-wiseplat is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-wiseplat is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-wiseplat. If not, see <http://www.gnu.org/licenses/>.
+
+// Command access creates access controlled manifests
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"github.com/wiseplat/go-wiseplat/cmd/utils"
+	"github.com/wiseplat/go-wiseplat/common"
+	"github.com/wiseplat/go-wiseplat/console"
+	"github.com/wiseplat/go-wiseplat/crypto"
+	"github.com/wiseplat/go-wiseplat/node"
+	"github.com/wiseplat/go-wiseplat/swarm/api"
+	swarm "github.com/wiseplat/go-wiseplat/swarm/api/client"
+	"gopkg.in/urfave/cli.v1"
+)
+
+var (
+	SwarmAccessPasswordFlag = cli.StringFlag{
+		Name:  "password",
+		Usage: "Password file protecting the content (prompted for if not set)",
+	}
+	SwarmAccessGrantKeyFlag = cli.StringFlag{
+		Name:  "grant-key",
+		Usage: "Hex encoded public key of the grantee",
+	}
+	SwarmAccessGrantKeysFlag = cli.StringFlag{
+		Name:  "grant-keys",
+		Usage: "File containing hex encoded public keys of the grantees, one per line",
+	}
+	SwarmAccessDryRunFlag = cli.BoolFlag{
+		Name:  "dry-run",
+		Usage: "Print the root manifest instead of uploading it",
+	}
+)
+
+// accessNewPass protects the manifest given as the first argument with a
+// password.
+func accessNewPass(ctx *cli.Context) {
+	ref := accessRef(ctx)
+	salt := accessSalt()
+
+	password := accessPassword(ctx, true)
+	accessEntry, err := api.NewAccessEntryPassword(salt, api.DefaultKdfParams)
+	if err != nil {
+		utils.Fatalf("Error creating access entry: %v", err)
+	}
+	sessionKey, err := api.NewSessionKeyPassword(password, accessEntry)
+	if err != nil {
+		utils.Fatalf("Error deriving session key: %v", err)
+	}
+	uploadAccessRoot(ctx, ref, sessionKey, accessEntry)
+}
+
+// accessNewPK shares the manifest given as the first argument with the holder
+// of a single private key.
+func accessNewPK(ctx *cli.Context) {
+	ref := accessRef(ctx)
+	salt := accessSalt()
+
+	grantee := ctx.String(SwarmAccessGrantKeyFlag.Name)
+	if grantee == "" {
+		utils.Fatalf("Option %q is required", SwarmAccessGrantKeyFlag.Name)
+	}
+	granteeKey := decodeGranteeKey(grantee)
+
+	publisher := accessPublisherKey(ctx)
+	accessEntry, err := api.NewAccessEntryPK(hex.EncodeToString(crypto.FromECDSAPub(&publisher.PublicKey)), salt)
+	if err != nil {
+		utils.Fatalf("Error creating access entry: %v", err)
+	}
+	sessionKey, err := api.NewSessionKeyPK(publisher, granteeKey, salt)
+	if err != nil {
+		utils.Fatalf("Error deriving session key: %v", err)
+	}
+	uploadAccessRoot(ctx, ref, sessionKey, accessEntry)
+}
+
+// accessNewACT shares the manifest given as the first argument with a list of
+// grantee keys and optionally a password, through an access control table.
+func accessNewACT(ctx *cli.Context) {
+	ref := accessRef(ctx)
+	salt := accessSalt()
+
+	var grantees []*ecdsa.PublicKey
+	if file := ctx.String(SwarmAccessGrantKeysFlag.Name); file != "" {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			utils.Fatalf("Error reading grantee keys: %v", err)
+		}
+		for _, line := range strings.Split(string(data), "\n") {
+			if line = strings.TrimSpace(line); line != "" {
+				grantees = append(grantees, decodeGranteeKey(line))
+			}
+		}
+	}
+	password := accessPassword(ctx, false)
+	if len(grantees) == 0 && password == "" {
+		utils.Fatalf("Need at least one grantee key or a password")
+	}
+
+	publisher := accessPublisherKey(ctx)
+	accessKey := make([]byte, api.AccessKeyLength)
+	if _, err := rand.Read(accessKey); err != nil {
+		utils.Fatalf("Error generating access key: %v", err)
+	}
+	bzzapi := strings.TrimRight(ctx.GlobalString(SwarmApiFlag.Name), "/")
+	client := swarm.NewClient(bzzapi)
+
+	// the table location is only known after upload, so create the entry
+	// with a placeholder and fill it in afterwards
+	accessEntry, err := api.NewAccessEntryACT(hex.EncodeToString(crypto.FromECDSAPub(&publisher.PublicKey)), salt, "")
+	if err != nil {
+		utils.Fatalf("Error creating access entry: %v", err)
+	}
+	entries, err := api.NewACTEntries(publisher, accessKey, accessEntry, grantees, password)
+	if err != nil {
+		utils.Fatalf("Error creating access control table: %v", err)
+	}
+	act := &api.Manifest{Entries: entries}
+	if ctx.Bool(SwarmAccessDryRunFlag.Name) {
+		printManifest(act)
+	} else {
+		accessEntry.Act, err = client.UploadManifest(act)
+		if err != nil {
+			utils.Fatalf("Error uploading access control table: %v", err)
+		}
+	}
+	uploadAccessRoot(ctx, ref, accessKey, accessEntry)
+}
+
+// uploadAccessRoot uploads the root manifest referencing ref encrypted with
+// the access key and prints its hash.
+func uploadAccessRoot(ctx *cli.Context, ref, accessKey []byte, accessEntry *api.AccessEntry) {
+	root := &api.Manifest{
+		Entries: []api.ManifestEntry{{
+			Hash:        hex.EncodeToString(api.EncryptRef(ref, accessKey)),
+			ContentType: api.ManifestType,
+			Access:      accessEntry,
+		}},
+	}
+	if ctx.Bool(SwarmAccessDryRunFlag.Name) {
+		printManifest(root)
+		return
+	}
+	bzzapi := strings.TrimRight(ctx.GlobalString(SwarmApiFlag.Name), "/")
+	hash, err := swarm.NewClient(bzzapi).UploadManifest(root)
+	if err != nil {
+		utils.Fatalf("Error uploading root manifest: %v", err)
+	}
+	fmt.Println(hash)
+}
+
+func accessRef(ctx *cli.Context) []byte {
+	args := ctx.Args()
+	if len(args) != 1 {
+		utils.Fatalf("Expected exactly one argument: the manifest hash to protect")
+	}
+	ref, err := hex.DecodeString(strings.TrimPrefix(args[0], "0x"))
+	if err != nil || len(ref) != common.HashLength {
+		utils.Fatalf("Invalid manifest hash %q", args[0])
+	}
+	return ref
+}
+
+func accessSalt() []byte {
+	salt := make([]byte, api.AccessSaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		utils.Fatalf("Error generating salt: %v", err)
+	}
+	return salt
+}
+
+// accessPassword reads the content password from the file given by the
+// password flag, prompting for it if the flag is not set and a password is
+// required.
+func accessPassword(ctx *cli.Context, required bool) string {
+	if file := ctx.String(SwarmAccessPasswordFlag.Name); file != "" {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			utils.Fatalf("Error reading password file: %v", err)
+		}
+		return strings.TrimRight(strings.Split(string(data), "\n")[0], "\r")
+	}
+	if !required {
+		return ""
+	}
+	password, err := console.Stdin.PromptPassword("Content password: ")
+	if err != nil {
+		utils.Fatalf("Failed to read password: %v", err)
+	}
+	return password
+}
+
+// accessPublisherKey loads the swarm account key, which publishes the content.
+func accessPublisherKey(ctx *cli.Context) *ecdsa.PrivateKey {
+	cfg := defaultNodeConfig
+	utils.SetNodeConfig(ctx, &cfg)
+	stack, err := node.New(&cfg)
+	if err != nil {
+		utils.Fatalf("can't create node: %v", err)
+	}
+	return getAccount(ctx, stack)
+}
+
+func decodeGranteeKey(key string) *ecdsa.PublicKey {
+	pub := crypto.ToECDSAPub(common.FromHex(key))
+	if pub == nil || pub.X == nil {
+		utils.Fatalf("Invalid grantee public key %q", key)
+	}
+	return pub
+}
+
+func printManifest(m *api.Manifest) {
+	data, _ := json.MarshalIndent(m, "", "  ")
+	fmt.Println(string(data))
+}
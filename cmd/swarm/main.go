@@ -240,6 +240,64 @@ Removes a path from the manifest
 				},
 			},
 		},
+		{
+			Name:      "access",
+			Usage:     "encrypts a reference and embeds it into a root manifest",
+			ArgsUsage: "access COMMAND",
+			Description: `
+Encrypts a manifest reference and embeds it into a root manifest, restricting
+access to the content to the given credentials.
+`,
+			Subcommands: []cli.Command{
+				{
+					Name:      "new",
+					Usage:     "encrypts a reference and embeds it into a root manifest",
+					ArgsUsage: "new COMMAND",
+					Description: `
+Encrypts a manifest reference and embeds it into a root manifest.
+`,
+					Subcommands: []cli.Command{
+						{
+							Action:    accessNewPass,
+							Name:      "pass",
+							Usage:     "encrypts a reference with a password and embeds it into a root manifest",
+							ArgsUsage: "<ref>",
+							Flags:     []cli.Flag{SwarmAccessPasswordFlag, SwarmAccessDryRunFlag},
+							Description: `
+Encrypts a reference with a session key derived from a password (scrypt) and
+embeds it into a root manifest. Clients are asked for the password when
+accessing the root manifest through bzz:/.
+`,
+						},
+						{
+							Action:    accessNewPK,
+							Name:      "pk",
+							Usage:     "encrypts a reference with the node's private key and a given grantee's public key and embeds it into a root manifest",
+							ArgsUsage: "<ref>",
+							Flags:     []cli.Flag{SwarmAccessGrantKeyFlag, SwarmAccessDryRunFlag},
+							Description: `
+Encrypts a reference with a session key derived via ECDH between the swarm
+account key (--bzzaccount) and the grantee's public key, and embeds it into a
+root manifest. Only the grantee's swarm node can access the content.
+`,
+						},
+						{
+							Action:    accessNewACT,
+							Name:      "act",
+							Usage:     "encrypts a reference with a random access key and shares it with a list of grantees through an access control table",
+							ArgsUsage: "<ref>",
+							Flags:     []cli.Flag{SwarmAccessGrantKeysFlag, SwarmAccessPasswordFlag, SwarmAccessDryRunFlag},
+							Description: `
+Encrypts a reference with a random access key and uploads an access control
+table (ACT) manifest holding the access key encrypted for every grantee public
+key, and optionally for a password. The root manifest referencing the ACT is
+printed.
+`,
+						},
+					},
+				},
+			},
+		},
 		{
 			Name:      "db",
 			Usage:     "manage the local chunk database",
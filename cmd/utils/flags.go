@@ -166,9 +166,21 @@ var (
 	defaultSyncMode = wsh.DefaultConfig.SyncMode
 	SyncModeFlag    = TextMarshalerFlag{
 		Name:  "syncmode",
-		Usage: `Blockchain sync mode ("fast", "full", or "light")`,
+		Usage: `Blockchain sync mode ("fast", "full", "light" or "beam")`,
 		Value: &defaultSyncMode,
 	}
+	SyncFromFlag = cli.StringFlag{
+		Name:  "syncfrom",
+		Usage: "Trusted block hash to start an empty chain from when fast syncing",
+	}
+	SyncFromTdFlag = BigFlag{
+		Name:  "syncfrom.td",
+		Usage: "Trusted total difficulty of the --syncfrom checkpoint (required with --syncfrom.nobackfill)",
+	}
+	NoBackfillFlag = cli.BoolFlag{
+		Name:  "syncfrom.nobackfill",
+		Usage: "Disables retrieving the blocks preceding the --syncfrom checkpoint",
+	}
 
 	LightServFlag = cli.IntFlag{
 		Name:  "lightserv",
@@ -180,6 +192,16 @@ var (
 		Usage: "Maximum number of LES client peers",
 		Value: 20,
 	}
+	ULCServersFlag = cli.StringFlag{
+		Name:  "ulc.servers",
+		Usage: "Comma separated enode URLs of the trusted servers of the ultra light client mode",
+		Value: "",
+	}
+	ULCFractionFlag = cli.IntFlag{
+		Name:  "ulc.fraction",
+		Usage: "Minimum percentage of trusted servers announcing a head for the ultra light client to accept it",
+		Value: wsh.DefaultULCMinTrustedFraction,
+	}
 	LightKDFFlag = cli.BoolFlag{
 		Name:  "lightkdf",
 		Usage: "Reduce key-derivation RAM & CPU usage at some expense of KDF strength",
@@ -480,6 +502,11 @@ var (
 		Name:  "v5disc",
 		Usage: "Enables the experimental RLPx V5 (Topic Discovery) mechanism",
 	}
+	DNSDiscoveryFlag = cli.StringFlag{
+		Name:  "dnsdisc",
+		Usage: "Comma separated enrtree:// URLs of DNS node lists used as dial candidates",
+		Value: "",
+	}
 	NetrestrictFlag = cli.StringFlag{
 		Name:  "netrestrict",
 		Usage: "Restricts network communication to the given IP networks (CIDR masks)",
@@ -818,6 +845,10 @@ func SetP2PConfig(ctx *cli.Context, cfg *p2p.Config) {
 		cfg.DiscoveryV5 = true
 	}
 
+	if urls := ctx.GlobalString(DNSDiscoveryFlag.Name); urls != "" {
+		cfg.DNSDiscovery = strings.Split(urls, ",")
+	}
+
 	if netrestrict := ctx.GlobalString(NetrestrictFlag.Name); netrestrict != "" {
 		list, err := netutil.ParseNetlist(netrestrict)
 		if err != nil {
@@ -833,6 +864,7 @@ func SetP2PConfig(ctx *cli.Context, cfg *p2p.Config) {
 		cfg.DiscoveryV5Addr = ":0"
 		cfg.NoDiscovery = true
 		cfg.DiscoveryV5 = false
+		cfg.DNSDiscovery = nil
 	}
 }
 
@@ -951,6 +983,21 @@ func SetShhConfig(ctx *cli.Context, stack *node.Node, cfg *whisper.Config) {
 	}
 }
 
+// setULC configures the ultra light client mode from the command line flags.
+func setULC(ctx *cli.Context, cfg *wsh.Config) {
+	if !ctx.GlobalIsSet(ULCServersFlag.Name) {
+		return
+	}
+	cfg.ULC = &wsh.ULCConfig{
+		MinTrustedFraction: ctx.GlobalInt(ULCFractionFlag.Name),
+	}
+	for _, url := range strings.Split(ctx.GlobalString(ULCServersFlag.Name), ",") {
+		if url = strings.TrimSpace(url); url != "" {
+			cfg.ULC.TrustedServers = append(cfg.ULC.TrustedServers, url)
+		}
+	}
+}
+
 // SetWshConfig applies wsh-related command line flags to the config.
 func SetWshConfig(ctx *cli.Context, stack *node.Node, cfg *wsh.Config) {
 	// Avoid conflicting network flags
@@ -971,12 +1018,24 @@ func SetWshConfig(ctx *cli.Context, stack *node.Node, cfg *wsh.Config) {
 	case ctx.GlobalBool(LightModeFlag.Name):
 		cfg.SyncMode = downloader.LightSync
 	}
+	if ctx.GlobalIsSet(SyncFromFlag.Name) {
+		if err := cfg.SyncFrom.UnmarshalText([]byte(ctx.GlobalString(SyncFromFlag.Name))); err != nil {
+			Fatalf("Option %q: %v", SyncFromFlag.Name, err)
+		}
+	}
+	if ctx.GlobalIsSet(SyncFromTdFlag.Name) {
+		cfg.SyncFromTd = GlobalBig(ctx, SyncFromTdFlag.Name)
+	}
+	if ctx.GlobalIsSet(NoBackfillFlag.Name) {
+		cfg.NoBackfill = ctx.GlobalBool(NoBackfillFlag.Name)
+	}
 	if ctx.GlobalIsSet(LightServFlag.Name) {
 		cfg.LightServ = ctx.GlobalInt(LightServFlag.Name)
 	}
 	if ctx.GlobalIsSet(LightPeersFlag.Name) {
 		cfg.LightPeers = ctx.GlobalInt(LightPeersFlag.Name)
 	}
+	setULC(ctx, cfg)
 	if ctx.GlobalIsSet(NetworkIdFlag.Name) {
 		cfg.NetworkId = ctx.GlobalUint64(NetworkIdFlag.Name)
 	}
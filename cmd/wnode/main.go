@@ -23,7 +23,6 @@ import (
 	"bufio"
 	"crypto/ecdsa"
 	"crypto/sha512"
-	"encoding/binary"
 	"encoding/hex"
 	"flag"
 	"fmt"
@@ -90,6 +89,7 @@ var (
 	argMaxSize   = flag.Uint("maxsize", uint(whisper.DefaultMaxMessageSize), "max size of message")
 	argPoW       = flag.Float64("pow", whisper.DefaultMinimumPoW, "PoW for normal messages in float format (e.g. 2.7)")
 	argServerPoW = flag.Float64("mspow", whisper.DefaultMinimumPoW, "PoW requirement for Mail Server request")
+	argMaxAge    = flag.Duration("msmaxage", 0, "Mail Server deletes archived messages older than this (0 keeps all)")
 
 	argIP      = flag.String("ip", "", "IP address and port of this node (e.g. 127.0.0.1:30373)")
 	argPub     = flag.String("pub", "", "public key for asymmetric encryption")
@@ -214,6 +214,9 @@ func initialize() {
 		shh = whisper.New(cfg)
 		shh.RegisterServer(&mailServer)
 		mailServer.Init(shh, *argDBPath, msPassword, *argServerPoW)
+		if *argMaxAge > 0 {
+			mailServer.StartPruning(*argMaxAge, time.Hour)
+		}
 	} else {
 		shh = whisper.New(cfg)
 	}
@@ -619,13 +622,11 @@ func requestExpiredMessagesLoop() {
 			timeUpp = 0xFFFFFFFF
 		}
 
-		data := make([]byte, 8+whisper.TopicLength)
-		binary.BigEndian.PutUint32(data, timeLow)
-		binary.BigEndian.PutUint32(data[4:], timeUpp)
-		copy(data[8:], xt[:])
-		if xt == empty {
-			data = data[:8]
+		request := mailserver.MessagesRequest{Lower: timeLow, Upper: timeUpp}
+		if xt != empty {
+			request.Topics = []whisper.TopicType{xt}
 		}
+		data := request.Payload()
 
 		var params whisper.MessageParams
 		params.PoW = *argServerPoW
@@ -0,0 +1,123 @@
+// Copyright 2018 The go-wiseplat Authors
+// This file is part of the go-wiseplat library.
+//
+// The go-wiseplat library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-wiseplat library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-wiseplat library. If not, see <http://www.gnu.org/licenses/>.
+
+// Package checkpointoracle is an on-chain light client checkpoint oracle.
+package checkpointoracle
+
+//go:generate abigen --sol contract/oracle.sol --pkg contract --out contract/oracle.go
+
+import (
+	"encoding/binary"
+	"errors"
+	"math/big"
+
+	"github.com/wiseplat/go-wiseplat/accounts/abi/bind"
+	"github.com/wiseplat/go-wiseplat/common"
+	"github.com/wiseplat/go-wiseplat/contracts/checkpointoracle/contract"
+	"github.com/wiseplat/go-wiseplat/core/types"
+	"github.com/wiseplat/go-wiseplat/crypto"
+)
+
+// NewCheckpointVoteTopic is the log topic of the NewCheckpointVote event
+// emitted by the oracle for every accepted admin signature.
+var NewCheckpointVoteTopic = crypto.Keccak256Hash([]byte("NewCheckpointVote(uint64,bytes32,uint8,bytes32,bytes32)"))
+
+var (
+	errInvalidSignature = errors.New("invalid checkpoint signature")
+	errInvalidVoteLog   = errors.New("invalid checkpoint vote log")
+)
+
+// CheckpointOracle is a Go wrapper around an on-chain checkpoint oracle contract.
+type CheckpointOracle struct {
+	address  common.Address
+	contract *contract.CheckpointOracle
+}
+
+// NewCheckpointOracle binds checkpoint contract and returns a registrar instance.
+func NewCheckpointOracle(contractAddr common.Address, backend bind.ContractBackend) (*CheckpointOracle, error) {
+	c, err := contract.NewCheckpointOracle(contractAddr, backend)
+	if err != nil {
+		return nil, err
+	}
+	return &CheckpointOracle{address: contractAddr, contract: c}, nil
+}
+
+// ContractAddr returns the address of contract.
+func (oracle *CheckpointOracle) ContractAddr() common.Address {
+	return oracle.address
+}
+
+// Contract returns the underlying contract instance.
+func (oracle *CheckpointOracle) Contract() *contract.CheckpointOracle {
+	return oracle.contract
+}
+
+// LookupCheckpointVotes searches the given logs for the admin votes approving
+// the checkpoint with the given section index and hash, returning them as
+// 65 byte [R || S || V] signatures (V being 0 or 1) in the order they were
+// accepted by the contract.
+func (oracle *CheckpointOracle) LookupCheckpointVotes(logs []*types.Log, section uint64, hash common.Hash) ([][]byte, error) {
+	var sigs [][]byte
+	for _, l := range logs {
+		if l.Address != oracle.address || len(l.Topics) != 2 || l.Topics[0] != NewCheckpointVoteTopic {
+			continue
+		}
+		if len(l.Data) != 4*32 {
+			return nil, errInvalidVoteLog
+		}
+		if new(big.Int).SetBytes(l.Topics[1].Bytes()).Uint64() != section || common.BytesToHash(l.Data[:32]) != hash {
+			continue
+		}
+		sig := make([]byte, 65)
+		copy(sig, l.Data[64:128])
+		sig[64] = l.Data[63] - 27
+		sigs = append(sigs, sig)
+	}
+	return sigs, nil
+}
+
+// RegisterCheckpoint registers the checkpoint with a batch of associated signatures
+// that are collected off-chain and sorted by ascending signer address.
+//
+// Notably all signatures given should be transformed to "wiseplat style" which
+// transforms v from 0/1 to 27/28 according to the yellow paper.
+func (oracle *CheckpointOracle) RegisterCheckpoint(opts *bind.TransactOpts, index uint64, hash []byte, rnum *big.Int, rhash [32]byte, sigs [][]byte) (*types.Transaction, error) {
+	var (
+		r [][32]byte
+		s [][32]byte
+		v []uint8
+	)
+	for i := 0; i < len(sigs); i++ {
+		if len(sigs[i]) != 65 {
+			return nil, errInvalidSignature
+		}
+		r = append(r, common.BytesToHash(sigs[i][:32]))
+		s = append(s, common.BytesToHash(sigs[i][32:64]))
+		v = append(v, sigs[i][64])
+	}
+	return oracle.contract.SetCheckpoint(opts, rnum, rhash, common.BytesToHash(hash), index, v, r, s)
+}
+
+// SignHash returns the hash the oracle admins need to sign in order to approve
+// the checkpoint hash at the given section index, following EIP 191 with the
+// oracle contract as the intended validator:
+//
+//	keccak256(0x19 || 0x00 || oracle || index || hash)
+func SignHash(oracle common.Address, index uint64, hash common.Hash) []byte {
+	buf := make([]byte, 8)
+	binary.BigEndian.PutUint64(buf, index)
+	return crypto.Keccak256([]byte{0x19, 0x00}, oracle.Bytes(), buf, hash.Bytes())
+}
@@ -0,0 +1,384 @@
+// Copyright 2018 The go-wiseplat Authors
+// This file is part of the go-wiseplat library.
+//
+// The go-wiseplat library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-wiseplat library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-wiseplat library. If not, see <http://www.gnu.org/licenses/>.
+
+package checkpointoracle
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"encoding/json"
+	"io/ioutil"
+	"math/big"
+	"os/exec"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/wiseplat/go-wiseplat/accounts/abi"
+	"github.com/wiseplat/go-wiseplat/accounts/abi/bind"
+	"github.com/wiseplat/go-wiseplat/accounts/abi/bind/backends"
+	"github.com/wiseplat/go-wiseplat/common"
+	"github.com/wiseplat/go-wiseplat/common/compiler"
+	"github.com/wiseplat/go-wiseplat/contracts/checkpointoracle/contract"
+	"github.com/wiseplat/go-wiseplat/core"
+	"github.com/wiseplat/go-wiseplat/core/types"
+	"github.com/wiseplat/go-wiseplat/crypto"
+	"github.com/wiseplat/go-wiseplat/params"
+)
+
+const (
+	testSectionSize     = 4
+	testProcessConfirms = 2
+	testThreshold       = 2
+)
+
+// Account is a test account with its private key and address.
+type Account struct {
+	key  *ecdsa.PrivateKey
+	addr common.Address
+}
+
+type Accounts []Account
+
+func (a Accounts) Len() int           { return len(a) }
+func (a Accounts) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
+func (a Accounts) Less(i, j int) bool { return bytes.Compare(a[i].addr.Bytes(), a[j].addr.Bytes()) < 0 }
+
+// setupOracleTest creates a blockchain simulator with a set of funded admin
+// accounts, sorted by address, and deploys a checkpoint oracle owned by them
+// from the given creation code. The last account is funded but not an admin.
+func setupOracleTest(t *testing.T, admins int, code []byte) (Accounts, *CheckpointOracle, *backends.SimulatedBackend) {
+	var accounts Accounts
+	alloc := make(core.GenesisAlloc)
+	for i := 0; i < admins+1; i++ {
+		key, _ := crypto.GenerateKey()
+		addr := crypto.PubkeyToAddress(key.PublicKey)
+		accounts = append(accounts, Account{key: key, addr: addr})
+		alloc[addr] = core.GenesisAccount{Balance: big.NewInt(1000000000000000000)}
+	}
+	outsider := accounts[admins]
+	accounts = accounts[:admins]
+	sort.Sort(accounts)
+
+	var addrs []common.Address
+	for _, account := range accounts {
+		addrs = append(addrs, account.addr)
+	}
+	parsed, err := abi.JSON(strings.NewReader(contract.CheckpointOracleABI))
+	if err != nil {
+		t.Fatalf("Failed to parse oracle ABI: %v", err)
+	}
+	sim := backends.NewSimulatedBackend(alloc)
+	addr, _, _, err := bind.DeployContract(bind.NewKeyedTransactor(accounts[0].key), parsed, code, sim, addrs, big.NewInt(testSectionSize), big.NewInt(testProcessConfirms), big.NewInt(testThreshold))
+	if err != nil {
+		t.Fatalf("Failed to deploy checkpoint oracle: %v", err)
+	}
+	sim.Commit()
+
+	oracle, err := NewCheckpointOracle(addr, sim)
+	if err != nil {
+		t.Fatalf("Failed to bind checkpoint oracle: %v", err)
+	}
+	return append(accounts, outsider), oracle, sim
+}
+
+// sign creates the oracle signatures of the given admins for a checkpoint.
+func sign(t *testing.T, oracle *CheckpointOracle, index uint64, hash common.Hash, signers ...Account) [][]byte {
+	var sigs [][]byte
+	for _, signer := range signers {
+		sig, err := crypto.Sign(SignHash(oracle.ContractAddr(), index, hash), signer.key)
+		if err != nil {
+			t.Fatalf("Failed to sign checkpoint: %v", err)
+		}
+		sig[64] += 27 // Transform V from 0/1 to 27/28 according to the yellow paper
+		sigs = append(sigs, sig)
+	}
+	return sigs
+}
+
+// register tries to register a checkpoint, returning the transaction receipt
+// or nil if the registration was rejected.
+func register(t *testing.T, oracle *CheckpointOracle, sim *backends.SimulatedBackend, sender Account, index uint64, hash common.Hash, sigs [][]byte) *types.Receipt {
+	head, err := sim.HeaderByNumber(context.Background(), nil)
+	if err != nil {
+		t.Fatalf("Failed to retrieve head: %v", err)
+	}
+	return registerAt(t, oracle, sim, sender, index, hash, sigs, head.Number, head.Hash())
+}
+
+// registerAt is like register, but replay protects the registration with the
+// given recent block number and hash instead of the current head.
+func registerAt(t *testing.T, oracle *CheckpointOracle, sim *backends.SimulatedBackend, sender Account, index uint64, hash common.Hash, sigs [][]byte, rnum *big.Int, rhash common.Hash) *types.Receipt {
+	tx, err := oracle.RegisterCheckpoint(bind.NewKeyedTransactor(sender.key), index, hash.Bytes(), rnum, rhash, sigs)
+	if err != nil {
+		// Gas estimation fails if the transaction is going to be reverted
+		return nil
+	}
+	sim.Commit()
+
+	receipt, _ := sim.TransactionReceipt(context.Background(), tx.Hash())
+	if receipt == nil {
+		t.Fatalf("Missing receipt for checkpoint registration")
+	}
+	if receipt.Status != types.ReceiptStatusSuccessful {
+		return nil
+	}
+	return receipt
+}
+
+// compileOracleSource compiles contract/oracle.sol with the local solc, the same
+// way as the go:generate directive of the package. The source can't be checked
+// against the bindings without a compiler for its language version, so the
+// test fails if none is available.
+func compileOracleSource(t *testing.T) *compiler.Contract {
+	if _, err := exec.LookPath("solc"); err != nil {
+		t.Fatalf("solc 0.4.x is needed to check the bindings against oracle.sol: %v", err)
+	}
+	solc, err := compiler.SolidityVersion("")
+	if err != nil {
+		t.Fatalf("Failed to retrieve solc version: %v", err)
+	}
+	if solc.Major != 0 || solc.Minor != 4 {
+		t.Fatalf("oracle.sol needs solc 0.4.x, have %s", solc.Version)
+	}
+	contracts, err := compiler.CompileSolidity("", "contract/oracle.sol")
+	if err != nil {
+		t.Fatalf("Failed to compile oracle source: %v", err)
+	}
+	if len(contracts) != 1 {
+		t.Fatalf("Contract count mismatch: have %d, want 1", len(contracts))
+	}
+	for name, c := range contracts {
+		if !strings.HasSuffix(name, ":CheckpointOracle") {
+			t.Fatalf("Unexpected contract %s in oracle source", name)
+		}
+		return c
+	}
+	return nil
+}
+
+// Tests that the oracle bytecode shipped in the bindings behaves as specified
+// by contract/oracle.sol.
+func TestCheckpointOracle(t *testing.T) {
+	code := common.FromHex(contract.CheckpointOracleBin)
+	t.Run("Creation", func(t *testing.T) { testCheckpointOracleCreation(t, code) })
+	t.Run("Registration", func(t *testing.T) { testCheckpointRegistration(t, code) })
+	t.Run("Replay", func(t *testing.T) { testCheckpointReplayProtection(t, code) })
+	t.Run("Malformed", func(t *testing.T) { testCheckpointMalformedVotes(t, code) })
+}
+
+// Tests that contract/oracle.go is exactly what abigen generates from
+// contract/oracle.sol, so the bytecode deployed and tested is built from the
+// source.
+func TestCheckpointOracleBindings(t *testing.T) {
+	c := compileOracleSource(t)
+
+	abi, err := json.Marshal(c.Info.AbiDefinition)
+	if err != nil {
+		t.Fatalf("Failed to flatten oracle ABI: %v", err)
+	}
+	want, err := bind.Bind([]string{"CheckpointOracle"}, []string{string(abi)}, []string{c.Code}, "contract", bind.LangGo)
+	if err != nil {
+		t.Fatalf("Failed to generate oracle bindings: %v", err)
+	}
+	have, err := ioutil.ReadFile("contract/oracle.go")
+	if err != nil {
+		t.Fatalf("Failed to read oracle bindings: %v", err)
+	}
+	if string(have) != want {
+		t.Fatalf("contract/oracle.go is not generated from contract/oracle.sol, run go generate")
+	}
+}
+
+// Tests that the oracle compiled from contract/oracle.sol passes the same
+// behavioural checks as the shipped bytecode.
+func TestCheckpointOracleSource(t *testing.T) {
+	code := common.FromHex(compileOracleSource(t).Code)
+	t.Run("Creation", func(t *testing.T) { testCheckpointOracleCreation(t, code) })
+	t.Run("Registration", func(t *testing.T) { testCheckpointRegistration(t, code) })
+	t.Run("Replay", func(t *testing.T) { testCheckpointReplayProtection(t, code) })
+	t.Run("Malformed", func(t *testing.T) { testCheckpointMalformedVotes(t, code) })
+}
+
+// Tests that the oracle can be deployed with its admin list and that an empty
+// checkpoint is reported before any registration.
+func testCheckpointOracleCreation(t *testing.T, code []byte) {
+	accounts, oracle, _ := setupOracleTest(t, 3, code)
+	accounts = accounts[:3]
+
+	admins, err := oracle.Contract().GetAllAdmin(nil)
+	if err != nil {
+		t.Fatalf("Failed to retrieve admins: %v", err)
+	}
+	if len(admins) != len(accounts) {
+		t.Fatalf("Admin count mismatch: have %d, want %d", len(admins), len(accounts))
+	}
+	for i, admin := range admins {
+		if admin != accounts[i].addr {
+			t.Errorf("Admin %d mismatch: have %x, want %x", i, admin, accounts[i].addr)
+		}
+	}
+	index, hash, height, err := oracle.Contract().GetLatestCheckpoint(nil)
+	if err != nil {
+		t.Fatalf("Failed to retrieve latest checkpoint: %v", err)
+	}
+	if index != 0 || hash != (common.Hash{}) || height.Sign() != 0 {
+		t.Fatalf("Unexpected initial checkpoint: index %d, hash %x, height %v", index, hash, height)
+	}
+}
+
+// Tests that checkpoints are only accepted with enough ordered admin signatures
+// and only once the section is old enough.
+func testCheckpointRegistration(t *testing.T, code []byte) {
+	accounts, oracle, sim := setupOracleTest(t, 3, code)
+	outsider := accounts[3]
+
+	checkpoint := &params.TrustedCheckpoint{
+		SectionIndex: 0,
+		SectionHead:  common.HexToHash("0x01"),
+		CHTRoot:      common.HexToHash("0x02"),
+		BloomRoot:    common.HexToHash("0x03"),
+	}
+	hash := checkpoint.Hash()
+
+	// The section is not yet confirmed, registration must fail
+	if register(t, oracle, sim, accounts[0], 0, hash, sign(t, oracle, 0, hash, accounts[0], accounts[1])) != nil {
+		t.Fatalf("Accepted checkpoint for unconfirmed section")
+	}
+	for i := 0; i < testSectionSize+testProcessConfirms; i++ {
+		sim.Commit()
+	}
+	// Non-admin senders, empty hashes, not enough signatures, unordered
+	// signatures and non-admin signers must fail
+	if register(t, oracle, sim, outsider, 0, hash, sign(t, oracle, 0, hash, accounts[0], accounts[1])) != nil {
+		t.Fatalf("Accepted checkpoint from non-admin sender")
+	}
+	if register(t, oracle, sim, accounts[0], 0, common.Hash{}, sign(t, oracle, 0, common.Hash{}, accounts[0], accounts[1])) != nil {
+		t.Fatalf("Accepted empty checkpoint")
+	}
+	if register(t, oracle, sim, accounts[0], 0, hash, sign(t, oracle, 0, hash, accounts[0])) != nil {
+		t.Fatalf("Accepted checkpoint below threshold")
+	}
+	if register(t, oracle, sim, accounts[0], 0, hash, sign(t, oracle, 0, hash, accounts[1], accounts[0])) != nil {
+		t.Fatalf("Accepted unordered signatures")
+	}
+	if register(t, oracle, sim, accounts[0], 0, hash, sign(t, oracle, 0, hash, accounts[0], accounts[0])) != nil {
+		t.Fatalf("Accepted duplicate signatures")
+	}
+	if register(t, oracle, sim, accounts[0], 0, hash, sign(t, oracle, 0, hash, accounts[0], outsider)) != nil {
+		t.Fatalf("Accepted signature of non-admin")
+	}
+	if register(t, oracle, sim, accounts[0], 0, hash, sign(t, oracle, 1, hash, accounts[0], accounts[1])) != nil {
+		t.Fatalf("Accepted signatures for another section")
+	}
+	// Ordered admin signatures are enough to register the checkpoint, votes
+	// past the threshold are ignored
+	receipt := register(t, oracle, sim, accounts[2], 0, hash, sign(t, oracle, 0, hash, accounts[0], accounts[1], accounts[2]))
+	if receipt == nil {
+		t.Fatalf("Failed to register valid checkpoint")
+	}
+	index, stored, height, err := oracle.Contract().GetLatestCheckpoint(nil)
+	if err != nil {
+		t.Fatalf("Failed to retrieve latest checkpoint: %v", err)
+	}
+	head, _ := sim.HeaderByNumber(context.Background(), nil)
+	if index != 0 || stored != hash || height.Cmp(head.Number) != 0 {
+		t.Fatalf("Checkpoint mismatch: have (%d, %x, %v), want (%d, %x, %v)", index, stored, height, 0, hash, head.Number)
+	}
+	// The votes must be recoverable from the registration logs
+	sigs, err := oracle.LookupCheckpointVotes(receipt.Logs, 0, hash)
+	if err != nil {
+		t.Fatalf("Failed to look up votes: %v", err)
+	}
+	if len(sigs) != testThreshold {
+		t.Fatalf("Vote count mismatch: have %d, want %d", len(sigs), testThreshold)
+	}
+	for i, want := range []common.Address{accounts[0].addr, accounts[1].addr} {
+		pubkey, err := crypto.Ecrecover(SignHash(oracle.ContractAddr(), 0, hash), sigs[i])
+		if err != nil {
+			t.Fatalf("Failed to recover signer %d: %v", i, err)
+		}
+		var signer common.Address
+		copy(signer[:], crypto.Keccak256(pubkey[1:])[12:])
+		if signer != want {
+			t.Errorf("Signer %d mismatch: have %x, want %x", i, signer, want)
+		}
+	}
+	// The same section cannot be registered twice
+	if register(t, oracle, sim, accounts[0], 0, hash, sign(t, oracle, 0, hash, accounts[0], accounts[1])) != nil {
+		t.Fatalf("Accepted checkpoint for an already registered section")
+	}
+	// The next section is accepted once confirmed
+	next := common.HexToHash("0x04")
+	for i := 0; i < testSectionSize; i++ {
+		sim.Commit()
+	}
+	if register(t, oracle, sim, accounts[0], 1, next, sign(t, oracle, 1, next, accounts[1], accounts[2])) == nil {
+		t.Fatalf("Failed to register next section")
+	}
+	if index, stored, _, _ = oracle.Contract().GetLatestCheckpoint(nil); index != 1 || stored != next {
+		t.Fatalf("Checkpoint mismatch: have (%d, %x), want (%d, %x)", index, stored, 1, next)
+	}
+}
+
+// Tests that registrations are bound to the chain they were created on.
+func testCheckpointReplayProtection(t *testing.T, code []byte) {
+	accounts, oracle, sim := setupOracleTest(t, 3, code)
+	for i := 0; i < testSectionSize+testProcessConfirms; i++ {
+		sim.Commit()
+	}
+	hash := common.HexToHash("0x01")
+	sigs := sign(t, oracle, 0, hash, accounts[0], accounts[1])
+
+	head, _ := sim.HeaderByNumber(context.Background(), nil)
+	if registerAt(t, oracle, sim, accounts[0], 0, hash, sigs, head.Number, common.HexToHash("0xdead")) != nil {
+		t.Fatalf("Accepted checkpoint with foreign recent hash")
+	}
+	parent, _ := sim.HeaderByNumber(context.Background(), new(big.Int).Sub(head.Number, common.Big1))
+	if registerAt(t, oracle, sim, accounts[0], 0, hash, sigs, parent.Number, parent.Hash()) == nil {
+		t.Fatalf("Failed to register checkpoint with recent ancestor")
+	}
+}
+
+// Tests that signature batches with mismatching component counts are rejected.
+func testCheckpointMalformedVotes(t *testing.T, code []byte) {
+	accounts, oracle, sim := setupOracleTest(t, 3, code)
+	for i := 0; i < testSectionSize+testProcessConfirms; i++ {
+		sim.Commit()
+	}
+	hash := common.HexToHash("0x01")
+	sigs := sign(t, oracle, 0, hash, accounts[0], accounts[1])
+
+	var (
+		r [][32]byte
+		s [][32]byte
+		v []uint8
+	)
+	for _, sig := range sigs {
+		r = append(r, common.BytesToHash(sig[:32]))
+		s = append(s, common.BytesToHash(sig[32:64]))
+		v = append(v, sig[64])
+	}
+	head, _ := sim.HeaderByNumber(context.Background(), nil)
+	opts := bind.NewKeyedTransactor(accounts[0].key)
+	if _, err := oracle.Contract().SetCheckpoint(opts, head.Number, head.Hash(), hash, 0, v[:1], r, s); err == nil {
+		t.Fatalf("Accepted fewer v values than signatures")
+	}
+	if _, err := oracle.Contract().SetCheckpoint(opts, head.Number, head.Hash(), hash, 0, v, r, s[:1]); err == nil {
+		t.Fatalf("Accepted fewer s values than signatures")
+	}
+}
@@ -97,6 +97,7 @@ type BlockChain struct {
 	currentFastBlock *types.Block // Current head of the fast-sync chain (may be above the block chain!)
 
 	stateCache   state.Database // State database to reuse between imports (contains state cache)
+	missingState atomic.Value   // trie.MissingNodeHook retrieving absent state (e.g. during beam sync)
 	bodyCache    *lru.Cache     // Cache for the most recent block bodies
 	bodyRLPCache *lru.Cache     // Cache for the most recent block bodies in RLP encoded format
 	blockCache   *lru.Cache     // Cache for the most recent entire blocks
@@ -129,7 +130,6 @@ func NewBlockChain(chainDb wshdb.Database, config *params.ChainConfig, engine co
 	bc := &BlockChain{
 		config:       config,
 		chainDb:      chainDb,
-		stateCache:   state.NewDatabase(chainDb),
 		quit:         make(chan struct{}),
 		bodyCache:    bodyCache,
 		bodyRLPCache: bodyRLPCache,
@@ -139,6 +139,7 @@ func NewBlockChain(chainDb wshdb.Database, config *params.ChainConfig, engine co
 		vmConfig:     vmConfig,
 		badBlocks:    badBlocks,
 	}
+	bc.stateCache = state.NewDatabaseWithHook(chainDb, bc.fetchMissingState)
 	bc.SetValidator(NewBlockValidator(config, bc, engine))
 	bc.SetProcessor(NewStateProcessor(config, bc, engine))
 
@@ -304,6 +305,22 @@ func (bc *BlockChain) FastSyncCommitHead(hash common.Hash) error {
 	return nil
 }
 
+// SetMissingStateHook sets a hook to retrieve state trie nodes and contract code
+// absent from the database, e.g. from the network while beam syncing. Block
+// processing blocks until the hook delivers the missing data.
+func (bc *BlockChain) SetMissingStateHook(hook trie.MissingNodeHook) {
+	bc.missingState.Store(hook)
+}
+
+// fetchMissingState is the missing node hook of the state cache, forwarding
+// requests to the hook set via SetMissingStateHook, if any.
+func (bc *BlockChain) fetchMissingState(hash common.Hash) ([]byte, error) {
+	if hook, _ := bc.missingState.Load().(trie.MissingNodeHook); hook != nil {
+		return hook(hash)
+	}
+	return nil, fmt.Errorf("missing state %x", hash)
+}
+
 // GasLimit returns the gas limit of the current HEAD block.
 func (bc *BlockChain) GasLimit() *big.Int {
 	bc.mu.RLock()
@@ -782,6 +799,122 @@ func (bc *BlockChain) InsertReceiptChain(blockChain types.Blocks, receiptChain [
 	return 0, nil
 }
 
+// InsertCheckpoint starts an empty chain from a block vouched for by the user,
+// along with its receipts and total difficulty, without requiring any of its
+// ancestors. The block becomes the head of the header and fast sync chains, its
+// state is left for fast sync to retrieve.
+func (bc *BlockChain) InsertCheckpoint(block *types.Block, receipts types.Receipts, td *big.Int) error {
+	bc.chainmu.Lock()
+	defer bc.chainmu.Unlock()
+
+	bc.wg.Add(1)
+	defer bc.wg.Done()
+
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+
+	if number := bc.currentFastBlock.NumberU64(); number > 0 {
+		return fmt.Errorf("checkpoint on non-empty chain (fast head #%d)", number)
+	}
+	SetReceiptsData(bc.config, block, receipts)
+
+	batch := bc.chainDb.NewBatch()
+	if err := WriteBody(batch, block.Hash(), block.NumberU64(), block.Body()); err != nil {
+		return fmt.Errorf("failed to write block body: %v", err)
+	}
+	if err := WriteBlockReceipts(batch, block.Hash(), block.NumberU64(), receipts); err != nil {
+		return fmt.Errorf("failed to write block receipts: %v", err)
+	}
+	if err := WriteTxLookupEntries(batch, block); err != nil {
+		return fmt.Errorf("failed to write lookup metadata: %v", err)
+	}
+	if err := batch.Write(); err != nil {
+		return err
+	}
+	if err := bc.hc.WriteCheckpoint(block.Header(), td); err != nil {
+		return err
+	}
+	if err := WriteHeadFastBlockHash(bc.chainDb, block.Hash()); err != nil {
+		log.Crit("Failed to update head fast block hash", "err", err)
+	}
+	bc.currentFastBlock = block
+
+	log.Info("Inserted sync checkpoint", "number", block.Number(), "hash", block.Hash(), "td", td)
+	return nil
+}
+
+// InsertAncestors backfills a batch of blocks and receipts preceding the tail of
+// a chain started from a sync checkpoint, ordered from the tail towards genesis.
+func (bc *BlockChain) InsertAncestors(blockChain types.Blocks, receiptChain []types.Receipts) (int, error) {
+	bc.wg.Add(1)
+	defer bc.wg.Done()
+
+	if len(blockChain) == 0 {
+		return 0, nil
+	}
+	// Write the block contents first, so a tail header always has its body
+	var (
+		start = time.Now()
+		bytes = 0
+		batch = bc.chainDb.NewBatch()
+	)
+	for i, block := range blockChain {
+		receipts := receiptChain[i]
+		// Short circuit insertion if shutting down
+		if atomic.LoadInt32(&bc.procInterrupt) == 1 {
+			return 0, nil
+		}
+		SetReceiptsData(bc.config, block, receipts)
+		if err := WriteBody(batch, block.Hash(), block.NumberU64(), block.Body()); err != nil {
+			return i, fmt.Errorf("failed to write block body: %v", err)
+		}
+		if err := WriteBlockReceipts(batch, block.Hash(), block.NumberU64(), receipts); err != nil {
+			return i, fmt.Errorf("failed to write block receipts: %v", err)
+		}
+		if err := WriteTxLookupEntries(batch, block); err != nil {
+			return i, fmt.Errorf("failed to write lookup metadata: %v", err)
+		}
+		if batch.ValueSize() >= wshdb.IdealBatchSize {
+			if err := batch.Write(); err != nil {
+				return 0, err
+			}
+			bytes += batch.ValueSize()
+			batch = bc.chainDb.NewBatch()
+		}
+	}
+	if batch.ValueSize() > 0 {
+		bytes += batch.ValueSize()
+		if err := batch.Write(); err != nil {
+			return 0, err
+		}
+	}
+	// Link the headers up with the chain, moving its tail
+	headers := make([]*types.Header, len(blockChain))
+	for i, block := range blockChain {
+		headers[i] = block.Header()
+	}
+	bc.mu.Lock()
+	err := bc.hc.WriteAncestors(headers)
+	bc.mu.Unlock()
+	if err != nil {
+		return 0, err
+	}
+	last := blockChain[len(blockChain)-1]
+	log.Info("Backfilled checkpoint ancestors", "count", len(blockChain), "elapsed", common.PrettyDuration(time.Since(start)),
+		"bytes", bytes, "number", last.Number(), "hash", last.Hash())
+	return 0, nil
+}
+
+// ChainTail retrieves the oldest header of a chain started from a sync checkpoint,
+// whose ancestors are not yet backfilled. If the chain is linked up with the
+// genesis block, nil is returned.
+func (bc *BlockChain) ChainTail() *types.Header {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+
+	return bc.hc.Tail()
+}
+
 // WriteBlock writes the block to the chain.
 func (bc *BlockChain) WriteBlockAndState(block *types.Block, receipts []*types.Receipt, state *state.StateDB) (status WriteStatus, err error) {
 	bc.wg.Add(1)
@@ -1264,7 +1397,23 @@ func (bc *BlockChain) InsertHeaderChain(chain []*types.Header, checkFreq int) (i
 	if i, err := bc.hc.ValidateHeaderChain(chain, checkFreq); err != nil {
 		return i, err
 	}
+	return bc.insertHeaderChain(chain, start)
+}
+
+// InsertVerifiedHeaderChain inserts a batch of headers into the local chain
+// without running them through the consensus engine, as the caller already did
+// so (e.g. the downloader verifying batches in parallel with their retrieval).
+// The headers must still form a contiguous chain extending a local header.
+func (bc *BlockChain) InsertVerifiedHeaderChain(chain []*types.Header) (int, error) {
+	start := time.Now()
+	if err := bc.hc.ValidateHeaderLinks(chain); err != nil {
+		return 0, err
+	}
+	return bc.insertHeaderChain(chain, start)
+}
 
+// insertHeaderChain writes an already validated header chain into the database.
+func (bc *BlockChain) insertHeaderChain(chain []*types.Header, start time.Time) (int, error) {
 	// Make sure only one thread manipulates the chain at once
 	bc.chainmu.Lock()
 	defer bc.chainmu.Unlock()
@@ -1348,6 +1497,19 @@ func (bc *BlockChain) GetBlockHashesFromHash(hash common.Hash, max uint64) []com
 	return bc.hc.GetBlockHashesFromHash(hash, max)
 }
 
+// GetAncestor retrieves the Nth ancestor of a given block. It assumes that either
+// the given block or a close ancestor of it is canonical. maxNonCanonical points
+// to a downwards counter limiting the number of blocks to be individually checked
+// before reaching the canonical chain.
+//
+// Note: ancestor == 0 returns the same block, 1 returns its parent and so on.
+func (bc *BlockChain) GetAncestor(hash common.Hash, number, ancestor uint64, maxNonCanonical *uint64) (common.Hash, uint64) {
+	bc.chainmu.Lock()
+	defer bc.chainmu.Unlock()
+
+	return bc.hc.GetAncestor(hash, number, ancestor, maxNonCanonical)
+}
+
 // GetHeaderByNumber retrieves a block header from the database by number,
 // caching it (associated with its hash) if found.
 func (bc *BlockChain) GetHeaderByNumber(number uint64) *types.Header {
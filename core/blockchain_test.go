@@ -337,6 +337,82 @@ func testBrokenChain(t *testing.T, full bool) {
 	}
 }
 
+// Tests that batches verified out of band are still only accepted if they are
+// contiguous and extend a known header.
+func TestBrokenVerifiedHeaderChain(t *testing.T) {
+	db, blockchain, err := newCanonical(10, false)
+	if err != nil {
+		t.Fatalf("failed to make new canonical chain: %v", err)
+	}
+	defer blockchain.Stop()
+
+	head := blockchain.CurrentHeader()
+	chain := makeHeaderChain(head, 5, db, forkSeed)
+
+	// A batch missing its first link must be rejected
+	if _, err := blockchain.InsertVerifiedHeaderChain(chain[1:]); err == nil {
+		t.Errorf("batch with unknown parent not reported")
+	}
+	// A batch containing headers of a different chain must be rejected
+	other := makeHeaderChain(head, 5, db, forkSeed+1)
+	mixed := append([]*types.Header{chain[0], chain[1]}, other[2:]...)
+	if _, err := blockchain.InsertVerifiedHeaderChain(mixed); err == nil {
+		t.Errorf("non contiguous batch not reported")
+	}
+	if current := blockchain.CurrentHeader(); current.Hash() != head.Hash() {
+		t.Errorf("head changed by rejected batches: have #%d [%x…], want #%d [%x…]", current.Number, current.Hash().Bytes()[:4], head.Number, head.Hash().Bytes()[:4])
+	}
+	// The intact batch is accepted
+	if _, err := blockchain.InsertVerifiedHeaderChain(chain); err != nil {
+		t.Fatalf("failed to insert contiguous batch: %v", err)
+	}
+	if current := blockchain.CurrentHeader(); current.Hash() != chain[len(chain)-1].Hash() {
+		t.Errorf("head mismatch: have #%d, want #%d", current.Number, chain[len(chain)-1].Number)
+	}
+}
+
+// Tests that ancestors are resolved on both the canonical chain and side chains,
+// and that side chain walks are bounded.
+func TestGetAncestor(t *testing.T) {
+	db, blockchain, err := newCanonical(10, false)
+	if err != nil {
+		t.Fatalf("failed to make new canonical chain: %v", err)
+	}
+	defer blockchain.Stop()
+
+	head := blockchain.CurrentHeader()
+	for _, ancestor := range []uint64{0, 1, 2, 10, 11} {
+		limit := uint64(0)
+		hash, number := blockchain.GetAncestor(head.Hash(), head.Number.Uint64(), ancestor, &limit)
+		if ancestor > head.Number.Uint64() {
+			if hash != (common.Hash{}) {
+				t.Errorf("ancestor %d beyond genesis resolved to %x", ancestor, hash)
+			}
+			continue
+		}
+		want := blockchain.GetHeaderByNumber(head.Number.Uint64() - ancestor)
+		if hash != want.Hash() || number != want.Number.Uint64() {
+			t.Errorf("ancestor %d mismatch: have #%d [%x…], want #%d [%x…]", ancestor, number, hash[:4], want.Number, want.Hash().Bytes()[:4])
+		}
+	}
+	// Resolve ancestors from the tip of a side chain forking off at #5
+	fork := makeHeaderChain(blockchain.GetHeaderByNumber(5), 3, db, forkSeed)
+	if _, err := blockchain.InsertHeaderChain(fork, 1); err != nil {
+		t.Fatalf("failed to insert side chain: %v", err)
+	}
+	tip := fork[len(fork)-1]
+
+	limit := uint64(2)
+	if hash, _ := blockchain.GetAncestor(tip.Hash(), tip.Number.Uint64(), 5, &limit); hash != (common.Hash{}) {
+		t.Errorf("side chain walk not bounded, resolved to %x", hash)
+	}
+	limit = 3
+	hash, number := blockchain.GetAncestor(tip.Hash(), tip.Number.Uint64(), 5, &limit)
+	if want := blockchain.GetHeaderByNumber(3); hash != want.Hash() || number != 3 {
+		t.Errorf("side chain ancestor mismatch: have #%d [%x…], want #3 [%x…]", number, hash[:4], want.Hash().Bytes()[:4])
+	}
+}
+
 type bproc struct{}
 
 func (bproc) ValidateBody(*types.Block) error { return nil }
@@ -741,6 +817,175 @@ func TestLightVsFastVsFullChainHeads(t *testing.T) {
 	assert(t, "light", light, height/2, 0, 0)
 }
 
+// Tests that a chain started from a sync checkpoint can be extended above it and
+// backfilled below it, ending up identical to a chain imported from genesis.
+func TestCheckpointChainBackfill(t *testing.T) {
+	// Configure and generate a sample block chain
+	var (
+		gendb, _ = wshdb.NewMemDatabase()
+		key, _   = crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+		address  = crypto.PubkeyToAddress(key.PublicKey)
+		funds    = big.NewInt(1000000000)
+		gspec    = &Genesis{Config: params.TestChainConfig, Alloc: GenesisAlloc{address: {Balance: funds}}}
+		genesis  = gspec.MustCommit(gendb)
+		signer   = types.NewEIP155Signer(gspec.Config.ChainId)
+	)
+	blocks, receipts := GenerateChain(gspec.Config, genesis, gendb, 512, func(i int, block *BlockGen) {
+		if i%3 == 2 {
+			tx, err := types.SignTx(types.NewTransaction(block.TxNonce(address), common.Address{0x00}, big.NewInt(1000), bigTxGas, nil, nil), signer, key)
+			if err != nil {
+				panic(err)
+			}
+			block.AddTx(tx)
+		}
+	})
+	// Import the chain as an archive node for the comparison baseline
+	archiveDb, _ := wshdb.NewMemDatabase()
+	gspec.MustCommit(archiveDb)
+	archive, _ := NewBlockChain(archiveDb, gspec.Config, wshash.NewFaker(), vm.Config{})
+	defer archive.Stop()
+
+	if n, err := archive.InsertChain(blocks); err != nil {
+		t.Fatalf("failed to process block %d: %v", n, err)
+	}
+	// Start a new chain from a checkpoint in the middle and extend it to the head
+	db, _ := wshdb.NewMemDatabase()
+	gspec.MustCommit(db)
+	chain, _ := NewBlockChain(db, gspec.Config, wshash.NewFaker(), vm.Config{})
+	defer chain.Stop()
+
+	cp := 300
+	if err := chain.InsertCheckpoint(blocks[cp], receipts[cp], archive.GetTdByHash(blocks[cp].Hash())); err != nil {
+		t.Fatalf("failed to insert checkpoint: %v", err)
+	}
+	if tail := chain.ChainTail(); tail == nil || tail.Hash() != blocks[cp].Hash() {
+		t.Fatalf("chain tail mismatch: have %v, want #%d", tail, blocks[cp].Number())
+	}
+	if head := chain.CurrentFastBlock(); head.Hash() != blocks[cp].Hash() {
+		t.Fatalf("fast head mismatch: have #%d, want #%d", head.Number(), blocks[cp].Number())
+	}
+	if err := chain.InsertCheckpoint(blocks[cp+1], receipts[cp+1], archive.GetTdByHash(blocks[cp+1].Hash())); err == nil {
+		t.Fatalf("checkpoint accepted on non-empty chain")
+	}
+	headers := make([]*types.Header, 0, len(blocks)-cp-1)
+	for _, block := range blocks[cp+1:] {
+		headers = append(headers, block.Header())
+	}
+	if n, err := chain.InsertHeaderChain(headers, 1); err != nil {
+		t.Fatalf("failed to insert header %d: %v", n, err)
+	}
+	if n, err := chain.InsertReceiptChain(blocks[cp+1:], receipts[cp+1:]); err != nil {
+		t.Fatalf("failed to insert receipt %d: %v", n, err)
+	}
+	// Backfill the ancestors in batches, rejecting any not linking up to the tail
+	if _, err := chain.InsertAncestors(types.Blocks{blocks[cp-2]}, []types.Receipts{receipts[cp-2]}); err == nil {
+		t.Fatalf("non contiguous ancestor accepted")
+	}
+	for i := cp - 1; i >= 0; i -= 64 {
+		var (
+			batch    types.Blocks
+			batchRcs []types.Receipts
+		)
+		for j := i; j >= 0 && j > i-64; j-- {
+			batch = append(batch, blocks[j])
+			batchRcs = append(batchRcs, receipts[j])
+		}
+		if chain.ChainTail() == nil {
+			t.Fatalf("chain tail dropped before reaching genesis (batch from #%d)", blocks[i].Number())
+		}
+		if n, err := chain.InsertAncestors(batch, batchRcs); err != nil {
+			t.Fatalf("failed to insert ancestor %d: %v", n, err)
+		}
+	}
+	if tail := chain.ChainTail(); tail != nil {
+		t.Fatalf("chain tail remained after backfill: #%d", tail.Number)
+	}
+	if tail := GetChainTailHash(db); tail != (common.Hash{}) {
+		t.Fatalf("chain tail marker remained after backfill: %x", tail)
+	}
+	// Iterate over all chain data components, and cross reference
+	for i := 0; i < len(blocks); i++ {
+		num, hash := blocks[i].NumberU64(), blocks[i].Hash()
+
+		if ctd, atd := chain.GetTdByHash(hash), archive.GetTdByHash(hash); ctd == nil || ctd.Cmp(atd) != 0 {
+			t.Errorf("block #%d [%x]: td mismatch: have %v, want %v", num, hash, ctd, atd)
+		}
+		if cblock := chain.GetBlockByHash(hash); cblock == nil || cblock.Hash() != hash {
+			t.Errorf("block #%d [%x]: block missing", num, hash)
+		} else if types.DeriveSha(cblock.Transactions()) != blocks[i].TxHash() {
+			t.Errorf("block #%d [%x]: transactions mismatch", num, hash)
+		}
+		if creceipts := GetBlockReceipts(db, hash, num); types.DeriveSha(creceipts) != blocks[i].ReceiptHash() {
+			t.Errorf("block #%d [%x]: receipts mismatch", num, hash)
+		}
+		if chash := GetCanonicalHash(db, num); chash != hash {
+			t.Errorf("block #%d: canonical hash mismatch: have %x, want %x", num, chash, hash)
+		}
+	}
+}
+
+// Tests that a wrong checkpoint total difficulty is detected once the chain is
+// backfilled to the genesis block, and the total difficulties get recalculated.
+func TestCheckpointChainTdReset(t *testing.T) {
+	var (
+		gendb, _ = wshdb.NewMemDatabase()
+		gspec    = &Genesis{Config: params.TestChainConfig}
+		genesis  = gspec.MustCommit(gendb)
+	)
+	blocks, receipts := GenerateChain(gspec.Config, genesis, gendb, 128, nil)
+
+	archiveDb, _ := wshdb.NewMemDatabase()
+	gspec.MustCommit(archiveDb)
+	archive, _ := NewBlockChain(archiveDb, gspec.Config, wshash.NewFaker(), vm.Config{})
+	defer archive.Stop()
+
+	if n, err := archive.InsertChain(blocks); err != nil {
+		t.Fatalf("failed to process block %d: %v", n, err)
+	}
+	// Start a chain from a checkpoint with an inflated total difficulty
+	db, _ := wshdb.NewMemDatabase()
+	gspec.MustCommit(db)
+	chain, _ := NewBlockChain(db, gspec.Config, wshash.NewFaker(), vm.Config{})
+	defer chain.Stop()
+
+	cp := 64
+	inflated := new(big.Int).Add(archive.GetTdByHash(blocks[cp].Hash()), big.NewInt(1000000))
+	if err := chain.InsertCheckpoint(blocks[cp], receipts[cp], inflated); err != nil {
+		t.Fatalf("failed to insert checkpoint: %v", err)
+	}
+	headers := make([]*types.Header, 0, len(blocks)-cp-1)
+	for _, block := range blocks[cp+1:] {
+		headers = append(headers, block.Header())
+	}
+	if n, err := chain.InsertHeaderChain(headers, 1); err != nil {
+		t.Fatalf("failed to insert header %d: %v", n, err)
+	}
+	head := blocks[len(blocks)-1]
+	if td := chain.GetTdByHash(head.Hash()); td.Cmp(archive.GetTdByHash(head.Hash())) <= 0 {
+		t.Fatalf("head td not inflated: have %v", td)
+	}
+	// Backfill all ancestors and ensure the total difficulties are corrected
+	var (
+		batch    types.Blocks
+		batchRcs []types.Receipts
+	)
+	for i := cp - 1; i >= 0; i-- {
+		batch = append(batch, blocks[i])
+		batchRcs = append(batchRcs, receipts[i])
+	}
+	if n, err := chain.InsertAncestors(batch, batchRcs); err != nil {
+		t.Fatalf("failed to insert ancestor %d: %v", n, err)
+	}
+	if tail := chain.ChainTail(); tail != nil {
+		t.Fatalf("chain tail remained after backfill: #%d", tail.Number)
+	}
+	for _, block := range blocks {
+		if ctd, atd := chain.GetTdByHash(block.Hash()), archive.GetTdByHash(block.Hash()); ctd == nil || ctd.Cmp(atd) != 0 {
+			t.Errorf("block #%d: td mismatch: have %v, want %v", block.NumberU64(), ctd, atd)
+		}
+	}
+}
+
 // Tests that chain reorganisations handle transaction removals and reinsertions.
 func TestChainTxReorgs(t *testing.T) {
 	var (
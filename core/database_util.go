@@ -47,6 +47,8 @@ var (
 	headHeaderKey = []byte("LastHeader")
 	headBlockKey  = []byte("LastBlock")
 	headFastKey   = []byte("LastFast")
+	chainTailKey  = []byte("ChainTail")
+	beamPivotKey  = []byte("BeamPivot")
 
 	// Data item prefixes (use single byte to avoid mixing data types, avoid `i`).
 	headerPrefix        = []byte("h") // headerPrefix + num (uint64 big endian) + hash -> header
@@ -146,6 +148,27 @@ func GetHeadFastBlockHash(db DatabaseReader) common.Hash {
 	return common.BytesToHash(data)
 }
 
+// GetChainTailHash retrieves the hash of the oldest header of a chain started
+// from a sync checkpoint, as long as its ancestors are not yet backfilled. If the
+// chain is linked up with the genesis block, the zero hash is returned.
+func GetChainTailHash(db DatabaseReader) common.Hash {
+	data, _ := db.Get(chainTailKey)
+	if len(data) == 0 {
+		return common.Hash{}
+	}
+	return common.BytesToHash(data)
+}
+
+// GetBeamPivotRoot retrieves the state root of the beam sync pivot block, as long
+// as its state is not yet fully downloaded. Otherwise the zero hash is returned.
+func GetBeamPivotRoot(db DatabaseReader) common.Hash {
+	data, _ := db.Get(beamPivotKey)
+	if len(data) == 0 {
+		return common.Hash{}
+	}
+	return common.BytesToHash(data)
+}
+
 // GetHeaderRLP retrieves a block header in its raw RLP database encoding, or nil
 // if the header's not found.
 func GetHeaderRLP(db DatabaseReader, hash common.Hash, number uint64) rlp.RawValue {
@@ -374,6 +397,22 @@ func WriteHeadFastBlockHash(db wshdb.Putter, hash common.Hash) error {
 	return nil
 }
 
+// WriteChainTailHash stores the hash of the oldest header of a checkpoint chain.
+func WriteChainTailHash(db wshdb.Putter, hash common.Hash) error {
+	if err := db.Put(chainTailKey, hash.Bytes()); err != nil {
+		log.Crit("Failed to store chain tail's hash", "err", err)
+	}
+	return nil
+}
+
+// WriteBeamPivotRoot stores the state root of the beam sync pivot block.
+func WriteBeamPivotRoot(db wshdb.Putter, root common.Hash) error {
+	if err := db.Put(beamPivotKey, root.Bytes()); err != nil {
+		log.Crit("Failed to store beam sync pivot root", "err", err)
+	}
+	return nil
+}
+
 // WriteHeader serializes a block header into the database.
 func WriteHeader(db wshdb.Putter, header *types.Header) error {
 	data, err := rlp.EncodeToBytes(header)
@@ -498,6 +537,18 @@ func DeleteCanonicalHash(db DatabaseDeleter, number uint64) {
 	db.Delete(append(append(headerPrefix, encodeBlockNumber(number)...), numSuffix...))
 }
 
+// DeleteChainTailHash removes the chain tail marker once the chain is linked up
+// with the genesis block.
+func DeleteChainTailHash(db DatabaseDeleter) {
+	db.Delete(chainTailKey)
+}
+
+// DeleteBeamPivotRoot removes the beam sync pivot marker once its state is fully
+// downloaded.
+func DeleteBeamPivotRoot(db DatabaseDeleter) {
+	db.Delete(beamPivotKey)
+}
+
 // DeleteHeader removes all block header data associated with a hash.
 func DeleteHeader(db DatabaseDeleter, hash common.Hash, number uint64) {
 	db.Delete(append(blockHashPrefix, hash.Bytes()...))
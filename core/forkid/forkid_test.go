@@ -0,0 +1,189 @@
+// Copyright 2018 The go-wiseplat Authors
+// This file is part of the go-wiseplat library.
+//
+// The go-wiseplat library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-wiseplat library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-wiseplat library. If not, see <http://www.gnu.org/licenses/>.
+
+package forkid
+
+import (
+	"bytes"
+	"math"
+	"testing"
+
+	"github.com/wiseplat/go-wiseplat/common"
+	"github.com/wiseplat/go-wiseplat/params"
+	"github.com/wiseplat/go-wiseplat/rlp"
+)
+
+// Tests that fork IDs are properly calculated at various chain heads.
+func TestCreation(t *testing.T) {
+	type testcase struct {
+		head uint64
+		want ID
+	}
+	tests := []struct {
+		config  *params.ChainConfig
+		genesis common.Hash
+		cases   []testcase
+	}{
+		// Mainnet test cases
+		{
+			params.MainnetChainConfig,
+			params.MainnetGenesisHash,
+			[]testcase{
+				{0, ID{Hash: checksumToBytes(0xae834c43), Next: 1}}, // Unsynced
+				{1, ID{Hash: checksumToBytes(0x61af727d), Next: 2}}, // Homestead and DAO block
+				{2, ID{Hash: checksumToBytes(0x8b9606c0), Next: 3}}, // EIP150 block
+				{3, ID{Hash: checksumToBytes(0xe8548803), Next: 4}}, // EIP155 block
+				{4, ID{Hash: checksumToBytes(0xd8827ef9), Next: 5}}, // EIP158 block
+				{5, ID{Hash: checksumToBytes(0xa3c60eba), Next: 0}}, // First Byzantium block
+				{1000, ID{Hash: checksumToBytes(0xa3c60eba), Next: 0}},
+			},
+		},
+		// Testnet test cases
+		{
+			params.TestnetChainConfig,
+			params.TestnetGenesisHash,
+			[]testcase{
+				{0, ID{Hash: checksumToBytes(0xbe317c11), Next: 10}},  // Unsynced, Homestead and EIP150 at genesis
+				{9, ID{Hash: checksumToBytes(0xbe317c11), Next: 10}},  // Last pre-EIP155 block
+				{10, ID{Hash: checksumToBytes(0x7effdfe0), Next: 15}}, // First EIP155 and EIP158 block
+				{14, ID{Hash: checksumToBytes(0x7effdfe0), Next: 15}}, // Last pre-Byzantium block
+				{15, ID{Hash: checksumToBytes(0x89e06157), Next: 0}},  // First Byzantium block
+				{1000, ID{Hash: checksumToBytes(0x89e06157), Next: 0}},
+			},
+		},
+	}
+	for i, tt := range tests {
+		for j, ttt := range tt.cases {
+			if have := newID(tt.config, tt.genesis, ttt.head); have != ttt.want {
+				t.Errorf("test %d, case %d: fork ID mismatch: have %x, want %x", i, j, have, ttt.want)
+			}
+		}
+	}
+}
+
+// Tests that fork IDs get validated against the local chain state as expected.
+func TestValidation(t *testing.T) {
+	tests := []struct {
+		head uint64
+		id   ID
+		err  error
+	}{
+		// Local is unsynced, remote announces the same. No future fork is announced
+		// beyond the locally known ones, connect.
+		{0, ID{Hash: checksumToBytes(0xae834c43), Next: 1}, nil},
+
+		// Local is mainnet EIP150, remote announces the same. No future fork is
+		// announced, connect.
+		{2, ID{Hash: checksumToBytes(0x8b9606c0), Next: 3}, nil},
+
+		// Local is mainnet EIP150, remote announces the same, but isn't aware of any
+		// future forks (not updated yet). Connect, it might update before the fork.
+		{2, ID{Hash: checksumToBytes(0x8b9606c0), Next: 0}, nil},
+
+		// Local is mainnet EIP150, remote announces the same, also announcing a
+		// later fork than ours. Remote is stale, but that's only known once the fork
+		// passes, connect.
+		{2, ID{Hash: checksumToBytes(0x8b9606c0), Next: math.MaxUint64}, nil},
+
+		// Local is mainnet Byzantium, remote announces the same and a fork at block
+		// 100 that we passed without knowing about it. Incompatible.
+		{1000, ID{Hash: checksumToBytes(0xa3c60eba), Next: 100}, ErrLocalIncompatibleOrStale},
+
+		// Local is mainnet Byzantium, remote announces Homestead + DAO and knows
+		// about EIP150. Remote is simply syncing, connect.
+		{1000, ID{Hash: checksumToBytes(0x61af727d), Next: 2}, nil},
+
+		// Local is mainnet Byzantium, remote announces the genesis ruleset and knows
+		// of the first fork. Remote is syncing, connect.
+		{1000, ID{Hash: checksumToBytes(0xae834c43), Next: 1}, nil},
+
+		// Local is mainnet EIP158, remote announces EIP150 but is not aware of any
+		// further forks. Remote needs a software update.
+		{4, ID{Hash: checksumToBytes(0x8b9606c0), Next: 0}, ErrRemoteStale},
+
+		// Local is mainnet EIP158, remote announces EIP150 with a next fork that
+		// differs from ours. Remote needs a software update.
+		{4, ID{Hash: checksumToBytes(0x8b9606c0), Next: 10}, ErrRemoteStale},
+
+		// Local is mainnet EIP150, remote announces Byzantium. Local is out of
+		// sync, connect.
+		{2, ID{Hash: checksumToBytes(0xa3c60eba), Next: 0}, nil},
+
+		// Local is unsynced, remote announces EIP158. Local is out of sync, connect.
+		{0, ID{Hash: checksumToBytes(0xd8827ef9), Next: 5}, nil},
+
+		// Local is mainnet Byzantium, remote announces a checksum unknown to us,
+		// e.g. a different genesis or a non-mainnet fork. Incompatible.
+		{1000, ID{Hash: checksumToBytes(0x89e06157), Next: 0}, ErrLocalIncompatibleOrStale},
+
+		// Local is unsynced, remote announces a checksum unknown to us. Incompatible.
+		{0, ID{Hash: checksumToBytes(0xafec6b27), Next: 0}, ErrLocalIncompatibleOrStale},
+	}
+	for i, tt := range tests {
+		filter := newFilter(params.MainnetChainConfig, params.MainnetGenesisHash, func() uint64 { return tt.head })
+		if err := filter(tt.id); err != tt.err {
+			t.Errorf("test %d: validation error mismatch: have %v, want %v", i, err, tt.err)
+		}
+	}
+}
+
+// Tests that fork IDs are correctly RLP encoded.
+func TestEncoding(t *testing.T) {
+	tests := []struct {
+		id   ID
+		want []byte
+	}{
+		{ID{Hash: checksumToBytes(0), Next: 0}, common.Hex2Bytes("c6840000000080")},
+		{ID{Hash: checksumToBytes(0xdeadbeef), Next: 0xBADDCAFE}, common.Hex2Bytes("ca84deadbeef84baddcafe")},
+		{ID{Hash: checksumToBytes(math.MaxUint32), Next: math.MaxUint64}, common.Hex2Bytes("ce84ffffffff88ffffffffffffffff")},
+	}
+	for i, tt := range tests {
+		have, err := rlp.EncodeToBytes(tt.id)
+		if err != nil {
+			t.Errorf("test %d: failed to encode forkid: %v", i, err)
+			continue
+		}
+		if !bytes.Equal(have, tt.want) {
+			t.Errorf("test %d: RLP mismatch: have %x, want %x", i, have, tt.want)
+		}
+	}
+}
+
+// Tests that the fork list is gathered sorted and deduplicated, skipping the
+// forks already active at genesis.
+func TestGatherForks(t *testing.T) {
+	tests := []struct {
+		config *params.ChainConfig
+		want   []uint64
+	}{
+		{params.MainnetChainConfig, []uint64{1, 2, 3, 4, 5}},
+		{params.TestnetChainConfig, []uint64{10, 15}},
+		{params.AllWshashProtocolChanges, nil},
+	}
+	for i, tt := range tests {
+		have := gatherForks(tt.config)
+		if len(have) != len(tt.want) {
+			t.Errorf("test %d: fork list mismatch: have %v, want %v", i, have, tt.want)
+			continue
+		}
+		for j := range have {
+			if have[j] != tt.want[j] {
+				t.Errorf("test %d: fork list mismatch: have %v, want %v", i, have, tt.want)
+				break
+			}
+		}
+	}
+}
@@ -53,6 +53,7 @@ type HeaderChain struct {
 
 	currentHeader     *types.Header // Current head of the header chain (may be above the block chain!)
 	currentHeaderHash common.Hash   // Hash of the current head of the header chain (prevent recomputing all the time)
+	tailHeader        *types.Header // Oldest header of a chain started from a sync checkpoint (nil if linked to genesis)
 
 	headerCache *lru.Cache // Cache for the most recent block headers
 	tdCache     *lru.Cache // Cache for the most recent block total difficulties
@@ -103,6 +104,9 @@ func NewHeaderChain(chainDb wshdb.Database, config *params.ChainConfig, engine c
 	}
 	hc.currentHeaderHash = hc.currentHeader.Hash()
 
+	if tail := GetChainTailHash(chainDb); tail != (common.Hash{}) {
+		hc.tailHeader = hc.GetHeaderByHash(tail)
+	}
 	return hc, nil
 }
 
@@ -194,6 +198,193 @@ func (hc *HeaderChain) WriteHeader(header *types.Header) (status WriteStatus, er
 	return
 }
 
+// WriteTrustedHeader writes a header vouched for by trusted parties as the new
+// head of the canonical chain, together with its announced total difficulty.
+// The header's ancestors are not required to be present: canonical number
+// assignments are only fixed up as far back as the local chain is linked.
+//
+// Note: This method is intended for ultra light clients, which accept headers
+// based on signed announcements instead of validating the header chain.
+func (hc *HeaderChain) WriteTrustedHeader(header *types.Header, td *big.Int) error {
+	var (
+		hash   = header.Hash()
+		number = header.Number.Uint64()
+	)
+	if err := hc.WriteTd(hash, number, td); err != nil {
+		log.Crit("Failed to write header total difficulty", "err", err)
+	}
+	if err := WriteHeader(hc.chainDb, header); err != nil {
+		log.Crit("Failed to write header content", "err", err)
+	}
+	// Delete any canonical number assignments above the new head
+	for i := number + 1; ; i++ {
+		hash := GetCanonicalHash(hc.chainDb, i)
+		if hash == (common.Hash{}) {
+			break
+		}
+		DeleteCanonicalHash(hc.chainDb, i)
+	}
+	// Overwrite any stale canonical number assignments of known ancestors
+	var (
+		headHash   = header.ParentHash
+		headNumber = number - 1
+		headHeader = hc.GetHeader(headHash, headNumber)
+	)
+	for number > 0 && headHeader != nil && GetCanonicalHash(hc.chainDb, headNumber) != headHash {
+		WriteCanonicalHash(hc.chainDb, headHash, headNumber)
+		if headNumber == 0 {
+			break
+		}
+		headHash = headHeader.ParentHash
+		headNumber = headHeader.Number.Uint64() - 1
+		headHeader = hc.GetHeader(headHash, headNumber)
+	}
+	// Set the new header as the head of the canonical chain
+	if err := WriteCanonicalHash(hc.chainDb, hash, number); err != nil {
+		log.Crit("Failed to insert header number", "err", err)
+	}
+	if err := WriteHeadHeaderHash(hc.chainDb, hash); err != nil {
+		log.Crit("Failed to insert head header hash", "err", err)
+	}
+	hc.currentHeaderHash, hc.currentHeader = hash, types.CopyHeader(header)
+
+	hc.headerCache.Add(hash, header)
+	hc.numberCache.Add(hash, number)
+	return nil
+}
+
+// WriteCheckpoint writes a header vouched for by the user as the new head of an
+// empty canonical chain, together with its total difficulty. Its ancestors are
+// not required to be present: until they are backfilled, the header is tracked
+// as the tail of the chain, the oldest header descendants can be linked to.
+func (hc *HeaderChain) WriteCheckpoint(header *types.Header, td *big.Int) error {
+	if err := hc.WriteTrustedHeader(header, td); err != nil {
+		return err
+	}
+	if number := header.Number.Uint64(); number > 0 && !hc.HasHeader(header.ParentHash, number-1) {
+		if err := WriteChainTailHash(hc.chainDb, header.Hash()); err != nil {
+			log.Crit("Failed to store chain tail hash", "err", err)
+		}
+		hc.tailHeader = types.CopyHeader(header)
+	}
+	return nil
+}
+
+// WriteAncestors backfills a batch of headers preceding the tail of a chain
+// started from a sync checkpoint, ordered from the tail towards the genesis.
+// The headers are authenticated by their hashes linking up to the tail, so no
+// consensus verification is done. Their total difficulties are derived from
+// the tail's backwards. Once the genesis block is reached, the chain is linked
+// up and no longer has a tail.
+func (hc *HeaderChain) WriteAncestors(headers []*types.Header) error {
+	if hc.tailHeader == nil {
+		return errors.New("chain has no tail to backfill")
+	}
+	if len(headers) == 0 {
+		return nil
+	}
+	// Make sure the headers link up with the tail, each other and the genesis
+	child := hc.tailHeader
+	for i, header := range headers {
+		if header.Number.Uint64()+1 != child.Number.Uint64() || header.Hash() != child.ParentHash || header.Number.Sign() == 0 {
+			return fmt.Errorf("non contiguous ancestor insert: item %d is #%d [%x…], expected #%d [%x…]", i, header.Number,
+				header.Hash().Bytes()[:4], child.Number.Uint64()-1, child.ParentHash.Bytes()[:4])
+		}
+		if header.Number.Uint64() == 1 && header.ParentHash != hc.genesisHeader.Hash() {
+			return fmt.Errorf("ancestors link to unknown genesis [%x…]", header.ParentHash.Bytes()[:4])
+		}
+		child = header
+	}
+	// Write the headers along with their total difficulties and canonical numbers
+	td := hc.GetTd(hc.tailHeader.Hash(), hc.tailHeader.Number.Uint64())
+	if td == nil {
+		return fmt.Errorf("unknown total difficulty of chain tail #%d [%x…]", hc.tailHeader.Number, hc.tailHeader.Hash().Bytes()[:4])
+	}
+	child = hc.tailHeader
+	for _, header := range headers {
+		var (
+			hash   = header.Hash()
+			number = header.Number.Uint64()
+		)
+		td = new(big.Int).Sub(td, child.Difficulty)
+		if err := hc.WriteTd(hash, number, td); err != nil {
+			log.Crit("Failed to write header total difficulty", "err", err)
+		}
+		if err := WriteHeader(hc.chainDb, header); err != nil {
+			log.Crit("Failed to write header content", "err", err)
+		}
+		if err := WriteCanonicalHash(hc.chainDb, hash, number); err != nil {
+			log.Crit("Failed to insert header number", "err", err)
+		}
+		hc.headerCache.Add(hash, header)
+		hc.numberCache.Add(hash, number)
+
+		child = header
+	}
+	// Move the tail down, or drop it if the chain reached the genesis block
+	if child.Number.Uint64() > 1 {
+		if err := WriteChainTailHash(hc.chainDb, child.Hash()); err != nil {
+			log.Crit("Failed to store chain tail hash", "err", err)
+		}
+		hc.tailHeader = types.CopyHeader(child)
+		return nil
+	}
+	// The checkpoint's total difficulty may have been reported by the network. If
+	// it's inconsistent with the genesis block, recalculate the whole chain's
+	genesisTd := hc.GetTd(hc.genesisHeader.Hash(), 0)
+	if td = new(big.Int).Sub(td, child.Difficulty); td.Cmp(genesisTd) != 0 {
+		log.Error("Checkpoint total difficulty mismatch, resetting", "genesis", genesisTd, "derived", td)
+		if err := hc.resetTds(genesisTd); err != nil {
+			return err
+		}
+	}
+	DeleteChainTailHash(hc.chainDb)
+	hc.tailHeader = nil
+
+	log.Info("Linked checkpoint chain to genesis")
+	return nil
+}
+
+// resetTds recalculates the total difficulties of the canonical chain from the
+// genesis block up to the current head, discarding the ones derived from an
+// untrusted checkpoint total difficulty.
+func (hc *HeaderChain) resetTds(genesisTd *big.Int) error {
+	var (
+		batch = hc.chainDb.NewBatch()
+		td    = new(big.Int).Set(genesisTd)
+		head  = hc.currentHeader.Number.Uint64()
+	)
+	for number := uint64(1); number <= head; number++ {
+		hash := GetCanonicalHash(hc.chainDb, number)
+		header := hc.GetHeader(hash, number)
+		if header == nil {
+			return fmt.Errorf("missing canonical header #%d [%x…]", number, hash.Bytes()[:4])
+		}
+		td.Add(td, header.Difficulty)
+		if err := WriteTd(batch, hash, number, td); err != nil {
+			return err
+		}
+		if batch.ValueSize() >= wshdb.IdealBatchSize {
+			if err := batch.Write(); err != nil {
+				return err
+			}
+			batch = hc.chainDb.NewBatch()
+		}
+	}
+	if err := batch.Write(); err != nil {
+		return err
+	}
+	hc.tdCache.Purge()
+	return nil
+}
+
+// Tail retrieves the oldest header of a chain started from a sync checkpoint,
+// whose ancestors are not yet backfilled. If the chain is linked up with the
+// genesis block, nil is returned.
+func (hc *HeaderChain) Tail() *types.Header {
+	return hc.tailHeader
+}
+
 // WhCallback is a callback function for inserting individual headers.
 // A callback is used for two reasons: first, in a LightChain, status should be
 // processed and light chain events sent, while in a BlockChain this is not
@@ -201,18 +392,41 @@ func (hc *HeaderChain) WriteHeader(header *types.Header) (status WriteStatus, er
 // header writes should be protected by the parent chain mutex individually.
 type WhCallback func(*types.Header) error
 
-func (hc *HeaderChain) ValidateHeaderChain(chain []*types.Header, checkFreq int) (int, error) {
-	// Do a sanity check that the provided chain is actually ordered and linked
+// ValidateHeaderLinks checks that the given headers form a contiguous chain
+// extending a header already present in the local chain. It is meant for
+// header batches verified by the consensus engine out of band, before they are
+// written into the database.
+func (hc *HeaderChain) ValidateHeaderLinks(chain []*types.Header) error {
+	if len(chain) == 0 {
+		return nil
+	}
+	if number := chain[0].Number.Uint64(); number == 0 || !hc.HasHeader(chain[0].ParentHash, number-1) {
+		return consensus.ErrUnknownAncestor
+	}
+	return validateHeaderLinks(chain)
+}
+
+// validateHeaderLinks checks that the given headers are ordered and each one
+// is the parent of the next.
+func validateHeaderLinks(chain []*types.Header) error {
 	for i := 1; i < len(chain); i++ {
 		if chain[i].Number.Uint64() != chain[i-1].Number.Uint64()+1 || chain[i].ParentHash != chain[i-1].Hash() {
 			// Chain broke ancestry, log a messge (programming error) and skip insertion
 			log.Error("Non contiguous header insert", "number", chain[i].Number, "hash", chain[i].Hash(),
 				"parent", chain[i].ParentHash, "prevnumber", chain[i-1].Number, "prevhash", chain[i-1].Hash())
 
-			return 0, fmt.Errorf("non contiguous insert: item %d is #%d [%x…], item %d is #%d [%x…] (parent [%x…])", i-1, chain[i-1].Number,
+			return fmt.Errorf("non contiguous insert: item %d is #%d [%x…], item %d is #%d [%x…] (parent [%x…])", i-1, chain[i-1].Number,
 				chain[i-1].Hash().Bytes()[:4], i, chain[i].Number, chain[i].Hash().Bytes()[:4], chain[i].ParentHash[:4])
 		}
 	}
+	return nil
+}
+
+func (hc *HeaderChain) ValidateHeaderChain(chain []*types.Header, checkFreq int) (int, error) {
+	// Do a sanity check that the provided chain is actually ordered and linked
+	if err := validateHeaderLinks(chain); err != nil {
+		return 0, err
+	}
 
 	// Generate the list of seal verification requests, and start the parallel verifier
 	seals := make([]bool, len(chain))
@@ -307,6 +521,44 @@ func (hc *HeaderChain) GetBlockHashesFromHash(hash common.Hash, max uint64) []co
 	return chain
 }
 
+// GetAncestor retrieves the Nth ancestor of a given block. It assumes that either
+// the given block or a close ancestor of it is canonical. maxNonCanonical points
+// to a downwards counter limiting the number of blocks to be individually checked
+// before reaching the canonical chain, from where the ancestor is looked up
+// directly.
+//
+// Note: ancestor == 0 returns the same block, 1 returns its parent and so on.
+func (hc *HeaderChain) GetAncestor(hash common.Hash, number, ancestor uint64, maxNonCanonical *uint64) (common.Hash, uint64) {
+	if ancestor > number {
+		return common.Hash{}, 0
+	}
+	if ancestor == 1 {
+		// in this case it is cheaper to just read the header
+		if header := hc.GetHeader(hash, number); header != nil {
+			return header.ParentHash, number - 1
+		}
+		return common.Hash{}, 0
+	}
+	for ancestor != 0 {
+		if GetCanonicalHash(hc.chainDb, number) == hash {
+			number -= ancestor
+			return GetCanonicalHash(hc.chainDb, number), number
+		}
+		if *maxNonCanonical == 0 {
+			return common.Hash{}, 0
+		}
+		*maxNonCanonical--
+		ancestor--
+		header := hc.GetHeader(hash, number)
+		if header == nil {
+			return common.Hash{}, 0
+		}
+		hash = header.ParentHash
+		number--
+	}
+	return hash, number
+}
+
 // GetTd retrieves a block's total difficulty in the canonical chain from the
 // database by hash and number, caching it if found.
 func (hc *HeaderChain) GetTd(hash common.Hash, number uint64) *big.Int {
@@ -431,6 +683,12 @@ func (hc *HeaderChain) SetHead(head uint64, delFn DeleteCallback) {
 	}
 	hc.currentHeaderHash = hc.currentHeader.Hash()
 
+	// Rewinding past the tail of a checkpoint chain leaves only the genesis
+	if hc.tailHeader != nil && hc.currentHeader.Number.Cmp(hc.tailHeader.Number) < 0 {
+		DeleteChainTailHash(hc.chainDb)
+		hc.tailHeader = nil
+	}
+
 	if err := WriteHeadHeaderHash(hc.chainDb, hc.currentHeaderHash); err != nil {
 		log.Crit("Failed to reset head header hash", "err", err)
 	}
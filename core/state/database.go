@@ -21,6 +21,7 @@ import (
 	"sync"
 
 	"github.com/wiseplat/go-wiseplat/common"
+	"github.com/wiseplat/go-wiseplat/crypto"
 	"github.com/wiseplat/go-wiseplat/wshdb"
 	"github.com/wiseplat/go-wiseplat/trie"
 	lru "github.com/hashicorp/golang-lru"
@@ -66,8 +67,15 @@ type Trie interface {
 // NewDatabase creates a backing store for state. The returned database is safe for
 // concurrent use and retains cached trie nodes in memory.
 func NewDatabase(db wshdb.Database) Database {
+	return NewDatabaseWithHook(db, nil)
+}
+
+// NewDatabaseWithHook creates a backing store for state, same as NewDatabase.
+// Trie nodes and contract code missing from db are requested from hook, which
+// allows processing blocks on top of partially downloaded state.
+func NewDatabaseWithHook(db wshdb.Database, hook trie.MissingNodeHook) Database {
 	csc, _ := lru.New(codeSizeCacheSize)
-	return &cachingDB{db: db, codeSizeCache: csc}
+	return &cachingDB{db: db, codeSizeCache: csc, missing: hook}
 }
 
 type cachingDB struct {
@@ -75,6 +83,7 @@ type cachingDB struct {
 	mu            sync.Mutex
 	pastTries     []*trie.SecureTrie
 	codeSizeCache *lru.Cache
+	missing       trie.MissingNodeHook
 }
 
 func (db *cachingDB) OpenTrie(root common.Hash) (Trie, error) {
@@ -86,7 +95,7 @@ func (db *cachingDB) OpenTrie(root common.Hash) (Trie, error) {
 			return cachedTrie{db.pastTries[i].Copy(), db}, nil
 		}
 	}
-	tr, err := trie.NewSecure(root, db.db, MaxTrieCacheGen)
+	tr, err := trie.NewSecureWithHook(root, db.db, MaxTrieCacheGen, db.missing)
 	if err != nil {
 		return nil, err
 	}
@@ -106,7 +115,7 @@ func (db *cachingDB) pushTrie(t *trie.SecureTrie) {
 }
 
 func (db *cachingDB) OpenStorageTrie(addrHash, root common.Hash) (Trie, error) {
-	return trie.NewSecure(root, db.db, 0)
+	return trie.NewSecureWithHook(root, db.db, 0, db.missing)
 }
 
 func (db *cachingDB) CopyTrie(t Trie) Trie {
@@ -122,12 +131,31 @@ func (db *cachingDB) CopyTrie(t Trie) Trie {
 
 func (db *cachingDB) ContractCode(addrHash, codeHash common.Hash) ([]byte, error) {
 	code, err := db.db.Get(codeHash[:])
+	if err != nil && db.missing != nil {
+		code, err = db.fetchCode(codeHash)
+	}
 	if err == nil {
 		db.codeSizeCache.Add(codeHash, len(code))
 	}
 	return code, err
 }
 
+// fetchCode retrieves contract code absent from the database via the missing
+// node hook, verifies it and stores it for later accesses.
+func (db *cachingDB) fetchCode(codeHash common.Hash) ([]byte, error) {
+	code, err := db.missing(codeHash)
+	if err != nil {
+		return nil, err
+	}
+	if crypto.Keccak256Hash(code) != codeHash {
+		return nil, fmt.Errorf("missing node hook returned invalid code for %x", codeHash)
+	}
+	if err := db.db.Put(codeHash[:], code); err != nil {
+		return nil, err
+	}
+	return code, nil
+}
+
 func (db *cachingDB) ContractCodeSize(addrHash, codeHash common.Hash) (int, error) {
 	if cached, ok := db.codeSizeCache.Get(codeHash); ok {
 		return cached.(int), nil
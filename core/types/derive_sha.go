@@ -29,13 +29,38 @@ type DerivableList interface {
 	GetRlp(i int) []byte
 }
 
+// TrieHasher is the tool used to calculate the root hash of a derivable list.
+// Both trie.Trie and trie.StackTrie satisfy it, but since DeriveShaWith inserts
+// the keys in ascending order, the cheaper stack trie is used by default.
+type TrieHasher interface {
+	Update(key, value []byte)
+	Hash() common.Hash
+}
+
+// DeriveSha computes the root hash of the trie made up from the RLP encoded
+// list items, keyed by the RLP encoding of their index.
 func DeriveSha(list DerivableList) common.Hash {
+	return DeriveShaWith(list, trie.NewStackTrie(nil))
+}
+
+// DeriveShaWith computes the root hash of a derivable list using the given
+// empty trie hasher. The items are inserted in the byte order of their keys,
+// i.e. 1..127 first, then 0 (RLP encoded as 0x80), then 128 and above.
+func DeriveShaWith(list DerivableList, hasher TrieHasher) common.Hash {
 	keybuf := new(bytes.Buffer)
-	trie := new(trie.Trie)
-	for i := 0; i < list.Len(); i++ {
+	insert := func(i int) {
 		keybuf.Reset()
 		rlp.Encode(keybuf, uint(i))
-		trie.Update(keybuf.Bytes(), list.GetRlp(i))
+		hasher.Update(keybuf.Bytes(), list.GetRlp(i))
+	}
+	for i := 1; i < list.Len() && i <= 0x7f; i++ {
+		insert(i)
+	}
+	if list.Len() > 0 {
+		insert(0)
+	}
+	for i := 0x80; i < list.Len(); i++ {
+		insert(i)
 	}
-	return trie.Hash()
+	return hasher.Hash()
 }
@@ -0,0 +1,65 @@
+// Copyright 2018 The go-wiseplat Authors
+// This file is part of the go-wiseplat library.
+//
+// The go-wiseplat library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-wiseplat library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-wiseplat library. If not, see <http://www.gnu.org/licenses/>.
+
+package types
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/wiseplat/go-wiseplat/common"
+	"github.com/wiseplat/go-wiseplat/trie"
+)
+
+func derivableTxs(n int) Transactions {
+	txs := make(Transactions, n)
+	for i := range txs {
+		txs[i] = NewTransaction(uint64(i), common.Address{byte(i)}, big.NewInt(int64(i)), big.NewInt(21000), big.NewInt(1), make([]byte, i%64))
+	}
+	return txs
+}
+
+// Tests that the stack trie based DeriveSha matches the regular trie for lists
+// crossing the single byte index boundaries.
+func TestDeriveSha(t *testing.T) {
+	for _, n := range []int{0, 1, 2, 127, 128, 129, 256, 1000} {
+		txs := derivableTxs(n)
+		if have, want := DeriveSha(txs), DeriveShaWith(txs, new(trie.Trie)); have != want {
+			t.Errorf("%d txs: root mismatch: have %x, want %x", n, have, want)
+		}
+	}
+	if root, want := DeriveSha(Transactions{}), common.HexToHash("56e81f171bcc55a6ff8345e692c0f86e5b48e01b996cadc001622fb5e363b421"); root != want {
+		t.Errorf("empty root mismatch: have %x, want %x", root, want)
+	}
+}
+
+func BenchmarkDeriveShaStackTrie(b *testing.B) {
+	txs := derivableTxs(1000)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		DeriveSha(txs)
+	}
+}
+
+func BenchmarkDeriveShaTrie(b *testing.B) {
+	txs := derivableTxs(1000)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		DeriveShaWith(txs, new(trie.Trie))
+	}
+}
@@ -39,6 +39,8 @@ var (
 	secp256k1_halfN = new(big.Int).Div(secp256k1_N, big.NewInt(2))
 )
 
+var errInvalidPubkey = errors.New("invalid secp256k1 public key")
+
 // Keccak256 calculates and returns the Keccak256 hash of the input data.
 func Keccak256(data ...[]byte) []byte {
 	d := sha3.NewKeccak256()
@@ -124,6 +126,56 @@ func FromECDSAPub(pub *ecdsa.PublicKey) []byte {
 	return elliptic.Marshal(S256(), pub.X, pub.Y)
 }
 
+// CompressPubkey encodes a public key to the 33-byte compressed format.
+func CompressPubkey(pubkey *ecdsa.PublicKey) []byte {
+	buf := make([]byte, 33)
+	buf[0] = byte(2 + pubkey.Y.Bit(0))
+	x := pubkey.X.Bytes()
+	copy(buf[33-len(x):], x)
+	return buf
+}
+
+// DecompressPubkey parses a public key in the 33-byte compressed format.
+func DecompressPubkey(pubkey []byte) (*ecdsa.PublicKey, error) {
+	if len(pubkey) != 33 || (pubkey[0] != 2 && pubkey[0] != 3) {
+		return nil, errInvalidPubkey
+	}
+	p := S256().Params().P
+	x := new(big.Int).SetBytes(pubkey[1:])
+	if x.Cmp(p) >= 0 {
+		return nil, errInvalidPubkey
+	}
+	// y² = x³ + 7, and since p = 3 mod 4 the square root is (x³ + 7)^((p+1)/4)
+	y2 := new(big.Int).Exp(x, big.NewInt(3), p)
+	y2.Add(y2, big.NewInt(7))
+	y2.Mod(y2, p)
+	y := new(big.Int).Exp(y2, new(big.Int).Rsh(new(big.Int).Add(p, big.NewInt(1)), 2), p)
+	if new(big.Int).Exp(y, big.NewInt(2), p).Cmp(y2) != 0 {
+		return nil, errInvalidPubkey
+	}
+	if y.Bit(0) != uint(pubkey[0]-2) {
+		y.Sub(p, y)
+	}
+	return &ecdsa.PublicKey{Curve: S256(), X: x, Y: y}, nil
+}
+
+// VerifySignature checks that the given public key created signature over hash.
+// The signature should be in [R || S] format, without the recovery id.
+func VerifySignature(pubkey *ecdsa.PublicKey, hash, signature []byte) bool {
+	if len(signature) != 64 {
+		return false
+	}
+	sig := make([]byte, 65)
+	copy(sig, signature)
+	for v := byte(0); v < 2; v++ {
+		sig[64] = v
+		if signer, err := SigToPub(hash, sig); err == nil && signer.X.Cmp(pubkey.X) == 0 && signer.Y.Cmp(pubkey.Y) == 0 {
+			return true
+		}
+	}
+	return false
+}
+
 // HexToECDSA parses a secp256k1 private key.
 func HexToECDSA(hexkey string) (*ecdsa.PrivateKey, error) {
 	b, err := hex.DecodeString(hexkey)
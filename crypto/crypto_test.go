@@ -92,6 +92,49 @@ func TestInvalidSign(t *testing.T) {
 	}
 }
 
+func TestPubkeyCompression(t *testing.T) {
+	for i := 0; i < 20; i++ {
+		key, _ := GenerateKey()
+		compressed := CompressPubkey(&key.PublicKey)
+		if len(compressed) != 33 {
+			t.Fatalf("wrong compressed length %d", len(compressed))
+		}
+		pub, err := DecompressPubkey(compressed)
+		if err != nil {
+			t.Fatalf("decompress error: %v", err)
+		}
+		if pub.X.Cmp(key.X) != 0 || pub.Y.Cmp(key.Y) != 0 {
+			t.Fatalf("decompressed key mismatch")
+		}
+	}
+	if _, err := DecompressPubkey(make([]byte, 33)); err == nil {
+		t.Errorf("no error for invalid prefix")
+	}
+	if _, err := DecompressPubkey(make([]byte, 32)); err == nil {
+		t.Errorf("no error for short input")
+	}
+}
+
+func TestVerifySignature(t *testing.T) {
+	key, _ := HexToECDSA(testPrivHex)
+	msg := Keccak256([]byte("foo"))
+	sig, _ := Sign(msg, key)
+
+	if !VerifySignature(&key.PublicKey, msg, sig[:64]) {
+		t.Errorf("can't verify signature")
+	}
+	if VerifySignature(&key.PublicKey, msg, sig) {
+		t.Errorf("signature with recovery id accepted")
+	}
+	other, _ := GenerateKey()
+	if VerifySignature(&other.PublicKey, msg, sig[:64]) {
+		t.Errorf("signature accepted for wrong key")
+	}
+	if VerifySignature(&key.PublicKey, Keccak256([]byte("bar")), sig[:64]) {
+		t.Errorf("signature accepted for wrong message")
+	}
+}
+
 func TestNewContractAddress(t *testing.T) {
 	key, _ := HexToECDSA(testPrivHex)
 	addr := common.HexToAddress(testAddrHex)
@@ -0,0 +1,70 @@
+// Copyright 2018 The go-wiseplat Authors
+// This file is part of the go-wiseplat library.
+//
+// The go-wiseplat library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-wiseplat library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-wiseplat library. If not, see <http://www.gnu.org/licenses/>.
+
+package utesting
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestTest(t *testing.T) {
+	tests := []Test{
+		{
+			Name: "successful test",
+			Fn:   func(t *T) {},
+		},
+		{
+			Name: "failing test",
+			Fn: func(t *T) {
+				t.Log("output")
+				t.Error("failed")
+			},
+		},
+		{
+			Name: "panicking test",
+			Fn: func(t *T) {
+				panic("oh no")
+			},
+		},
+	}
+	var report bytes.Buffer
+	results := RunTests(tests, &report)
+
+	if results[0].Failed || results[0].Output != "" {
+		t.Fatalf("wrong result for successful test: %#v", results[0])
+	}
+	if !results[1].Failed || results[1].Output != "output\nfailed\n" {
+		t.Fatalf("wrong result for failing test: %#v", results[1])
+	}
+	if !results[2].Failed || !strings.HasPrefix(results[2].Output, "panic: oh no\n") {
+		t.Fatalf("wrong result for panicking test: %#v", results[2])
+	}
+	if n := CountFailures(results); n != 2 {
+		t.Fatalf("wrong failure count %d", n)
+	}
+	if !strings.Contains(report.String(), "-- OK successful test") || !strings.Contains(report.String(), "-- FAIL failing test") {
+		t.Fatalf("wrong report:\n%s", report.String())
+	}
+}
+
+func TestMatchTests(t *testing.T) {
+	tests := []Test{{Name: "Status"}, {Name: "GetBlockHeaders"}, {Name: "Large"}}
+	if m := MatchTests(tests, "Block|Status"); len(m) != 2 || m[0].Name != "Status" || m[1].Name != "GetBlockHeaders" {
+		t.Fatalf("wrong match result: %v", m)
+	}
+}
@@ -23,11 +23,13 @@ var Modules = map[string]string{
 	"clique":     Clique_JS,
 	"debug":      Debug_JS,
 	"wsh":        Wsh_JS,
+	"les":        LES_JS,
 	"miner":      Miner_JS,
 	"net":        Net_JS,
 	"personal":   Personal_JS,
 	"rpc":        RPC_JS,
 	"shh":        Shh_JS,
+	"swap":       Swap_JS,
 	"swarmfs":    SWARMFS_JS,
 	"txpool":     TxPool_JS,
 }
@@ -63,6 +65,23 @@ web3._extend({
 });
 `
 
+const Swap_JS = `
+web3._extend({
+	property: 'swap',
+	methods: [
+		new web3._extend.Method({
+			name: 'balance',
+			call: 'swap_balance',
+			params: 1
+		}),
+		new web3._extend.Property({
+			name: 'balances',
+			getter: 'swap_balances'
+		}),
+	]
+});
+`
+
 const Clique_JS = `
 web3._extend({
 	property: 'clique',
@@ -571,6 +590,11 @@ web3._extend({
 			call: 'swarmfs_unmount',
 			params: 1
 		}),
+		new web3._extend.Method({
+			name: 'commit',
+			call: 'swarmfs_commit',
+			params: 1
+		}),
 		new web3._extend.Method({
 			name: 'listmounts',
 			call: 'swarmfs_listmounts',
@@ -606,3 +630,48 @@ web3._extend({
 	]
 });
 `
+
+const LES_JS = `
+web3._extend({
+	property: 'les',
+	methods: [
+		new web3._extend.Method({
+			name: 'getCheckpoint',
+			call: 'les_getCheckpoint',
+			params: 1
+		}),
+		new web3._extend.Method({
+			name: 'addBalance',
+			call: 'les_addBalance',
+			params: 2,
+			inputFormatter: [null, web3._extend.utils.fromDecimal]
+		}),
+		new web3._extend.Method({
+			name: 'setClientCapacity',
+			call: 'les_setClientCapacity',
+			params: 2,
+			inputFormatter: [null, web3._extend.utils.fromDecimal]
+		}),
+		new web3._extend.Method({
+			name: 'clientInfo',
+			call: 'les_clientInfo',
+			params: 1
+		}),
+		new web3._extend.Method({
+			name: 'getTransactionStatus',
+			call: 'les_getTransactionStatus',
+			params: 1
+		}),
+	],
+	properties: [
+		new web3._extend.Property({
+			name: 'latestCheckpoint',
+			getter: 'les_latestCheckpoint'
+		}),
+		new web3._extend.Property({
+			name: 'checkpointContractAddress',
+			getter: 'les_getCheckpointContractAddress'
+		}),
+	]
+});
+`
@@ -0,0 +1,200 @@
+// Copyright 2018 The go-wiseplat Authors
+// This file is part of the go-wiseplat library.
+//
+// The go-wiseplat library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-wiseplat library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-wiseplat library. If not, see <http://www.gnu.org/licenses/>.
+
+package les
+
+import (
+	"context"
+	"errors"
+
+	"github.com/wiseplat/go-wiseplat/common"
+	"github.com/wiseplat/go-wiseplat/common/hexutil"
+	"github.com/wiseplat/go-wiseplat/core"
+	"github.com/wiseplat/go-wiseplat/core/types"
+	"github.com/wiseplat/go-wiseplat/light"
+	"github.com/wiseplat/go-wiseplat/p2p/discover"
+	"github.com/wiseplat/go-wiseplat/params"
+	"github.com/wiseplat/go-wiseplat/rpc"
+)
+
+var (
+	errNoCheckpoint           = errors.New("no local checkpoint provided")
+	errNotActivated           = errors.New("checkpoint oracle is not activated")
+	errNoRegisteredCheckpoint = errors.New("no registered checkpoint available")
+	errNoClientPool           = errors.New("client pool is not available")
+)
+
+// PrivateLightServerAPI provides an API to access the LES light server.
+type PrivateLightServerAPI struct {
+	server *LesServer
+}
+
+// NewPrivateLightServerAPI creates a new LES light server API.
+func NewPrivateLightServerAPI(server *LesServer) *PrivateLightServerAPI {
+	return &PrivateLightServerAPI{server: server}
+}
+
+// GetCheckpoint returns the checkpoint of the given section as generated by the
+// local CHT and BloomTrie indexers. This is the checkpoint oracle admins sign.
+func (api *PrivateLightServerAPI) GetCheckpoint(index uint64) (*params.TrustedCheckpoint, error) {
+	checkpoint := localCheckpoint(api.server.protocolManager.chainDb, index)
+	if checkpoint.Empty() {
+		return nil, errNoCheckpoint
+	}
+	return checkpoint, nil
+}
+
+// LatestCheckpoint returns the latest checkpoint registered in the oracle which
+// is offered to light clients.
+func (api *PrivateLightServerAPI) LatestCheckpoint() (*params.TrustedCheckpoint, error) {
+	if api.server.oracle == nil {
+		return nil, errNotActivated
+	}
+	checkpoint, _ := api.server.oracle.stableCheckpoint()
+	if checkpoint == nil {
+		return nil, errNoRegisteredCheckpoint
+	}
+	return checkpoint, nil
+}
+
+// GetCheckpointContractAddress returns the address of the checkpoint oracle.
+func (api *PrivateLightServerAPI) GetCheckpointContractAddress() (common.Address, error) {
+	if api.server.oracle == nil {
+		return common.Address{}, errNotActivated
+	}
+	return api.server.oracle.config.Address, nil
+}
+
+// AddBalance adds the given amount to the prepaid balance of a light client and
+// returns the balance before and after the change. Clients with an assigned
+// capacity are served as priority clients while their balance is positive.
+func (api *PrivateLightServerAPI) AddBalance(id discover.NodeID, amount hexutil.Uint64) ([2]hexutil.Uint64, error) {
+	if api.server.clientPool == nil {
+		return [2]hexutil.Uint64{}, errNoClientPool
+	}
+	old, balance, err := api.server.clientPool.addBalance(id, uint64(amount))
+	return [2]hexutil.Uint64{hexutil.Uint64(old), hexutil.Uint64(balance)}, err
+}
+
+// SetClientCapacity assigns a guaranteed flow control capacity (minimum recharge
+// rate) to a light client. A zero capacity turns it back into a free client.
+func (api *PrivateLightServerAPI) SetClientCapacity(id discover.NodeID, capacity hexutil.Uint64) error {
+	if api.server.clientPool == nil {
+		return errNoClientPool
+	}
+	return api.server.clientPool.setCapacity(id, uint64(capacity))
+}
+
+// ClientInfo returns the state and usage statistics of a light client.
+func (api *PrivateLightServerAPI) ClientInfo(id discover.NodeID) (map[string]interface{}, error) {
+	if api.server.clientPool == nil {
+		return nil, errNoClientPool
+	}
+	return api.server.clientPool.info(id), nil
+}
+
+// txStatusNames maps the transaction states to their RPC representation.
+var txStatusNames = map[core.TxStatus]string{
+	core.TxStatusUnknown:  "unknown",
+	core.TxStatusQueued:   "queued",
+	core.TxStatusPending:  "pending",
+	core.TxStatusIncluded: "included",
+}
+
+// PublicLightAPI provides an API to access the LES light client.
+type PublicLightAPI struct {
+	backend *LightWiseplat
+}
+
+// NewPublicLightAPI creates a new LES light client API.
+func NewPublicLightAPI(backend *LightWiseplat) *PublicLightAPI {
+	return &PublicLightAPI{backend: backend}
+}
+
+// RPCTxStatus is the status of a transaction as returned by GetTransactionStatus.
+// The position and receipt of included transactions are only reported if the
+// inclusion could be verified or a majority of the queried servers agrees on it.
+type RPCTxStatus struct {
+	Status      string          `json:"status"`
+	BlockHash   *common.Hash    `json:"blockHash,omitempty"`
+	BlockNumber *hexutil.Uint64 `json:"blockNumber,omitempty"`
+	Index       *hexutil.Uint64 `json:"transactionIndex,omitempty"`
+	Receipt     *types.Receipt  `json:"receipt,omitempty"`
+	Verified    bool            `json:"verified"`
+	Servers     int             `json:"servers"`
+}
+
+// GetTransactionStatus queries multiple servers for the status of a transaction
+// and returns the reconciled result. Included transactions are verified against
+// the local chain by retrieving the block and its receipts.
+func (api *PublicLightAPI) GetTransactionStatus(ctx context.Context, hash common.Hash) (*RPCTxStatus, error) {
+	stat, err := getTxStatus(ctx, api.backend.peers, api.backend.odr, hash)
+	if err != nil {
+		return nil, err
+	}
+	res := &RPCTxStatus{
+		Status:   txStatusNames[stat.Status],
+		Receipt:  stat.Receipt,
+		Verified: stat.Verified,
+		Servers:  stat.Servers,
+	}
+	if stat.Lookup != nil {
+		number, index := hexutil.Uint64(stat.Lookup.BlockIndex), hexutil.Uint64(stat.Lookup.Index)
+		res.BlockHash, res.BlockNumber, res.Index = &stat.Lookup.BlockHash, &number, &index
+	}
+	return res, nil
+}
+
+// RPCTxStatusEvent is the notification sent to transaction status subscribers.
+type RPCTxStatusEvent struct {
+	Hash      common.Hash  `json:"hash"`
+	Status    string       `json:"status"`
+	BlockHash *common.Hash `json:"blockHash,omitempty"`
+}
+
+// TransactionStatus creates a subscription that fires each time the status of
+// a transaction sent through the local light transaction pool changes.
+func (api *PublicLightAPI) TransactionStatus(ctx context.Context) (*rpc.Subscription, error) {
+	notifier, supported := rpc.NotifierFromContext(ctx)
+	if !supported {
+		return &rpc.Subscription{}, rpc.ErrNotificationsUnsupported
+	}
+	rpcSub := notifier.CreateSubscription()
+
+	go func() {
+		events := make(chan light.TxStatusEvent, 16)
+		statusSub := api.backend.txPool.SubscribeTxStatusEvent(events)
+		defer statusSub.Unsubscribe()
+
+		for {
+			select {
+			case ev := <-events:
+				res := &RPCTxStatusEvent{Hash: ev.Hash, Status: txStatusNames[ev.Status]}
+				if ev.Status == core.TxStatusIncluded {
+					block := ev.BlockHash
+					res.BlockHash = &block
+				}
+				notifier.Notify(rpcSub.ID, res)
+			case <-rpcSub.Err():
+				return
+			case <-notifier.Closed():
+				return
+			}
+		}
+	}()
+
+	return rpcSub, nil
+}
@@ -173,11 +173,17 @@ func (b *LesApiBackend) AccountManager() *accounts.Manager {
 	return b.wsh.accountManager
 }
 
+// BloomStatus returns the section size and the number of bloom bits sections
+// available, either indexed locally or retrievable from servers via BloomTrie
+// proofs.
 func (b *LesApiBackend) BloomStatus() (uint64, uint64) {
 	if b.wsh.bloomIndexer == nil {
 		return 0, 0
 	}
 	sections, _, _ := b.wsh.bloomIndexer.Sections()
+	if trieSections := light.BloomTrieSections(b.wsh.odr); trieSections > sections {
+		sections = trieSections
+	}
 	return light.BloomTrieFrequency, sections
 }
 
@@ -126,6 +126,8 @@ func New(ctx *node.ServiceContext, config *wsh.Config) (*LightWiseplat, error) {
 	if lwsh.protocolManager, err = NewProtocolManager(lwsh.chainConfig, true, ClientProtocolVersions, config.NetworkId, lwsh.eventMux, lwsh.engine, lwsh.peers, lwsh.blockchain, nil, chainDb, lwsh.odr, lwsh.relay, quitSync, &lwsh.wg); err != nil {
 		return nil, err
 	}
+	lwsh.protocolManager.oracle = newCheckpointOracle(config.CheckpointOracle, nil, chainDb)
+	lwsh.protocolManager.ulc = newULC(config.ULC)
 	lwsh.ApiBackend = &LesApiBackend{lwsh, nil}
 	gpoParams := config.GPO
 	if gpoParams.Default == nil {
@@ -194,6 +196,11 @@ func (s *LightWiseplat) APIs() []rpc.API {
 			Version:   "1.0",
 			Service:   s.netRPCService,
 			Public:    true,
+		}, {
+			Namespace: "les",
+			Version:   "1.0",
+			Service:   NewPublicLightAPI(s),
+			Public:    true,
 		},
 	}...)
 }
@@ -221,9 +228,9 @@ func (s *LightWiseplat) Start(srvr *p2p.Server) error {
 	s.startBloomHandlers()
 	log.Warn("Light client mode is an experimental feature")
 	s.netRPCService = wshapi.NewPublicNetAPI(srvr, s.networkId)
-	// search the topic belonging to the oldest supported protocol because
-	// servers always advertise all supported protocols
-	protocolVersion := ClientProtocolVersions[len(ClientProtocolVersions)-1]
+	// search the topic belonging to the latest supported protocol; servers
+	// advertise all their protocols, so this finds everyone able to serve it
+	protocolVersion := ClientProtocolVersions[0]
 	s.serverPool.start(srvr, lesTopic(s.blockchain.Genesis().Hash(), protocolVersion))
 	s.protocolManager.Start()
 	return nil
@@ -17,10 +17,13 @@
 package les
 
 import (
+	"context"
+	"sync"
 	"time"
 
 	"github.com/wiseplat/go-wiseplat/common/bitutil"
 	"github.com/wiseplat/go-wiseplat/light"
+	"github.com/wiseplat/go-wiseplat/log"
 )
 
 const (
@@ -29,8 +32,9 @@ const (
 	bloomServiceThreads = 16
 
 	// bloomFilterThreads is the number of goroutines used locally per filter to
-	// multiplex requests onto the global servicing goroutines.
-	bloomFilterThreads = 3
+	// multiplex requests onto the global servicing goroutines. It is higher than
+	// for full nodes to keep enough network requests in flight.
+	bloomFilterThreads = 8
 
 	// bloomRetrievalBatch is the maximum number of bloom bit retrievals to service
 	// in a single batch.
@@ -39,6 +43,18 @@ const (
 	// bloomRetrievalWait is the maximum time to wait for enough bloom bit requests
 	// to accumulate request an entire batch (avoiding hysteresis).
 	bloomRetrievalWait = time.Microsecond * 100
+
+	// bloomRequestSections is the maximum number of sections requested from a
+	// single server at once. Larger batches are split and retrieved in parallel
+	// from different servers.
+	bloomRequestSections = 4
+
+	// bloomRetrievalRetries is the number of times a failed bloom bit retrieval
+	// is retried before the error is reported to the filter.
+	bloomRetrievalRetries = 3
+
+	// bloomRetryDelay is the time to wait before retrying a failed retrieval.
+	bloomRetryDelay = 200 * time.Millisecond
 )
 
 // startBloomHandlers starts a batch of goroutines to accept bloom bit database
@@ -54,7 +70,7 @@ func (wsh *LightWiseplat) startBloomHandlers() {
 				case request := <-wsh.bloomRequests:
 					task := <-request
 					task.Bitsets = make([][]byte, len(task.Sections))
-					compVectors, err := light.GetBloomBits(task.Context, wsh.odr, task.Bit, task.Sections)
+					compVectors, err := retrieveBloomBits(task.Context, wsh.odr, task.Bit, task.Sections)
 					if err == nil {
 						for i := range task.Sections {
 							if blob, err := bitutil.DecompressBytes(compVectors[i], int(light.BloomTrieFrequency/8)); err == nil {
@@ -73,6 +89,55 @@ func (wsh *LightWiseplat) startBloomHandlers() {
 	}
 }
 
+// retrieveBloomBits retrieves the compressed bloom bit vectors of the given bit
+// and sections. The sections are split into chunks requested in parallel, so
+// that they are served by different servers, and failed chunks are retried.
+func retrieveBloomBits(ctx context.Context, odr light.OdrBackend, bit uint, sections []uint64) ([][]byte, error) {
+	var (
+		vectors = make([][]byte, len(sections))
+		errs    = make([]error, (len(sections)+bloomRequestSections-1)/bloomRequestSections)
+		wg      sync.WaitGroup
+	)
+	for i := range errs {
+		start, end := i*bloomRequestSections, (i+1)*bloomRequestSections
+		if end > len(sections) {
+			end = len(sections)
+		}
+		wg.Add(1)
+		go func(chunk int, start, end int) {
+			defer wg.Done()
+
+			for retry := 0; ; retry++ {
+				chunkVectors, err := light.GetBloomBits(ctx, odr, bit, sections[start:end])
+				if err == nil {
+					copy(vectors[start:end], chunkVectors)
+					return
+				}
+				// Give up if the sections are not available or retrying failed
+				if err == light.ErrNoTrustedBloomTrie || ctx.Err() != nil || retry >= bloomRetrievalRetries {
+					errs[chunk] = err
+					return
+				}
+				log.Debug("Retrying bloom bits retrieval", "bit", bit, "sections", sections[start:end], "err", err)
+				select {
+				case <-time.After(bloomRetryDelay):
+				case <-ctx.Done():
+					errs[chunk] = ctx.Err()
+					return
+				}
+			}
+		}(i, start, end)
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+	return vectors, nil
+}
+
 const (
 	// bloomConfirms is the number of confirmation blocks before a bloom section is
 	// considered probably final and its rotated bits are calculated.
@@ -0,0 +1,102 @@
+// Copyright 2018 The go-wiseplat Authors
+// This file is part of the go-wiseplat library.
+//
+// The go-wiseplat library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-wiseplat library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-wiseplat library. If not, see <http://www.gnu.org/licenses/>.
+
+package les
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/wiseplat/go-wiseplat/common"
+	"github.com/wiseplat/go-wiseplat/core"
+	"github.com/wiseplat/go-wiseplat/light"
+	"github.com/wiseplat/go-wiseplat/wshdb"
+)
+
+// bloomTestOdr is an ODR backend serving bloom bit requests, failing the first
+// attempt of every request.
+type bloomTestOdr struct {
+	db      wshdb.Database
+	indexer *core.ChainIndexer
+
+	lock     sync.Mutex
+	requests map[uint64]int // Number of requests per first section
+}
+
+func (odr *bloomTestOdr) Database() wshdb.Database             { return odr.db }
+func (odr *bloomTestOdr) ChtIndexer() *core.ChainIndexer       { return nil }
+func (odr *bloomTestOdr) BloomTrieIndexer() *core.ChainIndexer { return odr.indexer }
+func (odr *bloomTestOdr) BloomIndexer() *core.ChainIndexer     { return nil }
+
+func (odr *bloomTestOdr) Retrieve(ctx context.Context, req light.OdrRequest) error {
+	r := req.(*light.BloomRequest)
+	if len(r.SectionIdxList) > bloomRequestSections {
+		return errors.New("too many sections")
+	}
+	odr.lock.Lock()
+	odr.requests[r.SectionIdxList[0]]++
+	first := odr.requests[r.SectionIdxList[0]] == 1
+	odr.lock.Unlock()
+
+	if first {
+		return errors.New("request timed out")
+	}
+	r.BloomBits = make([][]byte, len(r.SectionIdxList))
+	for i, section := range r.SectionIdxList {
+		r.BloomBits[i] = []byte{byte(r.BitIdx), byte(section)}
+	}
+	return nil
+}
+
+// Tests that bloom bits are retrieved in chunks and failed retrievals retried.
+func TestBloomBitsRetrieval(t *testing.T) {
+	db, _ := wshdb.NewMemDatabase()
+	odr := &bloomTestOdr{
+		db:       db,
+		indexer:  light.NewBloomTrieIndexer(db, true),
+		requests: make(map[uint64]int),
+	}
+	defer odr.indexer.Close()
+	odr.indexer.AddKnownSectionHead(9, common.Hash{})
+
+	if sections := light.BloomTrieSections(odr); sections != 10 {
+		t.Fatalf("BloomTrie section count mismatch: have %d, want %d", sections, 10)
+	}
+	sections := []uint64{0, 1, 2, 3, 4, 5, 6, 7, 8, 9}
+	vectors, err := retrieveBloomBits(context.Background(), odr, 7, sections)
+	if err != nil {
+		t.Fatalf("Failed to retrieve bloom bits: %v", err)
+	}
+	for i, section := range sections {
+		if len(vectors[i]) != 2 || vectors[i][0] != 7 || vectors[i][1] != byte(section) {
+			t.Errorf("Section %d vector mismatch: %x", section, vectors[i])
+		}
+	}
+	if len(odr.requests) != 3 {
+		t.Errorf("Chunk count mismatch: have %d, want %d", len(odr.requests), 3)
+	}
+	for section, count := range odr.requests {
+		if count != 2 {
+			t.Errorf("Request count mismatch for chunk at %d: have %d, want %d", section, count, 2)
+		}
+	}
+	// Sections not covered by the BloomTrie must fail without retrying
+	if _, err := retrieveBloomBits(context.Background(), odr, 7, []uint64{10}); err != light.ErrNoTrustedBloomTrie {
+		t.Fatalf("Retrieval of unavailable section: have %v, want %v", err, light.ErrNoTrustedBloomTrie)
+	}
+}
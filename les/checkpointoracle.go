@@ -0,0 +1,186 @@
+// Copyright 2018 The go-wiseplat Authors
+// This file is part of the go-wiseplat library.
+//
+// The go-wiseplat library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-wiseplat library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-wiseplat library. If not, see <http://www.gnu.org/licenses/>.
+
+package les
+
+import (
+	"sync"
+
+	"github.com/wiseplat/go-wiseplat/accounts/abi/bind"
+	"github.com/wiseplat/go-wiseplat/common"
+	"github.com/wiseplat/go-wiseplat/contracts/checkpointoracle"
+	"github.com/wiseplat/go-wiseplat/core"
+	"github.com/wiseplat/go-wiseplat/core/types"
+	"github.com/wiseplat/go-wiseplat/crypto"
+	"github.com/wiseplat/go-wiseplat/light"
+	"github.com/wiseplat/go-wiseplat/log"
+	"github.com/wiseplat/go-wiseplat/params"
+	"github.com/wiseplat/go-wiseplat/wshdb"
+)
+
+// checkpointOracle is responsible for the checkpoints registered on-chain by the
+// admins of the checkpoint oracle contract. Servers read the latest registered
+// checkpoint together with the admin signatures approving it and offer both to
+// clients during the handshake. Clients verify the signatures against their own
+// list of trusted signers before starting to sync from the checkpoint.
+type checkpointOracle struct {
+	config   *params.CheckpointOracleConfig
+	contract *checkpointoracle.CheckpointOracle // Binding to the oracle, nil on clients
+	chainDb  wshdb.Database
+
+	lock       sync.Mutex
+	checkpoint *params.TrustedCheckpoint // Latest checkpoint offered (server) or applied (client)
+	sigs       [][]byte                  // Admin signatures approving the offered checkpoint
+}
+
+// newCheckpointOracle creates a checkpoint oracle handler. The contract backend
+// is only needed by servers reading the oracle, clients should pass nil.
+func newCheckpointOracle(config *params.CheckpointOracleConfig, backend bind.ContractBackend, chainDb wshdb.Database) *checkpointOracle {
+	if config == nil {
+		return nil
+	}
+	if config.Threshold == 0 || uint64(len(config.Signers)) < config.Threshold {
+		log.Error("Invalid checkpoint oracle config", "signers", len(config.Signers), "threshold", config.Threshold)
+		return nil
+	}
+	oracle := &checkpointOracle{
+		config:  config,
+		chainDb: chainDb,
+	}
+	if backend != nil {
+		contract, err := checkpointoracle.NewCheckpointOracle(config.Address, backend)
+		if err != nil {
+			log.Error("Failed to bind checkpoint oracle", "err", err)
+			return nil
+		}
+		oracle.contract = contract
+	}
+	log.Info("Configured checkpoint oracle", "address", config.Address, "signers", len(config.Signers), "threshold", config.Threshold)
+	return oracle
+}
+
+// localCheckpoint assembles the checkpoint of the given section from the CHT
+// and BloomTrie roots generated by the local indexers.
+func localCheckpoint(db wshdb.Database, index uint64) *params.TrustedCheckpoint {
+	sectionHead := core.GetCanonicalHash(db, (index+1)*light.ChtFrequency-1)
+	return &params.TrustedCheckpoint{
+		SectionIndex: index,
+		SectionHead:  sectionHead,
+		CHTRoot:      light.GetChtV2Root(db, index, sectionHead),
+		BloomRoot:    light.GetBloomTrieRoot(db, index, sectionHead),
+	}
+}
+
+// stableCheckpoint returns the latest checkpoint registered in the oracle along
+// with the admin signatures approving it. A checkpoint is only offered if it
+// matches the locally generated one, servers never relay a checkpoint they
+// cannot serve proofs for.
+func (o *checkpointOracle) stableCheckpoint() (*params.TrustedCheckpoint, [][]byte) {
+	if o.contract == nil {
+		return nil, nil
+	}
+	index, root, height, err := o.contract.Contract().GetLatestCheckpoint(nil)
+	if err != nil {
+		log.Debug("Failed to retrieve latest checkpoint", "err", err)
+		return nil, nil
+	}
+	hash := common.Hash(root)
+	if hash == (common.Hash{}) {
+		return nil, nil
+	}
+	o.lock.Lock()
+	defer o.lock.Unlock()
+
+	if o.checkpoint != nil && o.checkpoint.SectionIndex == index && o.checkpoint.Hash() == hash {
+		return o.checkpoint, o.sigs
+	}
+	checkpoint := localCheckpoint(o.chainDb, index)
+	if checkpoint.Empty() || checkpoint.Hash() != hash {
+		log.Debug("Registered checkpoint not available locally", "section", index, "hash", hash)
+		return nil, nil
+	}
+	// Collect the admin votes from the logs of the registration block
+	number := height.Uint64()
+	var logs []*types.Log
+	for _, receipt := range core.GetBlockReceipts(o.chainDb, core.GetCanonicalHash(o.chainDb, number), number) {
+		logs = append(logs, receipt.Logs...)
+	}
+	sigs, err := o.contract.LookupCheckpointVotes(logs, index, hash)
+	if err != nil || len(sigs) == 0 {
+		log.Debug("Failed to retrieve checkpoint votes", "section", index, "err", err)
+		return nil, nil
+	}
+	o.checkpoint, o.sigs = checkpoint, sigs
+	log.Info("Offering registered checkpoint", "section", index, "hash", hash, "votes", len(sigs))
+	return checkpoint, sigs
+}
+
+// verifySigners recovers the signers of the given checkpoint signatures and
+// reports whether at least the configured threshold of distinct trusted signers
+// approved the checkpoint.
+func (o *checkpointOracle) verifySigners(index uint64, hash common.Hash, sigs [][]byte) (bool, []common.Address) {
+	if uint64(len(sigs)) < o.config.Threshold {
+		return false, nil
+	}
+	var (
+		signHash = checkpointoracle.SignHash(o.config.Address, index, hash)
+		signers  []common.Address
+		seen     = make(map[common.Address]bool)
+	)
+	for _, sig := range sigs {
+		if len(sig) != 65 {
+			return false, nil
+		}
+		pubkey, err := crypto.SigToPub(signHash, sig)
+		if err != nil {
+			return false, nil
+		}
+		signer := crypto.PubkeyToAddress(*pubkey)
+		if seen[signer] {
+			continue
+		}
+		for _, trusted := range o.config.Signers {
+			if signer == trusted {
+				signers = append(signers, signer)
+				seen[signer] = true
+				break
+			}
+		}
+	}
+	return uint64(len(signers)) >= o.config.Threshold, signers
+}
+
+// applyCheckpoint verifies a checkpoint received from a server and, if it is
+// approved by enough trusted signers and newer than any previously applied
+// one, adds it to the light chain so header sync starts from it.
+func (o *checkpointOracle) applyCheckpoint(chain *light.LightChain, checkpoint *params.TrustedCheckpoint, sigs [][]byte) bool {
+	if checkpoint == nil || checkpoint.Empty() {
+		return false
+	}
+	o.lock.Lock()
+	defer o.lock.Unlock()
+
+	if o.checkpoint != nil && o.checkpoint.SectionIndex >= checkpoint.SectionIndex {
+		return false
+	}
+	if ok, signers := o.verifySigners(checkpoint.SectionIndex, checkpoint.Hash(), sigs); !ok {
+		log.Debug("Rejected unapproved checkpoint", "section", checkpoint.SectionIndex, "signers", len(signers))
+		return false
+	}
+	chain.AddTrustedCheckpoint(checkpoint)
+	o.checkpoint = checkpoint
+	return true
+}
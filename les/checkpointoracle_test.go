@@ -0,0 +1,88 @@
+// Copyright 2018 The go-wiseplat Authors
+// This file is part of the go-wiseplat library.
+//
+// The go-wiseplat library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-wiseplat library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-wiseplat library. If not, see <http://www.gnu.org/licenses/>.
+
+package les
+
+import (
+	"crypto/ecdsa"
+	"testing"
+
+	"github.com/wiseplat/go-wiseplat/common"
+	"github.com/wiseplat/go-wiseplat/contracts/checkpointoracle"
+	"github.com/wiseplat/go-wiseplat/crypto"
+	"github.com/wiseplat/go-wiseplat/params"
+)
+
+// Tests that checkpoints offered by servers are only accepted if approved by
+// enough distinct trusted signers.
+func TestCheckpointSignerVerification(t *testing.T) {
+	keys := make([]*ecdsa.PrivateKey, 4)
+	for i := range keys {
+		keys[i], _ = crypto.GenerateKey()
+	}
+	config := &params.CheckpointOracleConfig{
+		Address:   common.HexToAddress("0x1234"),
+		Signers:   []common.Address{crypto.PubkeyToAddress(keys[0].PublicKey), crypto.PubkeyToAddress(keys[1].PublicKey), crypto.PubkeyToAddress(keys[2].PublicKey)},
+		Threshold: 2,
+	}
+	oracle := newCheckpointOracle(config, nil, nil)
+	if oracle == nil {
+		t.Fatalf("Failed to create checkpoint oracle")
+	}
+	checkpoint := &params.TrustedCheckpoint{
+		SectionIndex: 3,
+		SectionHead:  common.HexToHash("0x01"),
+		CHTRoot:      common.HexToHash("0x02"),
+		BloomRoot:    common.HexToHash("0x03"),
+	}
+	sign := func(index uint64, hash common.Hash, signers ...int) [][]byte {
+		var sigs [][]byte
+		for _, i := range signers {
+			sig, err := crypto.Sign(checkpointoracle.SignHash(config.Address, index, hash), keys[i])
+			if err != nil {
+				t.Fatalf("Failed to sign checkpoint: %v", err)
+			}
+			sigs = append(sigs, sig)
+		}
+		return sigs
+	}
+	hash := checkpoint.Hash()
+
+	tests := []struct {
+		sigs [][]byte
+		ok   bool
+	}{
+		{sign(3, hash, 0, 1), true},                      // Enough trusted signers
+		{sign(3, hash, 2, 1, 0), true},                   // Order doesn't matter off-chain
+		{sign(3, hash, 0), false},                        // Below threshold
+		{sign(3, hash, 0, 0), false},                     // Duplicate signer counted once
+		{sign(3, hash, 0, 3), false},                     // Untrusted signer ignored
+		{sign(4, hash, 0, 1), false},                     // Signatures for another section
+		{sign(3, common.HexToHash("0xff"), 0, 1), false}, // Signatures for another checkpoint
+	}
+	for i, tt := range tests {
+		if ok, _ := oracle.verifySigners(checkpoint.SectionIndex, hash, tt.sigs); ok != tt.ok {
+			t.Errorf("test %d: verification mismatch: have %v, want %v", i, ok, tt.ok)
+		}
+	}
+	// Invalid configurations must disable the oracle
+	if newCheckpointOracle(&params.CheckpointOracleConfig{Signers: config.Signers, Threshold: 4}, nil, nil) != nil {
+		t.Errorf("Accepted threshold above signer count")
+	}
+	if newCheckpointOracle(&params.CheckpointOracleConfig{Signers: config.Signers}, nil, nil) != nil {
+		t.Errorf("Accepted zero threshold")
+	}
+}
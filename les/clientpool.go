@@ -0,0 +1,407 @@
+// Copyright 2018 The go-wiseplat Authors
+// This file is part of the go-wiseplat library.
+//
+// The go-wiseplat library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-wiseplat library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-wiseplat library. If not, see <http://www.gnu.org/licenses/>.
+
+package les
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/wiseplat/go-wiseplat/common/mclock"
+	"github.com/wiseplat/go-wiseplat/les/flowcontrol"
+	"github.com/wiseplat/go-wiseplat/log"
+	"github.com/wiseplat/go-wiseplat/p2p/discover"
+	"github.com/wiseplat/go-wiseplat/rlp"
+	"github.com/wiseplat/go-wiseplat/wshdb"
+)
+
+var (
+	errPoolFull          = errors.New("client pool is full")
+	errClientConnected   = errors.New("client already connected")
+	errCapacityTooLow    = errors.New("capacity below free client capacity")
+	errCapacityExhausted = errors.New("not enough unassigned capacity")
+	errBalanceOverflow   = errors.New("balance overflow")
+)
+
+var (
+	clientInfoPrefix   = []byte("lesClient-")          // clientInfoPrefix + node id -> clientInfo
+	priorityClientsKey = []byte("_lesPriorityClients") // list of node ids with assigned capacity
+)
+
+// clientInfo is the persisted state and usage statistics of a light client.
+type clientInfo struct {
+	Balance    uint64 // Prepaid balance, consumed at Capacity units per second while connected
+	Capacity   uint64 // Guaranteed capacity of priority clients, zero for free clients
+	ConnTime   uint64 // Total time spent connected, in seconds
+	Requests   uint64 // Total number of requests served
+	ServedCost uint64 // Total flow control cost of served requests
+	LastSeen   uint64 // Unix timestamp of the last disconnection
+}
+
+// poolClient is a light client currently connected to the server.
+type poolClient struct {
+	id         discover.NodeID
+	info       clientInfo
+	priority   bool   // Whether the client was admitted with its guaranteed capacity
+	capacity   uint64 // Capacity granted for the current connection
+	connected  mclock.AbsTime
+	settled    mclock.AbsTime // Last time the connection time and balance were accounted
+	disconnect func()
+	timer      *time.Timer // Fires when the balance of a priority client runs out
+}
+
+// clientPool manages the capacity of the light server among the connected
+// clients. Priority clients are granted the capacity assigned to them through
+// the admin API for as long as they have a positive balance, free clients share
+// the remaining capacity with the flow control parameters of freeParams. When
+// a priority client connects to a saturated server, free clients are kicked
+// to make room for it.
+//
+// The capacity of a client is its minimum recharge rate, the buffer limit is
+// scaled proportionally. Flow control parameters are only announced during the
+// handshake, so changing the capacity of a connected client drops it and the
+// new value takes effect when it reconnects.
+type clientPool struct {
+	db         wshdb.Database
+	freeParams flowcontrol.ServerParams
+	totalCap   uint64 // Total capacity shared among all clients
+	reserved   uint64 // Sum of the capacities assigned to priority clients
+
+	lock      sync.Mutex
+	priority  map[discover.NodeID]uint64 // Assigned capacities of all priority clients
+	connected map[discover.NodeID]*poolClient
+	free      []*poolClient // Connected free clients in order of connection
+	used      uint64        // Capacity granted to connected clients
+}
+
+// newClientPool creates a client pool with room for maxFree free clients,
+// loading the assigned capacities of priority clients from the database.
+func newClientPool(db wshdb.Database, freeParams *flowcontrol.ServerParams, maxFree int) *clientPool {
+	pool := &clientPool{
+		db:         db,
+		freeParams: *freeParams,
+		totalCap:   freeParams.MinRecharge * uint64(maxFree),
+		priority:   make(map[discover.NodeID]uint64),
+		connected:  make(map[discover.NodeID]*poolClient),
+	}
+	if data, err := db.Get(priorityClientsKey); err == nil {
+		var ids []discover.NodeID
+		if err := rlp.DecodeBytes(data, &ids); err != nil {
+			log.Error("Failed to decode priority clients", "err", err)
+		}
+		for _, id := range ids {
+			if info := pool.loadInfo(id); info.Capacity != 0 {
+				pool.priority[id] = info.Capacity
+				pool.reserved += info.Capacity
+			}
+		}
+	}
+	return pool
+}
+
+// connect admits a newly connected client and returns the flow control
+// parameters it is granted. The disconnect callback is used to drop the
+// client when it is kicked or its balance runs out.
+func (pool *clientPool) connect(id discover.NodeID, disconnect func()) (*flowcontrol.ServerParams, error) {
+	pool.lock.Lock()
+	defer pool.lock.Unlock()
+
+	if _, ok := pool.connected[id]; ok {
+		return nil, errClientConnected
+	}
+	now := mclock.Now()
+	client := &poolClient{
+		id:         id,
+		info:       pool.loadInfo(id),
+		connected:  now,
+		settled:    now,
+		disconnect: disconnect,
+	}
+	if capacity := pool.priority[id]; capacity != 0 && client.info.Balance != 0 {
+		// Priority clients always fit into their reserved capacity, make
+		// room for them by kicking the most recently connected free clients
+		for pool.used+capacity > pool.totalCap && len(pool.free) > 0 {
+			kicked := pool.free[len(pool.free)-1]
+			log.Debug("Kicking free client", "id", kicked.id.TerminalString())
+			pool.remove(kicked, now)
+			kicked.disconnect()
+		}
+		if pool.used+capacity > pool.totalCap {
+			return nil, errPoolFull
+		}
+		client.priority, client.capacity = true, capacity
+		client.timer = time.AfterFunc(balanceDuration(client.info.Balance, capacity), func() { pool.balanceExhausted(client) })
+	} else {
+		// Free clients may only use the capacity not reserved for priority clients
+		capacity = pool.freeParams.MinRecharge
+		if pool.reservedIdle()+pool.used+capacity > pool.totalCap {
+			return nil, errPoolFull
+		}
+		client.capacity = capacity
+		pool.free = append(pool.free, client)
+	}
+	pool.connected[id] = client
+	pool.used += client.capacity
+
+	return &flowcontrol.ServerParams{
+		BufLimit:    pool.freeParams.BufLimit / pool.freeParams.MinRecharge * client.capacity,
+		MinRecharge: client.capacity,
+	}, nil
+}
+
+// disconnect removes a client from the pool, persisting its statistics.
+func (pool *clientPool) disconnect(id discover.NodeID) {
+	pool.lock.Lock()
+	defer pool.lock.Unlock()
+
+	if client, ok := pool.connected[id]; ok {
+		pool.remove(client, mclock.Now())
+	}
+}
+
+// remove settles and persists the state of a connected client and releases
+// its capacity. The caller must hold the pool lock.
+func (pool *clientPool) remove(client *poolClient, now mclock.AbsTime) {
+	pool.settle(client, now)
+	client.info.LastSeen = uint64(time.Now().Unix())
+	pool.storeInfo(client.id, &client.info)
+
+	if client.timer != nil {
+		client.timer.Stop()
+	}
+	if !client.priority {
+		for i, c := range pool.free {
+			if c == client {
+				pool.free = append(pool.free[:i], pool.free[i+1:]...)
+				break
+			}
+		}
+	}
+	delete(pool.connected, client.id)
+	pool.used -= client.capacity
+}
+
+// reservedIdle returns the capacity reserved for priority clients which are
+// not connected with their guaranteed capacity at the moment.
+func (pool *clientPool) reservedIdle() uint64 {
+	idle := pool.reserved
+	for _, client := range pool.connected {
+		if client.priority {
+			idle -= client.capacity
+		}
+	}
+	return idle
+}
+
+// settle accounts the connection time since the last settlement and charges
+// priority clients for it. The caller must hold the pool lock.
+func (pool *clientPool) settle(client *poolClient, now mclock.AbsTime) {
+	elapsed := time.Duration(now - client.settled)
+	if elapsed <= 0 {
+		return
+	}
+	// Count whole seconds since the connection was established to avoid
+	// accumulating rounding errors over many settlements
+	client.info.ConnTime += uint64(time.Duration(now-client.connected)/time.Second - time.Duration(client.settled-client.connected)/time.Second)
+	if client.priority {
+		cost := client.capacity * uint64(elapsed/time.Millisecond) / 1000
+		if cost > client.info.Balance {
+			cost = client.info.Balance
+		}
+		client.info.Balance -= cost
+	}
+	client.settled = now
+}
+
+// balanceExhausted drops a priority client whose balance ran out. It may
+// reconnect as a free client.
+func (pool *clientPool) balanceExhausted(client *poolClient) {
+	pool.lock.Lock()
+	defer pool.lock.Unlock()
+
+	if pool.connected[client.id] != client {
+		return
+	}
+	pool.settle(client, mclock.Now())
+	if client.info.Balance != 0 {
+		// Rounding left some balance, check again later
+		client.timer.Reset(balanceDuration(client.info.Balance, client.capacity))
+		return
+	}
+	log.Debug("Priority client balance exhausted", "id", client.id.TerminalString())
+	pool.remove(client, mclock.Now())
+	client.disconnect()
+}
+
+// requestServed records a served request in the usage statistics of a client.
+func (pool *clientPool) requestServed(id discover.NodeID, cost uint64) {
+	pool.lock.Lock()
+	defer pool.lock.Unlock()
+
+	if client, ok := pool.connected[id]; ok {
+		client.info.Requests++
+		client.info.ServedCost += cost
+	}
+}
+
+// addBalance adds the given amount to the balance of a client, returning the
+// balance before and after the change.
+func (pool *clientPool) addBalance(id discover.NodeID, amount uint64) (uint64, uint64, error) {
+	pool.lock.Lock()
+	defer pool.lock.Unlock()
+
+	info, client := pool.clientInfo(id)
+	old := info.Balance
+	if old+amount < old {
+		return old, old, errBalanceOverflow
+	}
+	info.Balance += amount
+	if client != nil {
+		if client.priority {
+			client.timer.Reset(balanceDuration(info.Balance, client.capacity))
+		} else if amount != 0 && pool.priority[id] != 0 && old == 0 {
+			// The client became eligible for priority service, drop it to
+			// renegotiate the flow control parameters
+			pool.remove(client, mclock.Now())
+			client.disconnect()
+			return old, info.Balance, nil
+		}
+	}
+	pool.storeInfo(id, info)
+	return old, info.Balance, nil
+}
+
+// setCapacity assigns a guaranteed capacity to a client, or turns it back into
+// a free client if the capacity is zero. Connected clients are dropped if the
+// flow control parameters they were granted change.
+func (pool *clientPool) setCapacity(id discover.NodeID, capacity uint64) error {
+	pool.lock.Lock()
+	defer pool.lock.Unlock()
+
+	if capacity != 0 && capacity < pool.freeParams.MinRecharge {
+		return errCapacityTooLow
+	}
+	old := pool.priority[id]
+	if pool.reserved-old+capacity > pool.totalCap {
+		return errCapacityExhausted
+	}
+	info, client := pool.clientInfo(id)
+	info.Capacity = capacity
+	if client != nil && ((client.priority && capacity != client.capacity) || (!client.priority && capacity != 0 && info.Balance != 0)) {
+		pool.remove(client, mclock.Now())
+		client.disconnect()
+	}
+	pool.storeInfo(id, info)
+
+	pool.reserved = pool.reserved - old + capacity
+	if capacity == 0 {
+		delete(pool.priority, id)
+	} else {
+		pool.priority[id] = capacity
+	}
+	if capacity == 0 || old == 0 {
+		ids := make([]discover.NodeID, 0, len(pool.priority))
+		for id := range pool.priority {
+			ids = append(ids, id)
+		}
+		data, err := rlp.EncodeToBytes(ids)
+		if err != nil {
+			log.Crit("Failed to encode priority clients", "err", err)
+		}
+		pool.db.Put(priorityClientsKey, data)
+	}
+	return nil
+}
+
+// clientInfo returns the up to date state of a client and the connection if
+// the client is connected. The caller must hold the pool lock.
+func (pool *clientPool) clientInfo(id discover.NodeID) (*clientInfo, *poolClient) {
+	if client, ok := pool.connected[id]; ok {
+		pool.settle(client, mclock.Now())
+		return &client.info, client
+	}
+	info := pool.loadInfo(id)
+	return &info, nil
+}
+
+// info returns the state and usage statistics of a client.
+func (pool *clientPool) info(id discover.NodeID) map[string]interface{} {
+	pool.lock.Lock()
+	defer pool.lock.Unlock()
+
+	info, client := pool.clientInfo(id)
+	res := map[string]interface{}{
+		"isConnected": client != nil,
+		"isPriority":  client != nil && client.priority,
+		"capacity":    info.Capacity,
+		"balance":     info.Balance,
+		"connTime":    info.ConnTime,
+		"requests":    info.Requests,
+		"servedCost":  info.ServedCost,
+		"lastSeen":    info.LastSeen,
+	}
+	if client != nil {
+		res["currentCapacity"] = client.capacity
+	}
+	return res
+}
+
+// stop persists the statistics of all connected clients.
+func (pool *clientPool) stop() {
+	pool.lock.Lock()
+	defer pool.lock.Unlock()
+
+	now := mclock.Now()
+	for _, client := range pool.connected {
+		pool.settle(client, now)
+		pool.storeInfo(client.id, &client.info)
+		if client.timer != nil {
+			client.timer.Stop()
+		}
+	}
+}
+
+// loadInfo retrieves the persisted state of a client.
+func (pool *clientPool) loadInfo(id discover.NodeID) clientInfo {
+	var info clientInfo
+	if data, err := pool.db.Get(append(clientInfoPrefix, id[:]...)); err == nil {
+		if err := rlp.DecodeBytes(data, &info); err != nil {
+			log.Error("Failed to decode client info", "id", id.TerminalString(), "err", err)
+		}
+	}
+	return info
+}
+
+// storeInfo persists the state of a client.
+func (pool *clientPool) storeInfo(id discover.NodeID, info *clientInfo) {
+	data, err := rlp.EncodeToBytes(info)
+	if err != nil {
+		log.Crit("Failed to encode client info", "err", err)
+	}
+	pool.db.Put(append(clientInfoPrefix, id[:]...), data)
+}
+
+// maxBalanceDuration caps the balance timers to avoid duration overflows.
+const maxBalanceDuration = 24 * time.Hour
+
+// balanceDuration returns how long a balance lasts at the given capacity.
+func balanceDuration(balance, capacity uint64) time.Duration {
+	if balance/capacity >= uint64(maxBalanceDuration/time.Second) {
+		return maxBalanceDuration
+	}
+	return time.Duration(balance/capacity)*time.Second + time.Duration((balance%capacity)*1000/capacity)*time.Millisecond
+}
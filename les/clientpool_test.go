@@ -0,0 +1,171 @@
+// Copyright 2018 The go-wiseplat Authors
+// This file is part of the go-wiseplat library.
+//
+// The go-wiseplat library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-wiseplat library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-wiseplat library. If not, see <http://www.gnu.org/licenses/>.
+
+package les
+
+import (
+	"testing"
+	"time"
+
+	"github.com/wiseplat/go-wiseplat/les/flowcontrol"
+	"github.com/wiseplat/go-wiseplat/p2p/discover"
+	"github.com/wiseplat/go-wiseplat/wshdb"
+)
+
+var testFreeParams = &flowcontrol.ServerParams{BufLimit: 1000, MinRecharge: 10}
+
+func testClientID(i byte) discover.NodeID {
+	var id discover.NodeID
+	id[0] = i
+	return id
+}
+
+// Tests that free clients share the unreserved capacity and are kicked to make
+// room for priority clients.
+func TestClientPoolPriority(t *testing.T) {
+	db, _ := wshdb.NewMemDatabase()
+	pool := newClientPool(db, testFreeParams, 4)
+
+	kicked := make(map[discover.NodeID]bool)
+	connect := func(id discover.NodeID) (*flowcontrol.ServerParams, error) {
+		return pool.connect(id, func() { kicked[id] = true })
+	}
+	if err := pool.setCapacity(testClientID(100), 5); err != errCapacityTooLow {
+		t.Fatalf("Capacity below free capacity: have %v, want %v", err, errCapacityTooLow)
+	}
+	if err := pool.setCapacity(testClientID(100), 50); err != errCapacityExhausted {
+		t.Fatalf("Capacity above total capacity: have %v, want %v", err, errCapacityExhausted)
+	}
+	// Fill the pool with free clients
+	for i := byte(0); i < 4; i++ {
+		params, err := connect(testClientID(i))
+		if err != nil {
+			t.Fatalf("Failed to connect free client %d: %v", i, err)
+		}
+		if *params != *testFreeParams {
+			t.Fatalf("Free client %d params mismatch: have %v, want %v", i, params, testFreeParams)
+		}
+	}
+	if _, err := connect(testClientID(4)); err != errPoolFull {
+		t.Fatalf("Free client accepted into full pool: %v", err)
+	}
+	if _, err := connect(testClientID(0)); err != errClientConnected {
+		t.Fatalf("Duplicate connection: have %v, want %v", err, errClientConnected)
+	}
+	// Priority clients without balance are treated as free clients
+	if err := pool.setCapacity(testClientID(100), 20); err != nil {
+		t.Fatalf("Failed to set capacity: %v", err)
+	}
+	if _, err := connect(testClientID(100)); err != errPoolFull {
+		t.Fatalf("Priority client without balance accepted into full pool: %v", err)
+	}
+	if _, _, err := pool.addBalance(testClientID(100), 1000); err != nil {
+		t.Fatalf("Failed to add balance: %v", err)
+	}
+	params, err := connect(testClientID(100))
+	if err != nil {
+		t.Fatalf("Failed to connect priority client: %v", err)
+	}
+	if params.MinRecharge != 20 || params.BufLimit != 2000 {
+		t.Fatalf("Priority client params mismatch: have %v", params)
+	}
+	// The two most recently connected free clients must have been kicked
+	if len(kicked) != 2 || !kicked[testClientID(2)] || !kicked[testClientID(3)] {
+		t.Fatalf("Kicked clients mismatch: %v", kicked)
+	}
+	// Free clients may not use the capacity reserved for priority clients
+	pool.disconnect(testClientID(100))
+	if _, err := connect(testClientID(2)); err != errPoolFull {
+		t.Fatalf("Free client accepted into reserved capacity: %v", err)
+	}
+	pool.disconnect(testClientID(0))
+	if _, err := connect(testClientID(2)); err != nil {
+		t.Fatalf("Failed to connect free client: %v", err)
+	}
+	// Revoking the capacity releases the reservation
+	if err := pool.setCapacity(testClientID(100), 0); err != nil {
+		t.Fatalf("Failed to revoke capacity: %v", err)
+	}
+	if _, err := connect(testClientID(3)); err != nil {
+		t.Fatalf("Failed to connect free client: %v", err)
+	}
+}
+
+// Tests that priority clients are charged for their connection time and
+// dropped when their balance runs out.
+func TestClientPoolBalance(t *testing.T) {
+	db, _ := wshdb.NewMemDatabase()
+	pool := newClientPool(db, testFreeParams, 4)
+
+	id := testClientID(1)
+	pool.setCapacity(id, 20)
+	pool.addBalance(id, 2) // 100ms at a capacity of 20 units per second
+
+	dropped := make(chan struct{})
+	if _, err := pool.connect(id, func() { close(dropped) }); err != nil {
+		t.Fatalf("Failed to connect priority client: %v", err)
+	}
+	if info := pool.info(id); info["isPriority"] != true {
+		t.Fatalf("Client not admitted as priority client: %v", info)
+	}
+	select {
+	case <-dropped:
+	case <-time.After(time.Second):
+		t.Fatalf("Client not dropped after its balance ran out")
+	}
+	if info := pool.info(id); info["isConnected"] != false || info["balance"] != uint64(0) {
+		t.Fatalf("Client info mismatch after balance ran out: %v", info)
+	}
+	// The client may reconnect as a free client
+	params, err := pool.connect(id, func() {})
+	if err != nil {
+		t.Fatalf("Failed to reconnect as free client: %v", err)
+	}
+	if *params != *testFreeParams {
+		t.Fatalf("Free client params mismatch: have %v, want %v", params, testFreeParams)
+	}
+}
+
+// Tests that client capacities and usage statistics are persisted.
+func TestClientPoolPersistence(t *testing.T) {
+	db, _ := wshdb.NewMemDatabase()
+	pool := newClientPool(db, testFreeParams, 4)
+
+	id := testClientID(1)
+	if err := pool.setCapacity(id, 30); err != nil {
+		t.Fatalf("Failed to set capacity: %v", err)
+	}
+	if old, balance, err := pool.addBalance(id, 1000000); err != nil || old != 0 || balance != 1000000 {
+		t.Fatalf("Balance mismatch: have (%d, %d, %v), want (0, 1000000, nil)", old, balance, err)
+	}
+	pool.connect(id, func() {})
+	pool.requestServed(id, 100)
+	pool.requestServed(id, 200)
+	pool.stop()
+
+	// Reload the pool and check the reservation and statistics
+	pool = newClientPool(db, testFreeParams, 4)
+	if err := pool.setCapacity(testClientID(2), 20); err != errCapacityExhausted {
+		t.Fatalf("Reservation not persisted: have %v, want %v", err, errCapacityExhausted)
+	}
+	info := pool.info(id)
+	if info["capacity"] != uint64(30) || info["requests"] != uint64(2) || info["servedCost"] != uint64(300) {
+		t.Fatalf("Client info mismatch: %v", info)
+	}
+	if balance := info["balance"].(uint64); balance == 0 || balance > 1000000 {
+		t.Fatalf("Balance mismatch: have %d", balance)
+	}
+}
@@ -89,6 +89,7 @@ type fetcherTreeNode struct {
 // fetchRequest represents a header download request
 type fetchRequest struct {
 	hash    common.Hash
+	td      *big.Int // Announced total difficulty of the requested head
 	amount  uint64
 	peer    *peer
 	sent    mclock.AbsTime
@@ -400,6 +401,14 @@ func (f *lightFetcher) nextRequest() (*distReq, uint64) {
 	for p, fp := range f.peers {
 		for hash, n := range fp.nodeByHash {
 			if !f.checkKnownNode(p, n) && !n.requested && (bestTd == nil || n.td.Cmp(bestTd) >= 0) {
+				if f.pm.ulc != nil {
+					// Ultra light clients only fetch the heads announced by
+					// enough trusted servers, without their ancestors
+					if (bestTd == nil || n.td.Cmp(bestTd) > 0) && f.trustedAnnounced(hash) {
+						bestHash, bestAmount, bestTd = hash, 1, n.td
+					}
+					continue
+				}
 				amount := f.requestAmount(p, n)
 				if bestTd == nil || n.td.Cmp(bestTd) > 0 || amount < bestAmount {
 					bestHash = hash
@@ -471,7 +480,7 @@ func (f *lightFetcher) nextRequest() (*distReq, uint64) {
 				cost := p.GetRequestCost(GetBlockHeadersMsg, int(bestAmount))
 				p.fcServer.QueueRequest(reqID, cost)
 				f.reqMu.Lock()
-				f.requested[reqID] = fetchRequest{hash: bestHash, amount: bestAmount, peer: p, sent: mclock.Now()}
+				f.requested[reqID] = fetchRequest{hash: bestHash, td: bestTd, amount: bestAmount, peer: p, sent: mclock.Now()}
 				f.reqMu.Unlock()
 				go func() {
 					time.Sleep(hardRequestTimeout)
@@ -484,6 +493,18 @@ func (f *lightFetcher) nextRequest() (*distReq, uint64) {
 	return rq, reqID
 }
 
+// trustedAnnounced returns whether a head has been announced by enough trusted
+// servers to be accepted by an ultra light client.
+func (f *lightFetcher) trustedAnnounced(hash common.Hash) bool {
+	count := 0
+	for p, fp := range f.peers {
+		if p.isTrusted && fp.nodeByHash[hash] != nil {
+			count++
+		}
+	}
+	return f.pm.ulc.enoughTrusted(count)
+}
+
 // deliverHeaders delivers header download request responses for processing
 func (f *lightFetcher) deliverHeaders(peer *peer, reqID uint64, headers []*types.Header) {
 	f.deliverChn <- fetchResponse{reqID: reqID, headers: headers, peer: peer}
@@ -499,6 +520,15 @@ func (f *lightFetcher) processResponse(req fetchRequest, resp fetchResponse) boo
 	for i, header := range resp.headers {
 		headers[int(req.amount)-1-i] = header
 	}
+	if f.pm.ulc != nil {
+		// The head was announced by enough trusted servers, accept it as is
+		if err := f.chain.InsertTrustedHeader(headers[0], req.td); err != nil {
+			log.Debug("Failed to insert trusted header", "err", err)
+			return false
+		}
+		f.newHeaders(headers, []*big.Int{req.td})
+		return true
+	}
 	if _, err := f.chain.InsertHeaderChain(headers, 1); err != nil {
 		if err == consensus.ErrFutureBlock {
 			return true
@@ -559,6 +589,10 @@ func (f *lightFetcher) checkAnnouncedHeaders(fp *fetcherPeerInfo, headers []*typ
 			// we ran out of recently delivered headers but have not reached a node known by this peer yet, continue matching
 			td = f.chain.GetTd(header.ParentHash, header.Number.Uint64()-1)
 			header = f.chain.GetHeader(header.ParentHash, header.Number.Uint64()-1)
+			if header == nil {
+				// ancestors of trusted heads are not downloaded by ultra light clients
+				return true
+			}
 		} else {
 			header = headers[i]
 			td = tds[i]
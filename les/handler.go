@@ -79,6 +79,9 @@ type BlockChain interface {
 	CurrentHeader() *types.Header
 	GetTdByHash(hash common.Hash) *big.Int
 	InsertHeaderChain(chain []*types.Header, checkFreq int) (int, error)
+	InsertVerifiedHeaderChain(chain []*types.Header) (int, error)
+	Config() *params.ChainConfig
+	Engine() consensus.Engine
 	Rollback(chain []common.Hash)
 	Status() (td *big.Int, currentBlock common.Hash, genesisBlock common.Hash)
 	GetHeaderByNumber(number uint64) *types.Header
@@ -104,6 +107,8 @@ type ProtocolManager struct {
 	odr         *LesOdr
 	server      *LesServer
 	serverPool  *serverPool
+	oracle      *checkpointOracle // Verifier of checkpoints offered by servers, nil if disabled
+	ulc         *ulc              // Trusted servers of the ultra light client mode, nil if disabled
 	lesTopic    discv5.Topic
 	reqDist     *requestDistributor
 	retriever   *retrieveManager
@@ -261,6 +266,20 @@ func (pm *ProtocolManager) newPeer(pv int, nv uint64, p *p2p.Peer, rw p2p.MsgRea
 func (pm *ProtocolManager) handle(p *peer) error {
 	p.Log().Debug("Light Wiseplat peer connected", "name", p.Name())
 
+	// Admit the client into the server's capacity pool
+	if pm.server != nil && pm.server.clientPool != nil {
+		id := p.ID()
+		params, err := pm.server.clientPool.connect(id, func() { go p.Disconnect(p2p.DiscTooManyPeers) })
+		if err != nil {
+			p.Log().Debug("Light Wiseplat client rejected", "err", err)
+			return p2p.DiscTooManyPeers
+		}
+		defer pm.server.clientPool.disconnect(id)
+		p.fcParams = params
+	}
+	if pm.ulc != nil {
+		p.isTrusted = pm.ulc.isTrusted(p.ID())
+	}
 	// Execute the LES handshake
 	td, head, genesis := pm.blockchain.Status()
 	headNum := core.GetBlockNumber(pm.chainDb, head)
@@ -284,6 +303,12 @@ func (pm *ProtocolManager) handle(p *peer) error {
 	}()
 	// Register the peer in the downloader. If the downloader considers it banned, we disconnect
 	if pm.lightSync {
+		// Start syncing from the checkpoint offered by the server if approved by the oracle admins
+		if pm.oracle != nil && p.checkpoint != nil {
+			if pm.oracle.applyCheckpoint(pm.blockchain.(*light.LightChain), p.checkpoint, p.checkpointSigs) {
+				p.Log().Info("Applied registered checkpoint", "section", p.checkpoint.SectionIndex, "head", p.checkpoint.SectionHead)
+			}
+		}
 		p.lock.Lock()
 		head := p.headInfo
 		p.lock.Unlock()
@@ -338,11 +363,11 @@ func (pm *ProtocolManager) handleMsg(p *peer) error {
 		}
 		bufValue, _ := p.fcClient.AcceptRequest()
 		cost := costs.baseCost + reqCnt*costs.reqCost
-		if cost > pm.server.defParams.BufLimit {
-			cost = pm.server.defParams.BufLimit
+		if cost > p.fcParams.BufLimit {
+			cost = p.fcParams.BufLimit
 		}
 		if cost > bufValue {
-			recharge := time.Duration((cost - bufValue) * 1000000 / pm.server.defParams.MinRecharge)
+			recharge := time.Duration((cost - bufValue) * 1000000 / p.fcParams.MinRecharge)
 			p.Log().Error("Request came too early", "recharge", common.PrettyDuration(recharge))
 			return true
 		}
@@ -466,7 +491,7 @@ func (pm *ProtocolManager) handleMsg(p *peer) error {
 		}
 
 		bv, rcost := p.fcClient.RequestProcessed(costs.baseCost + query.Amount*costs.reqCost)
-		pm.server.fcCostStats.update(msg.Code, query.Amount, rcost)
+		pm.server.requestServed(p, msg.Code, query.Amount, rcost)
 		return p.SendBlockHeaders(req.ReqID, bv, headers)
 
 	case BlockHeadersMsg:
@@ -523,7 +548,7 @@ func (pm *ProtocolManager) handleMsg(p *peer) error {
 			}
 		}
 		bv, rcost := p.fcClient.RequestProcessed(costs.baseCost + uint64(reqCnt)*costs.reqCost)
-		pm.server.fcCostStats.update(msg.Code, uint64(reqCnt), rcost)
+		pm.server.requestServed(p, msg.Code, uint64(reqCnt), rcost)
 		return p.SendBlockBodiesRLP(req.ReqID, bv, bodies)
 
 	case BlockBodiesMsg:
@@ -584,7 +609,7 @@ func (pm *ProtocolManager) handleMsg(p *peer) error {
 			}
 		}
 		bv, rcost := p.fcClient.RequestProcessed(costs.baseCost + uint64(reqCnt)*costs.reqCost)
-		pm.server.fcCostStats.update(msg.Code, uint64(reqCnt), rcost)
+		pm.server.requestServed(p, msg.Code, uint64(reqCnt), rcost)
 		return p.SendCode(req.ReqID, bv, data)
 
 	case CodeMsg:
@@ -647,7 +672,7 @@ func (pm *ProtocolManager) handleMsg(p *peer) error {
 			}
 		}
 		bv, rcost := p.fcClient.RequestProcessed(costs.baseCost + uint64(reqCnt)*costs.reqCost)
-		pm.server.fcCostStats.update(msg.Code, uint64(reqCnt), rcost)
+		pm.server.requestServed(p, msg.Code, uint64(reqCnt), rcost)
 		return p.SendReceiptsRLP(req.ReqID, bv, receipts)
 
 	case ReceiptsMsg:
@@ -715,7 +740,7 @@ func (pm *ProtocolManager) handleMsg(p *peer) error {
 			}
 		}
 		bv, rcost := p.fcClient.RequestProcessed(costs.baseCost + uint64(reqCnt)*costs.reqCost)
-		pm.server.fcCostStats.update(msg.Code, uint64(reqCnt), rcost)
+		pm.server.requestServed(p, msg.Code, uint64(reqCnt), rcost)
 		return p.SendProofs(req.ReqID, bv, proofs)
 
 	case GetProofsV2Msg:
@@ -775,7 +800,7 @@ func (pm *ProtocolManager) handleMsg(p *peer) error {
 		}
 		proofs := nodes.NodeList()
 		bv, rcost := p.fcClient.RequestProcessed(costs.baseCost + uint64(reqCnt)*costs.reqCost)
-		pm.server.fcCostStats.update(msg.Code, uint64(reqCnt), rcost)
+		pm.server.requestServed(p, msg.Code, uint64(reqCnt), rcost)
 		return p.SendProofsV2(req.ReqID, bv, proofs)
 
 	case ProofsV1Msg:
@@ -860,7 +885,7 @@ func (pm *ProtocolManager) handleMsg(p *peer) error {
 			}
 		}
 		bv, rcost := p.fcClient.RequestProcessed(costs.baseCost + uint64(reqCnt)*costs.reqCost)
-		pm.server.fcCostStats.update(msg.Code, uint64(reqCnt), rcost)
+		pm.server.requestServed(p, msg.Code, uint64(reqCnt), rcost)
 		return p.SendHeaderProofs(req.ReqID, bv, proofs)
 
 	case GetHelperTrieProofsMsg:
@@ -927,7 +952,7 @@ func (pm *ProtocolManager) handleMsg(p *peer) error {
 		}
 		proofs := nodes.NodeList()
 		bv, rcost := p.fcClient.RequestProcessed(costs.baseCost + uint64(reqCnt)*costs.reqCost)
-		pm.server.fcCostStats.update(msg.Code, uint64(reqCnt), rcost)
+		pm.server.requestServed(p, msg.Code, uint64(reqCnt), rcost)
 		return p.SendHelperTrieProofs(req.ReqID, bv, HelperTrieResps{Proofs: proofs, AuxData: auxData})
 
 	case HeaderProofsMsg:
@@ -987,7 +1012,7 @@ func (pm *ProtocolManager) handleMsg(p *peer) error {
 		pm.txpool.AddRemotes(txs)
 
 		_, rcost := p.fcClient.RequestProcessed(costs.baseCost + uint64(reqCnt)*costs.reqCost)
-		pm.server.fcCostStats.update(msg.Code, uint64(reqCnt), rcost)
+		pm.server.requestServed(p, msg.Code, uint64(reqCnt), rcost)
 
 	case SendTxV2Msg:
 		if pm.txpool == nil {
@@ -1014,7 +1039,7 @@ func (pm *ProtocolManager) handleMsg(p *peer) error {
 		for i, stat := range stats {
 			if stat.Status == core.TxStatusUnknown {
 				if errs := pm.txpool.AddRemotes([]*types.Transaction{req.Txs[i]}); errs[0] != nil {
-					stats[i].Error = errs[0]
+					stats[i].Error = errs[0].Error()
 					continue
 				}
 				stats[i] = pm.txStatus([]common.Hash{hashes[i]})[0]
@@ -1022,7 +1047,7 @@ func (pm *ProtocolManager) handleMsg(p *peer) error {
 		}
 
 		bv, rcost := p.fcClient.RequestProcessed(costs.baseCost + uint64(reqCnt)*costs.reqCost)
-		pm.server.fcCostStats.update(msg.Code, uint64(reqCnt), rcost)
+		pm.server.requestServed(p, msg.Code, uint64(reqCnt), rcost)
 
 		return p.SendTxStatus(req.ReqID, bv, stats)
 
@@ -1043,7 +1068,7 @@ func (pm *ProtocolManager) handleMsg(p *peer) error {
 			return errResp(ErrRequestRejected, "")
 		}
 		bv, rcost := p.fcClient.RequestProcessed(costs.baseCost + uint64(reqCnt)*costs.reqCost)
-		pm.server.fcCostStats.update(msg.Code, uint64(reqCnt), rcost)
+		pm.server.requestServed(p, msg.Code, uint64(reqCnt), rcost)
 
 		return p.SendTxStatus(req.ReqID, bv, pm.txStatus(req.Hashes))
 
@@ -1055,14 +1080,19 @@ func (pm *ProtocolManager) handleMsg(p *peer) error {
 		p.Log().Trace("Received tx status response")
 		var resp struct {
 			ReqID, BV uint64
-			Status    []core.TxStatus
+			Status    []txStatus
 		}
 		if err := msg.Decode(&resp); err != nil {
 			return errResp(ErrDecode, "msg %v: %v", msg, err)
 		}
-
 		p.fcServer.GotReply(resp.ReqID, resp.BV)
 
+		// Replies to transaction sends are not tracked by the retriever, only
+		// deliver the ones belonging to explicit status queries
+		if err := pm.retriever.deliver(p, &Msg{MsgType: MsgTxStatus, ReqID: resp.ReqID, Obj: resp.Status}); err != nil {
+			p.Log().Trace("Untracked tx status response", "reqID", resp.ReqID)
+		}
+
 	default:
 		p.Log().Trace("Received unknown message", "code", msg.Code)
 		return errResp(ErrInvalidMsgCode, "%v", msg.Code)
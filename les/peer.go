@@ -32,6 +32,7 @@ import (
 	"github.com/wiseplat/go-wiseplat/les/flowcontrol"
 	"github.com/wiseplat/go-wiseplat/light"
 	"github.com/wiseplat/go-wiseplat/p2p"
+	"github.com/wiseplat/go-wiseplat/params"
 	"github.com/wiseplat/go-wiseplat/rlp"
 )
 
@@ -59,6 +60,7 @@ type peer struct {
 	network uint64 // Network ID being on
 
 	announceType, requestAnnounceType uint64
+	isTrusted                         bool // Trusted server of the ultra light client mode
 
 	id string
 
@@ -72,8 +74,12 @@ type peer struct {
 	hasBlock       func(common.Hash, uint64) bool
 	responseErrors int
 
-	fcClient       *flowcontrol.ClientNode // nil if the peer is server only
-	fcServer       *flowcontrol.ServerNode // nil if the peer is client only
+	checkpoint     *params.TrustedCheckpoint // Latest registered checkpoint offered by the server
+	checkpointSigs [][]byte                  // Oracle admin signatures approving the checkpoint
+
+	fcClient       *flowcontrol.ClientNode   // nil if the peer is server only
+	fcParams       *flowcontrol.ServerParams // Flow control parameters granted to the client
+	fcServer       *flowcontrol.ServerNode   // nil if the peer is client only
 	fcServerParams *flowcontrol.ServerParams
 	fcCosts        requestCostTable
 }
@@ -410,13 +416,26 @@ func (p *peer) Handshake(td *big.Int, head common.Hash, headNum uint64, genesis
 		send = send.add("serveChainSince", uint64(0))
 		send = send.add("serveStateSince", uint64(0))
 		send = send.add("txRelay", nil)
-		send = send.add("flowControl/BL", server.defParams.BufLimit)
-		send = send.add("flowControl/MRR", server.defParams.MinRecharge)
+		if p.fcParams == nil {
+			p.fcParams = server.defParams
+		}
+		send = send.add("flowControl/BL", p.fcParams.BufLimit)
+		send = send.add("flowControl/MRR", p.fcParams.MinRecharge)
 		list := server.fcCostStats.getCurrentList()
 		send = send.add("flowControl/MRC", list)
 		p.fcCosts = list.decode()
+		if server.oracle != nil {
+			if checkpoint, sigs := server.oracle.stableCheckpoint(); checkpoint != nil {
+				send = send.add("checkpoint", checkpoint)
+				send = send.add("checkpointSigs", sigs)
+			}
+		}
 	} else {
-		p.requestAnnounceType = announceTypeSimple // set to default until "very light" client mode is implemented
+		// Ultra light clients rely on the signed announcements of trusted servers
+		p.requestAnnounceType = announceTypeSimple
+		if p.isTrusted {
+			p.requestAnnounceType = announceTypeSigned
+		}
 		send = send.add("announceType", p.requestAnnounceType)
 	}
 	recvList, err := p.sendReceiveHandshake(send)
@@ -465,7 +484,7 @@ func (p *peer) Handshake(td *big.Int, head common.Hash, headNum uint64, genesis
 		if recv.get("announceType", &p.announceType) != nil {
 			p.announceType = announceTypeSimple
 		}
-		p.fcClient = flowcontrol.NewClientNode(server.fcManager, server.defParams)
+		p.fcClient = flowcontrol.NewClientNode(server.fcManager, p.fcParams)
 	} else {
 		if recv.get("serveChainSince", nil) != nil {
 			return errResp(ErrUselessPeer, "peer cannot serve chain")
@@ -476,6 +495,15 @@ func (p *peer) Handshake(td *big.Int, head common.Hash, headNum uint64, genesis
 		if recv.get("txRelay", nil) != nil {
 			return errResp(ErrUselessPeer, "peer cannot relay transactions")
 		}
+		// Servers with a configured checkpoint oracle offer its latest checkpoint
+		var checkpoint params.TrustedCheckpoint
+		if recv.get("checkpoint", &checkpoint) == nil {
+			var sigs [][]byte
+			if err := recv.get("checkpointSigs", &sigs); err != nil {
+				return err
+			}
+			p.checkpoint, p.checkpointSigs = &checkpoint, sigs
+		}
 		params := &flowcontrol.ServerParams{}
 		if err := recv.get("flowControl/BL", &params.BufLimit); err != nil {
 			return err
@@ -34,7 +34,10 @@ import (
 	"github.com/wiseplat/go-wiseplat/log"
 	"github.com/wiseplat/go-wiseplat/p2p"
 	"github.com/wiseplat/go-wiseplat/p2p/discv5"
+	"github.com/wiseplat/go-wiseplat/p2p/enr"
+	"github.com/wiseplat/go-wiseplat/params"
 	"github.com/wiseplat/go-wiseplat/rlp"
+	"github.com/wiseplat/go-wiseplat/rpc"
 )
 
 type LesServer struct {
@@ -42,8 +45,10 @@ type LesServer struct {
 	fcManager       *flowcontrol.ClientManager // nil if our node is client only
 	fcCostStats     *requestCostStats
 	defParams       *flowcontrol.ServerParams
+	clientPool      *clientPool // Capacity assignment of connected clients, nil if unlimited
 	lesTopics       []discv5.Topic
 	privateKey      *ecdsa.PrivateKey
+	oracle          *checkpointOracle // Source of registered checkpoints, nil if disabled
 	quitSync        chan struct{}
 
 	chtIndexer, bloomTrieIndexer *core.ChainIndexer
@@ -92,32 +97,81 @@ func NewLesServer(wsh *wsh.Wiseplat, config *wsh.Config) (*LesServer, error) {
 
 	srv.chtIndexer.Start(wsh.BlockChain())
 	pm.server = srv
+	srv.oracle = newServerCheckpointOracle(wsh, config.CheckpointOracle)
 
 	srv.defParams = &flowcontrol.ServerParams{
 		BufLimit:    300000000,
 		MinRecharge: 50000,
 	}
 	srv.fcManager = flowcontrol.NewClientManager(uint64(config.LightServ), 10, 1000000000)
+	srv.clientPool = newClientPool(wsh.ChainDb(), srv.defParams, config.LightPeers)
 	srv.fcCostStats = newCostStats(wsh.ChainDb())
 	return srv, nil
 }
 
+// newServerCheckpointOracle creates a checkpoint oracle reading the registered
+// checkpoints from the local chain of the full node.
+func newServerCheckpointOracle(wiseplat *wsh.Wiseplat, config *params.CheckpointOracleConfig) *checkpointOracle {
+	if config == nil {
+		return nil
+	}
+	return newCheckpointOracle(config, wsh.NewContractBackend(wiseplat.ApiBackend), wiseplat.ChainDb())
+}
+
+// APIs returns the collection of RPC services the LES server offers.
+func (s *LesServer) APIs() []rpc.API {
+	return []rpc.API{
+		{
+			Namespace: "les",
+			Version:   "1.0",
+			Service:   NewPrivateLightServerAPI(s),
+			Public:    false,
+		},
+	}
+}
+
+// lesEntry is the "les" entry of the node record, advertising the capacity of
+// the server.
+type lesEntry struct {
+	TotalCapacity uint64 // capacity shared among all clients
+	MinCapacity   uint64 // capacity assigned to a free client
+
+	// Ignore additional fields (for forward compatibility).
+	Rest []rlp.RawValue `rlp:"tail"`
+}
+
+// ENRKey implements enr.Entry.
+func (e lesEntry) ENRKey() string {
+	return "les"
+}
+
 func (s *LesServer) Protocols() []p2p.Protocol {
-	return s.protocolManager.SubProtocols
+	entry := &lesEntry{
+		TotalCapacity: s.clientPool.totalCap,
+		MinCapacity:   s.defParams.MinRecharge,
+	}
+	protos := make([]p2p.Protocol, len(s.protocolManager.SubProtocols))
+	for i, p := range s.protocolManager.SubProtocols {
+		p.Attributes = []enr.Entry{entry}
+		protos[i] = p
+	}
+	return protos
 }
 
 // Start starts the LES server
 func (s *LesServer) Start(srvr *p2p.Server) {
 	s.protocolManager.Start()
-	for _, topic := range s.lesTopics {
-		topic := topic
-		go func() {
-			logger := log.New("topic", topic)
-			logger.Info("Starting topic registration")
-			defer logger.Info("Terminated topic registration")
-
-			srvr.DiscV5.RegisterTopic(topic, s.quitSync)
-		}()
+	if srvr.DiscV5 != nil {
+		for _, topic := range s.lesTopics {
+			topic := topic
+			go func() {
+				logger := log.New("topic", topic)
+				logger.Info("Starting topic registration")
+				defer logger.Info("Terminated topic registration")
+
+				srvr.DiscV5.RegisterTopic(topic, s.quitSync)
+			}()
+		}
 	}
 	s.privateKey = srvr.PrivateKey
 	s.protocolManager.blockLoop()
@@ -132,6 +186,7 @@ func (s *LesServer) Stop() {
 	s.chtIndexer.Close()
 	// bloom trie indexer is closed by parent bloombits indexer
 	s.fcCostStats.store()
+	s.clientPool.stop()
 	s.fcManager.Stop()
 	go func() {
 		<-s.protocolManager.noMorePeers
@@ -139,6 +194,15 @@ func (s *LesServer) Stop() {
 	s.protocolManager.Stop()
 }
 
+// requestServed updates the request cost statistics and the usage statistics
+// of the client the request was served to.
+func (s *LesServer) requestServed(p *peer, msgCode, reqCnt, cost uint64) {
+	s.fcCostStats.update(msgCode, reqCnt, cost)
+	if s.clientPool != nil {
+		s.clientPool.requestServed(p.ID(), cost)
+	}
+}
+
 type requestCosts struct {
 	baseCost, reqCost uint64
 }
@@ -276,11 +276,24 @@ func (pool *serverPool) adjustResponseTime(entry *poolEntry, time time.Duration,
 
 // eventLoop handles pool events and mutex locking for all internal functions
 func (pool *serverPool) eventLoop() {
-	lookupCnt := 0
-	var convTime mclock.AbsTime
+	var (
+		lookupCnt  int
+		convTime   mclock.AbsTime
+		discovered = make(map[discover.NodeID]struct{})
+	)
 	if pool.discSetPeriod != nil {
 		pool.discSetPeriod <- time.Millisecond * 100
 	}
+	// stopFastDiscover slows down the topic search once the fast discovery period
+	// is over.
+	stopFastDiscover := func() {
+		if pool.fastDiscover {
+			pool.fastDiscover = false
+			if pool.discSetPeriod != nil {
+				pool.discSetPeriod <- time.Minute
+			}
+		}
+	}
 	for {
 		select {
 		case entry := <-pool.timeout:
@@ -317,17 +330,21 @@ func (pool *serverPool) eventLoop() {
 			pool.updateCheckDial(entry)
 			pool.lock.Unlock()
 
+			// The topic radius may never converge in a small network, so also stop
+			// fast discovery when enough servers have been found.
+			discovered[entry.id] = struct{}{}
+			if len(discovered) >= targetServerCount {
+				stopFastDiscover()
+			}
+
 		case conv := <-pool.discLookups:
 			if conv {
 				if lookupCnt == 0 {
 					convTime = mclock.Now()
 				}
 				lookupCnt++
-				if pool.fastDiscover && (lookupCnt == 50 || time.Duration(mclock.Now()-convTime) > time.Minute) {
-					pool.fastDiscover = false
-					if pool.discSetPeriod != nil {
-						pool.discSetPeriod <- time.Minute
-					}
+				if lookupCnt == 50 || time.Duration(mclock.Now()-convTime) > time.Minute {
+					stopFastDiscover()
 				}
 			}
 
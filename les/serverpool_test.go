@@ -0,0 +1,120 @@
+// Copyright 2018 The go-wiseplat Authors
+// This file is part of the go-wiseplat library.
+//
+// The go-wiseplat library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-wiseplat library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-wiseplat library. If not, see <http://www.gnu.org/licenses/>.
+
+package les
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/wiseplat/go-wiseplat/common"
+	"github.com/wiseplat/go-wiseplat/crypto"
+	"github.com/wiseplat/go-wiseplat/p2p"
+	"github.com/wiseplat/go-wiseplat/p2p/discover"
+	"github.com/wiseplat/go-wiseplat/p2p/discv5"
+	"github.com/wiseplat/go-wiseplat/wshdb"
+)
+
+// Tests that a cold server pool finds enough light servers of a discovery v5
+// network through the LES topic search.
+func TestServerPoolTopicDiscovery(t *testing.T) {
+	const (
+		nodeCount   = 30
+		serverEvery = 3
+	)
+	topic := lesTopic(common.Hash{1}, lpv2)
+
+	bootnode := newTestDiscV5Node(t)
+	defer bootnode.Close()
+
+	stop := make(chan struct{})
+	defer close(stop)
+
+	servers := make(map[discover.NodeID]bool)
+	for i := 0; i < nodeCount; i++ {
+		net := newTestDiscV5Node(t)
+		defer net.Close()
+		if err := net.SetFallbackNodes([]*discv5.Node{bootnode.Self()}); err != nil {
+			t.Fatalf("failed to set fallback nodes: %v", err)
+		}
+		if i%serverEvery == 0 {
+			servers[discover.NodeID(net.Self().ID)] = true
+			go net.RegisterTopic(topic, stop)
+		}
+	}
+	// Start a light client with an empty server pool searching for the servers
+	key, _ := crypto.GenerateKey()
+	srv := &p2p.Server{Config: p2p.Config{
+		PrivateKey:       key,
+		MaxPeers:         10,
+		ListenAddr:       "127.0.0.1:0",
+		NoDiscovery:      true,
+		DiscoveryV5:      true,
+		DiscoveryV5Addr:  "127.0.0.1:0",
+		BootstrapNodesV5: []*discv5.Node{bootnode.Self()},
+	}}
+	if err := srv.Start(); err != nil {
+		t.Fatalf("failed to start client: %v", err)
+	}
+	defer srv.Stop()
+
+	var (
+		quit = make(chan struct{})
+		wg   sync.WaitGroup
+	)
+	db, _ := wshdb.NewMemDatabase()
+	pool := newServerPool(db, quit, &wg)
+	pool.start(srv, topic)
+	defer func() {
+		close(quit)
+		wg.Wait()
+	}()
+
+	for deadline := time.Now().Add(time.Minute); ; {
+		var found, invalid int
+		pool.lock.Lock()
+		for id := range pool.entries {
+			if servers[id] {
+				found++
+			} else {
+				invalid++
+			}
+		}
+		pool.lock.Unlock()
+
+		if invalid > 0 {
+			t.Fatalf("server pool discovered %d nodes not advertising the topic", invalid)
+		}
+		if found >= targetServerCount {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("server pool found only %d of %d servers", found, targetServerCount)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+// newTestDiscV5Node starts a discovery v5 node on the loopback interface.
+func newTestDiscV5Node(t *testing.T) *discv5.Network {
+	key, _ := crypto.GenerateKey()
+	net, err := discv5.ListenUDP(key, "127.0.0.1:0", nil, "", nil)
+	if err != nil {
+		t.Fatalf("failed to start discovery node: %v", err)
+	}
+	return net
+}
@@ -0,0 +1,198 @@
+// Copyright 2018 The go-wiseplat Authors
+// This file is part of the go-wiseplat library.
+//
+// The go-wiseplat library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-wiseplat library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-wiseplat library. If not, see <http://www.gnu.org/licenses/>.
+
+package les
+
+import (
+	"context"
+	"errors"
+
+	"github.com/wiseplat/go-wiseplat/common"
+	"github.com/wiseplat/go-wiseplat/core"
+	"github.com/wiseplat/go-wiseplat/core/types"
+	"github.com/wiseplat/go-wiseplat/light"
+	"github.com/wiseplat/go-wiseplat/log"
+)
+
+// txStatusServers is the maximum number of servers queried in parallel for the
+// status of a transaction.
+const txStatusServers = 3
+
+var (
+	errNoTxStatusServers = errors.New("no servers available for tx status query")
+	errNoTxStatusAnswers = errors.New("no servers answered the tx status query")
+	errTxNotCanonical    = errors.New("transaction block not canonical")
+	errTxLookupMismatch  = errors.New("transaction lookup entry mismatch")
+)
+
+// lightTxStatus is the status of a transaction reconciled from the answers of
+// multiple servers. Verified is set if the inclusion has been proven by the
+// block body and receipts retrieved through ODR.
+type lightTxStatus struct {
+	Status   core.TxStatus
+	Lookup   *core.TxLookupEntry
+	Receipt  *types.Receipt
+	Verified bool
+	Servers  int // number of servers that answered the query
+}
+
+// getTxStatus queries a few servers in parallel for the status of a transaction
+// and reconciles their answers. Claimed inclusions are verified through ODR, the
+// first one that checks out is returned. Unverifiable inclusions are only accepted
+// if a majority of the answering servers agrees on them, otherwise the most
+// advanced of the remaining states is returned.
+func getTxStatus(ctx context.Context, peers *peerSet, odr *LesOdr, hash common.Hash) (*lightTxStatus, error) {
+	var servers []*peer
+	for _, p := range peers.AllPeers() {
+		if p.version >= lpv2 {
+			servers = append(servers, p)
+			if len(servers) == txStatusServers {
+				break
+			}
+		}
+	}
+	if len(servers) == 0 {
+		return nil, errNoTxStatusServers
+	}
+	answers := make(chan *txStatus, len(servers))
+	for _, p := range servers {
+		go func(p *peer) {
+			stat, err := requestTxStatus(ctx, odr, p, hash)
+			if err != nil {
+				p.Log().Debug("Tx status query failed", "hash", hash, "err", err)
+			}
+			answers <- stat
+		}(p)
+	}
+	var stats []*txStatus
+	for range servers {
+		if stat := <-answers; stat != nil {
+			stats = append(stats, stat)
+		}
+	}
+	if len(stats) == 0 {
+		return nil, errNoTxStatusAnswers
+	}
+	return reconcileTxStatus(ctx, odr, hash, stats), nil
+}
+
+// requestTxStatus retrieves the status of a transaction from a single server.
+func requestTxStatus(ctx context.Context, odr *LesOdr, p *peer, hash common.Hash) (*txStatus, error) {
+	var stat *txStatus
+
+	reqID := genReqID()
+	rq := &distReq{
+		getCost: func(dp distPeer) uint64 {
+			return dp.(*peer).GetRequestCost(GetTxStatusMsg, 1)
+		},
+		canSend: func(dp distPeer) bool {
+			return dp.(*peer) == p
+		},
+		request: func(dp distPeer) func() {
+			cost := p.GetRequestCost(GetTxStatusMsg, 1)
+			p.fcServer.QueueRequest(reqID, cost)
+			return func() { p.RequestTxStatus(reqID, cost, []common.Hash{hash}) }
+		},
+	}
+	validate := func(dp distPeer, msg *Msg) error {
+		if msg.MsgType != MsgTxStatus {
+			return errInvalidMessageType
+		}
+		stats := msg.Obj.([]txStatus)
+		if len(stats) != 1 {
+			return errInvalidEntryCount
+		}
+		if stats[0].Status == core.TxStatusIncluded && stats[0].Lookup == nil {
+			return errTxLookupMismatch
+		}
+		stat = &stats[0]
+		return nil
+	}
+	if err := odr.retriever.retrieve(ctx, reqID, rq, validate, odr.stop); err != nil {
+		return nil, err
+	}
+	return stat, nil
+}
+
+// reconcileTxStatus merges the answers of multiple servers into a single status.
+func reconcileTxStatus(ctx context.Context, odr *LesOdr, hash common.Hash, stats []*txStatus) *lightTxStatus {
+	res := &lightTxStatus{Servers: len(stats)}
+
+	claims := make(map[core.TxLookupEntry]int)
+	for _, stat := range stats {
+		if stat.Status == core.TxStatusIncluded {
+			claims[*stat.Lookup]++
+		} else if stat.Status > res.Status {
+			res.Status = stat.Status
+		}
+	}
+	var (
+		majority    core.TxLookupEntry
+		hasMajority bool
+	)
+	for len(claims) > 0 {
+		// Verify the inclusion claimed by the most servers first
+		var (
+			best  core.TxLookupEntry
+			count int
+		)
+		for lookup, cnt := range claims {
+			if cnt > count {
+				best, count = lookup, cnt
+			}
+		}
+		delete(claims, best)
+
+		receipt, err := verifyTxInclusion(ctx, odr, hash, best)
+		if err == nil {
+			res.Status, res.Lookup, res.Receipt, res.Verified = core.TxStatusIncluded, &best, receipt, true
+			return res
+		}
+		log.Debug("Failed to verify tx inclusion", "hash", hash, "block", best.BlockHash, "err", err)
+		if count*2 > len(stats) {
+			majority, hasMajority = best, true
+		}
+	}
+	if hasMajority {
+		res.Status, res.Lookup = core.TxStatusIncluded, &majority
+	}
+	return res
+}
+
+// verifyTxInclusion checks that the transaction is contained in the canonical
+// block at the given position and returns its receipt. The body and the receipts
+// are both validated against the locally known header by ODR.
+func verifyTxInclusion(ctx context.Context, odr *LesOdr, hash common.Hash, lookup core.TxLookupEntry) (*types.Receipt, error) {
+	if core.GetCanonicalHash(odr.Database(), lookup.BlockIndex) != lookup.BlockHash {
+		return nil, errTxNotCanonical
+	}
+	block, err := light.GetBlock(ctx, odr, lookup.BlockHash, lookup.BlockIndex)
+	if err != nil {
+		return nil, err
+	}
+	txs := block.Transactions()
+	if lookup.Index >= uint64(len(txs)) || txs[lookup.Index].Hash() != hash {
+		return nil, errTxLookupMismatch
+	}
+	receipts, err := light.GetBlockReceipts(ctx, odr, lookup.BlockHash, lookup.BlockIndex)
+	if err != nil {
+		return nil, err
+	}
+	if lookup.Index >= uint64(len(receipts)) {
+		return nil, errTxLookupMismatch
+	}
+	return receipts[lookup.Index], nil
+}
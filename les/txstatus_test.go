@@ -0,0 +1,136 @@
+// Copyright 2018 The go-wiseplat Authors
+// This file is part of the go-wiseplat library.
+//
+// The go-wiseplat library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-wiseplat library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-wiseplat library. If not, see <http://www.gnu.org/licenses/>.
+
+package les
+
+import (
+	"context"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/wiseplat/go-wiseplat/common"
+	"github.com/wiseplat/go-wiseplat/core"
+	"github.com/wiseplat/go-wiseplat/core/types"
+	"github.com/wiseplat/go-wiseplat/light"
+	"github.com/wiseplat/go-wiseplat/params"
+	"github.com/wiseplat/go-wiseplat/wsh"
+	"github.com/wiseplat/go-wiseplat/wshdb"
+)
+
+// Tests that the status of a transaction is queried from multiple servers and
+// inclusions are verified through ODR.
+func TestGetTxStatus(t *testing.T) {
+	peers := newPeerSet()
+	dist := newRequestDistributor(peers, make(chan struct{}))
+	rm := newRetrieveManager(peers, dist, nil)
+	ldb, _ := wshdb.NewMemDatabase()
+	odr := NewLesOdr(ldb, light.NewChtIndexer(ldb, true), light.NewBloomTrieIndexer(ldb, true), wsh.NewBloomIndexer(ldb, light.BloomTrieFrequency), rm)
+	lpm := newTestProtocolManagerMust(t, true, 0, nil, peers, odr, ldb)
+
+	// Start two servers with the same chain, each with its own transaction pool
+	var (
+		servers []*ProtocolManager
+		pools   []*core.TxPool
+		lpeers  []*peer
+	)
+	for i := 0; i < 2; i++ {
+		db, _ := wshdb.NewMemDatabase()
+		pm := newTestProtocolManagerMust(t, false, 4, testChainGen, nil, nil, db)
+		pool := core.NewTxPool(core.DefaultTxPoolConfig, params.TestChainConfig, pm.blockchain.(*core.BlockChain))
+		defer pool.Stop()
+		pm.txpool = pool
+
+		_, err1, lpeer, err2 := newTestPeerPair("peer", lpv2, pm, lpm)
+		select {
+		case <-time.After(time.Millisecond * 100):
+		case err := <-err1:
+			t.Fatalf("peer %d handshake error: %v", i, err)
+		case err := <-err2:
+			t.Fatalf("peer %d handshake error: %v", i, err)
+		}
+		lpeer.lock.Lock()
+		lpeer.hasBlock = func(common.Hash, uint64) bool { return true }
+		lpeer.lock.Unlock()
+
+		servers = append(servers, pm)
+		pools = append(pools, pool)
+		lpeers = append(lpeers, lpeer)
+	}
+	lpm.synchronise(lpeers[0])
+
+	query := func(hash common.Hash) *lightTxStatus {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		stat, err := getTxStatus(ctx, peers, odr, hash)
+		if err != nil {
+			t.Fatalf("Failed to query tx status: %v", err)
+		}
+		if stat.Servers != len(servers) {
+			t.Fatalf("Answering servers mismatch: have %d, want %d", stat.Servers, len(servers))
+		}
+		return stat
+	}
+	// Check a transaction included in the chain
+	chain := servers[0].blockchain.(*core.BlockChain)
+	block := chain.GetBlockByNumber(2)
+	tx := block.Transactions()[1]
+
+	stat := query(tx.Hash())
+	if stat.Status != core.TxStatusIncluded || !stat.Verified {
+		t.Fatalf("Included tx status mismatch: have %d (verified %v)", stat.Status, stat.Verified)
+	}
+	if stat.Lookup.BlockHash != block.Hash() || stat.Lookup.BlockIndex != 2 || stat.Lookup.Index != 1 {
+		t.Fatalf("Included tx position mismatch: have %+v", stat.Lookup)
+	}
+	receipts := core.GetBlockReceipts(servers[0].chainDb, block.Hash(), 2)
+	if stat.Receipt == nil || stat.Receipt.CumulativeGasUsed.Cmp(receipts[1].CumulativeGasUsed) != 0 {
+		t.Fatalf("Included tx receipt mismatch: have %v, want %v", stat.Receipt, receipts[1])
+	}
+	// Check a transaction only known by one of the servers
+	tx, _ = types.SignTx(types.NewTransaction(4, acc1Addr, big.NewInt(10000), bigTxGas, big.NewInt(100000000000), nil), types.HomesteadSigner{}, testBankKey)
+	if err := pools[1].AddRemote(tx); err != nil {
+		t.Fatalf("Failed to add tx to server pool: %v", err)
+	}
+	if stat := query(tx.Hash()); stat.Status != core.TxStatusPending || stat.Lookup != nil {
+		t.Fatalf("Pending tx status mismatch: have %d", stat.Status)
+	}
+	// Check a transaction unknown to all servers
+	if stat := query(common.Hash{1}); stat.Status != core.TxStatusUnknown {
+		t.Fatalf("Unknown tx status mismatch: have %d", stat.Status)
+	}
+}
+
+// Tests that unverifiable inclusion claims are only accepted on majority.
+func TestReconcileTxStatus(t *testing.T) {
+	ldb, _ := wshdb.NewMemDatabase()
+	odr := NewLesOdr(ldb, nil, nil, nil, nil)
+
+	lookup := &core.TxLookupEntry{BlockHash: common.Hash{1}, BlockIndex: 1}
+	included := &txStatus{Status: core.TxStatusIncluded, Lookup: lookup}
+	pending := &txStatus{Status: core.TxStatusPending}
+	unknown := &txStatus{Status: core.TxStatusUnknown}
+
+	stat := reconcileTxStatus(context.Background(), odr, common.Hash{2}, []*txStatus{included, pending, unknown})
+	if stat.Status != core.TxStatusPending || stat.Verified {
+		t.Fatalf("Minority claim status mismatch: have %d (verified %v)", stat.Status, stat.Verified)
+	}
+	stat = reconcileTxStatus(context.Background(), odr, common.Hash{2}, []*txStatus{included, included, unknown})
+	if stat.Status != core.TxStatusIncluded || stat.Verified || *stat.Lookup != *lookup {
+		t.Fatalf("Majority claim status mismatch: have %d (verified %v)", stat.Status, stat.Verified)
+	}
+}
@@ -0,0 +1,71 @@
+// Copyright 2018 The go-wiseplat Authors
+// This file is part of the go-wiseplat library.
+//
+// The go-wiseplat library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-wiseplat library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-wiseplat library. If not, see <http://www.gnu.org/licenses/>.
+
+package les
+
+import (
+	"github.com/wiseplat/go-wiseplat/log"
+	"github.com/wiseplat/go-wiseplat/p2p/discover"
+	"github.com/wiseplat/go-wiseplat/wsh"
+)
+
+// ulc holds the configuration of the ultra light client mode, in which new
+// heads are accepted once enough trusted servers announced them with signed
+// announcements, without downloading and verifying the header chain.
+type ulc struct {
+	trustedKeys        map[discover.NodeID]bool
+	minTrustedFraction int
+}
+
+// newULC creates the ultra light client configuration, returning nil if the
+// mode is disabled or no valid trusted server is configured.
+func newULC(config *wsh.ULCConfig) *ulc {
+	if config == nil {
+		return nil
+	}
+	trustedKeys := make(map[discover.NodeID]bool)
+	for _, url := range config.TrustedServers {
+		node, err := discover.ParseNode(url)
+		if err != nil {
+			log.Error("Invalid trusted server", "url", url, "err", err)
+			continue
+		}
+		trustedKeys[node.ID] = true
+	}
+	if len(trustedKeys) == 0 {
+		return nil
+	}
+	fraction := config.MinTrustedFraction
+	if fraction <= 0 || fraction > 100 {
+		log.Warn("Invalid minimum trusted fraction, using default", "fraction", fraction, "default", wsh.DefaultULCMinTrustedFraction)
+		fraction = wsh.DefaultULCMinTrustedFraction
+	}
+	return &ulc{
+		trustedKeys:        trustedKeys,
+		minTrustedFraction: fraction,
+	}
+}
+
+// isTrusted returns whether the given node is a trusted server.
+func (u *ulc) isTrusted(id discover.NodeID) bool {
+	return u.trustedKeys[id]
+}
+
+// enoughTrusted returns whether the given number of trusted servers is enough
+// to accept an announced head.
+func (u *ulc) enoughTrusted(count int) bool {
+	return count*100 >= u.minTrustedFraction*len(u.trustedKeys)
+}
@@ -0,0 +1,65 @@
+// Copyright 2018 The go-wiseplat Authors
+// This file is part of the go-wiseplat library.
+//
+// The go-wiseplat library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-wiseplat library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-wiseplat library. If not, see <http://www.gnu.org/licenses/>.
+
+package les
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/wiseplat/go-wiseplat/crypto"
+	"github.com/wiseplat/go-wiseplat/p2p/discover"
+	"github.com/wiseplat/go-wiseplat/wsh"
+)
+
+// Tests that the trusted servers of the ultra light client mode are parsed and
+// that heads are only accepted with enough trusted announcements.
+func TestULCTrustedServers(t *testing.T) {
+	var (
+		ids  []discover.NodeID
+		urls []string
+	)
+	for i := 0; i < 4; i++ {
+		key, _ := crypto.GenerateKey()
+		id := discover.PubkeyID(&key.PublicKey)
+		ids = append(ids, id)
+		urls = append(urls, fmt.Sprintf("enode://%x@127.0.0.1:30303", id[:]))
+	}
+	if newULC(nil) != nil {
+		t.Fatalf("Ultra light client enabled without config")
+	}
+	if newULC(&wsh.ULCConfig{TrustedServers: []string{"invalid"}}) != nil {
+		t.Fatalf("Ultra light client enabled without valid trusted server")
+	}
+	u := newULC(&wsh.ULCConfig{TrustedServers: []string{urls[0], urls[1], urls[2], "invalid"}, MinTrustedFraction: 50})
+	if u == nil {
+		t.Fatalf("Failed to create ultra light client config")
+	}
+	for i, id := range ids {
+		if trusted := u.isTrusted(id); trusted != (i < 3) {
+			t.Errorf("Server %d trust mismatch: have %v, want %v", i, trusted, i < 3)
+		}
+	}
+	for count, want := range []bool{false, false, true, true} {
+		if have := u.enoughTrusted(count); have != want {
+			t.Errorf("Announcements by %d servers: have %v, want %v", count, have, want)
+		}
+	}
+	// Invalid fractions fall back to the default
+	if u := newULC(&wsh.ULCConfig{TrustedServers: urls, MinTrustedFraction: 101}); u.minTrustedFraction != wsh.DefaultULCMinTrustedFraction {
+		t.Errorf("Fraction mismatch: have %d, want %d", u.minTrustedFraction, wsh.DefaultULCMinTrustedFraction)
+	}
+}
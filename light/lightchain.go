@@ -96,7 +96,7 @@ func NewLightChain(odr OdrBackend, config *params.ChainConfig, engine consensus.
 		return nil, core.ErrNoGenesis
 	}
 	if cp, ok := trustedCheckpoints[bc.genesisBlock.Hash()]; ok {
-		bc.addTrustedCheckpoint(cp)
+		bc.AddTrustedCheckpoint(&cp)
 	}
 
 	if err := bc.loadLastState(); err != nil {
@@ -113,20 +113,21 @@ func NewLightChain(odr OdrBackend, config *params.ChainConfig, engine consensus.
 	return bc, nil
 }
 
-// addTrustedCheckpoint adds a trusted checkpoint to the blockchain
-func (self *LightChain) addTrustedCheckpoint(cp trustedCheckpoint) {
+// AddTrustedCheckpoint adds a trusted checkpoint to the blockchain. Header
+// synchronisation will start from the last header of the checkpoint section.
+func (self *LightChain) AddTrustedCheckpoint(cp *params.TrustedCheckpoint) {
 	if self.odr.ChtIndexer() != nil {
-		StoreChtRoot(self.chainDb, cp.sectionIdx, cp.sectionHead, cp.chtRoot)
-		self.odr.ChtIndexer().AddKnownSectionHead(cp.sectionIdx, cp.sectionHead)
+		StoreChtRoot(self.chainDb, cp.SectionIndex, cp.SectionHead, cp.CHTRoot)
+		self.odr.ChtIndexer().AddKnownSectionHead(cp.SectionIndex, cp.SectionHead)
 	}
 	if self.odr.BloomTrieIndexer() != nil {
-		StoreBloomTrieRoot(self.chainDb, cp.sectionIdx, cp.sectionHead, cp.bloomTrieRoot)
-		self.odr.BloomTrieIndexer().AddKnownSectionHead(cp.sectionIdx, cp.sectionHead)
+		StoreBloomTrieRoot(self.chainDb, cp.SectionIndex, cp.SectionHead, cp.BloomRoot)
+		self.odr.BloomTrieIndexer().AddKnownSectionHead(cp.SectionIndex, cp.SectionHead)
 	}
 	if self.odr.BloomIndexer() != nil {
-		self.odr.BloomIndexer().AddKnownSectionHead(cp.sectionIdx, cp.sectionHead)
+		self.odr.BloomIndexer().AddKnownSectionHead(cp.SectionIndex, cp.SectionHead)
 	}
-	log.Info("Added trusted checkpoint", "chain name", cp.name)
+	log.Info("Added trusted checkpoint", "chain name", cp.Name, "section", cp.SectionIndex, "hash", cp.SectionHead)
 }
 
 func (self *LightChain) getProcInterrupt() bool {
@@ -223,6 +224,9 @@ func (bc *LightChain) ResetWithGenesisBlock(genesis *types.Block) {
 
 // Accessors
 
+// Config retrieves the light chain's chain configuration.
+func (bc *LightChain) Config() *params.ChainConfig { return bc.hc.Config() }
+
 // Engine retrieves the light chain's consensus engine.
 func (bc *LightChain) Engine() consensus.Engine { return bc.engine }
 
@@ -363,7 +367,23 @@ func (self *LightChain) InsertHeaderChain(chain []*types.Header, checkFreq int)
 	if i, err := self.hc.ValidateHeaderChain(chain, checkFreq); err != nil {
 		return i, err
 	}
+	return self.insertHeaderChain(chain, start)
+}
 
+// InsertVerifiedHeaderChain inserts a batch of headers into the local chain
+// without running them through the consensus engine, as the caller already did
+// so. The headers must still form a contiguous chain extending a local header.
+// Light chain events are posted the same as for InsertHeaderChain.
+func (self *LightChain) InsertVerifiedHeaderChain(chain []*types.Header) (int, error) {
+	start := time.Now()
+	if err := self.hc.ValidateHeaderLinks(chain); err != nil {
+		return 0, err
+	}
+	return self.insertHeaderChain(chain, start)
+}
+
+// insertHeaderChain writes an already validated header chain into the database.
+func (self *LightChain) insertHeaderChain(chain []*types.Header, start time.Time) (int, error) {
 	// Make sure only one thread manipulates the chain at once
 	self.chainmu.Lock()
 	defer func() {
@@ -397,6 +417,27 @@ func (self *LightChain) InsertHeaderChain(chain []*types.Header, checkFreq int)
 	return i, err
 }
 
+// InsertTrustedHeader sets a header announced by enough trusted servers as the
+// new head of the chain without validating it or downloading its ancestors.
+// This is used by ultra light clients.
+func (self *LightChain) InsertTrustedHeader(header *types.Header, td *big.Int) error {
+	self.chainmu.Lock()
+	defer self.chainmu.Unlock()
+
+	self.wg.Add(1)
+	defer self.wg.Done()
+
+	self.mu.Lock()
+	err := self.hc.WriteTrustedHeader(header, td)
+	self.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	log.Debug("Inserted trusted header", "number", header.Number, "hash", header.Hash())
+	go self.postChainEvents([]interface{}{core.ChainEvent{Block: types.NewBlockWithHeader(header), Hash: header.Hash()}})
+	return nil
+}
+
 // CurrentHeader retrieves the current head header of the canonical chain. The
 // header is retrieved from the HeaderChain's internal cache.
 func (self *LightChain) CurrentHeader() *types.Header {
@@ -346,3 +346,41 @@ func TestReorgBadHeaderHashes(t *testing.T) {
 		t.Errorf("last header hash mismatch: have: %x, want %x", ncm.CurrentHeader().Hash(), headers[2].Hash())
 	}
 }
+
+// Tests that trusted headers can be set as the chain head without their
+// ancestors, and that the chain can be extended from them.
+func TestInsertTrustedHeader(t *testing.T) {
+	bc := newTestLightChain()
+	headers := makeHeaderChainWithDiff(bc.genesisBlock, []int{1, 2, 3, 4, 5, 6}, 10)
+
+	// Insert a trusted head skipping its ancestors
+	td := big.NewInt(100)
+	if err := bc.InsertTrustedHeader(headers[3], td); err != nil {
+		t.Fatalf("failed to insert trusted header: %v", err)
+	}
+	if bc.CurrentHeader().Hash() != headers[3].Hash() {
+		t.Fatalf("head mismatch: have %x, want %x", bc.CurrentHeader().Hash(), headers[3].Hash())
+	}
+	if have := bc.GetTd(headers[3].Hash(), headers[3].Number.Uint64()); have.Cmp(td) != 0 {
+		t.Fatalf("td mismatch: have %v, want %v", have, td)
+	}
+	if hash := core.GetCanonicalHash(bc.chainDb, headers[2].Number.Uint64()); hash != (common.Hash{}) {
+		t.Fatalf("unexpected canonical hash for skipped header: %x", hash)
+	}
+	// Regular headers can be imported on top of the trusted head
+	if _, err := bc.InsertHeaderChain(headers[4:], 1); err != nil {
+		t.Fatalf("failed to import headers on top of trusted header: %v", err)
+	}
+	if bc.CurrentHeader().Hash() != headers[5].Hash() {
+		t.Fatalf("head mismatch: have %x, want %x", bc.CurrentHeader().Hash(), headers[5].Hash())
+	}
+	// A trusted head on a lower height reorgs the chain
+	if err := bc.InsertTrustedHeader(headers[2], big.NewInt(200)); err != nil {
+		t.Fatalf("failed to insert trusted header: %v", err)
+	}
+	for _, header := range headers[3:] {
+		if hash := core.GetCanonicalHash(bc.chainDb, header.Number.Uint64()); hash != (common.Hash{}) {
+			t.Errorf("canonical hash %d not deleted: %x", header.Number, hash)
+		}
+	}
+}
@@ -140,6 +140,34 @@ func GetBlockReceipts(ctx context.Context, odr OdrBackend, hash common.Hash, num
 	return r.Receipts, nil
 }
 
+// bloomTrieStatus returns the number of BloomTrie sections consistent with the
+// local canonical chain and the head of the last one.
+func bloomTrieStatus(odr OdrBackend) (uint64, common.Hash) {
+	if odr.BloomTrieIndexer() == nil {
+		return 0, common.Hash{}
+	}
+	db := odr.Database()
+	bloomTrieCount, sectionHeadNum, sectionHead := odr.BloomTrieIndexer().Sections()
+	canonicalHash := core.GetCanonicalHash(db, sectionHeadNum)
+	// if the BloomTrie was injected as a trusted checkpoint, we have no canonical hash yet so we accept zero hash too
+	for bloomTrieCount > 0 && canonicalHash != sectionHead && canonicalHash != (common.Hash{}) {
+		bloomTrieCount--
+		if bloomTrieCount > 0 {
+			sectionHeadNum = bloomTrieCount*BloomTrieFrequency - 1
+			sectionHead = odr.BloomTrieIndexer().SectionHead(bloomTrieCount - 1)
+			canonicalHash = core.GetCanonicalHash(db, sectionHeadNum)
+		}
+	}
+	return bloomTrieCount, sectionHead
+}
+
+// BloomTrieSections returns the number of bloom bits sections which can be
+// retrieved from servers with BloomTrie proofs.
+func BloomTrieSections(odr OdrBackend) uint64 {
+	sections, _ := bloomTrieStatus(odr)
+	return sections
+}
+
 // GetBloomBits retrieves a batch of compressed bloomBits vectors belonging to the given bit index and section indexes
 func GetBloomBits(ctx context.Context, odr OdrBackend, bitIdx uint, sectionIdxList []uint64) ([][]byte, error) {
 	db := odr.Database()
@@ -149,23 +177,7 @@ func GetBloomBits(ctx context.Context, odr OdrBackend, bitIdx uint, sectionIdxLi
 		reqIdx  []int
 	)
 
-	var (
-		bloomTrieCount, sectionHeadNum uint64
-		sectionHead                    common.Hash
-	)
-	if odr.BloomTrieIndexer() != nil {
-		bloomTrieCount, sectionHeadNum, sectionHead = odr.BloomTrieIndexer().Sections()
-		canonicalHash := core.GetCanonicalHash(db, sectionHeadNum)
-		// if the BloomTrie was injected as a trusted checkpoint, we have no canonical hash yet so we accept zero hash too
-		for bloomTrieCount > 0 && canonicalHash != sectionHead && canonicalHash != (common.Hash{}) {
-			bloomTrieCount--
-			if bloomTrieCount > 0 {
-				sectionHeadNum = bloomTrieCount*BloomTrieFrequency - 1
-				sectionHead = odr.BloomTrieIndexer().SectionHead(bloomTrieCount - 1)
-				canonicalHash = core.GetCanonicalHash(db, sectionHeadNum)
-			}
-		}
-	}
+	bloomTrieCount, sectionHead := bloomTrieStatus(odr)
 
 	for i, sectionIdx := range sectionIdxList {
 		sectionHead := core.GetCanonicalHash(db, (sectionIdx+1)*BloomTrieFrequency-1)
@@ -52,6 +52,7 @@ type TxPool struct {
 	signer       types.Signer
 	quit         chan bool
 	txFeed       event.Feed
+	statusFeed   event.Feed
 	scope        event.SubscriptionScope
 	chainHeadCh  chan core.ChainHeadEvent
 	chainHeadSub event.Subscription
@@ -69,6 +70,14 @@ type TxPool struct {
 	homestead bool
 }
 
+// TxStatusEvent is posted when the status of a transaction sent through the
+// light transaction pool changes. BlockHash is only set for included transactions.
+type TxStatusEvent struct {
+	Hash      common.Hash
+	Status    core.TxStatus
+	BlockHash common.Hash
+}
+
 // TxRelayBackend provides an interface to the mechanism that forwards transacions
 // to the WSH network. The implementations of the functions should be non-blocking.
 //
@@ -307,6 +316,16 @@ func (pool *TxPool) setNewHead(head *types.Header) {
 	txc, _ := pool.reorgOnNewHead(ctx, head)
 	m, r := txc.getLists()
 	pool.relay.NewHead(pool.head, m, r)
+
+	events := make([]TxStatusEvent, 0, len(m)+len(r))
+	for _, hash := range m {
+		block, _, _ := core.GetTxLookupEntry(pool.chainDb, hash)
+		events = append(events, TxStatusEvent{Hash: hash, Status: core.TxStatusIncluded, BlockHash: block})
+	}
+	for _, hash := range r {
+		events = append(events, TxStatusEvent{Hash: hash, Status: core.TxStatusPending})
+	}
+	pool.postStatus(events)
 	pool.homestead = pool.config.IsHomestead(head.Number)
 	pool.signer = types.MakeSigner(pool.config, head.Number)
 }
@@ -327,6 +346,26 @@ func (pool *TxPool) SubscribeTxPreEvent(ch chan<- core.TxPreEvent) event.Subscri
 	return pool.scope.Track(pool.txFeed.Subscribe(ch))
 }
 
+// SubscribeTxStatusEvent registers a subscription of TxStatusEvent and starts
+// sending event to the given channel.
+func (pool *TxPool) SubscribeTxStatusEvent(ch chan<- TxStatusEvent) event.Subscription {
+	return pool.scope.Track(pool.statusFeed.Subscribe(ch))
+}
+
+// postStatus notifies the subscribers about transaction status changes. Same as
+// with TxPreEvent, the events are posted in a goroutine to avoid deadlocking on
+// the pool lock.
+func (pool *TxPool) postStatus(events []TxStatusEvent) {
+	if len(events) == 0 {
+		return
+	}
+	go func() {
+		for _, ev := range events {
+			pool.statusFeed.Send(ev)
+		}
+	}()
+}
+
 // Stats returns the number of currently pending (locally created) transactions
 func (pool *TxPool) Stats() (pending int) {
 	pool.mu.RLock()
@@ -410,6 +449,7 @@ func (self *TxPool) add(ctx context.Context, tx *types.Transaction) error {
 		// because it's possible that somewhere during the post "Remove transaction"
 		// gets called which will then wait for the global tx pool lock and deadlock.
 		go self.txFeed.Send(core.TxPreEvent{Tx: tx})
+		self.postStatus([]TxStatusEvent{{Hash: hash, Status: core.TxStatusPending}})
 	}
 
 	// Print a log message if low enough level is set
@@ -501,15 +541,20 @@ func (self *TxPool) Content() (map[common.Address]types.Transactions, map[common
 func (self *TxPool) RemoveTransactions(txs types.Transactions) {
 	self.mu.Lock()
 	defer self.mu.Unlock()
-	var hashes []common.Hash
+	var (
+		hashes []common.Hash
+		events []TxStatusEvent
+	)
 	for _, tx := range txs {
 		//self.RemoveTx(tx.Hash())
 		hash := tx.Hash()
 		delete(self.pending, hash)
 		self.chainDb.Delete(hash[:])
 		hashes = append(hashes, hash)
+		events = append(events, TxStatusEvent{Hash: hash, Status: core.TxStatusUnknown})
 	}
 	self.relay.Discard(hashes)
+	self.postStatus(events)
 }
 
 // RemoveTx removes the transaction with the given hash from the pool.
@@ -520,4 +565,5 @@ func (pool *TxPool) RemoveTx(hash common.Hash) {
 	delete(pool.pending, hash)
 	pool.chainDb.Delete(hash[:])
 	pool.relay.Discard([]common.Hash{hash})
+	pool.postStatus([]TxStatusEvent{{Hash: hash, Status: core.TxStatusUnknown}})
 }
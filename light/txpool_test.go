@@ -141,3 +141,63 @@ func TestTxPool(t *testing.T) {
 		}
 	}
 }
+
+// Tests that status changes of locally sent transactions are posted to the
+// status event subscribers.
+func TestTxPoolStatusEvents(t *testing.T) {
+	tx, _ := types.SignTx(types.NewTransaction(0, acc1Addr, big.NewInt(10000), bigTxGas, nil, nil), types.HomesteadSigner{}, testBankKey)
+
+	var (
+		sdb, _  = wshdb.NewMemDatabase()
+		ldb, _  = wshdb.NewMemDatabase()
+		gspec   = core.Genesis{Alloc: core.GenesisAlloc{testBankAddress: {Balance: testBankFunds}}}
+		genesis = gspec.MustCommit(sdb)
+	)
+	gspec.MustCommit(ldb)
+	blockchain, _ := core.NewBlockChain(sdb, params.TestChainConfig, wshash.NewFullFaker(), vm.Config{})
+	gchain, _ := core.GenerateChain(params.TestChainConfig, genesis, sdb, 1, func(i int, block *core.BlockGen) {
+		block.AddTx(tx)
+	})
+	if _, err := blockchain.InsertChain(gchain); err != nil {
+		t.Fatalf("Failed to insert chain: %v", err)
+	}
+	odr := &testOdr{sdb: sdb, ldb: ldb}
+	relay := &testTxRelay{
+		send:    make(chan int, 1),
+		discard: make(chan int, 1),
+		mined:   make(chan int, 1),
+	}
+	lightchain, _ := NewLightChain(odr, params.TestChainConfig, wshash.NewFullFaker())
+	pool := NewTxPool(params.TestChainConfig, lightchain, relay)
+	defer pool.Stop()
+
+	events := make(chan TxStatusEvent, 1)
+	sub := pool.SubscribeTxStatusEvent(events)
+	defer sub.Unsubscribe()
+
+	check := func(status core.TxStatus, block common.Hash) {
+		select {
+		case ev := <-events:
+			if ev.Hash != tx.Hash() || ev.Status != status || ev.BlockHash != block {
+				t.Fatalf("Status event mismatch: have %+v, want %x/%d/%x", ev, tx.Hash(), status, block)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("Status event %d not posted", status)
+		}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	if err := pool.Add(ctx, tx); err != nil {
+		t.Fatalf("Failed to add transaction: %v", err)
+	}
+	check(core.TxStatusPending, common.Hash{})
+
+	if _, err := lightchain.InsertHeaderChain([]*types.Header{gchain[0].Header()}, 1); err != nil {
+		t.Fatalf("Failed to insert header: %v", err)
+	}
+	check(core.TxStatusIncluded, gchain[0].Hash())
+
+	pool.RemoveTx(tx.Hash())
+	check(core.TxStatusUnknown, common.Hash{})
+}
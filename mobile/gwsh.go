@@ -70,6 +70,15 @@ type NodeConfig struct {
 	// It has the form "nodename:secret@host:port"
 	WiseplatNetStats string
 
+	// UltraLightServers are the trusted LES servers of the ultra light client mode.
+	// If set, the node follows the heads announced by enough of these servers
+	// instead of downloading and verifying the header chain.
+	UltraLightServers *Enodes
+
+	// UltraLightFraction is the minimum percentage of trusted servers that must
+	// announce a head for the ultra light client to accept it.
+	UltraLightFraction int
+
 	// WhisperEnabled specifies whether the node should run the Whisper protocol.
 	WhisperEnabled bool
 }
@@ -82,6 +91,7 @@ var defaultNodeConfig = &NodeConfig{
 	WiseplatEnabled:       true,
 	WiseplatNetworkID:     1,
 	WiseplatDatabaseCache: 16,
+	UltraLightFraction:    wsh.DefaultULCMinTrustedFraction,
 }
 
 // NewNodeConfig creates a new node option set, initialized to the default values.
@@ -150,6 +160,12 @@ func NewNode(datadir string, config *NodeConfig) (stack *Node, _ error) {
 		wshConf.SyncMode = downloader.LightSync
 		wshConf.NetworkId = uint64(config.WiseplatNetworkID)
 		wshConf.DatabaseCache = config.WiseplatDatabaseCache
+		if config.UltraLightServers != nil && config.UltraLightServers.Size() > 0 {
+			wshConf.ULC = &wsh.ULCConfig{MinTrustedFraction: config.UltraLightFraction}
+			for _, node := range config.UltraLightServers.nodes {
+				wshConf.ULC.TrustedServers = append(wshConf.ULC.TrustedServers, node.String())
+			}
+		}
 		if err := rawStack.Register(func(ctx *node.ServiceContext) (node.Service, error) {
 			return les.New(ctx, &wshConf)
 		}); err != nil {
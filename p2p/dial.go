@@ -26,6 +26,7 @@ import (
 
 	"github.com/wiseplat/go-wiseplat/log"
 	"github.com/wiseplat/go-wiseplat/p2p/discover"
+	"github.com/wiseplat/go-wiseplat/p2p/enr"
 	"github.com/wiseplat/go-wiseplat/p2p/netutil"
 )
 
@@ -34,6 +35,14 @@ const (
 	// redialing a certain node.
 	dialHistoryExpiration = 30 * time.Second
 
+	// Nodes whose record was rejected by a protocol are not redialed
+	// for this amount of time.
+	filteredDialExpiration = 30 * time.Minute
+
+	// Node records of dial candidates are reused for this amount of
+	// time before they are requested again.
+	recordCacheExpiration = time.Hour
+
 	// Discovery lookups are throttled and can only run
 	// once every few seconds.
 	lookupInterval = 4 * time.Second
@@ -77,8 +86,11 @@ type dialstate struct {
 	dialing       map[discover.NodeID]connFlag
 	lookupBuf     []*discover.Node // current discovery lookup results
 	randomNodes   []*discover.Node // filled from Table
+	dnsNodes      nodeSource       // DNS based node lists, may be nil
+	dnsBuf        []*discover.Node // filled from dnsNodes
 	static        map[discover.NodeID]*dialTask
 	hist          *dialHistory
+	records       map[discover.NodeID]*nodeRecord // records retrieved by recent dials
 
 	start     time.Time        // time when the dialer was first used
 	bootnodes []*discover.Node // default dials when there are no peers
@@ -90,6 +102,13 @@ type discoverTable interface {
 	Resolve(target discover.NodeID) *discover.Node
 	Lookup(target discover.NodeID) []*discover.Node
 	ReadRandomNodes([]*discover.Node) int
+	RequestENR(*discover.Node) (*enr.Record, error)
+}
+
+// nodeSource is an additional source of dial candidates, such as a DNS
+// discovery client.
+type nodeSource interface {
+	ReadRandomNodes([]*discover.Node) int
 }
 
 // the dial history remembers recent dials.
@@ -101,6 +120,13 @@ type pastDial struct {
 	exp time.Time
 }
 
+// nodeRecord is a node record retrieved for a dial. A nil record means that
+// the node didn't provide one.
+type nodeRecord struct {
+	record *enr.Record
+	exp    time.Time
+}
+
 type task interface {
 	Do(*Server)
 }
@@ -112,6 +138,8 @@ type dialTask struct {
 	dest         *discover.Node
 	lastResolved time.Time
 	resolveDelay time.Duration
+	record       *nodeRecord // node record of the destination, nil if not yet requested
+	filtered     bool        // set if the node record was rejected by a protocol
 }
 
 // discoverTask runs discovery table operations.
@@ -137,6 +165,7 @@ func newDialState(static []*discover.Node, bootnodes []*discover.Node, ntab disc
 		bootnodes:   make([]*discover.Node, len(bootnodes)),
 		randomNodes: make([]*discover.Node, maxdyn/2),
 		hist:        new(dialHistory),
+		records:     make(map[discover.NodeID]*nodeRecord),
 	}
 	copy(s.bootnodes, bootnodes)
 	for _, n := range static {
@@ -168,7 +197,7 @@ func (s *dialstate) newTasks(nRunning int, peers map[discover.NodeID]*Peer, now
 			return false
 		}
 		s.dialing[n.ID] = flag
-		newtasks = append(newtasks, &dialTask{flags: flag, dest: n})
+		newtasks = append(newtasks, &dialTask{flags: flag, dest: n, record: s.records[n.ID]})
 		return true
 	}
 
@@ -185,8 +214,13 @@ func (s *dialstate) newTasks(nRunning int, peers map[discover.NodeID]*Peer, now
 		}
 	}
 
-	// Expire the dial history on every invocation.
+	// Expire the dial history and the cached node records on every invocation.
 	s.hist.expire(now)
+	for id, r := range s.records {
+		if now.After(r.exp) {
+			delete(s.records, id)
+		}
+	}
 
 	// Create dials for static nodes if they are not connected.
 	for id, t := range s.static {
@@ -215,7 +249,7 @@ func (s *dialstate) newTasks(nRunning int, peers map[discover.NodeID]*Peer, now
 	// Use random nodes from the table for half of the necessary
 	// dynamic dials.
 	randomCandidates := needDynDials / 2
-	if randomCandidates > 0 {
+	if randomCandidates > 0 && s.ntab != nil {
 		n := s.ntab.ReadRandomNodes(s.randomNodes)
 		for i := 0; i < randomCandidates && i < n; i++ {
 			if addDial(dynDialedConn, s.randomNodes[i]) {
@@ -223,6 +257,24 @@ func (s *dialstate) newTasks(nRunning int, peers map[discover.NodeID]*Peer, now
 			}
 		}
 	}
+	// Use nodes from DNS lists for half of the remaining dynamic dials, or
+	// all of them if there is no discovery table.
+	dnsCandidates := needDynDials / 2
+	if s.ntab == nil {
+		dnsCandidates = needDynDials
+	}
+	if dnsCandidates > 0 && s.dnsNodes != nil {
+		if s.dnsBuf == nil {
+			s.dnsBuf = make([]*discover.Node, s.maxDynDials)
+		}
+		n := s.dnsNodes.ReadRandomNodes(s.dnsBuf)
+		for i := 0; i < n && dnsCandidates > 0; i++ {
+			if addDial(dynDialedConn, s.dnsBuf[i]) {
+				needDynDials--
+				dnsCandidates--
+			}
+		}
+	}
 	// Create dynamic dials from random lookup results, removing tried
 	// items from the result buffer.
 	i := 0
@@ -233,7 +285,7 @@ func (s *dialstate) newTasks(nRunning int, peers map[discover.NodeID]*Peer, now
 	}
 	s.lookupBuf = s.lookupBuf[:copy(s.lookupBuf, s.lookupBuf[i:])]
 	// Launch a discovery lookup if more candidates are needed.
-	if len(s.lookupBuf) < needDynDials && !s.lookupRunning {
+	if len(s.lookupBuf) < needDynDials && !s.lookupRunning && s.ntab != nil {
 		s.lookupRunning = true
 		newtasks = append(newtasks, &discoverTask{})
 	}
@@ -277,8 +329,19 @@ func (s *dialstate) checkDial(n *discover.Node, peers map[discover.NodeID]*Peer)
 func (s *dialstate) taskDone(t task, now time.Time) {
 	switch t := t.(type) {
 	case *dialTask:
-		s.hist.add(t.dest.ID, now.Add(dialHistoryExpiration))
+		// Nodes serving the wrong network are skipped for a longer time.
+		exp := dialHistoryExpiration
+		if t.filtered {
+			exp = filteredDialExpiration
+		}
+		s.hist.add(t.dest.ID, now.Add(exp))
 		delete(s.dialing, t.dest.ID)
+
+		// Cache newly retrieved node records for the next dials.
+		if t.record != nil && t.record.exp.IsZero() {
+			t.record.exp = now.Add(recordCacheExpiration)
+			s.records[t.dest.ID] = t.record
+		}
 	case *discoverTask:
 		s.lookupRunning = false
 		s.lookupBuf = append(s.lookupBuf, t.results...)
@@ -291,6 +354,9 @@ func (t *dialTask) Do(srv *Server) {
 			return
 		}
 	}
+	if t.flags&dynDialedConn != 0 && !t.checkRecord(srv) {
+		return
+	}
 	success := t.dial(srv, t.dest)
 	// Try resolving the ID of static nodes if dialing failed.
 	if !success && t.flags&staticDialedConn != 0 {
@@ -300,6 +366,34 @@ func (t *dialTask) Do(srv *Server) {
 	}
 }
 
+// checkRecord checks the node record of the destination against the dial
+// filters of the protocols. The record is only requested if it wasn't cached
+// by an earlier dial. Nodes whose record is unavailable are dialed anyway.
+func (t *dialTask) checkRecord(srv *Server) bool {
+	if srv.ntab == nil || !srv.hasDialFilter() {
+		return true
+	}
+	if t.record == nil {
+		record, err := srv.ntab.RequestENR(t.dest)
+		if err != nil {
+			log.Trace("Node record unavailable", "id", t.dest.ID, "err", err)
+		}
+		t.record = &nodeRecord{record: record}
+	}
+	record := t.record.record
+	if record == nil {
+		return true
+	}
+	for _, p := range srv.Protocols {
+		if p.DialFilter != nil && !p.DialFilter(record) {
+			log.Debug("Skipping dial candidate", "id", t.dest.ID, "protocol", p.Name, "seq", record.Seq())
+			t.filtered = true
+			return false
+		}
+	}
+	return true
+}
+
 // resolve attempts to find the current endpoint for the destination
 // using discovery.
 //
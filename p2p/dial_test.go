@@ -18,13 +18,16 @@ package p2p
 
 import (
 	"encoding/binary"
+	"errors"
 	"net"
 	"reflect"
 	"testing"
 	"time"
 
 	"github.com/davecgh/go-spew/spew"
+	"github.com/wiseplat/go-wiseplat/crypto"
 	"github.com/wiseplat/go-wiseplat/p2p/discover"
+	"github.com/wiseplat/go-wiseplat/p2p/enr"
 	"github.com/wiseplat/go-wiseplat/p2p/netutil"
 )
 
@@ -83,6 +86,9 @@ func (t fakeTable) Close()                                   {}
 func (t fakeTable) Lookup(discover.NodeID) []*discover.Node  { return nil }
 func (t fakeTable) Resolve(discover.NodeID) *discover.Node   { return nil }
 func (t fakeTable) ReadRandomNodes(buf []*discover.Node) int { return copy(buf, t) }
+func (t fakeTable) RequestENR(*discover.Node) (*enr.Record, error) {
+	return nil, errors.New("no record")
+}
 
 // This test checks that dynamic dials are launched from discovery results.
 func TestDialStateDynDial(t *testing.T) {
@@ -402,6 +408,73 @@ func TestDialStateDynDialFromTable(t *testing.T) {
 	})
 }
 
+// This test checks that dynamic dials are taken from DNS node lists when
+// there is no discovery table.
+func TestDialStateDynDialFromDNS(t *testing.T) {
+	dns := fakeTable{
+		{ID: uintID(1)},
+		{ID: uintID(2)},
+		{ID: uintID(3)},
+	}
+	state := newDialState(nil, nil, nil, 4, nil)
+	state.dnsNodes = dns
+
+	runDialTest(t, dialtest{
+		init: state,
+		rounds: []round{
+			// All nodes of the list are dialed. No discovery lookup is
+			// started although more candidates are needed.
+			{
+				new: []task{
+					&dialTask{flags: dynDialedConn, dest: &discover.Node{ID: uintID(1)}},
+					&dialTask{flags: dynDialedConn, dest: &discover.Node{ID: uintID(2)}},
+					&dialTask{flags: dynDialedConn, dest: &discover.Node{ID: uintID(3)}},
+				},
+			},
+			// Dialing nodes 1,2 succeeds, node 3 fails and is in the dial history.
+			{
+				peers: []*Peer{
+					{rw: &conn{flags: dynDialedConn, id: uintID(1)}},
+					{rw: &conn{flags: dynDialedConn, id: uintID(2)}},
+				},
+				done: []task{
+					&dialTask{flags: dynDialedConn, dest: &discover.Node{ID: uintID(1)}},
+					&dialTask{flags: dynDialedConn, dest: &discover.Node{ID: uintID(2)}},
+					&dialTask{flags: dynDialedConn, dest: &discover.Node{ID: uintID(3)}},
+				},
+				new: []task{
+					&waitExpireTask{Duration: 30 * time.Second},
+				},
+			},
+			{
+				peers: []*Peer{
+					{rw: &conn{flags: dynDialedConn, id: uintID(1)}},
+					{rw: &conn{flags: dynDialedConn, id: uintID(2)}},
+				},
+				done: []task{
+					&waitExpireTask{Duration: 30 * time.Second},
+				},
+				new: []task{
+					&waitExpireTask{Duration: 14 * time.Second},
+				},
+			},
+			// Node 3 is dialed again after its history entry expired.
+			{
+				peers: []*Peer{
+					{rw: &conn{flags: dynDialedConn, id: uintID(1)}},
+					{rw: &conn{flags: dynDialedConn, id: uintID(2)}},
+				},
+				done: []task{
+					&waitExpireTask{Duration: 14 * time.Second},
+				},
+				new: []task{
+					&dialTask{flags: dynDialedConn, dest: &discover.Node{ID: uintID(3)}},
+				},
+			},
+		},
+	})
+}
+
 // This test checks that candidates that do not match the netrestrict list are not dialed.
 func TestDialStateNetRestrict(t *testing.T) {
 	// This table always returns the same random nodes
@@ -611,6 +684,104 @@ func TestDialResolve(t *testing.T) {
 	}
 }
 
+// This test checks that dynamic dial candidates are skipped if a protocol
+// rejects their node record.
+func TestDialFilter(t *testing.T) {
+	var (
+		key, _ = crypto.GenerateKey()
+		good   = discover.NewNode(discover.PubkeyID(&key.PublicKey), net.IP{127, 0, 0, 1}, 30303, 30303)
+		bad    = discover.NewNode(uintID(2), net.IP{127, 0, 0, 2}, 30303, 30303)
+		none   = discover.NewNode(uintID(3), net.IP{127, 0, 0, 3}, 30303, 30303)
+	)
+	goodRecord, badRecord := new(enr.Record), new(enr.Record)
+	goodRecord.Set(enr.WithEntry("net", uint(1)))
+	badRecord.Set(enr.WithEntry("net", uint(2)))
+	goodRecord.Sign(key)
+	badRecord.Sign(key)
+
+	table := &recordMock{records: map[discover.NodeID]*enr.Record{good.ID: goodRecord, bad.ID: badRecord}}
+	dialer := new(dialRecorder)
+	srv := &Server{ntab: table, Config: Config{Dialer: dialer, Protocols: []Protocol{{
+		Name: "test",
+		DialFilter: func(r *enr.Record) bool {
+			var id uint
+			return r.Load(enr.WithEntry("net", &id)) == nil && id == 1
+		},
+	}}}}
+	state := newDialState(nil, nil, table, 3, nil)
+	now := time.Now()
+	for _, n := range []*discover.Node{good, bad, none} {
+		task := &dialTask{flags: dynDialedConn, dest: n}
+		task.Do(srv)
+		state.taskDone(task, now)
+	}
+	if !reflect.DeepEqual(dialer.dialed, []discover.NodeID{good.ID, none.ID}) {
+		t.Fatalf("wrong nodes dialed: %v", dialer.dialed)
+	}
+	// The rejected node stays in the dial history after the others expired.
+	state.hist.expire(now.Add(dialHistoryExpiration + time.Second))
+	if state.hist.contains(good.ID) || state.hist.contains(none.ID) || !state.hist.contains(bad.ID) {
+		t.Fatalf("wrong dial history after expiration: %v", *state.hist)
+	}
+}
+
+// This test checks that node records are reused by later dials until they
+// expire, instead of being requested on every dial.
+func TestDialRecordCache(t *testing.T) {
+	var (
+		key, _ = crypto.GenerateKey()
+		good   = discover.NewNode(discover.PubkeyID(&key.PublicKey), net.IP{127, 0, 0, 1}, 30303, 30303)
+		none   = discover.NewNode(uintID(2), net.IP{127, 0, 0, 2}, 30303, 30303)
+	)
+	record := new(enr.Record)
+	record.Sign(key)
+
+	table := &recordMock{
+		fakeTable: fakeTable{good, none},
+		records:   map[discover.NodeID]*enr.Record{good.ID: record},
+		requests:  make(map[discover.NodeID]int),
+	}
+	srv := &Server{ntab: table, Config: Config{Dialer: new(dialRecorder), Protocols: []Protocol{{
+		Name:       "test",
+		DialFilter: func(r *enr.Record) bool { return true },
+	}}}}
+	state := newDialState(nil, nil, table, 4, nil)
+
+	dial := func(now time.Time) {
+		var dialed int
+		for _, task := range state.newTasks(0, nil, now) {
+			if task, ok := task.(*dialTask); ok {
+				task.Do(srv)
+				state.taskDone(task, now)
+				dialed++
+			}
+		}
+		if dialed != 2 {
+			t.Fatalf("dial count mismatch: have %d, want 2", dialed)
+		}
+	}
+	checkRequests := func(want int) {
+		for _, n := range []*discover.Node{good, none} {
+			if have := table.requests[n.ID]; have != want {
+				t.Fatalf("node %x: record request count mismatch: have %d, want %d", n.ID[:8], have, want)
+			}
+		}
+	}
+	now := time.Now()
+	dial(now)
+	checkRequests(1)
+
+	// Redials reuse the records, including the unavailable one.
+	now = now.Add(dialHistoryExpiration + time.Second)
+	dial(now)
+	checkRequests(1)
+
+	// Expired records are requested again.
+	now = now.Add(recordCacheExpiration)
+	dial(now)
+	checkRequests(2)
+}
+
 // compares task lists but doesn't care about the order.
 func sametasks(a, b []task) bool {
 	if len(a) != len(b) {
@@ -650,3 +821,33 @@ func (t *resolveMock) Close()                                   {}
 func (t *resolveMock) Bootstrap([]*discover.Node)               {}
 func (t *resolveMock) Lookup(discover.NodeID) []*discover.Node  { return nil }
 func (t *resolveMock) ReadRandomNodes(buf []*discover.Node) int { return 0 }
+func (t *resolveMock) RequestENR(*discover.Node) (*enr.Record, error) {
+	return nil, errors.New("no record")
+}
+
+// recordMock is a discovery table serving node records.
+type recordMock struct {
+	fakeTable
+	records  map[discover.NodeID]*enr.Record
+	requests map[discover.NodeID]int // nil if requests aren't counted
+}
+
+func (t *recordMock) RequestENR(n *discover.Node) (*enr.Record, error) {
+	if t.requests != nil {
+		t.requests[n.ID]++
+	}
+	if r := t.records[n.ID]; r != nil {
+		return r, nil
+	}
+	return nil, errors.New("no record")
+}
+
+// dialRecorder is a NodeDialer which records dial attempts and fails them.
+type dialRecorder struct {
+	dialed []discover.NodeID
+}
+
+func (d *dialRecorder) Dial(n *discover.Node) (net.Conn, error) {
+	d.dialed = append(d.dialed, n.ID)
+	return nil, errors.New("dial failed")
+}
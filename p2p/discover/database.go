@@ -29,6 +29,7 @@ import (
 
 	"github.com/wiseplat/go-wiseplat/crypto"
 	"github.com/wiseplat/go-wiseplat/log"
+	"github.com/wiseplat/go-wiseplat/p2p/enr"
 	"github.com/wiseplat/go-wiseplat/rlp"
 	"github.com/syndtr/goleveldb/leveldb"
 	"github.com/syndtr/goleveldb/leveldb/errors"
@@ -61,6 +62,8 @@ var (
 	nodeDBDiscoverPing      = nodeDBDiscoverRoot + ":lastping"
 	nodeDBDiscoverPong      = nodeDBDiscoverRoot + ":lastpong"
 	nodeDBDiscoverFindFails = nodeDBDiscoverRoot + ":findfail"
+
+	nodeDBLocalRecord = ":local:enr" // Last node record published by the local node
 )
 
 // newNodeDB creates a new node database for storing and retrieving infos about
@@ -199,6 +202,29 @@ func (db *nodeDB) updateNode(node *Node) error {
 	return db.lvl.Put(makeKey(node.ID, nodeDBDiscoverRoot), blob, nil)
 }
 
+// localRecord retrieves the last node record published by the local node.
+func (db *nodeDB) localRecord() *enr.Record {
+	blob, err := db.lvl.Get(makeKey(db.self, nodeDBLocalRecord), nil)
+	if err != nil {
+		return nil
+	}
+	record := new(enr.Record)
+	if err := rlp.DecodeBytes(blob, record); err != nil {
+		log.Error("Failed to decode local node record", "err", err)
+		return nil
+	}
+	return record
+}
+
+// storeLocalRecord updates the last node record published by the local node.
+func (db *nodeDB) storeLocalRecord(record *enr.Record) error {
+	blob, err := rlp.EncodeToBytes(record)
+	if err != nil {
+		return err
+	}
+	return db.lvl.Put(makeKey(db.self, nodeDBLocalRecord), blob, nil)
+}
+
 // deleteNode deletes all information/keys associated with a node.
 func (db *nodeDB) deleteNode(id NodeID) error {
 	deleter := db.lvl.NewIterator(util.BytesPrefix(makeKey(id, "")), nil)
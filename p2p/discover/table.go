@@ -35,6 +35,7 @@ import (
 	"github.com/wiseplat/go-wiseplat/common"
 	"github.com/wiseplat/go-wiseplat/crypto"
 	"github.com/wiseplat/go-wiseplat/log"
+	"github.com/wiseplat/go-wiseplat/p2p/enr"
 )
 
 const (
@@ -84,6 +85,9 @@ type transport interface {
 	ping(NodeID, *net.UDPAddr) error
 	waitping(NodeID) error
 	findnode(toid NodeID, addr *net.UDPAddr, target NodeID) ([]*Node, error)
+	requestENR(toid NodeID, addr *net.UDPAddr) (*enr.Record, error)
+	localRecord() *enr.Record
+	setRecordEntries(entries []enr.Entry) error
 	close()
 }
 
@@ -123,6 +127,29 @@ func (tab *Table) Self() *Node {
 	return tab.self
 }
 
+// Record returns the signed node record of the local node.
+func (tab *Table) Record() *enr.Record {
+	return tab.net.localRecord()
+}
+
+// SetRecordEntries updates the local node record to contain the given entries
+// in addition to the endpoint of the node. Protocols use these entries to
+// advertise information about the node before a connection is established.
+func (tab *Table) SetRecordEntries(entries ...enr.Entry) error {
+	return tab.net.setRecordEntries(entries)
+}
+
+// Ping checks that the given node is online by sending a ping packet and waiting
+// for the pong.
+func (tab *Table) Ping(n *Node) error {
+	return tab.ping(n.ID, &net.UDPAddr{IP: n.IP, Port: int(n.UDP)})
+}
+
+// RequestENR retrieves the node record of the given node.
+func (tab *Table) RequestENR(n *Node) (*enr.Record, error) {
+	return tab.net.requestENR(n.ID, &net.UDPAddr{IP: n.IP, Port: int(n.UDP)})
+}
+
 // ReadRandomNodes fills the given slice with random nodes from the
 // table. It will not write the same node more than once. The nodes in
 // the slice are copies and can be modified by the caller.
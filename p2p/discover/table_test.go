@@ -29,6 +29,7 @@ import (
 
 	"github.com/wiseplat/go-wiseplat/common"
 	"github.com/wiseplat/go-wiseplat/crypto"
+	"github.com/wiseplat/go-wiseplat/p2p/enr"
 )
 
 func TestTable_pingReplace(t *testing.T) {
@@ -160,6 +161,12 @@ func newPingRecorder() *pingRecorder {
 func (t *pingRecorder) findnode(toid NodeID, toaddr *net.UDPAddr, target NodeID) ([]*Node, error) {
 	panic("findnode called on pingRecorder")
 }
+func (t *pingRecorder) requestENR(toid NodeID, toaddr *net.UDPAddr) (*enr.Record, error) {
+	panic("requestENR called on pingRecorder")
+}
+func (t *pingRecorder) localRecord() *enr.Record                   { return nil }
+func (t *pingRecorder) setRecordEntries(entries []enr.Entry) error { return nil }
+
 func (t *pingRecorder) close() {}
 func (t *pingRecorder) waitping(from NodeID) error {
 	return nil // remote always pings
@@ -527,6 +534,12 @@ func (*preminedTestnet) close()                                      {}
 func (*preminedTestnet) waitping(from NodeID) error                  { return nil }
 func (*preminedTestnet) ping(toid NodeID, toaddr *net.UDPAddr) error { return nil }
 
+func (*preminedTestnet) requestENR(toid NodeID, toaddr *net.UDPAddr) (*enr.Record, error) {
+	return nil, errTimeout
+}
+func (*preminedTestnet) localRecord() *enr.Record                   { return nil }
+func (*preminedTestnet) setRecordEntries(entries []enr.Entry) error { return nil }
+
 // mine generates a testnet struct literal with nodes at
 // various distances to the given target.
 func (n *preminedTestnet) mine(target NodeID) {
@@ -23,10 +23,12 @@ import (
 	"errors"
 	"fmt"
 	"net"
+	"sync"
 	"time"
 
 	"github.com/wiseplat/go-wiseplat/crypto"
 	"github.com/wiseplat/go-wiseplat/log"
+	"github.com/wiseplat/go-wiseplat/p2p/enr"
 	"github.com/wiseplat/go-wiseplat/p2p/nat"
 	"github.com/wiseplat/go-wiseplat/p2p/netutil"
 	"github.com/wiseplat/go-wiseplat/rlp"
@@ -44,6 +46,7 @@ var (
 	errTimeout          = errors.New("RPC timeout")
 	errClockWarp        = errors.New("reply deadline too far in the future")
 	errClosed           = errors.New("socket closed")
+	errRecordMismatch   = errors.New("node record doesn't match node ID")
 )
 
 // Timeouts
@@ -63,6 +66,8 @@ const (
 	pongPacket
 	findnodePacket
 	neighborsPacket
+	enrRequestPacket
+	enrResponsePacket
 )
 
 // RPC request structures
@@ -104,6 +109,21 @@ type (
 		Rest []rlp.RawValue `rlp:"tail"`
 	}
 
+	// enrRequest queries for the remote node's record.
+	enrRequest struct {
+		Expiration uint64
+		// Ignore additional fields (for forward compatibility).
+		Rest []rlp.RawValue `rlp:"tail"`
+	}
+
+	// enrResponse is the reply to enrRequest.
+	enrResponse struct {
+		ReplyTok []byte // Hash of the enrRequest packet.
+		Record   enr.Record
+		// Ignore additional fields (for forward compatibility).
+		Rest []rlp.RawValue `rlp:"tail"`
+	}
+
 	rpcNode struct {
 		IP  net.IP // len 4 for IPv4 or 16 for IPv6
 		UDP uint16 // for discovery protocol
@@ -170,6 +190,9 @@ type udp struct {
 	closing chan struct{}
 	nat     nat.Interface
 
+	recordMu sync.Mutex
+	record   *enr.Record // signed record of the local node
+
 	*Table
 }
 
@@ -254,6 +277,9 @@ func newUDP(priv *ecdsa.PrivateKey, c conn, natm nat.Interface, nodeDBPath strin
 		return nil, nil, err
 	}
 	udp.Table = tab
+	if err := udp.setRecordEntries(nil); err != nil {
+		return nil, nil, err
+	}
 
 	go udp.loop()
 	go udp.readLoop()
@@ -309,6 +335,97 @@ func (t *udp) findnode(toid NodeID, toaddr *net.UDPAddr, target NodeID) ([]*Node
 	return nodes, err
 }
 
+// requestENR sends an ENR request to the given node and waits for the response.
+// The returned record is verified to belong to the node.
+func (t *udp) requestENR(toid NodeID, toaddr *net.UDPAddr) (*enr.Record, error) {
+	packet, err := encodePacket(t.priv, enrRequestPacket, &enrRequest{
+		Expiration: uint64(time.Now().Add(expiration).Unix()),
+	})
+	if err != nil {
+		return nil, err
+	}
+	var (
+		hash   = packet[:macSize]
+		record *enr.Record
+	)
+	errc := t.pending(toid, enrResponsePacket, func(r interface{}) bool {
+		reply := r.(*enrResponse)
+		if !bytes.Equal(reply.ReplyTok, hash) {
+			return false
+		}
+		record = &reply.Record
+		return true
+	})
+	t.write(toaddr, "ENRREQUEST/v4", packet)
+	if err := <-errc; err != nil {
+		return nil, err
+	}
+	var pubkey enr.Secp256k1
+	if err := record.Load(&pubkey); err != nil {
+		return nil, err
+	}
+	if PubkeyID((*ecdsa.PublicKey)(&pubkey)) != toid {
+		return nil, errRecordMismatch
+	}
+	return record, nil
+}
+
+// localRecord returns the signed record of the local node.
+func (t *udp) localRecord() *enr.Record {
+	t.recordMu.Lock()
+	defer t.recordMu.Unlock()
+	return t.record
+}
+
+// setRecordEntries signs a new record of the local node containing its endpoint
+// and the given additional entries. The sequence number of the record is only
+// increased if its content differs from the last published record.
+func (t *udp) setRecordEntries(entries []enr.Entry) error {
+	t.recordMu.Lock()
+	defer t.recordMu.Unlock()
+
+	var seq uint64
+	last := t.db.localRecord()
+	if last != nil {
+		seq = last.Seq()
+	}
+	record, err := t.makeRecord(seq, entries)
+	if err != nil {
+		return err
+	}
+	if last == nil || !sameRecord(record, last) {
+		if record, err = t.makeRecord(seq+1, entries); err != nil {
+			return err
+		}
+		if err := t.db.storeLocalRecord(record); err != nil {
+			return err
+		}
+	}
+	t.record = record
+	return nil
+}
+
+func (t *udp) makeRecord(seq uint64, entries []enr.Entry) (*enr.Record, error) {
+	record := new(enr.Record)
+	record.SetSeq(seq)
+	record.Set(enr.IP(t.ourEndpoint.IP))
+	record.Set(enr.UDP(t.ourEndpoint.UDP))
+	record.Set(enr.TCP(t.ourEndpoint.TCP))
+	for _, e := range entries {
+		record.Set(e)
+	}
+	if err := record.Sign(t.priv); err != nil {
+		return nil, err
+	}
+	return record, nil
+}
+
+func sameRecord(a, b *enr.Record) bool {
+	enca, _ := rlp.EncodeToBytes(a)
+	encb, _ := rlp.EncodeToBytes(b)
+	return bytes.Equal(enca, encb)
+}
+
 // pending adds a reply callback to the pending reply queue.
 // see the documentation of type pending for a detailed explanation.
 func (t *udp) pending(id NodeID, ptype byte, callback func(interface{}) bool) <-chan error {
@@ -464,8 +581,12 @@ func (t *udp) send(toaddr *net.UDPAddr, ptype byte, req packet) error {
 	if err != nil {
 		return err
 	}
-	_, err = t.conn.WriteToUDP(packet, toaddr)
-	log.Trace(">> "+req.name(), "addr", toaddr, "err", err)
+	return t.write(toaddr, req.name(), packet)
+}
+
+func (t *udp) write(toaddr *net.UDPAddr, what string, packet []byte) error {
+	_, err := t.conn.WriteToUDP(packet, toaddr)
+	log.Trace(">> "+what, "addr", toaddr, "err", err)
 	return err
 }
 
@@ -547,6 +668,10 @@ func decodePacket(buf []byte) (packet, NodeID, []byte, error) {
 		req = new(findnode)
 	case neighborsPacket:
 		req = new(neighbors)
+	case enrRequestPacket:
+		req = new(enrRequest)
+	case enrResponsePacket:
+		req = new(enrResponse)
 	default:
 		return nil, fromID, hash, fmt.Errorf("unknown type: %d", ptype)
 	}
@@ -634,6 +759,33 @@ func (req *neighbors) handle(t *udp, from *net.UDPAddr, fromID NodeID, mac []byt
 
 func (req *neighbors) name() string { return "NEIGHBORS/v4" }
 
+func (req *enrRequest) handle(t *udp, from *net.UDPAddr, fromID NodeID, mac []byte) error {
+	if expired(req.Expiration) {
+		return errExpired
+	}
+	if t.db.node(fromID) == nil {
+		// No bond exists, we don't process the packet. The response is bigger
+		// than the request, see findnode.
+		return errUnknownNode
+	}
+	t.send(from, enrResponsePacket, &enrResponse{
+		ReplyTok: mac,
+		Record:   *t.localRecord(),
+	})
+	return nil
+}
+
+func (req *enrRequest) name() string { return "ENRREQUEST/v4" }
+
+func (req *enrResponse) handle(t *udp, from *net.UDPAddr, fromID NodeID, mac []byte) error {
+	if !t.handleReply(fromID, enrResponsePacket, req) {
+		return errUnsolicitedReply
+	}
+	return nil
+}
+
+func (req *enrResponse) name() string { return "ENRRESPONSE/v4" }
+
 func expired(ts uint64) bool {
 	return time.Unix(int64(ts), 0).Before(time.Now())
 }
@@ -36,6 +36,7 @@ import (
 	"github.com/davecgh/go-spew/spew"
 	"github.com/wiseplat/go-wiseplat/common"
 	"github.com/wiseplat/go-wiseplat/crypto"
+	"github.com/wiseplat/go-wiseplat/p2p/enr"
 	"github.com/wiseplat/go-wiseplat/rlp"
 )
 
@@ -126,6 +127,8 @@ func TestUDP_packetErrors(t *testing.T) {
 	test.packetIn(errUnsolicitedReply, pongPacket, &pong{ReplyTok: []byte{}, Expiration: futureExp})
 	test.packetIn(errUnknownNode, findnodePacket, &findnode{Expiration: futureExp})
 	test.packetIn(errUnsolicitedReply, neighborsPacket, &neighbors{Expiration: futureExp})
+	test.packetIn(errUnknownNode, enrRequestPacket, &enrRequest{Expiration: futureExp})
+	test.packetIn(errUnsolicitedReply, enrResponsePacket, &enrResponse{Record: signedRecord(test.remotekey)})
 }
 
 func TestUDP_pingTimeout(t *testing.T) {
@@ -323,6 +326,91 @@ func TestUDP_findnodeMultiReply(t *testing.T) {
 	}
 }
 
+func TestUDP_enrRequest(t *testing.T) {
+	test := newUDPTest(t)
+	defer test.table.Close()
+
+	if err := test.table.SetRecordEntries(enr.WithEntry("foo", "bar")); err != nil {
+		t.Fatal(err)
+	}
+	// ensure there's a bond with the test node,
+	// the request won't be accepted otherwise.
+	test.table.db.updateNode(NewNode(
+		PubkeyID(&test.remotekey.PublicKey),
+		test.remoteaddr.IP,
+		uint16(test.remoteaddr.Port),
+		99,
+	))
+	test.packetIn(nil, enrRequestPacket, &enrRequest{Expiration: futureExp})
+	test.waitPacketOut(func(p *enrResponse) {
+		if !bytes.Equal(p.ReplyTok, test.sent[0][:macSize]) {
+			t.Errorf("wrong reply token %x", p.ReplyTok)
+		}
+		var foo string
+		if err := p.Record.Load(enr.WithEntry("foo", &foo)); err != nil || foo != "bar" {
+			t.Errorf("wrong protocol entry %q (err %v)", foo, err)
+		}
+		var udp enr.UDP
+		if err := p.Record.Load(&udp); err != nil || uint16(udp) != test.udp.ourEndpoint.UDP {
+			t.Errorf("wrong UDP port %d (err %v)", udp, err)
+		}
+		if p.Record.Seq() != test.table.Record().Seq() {
+			t.Errorf("wrong record seq %d", p.Record.Seq())
+		}
+	})
+
+	// The sequence number only changes with the content of the record.
+	seq := test.table.Record().Seq()
+	test.table.SetRecordEntries(enr.WithEntry("foo", "bar"))
+	if test.table.Record().Seq() != seq {
+		t.Errorf("seq changed for unmodified record")
+	}
+	test.table.SetRecordEntries(enr.WithEntry("foo", "baz"))
+	if test.table.Record().Seq() != seq+1 {
+		t.Errorf("seq not incremented for modified record")
+	}
+}
+
+func TestUDP_requestENR(t *testing.T) {
+	test := newUDPTest(t)
+	defer test.table.Close()
+
+	var (
+		remoteID = PubkeyID(&test.remotekey.PublicKey)
+		record   *enr.Record
+		errc     = make(chan error, 1)
+	)
+	go func() {
+		var err error
+		record, err = test.udp.requestENR(remoteID, test.remoteaddr)
+		errc <- err
+	}()
+	dgram := test.pipe.waitPacketOut()
+	if p, _, _, err := decodePacket(dgram); err != nil {
+		t.Fatal(err)
+	} else if _, ok := p.(*enrRequest); !ok {
+		t.Fatalf("sent packet type mismatch, got: %T", p)
+	}
+	// Replies to other requests are ignored.
+	test.packetIn(nil, enrResponsePacket, &enrResponse{ReplyTok: []byte{1}, Record: signedRecord(test.remotekey)})
+	test.packetIn(nil, enrResponsePacket, &enrResponse{ReplyTok: dgram[:macSize], Record: signedRecord(test.remotekey)})
+	if err := <-errc; err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(record.NodeAddr(), crypto.Keccak256(remoteID[:])) {
+		t.Errorf("wrong record returned")
+	}
+}
+
+func signedRecord(key *ecdsa.PrivateKey) enr.Record {
+	var r enr.Record
+	r.Set(enr.UDP(30303))
+	if err := r.Sign(key); err != nil {
+		panic(err)
+	}
+	return r
+}
+
 func TestUDP_successfulPing(t *testing.T) {
 	test := newUDPTest(t)
 	added := make(chan *Node, 1)
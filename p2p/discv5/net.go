@@ -578,7 +578,7 @@ loop:
 				return n.pingEcho
 			}, func(n *Node, topic Topic) []byte {
 				if n.state == known {
-					return net.conn.send(n, topicQueryPacket, topicQuery{Topic: topic}) // TODO: set expiration
+					return net.conn.send(n, topicQueryPacket, &topicQuery{Topic: topic}) // TODO: set expiration
 				} else {
 					if n.state == unknown {
 						net.ping(n, n.addr())
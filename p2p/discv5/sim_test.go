@@ -186,6 +186,64 @@ func TestSimTopicHierarchy(t *testing.T) {
 	sim.shutdown()
 }
 
+// In this test, every tenth node of a 200 node network registers a light server
+// topic. The servers have to wait for their tickets before registering, after
+// which the other nodes of the network can be asked for them.
+func TestSimLightServerRegistration(t *testing.T) {
+	if runWithPlaygroundTime(t) {
+		return
+	}
+	const (
+		nodeCount   = 200
+		serverEvery = 10
+		wantServers = 10
+		topic       = Topic("LES2@0123456789abcdef")
+	)
+	sim := newSimulation()
+	defer sim.shutdown()
+	bootnode := sim.launchNode(false)
+
+	stop := make(chan struct{})
+	defer close(stop)
+
+	var nets []*Network
+	servers := make(map[NodeID]bool)
+	for i := 0; i < nodeCount; i++ {
+		net := sim.launchNode(false)
+		if err := net.SetFallbackNodes([]*Node{bootnode.Self()}); err != nil {
+			t.Fatalf("failed to set fallback nodes: %v", err)
+		}
+		nets = append(nets, net)
+		if i%serverEvery == 0 {
+			servers[net.Self().ID] = true
+			go net.RegisterTopic(topic, stop)
+		}
+	}
+	// Collect the registrations from the topic tables of the other nodes, the
+	// servers answering for themselves doesn't count.
+	registered := make(map[NodeID]bool)
+	for start := time.Now(); len(registered) < wantServers; {
+		if time.Since(start) > 30*time.Minute {
+			t.Fatalf("only %d of %d servers registered", len(registered), wantServers)
+		}
+		time.Sleep(10 * time.Second)
+
+		for _, net := range nets {
+			if servers[net.Self().ID] {
+				continue
+			}
+			net.reqTableOp(func() {
+				for _, n := range net.topictab.getEntries(topic) {
+					if !servers[n.ID] {
+						t.Errorf("node %x registered without advertising the topic", n.ID[:8])
+					}
+					registered[n.ID] = true
+				}
+			})
+		}
+	}
+}
+
 func randomResolves(t *testing.T, s *simulation, net *Network) {
 	randtime := func() time.Duration {
 		return time.Duration(rand.Intn(50)+20) * time.Second
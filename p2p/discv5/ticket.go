@@ -532,11 +532,17 @@ func (s *ticketStore) addTicket(localTime mclock.AbsTime, pingHash []byte, t *ti
 	}
 	s.adjustWithTicket(localTime, lastReq.lookup.target, t)
 
-	if lastReq.lookup.radiusLookup || s.nodes[t.node] != nil {
+	topic := lastReq.lookup.topic
+	if s.nodes[t.node] != nil {
+		return
+	}
+	// Tickets from radius lookups are also used until the radius has converged
+	// (at the regular collection rate), so the registration doesn't have to wait
+	// for the estimation, which can take very long or never end in small networks.
+	if lastReq.lookup.radiusLookup && (s.radius[topic].converged || !s.needMoreTickets(topic)) {
 		return
 	}
 
-	topic := lastReq.lookup.topic
 	topicIdx := t.findIdx(topic)
 	if topicIdx == -1 {
 		return
@@ -0,0 +1,304 @@
+// Copyright 2018 The go-wiseplat Authors
+// This file is part of the go-wiseplat library.
+//
+// The go-wiseplat library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-wiseplat library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-wiseplat library. If not, see <http://www.gnu.org/licenses/>.
+
+// Package dnsdisc implements node discovery via DNS based node lists. A list is
+// a signed merkle tree of enode URLs and links to other lists, published in DNS
+// TXT records in the style of EIP-1459.
+package dnsdisc
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/golang-lru"
+	"github.com/wiseplat/go-wiseplat/log"
+	"github.com/wiseplat/go-wiseplat/p2p/discover"
+)
+
+// maxLinkedTrees is the maximum number of trees synced by a client, including
+// the ones reached through links.
+const maxLinkedTrees = 64
+
+// Config holds configuration options for the DNS discovery client.
+type Config struct {
+	Timeout         time.Duration // timeout used for DNS lookups (default 5s)
+	RecheckInterval time.Duration // time between tree root update checks (default 30min)
+	CacheLimit      int           // maximum number of cached records (default 1000)
+	Resolver        Resolver      // the DNS resolver to use (defaults to system DNS)
+	Logger          log.Logger    // destination of client log messages (defaults to root logger)
+}
+
+// Resolver is a DNS resolver that can query TXT records.
+type Resolver interface {
+	LookupTXT(ctx context.Context, domain string) ([]string, error)
+}
+
+func (cfg Config) withDefaults() Config {
+	if cfg.Timeout == 0 {
+		cfg.Timeout = 5 * time.Second
+	}
+	if cfg.RecheckInterval == 0 {
+		cfg.RecheckInterval = 30 * time.Minute
+	}
+	if cfg.CacheLimit == 0 {
+		cfg.CacheLimit = 1000
+	}
+	if cfg.Resolver == nil {
+		cfg.Resolver = new(net.Resolver)
+	}
+	if cfg.Logger == nil {
+		cfg.Logger = log.Root()
+	}
+	return cfg
+}
+
+// Client discovers nodes by querying DNS servers. Besides syncing single trees
+// on demand, it can keep the trees of a set of URLs (and the ones linked from
+// them) synced in the background and serve their nodes as dial candidates.
+type Client struct {
+	cfg     Config
+	entries *lru.Cache
+	urls    []string
+
+	mu    sync.Mutex
+	trees map[string][]*discover.Node // nodes of the synced trees by URL
+	nodes []*discover.Node            // nodes of all synced trees, deduplicated
+
+	quit chan struct{}
+	wg   sync.WaitGroup
+}
+
+// NewClient creates a client for the given tree URLs.
+func NewClient(cfg Config, urls ...string) (*Client, error) {
+	cfg = cfg.withDefaults()
+	for _, url := range urls {
+		if _, err := parseLink(url); err != nil {
+			return nil, fmt.Errorf("invalid enrtree URL %q: %v", url, err)
+		}
+	}
+	cache, err := lru.New(cfg.CacheLimit)
+	if err != nil {
+		return nil, err
+	}
+	return &Client{
+		cfg:     cfg,
+		entries: cache,
+		urls:    urls,
+		trees:   make(map[string][]*discover.Node),
+		quit:    make(chan struct{}),
+	}, nil
+}
+
+// Start launches the background sync of the configured trees.
+func (c *Client) Start() {
+	c.wg.Add(1)
+	go c.loop()
+}
+
+// Close terminates the background sync.
+func (c *Client) Close() {
+	close(c.quit)
+	c.wg.Wait()
+}
+
+// SyncTree downloads the entire tree at the given URL and verifies it.
+func (c *Client) SyncTree(url string) (*Tree, error) {
+	le, err := parseLink(url)
+	if err != nil {
+		return nil, fmt.Errorf("invalid enrtree URL: %v", err)
+	}
+	root, err := c.resolveRoot(le)
+	if err != nil {
+		return nil, err
+	}
+	t := &Tree{root: root, entries: make(map[string]entry)}
+	if err := c.syncSubtree(le.domain, root.eroot, false, t); err != nil {
+		return nil, err
+	}
+	if err := c.syncSubtree(le.domain, root.lroot, true, t); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// ReadRandomNodes fills the given slice with random nodes of the synced trees
+// and returns the number of nodes written. It never waits for network activity.
+func (c *Client) ReadRandomNodes(buf []*discover.Node) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	n := 0
+	for _, i := range rand.Perm(len(c.nodes)) {
+		if n == len(buf) {
+			break
+		}
+		buf[n] = c.nodes[i]
+		n++
+	}
+	return n
+}
+
+// loop periodically syncs all configured trees.
+func (c *Client) loop() {
+	defer c.wg.Done()
+
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	for {
+		select {
+		case <-timer.C:
+			c.syncAll()
+			timer.Reset(c.cfg.RecheckInterval)
+		case <-c.quit:
+			return
+		}
+	}
+}
+
+// syncAll syncs the configured trees and the trees linked from them. The nodes of
+// trees failing to sync are kept from their last successful sync.
+func (c *Client) syncAll() {
+	var (
+		queue = append([]string{}, c.urls...)
+		seen  = make(map[string]bool)
+	)
+	for len(queue) > 0 && len(seen) < maxLinkedTrees {
+		select {
+		case <-c.quit:
+			return
+		default:
+		}
+		url := queue[0]
+		queue = queue[1:]
+		if seen[url] {
+			continue
+		}
+		seen[url] = true
+
+		t, err := c.SyncTree(url)
+		if err != nil {
+			c.cfg.Logger.Debug("Failed to sync DNS node tree", "url", url, "err", err)
+			continue
+		}
+		c.cfg.Logger.Trace("Synced DNS node tree", "url", url, "seq", t.Seq(), "nodes", len(t.Nodes()))
+		queue = append(queue, t.Links()...)
+
+		c.mu.Lock()
+		c.trees[url] = t.Nodes()
+		c.mu.Unlock()
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	known := make(map[discover.NodeID]bool)
+	c.nodes = c.nodes[:0]
+	for _, nodes := range c.trees {
+		for _, n := range nodes {
+			if !known[n.ID] {
+				known[n.ID] = true
+				c.nodes = append(c.nodes, n)
+			}
+		}
+	}
+}
+
+// syncSubtree retrieves the entry with the given hash and all of its children.
+func (c *Client) syncSubtree(domain, hash string, link bool, t *Tree) error {
+	e, err := c.resolveEntry(domain, hash)
+	if err != nil {
+		return err
+	}
+	t.entries[hash] = e
+
+	switch e := e.(type) {
+	case *branchEntry:
+		for _, child := range e.children {
+			if err := c.syncSubtree(domain, child, link, t); err != nil {
+				return err
+			}
+		}
+	case *nodeEntry:
+		if link {
+			return nameError{hash + "." + domain, errNodeInLinkTree}
+		}
+	case *linkEntry:
+		if !link {
+			return nameError{hash + "." + domain, errLinkInNodeTree}
+		}
+	}
+	return nil
+}
+
+// resolveRoot retrieves the root entry of a tree and verifies its signature.
+func (c *Client) resolveRoot(le *linkEntry) (*rootEntry, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), c.cfg.Timeout)
+	defer cancel()
+
+	txts, err := c.cfg.Resolver.LookupTXT(ctx, le.domain)
+	if err != nil {
+		return nil, err
+	}
+	for _, txt := range txts {
+		if !strings.HasPrefix(txt, rootPrefix) {
+			continue
+		}
+		root, err := parseRoot(txt)
+		if err != nil {
+			return nil, nameError{le.domain, err}
+		}
+		if !root.verifySignature(le.pubkey) {
+			return nil, nameError{le.domain, errBadSignature}
+		}
+		return root, nil
+	}
+	return nil, nameError{le.domain, errNoRoot}
+}
+
+// resolveEntry retrieves an entry from the cache or fetches it from the network
+// if it isn't cached.
+func (c *Client) resolveEntry(domain, hash string) (entry, error) {
+	if e, ok := c.entries.Get(hash); ok {
+		return e.(entry), nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), c.cfg.Timeout)
+	defer cancel()
+
+	name := hash + "." + domain
+	txts, err := c.cfg.Resolver.LookupTXT(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	for _, txt := range txts {
+		e, err := parseEntry(txt)
+		if err == errUnknownEntry {
+			continue
+		}
+		if err != nil {
+			return nil, nameError{name, err}
+		}
+		if !strings.EqualFold(hashTXT(txt), hash) {
+			return nil, nameError{name, errHashMismatch}
+		}
+		c.entries.Add(hash, e)
+		return e, nil
+	}
+	return nil, nameError{name, errNoEntry}
+}
@@ -0,0 +1,193 @@
+// Copyright 2018 The go-wiseplat Authors
+// This file is part of the go-wiseplat library.
+//
+// The go-wiseplat library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-wiseplat library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-wiseplat library. If not, see <http://www.gnu.org/licenses/>.
+
+package dnsdisc
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"errors"
+	"net"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/wiseplat/go-wiseplat/crypto"
+	"github.com/wiseplat/go-wiseplat/p2p/discover"
+)
+
+// Tests that a signed tree can be synced and verified.
+func TestClientSyncTree(t *testing.T) {
+	key := testKey()
+	nodes := testNodes(0, 40)
+	tree, url := makeTestTree(t, key, "n", nodes, nil)
+
+	r := mapResolver(tree.ToTXT("n"))
+	c, _ := NewClient(Config{Resolver: r})
+	synced, err := c.SyncTree(url)
+	if err != nil {
+		t.Fatal("sync error:", err)
+	}
+	if !reflect.DeepEqual(synced.Nodes(), sortedNodes(nodes)) {
+		t.Errorf("wrong nodes in synced tree")
+	}
+	if synced.Seq() != tree.Seq() || synced.Signature() != tree.Signature() {
+		t.Errorf("synced root mismatch: seq %d sig %s", synced.Seq(), synced.Signature())
+	}
+}
+
+// Tests that trees with invalid signatures or missing entries are rejected.
+func TestClientSyncTreeErrors(t *testing.T) {
+	key := testKey()
+	tree, url := makeTestTree(t, key, "n", testNodes(0, 20), nil)
+
+	// Signature by another key.
+	other, _ := crypto.GenerateKey()
+	otherURL := (&linkEntry{domain: "n", pubkey: &other.PublicKey}).String()
+	c, _ := NewClient(Config{Resolver: mapResolver(tree.ToTXT("n"))})
+	if _, err := c.SyncTree(otherURL); !isError(err, errBadSignature) {
+		t.Errorf("wrong error for bad signature: %v", err)
+	}
+	// Missing entry.
+	records := tree.ToTXT("n")
+	for name := range records {
+		if name != "n" {
+			delete(records, name)
+			break
+		}
+	}
+	c, _ = NewClient(Config{Resolver: mapResolver(records)})
+	if _, err := c.SyncTree(url); err == nil {
+		t.Errorf("no error for missing entry")
+	}
+	// Tampered entry.
+	records = tree.ToTXT("n")
+	for name, txt := range records {
+		if name != "n" && bytes.HasPrefix([]byte(txt), []byte(nodePrefix)) {
+			records[name] = testNodes(100, 1)[0].String()
+			break
+		}
+	}
+	c, _ = NewClient(Config{Resolver: mapResolver(records)})
+	if _, err := c.SyncTree(url); !isError(err, errHashMismatch) {
+		t.Errorf("wrong error for tampered entry: %v", err)
+	}
+}
+
+// Tests that the background sync follows links and serves the nodes of all
+// reachable trees.
+func TestClientBackgroundSync(t *testing.T) {
+	var (
+		key1, key2 = testKey(), testKey()
+		nodes1     = testNodes(0, 10)
+		nodes2     = testNodes(10, 10)
+	)
+	tree2, url2 := makeTestTree(t, key2, "b", nodes2, nil)
+	tree1, url1 := makeTestTree(t, key1, "a", nodes1, []string{url2})
+
+	r := mapResolver(tree1.ToTXT("a"))
+	r.add(tree2.ToTXT("b"))
+	c, err := NewClient(Config{Resolver: r}, url1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := c.ReadRandomNodes(make([]*discover.Node, 10)); n != 0 {
+		t.Fatalf("nodes available before sync: %d", n)
+	}
+	c.Start()
+	defer c.Close()
+
+	buf := make([]*discover.Node, 30)
+	for i := 0; ; i++ {
+		n := c.ReadRandomNodes(buf)
+		if n == len(nodes1)+len(nodes2) {
+			buf = buf[:n]
+			break
+		}
+		if i == 100 {
+			t.Fatalf("background sync incomplete: have %d nodes", n)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if !reflect.DeepEqual(sortedNodes(buf), sortedNodes(append(nodes1, nodes2...))) {
+		t.Fatalf("wrong nodes served")
+	}
+}
+
+func makeTestTree(t *testing.T, key *ecdsa.PrivateKey, domain string, nodes []*discover.Node, links []string) (*Tree, string) {
+	tree, err := MakeTree(1, nodes, links)
+	if err != nil {
+		t.Fatal(err)
+	}
+	url, err := tree.Sign(key, domain)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tree, url
+}
+
+func testKey() *ecdsa.PrivateKey {
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		panic(err)
+	}
+	return key
+}
+
+// testNodes creates n nodes with deterministic addresses.
+func testNodes(seed byte, n int) []*discover.Node {
+	nodes := make([]*discover.Node, n)
+	for i := range nodes {
+		id := discover.PubkeyID(&testKey().PublicKey)
+		ip := net.IP{10, seed, byte(i >> 8), byte(i)}
+		nodes[i] = discover.NewNode(id, ip, 30303, 30303)
+	}
+	return nodes
+}
+
+func sortedNodes(nodes []*discover.Node) []*discover.Node {
+	sorted := make([]*discover.Node, len(nodes))
+	copy(sorted, nodes)
+	sort.Slice(sorted, func(i, j int) bool {
+		return bytes.Compare(sorted[i].ID[:], sorted[j].ID[:]) < 0
+	})
+	return sorted
+}
+
+func isError(err, target error) bool {
+	if ne, ok := err.(nameError); ok {
+		err = ne.err
+	}
+	return err == target
+}
+
+// mapResolver is an in-process resolver serving the given records.
+type mapResolver map[string]string
+
+func (mr mapResolver) add(records map[string]string) {
+	for name, txt := range records {
+		mr[name] = txt
+	}
+}
+
+func (mr mapResolver) LookupTXT(ctx context.Context, name string) ([]string, error) {
+	if record, ok := mr[name]; ok {
+		return []string{record}, nil
+	}
+	return nil, errors.New("not found")
+}
@@ -0,0 +1,125 @@
+// Copyright 2018 The go-wiseplat Authors
+// This file is part of the go-wiseplat library.
+//
+// The go-wiseplat library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-wiseplat library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-wiseplat library. If not, see <http://www.gnu.org/licenses/>.
+
+package dnsdisc
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/wiseplat/go-wiseplat/crypto"
+)
+
+func TestParseRoot(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	root := &rootEntry{eroot: "QFT4PBCRX4XQCV3VUYJ6BTCEPU", lroot: "JGUFMSAGI7KZYB3P7IZW4S5Y3A", seq: 3}
+	root.sig, _ = crypto.Sign(root.sigHash(), key)
+
+	tests := []struct {
+		input string
+		e     *rootEntry
+		err   error
+	}{
+		{
+			input: "enrtree-root:v1 e=TO4Q75OQ2N7DX4EOOR7X66A6OM seq=3 sig=N-YY6UB9xD0hFx1Gmnt7v0RfSxch5tKyry2SRDoLx7B4GfPXagwLxQqyf7gAMvApFn_ORwZQekMWa_pXrcGCtw",
+			err:   entryError{"root", errSyntax},
+		},
+		{
+			input: "enrtree-root:v1 e=TO4Q75OQ2N7DX4EOOR7X66A6OM l=TO4Q75OQ2N7DX4EOOR7X66A6OM seq=3 sig=N-YY6UB9xD0hFx1Gmnt7v0RfSxch5tKyry2SRDoLx7B4GfPXagwLxQqyf7gAMvApFn_ORwZQekMWa_pXrcGCtw",
+			err:   entryError{"root", errInvalidSig},
+		},
+		{
+			input: root.String(),
+			e:     root,
+		},
+	}
+	for i, test := range tests {
+		e, err := parseRoot(test.input)
+		if !reflect.DeepEqual(e, test.e) {
+			t.Errorf("test %d: wrong entry %+v, want %+v", i, e, test.e)
+		}
+		if err != test.err {
+			t.Errorf("test %d: wrong error %q, want %q", i, err, test.err)
+		}
+	}
+}
+
+func TestParseEntry(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	link := (&linkEntry{domain: "nodes.example.org", pubkey: &key.PublicKey}).String()
+
+	tests := []struct {
+		input string
+		err   error
+	}{
+		// Branches.
+		{input: "enrtree-branch:"},
+		{input: "enrtree-branch:AAAAAAAAAAAAAAAAAAAA"},
+		{input: "enrtree-branch:AAAAAAAAAAAAAAAAAAAA,BBBBBBBBBBBBBBBBBBBB"},
+		{input: "enrtree-branch:AAAAAAAAAAAAAAAAAAAA,,", err: entryError{"branch", errInvalidChild}},
+		{input: "enrtree-branch:!!!!!!!!!!!!!!!!!!!!", err: entryError{"branch", errInvalidChild}},
+		// Links.
+		{input: link},
+		{input: "enrtree://nodes.example.org", err: entryError{"link", errNoPubkey}},
+		{input: "enrtree://AP62DT7WOTEQZGQZOU474PP3KMEGVTTE7A7NPRXKX3DUD57@nodes.example.org", err: entryError{"link", errBadPubkey}},
+		// Nodes.
+		{input: "enode://1dd9d65c4552b5eb43d5ad55a2ee3f56c6cbc1c64a5c8d659f51fcd51bace24351232b8d7821617d2b29b54b81cdefb9b3e9c37d7fd5f63270bcc9e1a6f6a439@127.0.0.1:30303"},
+		{input: "enode://1dd9d65c4552b5eb43d5ad55a2ee3f56c6cbc1c64a5c8d659f51fcd51bace24351232b8d7821617d2b29b54b81cdefb9b3e9c37d7fd5f63270bcc9e1a6f6a439", err: entryError{"node", errInvalidNode}},
+		// Invalid type.
+		{input: "arbitrary text", err: errUnknownEntry},
+	}
+	for i, test := range tests {
+		e, err := parseEntry(test.input)
+		if err != test.err {
+			t.Errorf("test %d: wrong error %q, want %q", i, err, test.err)
+			continue
+		}
+		if err == nil && e.String() != test.input {
+			t.Errorf("test %d: entry does not round-trip: %q", i, e.String())
+		}
+	}
+}
+
+func TestParseURL(t *testing.T) {
+	for i := 0; i < 20; i++ {
+		key, _ := crypto.GenerateKey()
+		url := (&linkEntry{domain: "nodes.example.org", pubkey: &key.PublicKey}).String()
+		domain, pub, err := ParseURL(url)
+		if err != nil {
+			t.Fatalf("failed to parse URL %q: %v", url, err)
+		}
+		if domain != "nodes.example.org" || pub.X.Cmp(key.X) != 0 || pub.Y.Cmp(key.Y) != 0 {
+			t.Fatalf("URL round-trip mismatch: domain %q", domain)
+		}
+	}
+}
+
+func TestMakeTree(t *testing.T) {
+	nodes := testNodes(0, 50)
+	tree, err := MakeTree(2, nodes, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(tree.Nodes(), sortedNodes(nodes)) {
+		t.Fatal("tree nodes mismatch")
+	}
+	// All branches must fit the child limit.
+	for _, e := range tree.entries {
+		if b, ok := e.(*branchEntry); ok && len(b.children) > maxChildren {
+			t.Fatalf("branch with %d children", len(b.children))
+		}
+	}
+}
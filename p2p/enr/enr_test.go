@@ -0,0 +1,342 @@
+// Copyright 2018 The go-wiseplat Authors
+// This file is part of the go-wiseplat library.
+//
+// The go-wiseplat library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-wiseplat library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-wiseplat library. If not, see <http://www.gnu.org/licenses/>.
+
+package enr
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/wiseplat/go-wiseplat/crypto"
+	"github.com/wiseplat/go-wiseplat/rlp"
+)
+
+var (
+	privkey, _ = crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+	pubkey     = &privkey.PublicKey
+)
+
+var rnd = rand.New(rand.NewSource(time.Now().UnixNano()))
+
+func randomString(strlen int) string {
+	b := make([]byte, strlen)
+	rnd.Read(b)
+	return string(b)
+}
+
+// TestGetSetID tests encoding/decoding and setting/getting of the ID key.
+func TestGetSetID(t *testing.T) {
+	id := ID("someid")
+	var r Record
+	r.Set(id)
+
+	var id2 ID
+	if err := r.Load(&id2); err != nil {
+		t.Fatal(err)
+	}
+	if id != id2 {
+		t.Fatalf("ID mismatch: have %q, want %q", id2, id)
+	}
+}
+
+// TestGetSetIP tests encoding/decoding and setting/getting of the IP key.
+func TestGetSetIP(t *testing.T) {
+	for _, ip := range []IP{IP(net.ParseIP("192.168.0.3")), IP(net.ParseIP("2001::1"))} {
+		var r Record
+		r.Set(ip)
+
+		var ip2 IP
+		if err := r.Load(&ip2); err != nil {
+			t.Fatal(err)
+		}
+		if !net.IP(ip).Equal(net.IP(ip2)) {
+			t.Fatalf("IP mismatch: have %v, want %v", ip2, ip)
+		}
+	}
+}
+
+// TestGetSetUDP tests encoding/decoding and setting/getting of the UDP key.
+func TestGetSetUDP(t *testing.T) {
+	port := UDP(30309)
+	var r Record
+	r.Set(port)
+
+	var port2 UDP
+	if err := r.Load(&port2); err != nil {
+		t.Fatal(err)
+	}
+	if port != port2 {
+		t.Fatalf("UDP port mismatch: have %d, want %d", port2, port)
+	}
+}
+
+// TestGetSetSecp256k1 tests encoding/decoding and setting/getting of the Secp256k1 key.
+func TestGetSetSecp256k1(t *testing.T) {
+	var r Record
+	if err := r.Sign(privkey); err != nil {
+		t.Fatal(err)
+	}
+
+	var pk Secp256k1
+	if err := r.Load(&pk); err != nil {
+		t.Fatal(err)
+	}
+	if pk.X.Cmp(pubkey.X) != 0 || pk.Y.Cmp(pubkey.Y) != 0 {
+		t.Fatalf("public key mismatch")
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	var r Record
+	ip4 := IP{127, 0, 0, 1}
+	r.Set(ip4)
+
+	// Check error for missing keys.
+	var udp UDP
+	err := r.Load(&udp)
+	if !IsNotFound(err) {
+		t.Error("IsNotFound should return true for missing key")
+	}
+	if err.Error() != `missing ENR key "udp"` {
+		t.Errorf("wrong error for missing key: %v", err)
+	}
+
+	// Check error for invalid keys.
+	var list []uint
+	err = r.Load(WithEntry(ip4.ENRKey(), &list))
+	kerr, ok := err.(*KeyError)
+	if !ok {
+		t.Fatalf("expected KeyError, got %T", err)
+	}
+	if kerr.Key != ip4.ENRKey() {
+		t.Errorf("wrong key in KeyError: %q", kerr.Key)
+	}
+	if IsNotFound(err) {
+		t.Error("IsNotFound should return false for decoding errors")
+	}
+}
+
+// TestSortedGetAndSet tests that Set produces a sorted pairs slice.
+func TestSortedGetAndSet(t *testing.T) {
+	type pair struct {
+		k string
+		v uint32
+	}
+
+	for _, tt := range []struct {
+		input []pair
+		want  []pair
+	}{
+		{
+			input: []pair{{"a", 1}, {"c", 2}, {"b", 3}},
+			want:  []pair{{"a", 1}, {"b", 3}, {"c", 2}},
+		},
+		{
+			input: []pair{{"a", 1}, {"c", 2}, {"b", 3}, {"d", 4}, {"a", 5}, {"bb", 6}},
+			want:  []pair{{"a", 5}, {"b", 3}, {"bb", 6}, {"c", 2}, {"d", 4}},
+		},
+		{
+			input: []pair{{"c", 2}, {"b", 3}, {"d", 4}, {"a", 5}, {"bb", 6}},
+			want:  []pair{{"a", 5}, {"b", 3}, {"bb", 6}, {"c", 2}, {"d", 4}},
+		},
+	} {
+		var r Record
+		for _, i := range tt.input {
+			r.Set(WithEntry(i.k, &i.v))
+		}
+		for i, w := range tt.want {
+			// set got's key from r.pair[i], so that we preserve order of pairs
+			got := pair{k: r.pairs[i].k}
+			if err := r.Load(WithEntry(w.k, &got.v)); err != nil {
+				t.Fatal(err)
+			}
+			if got != w {
+				t.Errorf("pair %d mismatch: have %v, want %v", i, got, w)
+			}
+		}
+	}
+}
+
+// TestDirty tests record signature removal on setting of new key/value pair in record.
+func TestDirty(t *testing.T) {
+	var r Record
+
+	if r.Signed() {
+		t.Error("Signed returned true for zero record")
+	}
+	if _, err := rlp.EncodeToBytes(r); err != errEncodeUnsigned {
+		t.Errorf("expected errEncodeUnsigned, got %#v", err)
+	}
+
+	if err := r.Sign(privkey); err != nil {
+		t.Fatal(err)
+	}
+	if !r.Signed() {
+		t.Error("Signed return false for signed record")
+	}
+	if _, err := rlp.EncodeToBytes(r); err != nil {
+		t.Fatal(err)
+	}
+
+	seq := r.Seq()
+	r.Set(UDP(30303))
+	if r.Signed() {
+		t.Error("Signed returned true for modified record")
+	}
+	if _, err := rlp.EncodeToBytes(r); err != errEncodeUnsigned {
+		t.Errorf("expected errEncodeUnsigned, got %#v", err)
+	}
+	if r.Seq() != seq+1 {
+		t.Errorf("sequence number not incremented: have %d, want %d", r.Seq(), seq+1)
+	}
+	// Further modifications of the unsigned record keep the sequence number.
+	r.Set(TCP(30303))
+	if err := r.Sign(privkey); err != nil {
+		t.Fatal(err)
+	}
+	if r.Seq() != seq+1 {
+		t.Errorf("sequence number changed by signing: have %d, want %d", r.Seq(), seq+1)
+	}
+}
+
+// TestGetSetOverwrite tests value overwrite when setting a new value with an existing key in record.
+func TestGetSetOverwrite(t *testing.T) {
+	var r Record
+
+	ip := IP{192, 168, 0, 3}
+	r.Set(ip)
+
+	var ip2 IP
+	if err := r.Load(&ip2); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(ip, ip2) {
+		t.Fatalf("IP mismatch: have %v, want %v", ip2, ip)
+	}
+
+	ip3 := IP{192, 168, 0, 4}
+	r.Set(ip3)
+	var ip4 IP
+	if err := r.Load(&ip4); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(ip3, ip4) {
+		t.Fatalf("IP mismatch: have %v, want %v", ip4, ip3)
+	}
+}
+
+// TestSignEncodeAndDecode tests signing, RLP encoding and RLP decoding of a record.
+func TestSignEncodeAndDecode(t *testing.T) {
+	var r Record
+	r.Set(UDP(30303))
+	r.Set(IP{127, 0, 0, 1})
+	if err := r.Sign(privkey); err != nil {
+		t.Fatal(err)
+	}
+
+	blob, err := rlp.EncodeToBytes(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var r2 Record
+	if err := rlp.DecodeBytes(blob, &r2); err != nil {
+		t.Fatal(err)
+	}
+	blob2, err := rlp.EncodeToBytes(r2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(blob, blob2) {
+		t.Fatalf("re-encoded record mismatch")
+	}
+	if !bytes.Equal(r2.NodeAddr(), crypto.Keccak256(crypto.FromECDSAPub(pubkey)[1:])) {
+		t.Fatalf("node address mismatch: %x", r2.NodeAddr())
+	}
+}
+
+// TestDecodeTampered tests that modified records are rejected.
+func TestDecodeTampered(t *testing.T) {
+	var r Record
+	r.Set(UDP(30303))
+	if err := r.Sign(privkey); err != nil {
+		t.Fatal(err)
+	}
+	blob, _ := rlp.EncodeToBytes(r)
+
+	// The UDP port is the last value of the record.
+	tampered := append([]byte{}, blob...)
+	tampered[len(tampered)-1]++
+	var r2 Record
+	if err := rlp.DecodeBytes(tampered, &r2); err != errInvalidSig {
+		t.Fatalf("wrong error for tampered record: %v", err)
+	}
+}
+
+// TestRecordTooBig tests that records bigger than SizeLimit bytes cannot be signed.
+func TestRecordTooBig(t *testing.T) {
+	var r Record
+	key := randomString(10)
+
+	// set a big value for random key, expect error
+	r.Set(WithEntry(key, randomString(SizeLimit)))
+	if err := r.Sign(privkey); err != errTooBig {
+		t.Fatalf("expected to get errTooBig, got %#v", err)
+	}
+
+	// set an acceptable value for random key, expect no error
+	r.Set(WithEntry(key, randomString(100)))
+	if err := r.Sign(privkey); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestSignEncodeAndDecodeRandom tests encoding/decoding of records containing random key/value pairs.
+func TestSignEncodeAndDecodeRandom(t *testing.T) {
+	var r Record
+
+	// random key/value pairs for testing
+	pairs := map[string]uint32{}
+	for i := 0; i < 10; i++ {
+		key := randomString(7)
+		value := rnd.Uint32()
+		pairs[key] = value
+		r.Set(WithEntry(key, &value))
+	}
+
+	if err := r.Sign(privkey); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := rlp.EncodeToBytes(r); err != nil {
+		t.Fatal(err)
+	}
+
+	for k, v := range pairs {
+		desc := fmt.Sprintf("key %q", k)
+		var got uint32
+		buf := WithEntry(k, &got)
+		if err := r.Load(buf); err != nil {
+			t.Fatalf("%s: %v", desc, err)
+		}
+		if got != v {
+			t.Fatalf("%s: value mismatch: have %d, want %d", desc, got, v)
+		}
+	}
+}
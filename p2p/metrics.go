@@ -29,6 +29,12 @@ var (
 	ingressTrafficMeter = metrics.NewMeter("p2p/InboundTraffic")
 	egressConnectMeter  = metrics.NewMeter("p2p/OutboundConnects")
 	egressTrafficMeter  = metrics.NewMeter("p2p/OutboundTraffic")
+
+	// Payload sizes of snappy compressed messages before and after compression
+	ingressSnappyRawMeter        = metrics.NewMeter("p2p/InboundSnappyRaw")
+	ingressSnappyCompressedMeter = metrics.NewMeter("p2p/InboundSnappyCompressed")
+	egressSnappyRawMeter         = metrics.NewMeter("p2p/OutboundSnappyRaw")
+	egressSnappyCompressedMeter  = metrics.NewMeter("p2p/OutboundSnappyCompressed")
 )
 
 // meteredConn is a wrapper around a network TCP connection that meters both the
@@ -20,6 +20,7 @@ import (
 	"fmt"
 
 	"github.com/wiseplat/go-wiseplat/p2p/discover"
+	"github.com/wiseplat/go-wiseplat/p2p/enr"
 )
 
 // Protocol represents a P2P subprotocol implementation.
@@ -52,6 +53,15 @@ type Protocol struct {
 	// about a certain peer in the network. If an info retrieval function is set,
 	// but returns nil, it is assumed that the protocol handshake is still running.
 	PeerInfo func(id discover.NodeID) interface{}
+
+	// Attributes contains protocol specific information for the node record,
+	// such as the network served by the node.
+	Attributes []enr.Entry
+
+	// DialFilter is an optional helper method to check the node records of
+	// dynamic dial candidates. If it returns false, the node is not dialed,
+	// e.g. because it serves a different network.
+	DialFilter func(record *enr.Record) bool
 }
 
 func (p Protocol) cap() Cap {
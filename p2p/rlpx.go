@@ -600,7 +600,9 @@ func (rw *rlpxFrameRW) WriteMsg(msg Msg) error {
 			return errPlainMessageTooLarge
 		}
 		payload, _ := ioutil.ReadAll(msg.Payload)
+		egressSnappyRawMeter.Mark(int64(len(payload)))
 		payload = snappy.Encode(nil, payload)
+		egressSnappyCompressedMeter.Mark(int64(len(payload)))
 
 		msg.Payload = bytes.NewReader(payload)
 		msg.Size = uint32(len(payload))
@@ -704,10 +706,12 @@ func (rw *rlpxFrameRW) ReadMsg() (msg Msg, err error) {
 		if size > int(maxUint24) {
 			return msg, errPlainMessageTooLarge
 		}
+		ingressSnappyCompressedMeter.Mark(int64(len(payload)))
 		payload, err = snappy.Decode(nil, payload)
 		if err != nil {
 			return msg, err
 		}
+		ingressSnappyRawMeter.Mark(int64(size))
 		msg.Size, msg.Payload = uint32(size), bytes.NewReader(payload)
 	}
 	return msg, nil
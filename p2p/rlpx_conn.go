@@ -0,0 +1,81 @@
+// Copyright 2018 The go-wiseplat Authors
+// This file is part of the go-wiseplat library.
+//
+// The go-wiseplat library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-wiseplat library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-wiseplat library. If not, see <http://www.gnu.org/licenses/>.
+
+package p2p
+
+import (
+	"crypto/ecdsa"
+	"net"
+
+	"github.com/wiseplat/go-wiseplat/p2p/discover"
+)
+
+// RLPxConn is a raw RLPx connection to a remote node. It performs the encryption
+// and protocol handshakes like a Server would, but leaves running the protocols to
+// the user. This is meant for tools which need to talk to a node at the wire level,
+// for example to test its protocol implementation.
+//
+// Message codes are not offset: the base protocol occupies codes 0x00-0x0f and the
+// codes of the negotiated subprotocols follow in the order of their capabilities.
+type RLPxConn struct {
+	t *rlpx
+}
+
+// NewRLPxConn wraps the given network connection.
+func NewRLPxConn(fd net.Conn) *RLPxConn {
+	return &RLPxConn{t: newRLPX(fd).(*rlpx)}
+}
+
+// Handshake performs the encryption handshake as the dialing side and checks
+// that the remote node holds the key of dest.
+func (c *RLPxConn) Handshake(prv *ecdsa.PrivateKey, dest *discover.Node) error {
+	_, err := c.t.doEncHandshake(prv, dest)
+	return err
+}
+
+// ProtoHandshake exchanges the base protocol handshake, announcing the given
+// client name and capabilities. It returns the capabilities of the remote node.
+// If the remote node disconnects during the handshake, the error is the
+// DiscReason it sent.
+func (c *RLPxConn) ProtoHandshake(prv *ecdsa.PrivateKey, name string, caps []Cap) ([]Cap, error) {
+	our := &protoHandshake{
+		Version: baseProtocolVersion,
+		Name:    name,
+		Caps:    caps,
+		ID:      discover.PubkeyID(&prv.PublicKey),
+	}
+	their, err := c.t.doProtoHandshake(our)
+	if err != nil {
+		return nil, err
+	}
+	return their.Caps, nil
+}
+
+// ReadMsg reads a message from the connection.
+func (c *RLPxConn) ReadMsg() (Msg, error) {
+	return c.t.ReadMsg()
+}
+
+// WriteMsg sends a message on the connection.
+func (c *RLPxConn) WriteMsg(msg Msg) error {
+	return c.t.WriteMsg(msg)
+}
+
+// Close sends the given disconnect reason if the handshake has completed and
+// closes the connection.
+func (c *RLPxConn) Close(reason DiscReason) {
+	c.t.close(reason)
+}
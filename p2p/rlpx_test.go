@@ -19,6 +19,7 @@ package p2p
 import (
 	"bytes"
 	"crypto/rand"
+	"encoding/binary"
 	"errors"
 	"fmt"
 	"io"
@@ -374,6 +375,76 @@ func TestRLPXFrameRW(t *testing.T) {
 	}
 }
 
+// newTestFrameRWPair creates two frame codecs with matching secrets. Messages
+// written by one of them on conn can be read by the other one.
+func newTestFrameRWPair(conn io.ReadWriter) (*rlpxFrameRW, *rlpxFrameRW) {
+	var (
+		aesSecret      = make([]byte, 16)
+		macSecret      = make([]byte, 16)
+		egressMACinit  = make([]byte, 32)
+		ingressMACinit = make([]byte, 32)
+	)
+	for _, s := range [][]byte{aesSecret, macSecret, egressMACinit, ingressMACinit} {
+		rand.Read(s)
+	}
+	s1 := secrets{AES: aesSecret, MAC: macSecret, EgressMAC: sha3.NewKeccak256(), IngressMAC: sha3.NewKeccak256()}
+	s1.EgressMAC.Write(egressMACinit)
+	s1.IngressMAC.Write(ingressMACinit)
+
+	s2 := secrets{AES: aesSecret, MAC: macSecret, EgressMAC: sha3.NewKeccak256(), IngressMAC: sha3.NewKeccak256()}
+	s2.EgressMAC.Write(ingressMACinit)
+	s2.IngressMAC.Write(egressMACinit)
+
+	return newRLPXFrameRW(conn, s1), newRLPXFrameRW(conn, s2)
+}
+
+// Tests that snappy compressed messages are transmitted compressed and
+// decompressed transparently on the receiving side.
+func TestRLPXFrameRWSnappy(t *testing.T) {
+	conn := new(bytes.Buffer)
+	rw1, rw2 := newTestFrameRWPair(conn)
+	rw1.snappy, rw2.snappy = true, true
+
+	wmsg := []interface{}{"foo", strings.Repeat("test", 1000)}
+	wantPayload, _ := rlp.EncodeToBytes(wmsg)
+	if err := Send(rw1, 8, wmsg); err != nil {
+		t.Fatalf("WriteMsg error: %v", err)
+	}
+	if conn.Len() >= len(wantPayload) {
+		t.Fatalf("message not compressed: %d bytes on the wire, payload is %d bytes", conn.Len(), len(wantPayload))
+	}
+	msg, err := rw2.ReadMsg()
+	if err != nil {
+		t.Fatalf("ReadMsg error: %v", err)
+	}
+	if msg.Code != 8 || msg.Size != uint32(len(wantPayload)) {
+		t.Fatalf("msg mismatch: got code %d size %d, want code 8 size %d", msg.Code, msg.Size, len(wantPayload))
+	}
+	payload, _ := ioutil.ReadAll(msg.Payload)
+	if !bytes.Equal(payload, wantPayload) {
+		t.Fatalf("msg payload mismatch:\ngot  %x\nwant %x", payload, wantPayload)
+	}
+}
+
+// Tests that compressed messages claiming to decompress beyond the message size
+// limit are rejected before they are decompressed.
+func TestRLPXFrameRWSnappyTooLarge(t *testing.T) {
+	conn := new(bytes.Buffer)
+	rw1, rw2 := newTestFrameRWPair(conn)
+	rw2.snappy = true
+
+	// Write the snappy length prefix of a 16MB message, without compression
+	bomb := make([]byte, binary.MaxVarintLen32+16)
+	n := binary.PutUvarint(bomb, uint64(maxUint24)+1)
+	bomb = bomb[:n+16]
+	if err := rw1.WriteMsg(Msg{Code: 8, Size: uint32(len(bomb)), Payload: bytes.NewReader(bomb)}); err != nil {
+		t.Fatalf("WriteMsg error: %v", err)
+	}
+	if _, err := rw2.ReadMsg(); err != errPlainMessageTooLarge {
+		t.Fatalf("wrong error for oversized message: got %v, want %v", err, errPlainMessageTooLarge)
+	}
+}
+
 type handshakeAuthTest struct {
 	input       string
 	isPlain     bool
@@ -31,6 +31,8 @@ import (
 	"github.com/wiseplat/go-wiseplat/log"
 	"github.com/wiseplat/go-wiseplat/p2p/discover"
 	"github.com/wiseplat/go-wiseplat/p2p/discv5"
+	"github.com/wiseplat/go-wiseplat/p2p/dnsdisc"
+	"github.com/wiseplat/go-wiseplat/p2p/enr"
 	"github.com/wiseplat/go-wiseplat/p2p/nat"
 	"github.com/wiseplat/go-wiseplat/p2p/netutil"
 )
@@ -94,6 +96,10 @@ type Config struct {
 	// protocol.
 	BootstrapNodesV5 []*discv5.Node `toml:",omitempty"`
 
+	// DNSDiscovery is a list of enrtree:// URLs of DNS based node lists. The
+	// nodes of these lists are used as dial candidates.
+	DNSDiscovery []string `toml:",omitempty"`
+
 	// Static nodes are used as pre-configured connections which are always
 	// maintained and re-connected on disconnects.
 	StaticNodes []*discover.Node
@@ -155,6 +161,7 @@ type Server struct {
 	running bool
 
 	ntab         discoverTable
+	dnsClient    *dnsdisc.Client
 	listener     net.Listener
 	ourHandshake *protoHandshake
 	lastLookup   time.Time
@@ -302,6 +309,16 @@ func (srv *Server) SubscribeEvents(ch chan *PeerEvent) event.Subscription {
 	return srv.peerFeed.Subscribe(ch)
 }
 
+// hasDialFilter reports whether any protocol checks the records of dial candidates.
+func (srv *Server) hasDialFilter() bool {
+	for _, p := range srv.Protocols {
+		if p.DialFilter != nil {
+			return true
+		}
+	}
+	return false
+}
+
 // Self returns the local node's endpoint information.
 func (srv *Server) Self() *discover.Node {
 	srv.lock.Lock()
@@ -389,6 +406,13 @@ func (srv *Server) Start() (err error) {
 		if err := ntab.SetFallbackNodes(srv.BootstrapNodes); err != nil {
 			return err
 		}
+		var entries []enr.Entry
+		for _, p := range srv.Protocols {
+			entries = append(entries, p.Attributes...)
+		}
+		if err := ntab.SetRecordEntries(entries...); err != nil {
+			return err
+		}
 		srv.ntab = ntab
 	}
 
@@ -403,11 +427,23 @@ func (srv *Server) Start() (err error) {
 		srv.DiscV5 = ntab
 	}
 
+	if len(srv.DNSDiscovery) > 0 {
+		client, err := dnsdisc.NewClient(dnsdisc.Config{}, srv.DNSDiscovery...)
+		if err != nil {
+			return err
+		}
+		client.Start()
+		srv.dnsClient = client
+	}
+
 	dynPeers := (srv.MaxPeers + 1) / 2
-	if srv.NoDiscovery {
+	if srv.NoDiscovery && srv.dnsClient == nil {
 		dynPeers = 0
 	}
 	dialer := newDialState(srv.StaticNodes, srv.BootstrapNodes, srv.ntab, dynPeers, srv.NetRestrict)
+	if srv.dnsClient != nil {
+		dialer.dnsNodes = srv.dnsClient
+	}
 
 	// handshake
 	srv.ourHandshake = &protoHandshake{Version: baseProtocolVersion, Name: srv.Name, ID: discover.PubkeyID(&srv.PrivateKey.PublicKey)}
@@ -594,6 +630,9 @@ running:
 	if srv.DiscV5 != nil {
 		srv.DiscV5.Close()
 	}
+	if srv.dnsClient != nil {
+		srv.dnsClient.Close()
+	}
 	// Disconnect all peers.
 	for _, p := range peers {
 		p.Disconnect(DiscQuitting)
@@ -17,10 +17,12 @@
 package params
 
 import (
+	"encoding/binary"
 	"fmt"
 	"math/big"
 
 	"github.com/wiseplat/go-wiseplat/common"
+	"github.com/wiseplat/go-wiseplat/crypto/sha3"
 )
 
 var (
@@ -141,6 +143,48 @@ func (c *CliqueConfig) String() string {
 	return "clique"
 }
 
+// TrustedCheckpoint represents a set of post-processed trie roots (CHT and
+// BloomTrie) associated with the appropriate section index and head hash. It is
+// used to start light syncing from this checkpoint and avoid downloading the
+// entire header chain while still being able to securely access old headers/logs.
+type TrustedCheckpoint struct {
+	Name         string      `json:"-" rlp:"-"`
+	SectionIndex uint64      `json:"sectionIndex"`
+	SectionHead  common.Hash `json:"sectionHead"`
+	CHTRoot      common.Hash `json:"chtRoot"`
+	BloomRoot    common.Hash `json:"bloomRoot"`
+}
+
+// Hash returns the hash of the checkpoint's four key fields (index, section head,
+// CHT root and BloomTrie root). This is the value registered in the on-chain
+// checkpoint oracle.
+func (c *TrustedCheckpoint) Hash() common.Hash {
+	buf := make([]byte, 8+3*common.HashLength)
+	binary.BigEndian.PutUint64(buf, c.SectionIndex)
+	copy(buf[8:], c.SectionHead.Bytes())
+	copy(buf[8+common.HashLength:], c.CHTRoot.Bytes())
+	copy(buf[8+2*common.HashLength:], c.BloomRoot.Bytes())
+
+	var h common.Hash
+	hasher := sha3.NewKeccak256()
+	hasher.Write(buf)
+	hasher.Sum(h[:0])
+	return h
+}
+
+// Empty returns an indicator whether the checkpoint is regarded as empty.
+func (c *TrustedCheckpoint) Empty() bool {
+	return c.SectionHead == (common.Hash{}) || c.CHTRoot == (common.Hash{}) || c.BloomRoot == (common.Hash{})
+}
+
+// CheckpointOracleConfig is the configuration of the on-chain checkpoint oracle
+// used by light clients to start syncing from a checkpoint approved by its admins.
+type CheckpointOracleConfig struct {
+	Address   common.Address   `json:"address"`   // Address of the oracle contract
+	Signers   []common.Address `json:"signers"`   // Admins allowed to approve checkpoints
+	Threshold uint64           `json:"threshold"` // Number of signatures required to accept a checkpoint
+}
+
 // String implements the fmt.Stringer interface.
 func (c *ChainConfig) String() string {
 	var engine interface{}
@@ -0,0 +1,348 @@
+// Copyright 2018 The go-wiseplat Authors
+// This file is part of the go-wiseplat library.
+//
+// The go-wiseplat library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-wiseplat library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-wiseplat library. If not, see <http://www.gnu.org/licenses/>.
+
+package api
+
+import (
+	"crypto/ecdsa"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+
+	"github.com/wiseplat/go-wiseplat/common"
+	"github.com/wiseplat/go-wiseplat/crypto"
+	"github.com/wiseplat/go-wiseplat/log"
+	"github.com/wiseplat/go-wiseplat/swarm/storage"
+	"golang.org/x/crypto/scrypt"
+)
+
+// AccessType is the method used to derive the session key protecting an
+// access controlled manifest.
+type AccessType string
+
+const (
+	AccessTypePass = AccessType("pass") // session key derived from a password via scrypt
+	AccessTypePK   = AccessType("pk")   // session key derived via ECDH with a single grantee
+	AccessTypeACT  = AccessType("act")  // access key looked up in an access control table
+)
+
+const (
+	// AccessSaltLength is the length of the random salt mixed into session keys.
+	AccessSaltLength = 32
+
+	// AccessKeyLength is the length of session and access keys.
+	AccessKeyLength = 32
+)
+
+var (
+	ErrNoCredentials = errors.New("access controlled content, credentials required")
+	ErrDecrypt       = errors.New("cannot decrypt access controlled content")
+	ErrNoAccess      = errors.New("no access granted to the given credentials")
+)
+
+// DefaultKdfParams are the scrypt parameters used for password protected
+// content, equal to the light variant used by the keystore.
+var DefaultKdfParams = &KdfParams{
+	N: 1 << 12,
+	P: 6,
+	R: 8,
+}
+
+// KdfParams are the scrypt parameters of a password derived session key.
+type KdfParams struct {
+	N int `json:"n"`
+	P int `json:"p"`
+	R int `json:"r"`
+}
+
+// AccessEntry is attached to the root manifest entry of access controlled
+// content. The hash of such an entry is encrypted with the access key and the
+// entry carries everything, apart from the credentials, needed to recover it.
+type AccessEntry struct {
+	Type      AccessType `json:"type"`
+	Publisher string     `json:"publisher,omitempty"`
+	Salt      []byte     `json:"salt"`
+	Act       string     `json:"act,omitempty"`
+	KdfParams *KdfParams `json:"kdf_params,omitempty"`
+}
+
+// NewAccessEntryPassword creates an access entry for content protected by a
+// password.
+func NewAccessEntryPassword(salt []byte, kdfParams *KdfParams) (*AccessEntry, error) {
+	if len(salt) != AccessSaltLength {
+		return nil, fmt.Errorf("salt should be %d bytes long", AccessSaltLength)
+	}
+	return &AccessEntry{
+		Type:      AccessTypePass,
+		Salt:      salt,
+		KdfParams: kdfParams,
+	}, nil
+}
+
+// NewAccessEntryPK creates an access entry for content shared with the holder
+// of a single private key.
+func NewAccessEntryPK(publisher string, salt []byte) (*AccessEntry, error) {
+	if _, err := decodePublisher(publisher); err != nil {
+		return nil, err
+	}
+	if len(salt) != AccessSaltLength {
+		return nil, fmt.Errorf("salt should be %d bytes long", AccessSaltLength)
+	}
+	return &AccessEntry{
+		Type:      AccessTypePK,
+		Publisher: publisher,
+		Salt:      salt,
+	}, nil
+}
+
+// NewAccessEntryACT creates an access entry for content shared with a list of
+// grantees through the access control table stored under act.
+func NewAccessEntryACT(publisher string, salt []byte, act string) (*AccessEntry, error) {
+	if len(salt) != AccessSaltLength {
+		return nil, fmt.Errorf("salt should be %d bytes long", AccessSaltLength)
+	}
+	if _, err := decodePublisher(publisher); err != nil {
+		return nil, err
+	}
+	return &AccessEntry{
+		Type:      AccessTypeACT,
+		Publisher: publisher,
+		Salt:      salt,
+		Act:       act,
+		KdfParams: DefaultKdfParams,
+	}, nil
+}
+
+// decodePublisher parses the hex encoded, uncompressed public key of a publisher.
+func decodePublisher(publisher string) (*ecdsa.PublicKey, error) {
+	pub := crypto.ToECDSAPub(common.FromHex(publisher))
+	if pub == nil || pub.X == nil {
+		return nil, fmt.Errorf("invalid publisher key %q", publisher)
+	}
+	return pub, nil
+}
+
+// NewSessionKeyPassword derives the session key of a password protected access
+// entry.
+func NewSessionKeyPassword(password string, accessEntry *AccessEntry) ([]byte, error) {
+	if accessEntry.KdfParams == nil {
+		return nil, errors.New("missing kdf parameters")
+	}
+	params := accessEntry.KdfParams
+	return scrypt.Key([]byte(password), accessEntry.Salt, params.N, params.R, params.P, AccessKeyLength)
+}
+
+// NewSessionKeyPK derives the session key shared between the holder of the
+// private key and the holder of the public key, using ECDH.
+func NewSessionKeyPK(private *ecdsa.PrivateKey, public *ecdsa.PublicKey, salt []byte) ([]byte, error) {
+	if !crypto.S256().IsOnCurve(public.X, public.Y) {
+		return nil, errors.New("invalid public key")
+	}
+	x, _ := crypto.S256().ScalarMult(public.X, public.Y, private.D.Bytes())
+	if x == nil {
+		return nil, errors.New("shared secret is infinity")
+	}
+	return crypto.Keccak256(common.LeftPadBytes(x.Bytes(), 32), salt), nil
+}
+
+// EncryptRef encrypts or decrypts a reference with the given key. The cipher is
+// a keccak256 based key stream, so the operation is its own inverse.
+func EncryptRef(ref, key []byte) []byte {
+	out := make([]byte, len(ref))
+	counter := make([]byte, 4)
+	for i := 0; i < len(ref); i += 32 {
+		binary.BigEndian.PutUint32(counter, uint32(i/32))
+		stream := crypto.Keccak256(key, counter)
+		for j := i; j < len(ref) && j < i+32; j++ {
+			out[j] = ref[j] ^ stream[j-i]
+		}
+	}
+	return out
+}
+
+// actLookupKey returns the ACT manifest path under which the access key for
+// the grantee holding the session key is stored.
+func actLookupKey(sessionKey []byte) string {
+	return hex.EncodeToString(crypto.Keccak256(sessionKey, []byte{0}))
+}
+
+// actAccessKeyDecryptionKey returns the key the access key is encrypted with
+// for the grantee holding the session key.
+func actAccessKeyDecryptionKey(sessionKey []byte) []byte {
+	return crypto.Keccak256(sessionKey, []byte{1})
+}
+
+// NewACTEntry creates the access control table entry granting the holder of
+// the session key access to the content encrypted under accessKey.
+func NewACTEntry(sessionKey, accessKey []byte) ManifestEntry {
+	return ManifestEntry{
+		Path:        actLookupKey(sessionKey),
+		Hash:        hex.EncodeToString(EncryptRef(accessKey, actAccessKeyDecryptionKey(sessionKey))),
+		ContentType: "application/octet-stream",
+	}
+}
+
+// NewACTEntries creates the access control table granting access to accessKey
+// to each of the grantee public keys, and optionally to a password.
+func NewACTEntries(publisher *ecdsa.PrivateKey, accessKey []byte, accessEntry *AccessEntry, grantees []*ecdsa.PublicKey, password string) ([]ManifestEntry, error) {
+	var entries []ManifestEntry
+	for _, grantee := range grantees {
+		sessionKey, err := NewSessionKeyPK(publisher, grantee, accessEntry.Salt)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, NewACTEntry(sessionKey, accessKey))
+	}
+	if password != "" {
+		sessionKey, err := NewSessionKeyPassword(password, accessEntry)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, NewACTEntry(sessionKey, accessKey))
+	}
+	return entries, nil
+}
+
+// DecryptFunc replaces the encrypted hash of an access controlled manifest
+// entry with the plain content reference.
+type DecryptFunc func(*ManifestEntry) error
+
+// NoDecrypt is a DecryptFunc refusing access to any access controlled content.
+var NoDecrypt = DecryptFunc(func(*ManifestEntry) error { return ErrNoCredentials })
+
+// Decryptor returns a DecryptFunc unlocking access controlled content with the
+// given password and the node's own private key.
+func (self *Api) Decryptor(credentials string) DecryptFunc {
+	return func(m *ManifestEntry) error {
+		if m.Access == nil {
+			return nil
+		}
+		ref, err := hex.DecodeString(m.Hash)
+		if err != nil {
+			return err
+		}
+		var accessKey []byte
+		switch m.Access.Type {
+		case AccessTypePass:
+			if credentials == "" {
+				return ErrNoCredentials
+			}
+			accessKey, err = NewSessionKeyPassword(credentials, m.Access)
+			if err != nil {
+				return err
+			}
+		case AccessTypePK:
+			accessKey, err = self.publisherSessionKey(m.Access)
+			if err != nil {
+				return err
+			}
+		case AccessTypeACT:
+			accessKey, err = self.actAccessKey(m.Access, credentials)
+			if err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("unknown access type %q", m.Access.Type)
+		}
+		m.Hash = hex.EncodeToString(EncryptRef(ref, accessKey))
+		m.Access = nil
+		return nil
+	}
+}
+
+// publisherSessionKey derives the session key shared between the node's key
+// and the publisher of the access entry.
+func (self *Api) publisherSessionKey(access *AccessEntry) ([]byte, error) {
+	if self.prvKey == nil {
+		return nil, ErrNoCredentials
+	}
+	publisher, err := decodePublisher(access.Publisher)
+	if err != nil {
+		return nil, err
+	}
+	return NewSessionKeyPK(self.prvKey, publisher, access.Salt)
+}
+
+// actAccessKey looks up the access key in the access control table, trying the
+// node's key first and the password second.
+func (self *Api) actAccessKey(access *AccessEntry, credentials string) ([]byte, error) {
+	trie, err := loadManifest(self.dpa, common.FromHex(access.Act), nil)
+	if err != nil {
+		return nil, fmt.Errorf("error loading access control table: %v", err)
+	}
+	var sessionKeys [][]byte
+	if self.prvKey != nil {
+		sessionKey, err := self.publisherSessionKey(access)
+		if err != nil {
+			return nil, err
+		}
+		sessionKeys = append(sessionKeys, sessionKey)
+	}
+	if credentials != "" {
+		sessionKey, err := NewSessionKeyPassword(credentials, access)
+		if err != nil {
+			return nil, err
+		}
+		sessionKeys = append(sessionKeys, sessionKey)
+	}
+	if len(sessionKeys) == 0 {
+		return nil, ErrNoCredentials
+	}
+	for _, sessionKey := range sessionKeys {
+		lookup := actLookupKey(sessionKey)
+		entry, path := trie.getEntry(lookup)
+		if entry == nil || path != lookup || entry.ContentType == ManifestType {
+			continue
+		}
+		encrypted, err := hex.DecodeString(entry.Hash)
+		if err != nil {
+			return nil, err
+		}
+		return EncryptRef(encrypted, actAccessKeyDecryptionKey(sessionKey)), nil
+	}
+	if credentials == "" {
+		return nil, ErrNoCredentials
+	}
+	return nil, ErrNoAccess
+}
+
+// ResolveAccess checks whether the manifest under key is access controlled and
+// if so, returns the key of the protected manifest unlocked by decrypt.
+// Manifests without access control are returned unchanged.
+func (self *Api) ResolveAccess(key storage.Key, decrypt DecryptFunc) (storage.Key, error) {
+	trie, err := loadManifest(self.dpa, key, nil)
+	if err != nil {
+		// not a manifest, leave it to the caller to deal with
+		return key, nil
+	}
+	cnt, entry := trie.getCountLast()
+	if cnt != 1 || entry.Access == nil {
+		return key, nil
+	}
+	log.Trace(fmt.Sprintf("access controlled manifest %v, type %s", key.Log(), entry.Access.Type))
+	plain := entry.ManifestEntry
+	if err := decrypt(&plain); err != nil {
+		return nil, err
+	}
+	// protected content is always a manifest, failing to load it means
+	// the credentials were wrong
+	plainKey := storage.Key(common.Hex2Bytes(plain.Hash))
+	if _, err := loadManifest(self.dpa, plainKey, nil); err != nil {
+		return nil, ErrDecrypt
+	}
+	return plainKey, nil
+}
@@ -0,0 +1,216 @@
+// Copyright 2018 The go-wiseplat Authors
+// This file is part of the go-wiseplat library.
+//
+// The go-wiseplat library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-wiseplat library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-wiseplat library. If not, see <http://www.gnu.org/licenses/>.
+
+package api
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"sync"
+	"testing"
+
+	"github.com/wiseplat/go-wiseplat/crypto"
+	"github.com/wiseplat/go-wiseplat/swarm/storage"
+)
+
+// testKdfParams are cheap scrypt parameters to keep the tests fast.
+var testKdfParams = &KdfParams{N: 1 << 4, P: 1, R: 8}
+
+func storeManifest(t *testing.T, api *Api, m *Manifest) storage.Key {
+	data, err := json.Marshal(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wg := &sync.WaitGroup{}
+	key, err := api.dpa.Store(bytes.NewReader(data), int64(len(data)), wg, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wg.Wait()
+	return key
+}
+
+func storeRoot(t *testing.T, api *Api, ref storage.Key, accessKey []byte, accessEntry *AccessEntry) storage.Key {
+	return storeManifest(t, api, &Manifest{
+		Entries: []ManifestEntry{{
+			Hash:        hex.EncodeToString(EncryptRef(ref, accessKey)),
+			ContentType: ManifestType,
+			Access:      accessEntry,
+		}},
+	})
+}
+
+func randomBytes(t *testing.T, n int) []byte {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func publisherHex(key *ecdsa.PrivateKey) string {
+	return hex.EncodeToString(crypto.FromECDSAPub(&key.PublicKey))
+}
+
+func TestEncryptRefRoundtrip(t *testing.T) {
+	ref := randomBytes(t, 64)
+	key := randomBytes(t, AccessKeyLength)
+
+	enc := EncryptRef(ref, key)
+	if bytes.Equal(enc, ref) {
+		t.Fatal("encrypted reference equals plain reference")
+	}
+	if dec := EncryptRef(enc, key); !bytes.Equal(dec, ref) {
+		t.Fatalf("decrypted reference mismatch: have %x, want %x", dec, ref)
+	}
+}
+
+func TestAccessPassword(t *testing.T) {
+	testApi(t, func(api *Api) {
+		ref := storeManifest(t, api, &Manifest{})
+
+		accessEntry, err := NewAccessEntryPassword(randomBytes(t, AccessSaltLength), testKdfParams)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sessionKey, err := NewSessionKeyPassword("secret", accessEntry)
+		if err != nil {
+			t.Fatal(err)
+		}
+		root := storeRoot(t, api, ref, sessionKey, accessEntry)
+
+		if _, err := api.ResolveAccess(root, api.Decryptor("")); err != ErrNoCredentials {
+			t.Fatalf("expected %v without password, got %v", ErrNoCredentials, err)
+		}
+		if _, err := api.ResolveAccess(root, api.Decryptor("wrong")); err != ErrDecrypt {
+			t.Fatalf("expected %v with wrong password, got %v", ErrDecrypt, err)
+		}
+		key, err := api.ResolveAccess(root, api.Decryptor("secret"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(key, ref) {
+			t.Fatalf("resolved key mismatch: have %v, want %v", key, ref)
+		}
+	})
+}
+
+func TestAccessPK(t *testing.T) {
+	testApi(t, func(api *Api) {
+		publisher, _ := crypto.GenerateKey()
+		grantee, _ := crypto.GenerateKey()
+		ref := storeManifest(t, api, &Manifest{})
+
+		salt := randomBytes(t, AccessSaltLength)
+		accessEntry, err := NewAccessEntryPK(publisherHex(publisher), salt)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sessionKey, err := NewSessionKeyPK(publisher, &grantee.PublicKey, salt)
+		if err != nil {
+			t.Fatal(err)
+		}
+		root := storeRoot(t, api, ref, sessionKey, accessEntry)
+
+		if _, err := api.ResolveAccess(root, api.Decryptor("")); err != ErrNoCredentials {
+			t.Fatalf("expected %v without node key, got %v", ErrNoCredentials, err)
+		}
+		api.prvKey = grantee
+		key, err := api.ResolveAccess(root, api.Decryptor(""))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(key, ref) {
+			t.Fatalf("resolved key mismatch: have %v, want %v", key, ref)
+		}
+		api.prvKey, _ = crypto.GenerateKey()
+		if _, err := api.ResolveAccess(root, api.Decryptor("")); err != ErrDecrypt {
+			t.Fatalf("expected %v for other node, got %v", ErrDecrypt, err)
+		}
+	})
+}
+
+func TestAccessACT(t *testing.T) {
+	testApi(t, func(api *Api) {
+		publisher, _ := crypto.GenerateKey()
+		ref := storeManifest(t, api, &Manifest{})
+
+		var grantees []*ecdsa.PrivateKey
+		var granteePubs []*ecdsa.PublicKey
+		for i := 0; i < 5; i++ {
+			key, _ := crypto.GenerateKey()
+			grantees = append(grantees, key)
+			granteePubs = append(granteePubs, &key.PublicKey)
+		}
+		accessKey := randomBytes(t, AccessKeyLength)
+		accessEntry, err := NewAccessEntryACT(publisherHex(publisher), randomBytes(t, AccessSaltLength), "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		accessEntry.KdfParams = testKdfParams
+
+		entries, err := NewACTEntries(publisher, accessKey, accessEntry, granteePubs, "secret")
+		if err != nil {
+			t.Fatal(err)
+		}
+		accessEntry.Act = storeManifest(t, api, &Manifest{Entries: entries}).String()
+		root := storeRoot(t, api, ref, accessKey, accessEntry)
+
+		if _, err := api.ResolveAccess(root, api.Decryptor("")); err != ErrNoCredentials {
+			t.Fatalf("expected %v without credentials, got %v", ErrNoCredentials, err)
+		}
+		for i, grantee := range grantees {
+			api.prvKey = grantee
+			key, err := api.ResolveAccess(root, api.Decryptor(""))
+			if err != nil {
+				t.Fatalf("grantee %d: %v", i, err)
+			}
+			if !bytes.Equal(key, ref) {
+				t.Fatalf("grantee %d: resolved key mismatch: have %v, want %v", i, key, ref)
+			}
+		}
+		api.prvKey, _ = crypto.GenerateKey()
+		if _, err := api.ResolveAccess(root, api.Decryptor("")); err != ErrNoCredentials {
+			t.Fatalf("expected %v for non-grantee, got %v", ErrNoCredentials, err)
+		}
+		if _, err := api.ResolveAccess(root, api.Decryptor("wrong")); err != ErrNoAccess {
+			t.Fatalf("expected %v for wrong password, got %v", ErrNoAccess, err)
+		}
+		key, err := api.ResolveAccess(root, api.Decryptor("secret"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(key, ref) {
+			t.Fatalf("resolved key mismatch: have %v, want %v", key, ref)
+		}
+	})
+}
+
+func TestAccessUnprotected(t *testing.T) {
+	testApi(t, func(api *Api) {
+		ref := storeManifest(t, api, &Manifest{Entries: []ManifestEntry{{Hash: hex.EncodeToString(randomBytes(t, 32)), Path: "a"}}})
+		key, err := api.ResolveAccess(ref, NoDecrypt)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(key, ref) {
+			t.Fatalf("unprotected manifest key changed: have %v, want %v", key, ref)
+		}
+	})
+}
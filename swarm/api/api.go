@@ -17,6 +17,7 @@
 package api
 
 import (
+	"crypto/ecdsa"
 	"fmt"
 	"io"
 	"net/http"
@@ -46,15 +47,17 @@ on top of the dpa
 it is the public interface of the dpa which is included in the wiseplat stack
 */
 type Api struct {
-	dpa *storage.DPA
-	dns Resolver
+	dpa    *storage.DPA
+	dns    Resolver
+	prvKey *ecdsa.PrivateKey // used to unlock content shared with this node
 }
 
 //the api constructor initialises
-func NewApi(dpa *storage.DPA, dns Resolver) (self *Api) {
+func NewApi(dpa *storage.DPA, dns Resolver, prvKey *ecdsa.PrivateKey) (self *Api) {
 	self = &Api{
-		dpa: dpa,
-		dns: dns,
+		dpa:    dpa,
+		dns:    dns,
+		prvKey: prvKey,
 	}
 	return
 }
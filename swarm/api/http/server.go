@@ -370,6 +370,10 @@ func (s *Server) HandleGetFiles(w http.ResponseWriter, r *Request) {
 		s.Error(w, r, fmt.Errorf("error resolving %s: %s", r.uri.Addr, err))
 		return
 	}
+	key, ok := s.resolveAccess(w, r, key)
+	if !ok {
+		return
+	}
 
 	walker, err := s.api.NewManifestWalker(key, nil)
 	if err != nil {
@@ -440,6 +444,10 @@ func (s *Server) HandleGetList(w http.ResponseWriter, r *Request) {
 		s.Error(w, r, fmt.Errorf("error resolving %s: %s", r.uri.Addr, err))
 		return
 	}
+	key, ok := s.resolveAccess(w, r, key)
+	if !ok {
+		return
+	}
 
 	list, err := s.getManifestList(key, r.uri.Path)
 
@@ -536,6 +544,10 @@ func (s *Server) HandleGetFile(w http.ResponseWriter, r *Request) {
 		s.Error(w, r, fmt.Errorf("error resolving %s: %s", r.uri.Addr, err))
 		return
 	}
+	key, ok := s.resolveAccess(w, r, key)
+	if !ok {
+		return
+	}
 
 	reader, contentType, status, err := s.api.Get(key, r.uri.Path)
 	if err != nil {
@@ -639,6 +651,23 @@ func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// resolveAccess unlocks access controlled manifests using the password sent
+// through HTTP basic authentication and the node's own key. If the content
+// cannot be unlocked, the client is asked for credentials and false returned.
+func (s *Server) resolveAccess(w http.ResponseWriter, r *Request, key storage.Key) (storage.Key, bool) {
+	_, password, _ := r.BasicAuth()
+	plain, err := s.api.ResolveAccess(key, s.api.Decryptor(password))
+	switch err {
+	case nil:
+		return plain, true
+	case api.ErrNoCredentials, api.ErrNoAccess, api.ErrDecrypt:
+		s.Unauthorized(w, r, err)
+	default:
+		s.Error(w, r, fmt.Errorf("error resolving access to %s: %s", key, err))
+	}
+	return nil, false
+}
+
 func (s *Server) updateManifest(key storage.Key, update func(mw *api.ManifestWriter) error) (storage.Key, error) {
 	mw, err := s.api.NewManifestWriter(key, nil)
 	if err != nil {
@@ -676,3 +705,8 @@ func (s *Server) Error(w http.ResponseWriter, r *Request, err error) {
 func (s *Server) NotFound(w http.ResponseWriter, r *Request, err error) {
 	ShowError(w, &r.Request, fmt.Sprintf("NOT FOUND error serving %s %s: %s", r.Method, r.uri, err), http.StatusNotFound)
 }
+
+func (s *Server) Unauthorized(w http.ResponseWriter, r *Request, err error) {
+	w.Header().Set("WWW-Authenticate", `Basic realm="Swarm access controlled content"`)
+	ShowError(w, &r.Request, fmt.Sprintf("Unauthorized %s %s: %s", r.Method, r.uri, err), http.StatusUnauthorized)
+}
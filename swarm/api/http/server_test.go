@@ -194,3 +194,81 @@ func TestBzzRootRedirect(t *testing.T) {
 		t.Fatalf("expected response to equal %q, got %q", data, gotData)
 	}
 }
+
+// TestBzzGetAccessPassword tests that password protected content asks for
+// credentials and is served once the right password is sent through HTTP
+// basic authentication.
+func TestBzzGetAccessPassword(t *testing.T) {
+	srv := testutil.NewTestSwarmServer(t)
+	defer srv.Close()
+
+	client := swarm.NewClient(srv.URL)
+	data := []byte("protected data")
+	file := &swarm.File{
+		ReadCloser: ioutil.NopCloser(bytes.NewReader(data)),
+		ManifestEntry: api.ManifestEntry{
+			Path:        "",
+			ContentType: "text/plain",
+			Size:        int64(len(data)),
+		},
+	}
+	hash, err := client.Upload(file, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// protect the manifest with a password
+	accessEntry, err := api.NewAccessEntryPassword(make([]byte, api.AccessSaltLength), &api.KdfParams{N: 1 << 4, P: 1, R: 8})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sessionKey, err := api.NewSessionKeyPassword("secret", accessEntry)
+	if err != nil {
+		t.Fatal(err)
+	}
+	root, err := client.UploadManifest(&api.Manifest{
+		Entries: []api.ManifestEntry{{
+			Hash:        common.Bytes2Hex(api.EncryptRef(common.Hex2Bytes(hash), sessionKey)),
+			ContentType: api.ManifestType,
+			Access:      accessEntry,
+		}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range []struct {
+		password string
+		status   int
+	}{
+		{"", http.StatusUnauthorized},
+		{"wrong", http.StatusUnauthorized},
+		{"secret", http.StatusOK},
+	} {
+		req, err := http.NewRequest("GET", srv.URL+"/bzz:/"+root+"/", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if test.password != "" {
+			req.SetBasicAuth("", test.password)
+		}
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, err := ioutil.ReadAll(res.Body)
+		res.Body.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.StatusCode != test.status {
+			t.Fatalf("password %q: expected status %d, got %d", test.password, test.status, res.StatusCode)
+		}
+		if test.status == http.StatusUnauthorized && res.Header.Get("WWW-Authenticate") == "" {
+			t.Fatalf("password %q: missing WWW-Authenticate header", test.password)
+		}
+		if test.status == http.StatusOK && !bytes.Equal(body, data) {
+			t.Fatalf("expected response to equal %q, got %q", data, body)
+		}
+	}
+}
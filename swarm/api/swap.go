@@ -0,0 +1,47 @@
+// Copyright 2018 The go-wiseplat Authors
+// This file is part of the go-wiseplat library.
+//
+// The go-wiseplat library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-wiseplat library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-wiseplat library. If not, see <http://www.gnu.org/licenses/>.
+
+package api
+
+import (
+	"fmt"
+
+	"github.com/wiseplat/go-wiseplat/swarm/network"
+)
+
+// Swap exposes the SWAP accounting state of the connected peers
+type Swap struct {
+	hive *network.Hive
+}
+
+func NewSwap(hive *network.Hive) *Swap {
+	return &Swap{hive}
+}
+
+// Balances returns the SWAP balance with each connected peer, keyed by node ID.
+// Positive balances are owed to us, negative ones are owed by us.
+func (self *Swap) Balances() map[string]int {
+	return self.hive.SwapBalances()
+}
+
+// Balance returns the SWAP balance with the connected peer of the given node ID
+func (self *Swap) Balance(id string) (int, error) {
+	balance, ok := self.hive.SwapBalances()[id]
+	if !ok {
+		return 0, fmt.Errorf("no SWAP arrangement with peer %s", id)
+	}
+	return balance, nil
+}
@@ -25,6 +25,7 @@ import (
 	"os"
 	"path/filepath"
 	"sync"
+	"syscall"
 )
 
 var (
@@ -34,6 +35,7 @@ var (
 	_ fs.NodeCreater         = (*SwarmDir)(nil)
 	_ fs.NodeRemover         = (*SwarmDir)(nil)
 	_ fs.NodeMkdirer         = (*SwarmDir)(nil)
+	_ fs.NodeRenamer         = (*SwarmDir)(nil)
 )
 
 type SwarmDir struct {
@@ -70,6 +72,8 @@ func (sd *SwarmDir) Attr(ctx context.Context, a *fuse.Attr) error {
 
 func (sd *SwarmDir) Lookup(ctx context.Context, req *fuse.LookupRequest, resp *fuse.LookupResponse) (fs.Node, error) {
 
+	sd.lock.RLock()
+	defer sd.lock.RUnlock()
 	for _, n := range sd.files {
 		if n.name == req.Name {
 			return n, nil
@@ -84,6 +88,8 @@ func (sd *SwarmDir) Lookup(ctx context.Context, req *fuse.LookupRequest, resp *f
 }
 
 func (sd *SwarmDir) ReadDirAll(ctx context.Context) ([]fuse.Dirent, error) {
+	sd.lock.RLock()
+	defer sd.lock.RUnlock()
 	var children []fuse.Dirent
 	for _, file := range sd.files {
 		children = append(children, fuse.Dirent{Inode: file.inode, Type: fuse.DT_File, Name: file.name})
@@ -108,35 +114,34 @@ func (sd *SwarmDir) Create(ctx context.Context, req *fuse.CreateRequest, resp *f
 
 func (sd *SwarmDir) Remove(ctx context.Context, req *fuse.RemoveRequest) error {
 
-	if req.Dir && sd.directories != nil {
-		newDirs := []*SwarmDir{}
-		for _, dir := range sd.directories {
-			if dir.name == req.Name {
-				removeDirectoryFromSwarm(dir)
-			} else {
-				newDirs = append(newDirs, dir)
+	sd.lock.Lock()
+	defer sd.lock.Unlock()
+
+	if req.Dir {
+		for i, dir := range sd.directories {
+			if dir.name != req.Name {
+				continue
 			}
-		}
-		if len(sd.directories) > len(newDirs) {
-			sd.lock.Lock()
-			defer sd.lock.Unlock()
-			sd.directories = newDirs
-		}
-		return nil
-	} else if !req.Dir && sd.files != nil {
-		newFiles := []*SwarmFile{}
-		for _, f := range sd.files {
-			if f.name == req.Name {
-				removeFileFromSwarm(f)
-			} else {
-				newFiles = append(newFiles, f)
+			// only empty directories can be removed, same as rmdir(2)
+			dir.lock.RLock()
+			empty := len(dir.directories) == 0 && len(dir.files) == 0
+			dir.lock.RUnlock()
+			if !empty {
+				return fuse.Errno(syscall.ENOTEMPTY)
 			}
+			sd.directories = append(sd.directories[:i:i], sd.directories[i+1:]...)
+			return nil
+		}
+		return fuse.ENOENT
+	}
+	for i, f := range sd.files {
+		if f.name != req.Name {
+			continue
 		}
-		if len(sd.files) > len(newFiles) {
-			sd.lock.Lock()
-			defer sd.lock.Unlock()
-			sd.files = newFiles
+		if err := removeFileFromSwarm(f); err != nil {
+			return err
 		}
+		sd.files = append(sd.files[:i:i], sd.files[i+1:]...)
 		return nil
 	}
 	return fuse.ENOENT
@@ -144,7 +149,7 @@ func (sd *SwarmDir) Remove(ctx context.Context, req *fuse.RemoveRequest) error {
 
 func (sd *SwarmDir) Mkdir(ctx context.Context, req *fuse.MkdirRequest) (fs.Node, error) {
 
-	newDir := NewSwarmDir(req.Name, sd.mountInfo)
+	newDir := NewSwarmDir(filepath.Join(sd.path, req.Name), sd.mountInfo)
 
 	sd.lock.Lock()
 	defer sd.lock.Unlock()
@@ -153,3 +158,125 @@ func (sd *SwarmDir) Mkdir(ctx context.Context, req *fuse.MkdirRequest) (fs.Node,
 	return newDir, nil
 
 }
+
+// Rename moves a file or directory, possibly into another directory. The
+// manifest entries of all affected files are moved in a single update.
+func (sd *SwarmDir) Rename(ctx context.Context, req *fuse.RenameRequest, newDir fs.Node) error {
+
+	target, ok := newDir.(*SwarmDir)
+	if !ok {
+		return fuse.EIO
+	}
+	sd.lock.Lock()
+	defer sd.lock.Unlock()
+	if target != sd {
+		target.lock.Lock()
+		defer target.lock.Unlock()
+	}
+
+	for i, f := range sd.files {
+		if f.name != req.OldName {
+			continue
+		}
+		if target.findDir(req.NewName) >= 0 {
+			return fuse.Errno(syscall.EISDIR)
+		}
+		// an existing file at the destination is replaced
+		if j := target.findFile(req.NewName); j >= 0 {
+			if target.files[j] == f {
+				return nil
+			}
+			if err := removeFileFromSwarm(target.files[j]); err != nil {
+				return err
+			}
+			target.files = append(target.files[:j:j], target.files[j+1:]...)
+			if target == sd {
+				i = sd.findFile(req.OldName)
+			}
+		}
+		if err := moveFilesInSwarm(sd.mountInfo, []fileMove{{f, target.path, req.NewName}}); err != nil {
+			return err
+		}
+		sd.files = append(sd.files[:i:i], sd.files[i+1:]...)
+		target.files = append(target.files, f)
+		return nil
+	}
+
+	for i, d := range sd.directories {
+		if d.name != req.OldName {
+			continue
+		}
+		if target.findFile(req.NewName) >= 0 {
+			return fuse.Errno(syscall.ENOTDIR)
+		}
+		// an existing directory at the destination is replaced if it is empty
+		if j := target.findDir(req.NewName); j >= 0 {
+			existing := target.directories[j]
+			if existing == d {
+				return nil
+			}
+			if len(existing.directories) > 0 || len(existing.files) > 0 {
+				return fuse.Errno(syscall.ENOTEMPTY)
+			}
+			target.directories = append(target.directories[:j:j], target.directories[j+1:]...)
+			if target == sd {
+				i = sd.findDir(req.OldName)
+			}
+		}
+		newPath := filepath.Join(target.path, req.NewName)
+		if err := moveFilesInSwarm(sd.mountInfo, d.moves(newPath)); err != nil {
+			return err
+		}
+		d.setPath(newPath)
+		sd.directories = append(sd.directories[:i:i], sd.directories[i+1:]...)
+		target.directories = append(target.directories, d)
+		return nil
+	}
+	return fuse.ENOENT
+}
+
+func (sd *SwarmDir) findFile(name string) int {
+	for i, f := range sd.files {
+		if f.name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+func (sd *SwarmDir) findDir(name string) int {
+	for i, d := range sd.directories {
+		if d.name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// moves returns the new locations of all files below the directory if it
+// were moved to the given path
+func (sd *SwarmDir) moves(fullpath string) []fileMove {
+	sd.lock.RLock()
+	defer sd.lock.RUnlock()
+
+	var moves []fileMove
+	for _, f := range sd.files {
+		moves = append(moves, fileMove{f, fullpath, f.name})
+	}
+	for _, d := range sd.directories {
+		moves = append(moves, d.moves(filepath.Join(fullpath, d.name))...)
+	}
+	return moves
+}
+
+// setPath updates the path of the directory and all its subdirectories
+func (sd *SwarmDir) setPath(fullpath string) {
+	sd.lock.Lock()
+	defer sd.lock.Unlock()
+
+	sd.path = fullpath
+	sd.name = filepath.Base(fullpath)
+	for _, d := range sd.directories {
+		d.setPath(filepath.Join(fullpath, d.name))
+	}
+}
@@ -41,9 +41,12 @@ var (
 )
 
 var (
-	_ fs.Node         = (*SwarmFile)(nil)
-	_ fs.HandleReader = (*SwarmFile)(nil)
-	_ fs.HandleWriter = (*SwarmFile)(nil)
+	_ fs.Node           = (*SwarmFile)(nil)
+	_ fs.HandleReader   = (*SwarmFile)(nil)
+	_ fs.HandleWriter   = (*SwarmFile)(nil)
+	_ fs.HandleReleaser = (*SwarmFile)(nil)
+	_ fs.NodeFsyncer    = (*SwarmFile)(nil)
+	_ fs.NodeSetattrer  = (*SwarmFile)(nil)
 )
 
 type SwarmFile struct {
@@ -52,7 +55,11 @@ type SwarmFile struct {
 	path     string
 	key      storage.Key
 	fileSize int64
-	reader   storage.LazySectionReader
+
+	// write-back cache, holds the full contents of the file while it is
+	// being modified until it is synced to swarm
+	data  []byte
+	dirty bool
 
 	mountInfo *MountInfo
 	lock      *sync.RWMutex
@@ -65,7 +72,6 @@ func NewSwarmFile(path, fname string, minfo *MountInfo) *SwarmFile {
 		path:     path,
 		key:      nil,
 		fileSize: -1, // -1 means , file already exists in swarm and you need to just get the size from swarm
-		reader:   nil,
 
 		mountInfo: minfo,
 		lock:      &sync.RWMutex{},
@@ -81,6 +87,8 @@ func (file *SwarmFile) Attr(ctx context.Context, a *fuse.Attr) error {
 	a.Uid = uint32(os.Getuid())
 	a.Gid = uint32(os.Getegid())
 
+	file.lock.Lock()
+	defer file.lock.Unlock()
 	if file.fileSize == -1 {
 		reader := file.mountInfo.swarmApi.Retrieve(file.key)
 		quitC := make(chan bool)
@@ -98,48 +106,115 @@ func (sf *SwarmFile) Read(ctx context.Context, req *fuse.ReadRequest, resp *fuse
 
 	sf.lock.RLock()
 	defer sf.lock.RUnlock()
-	if sf.reader == nil {
-		sf.reader = sf.mountInfo.swarmApi.Retrieve(sf.key)
+	if sf.data != nil {
+		// serve unsynced contents from the write-back cache
+		if req.Offset < int64(len(sf.data)) {
+			end := req.Offset + int64(req.Size)
+			if end > int64(len(sf.data)) {
+				end = int64(len(sf.data))
+			}
+			resp.Data = append([]byte{}, sf.data[req.Offset:end]...)
+		}
+		return nil
 	}
+	if sf.key == nil {
+		return nil
+	}
+	reader := sf.mountInfo.swarmApi.Retrieve(sf.key)
 	buf := make([]byte, req.Size)
-	n, err := sf.reader.ReadAt(buf, req.Offset)
+	n, err := reader.ReadAt(buf, req.Offset)
 	if err == io.ErrUnexpectedEOF || err == io.EOF {
 		err = nil
 	}
 	resp.Data = buf[:n]
-	sf.reader = nil
 	return err
 
 }
 
+// Write only modifies the write-back cache, the contents are stored in swarm
+// when the file is synced or released
 func (sf *SwarmFile) Write(ctx context.Context, req *fuse.WriteRequest, resp *fuse.WriteResponse) error {
 
-	if sf.fileSize == 0 && req.Offset == 0 {
+	sf.lock.Lock()
+	defer sf.lock.Unlock()
+	if err := sf.loadData(); err != nil {
+		return err
+	}
+	if req.Offset > int64(len(sf.data)) {
+		log.Warn("Invalid write request", "size", len(sf.data), "offset", req.Offset)
+		return errInvalidOffset
+	}
+	end := req.Offset + int64(len(req.Data))
+	if end > MaxAppendFileSize {
+		log.Warn("Max file size reached", "size", len(sf.data), "write", len(req.Data))
+		return errFileSizeMaxLimixReached
+	}
+	if end > int64(len(sf.data)) {
+		sf.data = append(sf.data, make([]byte, end-int64(len(sf.data)))...)
+	}
+	copy(sf.data[req.Offset:], req.Data)
+	sf.fileSize = int64(len(sf.data))
+	sf.dirty = true
 
-		// A new file is created
-		err := addFileToSwarm(sf, req.Data, len(req.Data))
-		if err != nil {
-			return err
-		}
-		resp.Size = len(req.Data)
+	resp.Size = len(req.Data)
+	return nil
+}
 
-	} else if req.Offset <= sf.fileSize {
+// Setattr handles truncation of the file, other attributes are fixed
+func (sf *SwarmFile) Setattr(ctx context.Context, req *fuse.SetattrRequest, resp *fuse.SetattrResponse) error {
 
-		totalSize := sf.fileSize + int64(len(req.Data))
-		if totalSize > MaxAppendFileSize {
-			log.Warn("Append file size reached (%v) : (%v)", sf.fileSize, len(req.Data))
-			return errFileSizeMaxLimixReached
-		}
+	if !req.Valid.Size() {
+		return nil
+	}
+	if req.Size > MaxAppendFileSize {
+		return errFileSizeMaxLimixReached
+	}
 
-		err := appendToExistingFileInSwarm(sf, req.Data, req.Offset, int64(len(req.Data)))
-		if err != nil {
-			return err
-		}
-		resp.Size = len(req.Data)
+	sf.lock.Lock()
+	defer sf.lock.Unlock()
+	if sf.fileSize == int64(req.Size) {
+		return nil
+	}
+	if err := sf.loadData(); err != nil {
+		return err
+	}
+	if size := int(req.Size); size <= len(sf.data) {
+		sf.data = sf.data[:size]
 	} else {
-		log.Warn("Invalid write request size(%v) : off(%v)", sf.fileSize, req.Offset)
-		return errInvalidOffset
+		sf.data = append(sf.data, make([]byte, size-len(sf.data))...)
 	}
+	sf.fileSize = int64(len(sf.data))
+	sf.dirty = true
+	return nil
+}
 
+func (sf *SwarmFile) Fsync(ctx context.Context, req *fuse.FsyncRequest) error {
+	return syncFilesToSwarm(sf.mountInfo, []*SwarmFile{sf})
+}
+
+func (sf *SwarmFile) Release(ctx context.Context, req *fuse.ReleaseRequest) error {
+	return syncFilesToSwarm(sf.mountInfo, []*SwarmFile{sf})
+}
+
+// loadData fills the write-back cache with the current contents of the file,
+// the caller must hold the file lock
+func (sf *SwarmFile) loadData() error {
+	if sf.data != nil {
+		return nil
+	}
+	if sf.key == nil {
+		sf.data = []byte{}
+		return nil
+	}
+	reader := sf.mountInfo.swarmApi.Retrieve(sf.key)
+	size, err := reader.Size(nil)
+	if err != nil {
+		return err
+	}
+	data := make([]byte, size)
+	if _, err := reader.ReadAt(data, 0); err != nil && err != io.EOF {
+		return err
+	}
+	sf.data = data
 	return nil
 }
@@ -42,6 +42,10 @@ func (self *SwarmFS) Unmount(mountpoint string) (bool, error) {
 	return false, errNoFUSE
 }
 
+func (self *SwarmFS) Commit(mountpoint string) (string, error) {
+	return "", errNoFUSE
+}
+
 func (self *SwarmFS) Listmounts() ([]*MountInfo, error) {
 	return nil, errNoFUSE
 }
@@ -803,6 +803,190 @@ func (ta *testAPI) appendFileContentsToEnd(t *testing.T) {
 	checkFile(t, testMountDir, "1.txt", line1and2)
 }
 
+func (ta *testAPI) renameFile(t *testing.T) {
+	files := make(map[string]fileInfo)
+	testUploadDir, _ := ioutil.TempDir(os.TempDir(), "rename-upload")
+	testMountDir, _ := ioutil.TempDir(os.TempDir(), "rename-mount")
+
+	files["1.txt"] = fileInfo{0700, 333, 444, getRandomBtes(10)}
+	files["one/2.txt"] = fileInfo{0700, 333, 444, getRandomBtes(10)}
+	bzzHash := createTestFilesAndUploadToSwarm(t, ta.api, files, testUploadDir)
+
+	swarmfs1 := mountDir(t, ta.api, files, bzzHash, testMountDir)
+	defer swarmfs1.Stop()
+
+	err := os.Rename(filepath.Join(testMountDir, "1.txt"), filepath.Join(testMountDir, "one", "3.txt"))
+	if err != nil {
+		t.Fatalf("Could not rename file: %v", err)
+	}
+
+	mi, err2 := swarmfs1.Unmount(testMountDir)
+	if err2 != nil {
+		t.Fatalf("Could not unmount %v ", err2)
+	}
+
+	// mount again and see if things are okay
+	files["one/3.txt"] = files["1.txt"]
+	delete(files, "1.txt")
+	swarmfs2 := mountDir(t, ta.api, files, mi.LatestManifest, testMountDir)
+	defer swarmfs2.Stop()
+}
+
+func (ta *testAPI) renameDir(t *testing.T) {
+	files := make(map[string]fileInfo)
+	testUploadDir, _ := ioutil.TempDir(os.TempDir(), "renamedir-upload")
+	testMountDir, _ := ioutil.TempDir(os.TempDir(), "renamedir-mount")
+
+	files["1.txt"] = fileInfo{0700, 333, 444, getRandomBtes(10)}
+	files["one/2.txt"] = fileInfo{0700, 333, 444, getRandomBtes(10)}
+	files["one/two/3.txt"] = fileInfo{0700, 333, 444, getRandomBtes(10)}
+	bzzHash := createTestFilesAndUploadToSwarm(t, ta.api, files, testUploadDir)
+
+	swarmfs1 := mountDir(t, ta.api, files, bzzHash, testMountDir)
+	defer swarmfs1.Stop()
+
+	err := os.Rename(filepath.Join(testMountDir, "one"), filepath.Join(testMountDir, "uno"))
+	if err != nil {
+		t.Fatalf("Could not rename directory: %v", err)
+	}
+	contents := getRandomBtes(10)
+	if err := ioutil.WriteFile(filepath.Join(testMountDir, "uno", "two", "4.txt"), contents, 0700); err != nil {
+		t.Fatalf("Could not create file in renamed directory: %v", err)
+	}
+
+	mi, err2 := swarmfs1.Unmount(testMountDir)
+	if err2 != nil {
+		t.Fatalf("Could not unmount %v ", err2)
+	}
+
+	// mount again and see if things are okay
+	files["uno/2.txt"] = files["one/2.txt"]
+	files["uno/two/3.txt"] = files["one/two/3.txt"]
+	files["uno/two/4.txt"] = fileInfo{0700, 333, 444, contents}
+	delete(files, "one/2.txt")
+	delete(files, "one/two/3.txt")
+	swarmfs2 := mountDir(t, ta.api, files, mi.LatestManifest, testMountDir)
+	defer swarmfs2.Stop()
+}
+
+func (ta *testAPI) truncateFile(t *testing.T) {
+	files := make(map[string]fileInfo)
+	testUploadDir, _ := ioutil.TempDir(os.TempDir(), "truncate-upload")
+	testMountDir, _ := ioutil.TempDir(os.TempDir(), "truncate-mount")
+
+	files["1.txt"] = fileInfo{0700, 333, 444, getRandomBtes(100)}
+	files["2.txt"] = fileInfo{0700, 333, 444, getRandomBtes(100)}
+	bzzHash := createTestFilesAndUploadToSwarm(t, ta.api, files, testUploadDir)
+
+	swarmfs1 := mountDir(t, ta.api, files, bzzHash, testMountDir)
+	defer swarmfs1.Stop()
+
+	if err := os.Truncate(filepath.Join(testMountDir, "1.txt"), 40); err != nil {
+		t.Fatalf("Could not truncate file: %v", err)
+	}
+	// opening with O_TRUNC discards the contents before writing
+	contents := getRandomBtes(10)
+	if err := ioutil.WriteFile(filepath.Join(testMountDir, "2.txt"), contents, 0700); err != nil {
+		t.Fatalf("Could not overwrite file: %v", err)
+	}
+	checkFile(t, testMountDir, "1.txt", files["1.txt"].contents[:40])
+	checkFile(t, testMountDir, "2.txt", contents)
+
+	mi, err2 := swarmfs1.Unmount(testMountDir)
+	if err2 != nil {
+		t.Fatalf("Could not unmount %v ", err2)
+	}
+
+	// mount again and see if things are okay
+	files["1.txt"] = fileInfo{0700, 333, 444, files["1.txt"].contents[:40]}
+	files["2.txt"] = fileInfo{0700, 333, 444, contents}
+	swarmfs2 := mountDir(t, ta.api, files, mi.LatestManifest, testMountDir)
+	defer swarmfs2.Stop()
+}
+
+func (ta *testAPI) removeNonEmptyDir(t *testing.T) {
+	files := make(map[string]fileInfo)
+	testUploadDir, _ := ioutil.TempDir(os.TempDir(), "rmnonempty-upload")
+	testMountDir, _ := ioutil.TempDir(os.TempDir(), "rmnonempty-mount")
+
+	files["one/1.txt"] = fileInfo{0700, 333, 444, getRandomBtes(10)}
+	bzzHash := createTestFilesAndUploadToSwarm(t, ta.api, files, testUploadDir)
+
+	swarmfs1 := mountDir(t, ta.api, files, bzzHash, testMountDir)
+	defer swarmfs1.Stop()
+
+	if err := os.Remove(filepath.Join(testMountDir, "one")); err == nil {
+		t.Fatalf("Expected error removing non-empty directory")
+	}
+
+	mi, err2 := swarmfs1.Unmount(testMountDir)
+	if err2 != nil {
+		t.Fatalf("Could not unmount %v ", err2)
+	}
+	if bzzHash != mi.LatestManifest {
+		t.Fatalf("same contents different hash orig(%v): new(%v)", bzzHash, mi.LatestManifest)
+	}
+}
+
+func (ta *testAPI) syncAndCommit(t *testing.T) {
+	files := make(map[string]fileInfo)
+	testUploadDir, _ := ioutil.TempDir(os.TempDir(), "commit-upload")
+	testMountDir, _ := ioutil.TempDir(os.TempDir(), "commit-mount")
+
+	files["1.txt"] = fileInfo{0700, 333, 444, getRandomBtes(10)}
+	bzzHash := createTestFilesAndUploadToSwarm(t, ta.api, files, testUploadDir)
+
+	swarmfs1 := mountDir(t, ta.api, files, bzzHash, testMountDir)
+	defer swarmfs1.Stop()
+
+	// writes are cached until the file is synced
+	actualPath := filepath.Join(testMountDir, "2.txt")
+	fd, err := os.OpenFile(actualPath, os.O_RDWR|os.O_CREATE, os.FileMode(0665))
+	if err != nil {
+		t.Fatalf("Could not create file %s : %v", actualPath, err)
+	}
+	defer fd.Close()
+	line1, line2 := getRandomBtes(10), getRandomBtes(10)
+	fd.Write(line1)
+	fd.Write(line2)
+
+	hash, err := swarmfs1.Commit(testMountDir)
+	if err != nil {
+		t.Fatalf("Could not commit: %v", err)
+	}
+	if hash == bzzHash {
+		t.Fatalf("Commit did not change the manifest hash")
+	}
+	hash2, err := swarmfs1.Commit(testMountDir)
+	if err != nil {
+		t.Fatalf("Could not commit: %v", err)
+	}
+	if hash2 != hash {
+		t.Fatalf("Commit without changes changed the hash: %v, %v", hash, hash2)
+	}
+
+	// fsync stores further writes
+	line3 := getRandomBtes(10)
+	fd.Write(line3)
+	if err := fd.Sync(); err != nil {
+		t.Fatalf("Could not sync file: %v", err)
+	}
+	for _, mi := range swarmfs1.Listmounts() {
+		if mi.MountPoint == testMountDir && mi.LatestManifest == hash {
+			t.Fatalf("Fsync did not change the manifest hash")
+		}
+	}
+
+	// the committed manifest contains the writes before the commit
+	testMountDir2, _ := ioutil.TempDir(os.TempDir(), "commit-mount2")
+	files["2.txt"] = fileInfo{0700, 333, 444, bytes.Join([][]byte{line1, line2}, nil)}
+	swarmfs2 := mountDir(t, ta.api, files, hash, testMountDir2)
+	defer swarmfs2.Stop()
+	if _, err := swarmfs2.Unmount(testMountDir2); err != nil {
+		t.Fatalf("Could not unmount %v ", err)
+	}
+}
+
 func TestFUSE(t *testing.T) {
 	datadir, err := ioutil.TempDir("", "fuse")
 	if err != nil {
@@ -814,7 +998,7 @@ func TestFUSE(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	ta := &testAPI{api: api.NewApi(dpa, nil)}
+	ta := &testAPI{api: api.NewApi(dpa, nil, nil)}
 	dpa.Start()
 	defer dpa.Stop()
 
@@ -835,4 +1019,9 @@ func TestFUSE(t *testing.T) {
 	t.Run("removeDirWhichHasFiles", ta.removeDirWhichHasFiles)
 	t.Run("removeDirWhichHasSubDirs", ta.removeDirWhichHasSubDirs)
 	t.Run("appendFileContentsToEnd", ta.appendFileContentsToEnd)
+	t.Run("renameFile", ta.renameFile)
+	t.Run("renameDir", ta.renameDir)
+	t.Run("truncateFile", ta.truncateFile)
+	t.Run("removeNonEmptyDir", ta.removeNonEmptyDir)
+	t.Run("syncAndCommit", ta.syncAndCommit)
 }
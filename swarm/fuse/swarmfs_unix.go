@@ -206,12 +206,43 @@ func (self *SwarmFS) Unmount(mountpoint string) (*MountInfo, error) {
 	mountInfo.fuseConnection.Close()
 	delete(self.activeMounts, cleanedMountPoint)
 
+	// store whatever is left in the write-back cache
+	if err := syncFilesToSwarm(mountInfo, dirtyFiles(mountInfo.rootDir)); err != nil {
+		log.Warn("Error syncing files on unmount", "mountpoint", cleanedMountPoint, "err", err)
+		return nil, err
+	}
+
 	succString := fmt.Sprintf("UnMounting %v succeeded", cleanedMountPoint)
 	log.Info(succString)
 
 	return mountInfo, nil
 }
 
+// Commit stores all pending changes of the given mount in swarm and returns
+// the resulting manifest hash
+func (self *SwarmFS) Commit(mountpoint string) (string, error) {
+
+	self.swarmFsLock.RLock()
+	defer self.swarmFsLock.RUnlock()
+
+	cleanedMountPoint, err := filepath.Abs(filepath.Clean(mountpoint))
+	if err != nil {
+		return "", err
+	}
+	mountInfo := self.activeMounts[cleanedMountPoint]
+	if mountInfo == nil {
+		return "", fmt.Errorf("%s is not mounted", cleanedMountPoint)
+	}
+	if err := syncFilesToSwarm(mountInfo, dirtyFiles(mountInfo.rootDir)); err != nil {
+		return "", err
+	}
+
+	mountInfo.lock.RLock()
+	defer mountInfo.lock.RUnlock()
+	log.Info("Committed swarm FUSE FS", "mountpoint", cleanedMountPoint, "manifest", mountInfo.LatestManifest)
+	return mountInfo.LatestManifest, nil
+}
+
 func (self *SwarmFS) Listmounts() []*MountInfo {
 	self.swarmFsLock.RLock()
 	defer self.swarmFsLock.RUnlock()
@@ -19,12 +19,20 @@
 package fuse
 
 import (
+	"bytes"
 	"context"
 	"fmt"
+	"mime"
 	"os/exec"
+	"path/filepath"
 	"runtime"
+	"strings"
+	"time"
 
+	"github.com/wiseplat/go-wiseplat/common"
 	"github.com/wiseplat/go-wiseplat/log"
+	"github.com/wiseplat/go-wiseplat/swarm/api"
+	"github.com/wiseplat/go-wiseplat/swarm/storage"
 )
 
 func externalUnmount(mountPoint string) error {
@@ -46,83 +54,171 @@ func externalUnmount(mountPoint string) error {
 	}
 }
 
-func addFileToSwarm(sf *SwarmFile, content []byte, size int) error {
+// updateManifest applies the given changes to the latest manifest of the mount
+// and stores the result as the new latest manifest
+func updateManifest(mi *MountInfo, update func(mw *api.ManifestWriter) error) error {
+	mi.lock.Lock()
+	defer mi.lock.Unlock()
 
-	fkey, mhash, err := sf.mountInfo.swarmApi.AddFile(sf.mountInfo.LatestManifest, sf.path, sf.name, content, true)
+	mw, err := mi.swarmApi.NewManifestWriter(storage.Key(common.Hex2Bytes(mi.LatestManifest)), nil)
 	if err != nil {
 		return err
 	}
-
-	sf.lock.Lock()
-	defer sf.lock.Unlock()
-	sf.key = fkey
-	sf.fileSize = int64(size)
-
-	sf.mountInfo.lock.Lock()
-	defer sf.mountInfo.lock.Unlock()
-	sf.mountInfo.LatestManifest = mhash
-
-	log.Info("Added new file:", "fname", sf.name, "New Manifest hash", mhash)
-	return nil
-
-}
-
-func removeFileFromSwarm(sf *SwarmFile) error {
-
-	mkey, err := sf.mountInfo.swarmApi.RemoveFile(sf.mountInfo.LatestManifest, sf.path, sf.name, true)
+	if err := update(mw); err != nil {
+		return err
+	}
+	mkey, err := mw.Store()
 	if err != nil {
 		return err
 	}
-
-	sf.mountInfo.lock.Lock()
-	defer sf.mountInfo.lock.Unlock()
-	sf.mountInfo.LatestManifest = mkey
-
-	log.Info("Removed file:", "fname", sf.name, "New Manifest hash", mkey)
+	mi.LatestManifest = mkey.String()
 	return nil
 }
 
-func removeDirectoryFromSwarm(sd *SwarmDir) error {
+// manifestPath returns the manifest path of the file with the given name in
+// the given directory of the mount
+func manifestPath(dir, fname string) string {
+	return strings.TrimPrefix(filepath.Join(dir, fname), "/")
+}
 
-	if len(sd.directories) == 0 && len(sd.files) == 0 {
-		return nil
+func manifestEntry(sf *SwarmFile) *api.ManifestEntry {
+	return &api.ManifestEntry{
+		Path:        manifestPath(sf.path, sf.name),
+		ContentType: mime.TypeByExtension(filepath.Ext(sf.name)),
+		Mode:        0700,
+		ModTime:     time.Now(),
 	}
+}
 
-	for _, d := range sd.directories {
-		err := removeDirectoryFromSwarm(d)
-		if err != nil {
-			return err
+// syncFilesToSwarm stores the write-back cache of all modified files in swarm
+// and updates the mount's manifest once for all of them
+func syncFilesToSwarm(mi *MountInfo, files []*SwarmFile) error {
+	var dirty []*SwarmFile
+	for _, sf := range files {
+		sf.lock.RLock()
+		if sf.dirty {
+			dirty = append(dirty, sf)
 		}
+		sf.lock.RUnlock()
+	}
+	if len(dirty) == 0 {
+		return nil
 	}
 
-	for _, f := range sd.files {
-		err := removeFileFromSwarm(f)
-		if err != nil {
-			return err
+	err := updateManifest(mi, func(mw *api.ManifestWriter) error {
+		for _, sf := range dirty {
+			sf.lock.Lock()
+			if !sf.dirty {
+				sf.lock.Unlock()
+				continue
+			}
+			entry := manifestEntry(sf)
+			entry.Size = int64(len(sf.data))
+			mw.RemoveEntry(entry.Path)
+			fkey, err := mw.AddEntry(bytes.NewReader(sf.data), entry)
+			if err != nil {
+				sf.lock.Unlock()
+				return err
+			}
+			sf.key = fkey
+			sf.fileSize = int64(len(sf.data))
+			sf.data = nil
+			sf.dirty = false
+			sf.lock.Unlock()
 		}
+		return nil
+	})
+	if err != nil {
+		return err
 	}
-
+	log.Info("Synced files", "count", len(dirty), "New Manifest hash", mi.LatestManifest)
 	return nil
-
 }
 
-func appendToExistingFileInSwarm(sf *SwarmFile, content []byte, offset int64, length int64) error {
+func removeFileFromSwarm(sf *SwarmFile) error {
+
+	sf.lock.Lock()
+	sf.data = nil
+	sf.dirty = false
+	stored := sf.key != nil
+	sf.lock.Unlock()
 
-	fkey, mhash, err := sf.mountInfo.swarmApi.AppendFile(sf.mountInfo.LatestManifest, sf.path, sf.name, sf.fileSize, content, sf.key, offset, length, true)
+	// files which were never synced are not part of the manifest
+	if !stored {
+		return nil
+	}
+	err := updateManifest(sf.mountInfo, func(mw *api.ManifestWriter) error {
+		return mw.RemoveEntry(manifestPath(sf.path, sf.name))
+	})
 	if err != nil {
 		return err
 	}
 
-	sf.lock.Lock()
-	defer sf.lock.Unlock()
-	sf.key = fkey
-	sf.fileSize = sf.fileSize + int64(len(content))
+	log.Info("Removed file:", "fname", sf.name, "New Manifest hash", sf.mountInfo.LatestManifest)
+	return nil
+}
 
-	sf.mountInfo.lock.Lock()
-	defer sf.mountInfo.lock.Unlock()
-	sf.mountInfo.LatestManifest = mhash
+// fileMove describes the new location of a file being renamed
+type fileMove struct {
+	file  *SwarmFile
+	path  string
+	fname string
+}
 
-	log.Info("Appended file:", "fname", sf.name, "New Manifest hash", mhash)
+// moveFilesInSwarm moves the manifest entries of the given files to their new
+// locations without storing the contents again. The files are only renamed once
+// the updated manifest is stored, so a failure leaves them at their old paths.
+func moveFilesInSwarm(mi *MountInfo, moves []fileMove) error {
+	err := updateManifest(mi, func(mw *api.ManifestWriter) error {
+		for _, m := range moves {
+			m.file.lock.RLock()
+			if m.file.key != nil {
+				mw.RemoveEntry(manifestPath(m.file.path, m.file.name))
+
+				entry := manifestEntry(m.file)
+				entry.Path = manifestPath(m.path, m.fname)
+				entry.ContentType = mime.TypeByExtension(filepath.Ext(m.fname))
+				entry.Hash = m.file.key.String()
+				if m.file.fileSize >= 0 && !m.file.dirty {
+					entry.Size = m.file.fileSize
+				}
+				if err := mw.AddEntryRef(entry); err != nil {
+					m.file.lock.RUnlock()
+					return err
+				}
+			}
+			m.file.lock.RUnlock()
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, m := range moves {
+		m.file.lock.Lock()
+		m.file.path, m.file.name = m.path, m.fname
+		m.file.lock.Unlock()
+	}
+	log.Info("Moved files", "count", len(moves), "New Manifest hash", mi.LatestManifest)
 	return nil
+}
 
+// dirtyFiles returns all files below the given directory which have changes
+// not yet synced to swarm
+func dirtyFiles(sd *SwarmDir) []*SwarmFile {
+	sd.lock.RLock()
+	defer sd.lock.RUnlock()
+
+	var files []*SwarmFile
+	for _, f := range sd.files {
+		f.lock.RLock()
+		if f.dirty {
+			files = append(files, f)
+		}
+		f.lock.RUnlock()
+	}
+	for _, d := range sd.directories {
+		files = append(files, dirtyFiles(d)...)
+	}
+	return files
 }
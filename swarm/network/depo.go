@@ -130,6 +130,13 @@ func (self *Depo) HandleStoreRequestMsg(req *storeRequestMsgData, p *peer) {
 		return
 	}
 
+	// swap - deliveries answering our own retrieve requests are credited
+	if req.Id != 0 && p.untrackRequest(req.Id) && p.swap != nil {
+		if err := p.swap.Add(-1); err != nil {
+			log.Warn(fmt.Sprintf("Depo.HandleStoreRequest: %v - cannot credit delivery: %v", req.Key.Log(), err))
+		}
+	}
+
 	if islocal {
 		return
 	}
@@ -142,19 +149,9 @@ func (self *Depo) HandleStoreRequestMsg(req *storeRequestMsgData, p *peer) {
 }
 
 // entrypoint for retrieve requests coming from the bzz wire protocol
-// checks swap balance - return if peer has no credit
+// swap - the peer is charged for each chunk actually delivered
 func (self *Depo) HandleRetrieveRequestMsg(req *retrieveRequestMsgData, p *peer) {
 	req.from = p
-	// swap - record credit for 1 request
-	// note that only charge actual reqsearches
-	var err error
-	if p.swap != nil {
-		err = p.swap.Add(1)
-	}
-	if err != nil {
-		log.Warn(fmt.Sprintf("Depo.HandleRetrieveRequest: %v - cannot process request: %v", req.Key.Log(), err))
-		return
-	}
 
 	// call storage.NetStore#Get which
 	// blocks until local retrieval finished
@@ -166,6 +163,10 @@ func (self *Depo) HandleRetrieveRequestMsg(req *retrieveRequestMsgData, p *peer)
 		log.Trace(fmt.Sprintf("Depo.HandleRetrieveRequest: %v - content found, delivering...", req.Key.Log()))
 
 		if req.MaxSize == 0 || int64(req.MaxSize) >= chunk.Size {
+			if err := charge(p); err != nil {
+				log.Warn(fmt.Sprintf("Depo.HandleRetrieveRequest: %v - cannot process request: %v", req.Key.Log(), err))
+				return
+			}
 			sreq := &storeRequestMsgData{
 				Id:             req.Id,
 				Key:            chunk.Key,
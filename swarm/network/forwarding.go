@@ -52,6 +52,10 @@ func generateId() uint64 {
 
 var searchTimeout = 3 * time.Second
 
+// requestTrackTimeout is the time after which a delivery answering one of our
+// retrieve requests is no longer credited to the delivering peer
+var requestTrackTimeout = 10 * searchTimeout
+
 // forwarding logic
 // logic propagating retrieve requests to peers given by the kademlia hive
 func (self *forwarder) Retrieve(chunk *storage.Chunk) {
@@ -68,19 +72,23 @@ OUT:
 				}
 			}
 		}
+		// only ask peers we are able to pay for the delivery
+		if p.swap != nil && !p.swap.Buys {
+			log.Trace(fmt.Sprintf("forwarder.Retrieve: not buying from peer [%v], skipping %v", p, chunk.Key.Log()))
+			continue
+		}
 		req := &retrieveRequestMsgData{
 			Key: chunk.Key,
 			Id:  generateId(),
 		}
-		var err error
-		if p.swap != nil {
-			err = p.swap.Add(-1)
-		}
-		if err == nil {
-			p.retrieve(req)
-			break OUT
+		// the peer is credited once the delivery arrives
+		p.trackRequest(req.Id)
+		if err := p.retrieve(req); err != nil {
+			p.untrackRequest(req.Id)
+			log.Warn(fmt.Sprintf("forwarder.Retrieve: unable to send retrieveRequest to peer [%v]: %v", chunk.Key.Log(), err))
+			continue
 		}
-		log.Warn(fmt.Sprintf("forwarder.Retrieve: unable to send retrieveRequest to peer [%v]: %v", chunk.Key.Log(), err))
+		break OUT
 	}
 }
 
@@ -113,18 +121,22 @@ func (self *forwarder) Deliver(chunk *storage.Chunk) {
 	// iterate over request entries
 	for id, requesters := range chunk.Req.Requesters {
 		counter := requesterCount
-		msg := &storeRequestMsgData{
-			Key:   chunk.Key,
-			SData: chunk.SData,
-		}
 		var n int
 		var req *retrieveRequestMsgData
 		// iterate over requesters with the same id
-		for id, r := range requesters {
+		for _, r := range requesters {
 			req = r.(*retrieveRequestMsgData)
 			if req.timeout == nil || req.timeout.After(time.Now()) {
 				log.Trace(fmt.Sprintf("forwarder.Deliver: %v -> %v", req.Id, req.from))
-				msg.Id = uint64(id)
+				if err := charge(req.from); err != nil {
+					log.Warn(fmt.Sprintf("forwarder.Deliver: %v - not delivering to peer [%v]: %v", chunk.Key.Log(), req.from, err))
+					continue
+				}
+				msg := &storeRequestMsgData{
+					Key:   chunk.Key,
+					SData: chunk.SData,
+					Id:    req.Id,
+				}
 				Deliver(req.from, msg, DeliverReq)
 				n++
 				counter--
@@ -137,6 +149,15 @@ func (self *forwarder) Deliver(chunk *storage.Chunk) {
 	}
 }
 
+// charge debits the SWAP balance of a peer for one chunk delivered to it
+// swap drops the peer if it went beyond the disconnect threshold without paying
+func charge(p *peer) error {
+	if p.swap == nil {
+		return nil
+	}
+	return p.swap.Add(1)
+}
+
 // initiate delivery of a chunk to a particular peer via syncer#addRequest
 // depending on syncer mode and priority settings and sync request type
 // this either goes via confirmation roundtrip or queued or pushed directly
@@ -270,6 +270,20 @@ func (self *Hive) DropAll() {
 	}
 }
 
+// SwapBalances returns the SWAP balance with each connected peer that has a
+// SWAP arrangement, keyed by node ID. Positive balances are owed to us by the
+// peer, negative ones are owed by us to the peer.
+func (self *Hive) SwapBalances() map[string]int {
+	balances := make(map[string]int)
+	for _, node := range self.kad.Nodes() {
+		p := node.(*peer)
+		if p.swap != nil {
+			balances[p.peer.ID().String()] = p.swap.Balance()
+		}
+	}
+	return balances
+}
+
 // contructor for kademlia.NodeRecord based on peer address alone
 // TODO: should go away and only addr passed to kademlia
 func newNodeRecord(addr *peerAddr) *kademlia.NodeRecord {
@@ -108,6 +108,17 @@ func (self *Kademlia) Count() int {
 	return self.count
 }
 
+// accessor for all KAD active nodes, across all proximity bins
+func (self *Kademlia) Nodes() []Node {
+	defer self.lock.RUnlock()
+	self.lock.RLock()
+	var nodes []Node
+	for _, bucket := range self.buckets {
+		nodes = append(nodes, bucket...)
+	}
+	return nodes
+}
+
 // accessor for KAD active node count
 func (self *Kademlia) DBCount() int {
 	return self.db.count()
@@ -68,6 +68,33 @@ func TestOn(t *testing.T) {
 	_ = err
 }
 
+func TestNodes(t *testing.T) {
+	addr, _ := gen(Address{}, quickrand).(Address)
+	kad := New(addr, NewKadParams())
+
+	// one node in each proximity bin, not just the bin of any single target
+	var nodes []*testNode
+	for po := 0; po <= kad.MaxProx; po++ {
+		node := &testNode{addr: RandomAddressAt(addr, po)}
+		if err := kad.On(node, nil); err != nil {
+			t.Fatalf("backend not accepting node: %v", err)
+		}
+		nodes = append(nodes, node)
+	}
+	found := make(map[Address]bool)
+	for _, node := range kad.Nodes() {
+		found[node.Addr()] = true
+	}
+	if len(found) != len(nodes) {
+		t.Fatalf("incorrect number of nodes, expected %d, got %d", len(nodes), len(found))
+	}
+	for _, node := range nodes {
+		if !found[node.addr] {
+			t.Errorf("node %v missing", node)
+		}
+	}
+}
+
 func TestBootstrap(t *testing.T) {
 
 	test := func(test *bootstrapTest) bool {
@@ -35,6 +35,7 @@ import (
 	"fmt"
 	"net"
 	"strconv"
+	"sync"
 	"time"
 
 	"github.com/wiseplat/go-wiseplat/contracts/chequebook"
@@ -73,6 +74,9 @@ type bzz struct {
 	syncer      *syncer             // syncer instance for the peer connection
 	syncParams  *SyncParams         // syncer params
 	syncState   *syncState          // outgoing syncronisation state (contains reference to remote peers db counter)
+
+	requests   map[uint64]time.Time // retrieve requests sent to the peer awaiting delivery
+	requestsMu sync.Mutex           // protects requests
 }
 
 // interface type for handler of storage/retrieval related requests coming
@@ -144,6 +148,7 @@ func run(requestDb *storage.LDBDatabase, depo StorageHandler, backend chequebook
 		swapEnabled: hive.swapEnabled,
 		syncEnabled: true,
 		NetworkId:   networkId,
+		requests:    make(map[uint64]time.Time),
 	}
 
 	// handle handshake
@@ -293,7 +298,13 @@ func (self *bzz) handle() error {
 				return fmt.Errorf("<- %v: %v", msg, err)
 			}
 			log.Debug(fmt.Sprintf("<- payment: %s", req.String()))
-			self.swap.Receive(int(req.Units), req.Promise)
+			if self.swap == nil {
+				return fmt.Errorf("<- %v: unexpected payment, no SWAP arrangement", msg)
+			}
+			// an invalid cheque is a breach of the SWAP arrangement
+			if err := self.swap.Receive(int(req.Units), req.Promise); err != nil {
+				return fmt.Errorf("<- %v: %v", msg, err)
+			}
 		}
 
 	default:
@@ -447,6 +458,34 @@ func (self *bzz) retrieve(req *retrieveRequestMsgData) error {
 	return self.send(retrieveRequestMsg, req)
 }
 
+// trackRequest records a retrieve request sent to the peer, so that the
+// delivery answering it can be credited to the peer's SWAP balance
+func (self *bzz) trackRequest(id uint64) {
+	self.requestsMu.Lock()
+	defer self.requestsMu.Unlock()
+
+	now := time.Now()
+	for reqId, expiry := range self.requests {
+		if expiry.Before(now) {
+			delete(self.requests, reqId)
+		}
+	}
+	self.requests[id] = now.Add(requestTrackTimeout)
+}
+
+// untrackRequest removes a retrieve request from the set of requests awaiting
+// delivery, reporting whether the request was sent to the peer by us
+func (self *bzz) untrackRequest(id uint64) bool {
+	self.requestsMu.Lock()
+	defer self.requestsMu.Unlock()
+
+	if _, ok := self.requests[id]; !ok {
+		return false
+	}
+	delete(self.requests, id)
+	return true
+}
+
 // send storeRequestMsg
 func (self *bzz) store(req *storeRequestMsgData) error {
 	return self.send(storeRequestMsg, req)
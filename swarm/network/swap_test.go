@@ -0,0 +1,237 @@
+// Copyright 2018 The go-wiseplat Authors
+// This file is part of the go-wiseplat library.
+//
+// The go-wiseplat library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-wiseplat library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-wiseplat library. If not, see <http://www.gnu.org/licenses/>.
+
+package network
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/wiseplat/go-wiseplat/common"
+	"github.com/wiseplat/go-wiseplat/p2p"
+	"github.com/wiseplat/go-wiseplat/p2p/discover"
+	"github.com/wiseplat/go-wiseplat/swarm/network/kademlia"
+	"github.com/wiseplat/go-wiseplat/swarm/services/swap/swap"
+	"github.com/wiseplat/go-wiseplat/swarm/storage"
+)
+
+// testSwapPayment is a no-op SWAP payment handler in both directions
+type testSwapPayment struct{}
+
+func (testSwapPayment) Issue(amount *big.Int) (swap.Promise, error) {
+	return amount, nil
+}
+
+func (testSwapPayment) Receive(promise swap.Promise) (*big.Int, error) {
+	return promise.(*big.Int), nil
+}
+
+func (testSwapPayment) AutoDeposit(interval time.Duration, threshold, buffer *big.Int) {}
+func (testSwapPayment) AutoCash(interval time.Duration, maxUncashed *big.Int)          {}
+func (testSwapPayment) Stop()                                                          {}
+
+// testSwapProtocol records the payments and disconnects of a SWAP instance
+type testSwapProtocol struct {
+	paid    int
+	dropped bool
+}
+
+func (self *testSwapProtocol) Pay(units int, promise swap.Promise) { self.paid += units }
+func (self *testSwapProtocol) Drop()                               { self.dropped = true }
+func (self *testSwapProtocol) String() string                      { return "test" }
+
+// testMsgRW swallows all messages sent to a peer, recording their codes
+type testMsgRW struct {
+	sent []uint64
+}
+
+func (self *testMsgRW) ReadMsg() (p2p.Msg, error) {
+	return p2p.Msg{}, fmt.Errorf("no messages")
+}
+
+func (self *testMsgRW) WriteMsg(msg p2p.Msg) error {
+	self.sent = append(self.sent, msg.Code)
+	return msg.Discard()
+}
+
+// testChunkStore is an in-memory chunk store
+type testChunkStore map[string]*storage.Chunk
+
+func (self testChunkStore) Put(chunk *storage.Chunk) { self[string(chunk.Key)] = chunk }
+func (self testChunkStore) Close()                   {}
+
+func (self testChunkStore) Get(key storage.Key) (*storage.Chunk, error) {
+	if chunk, ok := self[string(key)]; ok {
+		return chunk, nil
+	}
+	return nil, fmt.Errorf("chunk %v not found", key.Log())
+}
+
+// newTestSwapPeer creates a peer connected to the hive with a SWAP arrangement
+// buying and selling chunks at the same price, and a syncer queueing deliveries
+func newTestSwapPeer(t *testing.T, hive *Hive, addr kademlia.Address, id byte) *peer {
+	profile := &swap.Profile{
+		BuyAt:  big.NewInt(1),
+		SellAt: big.NewInt(1),
+		PayAt:  100,
+		DropAt: 100,
+	}
+	s, err := swap.New(&swap.Params{Profile: profile, Strategy: &swap.Strategy{}}, swap.Payment{
+		Out:   testSwapPayment{},
+		In:    testSwapPayment{},
+		Buys:  true,
+		Sells: true,
+	}, &testSwapProtocol{})
+	if err != nil {
+		t.Fatalf("failed to create swap: %v", err)
+	}
+	s.SetRemote(profile)
+
+	params := NewSyncParams("")
+	syncer := &syncer{
+		SyncParams: params,
+		syncF:      func() bool { return false },
+		quit:       make(chan bool),
+	}
+	for i := range syncer.keys {
+		syncer.keys[i] = make(chan interface{}, 16)
+	}
+	p := &peer{&bzz{
+		hive:       hive,
+		remoteAddr: &peerAddr{Addr: addr},
+		peer:       p2p.NewPeer(discover.NodeID{id}, "test", nil),
+		rw:         &testMsgRW{},
+		swap:       s,
+		syncer:     syncer,
+		requests:   make(map[uint64]time.Time),
+	}}
+	if err := hive.kad.On(p, nil); err != nil {
+		t.Fatalf("failed to add peer: %v", err)
+	}
+	return p
+}
+
+// newTestChunk creates a chunk with valid data for the given hasher
+func newTestChunk(hasher storage.SwarmHasher, data []byte) *storage.Chunk {
+	sdata := make([]byte, 8+len(data))
+	binary.LittleEndian.PutUint64(sdata, uint64(len(data)))
+	copy(sdata[8:], data)
+
+	h := hasher()
+	h.Write(sdata)
+	return &storage.Chunk{Key: storage.Key(h.Sum(nil)), SData: sdata, Size: int64(len(data))}
+}
+
+// Tests that the SWAP balances are reported for all connected peers, not only
+// the ones in a single proximity bin.
+func TestSwapBalances(t *testing.T) {
+	hive := NewHive(common.Hash{}, NewHiveParams(""), true, false)
+
+	var peers []*peer
+	for po := 0; po <= hive.kad.MaxProx; po++ {
+		p := newTestSwapPeer(t, hive, kademlia.RandomAddressAt(hive.addr, po), byte(po+1))
+		if err := p.swap.Add(po + 1); err != nil {
+			t.Fatalf("failed to charge peer: %v", err)
+		}
+		peers = append(peers, p)
+	}
+	balances := hive.SwapBalances()
+	if len(balances) != len(peers) {
+		t.Fatalf("balance count mismatch: have %d, want %d", len(balances), len(peers))
+	}
+	for i, p := range peers {
+		if have := balances[p.peer.ID().String()]; have != i+1 {
+			t.Errorf("peer %d: balance mismatch: have %d, want %d", i, have, i+1)
+		}
+	}
+}
+
+// Tests that a peer is credited for delivering a chunk we asked it for, but not
+// for deliveries we never requested.
+func TestSwapRetrieveCredit(t *testing.T) {
+	hive := NewHive(common.Hash{}, NewHiveParams(""), true, false)
+	p := newTestSwapPeer(t, hive, kademlia.RandomAddressAt(hive.addr, 1), 1)
+
+	hasher := storage.MakeHashFunc("SHA3")
+	chunk := newTestChunk(hasher, []byte("swap"))
+	depo := NewDepo(hasher, testChunkStore{}, testChunkStore{})
+
+	// forwarding the retrieve request tracks it for the delivery
+	NewForwarder(hive).Retrieve(&storage.Chunk{Key: chunk.Key, Req: &storage.RequestStatus{}})
+	if sent := p.rw.(*testMsgRW).sent; len(sent) != 1 || sent[0] != retrieveRequestMsg {
+		t.Fatalf("retrieve request not sent: %v", sent)
+	}
+	var id uint64
+	for id = range p.requests {
+	}
+	if balance := p.swap.Balance(); balance != 0 {
+		t.Fatalf("balance changed before delivery: have %d, want 0", balance)
+	}
+	// the delivery answering it is credited, only once
+	for i := 0; i < 2; i++ {
+		depo.HandleStoreRequestMsg(&storeRequestMsgData{Id: id, Key: chunk.Key, SData: chunk.SData}, p)
+		if balance := p.swap.Balance(); balance != -1 {
+			t.Fatalf("delivery %d: balance mismatch: have %d, want -1", i, balance)
+		}
+	}
+	// unrequested deliveries are not credited
+	other := newTestChunk(hasher, []byte("unrequested"))
+	depo.HandleStoreRequestMsg(&storeRequestMsgData{Id: id + 1, Key: other.Key, SData: other.SData}, p)
+	if balance := p.swap.Balance(); balance != -1 {
+		t.Fatalf("unrequested delivery: balance mismatch: have %d, want -1", balance)
+	}
+}
+
+// Tests that a peer is charged for each chunk delivered to it, both when served
+// right away from the local store and when forwarded once retrieved.
+func TestSwapDeliverCharge(t *testing.T) {
+	hive := NewHive(common.Hash{}, NewHiveParams(""), true, false)
+	p := newTestSwapPeer(t, hive, kademlia.RandomAddressAt(hive.addr, 1), 1)
+
+	hasher := storage.MakeHashFunc("SHA3")
+	chunk := newTestChunk(hasher, []byte("swap"))
+	store := testChunkStore{}
+	store.Put(chunk)
+	depo := NewDepo(hasher, store, store)
+
+	// chunks found locally are charged when delivered
+	depo.HandleRetrieveRequestMsg(&retrieveRequestMsgData{Id: 1, Key: chunk.Key}, p)
+	if balance := p.swap.Balance(); balance != 1 {
+		t.Fatalf("local delivery: balance mismatch: have %d, want 1", balance)
+	}
+	// chunks too large for the requester are neither delivered nor charged
+	depo.HandleRetrieveRequestMsg(&retrieveRequestMsgData{Id: 2, Key: chunk.Key, MaxSize: 1}, p)
+	if balance := p.swap.Balance(); balance != 1 {
+		t.Fatalf("unwanted delivery: balance mismatch: have %d, want 1", balance)
+	}
+	// chunks retrieved from the network are charged when forwarded
+	req := &retrieveRequestMsgData{Id: 3, Key: chunk.Key, from: p}
+	forwarded := &storage.Chunk{
+		Key:   chunk.Key,
+		SData: chunk.SData,
+		Req:   &storage.RequestStatus{Requesters: map[uint64][]interface{}{req.Id: {req}}},
+	}
+	NewForwarder(hive).Deliver(forwarded)
+	if balance := p.swap.Balance(); balance != 2 {
+		t.Fatalf("forwarded delivery: balance mismatch: have %d, want 2", balance)
+	}
+	if queued := len(p.syncer.keys[p.syncer.SyncPriorities[DeliverReq]]); queued != 2 {
+		t.Fatalf("queued delivery count mismatch: have %d, want 2", queued)
+	}
+}
@@ -0,0 +1,202 @@
+// Copyright 2018 The go-wiseplat Authors
+// This file is part of the go-wiseplat library.
+//
+// The go-wiseplat library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-wiseplat library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-wiseplat library. If not, see <http://www.gnu.org/licenses/>.
+
+package swap
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"testing"
+
+	"github.com/wiseplat/go-wiseplat/accounts/abi/bind"
+	"github.com/wiseplat/go-wiseplat/accounts/abi/bind/backends"
+	"github.com/wiseplat/go-wiseplat/contracts/chequebook/contract"
+	"github.com/wiseplat/go-wiseplat/core"
+	"github.com/wiseplat/go-wiseplat/crypto"
+	"github.com/wiseplat/go-wiseplat/swarm/services/swap/swap"
+)
+
+var (
+	key0, _ = crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+	key1, _ = crypto.HexToECDSA("8a1f9a8f95be41cd7ccb6168179afb4504aefe388d1e14474d32c45c72ce7b7a")
+	addr0   = crypto.PubkeyToAddress(key0.PublicKey)
+	addr1   = crypto.PubkeyToAddress(key1.PublicKey)
+)
+
+// testProtocol connects two swap instances directly, relaying payments from
+// one to the other.
+type testProtocol struct {
+	name    string
+	remote  *swap.Swap
+	paid    int
+	dropped bool
+	err     error
+}
+
+func (self *testProtocol) Pay(units int, promise swap.Promise) {
+	self.paid += units
+	self.err = self.remote.Receive(units, promise)
+}
+
+func (self *testProtocol) Drop() {
+	self.dropped = true
+}
+
+func (self *testProtocol) String() string {
+	return self.name
+}
+
+// newTestParams sets up the swap parameters of a node with a chequebook
+// deployed on the simulated backend.
+func newTestParams(t *testing.T, key *ecdsa.PrivateKey, backend *backends.SimulatedBackend, dir string, deposit *big.Int) *SwapParams {
+	opts := bind.NewKeyedTransactor(key)
+	opts.Value = deposit
+	addr, _, _, err := contract.DeployChequebook(opts, backend)
+	if err != nil {
+		t.Fatalf("failed to deploy chequebook: %v", err)
+	}
+	backend.Commit()
+
+	params := DefaultSwapParams(addr, key)
+	if err := params.SetChequebook(context.Background(), backend, dir); err != nil {
+		t.Fatalf("failed to set chequebook: %v", err)
+	}
+	return params
+}
+
+func profile(params *SwapParams) *SwapProfile {
+	return &SwapProfile{
+		Profile:    params.Profile,
+		PayProfile: params.PayProfile,
+	}
+}
+
+func TestSwapChequePayment(t *testing.T) {
+	dir0, err := ioutil.TempDir("", "swap-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir0)
+	dir1, err := ioutil.TempDir("", "swap-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir1)
+
+	funds := new(big.Int).Mul(big.NewInt(1000), big.NewInt(1e18))
+	backend := backends.NewSimulatedBackend(core.GenesisAlloc{
+		addr0: {Balance: funds},
+		addr1: {Balance: funds},
+	})
+	deposit := new(big.Int).Mul(sellAt, big.NewInt(int64(10*payAt)))
+
+	// node 0 buys chunks from node 1
+	params0 := newTestParams(t, key0, backend, dir0, deposit)
+	params1 := newTestParams(t, key1, backend, dir1, deposit)
+
+	proto0 := &testProtocol{name: "node1"}
+	proto1 := &testProtocol{name: "node0"}
+	swap0, err := NewSwap(params0, profile(params1), backend, proto0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer swap0.Stop()
+	swap1, err := NewSwap(params1, profile(params0), backend, proto1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer swap1.Stop()
+	proto0.remote, proto1.remote = swap1, swap0
+
+	if !swap0.Buys || !swap1.Sells {
+		t.Fatalf("expected trade between nodes: buys %v, sells %v", swap0.Buys, swap1.Sells)
+	}
+
+	// deliver one chunk less than the payment threshold
+	for i := 0; i < payAt-1; i++ {
+		if err := swap1.Add(1); err != nil {
+			t.Fatalf("delivery %d: seller error: %v", i, err)
+		}
+		if err := swap0.Add(-1); err != nil {
+			t.Fatalf("delivery %d: buyer error: %v", i, err)
+		}
+	}
+	if proto0.paid != 0 {
+		t.Fatalf("paid %d units before reaching the threshold", proto0.paid)
+	}
+	if swap0.Balance() != -(payAt-1) || swap1.Balance() != payAt-1 {
+		t.Fatalf("balance mismatch: buyer %d, seller %d", swap0.Balance(), swap1.Balance())
+	}
+
+	// the delivery reaching the threshold triggers a cheque
+	swap1.Add(1)
+	swap0.Add(-1)
+	if proto0.paid != payAt {
+		t.Fatalf("expected payment of %d units, got %d", payAt, proto0.paid)
+	}
+	if proto0.err != nil {
+		t.Fatalf("cheque rejected by seller: %v", proto0.err)
+	}
+	if swap0.Balance() != 0 || swap1.Balance() != 0 {
+		t.Fatalf("balances not settled: buyer %d, seller %d", swap0.Balance(), swap1.Balance())
+	}
+	if proto1.dropped || proto0.dropped {
+		t.Fatalf("peer dropped after paying")
+	}
+}
+
+func TestSwapDropUnpaid(t *testing.T) {
+	dir, err := ioutil.TempDir("", "swap-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	funds := new(big.Int).Mul(big.NewInt(1000), big.NewInt(1e18))
+	backend := backends.NewSimulatedBackend(core.GenesisAlloc{
+		addr0: {Balance: funds},
+		addr1: {Balance: funds},
+	})
+	deposit := new(big.Int).Mul(sellAt, big.NewInt(int64(10*payAt)))
+	params0 := newTestParams(t, key0, backend, dir, deposit)
+	params1 := newTestParams(t, key1, backend, dir, deposit)
+
+	// the seller's view of a buyer who never pays
+	proto := &testProtocol{name: "node0"}
+	seller, err := NewSwap(params1, profile(params0), backend, proto)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer seller.Stop()
+
+	for i := 0; i < dropAt-1; i++ {
+		if err := seller.Add(1); err != nil {
+			t.Fatalf("delivery %d: unexpected error: %v", i, err)
+		}
+	}
+	if proto.dropped {
+		t.Fatalf("peer dropped before reaching the disconnect threshold")
+	}
+	if err := seller.Add(1); err == nil {
+		t.Fatalf("expected error reaching the disconnect threshold")
+	}
+	if !proto.dropped {
+		t.Fatalf("peer not dropped after reaching the disconnect threshold")
+	}
+}
@@ -146,7 +146,7 @@ func NewSwarm(ctx *node.ServiceContext, backend chequebook.Backend, ensClient *w
 	}
 	log.Debug(fmt.Sprintf("-> Swarm Domain Name Registrar @ address %v", config.EnsRoot.Hex()))
 
-	self.api = api.NewApi(self.dpa, self.dns)
+	self.api = api.NewApi(self.dpa, self.dns, self.privateKey)
 	// Manifests for Smart Hosting
 	log.Debug(fmt.Sprintf("-> Web3 virtual server API"))
 
@@ -266,6 +266,12 @@ func (self *Swarm) APIs() []rpc.API {
 			Service:   chequebook.NewApi(self.config.Swap.Chequebook),
 			Public:    false,
 		},
+		{
+			Namespace: "swap",
+			Version:   "0.1",
+			Service:   api.NewSwap(self.hive),
+			Public:    false,
+		},
 		{
 			Namespace: "swarmfs",
 			Version:   fuse.Swarmfs_Version,
@@ -326,7 +332,7 @@ func NewLocalSwarm(datadir, port string) (self *Swarm, err error) {
 	}
 
 	self = &Swarm{
-		api:    api.NewApi(dpa, nil),
+		api:    api.NewApi(dpa, nil, prvKey),
 		config: config,
 	}
 
@@ -30,6 +30,7 @@ type hasher struct {
 	tmp                  *bytes.Buffer
 	sha                  hash.Hash
 	cachegen, cachelimit uint16
+	parallel             bool // whether to hash the children of the first full node concurrently
 }
 
 // hashers live in a global pool.
@@ -39,9 +40,9 @@ var hasherPool = sync.Pool{
 	},
 }
 
-func newHasher(cachegen, cachelimit uint16) *hasher {
+func newHasher(cachegen, cachelimit uint16, parallel bool) *hasher {
 	h := hasherPool.Get().(*hasher)
-	h.cachegen, h.cachelimit = cachegen, cachelimit
+	h.cachegen, h.cachelimit, h.parallel = cachegen, cachelimit, parallel
 	return h
 }
 
@@ -123,14 +124,20 @@ func (h *hasher) hashChildren(original node, db DatabaseWriter) (node, node, err
 		// Hash the full node's children, caching the newly hashed subtrees
 		collapsed, cached := n.copy(), n.copy()
 
-		for i := 0; i < 16; i++ {
-			if n.Children[i] != nil {
-				collapsed.Children[i], cached.Children[i], err = h.hash(n.Children[i], db, false)
-				if err != nil {
-					return original, original, err
+		if h.parallel {
+			if err := h.hashFullNodeChildrenParallel(n, collapsed, cached, db); err != nil {
+				return original, original, err
+			}
+		} else {
+			for i := 0; i < 16; i++ {
+				if n.Children[i] != nil {
+					collapsed.Children[i], cached.Children[i], err = h.hash(n.Children[i], db, false)
+					if err != nil {
+						return original, original, err
+					}
+				} else {
+					collapsed.Children[i] = valueNode(nil) // Ensure that nil children are encoded as empty strings.
 				}
-			} else {
-				collapsed.Children[i] = valueNode(nil) // Ensure that nil children are encoded as empty strings.
 			}
 		}
 		cached.Children[16] = n.Children[16]
@@ -145,6 +152,74 @@ func (h *hasher) hashChildren(original node, db DatabaseWriter) (node, node, err
 	}
 }
 
+// hashFullNodeChildrenParallel hashes the children of a full node, each on its
+// own goroutine and with its own hasher. Nodes to be written are collected into
+// a batch per child and flushed into db in child order, so the database sees the
+// exact same sequence of writes as with sequential hashing.
+func (h *hasher) hashFullNodeChildrenParallel(n, collapsed, cached *fullNode, db DatabaseWriter) error {
+	var (
+		wg      sync.WaitGroup
+		errs    [16]error
+		batches [16]*nodeBatch
+	)
+	for i := 0; i < 16; i++ {
+		if n.Children[i] == nil {
+			collapsed.Children[i] = valueNode(nil) // Ensure that nil children are encoded as empty strings.
+			continue
+		}
+		var dbw DatabaseWriter
+		if db != nil {
+			batches[i] = new(nodeBatch)
+			dbw = batches[i]
+		}
+		wg.Add(1)
+		go func(i int, dbw DatabaseWriter) {
+			defer wg.Done()
+
+			child := newHasher(h.cachegen, h.cachelimit, false)
+			defer returnHasherToPool(child)
+			collapsed.Children[i], cached.Children[i], errs[i] = child.hash(n.Children[i], dbw, false)
+		}(i, dbw)
+	}
+	wg.Wait()
+
+	for i := 0; i < 16; i++ {
+		if errs[i] != nil {
+			return errs[i]
+		}
+		if batches[i] != nil {
+			if err := batches[i].flush(db); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// nodeBatch is an in-memory DatabaseWriter collecting the nodes written by a
+// single goroutine during parallel commits.
+type nodeBatch struct {
+	keys, values [][]byte
+}
+
+// Put queues a node for writing. The value is copied since hashers reuse their
+// encoding buffer across writes.
+func (b *nodeBatch) Put(key, value []byte) error {
+	b.keys = append(b.keys, common.CopyBytes(key))
+	b.values = append(b.values, common.CopyBytes(value))
+	return nil
+}
+
+// flush writes the queued nodes into db in insertion order.
+func (b *nodeBatch) flush(db DatabaseWriter) error {
+	for i, key := range b.keys {
+		if err := db.Put(key, b.values[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func (h *hasher) store(n node, db DatabaseWriter, force bool) (node, error) {
 	// Don't store hashes or empty nodes.
 	if _, isHash := n.(hashNode); n == nil || isHash {
@@ -18,6 +18,7 @@ package trie
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 
 	"github.com/wiseplat/go-wiseplat/common"
@@ -66,7 +67,7 @@ func (t *Trie) Prove(key []byte, fromLevel uint, proofDb DatabaseWriter) error {
 			panic(fmt.Sprintf("%T: invalid node: %v", tn, tn))
 		}
 	}
-	hasher := newHasher(0, 0)
+	hasher := newHasher(0, 0, false)
 	for i, n := range nodes {
 		// Don't bother checking for errors here since hasher panics
 		// if encoding doesn't work and we're not writing to any database.
@@ -105,7 +106,7 @@ func VerifyProof(rootHash common.Hash, key []byte, proofDb DatabaseReader) (valu
 		if err != nil {
 			return nil, fmt.Errorf("bad proof node %d: %v", i, err), i
 		}
-		keyrest, cld := get(n, key)
+		keyrest, cld := get(n, key, true)
 		switch cld := cld.(type) {
 		case nil:
 			// The trie doesn't contain the key.
@@ -119,7 +120,11 @@ func VerifyProof(rootHash common.Hash, key []byte, proofDb DatabaseReader) (valu
 	}
 }
 
-func get(tn node, key []byte) ([]byte, node) {
+// get returns the child of the given node along key, together with the rest of
+// the key. A nil node is returned if the key doesn't exist at all. If skipResolved
+// is set, already resolved nodes are stepped over until an unresolved hash node,
+// a value or a missing branch is hit.
+func get(tn node, key []byte, skipResolved bool) ([]byte, node) {
 	for {
 		switch n := tn.(type) {
 		case *shortNode:
@@ -128,9 +133,15 @@ func get(tn node, key []byte) ([]byte, node) {
 			}
 			tn = n.Val
 			key = key[len(n.Key):]
+			if !skipResolved {
+				return key, tn
+			}
 		case *fullNode:
 			tn = n.Children[key[0]]
 			key = key[1:]
+			if !skipResolved {
+				return key, tn
+			}
 		case hashNode:
 			return key, n
 		case nil:
@@ -142,3 +153,405 @@ func get(tn node, key []byte) ([]byte, node) {
 		}
 	}
 }
+
+// proofToPath converts a merkle proof into a trie node path, resolving all the
+// nodes along the key and leaving the rest as hash nodes. If root is non-nil,
+// the newly resolved path is merged into it.
+//
+// The proof is allowed to be a proof of absence if allowNonExistent is set.
+func proofToPath(rootHash common.Hash, root node, key []byte, proofDb DatabaseReader, allowNonExistent bool) (node, []byte, error) {
+	// resolveNode retrieves and resolves a trie node from the proof
+	resolveNode := func(hash hashNode) (node, error) {
+		buf, _ := proofDb.Get(hash)
+		if buf == nil {
+			return nil, fmt.Errorf("proof node (hash %064x) missing", hash)
+		}
+		n, err := decodeNode(hash, buf, 0)
+		if err != nil {
+			return nil, fmt.Errorf("bad proof node: %v", err)
+		}
+		return n, nil
+	}
+	// The root node must always be included in the proof
+	if root == nil {
+		n, err := resolveNode(rootHash[:])
+		if err != nil {
+			return nil, nil, err
+		}
+		root = n
+	}
+	var (
+		err     error
+		child   node
+		parent  node
+		keyrest []byte
+		value   []byte
+	)
+	key, parent = keybytesToHex(key), root
+	for {
+		keyrest, child = get(parent, key, false)
+		switch cld := child.(type) {
+		case nil:
+			// The trie doesn't contain the key. All the resolved nodes are proven
+			// correct nonetheless, which is enough to prove a range edge.
+			if allowNonExistent {
+				return root, nil, nil
+			}
+			return nil, nil, errors.New("the node is not contained in trie")
+		case *shortNode, *fullNode:
+			// Embedded node, already resolved
+			key, parent = keyrest, child
+			continue
+		case hashNode:
+			child, err = resolveNode(cld)
+			if err != nil {
+				return nil, nil, err
+			}
+		case valueNode:
+			value = cld
+		}
+		// Link the resolved child into its parent
+		switch pnode := parent.(type) {
+		case *shortNode:
+			pnode.Val = child
+		case *fullNode:
+			pnode.Children[key[0]] = child
+		default:
+			return nil, nil, fmt.Errorf("%T: invalid node: %v", pnode, pnode)
+		}
+		if len(value) > 0 {
+			return root, value, nil
+		}
+		key, parent = keyrest, child
+	}
+}
+
+// unsetInternal removes all the internal node references (hash nodes and embedded
+// nodes) between the two edge paths, which must have been resolved already with
+// the same left and right keys. It returns whether the entire trie is within the
+// range and needs to be discarded.
+//
+// All the nodes along the edge paths are marked dirty, since their content will be
+// modified. Some full nodes might temporarily end up with a single child, which is
+// invalid, but a valid range will fill them up again, an invalid one is rejected
+// anyway.
+//
+// The left key must be strictly smaller than the right one.
+func unsetInternal(n node, left []byte, right []byte) (bool, error) {
+	left, right = keybytesToHex(left), keybytesToHex(right)
+
+	// Step down to the fork point. It's either a short node whose key doesn't
+	// match one of the edge paths, or a full node where the paths diverge (or
+	// one of them points to a missing child).
+	var (
+		pos    = 0
+		parent node
+
+		// Fork indicators, 0 means no fork, -1 means the path is smaller than
+		// the short node key, 1 means it's larger
+		shortForkLeft, shortForkRight int
+	)
+findFork:
+	for {
+		switch rn := n.(type) {
+		case *shortNode:
+			rn.flags = nodeFlag{dirty: true}
+
+			if len(left)-pos < len(rn.Key) {
+				shortForkLeft = bytes.Compare(left[pos:], rn.Key)
+			} else {
+				shortForkLeft = bytes.Compare(left[pos:pos+len(rn.Key)], rn.Key)
+			}
+			if len(right)-pos < len(rn.Key) {
+				shortForkRight = bytes.Compare(right[pos:], rn.Key)
+			} else {
+				shortForkRight = bytes.Compare(right[pos:pos+len(rn.Key)], rn.Key)
+			}
+			if shortForkLeft != 0 || shortForkRight != 0 {
+				break findFork
+			}
+			parent = n
+			n, pos = rn.Val, pos+len(rn.Key)
+
+		case *fullNode:
+			rn.flags = nodeFlag{dirty: true}
+
+			leftnode, rightnode := rn.Children[left[pos]], rn.Children[right[pos]]
+			if leftnode == nil || rightnode == nil || leftnode != rightnode {
+				break findFork
+			}
+			parent = n
+			n, pos = rn.Children[left[pos]], pos+1
+
+		default:
+			return false, fmt.Errorf("%T: invalid node: %v", n, n)
+		}
+	}
+	switch rn := n.(type) {
+	case *shortNode:
+		// The short node is either entirely outside the range (both paths on the
+		// same side of it), entirely inside (the paths on different sides), or
+		// one of the paths points into it
+		if shortForkLeft == -1 && shortForkRight == -1 {
+			return false, errors.New("empty range")
+		}
+		if shortForkLeft == 1 && shortForkRight == 1 {
+			return false, errors.New("empty range")
+		}
+		if shortForkLeft != 0 && shortForkRight != 0 {
+			if parent == nil {
+				return true, nil
+			}
+			return false, removeChild(parent, left[pos-1])
+		}
+		// Only one of the paths forks away from the short node
+		if shortForkRight != 0 {
+			if _, ok := rn.Val.(valueNode); ok {
+				if parent == nil {
+					return true, nil
+				}
+				return false, removeChild(parent, left[pos-1])
+			}
+			return false, unset(rn, rn.Val, left[pos:], len(rn.Key), false)
+		}
+		if shortForkLeft != 0 {
+			if _, ok := rn.Val.(valueNode); ok {
+				if parent == nil {
+					return true, nil
+				}
+				return false, removeChild(parent, right[pos-1])
+			}
+			return false, unset(rn, rn.Val, right[pos:], len(rn.Key), true)
+		}
+		return false, nil
+
+	case *fullNode:
+		// Unset all the children between the two paths, and everything right of
+		// the left path and left of the right path
+		for i := left[pos] + 1; i < right[pos]; i++ {
+			rn.Children[i] = nil
+		}
+		if err := unset(rn, rn.Children[left[pos]], left[pos:], 1, false); err != nil {
+			return false, err
+		}
+		if err := unset(rn, rn.Children[right[pos]], right[pos:], 1, true); err != nil {
+			return false, err
+		}
+		return false, nil
+
+	default:
+		return false, fmt.Errorf("%T: invalid node: %v", n, n)
+	}
+}
+
+// unset removes all the internal node references on one side of an edge path:
+// left of it if removeLeft is set, right of it otherwise. Nodes off the path but
+// within the range are dropped, nodes outside the range are kept along with their
+// cached hashes.
+func unset(parent node, child node, key []byte, pos int, removeLeft bool) error {
+	switch cld := child.(type) {
+	case *fullNode:
+		if removeLeft {
+			for i := 0; i < int(key[pos]); i++ {
+				cld.Children[i] = nil
+			}
+		} else {
+			for i := key[pos] + 1; i < 16; i++ {
+				cld.Children[i] = nil
+			}
+		}
+		cld.flags = nodeFlag{dirty: true}
+		return unset(cld, cld.Children[key[pos]], key, pos+1, removeLeft)
+
+	case *shortNode:
+		if len(key[pos:]) < len(cld.Key) || !bytes.Equal(cld.Key, key[pos:pos+len(cld.Key)]) {
+			// The path forks away from the short node (proof of absence). If the
+			// node is inside the range, drop it entirely, otherwise keep it.
+			if removeLeft {
+				if bytes.Compare(cld.Key, key[pos:]) < 0 {
+					return removeChild(parent, key[pos-1])
+				}
+			} else {
+				if bytes.Compare(cld.Key, key[pos:]) > 0 {
+					return removeChild(parent, key[pos-1])
+				}
+			}
+			return nil
+		}
+		if _, ok := cld.Val.(valueNode); ok {
+			return removeChild(parent, key[pos-1])
+		}
+		cld.flags = nodeFlag{dirty: true}
+		return unset(cld, cld.Val, key, pos+len(cld.Key), removeLeft)
+
+	case nil:
+		// The path points to a missing child of a full node (proof of absence)
+		return nil
+
+	default:
+		return fmt.Errorf("%T: invalid node: %v", child, child)
+	}
+}
+
+// removeChild drops the child of a full node at the given index. Any other parent
+// node type means the resolved edge paths are not a valid trie.
+func removeChild(parent node, index byte) error {
+	fn, ok := parent.(*fullNode)
+	if !ok {
+		return fmt.Errorf("%T: invalid parent node: %v", parent, parent)
+	}
+	fn.Children[index] = nil
+	return nil
+}
+
+// hasRightElement returns whether there are more elements in the trie right of
+// the given key. The key may or may not exist, but the whole path to it must be
+// resolved already, otherwise an error is returned.
+func hasRightElement(n node, key []byte) (bool, error) {
+	pos, key := 0, keybytesToHex(key)
+	for n != nil {
+		switch rn := n.(type) {
+		case *fullNode:
+			for i := key[pos] + 1; i < 16; i++ {
+				if rn.Children[i] != nil {
+					return true, nil
+				}
+			}
+			n, pos = rn.Children[key[pos]], pos+1
+		case *shortNode:
+			if len(key)-pos < len(rn.Key) || !bytes.Equal(rn.Key, key[pos:pos+len(rn.Key)]) {
+				return bytes.Compare(rn.Key, key[pos:]) > 0, nil
+			}
+			n, pos = rn.Val, pos+len(rn.Key)
+		case valueNode:
+			return false, nil
+		default:
+			return false, fmt.Errorf("%T: invalid node: %v", n, n)
+		}
+	}
+	return false, nil
+}
+
+// VerifyRangeProof checks whether the given sorted list of key/value pairs is
+// exactly the set of entries of the trie with the given root between firstKey
+// and lastKey (inclusive), i.e. that no entries are missing from or have been
+// added to the range. The edge proofs of firstKey and lastKey are expected in
+// proofDb, and either may be a proof of absence.
+//
+// A few special cases are supported:
+//
+//   - The proof is nil: the given range must be the entire trie.
+//   - The range is empty: the proof of firstKey must show that there are no
+//     entries in the trie at or after it at all.
+//   - The range has a single element equal to both edges: a single existence
+//     proof is enough.
+//
+// Besides the verification result, it returns whether there are more entries in
+// the trie right of the range.
+func VerifyRangeProof(rootHash common.Hash, firstKey []byte, lastKey []byte, keys [][]byte, values [][]byte, proofDb DatabaseReader) (bool, error) {
+	if len(keys) != len(values) {
+		return false, fmt.Errorf("inconsistent proof data, keys: %d, values: %d", len(keys), len(values))
+	}
+	// Ensure the range is monotonically increasing and contains no deletions
+	for i := 0; i < len(keys)-1; i++ {
+		if bytes.Compare(keys[i], keys[i+1]) >= 0 {
+			return false, errors.New("range is not monotonically increasing")
+		}
+	}
+	for _, value := range values {
+		if len(value) == 0 {
+			return false, errors.New("range contains deletion")
+		}
+	}
+	// Without edge proofs, the range must make up the whole trie
+	if proofDb == nil {
+		tr := new(Trie)
+		for i, key := range keys {
+			tr.Update(key, values[i])
+		}
+		if have := tr.Hash(); have != rootHash {
+			return false, fmt.Errorf("invalid proof, want hash %x, got %x", rootHash, have)
+		}
+		return false, nil
+	}
+	// With an edge proof but no entries, there must be nothing right of the origin
+	if len(keys) == 0 {
+		root, value, err := proofToPath(rootHash, nil, firstKey, proofDb, true)
+		if err != nil {
+			return false, err
+		}
+		if value != nil {
+			return false, errors.New("more entries available")
+		}
+		more, err := hasRightElement(root, firstKey)
+		if err != nil {
+			return false, err
+		}
+		if more {
+			return false, errors.New("more entries available")
+		}
+		return false, nil
+	}
+	// With a single element equal to both edges, a single proof of existence suffices
+	if len(keys) == 1 && bytes.Equal(firstKey, lastKey) {
+		root, value, err := proofToPath(rootHash, nil, firstKey, proofDb, false)
+		if err != nil {
+			return false, err
+		}
+		if !bytes.Equal(firstKey, keys[0]) {
+			return false, errors.New("correct proof but invalid key")
+		}
+		if !bytes.Equal(value, values[0]) {
+			return false, errors.New("correct proof but invalid data")
+		}
+		return hasRightElement(root, firstKey)
+	}
+	// In all other cases two distinct, equally long edge paths are needed, with
+	// the whole range in between them
+	if bytes.Compare(firstKey, lastKey) >= 0 {
+		return false, errors.New("invalid edge keys")
+	}
+	if len(firstKey) != len(lastKey) {
+		return false, errors.New("inconsistent edge keys")
+	}
+	if bytes.Compare(keys[0], firstKey) < 0 || bytes.Compare(keys[len(keys)-1], lastKey) > 0 {
+		return false, errors.New("range exceeds edge keys")
+	}
+	// Convert the edge proofs into resolved paths, merging the second into the
+	// first, so the trie has the same shape as the original around the edges
+	root, _, err := proofToPath(rootHash, nil, firstKey, proofDb, true)
+	if err != nil {
+		return false, err
+	}
+	root, _, err = proofToPath(rootHash, root, lastKey, proofDb, true)
+	if err != nil {
+		return false, err
+	}
+	// Remove everything in between the edges, which needs to be reconstructed
+	// from the given range
+	empty, err := unsetInternal(root, firstKey, lastKey)
+	if err != nil {
+		return false, err
+	}
+	tr := &Trie{root: root, db: emptyDatabase{}}
+	if empty {
+		tr.root = nil
+	}
+	for i, key := range keys {
+		if err := tr.TryUpdate(key, values[i]); err != nil {
+			return false, err
+		}
+	}
+	if have := tr.Hash(); have != rootHash {
+		return false, fmt.Errorf("invalid proof, want hash %x, got %x", rootHash, have)
+	}
+	return hasRightElement(tr.root, keys[len(keys)-1])
+}
+
+// emptyDatabase is a trie database without any content, used to reject any node
+// resolution attempts while reconstructing a range.
+type emptyDatabase struct{}
+
+func (emptyDatabase) Get(key []byte) ([]byte, error) { return nil, errors.New("not found") }
+func (emptyDatabase) Has(key []byte) (bool, error)   { return false, nil }
+func (emptyDatabase) Put(key, value []byte) error    { return nil }
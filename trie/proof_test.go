@@ -20,6 +20,7 @@ import (
 	"bytes"
 	crand "crypto/rand"
 	mrand "math/rand"
+	"sort"
 	"testing"
 	"time"
 
@@ -99,6 +100,293 @@ func mutateByte(b []byte) {
 	}
 }
 
+// Tests that range proofs of random subranges of a trie are accepted, both with
+// the edge proofs of the first and last elements and with proofs of absence of
+// keys just outside the range.
+func TestRangeProof(t *testing.T) {
+	trie, vals := randomTrie(4096)
+	entries := sortedEntries(vals)
+	root := trie.Hash()
+
+	for i := 0; i < 500; i++ {
+		start := mrand.Intn(len(entries))
+		end := mrand.Intn(len(entries)-start) + start + 1
+
+		keys, values := rangeOf(entries[start:end])
+		if _, err := VerifyRangeProof(root, keys[0], keys[len(keys)-1], keys, values, proveRange(t, trie, keys[0], keys[len(keys)-1])); err != nil {
+			t.Fatalf("case %d (%d->%d): %v", i, start, end-1, err)
+		}
+		// Extend the edges into non-existent keys, if they don't overlap neighbours
+		first, last := decreaseKey(common.CopyBytes(keys[0])), increaseKey(common.CopyBytes(keys[len(keys)-1]))
+		if start > 0 && bytes.Compare(first, entries[start-1].k) <= 0 {
+			continue
+		}
+		if end < len(entries) && bytes.Compare(last, entries[end].k) >= 0 {
+			continue
+		}
+		more, err := VerifyRangeProof(root, first, last, keys, values, proveRange(t, trie, first, last))
+		if err != nil {
+			t.Fatalf("case %d (%d->%d) with absent edges: %v", i, start, end-1, err)
+		}
+		if more != (end < len(entries)) {
+			t.Fatalf("case %d (%d->%d): more elements mismatch: have %v, want %v", i, start, end-1, more, end < len(entries))
+		}
+	}
+}
+
+// Tests that range proofs are rejected if the range has been tampered with by
+// modifying, adding, removing or reordering entries.
+func TestBadRangeProof(t *testing.T) {
+	trie, vals := randomTrie(4096)
+	entries := sortedEntries(vals)
+	root := trie.Hash()
+
+	for i := 0; i < 500; i++ {
+		start := mrand.Intn(len(entries))
+		end := mrand.Intn(len(entries)-start) + start + 1
+		if end-start < 3 {
+			continue
+		}
+		keys, values := rangeOf(entries[start:end])
+		first, last := keys[0], keys[len(keys)-1]
+		proof := proveRange(t, trie, first, last)
+
+		index := mrand.Intn(len(keys))
+		switch mrand.Intn(5) {
+		case 0: // Modified key
+			keys[index] = randBytes(32)
+		case 1: // Modified value
+			values[index] = randBytes(20)
+		case 2: // Extra entry
+			index = mrand.Intn(len(keys)-1) + 1
+			key := increaseKey(common.CopyBytes(keys[index-1]))
+			if bytes.Equal(key, keys[index]) {
+				continue
+			}
+			keys = append(keys[:index], append([][]byte{key}, keys[index:]...)...)
+			values = append(values[:index], append([][]byte{randBytes(20)}, values[index:]...)...)
+		case 3: // Missing entry (not the edges, otherwise the edge keys are off)
+			index = mrand.Intn(len(keys)-2) + 1
+			keys = append(keys[:index], keys[index+1:]...)
+			values = append(values[:index], values[index+1:]...)
+		case 4: // Reordered entries
+			other := mrand.Intn(len(keys))
+			if other == index {
+				continue
+			}
+			keys[index], keys[other] = keys[other], keys[index]
+			values[index], values[other] = values[other], values[index]
+		}
+		if _, err := VerifyRangeProof(root, first, last, keys, values, proof); err == nil {
+			t.Fatalf("case %d (%d->%d): tampered range accepted", i, start, end-1)
+		}
+	}
+}
+
+// Tests range proofs of a single element, with existent and non-existent edges.
+func TestOneElementRangeProof(t *testing.T) {
+	trie, vals := randomTrie(4096)
+	entries := sortedEntries(vals)
+	root := trie.Hash()
+
+	// Single element with the same edges, proven by one existence proof
+	index := mrand.Intn(len(entries))
+	key, value := entries[index].k, entries[index].v
+	if _, err := VerifyRangeProof(root, key, key, [][]byte{key}, [][]byte{value}, proveRange(t, trie, key, key)); err != nil {
+		t.Fatalf("single element with equal edges rejected: %v", err)
+	}
+	if _, err := VerifyRangeProof(root, key, key, [][]byte{key}, [][]byte{randBytes(20)}, proveRange(t, trie, key, key)); err == nil {
+		t.Fatalf("single element with invalid value accepted")
+	}
+	// Single element with a non-existent left edge
+	first := decreaseKey(common.CopyBytes(key))
+	if index == 0 || bytes.Compare(first, entries[index-1].k) > 0 {
+		if _, err := VerifyRangeProof(root, first, key, [][]byte{key}, [][]byte{value}, proveRange(t, trie, first, key)); err != nil {
+			t.Fatalf("single element with absent left edge rejected: %v", err)
+		}
+	}
+	// Single element with a non-existent right edge
+	last := increaseKey(common.CopyBytes(key))
+	if index == len(entries)-1 || bytes.Compare(last, entries[index+1].k) < 0 {
+		if _, err := VerifyRangeProof(root, key, last, [][]byte{key}, [][]byte{value}, proveRange(t, trie, key, last)); err != nil {
+			t.Fatalf("single element with absent right edge rejected: %v", err)
+		}
+	}
+	// Trie consisting of a single element, with both edges absent
+	single := new(Trie)
+	key = common.LeftPadBytes([]byte{0x7f}, 32)
+	single.Update(key, []byte("v"))
+	first, last = common.LeftPadBytes([]byte{0x00}, 32), common.LeftPadBytes([]byte{0xff}, 32)
+	more, err := VerifyRangeProof(single.Hash(), first, last, [][]byte{key}, [][]byte{[]byte("v")}, proveRange(t, single, first, last))
+	if err != nil {
+		t.Fatalf("single element trie rejected: %v", err)
+	}
+	if more {
+		t.Fatalf("single element trie reported more elements")
+	}
+}
+
+// Tests that the entire trie can be proven both without any proofs and with the
+// edge proofs of the first and last elements.
+func TestAllElementsProof(t *testing.T) {
+	trie, vals := randomTrie(4096)
+	entries := sortedEntries(vals)
+	root := trie.Hash()
+
+	keys, values := rangeOf(entries)
+	if _, err := VerifyRangeProof(root, nil, nil, keys, values, nil); err != nil {
+		t.Fatalf("entire trie without proofs rejected: %v", err)
+	}
+	if _, err := VerifyRangeProof(root, nil, nil, keys[1:], values[1:], nil); err == nil {
+		t.Fatalf("partial trie without proofs accepted")
+	}
+	more, err := VerifyRangeProof(root, keys[0], keys[len(keys)-1], keys, values, proveRange(t, trie, keys[0], keys[len(keys)-1]))
+	if err != nil {
+		t.Fatalf("entire trie with edge proofs rejected: %v", err)
+	}
+	if more {
+		t.Fatalf("entire trie reported more elements")
+	}
+	// Edge proofs of the smallest and largest possible keys
+	first, last := make([]byte, 32), bytes.Repeat([]byte{0xff}, 32)
+	if _, err := VerifyRangeProof(root, first, last, keys, values, proveRange(t, trie, first, last)); err != nil {
+		t.Fatalf("entire trie with absent edge proofs rejected: %v", err)
+	}
+}
+
+// Tests that empty ranges are only accepted if there are no elements at or
+// right of the origin.
+func TestEmptyRangeProof(t *testing.T) {
+	trie, vals := randomTrie(4096)
+	entries := sortedEntries(vals)
+	root := trie.Hash()
+
+	origin := increaseKey(common.CopyBytes(entries[len(entries)-1].k))
+	if _, err := VerifyRangeProof(root, origin, nil, nil, nil, proveRange(t, trie, origin, origin)); err != nil {
+		t.Fatalf("empty range past the last element rejected: %v", err)
+	}
+	origin = decreaseKey(common.CopyBytes(entries[len(entries)-1].k))
+	if _, err := VerifyRangeProof(root, origin, nil, nil, nil, proveRange(t, trie, origin, origin)); err == nil {
+		t.Fatalf("empty range before the last element accepted")
+	}
+	if _, err := VerifyRangeProof(root, entries[0].k, nil, nil, nil, proveRange(t, trie, entries[0].k, entries[0].k)); err == nil {
+		t.Fatalf("empty range at an existing element accepted")
+	}
+}
+
+// Tests that range proofs of random tries with random ranges and random edges
+// agree with the content of the trie: valid ranges are accepted with the correct
+// continuation flag, and ranges with dropped or altered entries are rejected.
+func TestRangeProofFuzz(t *testing.T) {
+	for i := 0; i < 1000; i++ {
+		// Create a random trie of random size
+		trie := new(Trie)
+		vals := make(map[string]*kv)
+		for n := mrand.Intn(64) + 1; len(vals) < n; {
+			value := &kv{randBytes(32), randBytes(mrand.Intn(40) + 1), false}
+			if mrand.Intn(2) == 0 {
+				// Use keys sharing prefixes to get short nodes at varying depths
+				value.k[0], value.k[1] = 0x00, byte(mrand.Intn(4))
+			}
+			trie.Update(value.k, value.v)
+			vals[string(value.k)] = value
+		}
+		entries := sortedEntries(vals)
+		root := trie.Hash()
+
+		// Pick random edges and gather the entries in between from the trie
+		first, last := randBytes(32), randBytes(32)
+		if mrand.Intn(2) == 0 {
+			first[0], first[1] = 0x00, byte(mrand.Intn(4))
+		}
+		if bytes.Compare(first, last) > 0 {
+			first, last = last, first
+		}
+		var keys, values [][]byte
+		for _, entry := range entries {
+			if bytes.Compare(entry.k, first) >= 0 && bytes.Compare(entry.k, last) <= 0 {
+				keys, values = append(keys, entry.k), append(values, entry.v)
+			}
+		}
+		more := len(entries) > 0 && bytes.Compare(entries[len(entries)-1].k, last) > 0
+
+		proof := proveRange(t, trie, first, last)
+		if len(keys) == 0 {
+			// Empty ranges are only valid if nothing follows the origin
+			_, err := VerifyRangeProof(root, first, last, keys, values, proof)
+			if (err == nil) != !more {
+				t.Fatalf("case %d: empty range verification mismatch: err %v, more %v", i, err, more)
+			}
+			continue
+		}
+		have, err := VerifyRangeProof(root, first, last, keys, values, proof)
+		if err != nil {
+			t.Fatalf("case %d: valid range rejected: %v", i, err)
+		}
+		if have != more {
+			t.Fatalf("case %d: more elements mismatch: have %v, want %v", i, have, more)
+		}
+		// Tamper with the range and ensure it's rejected
+		index := mrand.Intn(len(keys))
+		if mrand.Intn(2) == 0 {
+			keys, values = append(keys[:index:index], keys[index+1:]...), append(values[:index:index], values[index+1:]...)
+			if len(keys) == 0 {
+				continue
+			}
+		} else {
+			values = append(values[:index:index], append([][]byte{randBytes(41)}, values[index+1:]...)...)
+		}
+		if _, err := VerifyRangeProof(root, first, last, keys, values, proof); err == nil {
+			t.Fatalf("case %d: tampered range accepted", i)
+		}
+	}
+}
+
+// Tests that the range proof helpers reject unresolved or malformed edge paths
+// with an error instead of crashing.
+func TestRangeProofInvalidNodes(t *testing.T) {
+	left, right := common.Hex2Bytes("1000"), common.Hex2Bytes("2000")
+
+	unresolved := hashNode(common.Hex2Bytes("deadbeef"))
+	if _, err := unsetInternal(unresolved, left, right); err == nil {
+		t.Errorf("unresolved root accepted while unsetting")
+	}
+	if _, err := hasRightElement(unresolved, left); err == nil {
+		t.Errorf("unresolved root accepted while looking right")
+	}
+	// A short node forking away from one of the edges must hang off a full node
+	malformed := &shortNode{Key: []byte{1}, Val: &shortNode{Key: []byte{0, 0, 1}, Val: valueNode("a")}}
+	if _, err := unsetInternal(malformed, common.Hex2Bytes("1000"), common.Hex2Bytes("1001")); err == nil {
+		t.Errorf("short node parent accepted while unsetting")
+	}
+	// A value can't sit on an edge path below a full node
+	if err := unset(&fullNode{}, valueNode("a"), keybytesToHex(left), 1, false); err == nil {
+		t.Errorf("value node accepted while unsetting")
+	}
+}
+
+func BenchmarkVerifyRangeProof100(b *testing.B)  { benchmarkVerifyRangeProof(b, 100) }
+func BenchmarkVerifyRangeProof1000(b *testing.B) { benchmarkVerifyRangeProof(b, 1000) }
+
+func benchmarkVerifyRangeProof(b *testing.B, size int) {
+	trie, vals := randomTrie(8192)
+	entries := sortedEntries(vals)
+	root := trie.Hash()
+
+	start := 2
+	keys, values := rangeOf(entries[start : start+size])
+	proof, _ := wshdb.NewMemDatabase()
+	trie.Prove(keys[0], 0, proof)
+	trie.Prove(keys[len(keys)-1], 0, proof)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := VerifyRangeProof(root, keys[0], keys[len(keys)-1], keys, values, proof); err != nil {
+			b.Fatalf("range proof rejected: %v", err)
+		}
+	}
+}
+
 func BenchmarkProve(b *testing.B) {
 	trie, vals := randomTrie(100)
 	var keys []string
@@ -161,3 +449,57 @@ func randBytes(n int) []byte {
 	crand.Read(r)
 	return r
 }
+
+// sortedEntries returns the key/value pairs of a random trie ordered by key.
+func sortedEntries(vals map[string]*kv) []*kv {
+	entries := make([]*kv, 0, len(vals))
+	for _, entry := range vals {
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool { return bytes.Compare(entries[i].k, entries[j].k) < 0 })
+	return entries
+}
+
+// rangeOf splits a list of entries into separate key and value lists.
+func rangeOf(entries []*kv) ([][]byte, [][]byte) {
+	keys := make([][]byte, len(entries))
+	values := make([][]byte, len(entries))
+	for i, entry := range entries {
+		keys[i], values[i] = entry.k, entry.v
+	}
+	return keys, values
+}
+
+// proveRange collects the edge proofs of a range into a proof database.
+func proveRange(t *testing.T, trie *Trie, first, last []byte) *wshdb.MemDatabase {
+	proof, _ := wshdb.NewMemDatabase()
+	if err := trie.Prove(first, 0, proof); err != nil {
+		t.Fatalf("failed to prove first key %x: %v", first, err)
+	}
+	if err := trie.Prove(last, 0, proof); err != nil {
+		t.Fatalf("failed to prove last key %x: %v", last, err)
+	}
+	return proof
+}
+
+// increaseKey increments a key by one in place, wrapping around on overflow.
+func increaseKey(key []byte) []byte {
+	for i := len(key) - 1; i >= 0; i-- {
+		key[i]++
+		if key[i] != 0x00 {
+			break
+		}
+	}
+	return key
+}
+
+// decreaseKey decrements a key by one in place, wrapping around on underflow.
+func decreaseKey(key []byte) []byte {
+	for i := len(key) - 1; i >= 0; i-- {
+		key[i]--
+		if key[i] != 0xff {
+			break
+		}
+	}
+	return key
+}
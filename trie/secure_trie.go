@@ -56,10 +56,16 @@ type SecureTrie struct {
 // A new cache generation is created by each call to Commit.
 // cachelimit sets the number of past cache generations to keep.
 func NewSecure(root common.Hash, db Database, cachelimit uint16) (*SecureTrie, error) {
+	return NewSecureWithHook(root, db, cachelimit, nil)
+}
+
+// NewSecureWithHook creates a secure trie with an existing root node from db,
+// same as NewSecure, but requests any node missing from db from hook.
+func NewSecureWithHook(root common.Hash, db Database, cachelimit uint16, hook MissingNodeHook) (*SecureTrie, error) {
 	if db == nil {
 		panic("NewSecure called with nil database")
 	}
-	trie, err := New(root, db)
+	trie, err := NewWithHook(root, db, hook)
 	if err != nil {
 		return nil, err
 	}
@@ -198,7 +204,7 @@ func (t *SecureTrie) secKey(key []byte) []byte {
 // The caller must not hold onto the return value because it will become
 // invalid on the next call to hashKey or secKey.
 func (t *SecureTrie) hashKey(key []byte) []byte {
-	h := newHasher(0, 0)
+	h := newHasher(0, 0, false)
 	h.sha.Reset()
 	h.sha.Write(key)
 	buf := h.sha.Sum(t.hashKeyBuf[:0])
@@ -0,0 +1,279 @@
+// Copyright 2018 The go-wiseplat Authors
+// This file is part of the go-wiseplat library.
+//
+// The go-wiseplat library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-wiseplat library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-wiseplat library. If not, see <http://www.gnu.org/licenses/>.
+
+package trie
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	"github.com/wiseplat/go-wiseplat/common"
+	"github.com/wiseplat/go-wiseplat/log"
+)
+
+var (
+	errStackTrieUnordered = errors.New("stack trie keys not in ascending order")
+	errStackTrieEmptyVal  = errors.New("stack trie values must not be empty")
+	errStackTriePrefixKey = errors.New("stack trie keys must not be prefixes of each other")
+	errStackTrieHashed    = errors.New("stack trie already hashed")
+)
+
+// Stack trie node types.
+const (
+	stEmpty = iota
+	stLeaf
+	stExt
+	stBranch
+	stHashed
+)
+
+// stNode is a node of the stack trie. Only the rightmost path of the trie is
+// ever held in expanded form, every subtree to the left of it is collapsed into
+// its hash (or its embedded encoding if it is smaller than a hash).
+type stNode struct {
+	typ      uint8
+	key      []byte      // key nibbles of leaf and extension nodes, without terminator
+	val      []byte      // value of leaf nodes
+	children [16]*stNode // children of branch nodes, extensions use only the first slot
+	hashed   node        // collapsed form of the node once it has been hashed
+}
+
+// StackTrie is a trie implementation that expects keys to be inserted in
+// ascending order. Once a key is inserted, every subtree left of it can no
+// longer change, so it is hashed right away and its nodes are released. This
+// keeps memory usage proportional to the depth of the trie instead of its size,
+// making it well suited for computing the root hash of large, sorted data sets
+// such as derived transaction and receipt tries or state sync ranges.
+//
+// The resulting root hash is identical to the one a Trie holding the same key
+// value pairs would produce. If a database is given, all hashed nodes are also
+// written into it.
+//
+// StackTrie is not safe for concurrent use.
+type StackTrie struct {
+	db   DatabaseWriter
+	root *stNode
+	last []byte // last inserted key, used to enforce ordering
+	h    *hasher
+}
+
+// NewStackTrie creates an empty stack trie. If db is not nil, the nodes of the
+// trie are written into it as they are hashed.
+func NewStackTrie(db DatabaseWriter) *StackTrie {
+	return &StackTrie{
+		db:   db,
+		root: new(stNode),
+		h:    newHasher(0, 0, false),
+	}
+}
+
+// Reset clears the stack trie so it can be reused for a new set of keys.
+func (t *StackTrie) Reset() {
+	t.root = new(stNode)
+	t.last = nil
+}
+
+// Update inserts a key value pair into the trie. Keys must be inserted in
+// strictly ascending order and values must not be empty.
+func (t *StackTrie) Update(key, value []byte) {
+	if err := t.TryUpdate(key, value); err != nil {
+		log.Error(fmt.Sprintf("Unhandled trie error: %v", err))
+	}
+}
+
+// TryUpdate inserts a key value pair into the trie. Keys must be inserted in
+// strictly ascending order and values must not be empty.
+//
+// If a node could not be written into the database, the error is returned.
+func (t *StackTrie) TryUpdate(key, value []byte) error {
+	if len(value) == 0 {
+		return errStackTrieEmptyVal
+	}
+	if t.root.typ == stHashed {
+		return errStackTrieHashed
+	}
+	if t.last != nil && bytes.Compare(key, t.last) <= 0 {
+		return errStackTrieUnordered
+	}
+	t.last = common.CopyBytes(key)
+
+	k := keybytesToHex(key)
+	return t.insert(t.root, k[:len(k)-1], common.CopyBytes(value))
+}
+
+// insert adds the given key (in nibbles, without terminator) below st.
+func (t *StackTrie) insert(st *stNode, key, value []byte) error {
+	switch st.typ {
+	case stEmpty:
+		st.typ, st.key, st.val = stLeaf, key, value
+		return nil
+
+	case stBranch:
+		if len(key) == 0 {
+			return errStackTriePrefixKey
+		}
+		idx := int(key[0])
+		// Every older sibling is now final, collapse the closest unhashed one.
+		// All siblings before that were collapsed by earlier insertions.
+		for i := idx - 1; i >= 0; i-- {
+			if st.children[i] != nil {
+				if st.children[i].typ != stHashed {
+					if err := t.hash(st.children[i], false); err != nil {
+						return err
+					}
+				}
+				break
+			}
+		}
+		if st.children[idx] == nil {
+			st.children[idx] = &stNode{typ: stLeaf, key: key[1:], val: value}
+			return nil
+		}
+		return t.insert(st.children[idx], key[1:], value)
+
+	case stExt:
+		diff := prefixLen(st.key, key)
+		if diff == len(st.key) {
+			return t.insert(st.children[0], key[diff:], value)
+		}
+		if diff == len(key) {
+			return errStackTriePrefixKey
+		}
+		// The new key diverges within the extension, so everything below it
+		// is final. Collapse it, wrapped in a shorter extension if needed.
+		var n *stNode
+		if diff < len(st.key)-1 {
+			n = &stNode{typ: stExt, key: st.key[diff+1:]}
+			n.children[0] = st.children[0]
+		} else {
+			n = st.children[0]
+		}
+		if err := t.hash(n, false); err != nil {
+			return err
+		}
+		t.split(st, diff, n, key, value)
+		return nil
+
+	case stLeaf:
+		diff := prefixLen(st.key, key)
+		if diff == len(st.key) || diff == len(key) {
+			return errStackTriePrefixKey
+		}
+		// Move the existing value into its own, now final, leaf.
+		n := &stNode{typ: stLeaf, key: st.key[diff+1:], val: st.val}
+		if err := t.hash(n, false); err != nil {
+			return err
+		}
+		st.val = nil
+		t.split(st, diff, n, key, value)
+		return nil
+
+	case stHashed:
+		return errStackTrieHashed
+
+	default:
+		panic(fmt.Sprintf("invalid stack trie node type %d", st.typ))
+	}
+}
+
+// split turns st into a branch at position diff of its key, placing the old
+// content n and a new leaf for key/value below it. If diff is not zero, st
+// becomes an extension with the shared prefix leading to the branch.
+func (t *StackTrie) split(st *stNode, diff int, n *stNode, key, value []byte) {
+	origIdx, newIdx := st.key[diff], key[diff]
+
+	branch := st
+	if diff > 0 {
+		branch = new(stNode)
+		st.typ, st.key = stExt, st.key[:diff]
+		st.children[0] = branch
+	} else {
+		st.typ, st.key = stBranch, nil
+		st.children[0] = nil
+	}
+	branch.typ = stBranch
+	branch.children[origIdx] = n
+	branch.children[newIdx] = &stNode{typ: stLeaf, key: key[diff+1:], val: value}
+}
+
+// hash collapses st and all its children, replacing it with a hashed node that
+// holds either the hash of its encoding or, for nodes smaller than a hash, the
+// collapsed node itself.
+func (t *StackTrie) hash(st *stNode, force bool) error {
+	var n node
+	switch st.typ {
+	case stHashed:
+		return nil
+
+	case stEmpty:
+		st.typ, st.hashed = stHashed, hashNode(emptyRoot.Bytes())
+		return nil
+
+	case stLeaf:
+		// Leaf keys always end where the original key ended, so appending
+		// the terminator only overwrites the terminator already there.
+		n = &shortNode{Key: hexToCompact(append(st.key, 16)), Val: valueNode(st.val)}
+
+	case stExt:
+		if err := t.hash(st.children[0], false); err != nil {
+			return err
+		}
+		n = &shortNode{Key: hexToCompact(st.key), Val: st.children[0].hashed}
+
+	case stBranch:
+		fn := new(fullNode)
+		for i, child := range st.children {
+			if child == nil {
+				fn.Children[i] = valueNode(nil)
+				continue
+			}
+			if err := t.hash(child, false); err != nil {
+				return err
+			}
+			fn.Children[i] = child.hashed
+		}
+		fn.Children[16] = valueNode(nil)
+		n = fn
+
+	default:
+		panic(fmt.Sprintf("invalid stack trie node type %d", st.typ))
+	}
+	hashed, err := t.h.store(n, t.db, force)
+	if err != nil {
+		return err
+	}
+	st.typ, st.hashed = stHashed, hashed
+	st.key, st.val, st.children = nil, nil, [16]*stNode{}
+	return nil
+}
+
+// Hash returns the root hash of the trie. Afterwards no more keys can be
+// inserted until the trie is Reset.
+func (t *StackTrie) Hash() common.Hash {
+	root, _ := t.Commit()
+	return root
+}
+
+// Commit hashes the remaining nodes of the trie, writes them into the database
+// if one was given, and returns the root hash. Afterwards no more keys can be
+// inserted until the trie is Reset.
+func (t *StackTrie) Commit() (common.Hash, error) {
+	if err := t.hash(t.root, true); err != nil {
+		return common.Hash{}, err
+	}
+	return common.BytesToHash(t.root.hashed.(hashNode)), nil
+}
@@ -0,0 +1,189 @@
+// Copyright 2018 The go-wiseplat Authors
+// This file is part of the go-wiseplat library.
+//
+// The go-wiseplat library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-wiseplat library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-wiseplat library. If not, see <http://www.gnu.org/licenses/>.
+
+package trie
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	"github.com/wiseplat/go-wiseplat/common"
+	"github.com/wiseplat/go-wiseplat/rlp"
+	"github.com/wiseplat/go-wiseplat/wshdb"
+)
+
+func TestStackTrieEmpty(t *testing.T) {
+	if root := NewStackTrie(nil).Hash(); root != emptyRoot {
+		t.Fatalf("empty root mismatch: have %x, want %x", root, emptyRoot)
+	}
+}
+
+// Tests that the stack trie produces the same root as the regular trie for a
+// random set of keys, including small embedded nodes.
+func TestStackTrieRandom(t *testing.T) {
+	for _, n := range []int{0, 1, 2, 10, 100, 1000} {
+		trie, vals := randomTrie(n)
+
+		stack := NewStackTrie(nil)
+		for _, entry := range sortedEntries(vals) {
+			if err := stack.TryUpdate(entry.k, entry.v); err != nil {
+				t.Fatalf("%d: insert failed: %v", n, err)
+			}
+		}
+		if have, want := stack.Hash(), trie.Hash(); have != want {
+			t.Fatalf("%d: root mismatch: have %x, want %x", n, have, want)
+		}
+	}
+}
+
+// Tests that keys of varying length (as used by derived list tries) are hashed
+// identically to the regular trie.
+func TestStackTrieVariableKeys(t *testing.T) {
+	for _, n := range []int{1, 127, 128, 129, 300, 70000} {
+		keys := make([][]byte, n)
+		for i := range keys {
+			keys[i], _ = rlp.EncodeToBytes(uint(i))
+		}
+		trie := new(Trie)
+		for i, key := range keys {
+			trie.Update(key, common.LeftPadBytes([]byte{byte(i)}, i%40+1))
+		}
+		sorted := make([]int, 0, n)
+		for i := 1; i < n && i < 0x80; i++ {
+			sorted = append(sorted, i)
+		}
+		sorted = append(sorted, 0)
+		for i := 0x80; i < n; i++ {
+			sorted = append(sorted, i)
+		}
+		stack := NewStackTrie(nil)
+		for _, i := range sorted {
+			if err := stack.TryUpdate(keys[i], common.LeftPadBytes([]byte{byte(i)}, i%40+1)); err != nil {
+				t.Fatalf("%d: insert of key %x failed: %v", n, keys[i], err)
+			}
+		}
+		if have, want := stack.Hash(), trie.Hash(); have != want {
+			t.Fatalf("%d: root mismatch: have %x, want %x", n, have, want)
+		}
+	}
+}
+
+// Tests that committing a stack trie writes the same nodes the regular trie does.
+func TestStackTrieCommit(t *testing.T) {
+	trie, vals := randomTrie(500)
+	trieDb, _ := wshdb.NewMemDatabase()
+	want, err := trie.CommitTo(trieDb)
+	if err != nil {
+		t.Fatalf("failed to commit trie: %v", err)
+	}
+	stackDb, _ := wshdb.NewMemDatabase()
+	stack := NewStackTrie(stackDb)
+	for _, entry := range sortedEntries(vals) {
+		stack.Update(entry.k, entry.v)
+	}
+	have, err := stack.Commit()
+	if err != nil {
+		t.Fatalf("failed to commit stack trie: %v", err)
+	}
+	if have != want {
+		t.Fatalf("root mismatch: have %x, want %x", have, want)
+	}
+	if have, want := len(stackDb.Keys()), len(trieDb.Keys()); have != want {
+		t.Fatalf("node count mismatch: have %d, want %d", have, want)
+	}
+	for _, key := range trieDb.Keys() {
+		blob, err := stackDb.Get(key)
+		if err != nil {
+			t.Fatalf("node %x missing from stack trie database", key)
+		}
+		if orig, _ := trieDb.Get(key); !bytes.Equal(blob, orig) {
+			t.Fatalf("node %x mismatch: have %x, want %x", key, blob, orig)
+		}
+	}
+	// Ensure the committed trie is fully usable
+	reloaded, err := New(have, stackDb)
+	if err != nil {
+		t.Fatalf("failed to open committed trie: %v", err)
+	}
+	for _, entry := range vals {
+		if val := reloaded.Get(entry.k); !bytes.Equal(val, entry.v) {
+			t.Fatalf("value mismatch for %x: have %x, want %x", entry.k, val, entry.v)
+		}
+	}
+}
+
+func TestStackTrieInvalidInserts(t *testing.T) {
+	stack := NewStackTrie(nil)
+	if err := stack.TryUpdate([]byte{0x02}, []byte{0x01}); err != nil {
+		t.Fatalf("insert failed: %v", err)
+	}
+	if err := stack.TryUpdate([]byte{0x01}, []byte{0x01}); err != errStackTrieUnordered {
+		t.Errorf("out of order insert: have %v, want %v", err, errStackTrieUnordered)
+	}
+	if err := stack.TryUpdate([]byte{0x02}, []byte{0x01}); err != errStackTrieUnordered {
+		t.Errorf("duplicate insert: have %v, want %v", err, errStackTrieUnordered)
+	}
+	if err := stack.TryUpdate([]byte{0x02, 0x00}, []byte{0x01}); err != errStackTriePrefixKey {
+		t.Errorf("prefix insert: have %v, want %v", err, errStackTriePrefixKey)
+	}
+	if err := stack.TryUpdate([]byte{0x03}, nil); err != errStackTrieEmptyVal {
+		t.Errorf("empty value insert: have %v, want %v", err, errStackTrieEmptyVal)
+	}
+	stack.Hash()
+	if err := stack.TryUpdate([]byte{0x04}, []byte{0x01}); err != errStackTrieHashed {
+		t.Errorf("insert after hash: have %v, want %v", err, errStackTrieHashed)
+	}
+	stack.Reset()
+	if err := stack.TryUpdate([]byte{0x01}, []byte{0x01}); err != nil {
+		t.Errorf("insert after reset failed: %v", err)
+	}
+}
+
+func BenchmarkStackTrieHash(b *testing.B) {
+	benchSortedHash(b, func() hashUpdater { return NewStackTrie(nil) })
+}
+
+func BenchmarkTrieSortedHash(b *testing.B) {
+	benchSortedHash(b, func() hashUpdater { return new(Trie) })
+}
+
+// hashUpdater is the common subset of Trie and StackTrie used by the benchmarks.
+type hashUpdater interface {
+	Update(key, value []byte)
+	Hash() common.Hash
+}
+
+// benchSortedHash measures inserting benchElemCount sorted keys and hashing
+// the resulting trie.
+func benchSortedHash(b *testing.B, newTrie func() hashUpdater) {
+	keys := make([][]byte, benchElemCount)
+	vals := make([][]byte, benchElemCount)
+	for i := range keys {
+		keys[i], vals[i] = make([]byte, 32), make([]byte, 100)
+		binary.BigEndian.PutUint64(keys[i], uint64(i))
+		binary.BigEndian.PutUint64(vals[i], uint64(i))
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		trie := newTrie()
+		for j := range keys {
+			trie.Update(keys[j], vals[j])
+		}
+		trie.Hash()
+	}
+}
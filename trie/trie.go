@@ -22,6 +22,7 @@ import (
 	"fmt"
 
 	"github.com/wiseplat/go-wiseplat/common"
+	"github.com/wiseplat/go-wiseplat/crypto"
 	"github.com/wiseplat/go-wiseplat/crypto/sha3"
 	"github.com/wiseplat/go-wiseplat/log"
 	"github.com/rcrowley/go-metrics"
@@ -34,6 +35,11 @@ var (
 	emptyState common.Hash
 )
 
+// parallelHashThreshold is the number of modifications since the last hashing
+// (or commit) above which the children of the root are processed concurrently.
+// Below it, the goroutine overhead outweighs the gains.
+const parallelHashThreshold = 100
+
 var (
 	cacheMissCounter   = metrics.NewRegisteredCounter("trie/cachemiss", nil)
 	cacheUnloadCounter = metrics.NewRegisteredCounter("trie/cacheunload", nil)
@@ -77,6 +83,13 @@ type DatabaseWriter interface {
 	Put(key, value []byte) error
 }
 
+// MissingNodeHook is called by a trie when a node cannot be found in its
+// database. It may retrieve the node from elsewhere (e.g. from remote peers),
+// blocking until it becomes available, and must return the node's RLP encoding.
+// Returned nodes are verified against the requested hash and written into the
+// trie's database before use.
+type MissingNodeHook func(hash common.Hash) ([]byte, error)
+
 // Trie is a Merkle Patricia Trie.
 // The zero value is an empty trie with no database.
 // Use New to create a trie that sits on top of a database.
@@ -92,6 +105,12 @@ type Trie struct {
 	// new nodes are tagged with the current generation and unloaded
 	// when their generation is older than than cachegen-cachelimit.
 	cachegen, cachelimit uint16
+
+	// Number of updates and deletions since the last hash and commit,
+	// used to decide whether hashing is worth parallelizing.
+	unhashed, uncommitted int
+
+	missing MissingNodeHook // Optional source of nodes absent from db
 }
 
 // SetCacheLimit sets the number of 'cache generations' to keep.
@@ -112,7 +131,14 @@ func (t *Trie) newFlag() nodeFlag {
 // New will panic if db is nil and returns a MissingNodeError if root does
 // not exist in the database. Accessing the trie loads nodes from db on demand.
 func New(root common.Hash, db Database) (*Trie, error) {
-	trie := &Trie{db: db, originalRoot: root}
+	return NewWithHook(root, db, nil)
+}
+
+// NewWithHook creates a trie with an existing root node from db, same as New.
+// Any node missing from db, including the root, is requested from hook and
+// stored in db before the trie continues using it.
+func NewWithHook(root common.Hash, db Database, hook MissingNodeHook) (*Trie, error) {
+	trie := &Trie{db: db, originalRoot: root, missing: hook}
 	if (root != common.Hash{}) && root != emptyRoot {
 		if db == nil {
 			panic("trie.New: cannot use existing root without a database")
@@ -213,6 +239,8 @@ func (t *Trie) Update(key, value []byte) {
 //
 // If a node was not found in the database, a MissingNodeError is returned.
 func (t *Trie) TryUpdate(key, value []byte) error {
+	t.unhashed++
+	t.uncommitted++
 	k := keybytesToHex(key)
 	if len(value) != 0 {
 		_, n, err := t.insert(t.root, nil, k, valueNode(value))
@@ -309,6 +337,8 @@ func (t *Trie) Delete(key []byte) {
 // TryDelete removes any existing value for key from the trie.
 // If a node was not found in the database, a MissingNodeError is returned.
 func (t *Trie) TryDelete(key []byte) error {
+	t.unhashed++
+	t.uncommitted++
 	k := keybytesToHex(key)
 	_, n, err := t.delete(t.root, nil, k)
 	if err != nil {
@@ -448,6 +478,9 @@ func (t *Trie) resolveHash(n hashNode, prefix []byte) (node, error) {
 	cacheMissCounter.Inc(1)
 
 	enc, err := t.db.Get(n)
+	if (err != nil || enc == nil) && t.missing != nil {
+		enc, err = t.fetchMissing(common.BytesToHash(n))
+	}
 	if err != nil || enc == nil {
 		return nil, &MissingNodeError{NodeHash: common.BytesToHash(n), Path: prefix}
 	}
@@ -455,6 +488,22 @@ func (t *Trie) resolveHash(n hashNode, prefix []byte) (node, error) {
 	return dec, nil
 }
 
+// fetchMissing retrieves a node absent from the database via the missing node
+// hook, verifies it and stores it for later accesses.
+func (t *Trie) fetchMissing(hash common.Hash) ([]byte, error) {
+	enc, err := t.missing(hash)
+	if err != nil {
+		return nil, err
+	}
+	if crypto.Keccak256Hash(enc) != hash {
+		return nil, fmt.Errorf("missing node hook returned invalid node for %x", hash)
+	}
+	if err := t.db.Put(hash[:], enc); err != nil {
+		return nil, err
+	}
+	return enc, nil
+}
+
 // Root returns the root hash of the trie.
 // Deprecated: use Hash instead.
 func (t *Trie) Root() []byte { return t.Hash().Bytes() }
@@ -500,7 +549,21 @@ func (t *Trie) hashRoot(db DatabaseWriter) (node, node, error) {
 	if t.root == nil {
 		return hashNode(emptyRoot.Bytes()), nil, nil
 	}
-	h := newHasher(t.cachegen, t.cachelimit)
+	// Hashing only needs to revisit the nodes modified since the last hash,
+	// committing those modified since the last commit.
+	parallel := t.unhashed >= parallelHashThreshold
+	if db != nil {
+		parallel = t.uncommitted >= parallelHashThreshold
+	}
+	h := newHasher(t.cachegen, t.cachelimit, parallel)
 	defer returnHasherToPool(h)
-	return h.hash(t.root, db, true)
+
+	hashed, cached, err := h.hash(t.root, db, true)
+	if err == nil {
+		t.unhashed = 0
+		if db != nil {
+			t.uncommitted = 0
+		}
+	}
+	return hashed, cached, err
 }
@@ -148,6 +148,46 @@ func TestMissingNode(t *testing.T) {
 	}
 }
 
+// Tests that nodes missing from the database are retrieved via the missing
+// node hook, verified and persisted.
+func TestMissingNodeHook(t *testing.T) {
+	remote, _ := wshdb.NewMemDatabase()
+	trie, _ := New(common.Hash{}, remote)
+	updateString(trie, "120000", "qwerqwerqwerqwerqwerqwerqwerqwer")
+	updateString(trie, "123456", "asdfasdfasdfasdfasdfasdfasdfasdf")
+	root, _ := trie.Commit()
+
+	local, _ := wshdb.NewMemDatabase()
+	fetched := 0
+	hook := func(hash common.Hash) ([]byte, error) {
+		fetched++
+		return remote.Get(hash[:])
+	}
+	trie, err := NewWithHook(root, local, hook)
+	if err != nil {
+		t.Fatalf("failed to open trie with missing root: %v", err)
+	}
+	if val := getString(trie, "123456"); string(val) != "asdfasdfasdfasdfasdfasdfasdfasdf" {
+		t.Errorf("value mismatch: have %q", val)
+	}
+	if len(local.Keys()) != fetched {
+		t.Errorf("fetched nodes not persisted: have %d, want %d", len(local.Keys()), fetched)
+	}
+	// Nodes already fetched must be served from the database
+	before := fetched
+	trie, _ = NewWithHook(root, local, hook)
+	getString(trie, "123456")
+	if fetched != before {
+		t.Errorf("persisted nodes refetched: have %d fetches, want %d", fetched, before)
+	}
+	// Invalid nodes returned by the hook must be rejected
+	bad, _ := wshdb.NewMemDatabase()
+	_, err = NewWithHook(root, bad, func(hash common.Hash) ([]byte, error) { return []byte{0xc0}, nil })
+	if _, ok := err.(*MissingNodeError); !ok {
+		t.Errorf("invalid node accepted: %v", err)
+	}
+}
+
 func TestInsert(t *testing.T) {
 	trie := newEmpty()
 
@@ -353,6 +393,59 @@ func TestCacheUnload(t *testing.T) {
 	}
 }
 
+// recordingDB is a DatabaseWriter logging the sequence of writes it receives.
+type recordingDB struct {
+	keys, values [][]byte
+}
+
+func (db *recordingDB) Put(key, value []byte) error {
+	db.keys = append(db.keys, common.CopyBytes(key))
+	db.values = append(db.values, common.CopyBytes(value))
+	return nil
+}
+
+// TestParallelHashing checks that hashing and committing the children of the
+// root concurrently yields exactly the same root and database writes, in the
+// same order, as doing it sequentially.
+func TestParallelHashing(t *testing.T) {
+	addresses, accounts := makeAccounts(1000)
+	build := func() *Trie {
+		trie := newEmpty()
+		for i := 0; i < len(addresses); i++ {
+			trie.Update(crypto.Keccak256(addresses[i][:]), accounts[i])
+		}
+		return trie
+	}
+	seqTrie, parTrie := build(), build()
+	seqTrie.unhashed, seqTrie.uncommitted = 0, 0
+
+	if seq, par := seqTrie.Hash(), parTrie.Hash(); seq != par {
+		t.Fatalf("hash mismatch: sequential %x, parallel %x", seq, par)
+	}
+	// Modify both tries enough to commit in parallel again
+	for i := 0; i < len(addresses); i += 5 {
+		seqTrie.Delete(crypto.Keccak256(addresses[i][:]))
+		parTrie.Delete(crypto.Keccak256(addresses[i][:]))
+	}
+	seqTrie.uncommitted = 0
+
+	seqDb, parDb := new(recordingDB), new(recordingDB)
+	seq, err := seqTrie.CommitTo(seqDb)
+	if err != nil {
+		t.Fatalf("sequential commit failed: %v", err)
+	}
+	par, err := parTrie.CommitTo(parDb)
+	if err != nil {
+		t.Fatalf("parallel commit failed: %v", err)
+	}
+	if seq != par {
+		t.Fatalf("commit root mismatch: sequential %x, parallel %x", seq, par)
+	}
+	if !reflect.DeepEqual(seqDb, parDb) {
+		t.Fatalf("database writes mismatch: sequential %d nodes, parallel %d nodes", len(seqDb.keys), len(parDb.keys))
+	}
+}
+
 // randTest performs random trie operations.
 // Instances of this test are created by Generate.
 type randTest []randTestStep
@@ -555,17 +648,64 @@ func benchUpdate(b *testing.B, e binary.ByteOrder) *Trie {
 // the first one will be NOOP. As such, we'll use b.N as the number of account to
 // insert into the trie before measuring the hashing.
 func BenchmarkHash(b *testing.B) {
+	// Create a realistic account trie to hash
+	addresses, accounts := makeAccounts(b.N)
+
+	// Insert the accounts into the trie and hash it
+	trie := newEmpty()
+	for i := 0; i < len(addresses); i++ {
+		trie.Update(crypto.Keccak256(addresses[i][:]), accounts[i])
+	}
+	b.ResetTimer()
+	b.ReportAllocs()
+	trie.Hash()
+}
+
+// Benchmarks hashing and committing a fixed size account trie with and without
+// processing the root's children concurrently.
+func BenchmarkHashSequential(b *testing.B)   { benchHashFixedSize(b, false, false) }
+func BenchmarkHashParallel(b *testing.B)     { benchHashFixedSize(b, true, false) }
+func BenchmarkCommitSequential(b *testing.B) { benchHashFixedSize(b, false, true) }
+func BenchmarkCommitParallel(b *testing.B)   { benchHashFixedSize(b, true, true) }
+
+func benchHashFixedSize(b *testing.B, parallel bool, commit bool) {
+	addresses, accounts := makeAccounts(benchElemCount)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		trie := newEmpty()
+		for j := 0; j < len(addresses); j++ {
+			trie.Update(crypto.Keccak256(addresses[j][:]), accounts[j])
+		}
+		if !parallel {
+			trie.unhashed, trie.uncommitted = 0, 0
+		}
+		db, _ := wshdb.NewMemDatabase()
+		b.StartTimer()
+
+		if commit {
+			trie.CommitTo(db)
+		} else {
+			trie.Hash()
+		}
+	}
+}
+
+// makeAccounts generates a deterministic set of random addresses and RLP
+// encoded accounts for the hashing benchmarks.
+func makeAccounts(size int) (addresses [][20]byte, accounts [][]byte) {
 	// Make the random benchmark deterministic
 	random := rand.New(rand.NewSource(0))
 
-	// Create a realistic account trie to hash
-	addresses := make([][20]byte, b.N)
+	addresses = make([][20]byte, size)
 	for i := 0; i < len(addresses); i++ {
 		for j := 0; j < len(addresses[i]); j++ {
 			addresses[i][j] = byte(random.Intn(256))
 		}
 	}
-	accounts := make([][]byte, len(addresses))
+	accounts = make([][]byte, len(addresses))
 	for i := 0; i < len(accounts); i++ {
 		var (
 			nonce   = uint64(random.Int63())
@@ -575,14 +715,7 @@ func BenchmarkHash(b *testing.B) {
 		)
 		accounts[i], _ = rlp.EncodeToBytes([]interface{}{nonce, balance, root, code})
 	}
-	// Insert the accounts into the trie and hash it
-	trie := newEmpty()
-	for i := 0; i < len(addresses); i++ {
-		trie.Update(crypto.Keccak256(addresses[i][:]), accounts[i])
-	}
-	b.ResetTimer()
-	b.ReportAllocs()
-	trie.Hash()
+	return addresses, accounts
 }
 
 func tempDB() (string, Database) {
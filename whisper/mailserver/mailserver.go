@@ -19,7 +19,10 @@ package mailserver
 import (
 	"bytes"
 	"encoding/binary"
+	"errors"
 	"fmt"
+	"sync"
+	"time"
 
 	"github.com/wiseplat/go-wiseplat/cmd/utils"
 	"github.com/wiseplat/go-wiseplat/common"
@@ -31,11 +34,32 @@ import (
 	"github.com/syndtr/goleveldb/leveldb/util"
 )
 
+// CompletedTopic is the topic of the message sent back to the peer when a
+// history request has been processed. Its payload is an RLP encoded
+// RequestCompleted, encrypted with the mail server's symmetric key.
+var CompletedTopic = whisper.BytesToTopic([]byte("mail"))
+
+const (
+	requestTimeLength   = 8 // lower and upper bound of the time range
+	legacyRequestLength = requestTimeLength + whisper.TopicLength
+
+	completedPoW      = 0.00001 // PoW of the completion message, delivered directly to the peer
+	completedWorkTime = 1
+)
+
+var (
+	errUndersizedRequest = errors.New("undersized request")
+	errInvalidCursor     = errors.New("invalid cursor")
+)
+
 type WMailServer struct {
 	db  *leveldb.DB
 	w   *whisper.Whisper
 	pow float64
 	key []byte
+
+	pruneQuit chan struct{}
+	pruneWg   sync.WaitGroup
 }
 
 type DBKey struct {
@@ -55,6 +79,100 @@ func NewDbKey(t uint32, h common.Hash) *DBKey {
 	return &k
 }
 
+// MessagesRequest is a request for archived envelopes sent within a time range.
+// Only envelopes matching one of the topics are delivered, all of them if no
+// topics are given. If Limit is set, at most Limit envelopes are delivered per
+// request and the remaining ones can be fetched by repeating the request with
+// the cursor returned in the RequestCompleted message.
+type MessagesRequest struct {
+	Lower  uint32
+	Upper  uint32
+	Topics []whisper.TopicType
+	Limit  uint32
+	Cursor []byte
+}
+
+// requestExt holds the fields of a request following the time range and the
+// topic of the original request format.
+type requestExt struct {
+	Limit  uint32
+	Cursor []byte
+	Topics []whisper.TopicType
+}
+
+// RequestCompleted is sent back to the peer once a request has been processed.
+// Cursor is empty if all envelopes were delivered.
+type RequestCompleted struct {
+	RequestHash common.Hash
+	Cursor      []byte
+}
+
+// Payload encodes the request as the payload of a request message. Requests
+// without limit, cursor and with at most one topic use the original format,
+// otherwise the additional fields are appended in RLP.
+func (r *MessagesRequest) Payload() []byte {
+	data := make([]byte, legacyRequestLength)
+	binary.BigEndian.PutUint32(data, r.Lower)
+	binary.BigEndian.PutUint32(data[4:], r.Upper)
+
+	if r.Limit == 0 && len(r.Cursor) == 0 && len(r.Topics) <= 1 {
+		if len(r.Topics) == 0 {
+			return data[:requestTimeLength]
+		}
+		copy(data[requestTimeLength:], r.Topics[0][:])
+		return data
+	}
+	ext, _ := rlp.EncodeToBytes(&requestExt{Limit: r.Limit, Cursor: r.Cursor, Topics: r.Topics})
+	return append(data, ext...)
+}
+
+// decodeRequest parses the payload of a request message.
+func decodeRequest(payload []byte) (*MessagesRequest, error) {
+	if len(payload) < requestTimeLength {
+		return nil, errUndersizedRequest
+	}
+	r := &MessagesRequest{
+		Lower: binary.BigEndian.Uint32(payload[:4]),
+		Upper: binary.BigEndian.Uint32(payload[4:8]),
+	}
+	if len(payload) < legacyRequestLength {
+		return r, nil
+	}
+	var empty whisper.TopicType
+	if topic := whisper.BytesToTopic(payload[requestTimeLength:]); topic != empty {
+		r.Topics = append(r.Topics, topic)
+	}
+	if len(payload) == legacyRequestLength {
+		return r, nil
+	}
+	var ext requestExt
+	if err := rlp.DecodeBytes(payload[legacyRequestLength:], &ext); err != nil {
+		return nil, err
+	}
+	if len(ext.Cursor) != 0 && len(ext.Cursor) != common.HashLength+4 {
+		return nil, errInvalidCursor
+	}
+	r.Limit = ext.Limit
+	if len(ext.Cursor) > 0 {
+		r.Cursor = ext.Cursor
+	}
+	r.Topics = append(r.Topics, ext.Topics...)
+	return r, nil
+}
+
+// matchTopic checks if the envelope's topic is requested.
+func (r *MessagesRequest) matchTopic(topic whisper.TopicType) bool {
+	if len(r.Topics) == 0 {
+		return true
+	}
+	for _, t := range r.Topics {
+		if t == topic {
+			return true
+		}
+	}
+	return false
+}
+
 func (s *WMailServer) Init(shh *whisper.Whisper, path string, password string, pow float64) {
 	var err error
 	if len(path) == 0 {
@@ -83,7 +201,60 @@ func (s *WMailServer) Init(shh *whisper.Whisper, path string, password string, p
 	}
 }
 
+// StartPruning periodically deletes archived envelopes older than maxAge,
+// checking every interval until the server is closed.
+func (s *WMailServer) StartPruning(maxAge, interval time.Duration) {
+	if s.pruneQuit != nil {
+		return
+	}
+	s.pruneQuit = make(chan struct{})
+	s.pruneWg.Add(1)
+	go func() {
+		defer s.pruneWg.Done()
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			threshold := uint32(time.Now().Add(-maxAge).Unix())
+			if n, err := s.Prune(threshold); err != nil {
+				log.Error(fmt.Sprintf("Pruning archived envelopes failed: %s", err))
+			} else if n > 0 {
+				log.Info("Pruned archived envelopes", "count", n, "threshold", threshold)
+			}
+			select {
+			case <-ticker.C:
+			case <-s.pruneQuit:
+				return
+			}
+		}
+	}()
+}
+
+// Prune deletes all archived envelopes sent before the given timestamp and
+// returns their number.
+func (s *WMailServer) Prune(before uint32) (int, error) {
+	var zero common.Hash
+	kl := NewDbKey(0, zero)
+	ku := NewDbKey(before, zero)
+	i := s.db.NewIterator(&util.Range{Start: kl.raw, Limit: ku.raw}, nil)
+	defer i.Release()
+
+	batch := new(leveldb.Batch)
+	for i.Next() {
+		batch.Delete(i.Key())
+	}
+	if err := i.Error(); err != nil {
+		return 0, err
+	}
+	return batch.Len(), s.db.Write(batch, nil)
+}
+
 func (s *WMailServer) Close() {
+	if s.pruneQuit != nil {
+		close(s.pruneQuit)
+		s.pruneWg.Wait()
+		s.pruneQuit = nil
+	}
 	if s.db != nil {
 		s.db.Close()
 	}
@@ -108,30 +279,49 @@ func (s *WMailServer) DeliverMail(peer *whisper.Peer, request *whisper.Envelope)
 		return
 	}
 
-	ok, lower, upper, topic := s.validateRequest(peer.ID(), request)
-	if ok {
-		s.processRequest(peer, lower, upper, topic)
+	ok, req := s.validateRequest(peer.ID(), request)
+	if !ok {
+		return
+	}
+	_, cursor, err := s.processRequest(peer, req)
+	if err != nil {
+		return
+	}
+	if err := s.sendCompleted(peer, request.Hash(), cursor); err != nil {
+		log.Error(fmt.Sprintf("Failed to send request completion to peer: %s", err))
 	}
 }
 
-func (s *WMailServer) processRequest(peer *whisper.Peer, lower, upper uint32, topic whisper.TopicType) []*whisper.Envelope {
+// processRequest delivers the archived envelopes matching the request to the
+// peer, or returns them if peer is nil. If the limit was reached, the key of
+// the last delivered envelope is returned as cursor for the next request.
+func (s *WMailServer) processRequest(peer *whisper.Peer, req *MessagesRequest) ([]*whisper.Envelope, []byte, error) {
 	ret := make([]*whisper.Envelope, 0)
 	var err error
 	var zero common.Hash
-	var empty whisper.TopicType
-	kl := NewDbKey(lower, zero)
-	ku := NewDbKey(upper, zero)
-	i := s.db.NewIterator(&util.Range{Start: kl.raw, Limit: ku.raw}, nil)
+	kl := NewDbKey(req.Lower, zero)
+	ku := NewDbKey(req.Upper, zero)
+	start := kl.raw
+	if len(req.Cursor) > 0 && bytes.Compare(req.Cursor, start) >= 0 {
+		// continue right after the last delivered envelope
+		start = append(common.CopyBytes(req.Cursor), 0)
+	}
+	i := s.db.NewIterator(&util.Range{Start: start, Limit: ku.raw}, nil)
 	defer i.Release()
 
+	var (
+		sent   uint32
+		cursor []byte
+	)
 	for i.Next() {
 		var envelope whisper.Envelope
 		err = rlp.DecodeBytes(i.Value(), &envelope)
 		if err != nil {
 			log.Error(fmt.Sprintf("RLP decoding failed: %s", err))
+			continue
 		}
 
-		if topic == empty || envelope.Topic == topic {
+		if req.matchTopic(envelope.Topic) {
 			if peer == nil {
 				// used for test purposes
 				ret = append(ret, &envelope)
@@ -139,9 +329,14 @@ func (s *WMailServer) processRequest(peer *whisper.Peer, lower, upper uint32, to
 				err = s.w.SendP2PDirect(peer, &envelope)
 				if err != nil {
 					log.Error(fmt.Sprintf("Failed to send direct message to peer: %s", err))
-					return nil
+					return nil, nil, err
 				}
 			}
+			sent++
+			if req.Limit > 0 && sent >= req.Limit {
+				cursor = common.CopyBytes(i.Key())
+				break
+			}
 		}
 	}
 
@@ -150,25 +345,49 @@ func (s *WMailServer) processRequest(peer *whisper.Peer, lower, upper uint32, to
 		log.Error(fmt.Sprintf("Level DB iterator error: %s", err))
 	}
 
-	return ret
+	return ret, cursor, nil
+}
+
+// sendCompleted notifies the peer that the request has been processed.
+func (s *WMailServer) sendCompleted(peer *whisper.Peer, requestHash common.Hash, cursor []byte) error {
+	payload, err := rlp.EncodeToBytes(&RequestCompleted{RequestHash: requestHash, Cursor: cursor})
+	if err != nil {
+		return err
+	}
+	params := &whisper.MessageParams{
+		KeySym:   s.key,
+		Topic:    CompletedTopic,
+		Payload:  payload,
+		PoW:      completedPoW,
+		WorkTime: completedWorkTime,
+	}
+	msg, err := whisper.NewSentMessage(params)
+	if err != nil {
+		return err
+	}
+	env, err := msg.Wrap(params)
+	if err != nil {
+		return err
+	}
+	return s.w.SendP2PDirect(peer, env)
 }
 
-func (s *WMailServer) validateRequest(peerID []byte, request *whisper.Envelope) (bool, uint32, uint32, whisper.TopicType) {
-	var topic whisper.TopicType
+func (s *WMailServer) validateRequest(peerID []byte, request *whisper.Envelope) (bool, *MessagesRequest) {
 	if s.pow > 0.0 && request.PoW() < s.pow {
-		return false, 0, 0, topic
+		return false, nil
 	}
 
 	f := whisper.Filter{KeySym: s.key}
 	decrypted := request.Open(&f)
 	if decrypted == nil {
 		log.Warn(fmt.Sprintf("Failed to decrypt p2p request"))
-		return false, 0, 0, topic
+		return false, nil
 	}
 
-	if len(decrypted.Payload) < 8 {
-		log.Warn(fmt.Sprintf("Undersized p2p request"))
-		return false, 0, 0, topic
+	req, err := decodeRequest(decrypted.Payload)
+	if err != nil {
+		log.Warn(fmt.Sprintf("Invalid p2p request: %s", err))
+		return false, nil
 	}
 
 	src := crypto.FromECDSAPub(decrypted.Src)
@@ -177,15 +396,8 @@ func (s *WMailServer) validateRequest(peerID []byte, request *whisper.Envelope)
 	}
 	if !bytes.Equal(peerID, src) {
 		log.Warn(fmt.Sprintf("Wrong signature of p2p request"))
-		return false, 0, 0, topic
-	}
-
-	lower := binary.BigEndian.Uint32(decrypted.Payload[:4])
-	upper := binary.BigEndian.Uint32(decrypted.Payload[4:8])
-
-	if len(decrypted.Payload) >= 8+whisper.TopicLength {
-		topic = whisper.BytesToTopic(decrypted.Payload[8:])
+		return false, nil
 	}
 
-	return true, lower, upper, topic
+	return true, req
 }
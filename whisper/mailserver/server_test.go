@@ -21,6 +21,8 @@ import (
 	"encoding/binary"
 	"io/ioutil"
 	"math/rand"
+	"os"
+	"reflect"
 	"testing"
 	"time"
 
@@ -138,22 +140,23 @@ func deliverTest(t *testing.T, server *WMailServer, env *whisper.Envelope) {
 func singleRequest(t *testing.T, server *WMailServer, env *whisper.Envelope, p *ServerTestParams, expect bool) {
 	request := createRequest(t, p)
 	src := crypto.FromECDSAPub(&p.key.PublicKey)
-	ok, lower, upper, topic := server.validateRequest(src, request)
+	ok, req := server.validateRequest(src, request)
 	if !ok {
 		t.Fatalf("request validation failed, seed: %d.", seed)
 	}
-	if lower != p.low {
+	if req.Lower != p.low {
 		t.Fatalf("request validation failed (lower bound), seed: %d.", seed)
 	}
-	if upper != p.upp {
+	if req.Upper != p.upp {
 		t.Fatalf("request validation failed (upper bound), seed: %d.", seed)
 	}
-	if topic != p.topic {
+	var empty whisper.TopicType
+	if (p.topic == empty && len(req.Topics) != 0) || (p.topic != empty && (len(req.Topics) != 1 || req.Topics[0] != p.topic)) {
 		t.Fatalf("request validation failed (topic), seed: %d.", seed)
 	}
 
 	var exist bool
-	mail := server.processRequest(nil, p.low, p.upp, p.topic)
+	mail, _, _ := server.processRequest(nil, req)
 	for _, msg := range mail {
 		if msg.Hash() == env.Hash() {
 			exist = true
@@ -166,9 +169,9 @@ func singleRequest(t *testing.T, server *WMailServer, env *whisper.Envelope, p *
 	}
 
 	src[0]++
-	ok, lower, upper, topic = server.validateRequest(src, request)
+	ok, req = server.validateRequest(src, request)
 	if ok {
-		t.Fatalf("request validation false positive, seed: %d (lower: %d, upper: %d).", seed, lower, upper)
+		t.Fatalf("request validation false positive, seed: %d (lower: %d, upper: %d).", seed, req.Lower, req.Upper)
 	}
 }
 
@@ -177,6 +180,10 @@ func createRequest(t *testing.T, p *ServerTestParams) *whisper.Envelope {
 	binary.BigEndian.PutUint32(data, p.low)
 	binary.BigEndian.PutUint32(data[4:], p.upp)
 	copy(data[8:], p.topic[:])
+	return createRequestWithPayload(t, p, data)
+}
+
+func createRequestWithPayload(t *testing.T, p *ServerTestParams, data []byte) *whisper.Envelope {
 
 	key, err := shh.GetSymKey(keyID)
 	if err != nil {
@@ -202,3 +209,166 @@ func createRequest(t *testing.T, p *ServerTestParams) *whisper.Envelope {
 	}
 	return env
 }
+
+func newTestServer(t *testing.T) (*WMailServer, string) {
+	const password = "password_for_this_test"
+
+	dir, err := ioutil.TempDir("", "whisper-server-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := new(WMailServer)
+	shh = whisper.New(&whisper.DefaultConfig)
+	shh.RegisterServer(server)
+	server.Init(shh, dir, password, powRequirement)
+
+	keyID, err = shh.AddSymKeyFromPassword(password)
+	if err != nil {
+		t.Fatalf("Failed to create symmetric key for mail request: %s", err)
+	}
+	return server, dir
+}
+
+// archiveTopics archives one envelope per topic and returns the sent time of
+// the first one.
+func archiveTopics(t *testing.T, server *WMailServer, topics []whisper.TopicType) uint32 {
+	var birth uint32
+	for i, topic := range topics {
+		env := generateEnvelope(t)
+		env.Topic = topic
+		env.EnvNonce = uint64(i) // make the hashes unique
+		if i == 0 {
+			birth = env.Expiry - env.TTL
+		}
+		server.Archive(env)
+	}
+	return birth
+}
+
+func TestMailServerRequestPayload(t *testing.T) {
+	server, dir := newTestServer(t)
+	defer os.RemoveAll(dir)
+	defer server.Close()
+
+	id, err := shh.NewKeyPair()
+	if err != nil {
+		t.Fatalf("failed to generate new key pair with seed %d: %s.", seed, err)
+	}
+	key, err := shh.GetPrivateKey(id)
+	if err != nil {
+		t.Fatalf("failed to retrieve new key pair with seed %d: %s.", seed, err)
+	}
+
+	cursor := NewDbKey(100, common.Hash{1}).raw
+	tests := []MessagesRequest{
+		{Lower: 1, Upper: 2},
+		{Lower: 1, Upper: 2, Topics: []whisper.TopicType{{1, 2, 3, 4}}},
+		{Lower: 1, Upper: 2, Topics: []whisper.TopicType{{1, 2, 3, 4}, {5, 6, 7, 8}}},
+		{Lower: 1, Upper: 2, Limit: 10},
+		{Lower: 1, Upper: 2, Limit: 10, Cursor: cursor, Topics: []whisper.TopicType{{1, 2, 3, 4}}},
+	}
+	for i, want := range tests {
+		payload := want.Payload()
+		if want.Limit == 0 && len(want.Topics) <= 1 && len(payload) != 8+whisper.TopicLength*len(want.Topics) {
+			t.Errorf("test %d: simple request not in original format: %x", i, payload)
+		}
+		request := createRequestWithPayload(t, &ServerTestParams{low: want.Lower, upp: want.Upper, key: key}, payload)
+		ok, have := server.validateRequest(crypto.FromECDSAPub(&key.PublicKey), request)
+		if !ok {
+			t.Fatalf("test %d: request validation failed, seed: %d.", i, seed)
+		}
+		if !reflect.DeepEqual(have, &want) {
+			t.Errorf("test %d: request mismatch:\nhave %+v\nwant %+v", i, have, &want)
+		}
+	}
+
+	// cursors must be DB keys
+	payload := (&MessagesRequest{Lower: 1, Upper: 2, Cursor: []byte{1, 2, 3}}).Payload()
+	request := createRequestWithPayload(t, &ServerTestParams{key: key}, payload)
+	if ok, _ := server.validateRequest(crypto.FromECDSAPub(&key.PublicKey), request); ok {
+		t.Fatalf("request with invalid cursor accepted")
+	}
+}
+
+func TestMailServerPagination(t *testing.T) {
+	server, dir := newTestServer(t)
+	defer os.RemoveAll(dir)
+	defer server.Close()
+
+	a, b := whisper.TopicType{1}, whisper.TopicType{2}
+	birth := archiveTopics(t, server, []whisper.TopicType{a, b, a, b, a, b, a, b, a, b})
+
+	// page through all envelopes
+	req := &MessagesRequest{Lower: birth - 1, Upper: birth + 5, Limit: 3}
+	seen := make(map[common.Hash]bool)
+	var pages []int
+	for {
+		mail, cursor, err := server.processRequest(nil, req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		pages = append(pages, len(mail))
+		for _, env := range mail {
+			if seen[env.Hash()] {
+				t.Fatalf("envelope %x delivered twice", env.Hash())
+			}
+			seen[env.Hash()] = true
+		}
+		if cursor == nil {
+			break
+		}
+		req.Cursor = cursor
+	}
+	if len(seen) != 10 || !reflect.DeepEqual(pages, []int{3, 3, 3, 1}) {
+		t.Fatalf("wrong pages: delivered %d envelopes in pages %v", len(seen), pages)
+	}
+
+	// filter by topics
+	req = &MessagesRequest{Lower: birth - 1, Upper: birth + 5, Topics: []whisper.TopicType{b}}
+	mail, cursor, _ := server.processRequest(nil, req)
+	if len(mail) != 5 || cursor != nil {
+		t.Fatalf("have %d envelopes for topic (cursor %x), want 5", len(mail), cursor)
+	}
+	for _, env := range mail {
+		if env.Topic != b {
+			t.Fatalf("delivered envelope with topic %x", env.Topic)
+		}
+	}
+	req.Topics = append(req.Topics, a)
+	if mail, _, _ := server.processRequest(nil, req); len(mail) != 10 {
+		t.Fatalf("have %d envelopes for both topics, want 10", len(mail))
+	}
+}
+
+func TestMailServerPrune(t *testing.T) {
+	server, dir := newTestServer(t)
+	defer os.RemoveAll(dir)
+	defer server.Close()
+
+	birth := archiveTopics(t, server, []whisper.TopicType{{1}, {2}, {3}})
+	req := &MessagesRequest{Lower: 0, Upper: 0xffffffff}
+
+	if n, err := server.Prune(birth - 10); err != nil || n != 0 {
+		t.Fatalf("pruned %d envelopes (err %v), want 0", n, err)
+	}
+	if mail, _, _ := server.processRequest(nil, req); len(mail) != 3 {
+		t.Fatalf("have %d envelopes, want 3", len(mail))
+	}
+	if n, err := server.Prune(birth + 10); err != nil || n != 3 {
+		t.Fatalf("pruned %d envelopes (err %v), want 3", n, err)
+	}
+	if mail, _, _ := server.processRequest(nil, req); len(mail) != 0 {
+		t.Fatalf("have %d envelopes after pruning, want 0", len(mail))
+	}
+
+	// the pruning loop removes envelopes older than the maximum age
+	archiveTopics(t, server, []whisper.TopicType{{1}})
+	server.StartPruning(-time.Hour, time.Hour)
+	for i := 0; i < 50; i++ {
+		if mail, _, _ := server.processRequest(nil, req); len(mail) == 0 {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("envelopes not pruned by the pruning loop")
+}
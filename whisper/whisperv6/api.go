@@ -97,6 +97,7 @@ type Info struct {
 	Messages       int     `json:"messages"`       // Number of floating messages.
 	MinPow         float64 `json:"minPow"`         // Minimal accepted PoW
 	MaxMessageSize uint32  `json:"maxMessageSize"` // Maximum accepted message size
+	LightClient    bool    `json:"lightClient"`    // Whether the node runs in light client mode
 }
 
 // Info returns diagnostic information about the whisper node.
@@ -107,6 +108,7 @@ func (api *PublicWhisperAPI) Info(ctx context.Context) Info {
 		Messages:       len(api.w.messageQueue) + len(api.w.p2pMsgQueue),
 		MinPow:         api.w.MinPow(),
 		MaxMessageSize: api.w.MaxMessageSize(),
+		LightClient:    api.w.LightClientMode(),
 	}
 }
 
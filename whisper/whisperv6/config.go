@@ -19,6 +19,7 @@ package whisperv6
 type Config struct {
 	MaxMessageSize     uint32  `toml:",omitempty"`
 	MinimumAcceptedPOW float64 `toml:",omitempty"`
+	LightClient        bool    `toml:",omitempty"` // only relay own envelopes and receive those matching the bloom filter
 }
 
 var DefaultConfig = Config{
@@ -26,6 +26,15 @@ Whisper is a pure identity-based messaging system. Whisper provides a low-level
 (non-application-specific) but easily-accessible API without being based upon
 or prejudiced by the low-level hardware attributes and characteristics,
 particularly the notion of singular endpoints.
+
+The status message exchanged in the handshake only contains the protocol
+version, so that nodes without light client support can still connect. Each
+node follows it up with a status extension message, carrying its bloom filter
+and whether it runs in light client mode. Light clients only relay their own
+envelopes and are sent the envelopes matching their bloom filter, which they
+update when their filters change. Nodes not sending the extension are treated
+as full nodes interested in all topics, and nodes not knowing it ignore it.
+Two light clients cannot relay anything to each other, so they disconnect.
 */
 package whisperv6
 
@@ -44,12 +53,15 @@ const (
 	messagesCode         = 1 // normal whisper message
 	p2pCode              = 2 // peer-to-peer message (to be consumed by the peer, but not forwarded any further)
 	p2pRequestCode       = 3 // peer-to-peer message, used by Dapp protocol
+	bloomFilterExCode    = 4 // bloom filter update, sent by light clients when their filters change
+	statusExCode         = 5 // optional status extension with bloom filter and light client flag
 	NumberOfMessageCodes = 64
 
 	paddingMask   = byte(3)
 	signatureFlag = byte(4)
 
 	TopicLength     = 4
+	BloomFilterSize = 64 // in bytes
 	signatureLength = 65
 	aesKeyLength    = 32
 	AESNonceLength  = 12
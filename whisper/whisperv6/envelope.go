@@ -173,6 +173,11 @@ func (e *Envelope) Hash() common.Hash {
 	return e.hash
 }
 
+// Bloom returns the bloom filter of the envelope's topic.
+func (e *Envelope) Bloom() []byte {
+	return TopicToBloom(e.Topic)
+}
+
 // DecodeRLP decodes an Envelope from an RLP data stream.
 func (e *Envelope) DecodeRLP(s *rlp.Stream) error {
 	raw, err := s.Raw()
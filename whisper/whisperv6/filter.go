@@ -93,6 +93,24 @@ func (fs *Filters) Get(id string) *Filter {
 	return fs.watchers[id]
 }
 
+// bloom returns the bloom filter matching the topics of all installed filters.
+func (fs *Filters) bloom() []byte {
+	fs.mutex.RLock()
+	defer fs.mutex.RUnlock()
+
+	bloom := make([]byte, BloomFilterSize)
+	for _, watcher := range fs.watchers {
+		if len(watcher.Topics) == 0 {
+			// filters without topics match all envelopes
+			return makeFullNodeBloom()
+		}
+		for _, t := range watcher.Topics {
+			addBloom(bloom, TopicToBloom(BytesToTopic(t)))
+		}
+	}
+	return bloom
+}
+
 func (fs *Filters) NotifyWatchers(env *Envelope, p2pMessage bool) {
 	var msg *ReceivedMessage
 
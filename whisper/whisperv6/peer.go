@@ -18,6 +18,7 @@ package whisperv6
 
 import (
 	"fmt"
+	"sync"
 	"time"
 
 	"github.com/wiseplat/go-wiseplat/common"
@@ -36,6 +37,9 @@ type Peer struct {
 
 	known *set.Set // Messages already known by the peer to avoid wasting bandwidth
 
+	bloomFilter []byte       // Topics the peer is interested in, nil matches all
+	bloomMu     sync.RWMutex // Mutex protecting the bloom filter
+
 	quit chan struct{}
 }
 
@@ -95,6 +99,54 @@ func (p *Peer) handshake() error {
 	return nil
 }
 
+// sendStatusEx sends the optional status extension with the local bloom filter
+// and light client flag. Peers not knowing the message simply ignore it and
+// keep relaying every envelope.
+func (p *Peer) sendStatusEx() error {
+	return p2p.SendItems(p.ws, statusExCode, p.host.BloomFilter(), p.host.LightClientMode())
+}
+
+// handleStatusEx decodes the status extension of the remote peer. Fields added
+// in later versions are ignored. Until it arrives, the peer is treated as a
+// full node interested in all topics. Light clients only relay their own
+// envelopes, so a light peer is useless to a local light client.
+func (p *Peer) handleStatusEx(packet p2p.Msg) error {
+	s := rlp.NewStream(packet.Payload, uint64(packet.Size))
+	if _, err := s.List(); err != nil {
+		return err
+	}
+	bloom, err := s.Bytes()
+	if err != nil {
+		return err
+	}
+	if len(bloom) != BloomFilterSize {
+		return fmt.Errorf("invalid bloom filter size %d", len(bloom))
+	}
+	light, err := s.Bool()
+	if err != nil {
+		return err
+	}
+	if light && p.host.LightClientMode() {
+		return fmt.Errorf("peer [%x] is a light client too", p.ID())
+	}
+	p.setBloomFilter(bloom)
+	return nil
+}
+
+// setBloomFilter replaces the bloom filter of the peer.
+func (p *Peer) setBloomFilter(bloom []byte) {
+	p.bloomMu.Lock()
+	defer p.bloomMu.Unlock()
+	p.bloomFilter = bloom
+}
+
+// bloomMatch checks whether the envelope matches the peer's bloom filter.
+func (p *Peer) bloomMatch(envelope *Envelope) bool {
+	p.bloomMu.RLock()
+	defer p.bloomMu.RUnlock()
+	return bloomFilterMatch(p.bloomFilter, envelope.Bloom())
+}
+
 // update executes periodic operations on the peer, including message transmission
 // and expiration.
 func (p *Peer) update() {
@@ -102,6 +154,11 @@ func (p *Peer) update() {
 	expire := time.NewTicker(expirationCycle)
 	transmit := time.NewTicker(transmissionCycle)
 
+	// Advertise the local bloom filter and mode before relaying anything
+	if err := p.sendStatusEx(); err != nil {
+		log.Trace("status extension failed", "reason", err, "peer", p.ID())
+		return
+	}
 	// Loop and transmit until termination is requested
 	for {
 		select {
@@ -150,9 +207,9 @@ func (peer *Peer) expire() {
 // ones over the network.
 func (p *Peer) broadcast() error {
 	var cnt int
-	envelopes := p.host.Envelopes()
+	envelopes := p.host.forwardableEnvelopes()
 	for _, envelope := range envelopes {
-		if !p.marked(envelope) {
+		if !p.marked(envelope) && p.bloomMatch(envelope) {
 			err := p2p.Send(p.ws, messagesCode, envelope)
 			if err != nil {
 				return err
@@ -304,3 +304,109 @@ func TestPeerBasic(t *testing.T) {
 		t.Fatalf("failed mark with seed %d.", seed)
 	}
 }
+
+func TestPeerStatus(t *testing.T) {
+	light := New(&Config{MaxMessageSize: DefaultMaxMessageSize, LightClient: true})
+	full := New(&DefaultConfig)
+
+	rw1, rw2 := p2p.MsgPipe()
+	defer rw1.Close()
+	defer rw2.Close()
+	p1 := newPeer(full, p2p.NewPeer(discover.NodeID{1}, "light", nil), rw1)
+	p2 := newPeer(light, p2p.NewPeer(discover.NodeID{2}, "full", nil), rw2)
+
+	errc := make(chan error, 1)
+	go func() { errc <- p2.handshake() }()
+	if err := p1.handshake(); err != nil {
+		t.Fatalf("full node handshake failed: %v", err)
+	}
+	if err := <-errc; err != nil {
+		t.Fatalf("light client handshake failed: %v", err)
+	}
+	// until the status extension arrives, peers are full nodes
+	if p1.bloomFilter != nil {
+		t.Fatalf("peer not treated as full node before status extension")
+	}
+	exchange := func(from *Peer, rw p2p.MsgReadWriter, to *Peer) {
+		go from.sendStatusEx()
+		msg, err := rw.ReadMsg()
+		if err != nil {
+			t.Fatalf("failed to read status extension: %v", err)
+		}
+		if msg.Code != statusExCode {
+			t.Fatalf("unexpected message code: have %d, want %d", msg.Code, statusExCode)
+		}
+		if err := to.handleStatusEx(msg); err != nil {
+			t.Fatalf("failed to handle status extension: %v", err)
+		}
+	}
+	exchange(p2, rw1, p1)
+	exchange(p1, rw2, p2)
+
+	if !bytes.Equal(p1.bloomFilter, light.BloomFilter()) {
+		t.Fatalf("light client status not received: bloom %x", p1.bloomFilter)
+	}
+	if !bytes.Equal(p2.bloomFilter, makeFullNodeBloom()) {
+		t.Fatalf("full node status not received: bloom %x", p2.bloomFilter)
+	}
+}
+
+// Tests that light clients reject each other, as neither relays the envelopes
+// of the other.
+func TestPeerStatusLightClients(t *testing.T) {
+	light1 := New(&Config{MaxMessageSize: DefaultMaxMessageSize, LightClient: true})
+	light2 := New(&Config{MaxMessageSize: DefaultMaxMessageSize, LightClient: true})
+
+	rw1, rw2 := p2p.MsgPipe()
+	defer rw1.Close()
+	defer rw2.Close()
+	p1 := newPeer(light1, p2p.NewPeer(discover.NodeID{2}, "light", nil), rw1)
+	p2 := newPeer(light2, p2p.NewPeer(discover.NodeID{1}, "light", nil), rw2)
+
+	go p2.sendStatusEx()
+	msg, err := rw1.ReadMsg()
+	if err != nil {
+		t.Fatalf("failed to read status extension: %v", err)
+	}
+	if err := p1.handleStatusEx(msg); err == nil {
+		t.Fatalf("light client status extension accepted by light client")
+	}
+	if p1.bloomFilter != nil {
+		t.Fatalf("bloom filter of rejected peer stored: %x", p1.bloomFilter)
+	}
+}
+
+// Tests that the handshake stays compatible with peers expecting the plain
+// version number as status.
+func TestPeerStatusCompatibility(t *testing.T) {
+	light := New(&Config{MaxMessageSize: DefaultMaxMessageSize, LightClient: true})
+
+	rw1, rw2 := p2p.MsgPipe()
+	defer rw1.Close()
+	defer rw2.Close()
+	p := newPeer(light, p2p.NewPeer(discover.NodeID{1}, "old", nil), rw1)
+
+	errc := make(chan error, 1)
+	go func() { errc <- p.handshake() }()
+
+	msg, err := rw2.ReadMsg()
+	if err != nil {
+		t.Fatalf("failed to read status: %v", err)
+	}
+	var version uint64
+	if err := msg.Decode(&version); err != nil {
+		t.Fatalf("status is not a plain version number: %v", err)
+	}
+	if version != ProtocolVersion {
+		t.Fatalf("version mismatch: have %d, want %d", version, ProtocolVersion)
+	}
+	if err := p2p.Send(rw2, statusCode, ProtocolVersion); err != nil {
+		t.Fatalf("failed to send status: %v", err)
+	}
+	if err := <-errc; err != nil {
+		t.Fatalf("handshake with version-only status failed: %v", err)
+	}
+	if p.bloomFilter != nil {
+		t.Fatalf("version-only peer not treated as full node")
+	}
+}
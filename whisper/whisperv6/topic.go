@@ -53,3 +53,48 @@ func (t TopicType) MarshalText() ([]byte, error) {
 func (t *TopicType) UnmarshalText(input []byte) error {
 	return hexutil.UnmarshalFixedText("Topic", input, t[:])
 }
+
+// TopicToBloom converts the topic (4 bytes) to a bloom filter (64 bytes). Three
+// bits are set, each indexed by one of the first three topic bytes extended by
+// one bit of the fourth.
+func TopicToBloom(topic TopicType) []byte {
+	b := make([]byte, BloomFilterSize)
+	for j := 0; j < 3; j++ {
+		index := int(topic[j])
+		if topic[3]&(1<<uint(j)) != 0 {
+			index += 256
+		}
+		b[index/8] |= 1 << uint(index%8)
+	}
+	return b
+}
+
+// makeFullNodeBloom returns a bloom filter matching all topics.
+func makeFullNodeBloom() []byte {
+	bloom := make([]byte, BloomFilterSize)
+	for i := range bloom {
+		bloom[i] = 0xFF
+	}
+	return bloom
+}
+
+// bloomFilterMatch checks whether all bits set in sample are also set in
+// filter. A nil filter matches everything.
+func bloomFilterMatch(filter, sample []byte) bool {
+	if filter == nil {
+		return true
+	}
+	for i := 0; i < BloomFilterSize; i++ {
+		if filter[i]&sample[i] != sample[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// addBloom merges the bits of b into a.
+func addBloom(a, b []byte) {
+	for i := 0; i < BloomFilterSize; i++ {
+		a[i] |= b[i]
+	}
+}
@@ -132,3 +132,36 @@ func TestUnmarshalTestsUgly(t *testing.T) {
 		}
 	}
 }
+
+func TestTopicToBloom(t *testing.T) {
+	a := TopicType{0x01, 0x02, 0x03, 0x00}
+	b := TopicType{0x01, 0x02, 0x03, 0x07}
+	ba, bb := TopicToBloom(a), TopicToBloom(b)
+
+	for i, bloom := range [][]byte{ba, bb} {
+		bits := 0
+		for _, x := range bloom {
+			for ; x != 0; x &= x - 1 {
+				bits++
+			}
+		}
+		if bits != 3 {
+			t.Fatalf("bloom %d: have %d bits set, want 3", i, bits)
+		}
+	}
+	if !bloomFilterMatch(ba, ba) {
+		t.Fatalf("bloom does not match itself")
+	}
+	if bloomFilterMatch(ba, bb) {
+		t.Fatalf("bloom of different topic matched")
+	}
+	if !bloomFilterMatch(nil, ba) || !bloomFilterMatch(makeFullNodeBloom(), ba) {
+		t.Fatalf("full node bloom did not match")
+	}
+	combined := make([]byte, BloomFilterSize)
+	addBloom(combined, ba)
+	addBloom(combined, bb)
+	if !bloomFilterMatch(combined, ba) || !bloomFilterMatch(combined, bb) {
+		t.Fatalf("combined bloom does not match its topics")
+	}
+}
@@ -49,6 +49,8 @@ const (
 	minPowIdx     = iota // Minimal PoW required by the whisper node
 	maxMsgSizeIdx = iota // Maximal message length allowed by the whisper node
 	overflowIdx   = iota // Indicator of message queue overflow
+	lightModeIdx  = iota // Light client mode, only own envelopes are relayed
+	bloomIdx      = iota // Bloom filter of the topics this node is interested in
 )
 
 // Whisper represents a dark communication interface through the Wiseplat
@@ -64,6 +66,7 @@ type Whisper struct {
 	poolMu      sync.RWMutex              // Mutex to sync the message and expiration pools
 	envelopes   map[common.Hash]*Envelope // Pool of envelopes currently tracked by this node
 	expirations map[uint32]*set.SetNonTS  // Message expiration pool
+	sent        map[common.Hash]struct{}  // Envelopes originating from this node
 
 	peerMu sync.RWMutex       // Mutex to sync the active peer set
 	peers  map[*Peer]struct{} // Set of currently active peers
@@ -91,6 +94,7 @@ func New(cfg *Config) *Whisper {
 		symKeys:      make(map[string][]byte),
 		envelopes:    make(map[common.Hash]*Envelope),
 		expirations:  make(map[uint32]*set.SetNonTS),
+		sent:         make(map[common.Hash]struct{}),
 		peers:        make(map[*Peer]struct{}),
 		messageQueue: make(chan *Envelope, messageQueueLimit),
 		p2pMsgQueue:  make(chan *Envelope, messageQueueLimit),
@@ -102,6 +106,12 @@ func New(cfg *Config) *Whisper {
 	whisper.settings.Store(minPowIdx, cfg.MinimumAcceptedPOW)
 	whisper.settings.Store(maxMsgSizeIdx, cfg.MaxMessageSize)
 	whisper.settings.Store(overflowIdx, false)
+	whisper.settings.Store(lightModeIdx, cfg.LightClient)
+	if cfg.LightClient {
+		whisper.settings.Store(bloomIdx, make([]byte, BloomFilterSize))
+	} else {
+		whisper.settings.Store(bloomIdx, makeFullNodeBloom())
+	}
 
 	// p2p whisper sub protocol handler
 	whisper.protocol = p2p.Protocol{
@@ -114,6 +124,7 @@ func New(cfg *Config) *Whisper {
 				"version":        ProtocolVersionStr,
 				"maxMessageSize": whisper.MaxMessageSize(),
 				"minimumPoW":     whisper.MinPow(),
+				"lightClient":    whisper.LightClientMode(),
 			}
 		},
 	}
@@ -126,6 +137,38 @@ func (w *Whisper) MinPow() float64 {
 	return val.(float64)
 }
 
+// LightClientMode indicates whether the node only relays its own envelopes
+// and receives only those matching its bloom filter.
+func (w *Whisper) LightClientMode() bool {
+	val, _ := w.settings.Load(lightModeIdx)
+	return val.(bool)
+}
+
+// BloomFilter returns the bloom filter advertised to the peers. Full nodes
+// advertise a filter matching all topics.
+func (w *Whisper) BloomFilter() []byte {
+	val, _ := w.settings.Load(bloomIdx)
+	return val.([]byte)
+}
+
+// updateBloomFilter recalculates the bloom filter of a light client from the
+// installed filters and sends it to all peers.
+func (w *Whisper) updateBloomFilter() {
+	if !w.LightClientMode() {
+		return
+	}
+	bloom := w.filters.bloom()
+	w.settings.Store(bloomIdx, bloom)
+
+	w.peerMu.RLock()
+	defer w.peerMu.RUnlock()
+	for p := range w.peers {
+		if err := p2p.Send(p.ws, bloomFilterExCode, bloom); err != nil {
+			log.Trace("failed to send bloom filter", "peer", p.ID(), "err", err)
+		}
+	}
+}
+
 // MaxMessageSize returns the maximum accepted message size.
 func (w *Whisper) MaxMessageSize() uint32 {
 	val, _ := w.settings.Load(maxMsgSizeIdx)
@@ -415,7 +458,12 @@ func (w *Whisper) GetSymKey(id string) ([]byte, error) {
 // Subscribe installs a new message handler used for filtering, decrypting
 // and subsequent storing of incoming messages.
 func (w *Whisper) Subscribe(f *Filter) (string, error) {
-	return w.filters.Install(f)
+	id, err := w.filters.Install(f)
+	if err != nil {
+		return id, err
+	}
+	w.updateBloomFilter()
+	return id, nil
 }
 
 // GetFilter returns the filter by id.
@@ -429,6 +477,7 @@ func (w *Whisper) Unsubscribe(id string) error {
 	if !ok {
 		return fmt.Errorf("Unsubscribe: Invalid ID")
 	}
+	w.updateBloomFilter()
 	return nil
 }
 
@@ -442,6 +491,9 @@ func (w *Whisper) Send(envelope *Envelope) error {
 	if !ok {
 		return fmt.Errorf("failed to add envelope")
 	}
+	w.poolMu.Lock()
+	w.sent[envelope.Hash()] = struct{}{}
+	w.poolMu.Unlock()
 	return err
 }
 
@@ -526,6 +578,18 @@ func (wh *Whisper) runMessageLoop(p *Peer, rw p2p.MsgReadWriter) error {
 			if cached {
 				p.mark(&envelope)
 			}
+		case bloomFilterExCode:
+			var bloom []byte
+			if err := packet.Decode(&bloom); err != nil || len(bloom) != BloomFilterSize {
+				log.Warn("invalid bloom filter received, peer will be disconnected", "peer", p.peer.ID(), "err", err)
+				return errors.New("invalid bloom filter")
+			}
+			p.setBloomFilter(bloom)
+		case statusExCode:
+			if err := p.handleStatusEx(packet); err != nil {
+				log.Warn("invalid status extension received, peer will be disconnected", "peer", p.peer.ID(), "err", err)
+				return errors.New("invalid status extension")
+			}
 		case p2pCode:
 			// peer-to-peer message, sent directly to peer bypassing PoW checks, etc.
 			// this message is not supposed to be forwarded to other peers, and
@@ -716,6 +780,7 @@ func (w *Whisper) expire() {
 			hashSet.Each(func(v interface{}) bool {
 				sz := w.envelopes[v.(common.Hash)].size()
 				delete(w.envelopes, v.(common.Hash))
+				delete(w.sent, v.(common.Hash))
 				w.stats.messagesCleared++
 				w.stats.memoryCleared += sz
 				w.stats.memoryUsed -= sz
@@ -747,6 +812,24 @@ func (w *Whisper) Envelopes() []*Envelope {
 	return all
 }
 
+// forwardableEnvelopes retrieves the pooled messages which may be relayed to
+// the peers. Light clients only relay their own envelopes.
+func (w *Whisper) forwardableEnvelopes() []*Envelope {
+	if !w.LightClientMode() {
+		return w.Envelopes()
+	}
+	w.poolMu.RLock()
+	defer w.poolMu.RUnlock()
+
+	own := make([]*Envelope, 0, len(w.sent))
+	for hash := range w.sent {
+		if envelope, ok := w.envelopes[hash]; ok {
+			own = append(own, envelope)
+		}
+	}
+	return own
+}
+
 // Messages iterates through all currently floating envelopes
 // and retrieves all the messages, that this filter could decrypt.
 func (w *Whisper) Messages(id string) []*ReceivedMessage {
@@ -849,3 +849,76 @@ func TestSymmetricSendKeyMismatch(t *testing.T) {
 		t.Fatalf("received a message when keys weren't matching")
 	}
 }
+
+func TestLightClient(t *testing.T) {
+	InitSingleTest()
+
+	w := New(&Config{
+		MaxMessageSize:     DefaultMaxMessageSize,
+		MinimumAcceptedPOW: 0.0000001,
+		LightClient:        true,
+	})
+	if !w.LightClientMode() {
+		t.Fatalf("light client mode not set")
+	}
+
+	params, err := generateMessageParams()
+	if err != nil {
+		t.Fatalf("failed generateMessageParams with seed %d: %s.", seed, err)
+	}
+	params.TTL = 50
+	wrap := func(topic TopicType) *Envelope {
+		params.Topic = topic
+		msg, err := NewSentMessage(params)
+		if err != nil {
+			t.Fatalf("failed to create new message with seed %d: %s.", seed, err)
+		}
+		env, err := msg.Wrap(params)
+		if err != nil {
+			t.Fatalf("failed Wrap with seed %d: %s.", seed, err)
+		}
+		return env
+	}
+	topic := params.Topic
+	other := TopicType{topic[0] ^ 0xff, topic[1] ^ 0xff, topic[2] ^ 0xff, topic[3]}
+	own, foreign := wrap(topic), wrap(other)
+
+	// the bloom filter follows the installed filters
+	if bloomFilterMatch(w.BloomFilter(), own.Bloom()) {
+		t.Fatalf("empty bloom filter matched envelope")
+	}
+	id, err := w.Subscribe(&Filter{KeySym: params.KeySym, Topics: [][]byte{topic[:]}})
+	if err != nil {
+		t.Fatalf("failed to subscribe with seed %d: %s.", seed, err)
+	}
+	if !bloomFilterMatch(w.BloomFilter(), own.Bloom()) {
+		t.Fatalf("bloom filter does not match subscribed topic")
+	}
+	if bloomFilterMatch(w.BloomFilter(), foreign.Bloom()) {
+		t.Fatalf("bloom filter matches topic not subscribed to")
+	}
+	w.Unsubscribe(id)
+	if bloomFilterMatch(w.BloomFilter(), own.Bloom()) {
+		t.Fatalf("bloom filter not cleared after unsubscribe")
+	}
+
+	// only own envelopes are relayed
+	if err := w.Send(own); err != nil {
+		t.Fatalf("failed to send envelope with seed %d: %s.", seed, err)
+	}
+	if _, err := w.add(foreign); err != nil {
+		t.Fatalf("failed to add envelope with seed %d: %s.", seed, err)
+	}
+	if len(w.Envelopes()) != 2 {
+		t.Fatalf("have %d pooled envelopes, want 2", len(w.Envelopes()))
+	}
+	forward := w.forwardableEnvelopes()
+	if len(forward) != 1 || forward[0].Hash() != own.Hash() {
+		t.Fatalf("light client relays foreign envelopes")
+	}
+
+	full := New(&DefaultConfig)
+	if full.LightClientMode() || !bloomFilterMatch(full.BloomFilter(), foreign.Bloom()) {
+		t.Fatalf("full node bloom filter does not match all topics")
+	}
+}
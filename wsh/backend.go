@@ -54,6 +54,7 @@ type LesServer interface {
 	Start(srvr *p2p.Server)
 	Stop()
 	Protocols() []p2p.Protocol
+	APIs() []rpc.API
 	SetBloomBitsIndexer(bbIndexer *core.ChainIndexer)
 }
 
@@ -105,6 +106,10 @@ func New(ctx *node.ServiceContext, config *Config) (*Wiseplat, error) {
 	if config.SyncMode == downloader.LightSync {
 		return nil, errors.New("can't run wsh.Wiseplat in light sync mode, use les.LightWiseplat")
 	}
+	if config.NoBackfill && config.SyncFrom != (common.Hash{}) && config.SyncFromTd == nil {
+		// Without backfilling, the total difficulty announced by the peers is never checked
+		return nil, errors.New("checkpoint sync without backfilling needs the checkpoint's total difficulty")
+	}
 	if !config.SyncMode.IsValid() {
 		return nil, fmt.Errorf("invalid sync mode %d", config.SyncMode)
 	}
@@ -166,6 +171,7 @@ func New(ctx *node.ServiceContext, config *Config) (*Wiseplat, error) {
 	if wsh.protocolManager, err = NewProtocolManager(wsh.chainConfig, config.SyncMode, config.NetworkId, wsh.eventMux, wsh.txPool, wsh.engine, wsh.blockchain, chainDb); err != nil {
 		return nil, err
 	}
+	wsh.protocolManager.setCheckpoint(config.SyncFrom, config.SyncFromTd, !config.NoBackfill)
 	wsh.miner = miner.New(wsh, wsh.chainConfig, wsh.EventMux(), wsh.engine)
 	wsh.miner.SetExtra(makeExtraData(config.ExtraData))
 
@@ -241,6 +247,11 @@ func (s *Wiseplat) APIs() []rpc.API {
 	// Append any APIs exposed explicitly by the consensus engine
 	apis = append(apis, s.engine.APIs(s.BlockChain())...)
 
+	// Append any APIs exposed by the light server
+	if s.lesServer != nil {
+		apis = append(apis, s.lesServer.APIs()...)
+	}
+
 	// Append all the local APIs and return
 	return append(apis, []rpc.API{
 		{
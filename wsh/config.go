@@ -76,10 +76,23 @@ type Config struct {
 	NetworkId uint64 // Network ID to use for selecting peers to connect to
 	SyncMode  downloader.SyncMode
 
+	// Trusted block to start an empty chain from when fast syncing, its total
+	// difficulty if known, and whether to skip backfilling the blocks before it.
+	SyncFrom   common.Hash `toml:",omitempty"`
+	SyncFromTd *big.Int    `toml:",omitempty"`
+	NoBackfill bool        `toml:",omitempty"`
+
 	// Light client options
 	LightServ  int `toml:",omitempty"` // Maximum percentage of time allowed for serving LES requests
 	LightPeers int `toml:",omitempty"` // Maximum number of LES client peers
 
+	// Checkpoint oracle used by light clients to start syncing from a
+	// checkpoint approved by the oracle admins and by servers to offer it.
+	CheckpointOracle *params.CheckpointOracleConfig `toml:",omitempty"`
+
+	// Ultra light client options
+	ULC *ULCConfig `toml:",omitempty"`
+
 	// Database options
 	SkipBcVersionCheck bool `toml:"-"`
 	DatabaseHandles    int  `toml:"-"`
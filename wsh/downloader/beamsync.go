@@ -0,0 +1,134 @@
+// Copyright 2018 The go-wiseplat Authors
+// This file is part of the go-wiseplat library.
+//
+// The go-wiseplat library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-wiseplat library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-wiseplat library. If not, see <http://www.gnu.org/licenses/>.
+
+package downloader
+
+import (
+	"errors"
+
+	"github.com/wiseplat/go-wiseplat/common"
+	"github.com/wiseplat/go-wiseplat/core"
+	"github.com/wiseplat/go-wiseplat/log"
+)
+
+var errNoBeamSync = errors.New("no beam sync state download running")
+
+// beamReq is an on demand request for a single state trie node or contract code
+// blob, issued by block processing while beam syncing.
+type beamReq struct {
+	hash common.Hash   // Hash of the state item to retrieve
+	blob []byte        // Retrieved data, set before done is closed
+	err  error         // Retrieval failure, set before done is closed
+	done chan struct{} // Channel to signal the completion of the request
+}
+
+// beamTask tracks an on demand state retrieval inside a running state sync.
+type beamTask struct {
+	reqs     []*beamReq          // Requests waiting for the state item
+	attempts map[string]struct{} // Peers already attempted retrieval from
+}
+
+// FetchState retrieves a single state trie node or contract code blob from the
+// network, blocking until it is delivered. It is meant to be used as the missing
+// node hook of the chain's state database while beam syncing: the requests are
+// served ahead of everything else by the background state download.
+func (d *Downloader) FetchState(hash common.Hash) ([]byte, error) {
+	s := d.runningBeamState()
+	if s == nil {
+		return nil, errNoBeamSync
+	}
+	req := &beamReq{hash: hash, done: make(chan struct{})}
+	select {
+	case s.beam <- req:
+	case <-s.done:
+		return nil, errNoBeamSync
+	case <-d.quitCh:
+		return nil, errCancelStateFetch
+	}
+	select {
+	case <-req.done:
+		return req.blob, req.err
+	case <-d.quitCh:
+		return nil, errCancelStateFetch
+	}
+}
+
+// ResumeBeamSync restarts the background state download of a beam sync pivot if
+// it was interrupted, e.g. by a restart or a download failure, returning whether
+// there was one. Until the download completes, block processing must retrieve
+// any missing state on demand via FetchState.
+func (d *Downloader) ResumeBeamSync() bool {
+	root := core.GetBeamPivotRoot(d.stateDB)
+	if root == (common.Hash{}) {
+		return false
+	}
+	if d.startBeamState(root) {
+		log.Info("Resuming beam sync state download", "root", root)
+	}
+	return true
+}
+
+// startBeamState starts downloading the state of the beam sync pivot block in
+// the background, unless it is already being downloaded, returning whether a new
+// download was started. Contrary to fast sync, the download is not tied to a
+// sync cycle and keeps running until done. The pivot's state root is persisted
+// until then, so the download can be resumed after a restart.
+func (d *Downloader) startBeamState(root common.Hash) bool {
+	d.beamLock.Lock()
+	defer d.beamLock.Unlock()
+
+	if s := d.beamState; s != nil && s.root == root {
+		select {
+		case <-s.done:
+		default:
+			return false
+		}
+	}
+	core.WriteBeamPivotRoot(d.stateDB, root)
+
+	s := d.syncState(root)
+	d.beamState = s
+
+	go func() {
+		if err := s.Wait(); err != nil {
+			log.Warn("Beam sync state download failed", "root", root, "err", err)
+			return
+		}
+		d.beamLock.Lock()
+		if core.GetBeamPivotRoot(d.stateDB) == root {
+			core.DeleteBeamPivotRoot(d.stateDB)
+		}
+		d.beamLock.Unlock()
+
+		log.Info("Beam sync state download completed", "root", root)
+	}()
+	return true
+}
+
+// runningBeamState returns the beam sync state download if one is in progress.
+func (d *Downloader) runningBeamState() *stateSync {
+	d.beamLock.Lock()
+	defer d.beamLock.Unlock()
+
+	if s := d.beamState; s != nil {
+		select {
+		case <-s.done:
+		default:
+			return s
+		}
+	}
+	return nil
+}
@@ -0,0 +1,386 @@
+// Copyright 2018 The go-wiseplat Authors
+// This file is part of the go-wiseplat library.
+//
+// The go-wiseplat library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-wiseplat library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-wiseplat library. If not, see <http://www.gnu.org/licenses/>.
+
+package downloader
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"sync/atomic"
+	"time"
+
+	"github.com/wiseplat/go-wiseplat/common"
+	"github.com/wiseplat/go-wiseplat/core/types"
+	"github.com/wiseplat/go-wiseplat/log"
+)
+
+const (
+	checkpointAncestors = 256  // Number of blocks preceding a checkpoint needed to import the blocks after it
+	checkpointMaxDepth  = 4096 // Maximum number of headers after a checkpoint to derive its total difficulty from
+	backfillBatch       = 2048 // Number of checkpoint ancestors to backfill at once in the background
+)
+
+var (
+	errCheckpointUnavailable = errors.New("sync checkpoint not available from peer")
+	errCheckpointTooDeep     = errors.New("sync checkpoint too far below peer head, configure its total difficulty")
+)
+
+// SetCheckpoint sets a trusted block hash to start an empty chain from when fast
+// (or beam) syncing, instead of downloading all headers since the genesis block.
+// Its ancestors are left to be retrieved via Backfill once the chain is in sync.
+//
+// If the total difficulty of the checkpoint is not given, it is derived from the
+// one announced by the peer synced with, which is only confirmed once the chain
+// is backfilled down to the genesis block.
+func (d *Downloader) SetCheckpoint(hash common.Hash, td *big.Int) {
+	d.checkpoint = hash
+	d.checkpointTd = td
+}
+
+// checkpointHeader retrieves the header of the sync checkpoint, if one is set
+// and present in the local chain.
+func (d *Downloader) checkpointHeader() *types.Header {
+	if d.checkpoint == (common.Hash{}) {
+		return nil
+	}
+	return d.lightchain.GetHeaderByHash(d.checkpoint)
+}
+
+// syncCheckpoint starts an empty local chain from the sync checkpoint, if one is
+// set: the checkpoint block is retrieved along with its total difficulty and
+// inserted as the root of the chain. Afterwards enough of its ancestors are
+// backfilled to import blocks on top of it, as uncle verification and the
+// BLOCKHASH opcode both reach into the recent ancestors of a block.
+func (d *Downloader) syncCheckpoint(p *peerConnection) error {
+	if d.checkpoint == (common.Hash{}) {
+		return nil
+	}
+	header := d.checkpointHeader()
+	if header == nil {
+		// Only empty chains can be started from a checkpoint
+		if number := d.blockchain.CurrentFastBlock().NumberU64(); number > 0 {
+			log.Debug("Ignoring sync checkpoint on non-empty chain", "checkpoint", d.checkpoint, "head", number)
+			return nil
+		}
+		var err error
+		if header, err = d.insertCheckpoint(p); err != nil {
+			return err
+		}
+	}
+	if tail := d.blockchain.ChainTail(); tail != nil {
+		if have := header.Number.Uint64() - tail.Number.Uint64(); have < checkpointAncestors {
+			return d.backfill(p, checkpointAncestors-int(have))
+		}
+	}
+	return nil
+}
+
+// insertCheckpoint retrieves the checkpoint block and its receipts from the peer
+// and starts the local chain from it.
+func (d *Downloader) insertCheckpoint(p *peerConnection) (*types.Header, error) {
+	p.log.Debug("Retrieving sync checkpoint", "hash", d.checkpoint)
+
+	packet, err := d.fetchPacket(p, d.headerCh, func() error { return p.peer.RequestHeadersByHash(d.checkpoint, 1, 0, false) })
+	if err != nil {
+		return nil, err
+	}
+	headers := packet.(*headerPack).headers
+	if len(headers) == 0 {
+		return nil, errCheckpointUnavailable
+	}
+	if len(headers) != 1 || headers[0].Hash() != d.checkpoint {
+		p.log.Debug("Invalid sync checkpoint response", "headers", len(headers))
+		return nil, errBadPeer
+	}
+	header := headers[0]
+
+	td, err := d.deriveCheckpointTd(p, header)
+	if err != nil {
+		return nil, err
+	}
+	blocks, receipts, err := d.fetchBlockContents(p, headers)
+	if err != nil {
+		return nil, err
+	}
+	if err := d.blockchain.InsertCheckpoint(blocks[0], receipts[0], td); err != nil {
+		return nil, err
+	}
+	return header, nil
+}
+
+// deriveCheckpointTd returns the total difficulty of the checkpoint. Unless one
+// was configured, it is derived from the one the peer announced for its head, by
+// subtracting the difficulties of all headers in between. These are verified by
+// the consensus engine, so the peer can't inflate the difficulties without doing
+// the corresponding work, and the checkpoint must be part of the peer's chain.
+func (d *Downloader) deriveCheckpointTd(p *peerConnection, checkpoint *types.Header) (*big.Int, error) {
+	if d.checkpointTd != nil {
+		if d.checkpointTd.Cmp(checkpoint.Difficulty) < 0 {
+			return nil, fmt.Errorf("configured checkpoint total difficulty %v below its difficulty %v", d.checkpointTd, checkpoint.Difficulty)
+		}
+		return new(big.Int).Set(d.checkpointTd), nil
+	}
+	head, headTd := p.peer.Head()
+
+	// Verify the headers after the checkpoint on top of it, as it's not yet local
+	verifier := newHeaderVerifier(d.lightchain)
+	verifier.trust(checkpoint)
+
+	var (
+		td     = new(big.Int).Set(headTd)
+		parent = checkpoint.Hash()
+		number = checkpoint.Number.Uint64()
+	)
+	for parent != head {
+		if number-checkpoint.Number.Uint64() >= checkpointMaxDepth {
+			p.log.Debug("Peer head too far above checkpoint", "checkpoint", checkpoint.Number, "limit", checkpointMaxDepth)
+			return nil, errCheckpointTooDeep
+		}
+		p.log.Trace("Summing up difficulties after checkpoint", "from", number+1)
+		packet, err := d.fetchPacket(p, d.headerCh, func() error { return p.peer.RequestHeadersByNumber(number+1, MaxHeaderFetch, 0, false) })
+		if err != nil {
+			return nil, err
+		}
+		headers := packet.(*headerPack).headers
+		if len(headers) == 0 {
+			return nil, errCheckpointUnavailable
+		}
+		link := parent
+		for i, header := range headers {
+			if header.Number.Uint64() != number+1+uint64(i) || header.ParentHash != link {
+				p.log.Debug("Headers after checkpoint broke chain ordering", "number", header.Number, "expected", number+1+uint64(i))
+				return nil, errInvalidChain
+			}
+			link = header.Hash()
+			if link == head {
+				headers = headers[:i+1]
+				break
+			}
+		}
+		// Keep the batch in the verifier's overlay, it's the parent of the next one
+		task := verifier.verify(headers, headerSeals(len(headers), 1))
+		<-task.done
+		if task.err != nil {
+			p.log.Debug("Invalid header after checkpoint", "number", headers[task.failed].Number, "hash", headers[task.failed].Hash(), "err", task.err)
+			return nil, errInvalidChain
+		}
+		for _, header := range headers {
+			td.Sub(td, header.Difficulty)
+		}
+		parent, number = link, number+uint64(len(headers))
+	}
+	if td.Cmp(checkpoint.Difficulty) < 0 {
+		p.log.Debug("Announced total difficulty below checkpoint's", "td", headTd)
+		return nil, errInvalidChain
+	}
+	return td, nil
+}
+
+// Backfill retrieves a batch of blocks preceding the tail of a chain started from
+// a sync checkpoint from the given peer. It is meant to be called repeatedly once
+// the chain is in sync, until the gap to the genesis block is closed. Backfills
+// and sync cycles exclude each other, errBusy is returned if either is running.
+func (d *Downloader) Backfill(id string) error {
+	if !atomic.CompareAndSwapInt32(&d.synchronising, 0, 1) {
+		return errBusy
+	}
+	defer atomic.StoreInt32(&d.synchronising, 0)
+
+	p := d.peers.Peer(id)
+	if p == nil {
+		return errUnknownPeer
+	}
+	d.cancelLock.Lock()
+	d.cancelCh = make(chan struct{})
+	d.cancelPeer = id
+	d.cancelLock.Unlock()
+
+	defer d.Cancel() // No matter what, we can't leave the cancel channel open
+
+	return d.backfill(p, backfillBatch)
+}
+
+// backfill retrieves up to count blocks preceding the tail of a chain started
+// from a sync checkpoint, inserting them batch by batch.
+func (d *Downloader) backfill(p *peerConnection, count int) error {
+	for count > 0 {
+		tail := d.blockchain.ChainTail()
+		if tail == nil || tail.Number.Uint64() < 2 {
+			return nil
+		}
+		amount := MaxHeaderFetch
+		if count < amount {
+			amount = count
+		}
+		if missing := tail.Number.Uint64() - 1; missing < uint64(amount) {
+			amount = int(missing)
+		}
+		p.log.Debug("Backfilling checkpoint ancestors", "tail", tail.Number, "count", amount)
+
+		packet, err := d.fetchPacket(p, d.headerCh, func() error { return p.peer.RequestHeadersByHash(tail.ParentHash, amount, 0, true) })
+		if err != nil {
+			return err
+		}
+		headers := packet.(*headerPack).headers
+		if len(headers) == 0 {
+			return errCheckpointUnavailable
+		}
+		if len(headers) > amount {
+			p.log.Debug("Too many ancestor headers", "requested", amount, "received", len(headers))
+			return errBadPeer
+		}
+		// Ancestors are authenticated by linking up with the tail
+		child := tail
+		for _, header := range headers {
+			if header.Hash() != child.ParentHash {
+				p.log.Debug("Ancestor headers broke chain ancestry", "number", header.Number, "hash", header.Hash())
+				return errInvalidChain
+			}
+			child = header
+		}
+		blocks, receipts, err := d.fetchBlockContents(p, headers)
+		if err != nil {
+			return err
+		}
+		if _, err := d.blockchain.InsertAncestors(blocks, receipts); err != nil {
+			return err
+		}
+		count -= len(headers)
+	}
+	return nil
+}
+
+// fetchBlockContents retrieves the bodies and receipts of the given headers from
+// the peer, verifying them against the headers and assembling the blocks.
+func (d *Downloader) fetchBlockContents(p *peerConnection, headers []*types.Header) (types.Blocks, []types.Receipts, error) {
+	var (
+		txs      = make([][]*types.Transaction, len(headers))
+		uncles   = make([][]*types.Header, len(headers))
+		receipts = make([]types.Receipts, len(headers))
+	)
+	// Retrieve the non-empty block bodies
+	var pending []int
+	for i, header := range headers {
+		if header.TxHash != types.EmptyRootHash || header.UncleHash != types.EmptyUncleHash {
+			pending = append(pending, i)
+		}
+	}
+	for len(pending) > 0 {
+		batch := pending
+		if len(batch) > MaxBlockFetch {
+			batch = batch[:MaxBlockFetch]
+		}
+		hashes := make([]common.Hash, len(batch))
+		for i, idx := range batch {
+			hashes[i] = headers[idx].Hash()
+		}
+		packet, err := d.fetchPacket(p, d.bodyCh, func() error { return p.peer.RequestBodies(hashes) })
+		if err != nil {
+			return nil, nil, err
+		}
+		bodies := packet.(*bodyPack)
+		if len(bodies.transactions) == 0 {
+			return nil, nil, errCheckpointUnavailable
+		}
+		if len(bodies.transactions) > len(batch) || len(bodies.uncles) != len(bodies.transactions) {
+			return nil, nil, errBadPeer
+		}
+		for i := range bodies.transactions {
+			header := headers[batch[i]]
+			if types.DeriveSha(types.Transactions(bodies.transactions[i])) != header.TxHash || types.CalcUncleHash(bodies.uncles[i]) != header.UncleHash {
+				return nil, nil, errInvalidBody
+			}
+			txs[batch[i]], uncles[batch[i]] = bodies.transactions[i], bodies.uncles[i]
+		}
+		pending = pending[len(bodies.transactions):]
+	}
+	// Retrieve the non-empty receipts
+	for i, header := range headers {
+		if header.ReceiptHash != types.EmptyRootHash {
+			pending = append(pending, i)
+		}
+	}
+	for len(pending) > 0 {
+		batch := pending
+		if len(batch) > MaxReceiptFetch {
+			batch = batch[:MaxReceiptFetch]
+		}
+		hashes := make([]common.Hash, len(batch))
+		for i, idx := range batch {
+			hashes[i] = headers[idx].Hash()
+		}
+		packet, err := d.fetchPacket(p, d.receiptCh, func() error { return p.peer.RequestReceipts(hashes) })
+		if err != nil {
+			return nil, nil, err
+		}
+		delivered := packet.(*receiptPack).receipts
+		if len(delivered) == 0 {
+			return nil, nil, errCheckpointUnavailable
+		}
+		if len(delivered) > len(batch) {
+			return nil, nil, errBadPeer
+		}
+		for i := range delivered {
+			if types.DeriveSha(types.Receipts(delivered[i])) != headers[batch[i]].ReceiptHash {
+				return nil, nil, errInvalidReceipt
+			}
+			receipts[batch[i]] = delivered[i]
+		}
+		pending = pending[len(delivered):]
+	}
+	// Assemble the blocks from the retrieved parts
+	blocks := make(types.Blocks, len(headers))
+	for i, header := range headers {
+		blocks[i] = types.NewBlockWithHeader(header).WithBody(txs[i], uncles[i])
+	}
+	return blocks, receipts, nil
+}
+
+// fetchPacket sends a single request to the peer and waits for its response on
+// the given delivery channel, discarding any other deliveries meanwhile.
+func (d *Downloader) fetchPacket(p *peerConnection, deliveries chan dataPack, request func() error) (dataPack, error) {
+	go request()
+
+	ttl := d.requestTTL()
+	timeout := time.After(ttl)
+	for {
+		var (
+			packet dataPack
+			source chan dataPack
+		)
+		select {
+		case <-d.cancelCh:
+			return nil, errCancelBlockFetch
+
+		case packet = <-d.headerCh:
+			source = d.headerCh
+		case packet = <-d.bodyCh:
+			source = d.bodyCh
+		case packet = <-d.receiptCh:
+			source = d.receiptCh
+
+		case <-timeout:
+			p.log.Debug("Waiting for checkpoint chain data timed out", "elapsed", ttl)
+			return nil, errTimeout
+		}
+		if source != deliveries || packet.PeerId() != p.id {
+			log.Debug("Discarded out of bounds delivery", "peer", packet.PeerId())
+			continue
+		}
+		return packet, nil
+	}
+}
@@ -29,7 +29,9 @@ import (
 
 	wiseplat "github.com/wiseplat/go-wiseplat"
 	"github.com/wiseplat/go-wiseplat/common"
+	"github.com/wiseplat/go-wiseplat/consensus"
 	"github.com/wiseplat/go-wiseplat/core/types"
+	"github.com/wiseplat/go-wiseplat/wsh/snap"
 	"github.com/wiseplat/go-wiseplat/wshdb"
 	"github.com/wiseplat/go-wiseplat/event"
 	"github.com/wiseplat/go-wiseplat/log"
@@ -59,6 +61,7 @@ var (
 
 	maxQueuedHeaders  = 32 * 1024 // [wsh/62] Maximum number of headers to queue for import (DOS protection)
 	maxHeadersProcess = 2048      // Number of header download results to import at once into the chain
+	maxHeadersVerify  = 8         // Number of header batches to verify ahead of their import into the chain
 	maxResultsProcess = 2048      // Number of content download results to import at once into the chain
 
 	fsHeaderCheckFrequency = 100        // Verification frequency of the downloaded headers during fast sync
@@ -102,9 +105,17 @@ type Downloader struct {
 	peers   *peerSet // Set of active peers from which download can proceed
 	stateDB wshdb.Database
 
+	SnapSyncer *snap.Syncer // Range based state syncer to retrieve the bulk of the state
+
 	fsPivotLock  *types.Header // Pivot header on critical section entry (cannot change between retries)
 	fsPivotFails uint32        // Number of subsequent fast sync failures in the critical section
 
+	checkpoint   common.Hash // Trusted block hash to start an empty chain from instead of the genesis
+	checkpointTd *big.Int    // Trusted total difficulty of the checkpoint, derived from the peer's if nil
+
+	beamState *stateSync // Background pivot state sync serving on demand requests while beam syncing
+	beamLock  sync.Mutex // Lock protecting the beam state sync
+
 	rttEstimate   uint64 // Round trip time to target for download requests
 	rttConfidence uint64 // Confidence in the estimated RTT (unit: millionths to allow atomic ops)
 
@@ -167,8 +178,21 @@ type LightChain interface {
 	// GetTdByHash returns the total difficulty of a local block.
 	GetTdByHash(common.Hash) *big.Int
 
-	// InsertHeaderChain inserts a batch of headers into the local chain.
-	InsertHeaderChain([]*types.Header, int) (int, error)
+	// GetHeader retrieves a header by hash and number from the local chain.
+	GetHeader(common.Hash, uint64) *types.Header
+
+	// GetHeaderByNumber retrieves a canonical header by number from the local chain.
+	GetHeaderByNumber(uint64) *types.Header
+
+	// Config retrieves the chain configuration headers are verified against.
+	Config() *params.ChainConfig
+
+	// Engine retrieves the consensus engine verifying the headers of the chain.
+	Engine() consensus.Engine
+
+	// InsertVerifiedHeaderChain inserts a batch of already verified headers into
+	// the local chain.
+	InsertVerifiedHeaderChain([]*types.Header) (int, error)
 
 	// Rollback removes a few recently added elements from the local chain.
 	Rollback([]common.Hash)
@@ -198,6 +222,15 @@ type BlockChain interface {
 
 	// InsertReceiptChain inserts a batch of receipts into the local chain.
 	InsertReceiptChain(types.Blocks, []types.Receipts) (int, error)
+
+	// InsertCheckpoint starts an empty local chain from a trusted block.
+	InsertCheckpoint(*types.Block, types.Receipts, *big.Int) error
+
+	// InsertAncestors backfills a batch of blocks preceding the local chain's tail.
+	InsertAncestors(types.Blocks, []types.Receipts) (int, error)
+
+	// ChainTail retrieves the oldest header of a chain started from a checkpoint.
+	ChainTail() *types.Header
 }
 
 // New creates a new downloader to fetch hashes and blocks from remote peers.
@@ -209,6 +242,7 @@ func New(mode SyncMode, stateDb wshdb.Database, mux *event.TypeMux, chain BlockC
 	dl := &Downloader{
 		mode:           mode,
 		stateDB:        stateDb,
+		SnapSyncer:     snap.NewSyncer(stateDb),
 		mux:            mux,
 		queue:          newQueue(),
 		peers:          newPeerSet(),
@@ -249,7 +283,7 @@ func (d *Downloader) Progress() wiseplat.SyncProgress {
 	switch d.mode {
 	case FullSync:
 		current = d.blockchain.CurrentBlock().NumberU64()
-	case FastSync:
+	case FastSync, BeamSync:
 		current = d.blockchain.CurrentFastBlock().NumberU64()
 	case LightSync:
 		current = d.lightchain.CurrentHeader().Number.Uint64()
@@ -389,6 +423,9 @@ func (d *Downloader) synchronise(id string, hash common.Hash, td *big.Int, mode
 	if d.mode == FastSync && atomic.LoadUint32(&d.fsPivotFails) >= fsCriticalTrials {
 		d.mode = FullSync
 	}
+	// Restart the state download of an earlier beam sync if it failed meanwhile
+	d.ResumeBeamSync()
+
 	// Retrieve the origin peer and initiate the downloading process
 	p := d.peers.Peer(id)
 	if p == nil {
@@ -418,6 +455,13 @@ func (d *Downloader) syncWithPeer(p *peerConnection, hash common.Hash, td *big.I
 		log.Debug("Synchronisation terminated", "elapsed", time.Since(start))
 	}(time.Now())
 
+	// Start an empty chain from the sync checkpoint instead of the genesis
+	if d.mode == FastSync || d.mode == BeamSync {
+		if err := d.syncCheckpoint(p); err != nil {
+			return err
+		}
+	}
+
 	// Look up the sync boundaries: the common ancestor and the target block
 	latest, err := d.fetchHeight(p)
 	if err != nil {
@@ -441,7 +485,7 @@ func (d *Downloader) syncWithPeer(p *peerConnection, hash common.Hash, td *big.I
 	switch d.mode {
 	case LightSync:
 		pivot = height
-	case FastSync:
+	case FastSync, BeamSync:
 		// Calculate the new fast/slow sync pivot point
 		if d.fsPivotLock == nil {
 			pivotOffset, err := rand.Int(rand.Reader, big.NewInt(int64(fsPivotInterval)))
@@ -455,8 +499,12 @@ func (d *Downloader) syncWithPeer(p *peerConnection, hash common.Hash, td *big.I
 			// Pivot point locked in, use this and do not pick a new one!
 			pivot = d.fsPivotLock.Number.Uint64()
 		}
-		// If the point is below the origin, move origin back to ensure state download
-		if pivot < origin {
+		// Never pivot below the sync checkpoint, the blocks before it aren't synced
+		if checkpoint := d.checkpointHeader(); checkpoint != nil && pivot < checkpoint.Number.Uint64() {
+			pivot = checkpoint.Number.Uint64()
+		}
+		// If the point is not above the origin, move origin back to ensure state download
+		if pivot <= origin {
 			if pivot > 0 {
 				origin = pivot - 1
 			} else {
@@ -465,7 +513,12 @@ func (d *Downloader) syncWithPeer(p *peerConnection, hash common.Hash, td *big.I
 		}
 		log.Debug("Fast syncing until pivot block", "pivot", pivot)
 	}
-	d.queue.Prepare(origin+1, d.mode, pivot, latest)
+	// Beam sync schedules the block parts to retrieve the same way as fast sync
+	queueMode := d.mode
+	if queueMode == BeamSync {
+		queueMode = FastSync
+	}
+	d.queue.Prepare(origin+1, queueMode, pivot, latest)
 	if d.syncInitHook != nil {
 		d.syncInitHook(origin, height)
 	}
@@ -476,9 +529,12 @@ func (d *Downloader) syncWithPeer(p *peerConnection, hash common.Hash, td *big.I
 		func() error { return d.fetchReceipts(origin + 1) }, // Receipts are retrieved during fast sync
 		func() error { return d.processHeaders(origin+1, td) },
 	}
-	if d.mode == FastSync {
+	switch d.mode {
+	case FastSync:
 		fetchers = append(fetchers, func() error { return d.processFastSyncContent(latest) })
-	} else if d.mode == FullSync {
+	case BeamSync:
+		fetchers = append(fetchers, d.processBeamSyncContent)
+	case FullSync:
 		fetchers = append(fetchers, d.processFullSyncContent)
 	}
 	err = d.spawnSync(fetchers)
@@ -548,6 +604,13 @@ func (d *Downloader) Terminate() {
 
 	// Cancel any pending download requests
 	d.Cancel()
+
+	// Stop any background beam sync state download
+	d.beamLock.Lock()
+	if d.beamState != nil {
+		d.beamState.Cancel()
+	}
+	d.beamLock.Unlock()
 }
 
 // fetchHeight retrieves the head header of the remote peer to aid in estimating
@@ -605,7 +668,7 @@ func (d *Downloader) findAncestor(p *peerConnection, height uint64) (uint64, err
 	p.log.Debug("Looking for common ancestor", "local", ceil, "remote", height)
 	if d.mode == FullSync {
 		ceil = d.blockchain.CurrentBlock().NumberU64()
-	} else if d.mode == FastSync {
+	} else if d.mode == FastSync || d.mode == BeamSync {
 		ceil = d.blockchain.CurrentFastBlock().NumberU64()
 	}
 	if ceil >= MaxForkAncestry {
@@ -769,6 +832,10 @@ func (d *Downloader) findAncestor(p *peerConnection, height uint64) (uint64, err
 // other peers are only accepted if they map cleanly to the skeleton. If no one
 // can fill in the skeleton - not even the origin peer - it's assumed invalid and
 // the origin is dropped.
+//
+// If the origin is slow to deliver a skeleton, other peers on the same head are
+// asked for it too. A skeleton from such a helper which cannot be filled gets it
+// dropped, the origin being asked for it instead.
 func (d *Downloader) fetchHeaders(p *peerConnection, from uint64) error {
 	p.log.Debug("Directing header downloads", "origin", from)
 	defer p.log.Debug("Header download terminated")
@@ -780,7 +847,20 @@ func (d *Downloader) fetchHeaders(p *peerConnection, from uint64) error {
 	<-timeout.C                 // timeout channel should be initially empty
 	defer timeout.Stop()
 
-	var ttl time.Duration
+	var (
+		ttl    time.Duration
+		hedge  <-chan time.Time            // timer to ask helpers for a stalling skeleton
+		want   uint64                      // number of the first header expected in the reply
+		asked  = make(map[string][]uint64) // first headers expected in the unanswered replies per peer
+		failed = make(map[string]struct{}) // peers not asked for skeletons any more
+	)
+	hedgeDelay := func() time.Duration {
+		rtt := d.requestRTT()
+		if delay := 2 * p.HeaderDelay(rtt); delay > rtt {
+			return delay
+		}
+		return rtt
+	}
 	getHeaders := func(from uint64) {
 		request = time.Now()
 
@@ -789,11 +869,14 @@ func (d *Downloader) fetchHeaders(p *peerConnection, from uint64) error {
 
 		if skeleton {
 			p.log.Trace("Fetching skeleton headers", "count", MaxHeaderFetch, "from", from)
-			go p.peer.RequestHeadersByNumber(from+uint64(MaxHeaderFetch)-1, MaxSkeletonSize, MaxHeaderFetch-1, false)
+			want, hedge = from+uint64(MaxHeaderFetch)-1, time.After(hedgeDelay())
+			go p.peer.RequestHeadersByNumber(want, MaxSkeletonSize, MaxHeaderFetch-1, false)
 		} else {
 			p.log.Trace("Fetching full headers", "count", MaxHeaderFetch, "from", from)
+			want, hedge = from, nil
 			go p.peer.RequestHeadersByNumber(from, MaxHeaderFetch, 0, false)
 		}
+		asked[p.id] = append(asked[p.id], want)
 	}
 	// Start pulling the header chain skeleton until all is done
 	getHeaders(from)
@@ -803,14 +886,65 @@ func (d *Downloader) fetchHeaders(p *peerConnection, from uint64) error {
 		case <-d.cancelCh:
 			return errCancelHeaderFetch
 
+		case <-hedge:
+			// The skeleton is stalling, ask an idle peer on the same chain too
+			if helper := d.skeletonHelper(p, asked, failed); helper != nil {
+				helper.log.Trace("Fetching stalling skeleton headers", "count", MaxHeaderFetch, "from", from)
+				asked[helper.id] = append(asked[helper.id], want)
+				go helper.peer.RequestHeadersByNumber(want, MaxSkeletonSize, MaxHeaderFetch-1, false)
+			}
+			hedge = time.After(hedgeDelay())
+
 		case packet := <-d.headerCh:
-			// Make sure the active peer is giving us the skeleton headers
-			if packet.PeerId() != p.id {
-				log.Debug("Received skeleton from incorrect peer", "peer", packet.PeerId())
+			// Make sure an asked peer is giving us the skeleton headers
+			id := packet.PeerId()
+			if len(asked[id]) == 0 {
+				log.Debug("Received skeleton from incorrect peer", "peer", id)
+				break
+			}
+			headers := packet.(*headerPack).headers
+
+			// Match the reply to its request, discarding any answering a previous one
+			index := len(asked[id]) - 1
+			if len(headers) > 0 {
+				for i, number := range asked[id] {
+					if headers[0].Number.Uint64() == number {
+						index = i
+						break
+					}
+				}
+			}
+			number := asked[id][index]
+			asked[id] = append(asked[id][:index], asked[id][index+1:]...)
+			if number != want {
+				log.Debug("Discarded stale header reply", "peer", id, "count", len(headers))
+				break
+			}
+			server := p
+			if id != p.id {
+				if server = d.peers.Peer(id); server == nil {
+					break
+				}
+			}
+			// Skeletons must be numbered as requested, and only the origin may end them
+			if skeleton && !validSkeleton(headers, want) {
+				if server == p {
+					p.log.Debug("Skeleton chain invalid", "err", errInvalidChain)
+					return errInvalidChain
+				}
+				server.log.Debug("Helper skeleton invalid", "from", from)
+				failed[id] = struct{}{}
+				d.dropPeer(id)
+				break
+			}
+			if skeleton && len(headers) == 0 && server != p {
+				server.log.Debug("Helper skeleton unavailable", "from", from)
+				failed[id] = struct{}{}
 				break
 			}
 			headerReqTimer.UpdateSince(request)
 			timeout.Stop()
+			hedge, want = nil, 0
 
 			// If the skeleton's finished, pull any remaining head headers directly from the origin
 			if packet.Items() == 0 && skeleton {
@@ -828,16 +962,27 @@ func (d *Downloader) fetchHeaders(p *peerConnection, from uint64) error {
 					return errCancelHeaderFetch
 				}
 			}
-			headers := packet.(*headerPack).headers
-
 			// If we received a skeleton batch, resolve internals concurrently
 			if skeleton {
 				filled, proced, err := d.fillHeaderSkeleton(from, headers)
-				if err != nil {
+				switch {
+				case err == nil:
+					headers = filled[proced:]
+
+				case server == p:
 					p.log.Debug("Skeleton chain invalid", "err", err)
 					return errInvalidChain
+
+				case err == errCancelHeaderFetch:
+					return err
+
+				default:
+					// The helper's skeleton couldn't be filled, drop it and ask the origin again
+					server.log.Debug("Helper skeleton chain invalid", "err", err)
+					failed[id] = struct{}{}
+					d.dropPeer(id)
+					headers = nil
 				}
-				headers = filled[proced:]
 				from += uint64(proced)
 			}
 			// Insert all the new headers and fetch the next batch
@@ -874,6 +1019,41 @@ func (d *Downloader) fetchHeaders(p *peerConnection, from uint64) error {
 	}
 }
 
+// skeletonHelper picks the fastest idle peer announcing the same head as the
+// origin, which isn't awaiting any replies and wasn't found unreliable before,
+// to also retrieve a stalling skeleton from.
+func (d *Downloader) skeletonHelper(origin *peerConnection, asked map[string][]uint64, failed map[string]struct{}) *peerConnection {
+	head, _ := origin.peer.Head()
+
+	idles, _ := d.peers.HeaderIdlePeers()
+	for _, peer := range idles {
+		if len(asked[peer.id]) > 0 {
+			continue
+		}
+		if _, ok := failed[peer.id]; ok {
+			continue
+		}
+		if hash, _ := peer.peer.Head(); hash == head {
+			return peer
+		}
+	}
+	return nil
+}
+
+// validSkeleton checks whether a skeleton is numbered as requested, starting at
+// the given header and spacing the rest MaxHeaderFetch apart.
+func validSkeleton(skeleton []*types.Header, first uint64) bool {
+	if len(skeleton) > MaxSkeletonSize {
+		return false
+	}
+	for i, header := range skeleton {
+		if header.Number == nil || header.Number.Uint64() != first+uint64(i*MaxHeaderFetch) {
+			return false
+		}
+	}
+	return true
+}
+
 // fillHeaderSkeleton concurrently retrieves headers from all our available peers
 // and maps them to the provided skeleton header chain.
 //
@@ -895,7 +1075,7 @@ func (d *Downloader) fillHeaderSkeleton(from uint64, skeleton []*types.Header) (
 		expire   = func() map[string]int { return d.queue.ExpireHeaders(d.requestTTL()) }
 		throttle = func() bool { return false }
 		reserve  = func(p *peerConnection, count int) (*fetchRequest, bool, error) {
-			return d.queue.ReserveHeaders(p, count), false, nil
+			return d.queue.ReserveHeaders(p, count, d.requestRTT()), false, nil
 		}
 		fetch    = func(p *peerConnection, req *fetchRequest) error { return p.FetchHeaders(req.From, MaxHeaderFetch) }
 		capacity = func(p *peerConnection) int { return p.HeaderCapacity(d.requestRTT()) }
@@ -907,6 +1087,10 @@ func (d *Downloader) fillHeaderSkeleton(from uint64, skeleton []*types.Header) (
 
 	log.Debug("Skeleton fill terminated", "err", err)
 
+	// Release any peers still retrieving batches filled meanwhile by others
+	for _, p := range d.queue.AbandonHeaders() {
+		p.SetHeadersIdle(0)
+	}
 	filled, proced := d.queue.RetrieveHeaders()
 	return filled, proced, err
 }
@@ -1187,129 +1371,175 @@ func (d *Downloader) processHeaders(origin uint64, td *big.Int) error {
 		}
 	}()
 
-	// Wait for batches of headers to process
-	gotHeaders := false
-
+	// Verify the header batches in the background as they arrive, while the
+	// preceding ones are being imported and scheduled for content retrieval
+	var (
+		verifier   = newHeaderVerifier(d.lightchain)
+		tasks      []*headerTask // Header batches being verified, in chain order
+		finished   bool          // Whether the header stream has been terminated
+		gotHeaders bool          // Whether any headers were retrieved at all
+	)
+	defer func() {
+		for _, task := range tasks {
+			verifier.release(task)
+		}
+	}()
 	for {
+		// Terminate header processing if we synced up and all batches are done
+		if finished && len(tasks) == 0 {
+			// Notify everyone that headers are fully processed
+			for _, ch := range []chan bool{d.bodyWakeCh, d.receiptWakeCh} {
+				select {
+				case ch <- false:
+				case <-d.cancelCh:
+				}
+			}
+			// If no headers were retrieved at all, the peer violated its TD promise that it had a
+			// better chain compared to ours. The only exception is if its promised blocks were
+			// already imported by other means (e.g. fecher):
+			//
+			// R <remote peer>, L <local node>: Both at block 10
+			// R: Mine block 11, and propagate it to L
+			// L: Queue block 11 for import
+			// L: Notice that R's head and TD increased compared to ours, start sync
+			// L: Import of block 11 finishes
+			// L: Sync begins, and finds common ancestor at 11
+			// L: Request new headers up from 11 (R's TD was higher, it must have something)
+			// R: Nothing to give
+			if d.mode != LightSync {
+				if !gotHeaders && td.Cmp(d.blockchain.GetTdByHash(d.blockchain.CurrentBlock().Hash())) > 0 {
+					return errStallingPeer
+				}
+			}
+			// If fast or light syncing, ensure promised headers are indeed delivered. This is
+			// needed to detect scenarios where an attacker feeds a bad pivot and then bails out
+			// of delivering the post-pivot blocks that would flag the invalid content.
+			//
+			// This check cannot be executed "as is" for full imports, since blocks may still be
+			// queued for processing when the header download completes. However, as long as the
+			// peer gave us something useful, we're already happy/progressed (above check).
+			if d.mode == FastSync || d.mode == BeamSync || d.mode == LightSync {
+				if td.Cmp(d.lightchain.GetTdByHash(d.lightchain.CurrentHeader().Hash())) > 0 {
+					return errStallingPeer
+				}
+			}
+			// Disable any rollback and return
+			rollback = nil
+			return nil
+		}
+		// Only accept new batches if not too many are being verified already
+		var (
+			procCh = d.headerProcCh
+			doneCh <-chan struct{}
+		)
+		if finished || len(tasks) >= maxHeadersVerify {
+			procCh = nil
+		}
+		if len(tasks) > 0 {
+			doneCh = tasks[0].done
+		}
 		select {
 		case <-d.cancelCh:
 			return errCancelHeaderProcessing
 
-		case headers := <-d.headerProcCh:
-			// Terminate header processing if we synced up
+		case headers := <-procCh:
+			// Mark the header stream finished if we synced up
 			if len(headers) == 0 {
-				// Notify everyone that headers are fully processed
-				for _, ch := range []chan bool{d.bodyWakeCh, d.receiptWakeCh} {
-					select {
-					case ch <- false:
-					case <-d.cancelCh:
-					}
-				}
-				// If no headers were retrieved at all, the peer violated its TD promise that it had a
-				// better chain compared to ours. The only exception is if its promised blocks were
-				// already imported by other means (e.g. fecher):
-				//
-				// R <remote peer>, L <local node>: Both at block 10
-				// R: Mine block 11, and propagate it to L
-				// L: Queue block 11 for import
-				// L: Notice that R's head and TD increased compared to ours, start sync
-				// L: Import of block 11 finishes
-				// L: Sync begins, and finds common ancestor at 11
-				// L: Request new headers up from 11 (R's TD was higher, it must have something)
-				// R: Nothing to give
-				if d.mode != LightSync {
-					if !gotHeaders && td.Cmp(d.blockchain.GetTdByHash(d.blockchain.CurrentBlock().Hash())) > 0 {
-						return errStallingPeer
-					}
-				}
-				// If fast or light syncing, ensure promised headers are indeed delivered. This is
-				// needed to detect scenarios where an attacker feeds a bad pivot and then bails out
-				// of delivering the post-pivot blocks that would flag the invalid content.
-				//
-				// This check cannot be executed "as is" for full imports, since blocks may still be
-				// queued for processing when the header download completes. However, as long as the
-				// peer gave us something useful, we're already happy/progressed (above check).
-				if d.mode == FastSync || d.mode == LightSync {
-					if td.Cmp(d.lightchain.GetTdByHash(d.lightchain.CurrentHeader().Hash())) > 0 {
-						return errStallingPeer
-					}
-				}
-				// Disable any rollback and return
-				rollback = nil
-				return nil
+				finished = true
+				continue
 			}
-			// Otherwise split the chunk of headers into batches and process them
+			// Otherwise split the chunk of headers into batches and start verifying them
 			gotHeaders = true
 
 			for len(headers) > 0 {
-				// Terminate if something failed in between processing chunks
-				select {
-				case <-d.cancelCh:
-					return errCancelHeaderProcessing
-				default:
-				}
-				// Select the next chunk of headers to import
 				limit := maxHeadersProcess
 				if limit > len(headers) {
 					limit = len(headers)
 				}
 				chunk := headers[:limit]
 
-				// In case of header only syncing, validate the chunk immediately
-				if d.mode == FastSync || d.mode == LightSync {
-					// Collect the yet unknown headers to mark them as uncertain
-					unknown := make([]*types.Header, 0, len(headers))
-					for _, header := range chunk {
-						if !d.lightchain.HasHeader(header.Hash(), header.Number.Uint64()) {
-							unknown = append(unknown, header)
-						}
-					}
+				// In case of header only syncing, validate the chunk in the background
+				if d.mode == FastSync || d.mode == BeamSync || d.mode == LightSync {
 					// If we're importing pure headers, verify based on their recentness
 					frequency := fsHeaderCheckFrequency
 					if chunk[len(chunk)-1].Number.Uint64()+uint64(fsHeaderForceVerify) > pivot {
 						frequency = 1
 					}
-					if n, err := d.lightchain.InsertHeaderChain(chunk, frequency); err != nil {
-						// If some headers were inserted, add them too to the rollback list
-						if n > 0 {
-							rollback = append(rollback, chunk[:n]...)
-						}
-						log.Debug("Invalid header encountered", "number", chunk[n].Number, "hash", chunk[n].Hash(), "err", err)
-						return errInvalidChain
-					}
-					// All verifications passed, store newly found uncertain headers
-					rollback = append(rollback, unknown...)
-					if len(rollback) > fsHeaderSafetyNet {
-						rollback = append(rollback[:0], rollback[len(rollback)-fsHeaderSafetyNet:]...)
-					}
+					tasks = append(tasks, verifier.verify(chunk, headerSeals(len(chunk), frequency)))
+				} else {
+					// Full sync verifies the headers along with the blocks during import
+					task := &headerTask{headers: chunk, done: make(chan struct{}), quit: make(chan struct{})}
+					close(task.done)
+					tasks = append(tasks, task)
 				}
-				// If we're fast syncing and just pulled in the pivot, make sure it's the one locked in
-				if d.mode == FastSync && d.fsPivotLock != nil && chunk[0].Number.Uint64() <= pivot && chunk[len(chunk)-1].Number.Uint64() >= pivot {
-					if pivot := chunk[int(pivot-chunk[0].Number.Uint64())]; pivot.Hash() != d.fsPivotLock.Hash() {
-						log.Warn("Pivot doesn't match locked in one", "remoteNumber", pivot.Number, "remoteHash", pivot.Hash(), "localNumber", d.fsPivotLock.Number, "localHash", d.fsPivotLock.Hash())
-						return errInvalidChain
+				headers = headers[limit:]
+			}
+
+		case <-doneCh:
+			// The oldest batch finished verification, import it unless it failed
+			task := tasks[0]
+			tasks = tasks[1:]
+
+			chunk := task.headers
+			if task.err != nil {
+				// Import the headers preceding the invalid one still, to be able to roll them back
+				log.Debug("Invalid header encountered", "number", chunk[task.failed].Number, "hash", chunk[task.failed].Hash(), "err", task.err)
+				chunk = chunk[:task.failed]
+			}
+			if (d.mode == FastSync || d.mode == BeamSync || d.mode == LightSync) && len(chunk) > 0 {
+				// Collect the yet unknown headers to mark them as uncertain
+				unknown := make([]*types.Header, 0, len(chunk))
+				for _, header := range chunk {
+					if !d.lightchain.HasHeader(header.Hash(), header.Number.Uint64()) {
+						unknown = append(unknown, header)
 					}
 				}
-				// Unless we're doing light chains, schedule the headers for associated content retrieval
-				if d.mode == FullSync || d.mode == FastSync {
-					// If we've reached the allowed number of pending headers, stall a bit
-					for d.queue.PendingBlocks() >= maxQueuedHeaders || d.queue.PendingReceipts() >= maxQueuedHeaders {
-						select {
-						case <-d.cancelCh:
-							return errCancelHeaderProcessing
-						case <-time.After(time.Second):
-						}
+				n, err := d.lightchain.InsertVerifiedHeaderChain(chunk)
+				verifier.release(task)
+				if err != nil {
+					// If some headers were inserted, add them too to the rollback list
+					if n > 0 {
+						rollback = append(rollback, chunk[:n]...)
 					}
-					// Otherwise insert the headers for content retrieval
-					inserts := d.queue.Schedule(chunk, origin)
-					if len(inserts) != len(chunk) {
-						log.Debug("Stale headers")
-						return errBadPeer
+					log.Debug("Invalid header encountered", "number", chunk[n].Number, "hash", chunk[n].Hash(), "err", err)
+					return errInvalidChain
+				}
+				// All verifications passed, store newly found uncertain headers
+				rollback = append(rollback, unknown...)
+				if len(rollback) > fsHeaderSafetyNet {
+					rollback = append(rollback[:0], rollback[len(rollback)-fsHeaderSafetyNet:]...)
+				}
+			}
+			if task.err != nil {
+				verifier.release(task)
+				return errInvalidChain
+			}
+			// If we're fast syncing and just pulled in the pivot, make sure it's the one locked in
+			if (d.mode == FastSync || d.mode == BeamSync) && d.fsPivotLock != nil && chunk[0].Number.Uint64() <= pivot && chunk[len(chunk)-1].Number.Uint64() >= pivot {
+				if pivot := chunk[int(pivot-chunk[0].Number.Uint64())]; pivot.Hash() != d.fsPivotLock.Hash() {
+					log.Warn("Pivot doesn't match locked in one", "remoteNumber", pivot.Number, "remoteHash", pivot.Hash(), "localNumber", d.fsPivotLock.Number, "localHash", d.fsPivotLock.Hash())
+					return errInvalidChain
+				}
+			}
+			// Unless we're doing light chains, schedule the headers for associated content retrieval
+			if d.mode == FullSync || d.mode == FastSync || d.mode == BeamSync {
+				// If we've reached the allowed number of pending headers, stall a bit
+				for d.queue.PendingBlocks() >= maxQueuedHeaders || d.queue.PendingReceipts() >= maxQueuedHeaders {
+					select {
+					case <-d.cancelCh:
+						return errCancelHeaderProcessing
+					case <-time.After(time.Second):
 					}
 				}
-				headers = headers[limit:]
-				origin += uint64(limit)
+				// Otherwise insert the headers for content retrieval
+				inserts := d.queue.Schedule(chunk, origin)
+				if len(inserts) != len(chunk) {
+					log.Debug("Stale headers")
+					return errBadPeer
+				}
 			}
+			origin += uint64(len(chunk))
+
 			// Signal the content downloaders of the availablility of new tasks
 			for _, ch := range []chan bool{d.bodyWakeCh, d.receiptWakeCh} {
 				select {
@@ -1371,7 +1601,7 @@ func (d *Downloader) importBlockResults(results []*fetchResult) error {
 func (d *Downloader) processFastSyncContent(latest *types.Header) error {
 	// Start syncing state of the reported head block.
 	// This should get us most of the state of the pivot block.
-	stateSync := d.syncState(latest.Root)
+	stateSync := d.snapSyncState(latest.Root)
 	defer stateSync.Cancel()
 	go func() {
 		if err := stateSync.Wait(); err != nil {
@@ -1420,12 +1650,17 @@ func splitAroundPivot(pivot uint64, results []*fetchResult) (p *fetchResult, bef
 }
 
 func (d *Downloader) commitFastSyncData(results []*fetchResult, stateSync *stateSync) error {
+	// Beam sync doesn't download any state before reaching the pivot
+	var stateDone chan struct{}
+	if stateSync != nil {
+		stateDone = stateSync.done
+	}
 	for len(results) != 0 {
 		// Check for any termination requests.
 		select {
 		case <-d.quitCh:
 			return errCancelContentProcessing
-		case <-stateSync.done:
+		case <-stateDone:
 			if err := stateSync.Wait(); err != nil {
 				return err
 			}
@@ -1468,6 +1703,59 @@ func (d *Downloader) commitPivotBlock(result *fetchResult) error {
 	return d.blockchain.FastSyncCommitHead(b.Hash())
 }
 
+// processBeamSyncContent takes fetch results from the queue and writes them to
+// the database the same way fast sync does up to the pivot block. The pivot is
+// however committed without waiting for its state: its download is started in
+// the background instead, and all subsequent blocks are imported fully, with
+// block processing retrieving any missing state on demand via FetchState.
+func (d *Downloader) processBeamSyncContent() error {
+	pivot := d.queue.FastSyncPivot()
+	for {
+		results := d.queue.WaitResults()
+		if len(results) == 0 {
+			return nil
+		}
+		if d.chainInsertHook != nil {
+			d.chainInsertHook(results)
+		}
+		P, beforeP, afterP := splitAroundPivot(pivot, results)
+		if err := d.commitFastSyncData(beforeP, nil); err != nil {
+			return err
+		}
+		if P != nil {
+			if err := d.commitBeamPivotBlock(P); err != nil {
+				return err
+			}
+		}
+		if err := d.importBlockResults(afterP); err != nil {
+			return err
+		}
+	}
+}
+
+// commitBeamPivotBlock starts the background download of the pivot block's
+// state and commits the pivot as the new head as soon as its state root node is
+// available.
+func (d *Downloader) commitBeamPivotBlock(result *fetchResult) error {
+	b := types.NewBlockWithHeader(result.Header).WithBody(result.Transactions, result.Uncles)
+	d.startBeamState(b.Root())
+
+	if has, _ := d.stateDB.Has(b.Root().Bytes()); !has {
+		blob, err := d.FetchState(b.Root())
+		if err != nil {
+			return err
+		}
+		if err := d.stateDB.Put(b.Root().Bytes(), blob); err != nil {
+			return err
+		}
+	}
+	log.Debug("Committing beam sync pivot as new head", "number", b.Number(), "hash", b.Hash())
+	if _, err := d.blockchain.InsertReceiptChain([]*types.Block{b}, []types.Receipts{result.Receipts}); err != nil {
+		return err
+	}
+	return d.blockchain.FastSyncCommitHead(b.Hash())
+}
+
 // DeliverHeaders injects a new batch of block headers received from a remote
 // node into the download schedule.
 func (d *Downloader) DeliverHeaders(id string, headers []*types.Header) (err error) {
@@ -1486,6 +1774,17 @@ func (d *Downloader) DeliverReceipts(id string, receipts [][]*types.Receipt) (er
 
 // DeliverNodeData injects a new batch of node state data received from a remote node.
 func (d *Downloader) DeliverNodeData(id string, data [][]byte) (err error) {
+	// Beam sync state downloads outlive sync cycles, feed them directly
+	if s := d.runningBeamState(); s != nil {
+		stateInMeter.Mark(int64(len(data)))
+		select {
+		case d.stateCh <- &statePack{id, data}:
+			return nil
+		case <-s.done:
+			stateDropMeter.Mark(int64(len(data)))
+			return errNoSyncActive
+		}
+	}
 	return d.deliver(id, d.stateCh, &statePack{id, data}, stateInMeter, stateDropMeter)
 }
 
@@ -17,6 +17,7 @@
 package downloader
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
 	"math/big"
@@ -26,6 +27,8 @@ import (
 	"time"
 
 	"github.com/wiseplat/go-wiseplat/common"
+	"github.com/wiseplat/go-wiseplat/consensus"
+	"github.com/wiseplat/go-wiseplat/consensus/wshash"
 	"github.com/wiseplat/go-wiseplat/core"
 	"github.com/wiseplat/go-wiseplat/core/state"
 	"github.com/wiseplat/go-wiseplat/core/types"
@@ -61,6 +64,7 @@ type downloadTester struct {
 	ownBlocks   map[common.Hash]*types.Block   // Blocks belonging to the tester
 	ownReceipts map[common.Hash]types.Receipts // Receipts belonging to the tester
 	ownChainTd  map[common.Hash]*big.Int       // Total difficulties of the blocks in the local chain
+	ownTail     common.Hash                    // Oldest block of a chain started from a checkpoint
 
 	peerHashes   map[string][]common.Hash                  // Hash chain belonging to different test peers
 	peerHeaders  map[string]map[common.Hash]*types.Header  // Headers belonging to different test peers
@@ -70,6 +74,8 @@ type downloadTester struct {
 
 	peerMissingStates map[string]map[common.Hash]bool // State entries that fast sync should not return
 
+	beamFetches int32 // Number of state entries retrieved on demand during beam sync
+
 	lock sync.RWMutex
 }
 
@@ -239,6 +245,40 @@ func (dl *downloadTester) GetHeaderByHash(hash common.Hash) *types.Header {
 	return dl.ownHeaders[hash]
 }
 
+// GetHeader retrieves a header by hash and number from the testers canonical chain.
+func (dl *downloadTester) GetHeader(hash common.Hash, number uint64) *types.Header {
+	dl.lock.RLock()
+	defer dl.lock.RUnlock()
+
+	if header := dl.ownHeaders[hash]; header != nil && header.Number.Uint64() == number {
+		return header
+	}
+	return nil
+}
+
+// GetHeaderByNumber retrieves a header by number from the testers canonical chain.
+func (dl *downloadTester) GetHeaderByNumber(number uint64) *types.Header {
+	dl.lock.RLock()
+	defer dl.lock.RUnlock()
+
+	for _, hash := range dl.ownHashes {
+		if header := dl.ownHeaders[hash]; header != nil && header.Number.Uint64() == number {
+			return header
+		}
+	}
+	return nil
+}
+
+// Config retrieves the chain configuration of the simulated chain.
+func (dl *downloadTester) Config() *params.ChainConfig {
+	return params.TestChainConfig
+}
+
+// Engine retrieves a consensus engine verifying everything but the seals.
+func (dl *downloadTester) Engine() consensus.Engine {
+	return wshash.NewFaker()
+}
+
 // GetBlock retrieves a block from the testers canonical chain.
 func (dl *downloadTester) GetBlockByHash(hash common.Hash) *types.Block {
 	dl.lock.RLock()
@@ -306,8 +346,8 @@ func (dl *downloadTester) GetTdByHash(hash common.Hash) *big.Int {
 	return dl.ownChainTd[hash]
 }
 
-// InsertHeaderChain injects a new batch of headers into the simulated chain.
-func (dl *downloadTester) InsertHeaderChain(headers []*types.Header, checkFreq int) (int, error) {
+// InsertVerifiedHeaderChain injects a new batch of headers into the simulated chain.
+func (dl *downloadTester) InsertVerifiedHeaderChain(headers []*types.Header) (int, error) {
 	dl.lock.Lock()
 	defer dl.lock.Unlock()
 
@@ -337,6 +377,21 @@ func (dl *downloadTester) InsertHeaderChain(headers []*types.Header, checkFreq i
 
 // InsertChain injects a new batch of blocks into the simulated chain.
 func (dl *downloadTester) InsertChain(blocks types.Blocks) (int, error) {
+	// Beam sync accesses the parent states on demand, which must be done without
+	// holding the lock as the peers need it to serve the requests
+	if dl.downloader.mode == BeamSync {
+		for i, block := range blocks {
+			var parent *types.Block
+			if i > 0 {
+				parent = blocks[i-1]
+			} else if parent = dl.GetBlockByHash(block.ParentHash()); parent == nil {
+				return i, errors.New("unknown parent")
+			}
+			if err := dl.beamProcess(parent, block); err != nil {
+				return i, err
+			}
+		}
+	}
 	dl.lock.Lock()
 	defer dl.lock.Unlock()
 
@@ -351,12 +406,48 @@ func (dl *downloadTester) InsertChain(blocks types.Blocks) (int, error) {
 			dl.ownHeaders[block.Hash()] = block.Header()
 		}
 		dl.ownBlocks[block.Hash()] = block
-		dl.stateDb.Put(block.Root().Bytes(), []byte{0x00})
+		if dl.downloader.mode != BeamSync {
+			dl.stateDb.Put(block.Root().Bytes(), []byte{0x00})
+		}
 		dl.ownChainTd[block.Hash()] = new(big.Int).Add(dl.ownChainTd[block.ParentHash()], block.Difficulty())
 	}
 	return len(blocks), nil
 }
 
+// beamProcess simulates processing a block during beam sync: the entire parent
+// state is read, retrieving missing entries on demand, and the post state that
+// would be produced by executing the block is copied over from the peers.
+func (dl *downloadTester) beamProcess(parent, block *types.Block) error {
+	if parent.Hash() == dl.genesis.Hash() {
+		return nil // Placeholder state of the tester
+	}
+	fetch := func(hash common.Hash) ([]byte, error) {
+		atomic.AddInt32(&dl.beamFetches, 1)
+		return dl.downloader.FetchState(hash)
+	}
+	pre, err := trie.NewSecureWithHook(parent.Root(), dl.stateDb, 0, fetch)
+	if err != nil {
+		return err
+	}
+	for it := pre.NodeIterator(nil); it.Next(true); {
+		if it.Error() != nil {
+			return it.Error()
+		}
+	}
+	post, err := trie.NewSecure(block.Root(), dl.peerDb, 0)
+	if err != nil {
+		return err
+	}
+	it := post.NodeIterator(nil)
+	for it.Next(true) {
+		if hash := it.Hash(); hash != (common.Hash{}) {
+			blob, _ := dl.peerDb.Get(hash[:])
+			dl.stateDb.Put(hash[:], blob)
+		}
+	}
+	return it.Error()
+}
+
 // InsertReceiptChain injects a new batch of receipts into the simulated chain.
 func (dl *downloadTester) InsertReceiptChain(blocks types.Blocks, receipts []types.Receipts) (int, error) {
 	dl.lock.Lock()
@@ -375,6 +466,64 @@ func (dl *downloadTester) InsertReceiptChain(blocks types.Blocks, receipts []typ
 	return len(blocks), nil
 }
 
+// InsertCheckpoint starts the simulated chain from a trusted block.
+func (dl *downloadTester) InsertCheckpoint(block *types.Block, receipts types.Receipts, td *big.Int) error {
+	dl.lock.Lock()
+	defer dl.lock.Unlock()
+
+	if len(dl.ownHashes) > 1 {
+		return errors.New("non-empty chain")
+	}
+	dl.ownHashes = append(dl.ownHashes, block.Hash())
+	dl.ownHeaders[block.Hash()] = block.Header()
+	dl.ownBlocks[block.Hash()] = block
+	dl.ownReceipts[block.Hash()] = receipts
+	dl.ownChainTd[block.Hash()] = new(big.Int).Set(td)
+	dl.ownTail = block.Hash()
+	return nil
+}
+
+// InsertAncestors injects a batch of blocks preceding the simulated chain's tail.
+func (dl *downloadTester) InsertAncestors(blocks types.Blocks, receipts []types.Receipts) (int, error) {
+	dl.lock.Lock()
+	defer dl.lock.Unlock()
+
+	if dl.ownTail == (common.Hash{}) {
+		return 0, errors.New("no chain tail")
+	}
+	ancestors := make([]common.Hash, 0, len(blocks))
+	for i, block := range blocks {
+		child := dl.ownHeaders[dl.ownTail]
+		if block.Hash() != child.ParentHash {
+			return i, errors.New("non contiguous ancestors")
+		}
+		ancestors = append([]common.Hash{block.Hash()}, ancestors...)
+		dl.ownHeaders[block.Hash()] = block.Header()
+		dl.ownBlocks[block.Hash()] = block
+		dl.ownReceipts[block.Hash()] = receipts[i]
+		dl.ownChainTd[block.Hash()] = new(big.Int).Sub(dl.ownChainTd[dl.ownTail], child.Difficulty)
+		dl.ownTail = block.Hash()
+	}
+	// Keep the hash chain ordered, the heads are looked up at its end
+	dl.ownHashes = append(dl.ownHashes[:1], append(ancestors, dl.ownHashes[1:]...)...)
+	if dl.ownHeaders[dl.ownTail].ParentHash == dl.genesis.Hash() {
+		dl.ownTail = common.Hash{}
+	}
+	return len(blocks), nil
+}
+
+// ChainTail retrieves the oldest header of the simulated chain if it was started
+// from a checkpoint and is not yet linked up with the genesis block.
+func (dl *downloadTester) ChainTail() *types.Header {
+	dl.lock.RLock()
+	defer dl.lock.RUnlock()
+
+	if dl.ownTail == (common.Hash{}) {
+		return nil
+	}
+	return dl.ownHeaders[dl.ownTail]
+}
+
 // Rollback removes some recently added elements from the chain.
 func (dl *downloadTester) Rollback(hashes []common.Hash) {
 	dl.lock.Lock()
@@ -465,6 +614,7 @@ type downloadTesterPeer struct {
 	dl    *downloadTester
 	id    string
 	delay time.Duration
+	hook  func(skip int, headers []*types.Header) ([]*types.Header, bool) // Header reply tampering, withholding it if false
 	lock  sync.RWMutex
 }
 
@@ -476,6 +626,14 @@ func (dlp *downloadTesterPeer) setDelay(delay time.Duration) {
 	dlp.delay = delay
 }
 
+// setHeaderHook is a thread safe setter for the header reply tampering hook.
+func (dlp *downloadTesterPeer) setHeaderHook(hook func(skip int, headers []*types.Header) ([]*types.Header, bool)) {
+	dlp.lock.Lock()
+	defer dlp.lock.Unlock()
+
+	dlp.hook = hook
+}
+
 // waitDelay is a thread safe way to sleep for the configured time.
 func (dlp *downloadTesterPeer) waitDelay() {
 	dlp.lock.RLock()
@@ -491,7 +649,8 @@ func (dlp *downloadTesterPeer) Head() (common.Hash, *big.Int) {
 	dlp.dl.lock.RLock()
 	defer dlp.dl.lock.RUnlock()
 
-	return dlp.dl.peerHashes[dlp.id][0], nil
+	head := dlp.dl.peerHashes[dlp.id][0]
+	return head, dlp.dl.peerChainTds[dlp.id][head]
 }
 
 // RequestHeadersByHash constructs a GetBlockHeaders function based on a hashed
@@ -526,14 +685,28 @@ func (dlp *downloadTesterPeer) RequestHeadersByNumber(origin uint64, amount int,
 	hashes := dlp.dl.peerHashes[dlp.id]
 	headers := dlp.dl.peerHeaders[dlp.id]
 	result := make([]*types.Header, 0, amount)
-	for i := 0; i < amount && len(hashes)-int(origin)-1-i*(skip+1) >= 0; i++ {
-		if header, ok := headers[hashes[len(hashes)-int(origin)-1-i*(skip+1)]]; ok {
+	step := -(skip + 1)
+	if reverse {
+		step = skip + 1
+	}
+	for i, idx := 0, len(hashes)-int(origin)-1; i < amount && idx >= 0 && idx < len(hashes); i, idx = i+1, idx+step {
+		if header, ok := headers[hashes[idx]]; ok {
 			result = append(result, header)
 		}
 	}
+	dlp.lock.RLock()
+	hook := dlp.hook
+	dlp.lock.RUnlock()
+
 	// Delay delivery a bit to allow attacks to unfold
 	go func() {
 		time.Sleep(time.Millisecond)
+		if hook != nil {
+			var deliver bool
+			if result, deliver = hook(skip, result); !deliver {
+				return
+			}
+		}
 		dlp.dl.downloader.DeliverHeaders(dlp.id, result)
 	}()
 	return nil
@@ -650,7 +823,23 @@ func assertOwnForkedChain(t *testing.T, tester *downloadTester, common int, leng
 	if rs := len(tester.ownReceipts); rs < minReceipts || rs > maxReceipts {
 		t.Fatalf("synchronised receipts mismatch: have %v, want between [%v, %v]", rs, minReceipts, maxReceipts)
 	}
-	// Verify the state trie too for fast syncs
+	// Verify the state trie too for fast and beam syncs
+	if tester.downloader.mode == BeamSync {
+		if err := tester.downloader.beamState.Wait(); err != nil {
+			t.Fatalf("beam sync state download failed: %v", err)
+		}
+		root := tester.ownHeaders[tester.ownHashes[tester.downloader.queue.fastSyncPivot]].Root
+		tr, err := trie.NewSecure(root, tester.stateDb, 0)
+		if err != nil {
+			t.Fatalf("pivot state missing: %v", err)
+		}
+		it := tr.NodeIterator(nil)
+		for it.Next(true) {
+		}
+		if it.Error() != nil {
+			t.Fatalf("pivot state incomplete: %v", it.Error())
+		}
+	}
 	if tester.downloader.mode == FastSync {
 		var index int
 		if pivot := int(tester.downloader.queue.fastSyncPivot); pivot < common {
@@ -675,6 +864,8 @@ func TestCanonicalSynchronisation63Fast(t *testing.T)  { testCanonicalSynchronis
 func TestCanonicalSynchronisation64Full(t *testing.T)  { testCanonicalSynchronisation(t, 64, FullSync) }
 func TestCanonicalSynchronisation64Fast(t *testing.T)  { testCanonicalSynchronisation(t, 64, FastSync) }
 func TestCanonicalSynchronisation64Light(t *testing.T) { testCanonicalSynchronisation(t, 64, LightSync) }
+func TestCanonicalSynchronisation63Beam(t *testing.T)  { testCanonicalSynchronisation(t, 63, BeamSync) }
+func TestCanonicalSynchronisation64Beam(t *testing.T)  { testCanonicalSynchronisation(t, 64, BeamSync) }
 
 func testCanonicalSynchronisation(t *testing.T, protocol int, mode SyncMode) {
 	t.Parallel()
@@ -1820,3 +2011,431 @@ func testFastCriticalRestarts(t *testing.T, protocol int, progress bool) {
 	// completed using a single mode of operation, whereas fast-then-slow can result
 	// in arbitrary intermediate state that's not cleanly verifiable.
 }
+
+// Tests that state requested on demand during beam sync is retrieved along with
+// the background state download and handed over to the waiting requester.
+func TestBeamStateRetrieval63(t *testing.T) { testBeamStateRetrieval(t, 63) }
+func TestBeamStateRetrieval64(t *testing.T) { testBeamStateRetrieval(t, 64) }
+
+func testBeamStateRetrieval(t *testing.T, protocol int) {
+	t.Parallel()
+
+	tester := newTester()
+	defer tester.terminate()
+
+	targetBlocks := blockCacheLimit - 15
+	hashes, headers, blocks, receipts := tester.makeChain(targetBlocks, 0, tester.genesis, nil, false)
+	root := blocks[hashes[0]].Root()
+
+	// Without a state download running, on demand retrievals must fail right away
+	if _, err := tester.downloader.FetchState(root); err != errNoBeamSync {
+		t.Fatalf("retrieval without state download: have %v, want %v", err, errNoBeamSync)
+	}
+	// Pick the deepest state trie node for on demand retrieval
+	var deepest common.Hash
+	tr, _ := trie.NewSecure(root, tester.peerDb, 0)
+	for it := tr.NodeIterator(nil); it.Next(true); {
+		if it.Hash() != (common.Hash{}) {
+			deepest = it.Hash()
+		}
+	}
+	want, _ := tester.peerDb.Get(deepest[:])
+
+	// Start the state download without peers and queue the on demand request
+	// before any, so it's retrieved ahead of the regular trie sync
+	tester.downloader.startBeamState(root)
+	req := &beamReq{hash: deepest, done: make(chan struct{})}
+	tester.downloader.beamState.beam <- req
+
+	tester.newPeer("peer", protocol, hashes, headers, blocks, receipts)
+	select {
+	case <-req.done:
+	case <-time.After(3 * time.Second):
+		t.Fatalf("on demand retrieval timed out")
+	}
+	if req.err != nil {
+		t.Fatalf("on demand retrieval failed: %v", req.err)
+	}
+	if !bytes.Equal(req.blob, want) {
+		t.Fatalf("on demand retrieval mismatch: have %x, want %x", req.blob, want)
+	}
+	if err := tester.downloader.beamState.Wait(); err != nil {
+		t.Fatalf("state download failed: %v", err)
+	}
+	// Retrievals after the state download completed must fail instead of hanging
+	if _, err := tester.downloader.FetchState(root); err != errNoBeamSync {
+		t.Fatalf("retrieval after state download: have %v, want %v", err, errNoBeamSync)
+	}
+}
+
+// Tests that a beam sync state download interrupted by a restart is resumed from
+// the pivot root persisted in the database, and that the marker is dropped once
+// the download completes.
+func TestBeamSyncResume63(t *testing.T) { testBeamSyncResume(t, 63) }
+func TestBeamSyncResume64(t *testing.T) { testBeamSyncResume(t, 64) }
+
+func testBeamSyncResume(t *testing.T, protocol int) {
+	t.Parallel()
+
+	tester := newTester()
+	defer tester.terminate()
+
+	targetBlocks := blockCacheLimit - 15
+	hashes, headers, blocks, receipts := tester.makeChain(targetBlocks, 0, tester.genesis, nil, false)
+	root := blocks[hashes[0]].Root()
+
+	// Nothing to resume on a fresh database
+	if tester.downloader.ResumeBeamSync() {
+		t.Fatalf("beam sync resumed without a pivot marker")
+	}
+	// Simulate a restart in the middle of a beam sync state download
+	core.WriteBeamPivotRoot(tester.stateDb, root)
+
+	if !tester.downloader.ResumeBeamSync() {
+		t.Fatalf("beam sync not resumed from pivot marker")
+	}
+	s := tester.downloader.runningBeamState()
+	if s == nil || s.root != root {
+		t.Fatalf("resumed state download mismatch: have %v, want root %x", s, root)
+	}
+	// Resuming again must not restart the running download
+	tester.downloader.ResumeBeamSync()
+	if tester.downloader.beamState != s {
+		t.Fatalf("running state download restarted")
+	}
+	tester.newPeer("peer", protocol, hashes, headers, blocks, receipts)
+	if err := s.Wait(); err != nil {
+		t.Fatalf("resumed state download failed: %v", err)
+	}
+	tr, err := trie.NewSecure(root, tester.stateDb, 0)
+	if err != nil {
+		t.Fatalf("pivot state missing: %v", err)
+	}
+	for it := tr.NodeIterator(nil); it.Next(true); {
+		if it.Error() != nil {
+			t.Fatalf("pivot state incomplete: %v", it.Error())
+		}
+	}
+	// The pivot marker is dropped right after the download completes
+	for i := 0; core.GetBeamPivotRoot(tester.stateDb) != (common.Hash{}); i++ {
+		if i == 100 {
+			t.Fatalf("pivot marker not dropped after state download")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if tester.downloader.ResumeBeamSync() {
+		t.Fatalf("beam sync resumed after state download completed")
+	}
+}
+
+// Tests that fast sync can start an empty chain from a trusted checkpoint, only
+// retrieving the recent ancestors of it needed for block import, and that the
+// remaining ancestors can be backfilled afterwards.
+func TestCheckpointSync63(t *testing.T) { testCheckpointSync(t, 63) }
+func TestCheckpointSync64(t *testing.T) { testCheckpointSync(t, 64) }
+
+func testCheckpointSync(t *testing.T, protocol int) {
+	t.Parallel()
+
+	targetBlocks := blockCacheLimit - 15
+	for i, number := range []int{400, targetBlocks - 10, 400} {
+		tester := newTester()
+		defer tester.terminate()
+
+		hashes, headers, blocks, receipts := tester.makeChain(targetBlocks, 0, tester.genesis, nil, false)
+		tester.newPeer("peer", protocol, hashes, headers, blocks, receipts)
+
+		// Synchronise from the checkpoint and ensure no blocks before its ancestors are retrieved,
+		// the last time with its total difficulty configured instead of derived from the peer's
+		checkpoint := hashes[len(hashes)-1-number]
+		if i == 2 {
+			tester.downloader.SetCheckpoint(checkpoint, tester.peerChainTds["peer"][checkpoint])
+		} else {
+			tester.downloader.SetCheckpoint(checkpoint, nil)
+		}
+		if err := tester.sync("peer", nil, FastSync); err != nil {
+			t.Fatalf("checkpoint %d: failed to synchronise blocks: %v", number, err)
+		}
+		if have, want := len(tester.ownBlocks), targetBlocks-number+1+checkpointAncestors+1; have != want {
+			t.Fatalf("checkpoint %d: block count mismatch: have %v, want %v", number, have, want)
+		}
+		if tail := tester.ChainTail(); tail == nil || tail.Number.Uint64() != uint64(number-checkpointAncestors) {
+			t.Fatalf("checkpoint %d: chain tail mismatch: have %v, want #%d", number, tail, number-checkpointAncestors)
+		}
+		if head := tester.CurrentBlock(); head.Hash() != hashes[0] {
+			t.Fatalf("checkpoint %d: head block mismatch: have #%d, want #%d", number, head.Number(), targetBlocks)
+		}
+		// Backfill the remaining ancestors and ensure the chain matches the peer's
+		for tester.ChainTail() != nil {
+			if err := tester.downloader.Backfill("peer"); err != nil {
+				t.Fatalf("checkpoint %d: failed to backfill ancestors: %v", number, err)
+			}
+		}
+		if hs := len(tester.ownHeaders); hs != targetBlocks+1 {
+			t.Fatalf("checkpoint %d: synchronised headers mismatch: have %v, want %v", number, hs, targetBlocks+1)
+		}
+		if bs := len(tester.ownBlocks); bs != targetBlocks+1 {
+			t.Fatalf("checkpoint %d: synchronised blocks mismatch: have %v, want %v", number, bs, targetBlocks+1)
+		}
+		for _, hash := range hashes {
+			if have, want := tester.GetTdByHash(hash), tester.peerChainTds["peer"][hash]; have == nil || have.Cmp(want) != 0 {
+				t.Fatalf("checkpoint %d: block %x td mismatch: have %v, want %v", number, hash, have, want)
+			}
+		}
+	}
+}
+
+// Tests that a peer stalling on filling a skeleton batch doesn't hold up the
+// sync until its request times out, the batch being requested from a peer
+// estimated to be faster too.
+func TestStalledSkeletonFill62(t *testing.T)      { testStalledSkeletonFill(t, 62, FullSync) }
+func TestStalledSkeletonFill63Full(t *testing.T)  { testStalledSkeletonFill(t, 63, FullSync) }
+func TestStalledSkeletonFill63Fast(t *testing.T)  { testStalledSkeletonFill(t, 63, FastSync) }
+func TestStalledSkeletonFill64Full(t *testing.T)  { testStalledSkeletonFill(t, 64, FullSync) }
+func TestStalledSkeletonFill64Fast(t *testing.T)  { testStalledSkeletonFill(t, 64, FastSync) }
+func TestStalledSkeletonFill64Light(t *testing.T) { testStalledSkeletonFill(t, 64, LightSync) }
+
+func testStalledSkeletonFill(t *testing.T, protocol int, mode SyncMode) {
+	t.Parallel()
+
+	tester := newTester()
+	defer tester.terminate()
+
+	// Create a chain spanning multiple skeleton batches, and a peer never filling any
+	targetBlocks := 8*MaxHeaderFetch + 15
+	hashes, headers, blocks, receipts := tester.makeChain(targetBlocks, 0, tester.genesis, nil, false)
+
+	tester.newPeer("peer", protocol, hashes, headers, blocks, receipts)
+	tester.newPeer("staller", protocol, hashes, headers, blocks, receipts)
+	tester.downloader.peers.Peer("staller").peer.(*downloadTesterPeer).setHeaderHook(func(skip int, headers []*types.Header) ([]*types.Header, bool) {
+		return headers, skip != 0
+	})
+	// Tighten the QoS estimates for stalls to be detected well before timing out
+	atomic.StoreUint64(&tester.downloader.rttEstimate, uint64(100*time.Millisecond))
+	atomic.StoreUint64(&tester.downloader.rttConfidence, 100000)
+
+	if err := tester.sync("peer", nil, mode); err != nil {
+		t.Fatalf("failed to synchronise blocks: %v", err)
+	}
+	assertOwnChain(t, tester, targetBlocks+1)
+
+	if tester.downloader.peers.Peer("staller") == nil {
+		t.Errorf("stalling peer timed out instead of being bypassed")
+	}
+}
+
+// Tests that an origin peer stalling on delivering a skeleton doesn't fail the
+// sync, the skeleton being requested from another peer on the same chain too.
+func TestStalledSkeletonOrigin62(t *testing.T)      { testStalledSkeletonOrigin(t, 62, FullSync) }
+func TestStalledSkeletonOrigin63Full(t *testing.T)  { testStalledSkeletonOrigin(t, 63, FullSync) }
+func TestStalledSkeletonOrigin63Fast(t *testing.T)  { testStalledSkeletonOrigin(t, 63, FastSync) }
+func TestStalledSkeletonOrigin64Full(t *testing.T)  { testStalledSkeletonOrigin(t, 64, FullSync) }
+func TestStalledSkeletonOrigin64Fast(t *testing.T)  { testStalledSkeletonOrigin(t, 64, FastSync) }
+func TestStalledSkeletonOrigin64Light(t *testing.T) { testStalledSkeletonOrigin(t, 64, LightSync) }
+
+func testStalledSkeletonOrigin(t *testing.T, protocol int, mode SyncMode) {
+	t.Parallel()
+
+	tester := newTester()
+	defer tester.terminate()
+
+	// Create a chain and an origin never delivering the first skeleton
+	targetBlocks := 8*MaxHeaderFetch + 15
+	hashes, headers, blocks, receipts := tester.makeChain(targetBlocks, 0, tester.genesis, nil, false)
+
+	tester.newPeer("peer", protocol, hashes, headers, blocks, receipts)
+	tester.newPeer("helper", protocol, hashes, headers, blocks, receipts)
+
+	stalled := int32(0)
+	tester.downloader.peers.Peer("peer").peer.(*downloadTesterPeer).setHeaderHook(func(skip int, headers []*types.Header) ([]*types.Header, bool) {
+		return headers, skip != MaxHeaderFetch-1 || len(headers) == 0 || !atomic.CompareAndSwapInt32(&stalled, 0, 1)
+	})
+	// Tighten the QoS estimates for stalls to be detected well before timing out
+	atomic.StoreUint64(&tester.downloader.rttEstimate, uint64(100*time.Millisecond))
+	atomic.StoreUint64(&tester.downloader.rttConfidence, 100000)
+
+	if err := tester.sync("peer", nil, mode); err != nil {
+		t.Fatalf("failed to synchronise blocks: %v", err)
+	}
+	assertOwnChain(t, tester, targetBlocks+1)
+
+	if tester.downloader.peers.Peer("peer") == nil {
+		t.Errorf("stalling origin timed out instead of being helped")
+	}
+}
+
+// Tests that peers asked for a skeleton stalling on the origin cannot disrupt
+// the sync by delivering junk, either misnumbered or not mapping to any of the
+// fillings, but are dropped instead.
+func TestSkeletonHelperAttack62(t *testing.T)      { testSkeletonHelperAttack(t, 62, FullSync) }
+func TestSkeletonHelperAttack63Full(t *testing.T)  { testSkeletonHelperAttack(t, 63, FullSync) }
+func TestSkeletonHelperAttack63Fast(t *testing.T)  { testSkeletonHelperAttack(t, 63, FastSync) }
+func TestSkeletonHelperAttack64Full(t *testing.T)  { testSkeletonHelperAttack(t, 64, FullSync) }
+func TestSkeletonHelperAttack64Fast(t *testing.T)  { testSkeletonHelperAttack(t, 64, FastSync) }
+func TestSkeletonHelperAttack64Light(t *testing.T) { testSkeletonHelperAttack(t, 64, LightSync) }
+
+func testSkeletonHelperAttack(t *testing.T, protocol int, mode SyncMode) {
+	t.Parallel()
+
+	attacks := map[string]func([]*types.Header) []*types.Header{
+		"misnumbered": func(skeleton []*types.Header) []*types.Header {
+			return skeleton[1:]
+		},
+		"forged": func(skeleton []*types.Header) []*types.Header {
+			forged := make([]*types.Header, len(skeleton))
+			for i, header := range skeleton {
+				forged[i] = types.CopyHeader(header)
+				forged[i].Extra = []byte("forged")
+			}
+			return forged
+		},
+	}
+	for name, attack := range attacks {
+		tester := newTester()
+		defer tester.terminate()
+
+		// Create a chain, an origin slow to deliver the first skeleton and an attacker
+		targetBlocks := 8*MaxHeaderFetch + 15
+		hashes, headers, blocks, receipts := tester.makeChain(targetBlocks, 0, tester.genesis, nil, false)
+
+		tester.newPeer("peer", protocol, hashes, headers, blocks, receipts)
+		tester.newPeer("attack", protocol, hashes, headers, blocks, receipts)
+
+		delayed := int32(0)
+		tester.downloader.peers.Peer("peer").peer.(*downloadTesterPeer).setHeaderHook(func(skip int, headers []*types.Header) ([]*types.Header, bool) {
+			if skip == MaxHeaderFetch-1 && len(headers) > 0 && atomic.CompareAndSwapInt32(&delayed, 0, 1) {
+				time.Sleep(time.Second)
+			}
+			return headers, true
+		})
+		tester.downloader.peers.Peer("attack").peer.(*downloadTesterPeer).setHeaderHook(func(skip int, headers []*types.Header) ([]*types.Header, bool) {
+			if skip == MaxHeaderFetch-1 && len(headers) > 0 {
+				return attack(headers), true
+			}
+			return headers, true
+		})
+		// Tighten the QoS estimates for stalls to be detected well before timing out
+		atomic.StoreUint64(&tester.downloader.rttEstimate, uint64(100*time.Millisecond))
+		atomic.StoreUint64(&tester.downloader.rttConfidence, 100000)
+
+		if err := tester.sync("peer", nil, mode); err != nil {
+			t.Fatalf("%s: failed to synchronise blocks: %v", name, err)
+		}
+		assertOwnChain(t, tester, targetBlocks+1)
+
+		if tester.downloader.peers.Peer("attack") != nil {
+			t.Errorf("%s: attacker not dropped", name)
+		}
+		if tester.downloader.peers.Peer("peer") == nil {
+			t.Errorf("%s: origin dropped", name)
+		}
+	}
+}
+
+// Tests that the seal selection of header batches always includes the last
+// header, and copes with empty batches.
+func TestHeaderSeals(t *testing.T) {
+	if seals := headerSeals(0, fsHeaderCheckFrequency); len(seals) != 0 {
+		t.Fatalf("empty batch seals mismatch: have %v, want none", seals)
+	}
+	for _, count := range []int{1, fsHeaderCheckFrequency - 1, fsHeaderCheckFrequency, 3*fsHeaderCheckFrequency + 1} {
+		seals := headerSeals(count, fsHeaderCheckFrequency)
+		if len(seals) != count {
+			t.Fatalf("batch of %d: seal count mismatch: have %d", count, len(seals))
+		}
+		if !seals[count-1] {
+			t.Errorf("batch of %d: last header seal not verified", count)
+		}
+	}
+}
+
+// Tests that pipelined header verification actually checks the headers of each
+// batch, instead of skipping them as known ones, while still resolving parents
+// from the batches in flight before it.
+func TestHeaderVerifierPipelining(t *testing.T) {
+	tester := newTester()
+	defer tester.terminate()
+
+	hashes, headers, _, _ := tester.makeChain(2*MaxHeaderFetch, 0, tester.genesis, nil, false)
+
+	chain := make([]*types.Header, 0, len(hashes)-1)
+	for i := len(hashes) - 2; i >= 0; i-- {
+		chain = append(chain, headers[hashes[i]])
+	}
+	first, second := chain[:MaxHeaderFetch], chain[MaxHeaderFetch:]
+
+	// Verify two valid consecutive batches, the second one's parent in flight
+	verifier := newHeaderVerifier(tester)
+	tasks := []*headerTask{
+		verifier.verify(first, make([]bool, len(first))),
+		verifier.verify(second, make([]bool, len(second))),
+	}
+	for i, task := range tasks {
+		<-task.done
+		if task.err != nil {
+			t.Fatalf("batch %d: failed to verify valid headers: %v (index %d)", i, task.err, task.failed)
+		}
+	}
+	for _, task := range tasks {
+		verifier.release(task)
+	}
+	// Tamper with a header in the second batch and ensure it's rejected
+	bad := make([]*types.Header, len(second))
+	copy(bad, second)
+
+	bad[10] = types.CopyHeader(bad[10])
+	bad[10].Difficulty = new(big.Int).Add(bad[10].Difficulty, big.NewInt(1))
+
+	tasks = []*headerTask{
+		verifier.verify(first, make([]bool, len(first))),
+		verifier.verify(bad, make([]bool, len(bad))),
+	}
+	<-tasks[0].done
+	<-tasks[1].done
+
+	if tasks[0].err != nil {
+		t.Fatalf("valid batch rejected: %v (index %d)", tasks[0].err, tasks[0].failed)
+	}
+	if tasks[1].err == nil || tasks[1].failed != 10 {
+		t.Fatalf("tampered batch failure mismatch: have %v at index %d, want failure at index 10", tasks[1].err, tasks[1].failed)
+	}
+	for _, task := range tasks {
+		verifier.release(task)
+	}
+}
+
+// Tests that the headers a checkpoint's total difficulty is derived from are
+// verified, so a peer can't inflate it with headers of bogus difficulty.
+func TestCheckpointSyncInvalidTd63(t *testing.T) { testCheckpointSyncInvalidTd(t, 63) }
+func TestCheckpointSyncInvalidTd64(t *testing.T) { testCheckpointSyncInvalidTd(t, 64) }
+
+func testCheckpointSyncInvalidTd(t *testing.T, protocol int) {
+	t.Parallel()
+
+	tester := newTester()
+	defer tester.terminate()
+
+	targetBlocks, number := 2*MaxHeaderFetch, 300
+	hashes, headers, blocks, receipts := tester.makeChain(targetBlocks, 0, tester.genesis, nil, false)
+
+	// Rebuild the chain above the checkpoint with doubled difficulties
+	checkpoint := hashes[len(hashes)-1-number]
+	parent := checkpoint
+	for i := len(hashes) - 2 - number; i >= 0; i-- {
+		header := types.CopyHeader(headers[hashes[i]])
+		header.ParentHash = parent
+		header.Difficulty = new(big.Int).Mul(header.Difficulty, big.NewInt(2))
+
+		hashes[i], parent = header.Hash(), header.Hash()
+		headers[parent] = header
+	}
+	tester.newPeer("attack", protocol, hashes, headers, blocks, receipts)
+
+	tester.downloader.SetCheckpoint(checkpoint, nil)
+	if err := tester.sync("attack", nil, FastSync); err != errInvalidChain {
+		t.Fatalf("synchronisation error mismatch: have %v, want %v", err, errInvalidChain)
+	}
+	if tester.GetTdByHash(checkpoint) != nil {
+		t.Fatalf("checkpoint inserted with unverified total difficulty")
+	}
+}
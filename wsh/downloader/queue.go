@@ -63,6 +63,7 @@ type fetchResult struct {
 type queue struct {
 	mode          SyncMode // Synchronisation mode to decide on the block parts to schedule for fetching
 	fastSyncPivot uint64   // Block number where the fast sync pivots into archive synchronisation mode
+	fastSyncHead  uint64   // Block number of the remote head known when the sync started
 
 	headerHead common.Hash // [wsh/62] Hash of the last queued header to verify order
 
@@ -123,6 +124,7 @@ func (q *queue) Reset() {
 	q.closed = false
 	q.mode = FullSync
 	q.fastSyncPivot = 0
+	q.fastSyncHead = 0
 
 	q.headerHead = common.Hash{}
 
@@ -151,12 +153,13 @@ func (q *queue) Close() {
 	q.active.Broadcast()
 }
 
-// PendingHeaders retrieves the number of header requests pending for retrieval.
+// PendingHeaders retrieves the number of skeleton batches not yet filled. Batches
+// already being retrieved are counted too, as stalling ones may be reassigned.
 func (q *queue) PendingHeaders() int {
 	q.lock.Lock()
 	defer q.lock.Unlock()
 
-	return q.headerTaskQueue.Size()
+	return len(q.headerTaskPool)
 }
 
 // PendingBlocks retrieves the number of block (body) requests pending for retrieval.
@@ -176,12 +179,17 @@ func (q *queue) PendingReceipts() int {
 }
 
 // InFlightHeaders retrieves whether there are header fetch requests currently
-// in flight.
+// in flight for batches not yet filled.
 func (q *queue) InFlightHeaders() bool {
 	q.lock.Lock()
 	defer q.lock.Unlock()
 
-	return len(q.headerPendPool) > 0
+	for _, request := range q.headerPendPool {
+		if _, ok := q.headerTaskPool[request.From]; ok {
+			return true
+		}
+	}
+	return false
 }
 
 // InFlightBlocks retrieves whether there are block fetch requests currently in
@@ -377,9 +385,14 @@ func (q *queue) countProcessableItems() int {
 		// Stop before processing the pivot block to ensure that
 		// resultCache has space for fsHeaderForceVerify items. Not
 		// doing this could leave us unable to download the required
-		// amount of headers.
+		// amount of headers. Only headers known to exist are waited for, as
+		// a checkpoint pivot may be closer to the head than that.
 		if q.mode == FastSync && result.Header.Number.Uint64() == q.fastSyncPivot {
-			for j := 0; j < fsHeaderForceVerify; j++ {
+			verify := fsHeaderForceVerify
+			if q.fastSyncHead > q.fastSyncPivot && q.fastSyncHead-q.fastSyncPivot < uint64(verify) {
+				verify = int(q.fastSyncHead - q.fastSyncPivot)
+			}
+			for j := 0; j < verify; j++ {
 				if i+j+1 >= len(q.resultCache) || q.resultCache[i+j+1] == nil {
 					return i
 				}
@@ -390,8 +403,9 @@ func (q *queue) countProcessableItems() int {
 }
 
 // ReserveHeaders reserves a set of headers for the given peer, skipping any
-// previously failed batches.
-func (q *queue) ReserveHeaders(p *peerConnection, count int) *fetchRequest {
+// previously failed batches. If the batch holding back the delivery of the
+// filled headers is stalling, it's reserved for the peer too if it's faster.
+func (q *queue) ReserveHeaders(p *peerConnection, count int, rtt time.Duration) *fetchRequest {
 	q.lock.Lock()
 	defer q.lock.Unlock()
 
@@ -401,7 +415,7 @@ func (q *queue) ReserveHeaders(p *peerConnection, count int) *fetchRequest {
 		return nil
 	}
 	// Retrieve a batch of hashes, skipping previously failed ones
-	send, skip := uint64(0), []uint64{}
+	send, skip := q.stalledHeaders(p, rtt), []uint64{}
 	for send == 0 && !q.headerTaskQueue.Empty() {
 		from, _ := q.headerTaskQueue.Pop()
 		if q.headerPeerMiss[p.id] != nil {
@@ -429,6 +443,58 @@ func (q *queue) ReserveHeaders(p *peerConnection, count int) *fetchRequest {
 	return request
 }
 
+// stalledHeaders returns the first unfilled skeleton batch if all the peers it's
+// assigned to exceeded twice their estimated delivery time, and the given peer
+// is estimated to be faster than each of them. Otherwise 0 is returned.
+//
+// Note, this method expects the queue lock to be already held.
+func (q *queue) stalledHeaders(p *peerConnection, rtt time.Duration) uint64 {
+	// Find the first batch not yet filled, and make sure the peer may have it
+	index := q.headerProced
+	for index < len(q.headerResults) && q.headerResults[index] != nil {
+		index += MaxHeaderFetch
+	}
+	if index >= len(q.headerResults) {
+		return 0
+	}
+	from := q.headerOffset + uint64(index)
+	if _, ok := q.headerPeerMiss[p.id][from]; ok {
+		return 0
+	}
+	// Only duplicate the request if all the current assignees are stalling
+	delay, holders := p.HeaderDelay(rtt), 0
+	for _, request := range q.headerPendPool {
+		if request.From != from {
+			continue
+		}
+		held := request.Peer.HeaderDelay(rtt)
+		if elapsed := time.Since(request.Time); elapsed < 2*held || elapsed < rtt || delay >= held {
+			return 0
+		}
+		holders++
+	}
+	if holders == 0 {
+		return 0
+	}
+	return from
+}
+
+// requeueHeaders returns a skeleton batch into the task queue, unless it was
+// filled meanwhile or other peers are still retrieving it.
+//
+// Note, this method expects the queue lock to be already held.
+func (q *queue) requeueHeaders(from uint64) {
+	if _, ok := q.headerTaskPool[from]; !ok {
+		return
+	}
+	for _, request := range q.headerPendPool {
+		if request.From == from {
+			return
+		}
+	}
+	q.headerTaskQueue.Push(from, -float32(from))
+}
+
 // ReserveBodies reserves a set of body fetches for the given peer, skipping any
 // previously failed downloads. Beside the next batch of needed fetches, it also
 // returns a flag whether empty blocks were queued requiring processing.
@@ -562,8 +628,10 @@ func (q *queue) cancel(request *fetchRequest, taskQueue *prque.Prque, pendPool m
 	q.lock.Lock()
 	defer q.lock.Unlock()
 
+	delete(pendPool, request.Peer.id)
+
 	if request.From > 0 {
-		taskQueue.Push(request.From, -float32(request.From))
+		q.requeueHeaders(request.From)
 	}
 	for hash, index := range request.Hashes {
 		taskQueue.Push(hash, float32(index))
@@ -571,7 +639,21 @@ func (q *queue) cancel(request *fetchRequest, taskQueue *prque.Prque, pendPool m
 	for _, header := range request.Headers {
 		taskQueue.Push(header, -float32(header.Number.Uint64()))
 	}
-	delete(pendPool, request.Peer.id)
+}
+
+// AbandonHeaders drops all the pending header fetch requests, returning the peers
+// they were assigned to. It's meant to release the peers still retrieving batches
+// filled meanwhile by others, once the skeleton filling terminates.
+func (q *queue) AbandonHeaders() []*peerConnection {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	peers := make([]*peerConnection, 0, len(q.headerPendPool))
+	for id, request := range q.headerPendPool {
+		peers = append(peers, request.Peer)
+		delete(q.headerPendPool, id)
+	}
+	return peers
 }
 
 // Revoke cancels all pending requests belonging to a given peer. This method is
@@ -637,8 +719,9 @@ func (q *queue) expire(timeout time.Duration, pendPool map[string]*fetchRequest,
 			timeoutMeter.Mark(1)
 
 			// Return any non satisfied requests to the pool
+			delete(pendPool, id)
 			if request.From > 0 {
-				taskQueue.Push(request.From, -float32(request.From))
+				q.requeueHeaders(request.From)
 			}
 			for hash, index := range request.Hashes {
 				taskQueue.Push(hash, float32(index))
@@ -654,10 +737,6 @@ func (q *queue) expire(timeout time.Duration, pendPool map[string]*fetchRequest,
 			expiries[id] = expirations
 		}
 	}
-	// Remove the expired requests from the pending pool
-	for id := range expiries {
-		delete(pendPool, id)
-	}
 	return expiries
 }
 
@@ -680,8 +759,14 @@ func (q *queue) DeliverHeaders(id string, headers []*types.Header, headerProcCh
 	headerReqTimer.UpdateSince(request.Time)
 	delete(q.headerPendPool, id)
 
+	// If the batch was already filled by a faster peer, discard the duplicate
+	skeleton, ok := q.headerTaskPool[request.From]
+	if !ok {
+		log.Trace("Skeleton filling already delivered", "peer", id, "from", request.From)
+		return len(headers), nil
+	}
 	// Ensure headers can be mapped onto the skeleton chain
-	target := q.headerTaskPool[request.From].Hash()
+	target := skeleton.Hash()
 
 	accepted := len(headers) == MaxHeaderFetch
 	if accepted {
@@ -719,7 +804,7 @@ func (q *queue) DeliverHeaders(id string, headers []*types.Header, headerProcCh
 		}
 		miss[request.From] = struct{}{}
 
-		q.headerTaskQueue.Push(request.From, -float32(request.From))
+		q.requeueHeaders(request.From)
 		return 0, errors.New("delivery not accepted")
 	}
 	// Clean up a successful fetch and try to deliver any sub-results
@@ -869,5 +954,8 @@ func (q *queue) Prepare(offset uint64, mode SyncMode, pivot uint64, head *types.
 		q.resultOffset = offset
 	}
 	q.fastSyncPivot = pivot
+	if head != nil {
+		q.fastSyncHead = head.Number.Uint64()
+	}
 	q.mode = mode
 }
@@ -36,6 +36,7 @@ import (
 type stateReq struct {
 	items    []common.Hash              // Hashes of the state items to download
 	tasks    map[common.Hash]*stateTask // Download tasks to track previous attempts
+	beams    map[common.Hash]*beamTask  // On demand retrievals to track previous attempts
 	timeout  time.Duration              // Maximum round trip time for this to complete
 	timer    *time.Timer                // Timer to fire when the RTT timeout expires
 	peer     *peerConnection            // Peer that we're requesting from
@@ -57,9 +58,23 @@ type stateSyncStats struct {
 	pending    uint64 // Number of still pending state entries
 }
 
-// syncState starts downloading state with the given root hash.
+// syncState starts downloading state with the given root hash, retrieving the
+// trie node by node.
 func (d *Downloader) syncState(root common.Hash) *stateSync {
+	return d.startStateSync(newStateSync(d, root))
+}
+
+// snapSyncState starts downloading state with the given root hash, retrieving the
+// bulk of it in contiguous ranges via the snap protocol first and only healing the
+// leftover gaps node by node.
+func (d *Downloader) snapSyncState(root common.Hash) *stateSync {
 	s := newStateSync(d, root)
+	s.snap = true
+	return d.startStateSync(s)
+}
+
+// startStateSync hands a state sync over to the state fetcher for running.
+func (d *Downloader) startStateSync(s *stateSync) *stateSync {
 	select {
 	case d.stateSyncStart <- s:
 	case <-d.quitCh:
@@ -211,10 +226,17 @@ func (d *Downloader) runStateSync(s *stateSync) *stateSync {
 type stateSync struct {
 	d *Downloader // Downloader instance to access and manage current peerset
 
+	root common.Hash // State root currently being synced
+	snap bool        // Whether to range sync via snap before healing node by node
+
 	sched  *trie.TrieSync             // State trie sync scheduler defining the tasks
 	keccak hash.Hash                  // Keccak256 hasher to verify deliveries with
 	tasks  map[common.Hash]*stateTask // Set of tasks currently queued for retrieval
 
+	beam      chan *beamReq             // Channel receiving on demand retrievals during beam sync
+	beamTasks map[common.Hash]*beamTask // On demand retrievals currently queued or in flight
+	beamQueue map[common.Hash]struct{}  // On demand retrievals queued for (re)assignment
+
 	numUncommitted   int
 	bytesUncommitted int
 
@@ -235,13 +257,17 @@ type stateTask struct {
 // yet start the sync. The user needs to call run to initiate.
 func newStateSync(d *Downloader, root common.Hash) *stateSync {
 	return &stateSync{
-		d:       d,
-		sched:   state.NewStateSync(root, d.stateDB),
-		keccak:  sha3.NewKeccak256(),
-		tasks:   make(map[common.Hash]*stateTask),
-		deliver: make(chan *stateReq),
-		cancel:  make(chan struct{}),
-		done:    make(chan struct{}),
+		d:         d,
+		root:      root,
+		sched:     state.NewStateSync(root, d.stateDB),
+		keccak:    sha3.NewKeccak256(),
+		tasks:     make(map[common.Hash]*stateTask),
+		beam:      make(chan *beamReq),
+		beamTasks: make(map[common.Hash]*beamTask),
+		beamQueue: make(map[common.Hash]struct{}),
+		deliver:   make(chan *stateReq),
+		cancel:    make(chan struct{}),
+		done:      make(chan struct{}),
 	}
 }
 
@@ -249,6 +275,14 @@ func newStateSync(d *Downloader, root common.Hash) *stateSync {
 // it finishes, and finally notifying any goroutines waiting for the loop to
 // finish.
 func (s *stateSync) run() {
+	if s.snap {
+		// Retrieve as much of the state as possible in ranges, and recreate the
+		// node scheduler afterwards so it only requests the missing trie nodes
+		if err := s.d.SnapSyncer.Sync(s.root, s.cancel); err != nil {
+			log.Debug("Snapshot sync failed, healing state trie", "root", s.root, "err", err)
+		}
+		s.sched = state.NewStateSync(s.root, s.d.stateDB)
+	}
 	s.err = s.loop()
 	close(s.done)
 }
@@ -277,6 +311,12 @@ func (s *stateSync) loop() error {
 	peerSub := s.d.peers.SubscribeNewPeers(newPeer)
 	defer peerSub.Unsubscribe()
 
+	// Fail any on demand retrievals still waiting when the sync terminates
+	defer func() {
+		for hash := range s.beamTasks {
+			s.failBeamTask(hash, errNoBeamSync)
+		}
+	}()
 	// Keep assigning new tasks until the sync completes or aborts
 	for s.sched.Pending() > 0 {
 		if err := s.commit(false); err != nil {
@@ -291,6 +331,15 @@ func (s *stateSync) loop() error {
 		case <-s.cancel:
 			return errCancelStateFetch
 
+		case req := <-s.beam:
+			// On demand retrieval from block processing, schedule it ahead of the rest
+			if task := s.beamTasks[req.hash]; task != nil {
+				task.reqs = append(task.reqs, req)
+				continue
+			}
+			s.beamTasks[req.hash] = &beamTask{reqs: []*beamReq{req}, attempts: make(map[string]struct{})}
+			s.beamQueue[req.hash] = struct{}{}
+
 		case req := <-s.deliver:
 			// Response, disconnect or timeout triggered, drop the peer if stalling
 			log.Trace("Received node data response", "peer", req.peer.id, "count", len(req.response), "dropped", req.dropped, "timeout", !req.dropped && req.timedOut())
@@ -364,9 +413,24 @@ func (s *stateSync) fillTasks(n int, req *stateReq) {
 			s.tasks[hash] = &stateTask{make(map[string]struct{})}
 		}
 	}
-	// Find tasks that haven't been tried with the request's peer.
+	// Find tasks that haven't been tried with the request's peer, prioritizing
+	// on demand retrievals blocking block processing.
 	req.items = make([]common.Hash, 0, n)
 	req.tasks = make(map[common.Hash]*stateTask, n)
+	req.beams = make(map[common.Hash]*beamTask)
+	for hash := range s.beamQueue {
+		if len(req.items) == n {
+			break
+		}
+		t := s.beamTasks[hash]
+		if _, ok := t.attempts[req.peer.id]; ok {
+			continue
+		}
+		t.attempts[req.peer.id] = struct{}{}
+		req.items = append(req.items, hash)
+		req.beams[hash] = t
+		delete(s.beamQueue, hash)
+	}
 	for hash, t := range s.tasks {
 		// Stop when we've gathered enough requests
 		if len(req.items) == n {
@@ -402,13 +466,26 @@ func (s *stateSync) process(req *stateReq) (bool, error) {
 
 	for _, blob := range req.response {
 		prog, hash, err := s.processNodeData(blob)
+
+		// Hand any on demand retrievals over to block processing
+		beam := false
+		if _, ok := s.beamTasks[hash]; ok {
+			s.deliverBeamTask(hash, blob)
+			beam = true
+		}
+		if _, ok := req.beams[hash]; ok {
+			delete(req.beams, hash)
+			stale = false
+		}
 		switch err {
 		case nil:
 			s.numUncommitted++
 			s.bytesUncommitted += len(blob)
 			progress = progress || prog
 		case trie.ErrNotRequested:
-			unexpected++
+			if !beam {
+				unexpected++
+			}
 		case trie.ErrAlreadyProcessed:
 			duplicate++
 		default:
@@ -428,6 +505,22 @@ func (s *stateSync) process(req *stateReq) (bool, error) {
 
 	// Put unfulfilled tasks back into the retry queue
 	npeers := s.d.peers.Len()
+	for hash, task := range req.beams {
+		// Skip items delivered in the meantime by some other request
+		if s.beamTasks[hash] != task {
+			continue
+		}
+		if len(req.response) > 0 || req.timedOut() {
+			delete(task.attempts, req.peer.id)
+		}
+		// On demand items nobody can deliver only fail block processing, the
+		// state sync itself may still succeed.
+		if len(task.attempts) >= npeers {
+			s.failBeamTask(hash, fmt.Errorf("state item %s failed with all peers (%d tries, %d peers)", hash.TerminalString(), len(task.attempts), npeers))
+			continue
+		}
+		s.beamQueue[hash] = struct{}{}
+	}
 	for hash, task := range req.tasks {
 		// If the node did deliver something, missing items may be due to a protocol
 		// limit or a previous timeout + delayed delivery. Both cases should permit
@@ -446,6 +539,26 @@ func (s *stateSync) process(req *stateReq) (bool, error) {
 	return stale, nil
 }
 
+// deliverBeamTask completes all on demand requests waiting for a state item.
+func (s *stateSync) deliverBeamTask(hash common.Hash, blob []byte) {
+	for _, req := range s.beamTasks[hash].reqs {
+		req.blob = blob
+		close(req.done)
+	}
+	delete(s.beamTasks, hash)
+	delete(s.beamQueue, hash)
+}
+
+// failBeamTask aborts all on demand requests waiting for a state item.
+func (s *stateSync) failBeamTask(hash common.Hash, err error) {
+	for _, req := range s.beamTasks[hash].reqs {
+		req.err = err
+		close(req.done)
+	}
+	delete(s.beamTasks, hash)
+	delete(s.beamQueue, hash)
+}
+
 // processNodeData tries to inject a trie node data blob delivered from a remote
 // peer into the state trie, returning whether anything useful was written or any
 // error occurred.
@@ -0,0 +1,225 @@
+// Copyright 2018 The go-wiseplat Authors
+// This file is part of the go-wiseplat library.
+//
+// The go-wiseplat library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-wiseplat library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-wiseplat library. If not, see <http://www.gnu.org/licenses/>.
+
+package downloader
+
+import (
+	"math/rand"
+	"sync"
+
+	"github.com/wiseplat/go-wiseplat/common"
+	"github.com/wiseplat/go-wiseplat/core"
+	"github.com/wiseplat/go-wiseplat/core/types"
+	"github.com/wiseplat/go-wiseplat/params"
+)
+
+// headerTask is a batch of retrieved headers being verified by the consensus
+// engine in the background, ahead of its insertion into the local chain.
+type headerTask struct {
+	headers []*types.Header // Batch of contiguous headers to verify
+	done    chan struct{}   // Channel closed when the verification finished
+	quit    chan struct{}   // Channel to abandon the verification of the batch
+
+	failed int   // Index of the first header failing verification
+	err    error // Verification error of the first failing header
+}
+
+// headerVerifier pipelines the verification of consecutive header batches. Each
+// batch is handed to the consensus engine as soon as it's retrieved, the headers
+// of all batches still in flight being resolvable as the ancestors of the ones
+// following them. This way verifying a batch doesn't need to wait for all the
+// ones preceding it to be verified and inserted into the local chain first.
+type headerVerifier struct {
+	chain LightChain
+
+	hashes  map[common.Hash]overlayHeader // Headers of the in-flight batches by hash
+	numbers map[uint64]overlayHeader      // Headers of the in-flight batches by number
+	lock    sync.RWMutex
+}
+
+// overlayHeader is a header of an in-flight batch, tagged with its batch.
+type overlayHeader struct {
+	header *types.Header
+	task   *headerTask
+}
+
+// newHeaderVerifier creates a header verifier pipelining on top of a local chain.
+func newHeaderVerifier(chain LightChain) *headerVerifier {
+	return &headerVerifier{
+		chain:   chain,
+		hashes:  make(map[common.Hash]overlayHeader),
+		numbers: make(map[uint64]overlayHeader),
+	}
+}
+
+// verify starts verifying a batch of headers in the background, checking the
+// seals of those flagged. The headers must directly follow either a previously
+// started batch or a header already present in the local chain.
+func (v *headerVerifier) verify(headers []*types.Header, seals []bool) *headerTask {
+	task := &headerTask{
+		headers: headers,
+		done:    make(chan struct{}),
+		quit:    make(chan struct{}),
+		failed:  -1,
+	}
+	v.lock.Lock()
+	for _, header := range headers {
+		v.hashes[header.Hash()] = overlayHeader{header, task}
+		v.numbers[header.Number.Uint64()] = overlayHeader{header, task}
+	}
+	v.lock.Unlock()
+
+	abort, results := v.chain.Engine().VerifyHeaders(&headerView{v, task}, headers, seals)
+	go func() {
+		defer close(task.done)
+		defer close(abort)
+
+		for i, header := range headers {
+			// If the header is a banned one, straight out abort
+			if core.BadHashes[header.Hash()] {
+				task.failed, task.err = i, core.ErrBlacklistedHash
+				return
+			}
+			// Otherwise wait for the header checks and ensure they pass
+			select {
+			case err := <-results:
+				if err != nil {
+					task.failed, task.err = i, err
+					return
+				}
+			case <-task.quit:
+				return
+			}
+		}
+	}()
+	return task
+}
+
+// trust adds a header to the verifier's overlay without verifying it, so that
+// the batches following it can be verified before it's in the local chain.
+func (v *headerVerifier) trust(header *types.Header) {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+
+	v.hashes[header.Hash()] = overlayHeader{header: header}
+	v.numbers[header.Number.Uint64()] = overlayHeader{header: header}
+}
+
+// release drops the headers of a batch from the verifier's overlay. It's meant
+// to be called after the batch was inserted into the local chain, or if it was
+// abandoned, in which case any pending verification is aborted.
+func (v *headerVerifier) release(task *headerTask) {
+	select {
+	case <-task.quit:
+	default:
+		close(task.quit)
+	}
+	v.lock.Lock()
+	defer v.lock.Unlock()
+
+	for _, header := range task.headers {
+		hash, number := header.Hash(), header.Number.Uint64()
+		if v.hashes[hash].task == task {
+			delete(v.hashes, hash)
+		}
+		if v.numbers[number].task == task {
+			delete(v.numbers, number)
+		}
+	}
+}
+
+// headerView is the chain a single batch is verified against: the local chain
+// overlaid with the headers of all the other batches in flight. The batch's own
+// headers are hidden, otherwise the consensus engine would skip them as known.
+//
+// The view implements consensus.ChainReader.
+type headerView struct {
+	verifier *headerVerifier
+	task     *headerTask
+}
+
+// Config retrieves the chain configuration of the local chain.
+func (view *headerView) Config() *params.ChainConfig {
+	return view.verifier.chain.Config()
+}
+
+// CurrentHeader retrieves the head header of the local chain.
+func (view *headerView) CurrentHeader() *types.Header {
+	return view.verifier.chain.CurrentHeader()
+}
+
+// GetHeader retrieves a header by hash and number, either from the other batches
+// in flight or from the local chain.
+func (view *headerView) GetHeader(hash common.Hash, number uint64) *types.Header {
+	view.verifier.lock.RLock()
+	overlay := view.verifier.hashes[hash]
+	view.verifier.lock.RUnlock()
+
+	if overlay.header != nil && overlay.task != view.task {
+		return overlay.header
+	}
+	return view.verifier.chain.GetHeader(hash, number)
+}
+
+// GetHeaderByNumber retrieves a header by number, either from the other batches
+// in flight or from the local chain.
+func (view *headerView) GetHeaderByNumber(number uint64) *types.Header {
+	view.verifier.lock.RLock()
+	overlay := view.verifier.numbers[number]
+	view.verifier.lock.RUnlock()
+
+	if overlay.header != nil && overlay.task != view.task {
+		return overlay.header
+	}
+	return view.verifier.chain.GetHeaderByNumber(number)
+}
+
+// GetHeaderByHash retrieves a header by hash, either from the other batches in
+// flight or from the local chain.
+func (view *headerView) GetHeaderByHash(hash common.Hash) *types.Header {
+	view.verifier.lock.RLock()
+	overlay := view.verifier.hashes[hash]
+	view.verifier.lock.RUnlock()
+
+	if overlay.header != nil && overlay.task != view.task {
+		return overlay.header
+	}
+	return view.verifier.chain.GetHeaderByHash(hash)
+}
+
+// GetBlock is only needed to verify uncles, which header verification doesn't
+// do, hence no blocks are ever available.
+func (view *headerView) GetBlock(hash common.Hash, number uint64) *types.Block {
+	return nil
+}
+
+// headerSeals picks which headers of a batch to verify the seals of, randomly
+// selecting one out of every checkFreq, along with the last one to avoid junk.
+func headerSeals(count int, checkFreq int) []bool {
+	if count == 0 {
+		return nil
+	}
+	seals := make([]bool, count)
+	for i := 0; i < count/checkFreq; i++ {
+		index := i*checkFreq + rand.Intn(checkFreq)
+		if index >= count {
+			index = count - 1
+		}
+		seals[index] = true
+	}
+	seals[count-1] = true
+	return seals
+}
@@ -0,0 +1,60 @@
+// Copyright 2018 The go-wiseplat Authors
+// This file is part of the go-wiseplat library.
+//
+// The go-wiseplat library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-wiseplat library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-wiseplat library. If not, see <http://www.gnu.org/licenses/>.
+
+package wsh
+
+import (
+	"github.com/wiseplat/go-wiseplat/core/forkid"
+	"github.com/wiseplat/go-wiseplat/p2p/enr"
+	"github.com/wiseplat/go-wiseplat/rlp"
+)
+
+// enrEntry is the "wsh" entry of the node record, advertising the network
+// served by the node and the forks its chain has passed.
+type enrEntry struct {
+	NetworkId uint64
+	ForkID    forkid.ID
+
+	// Ignore additional fields (for forward compatibility).
+	Rest []rlp.RawValue `rlp:"tail"`
+}
+
+// ENRKey implements enr.Entry.
+func (e enrEntry) ENRKey() string {
+	return "wsh"
+}
+
+// enrEntry creates the node record entry of the local node.
+func (pm *ProtocolManager) enrEntry() *enrEntry {
+	return &enrEntry{
+		NetworkId: pm.networkId,
+		ForkID:    forkid.NewID(pm.blockchain),
+	}
+}
+
+// filterRecord checks whether a node serves the same network as the local node
+// and whether its fork ID is compatible with the local chain. Nodes without a
+// wsh entry in their record are accepted.
+func (pm *ProtocolManager) filterRecord(r *enr.Record) bool {
+	var entry enrEntry
+	if err := r.Load(&entry); err != nil {
+		return enr.IsNotFound(err)
+	}
+	if entry.NetworkId != pm.networkId {
+		return false
+	}
+	return pm.forkFilter(entry.ForkID) == nil
+}
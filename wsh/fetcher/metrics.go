@@ -40,4 +40,9 @@ var (
 	headerFilterOutMeter = metrics.NewMeter("wsh/fetcher/filter/headers/out")
 	bodyFilterInMeter    = metrics.NewMeter("wsh/fetcher/filter/bodies/in")
 	bodyFilterOutMeter   = metrics.NewMeter("wsh/fetcher/filter/bodies/out")
+
+	txAnnounceInMeter     = metrics.NewMeter("wsh/fetcher/tx/announces/in")
+	txAnnounceDOSMeter    = metrics.NewMeter("wsh/fetcher/tx/announces/dos")
+	txRequestOutMeter     = metrics.NewMeter("wsh/fetcher/tx/requests/out")
+	txRequestTimeoutMeter = metrics.NewMeter("wsh/fetcher/tx/requests/timeout")
 )
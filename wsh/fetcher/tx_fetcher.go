@@ -0,0 +1,381 @@
+// Copyright 2018 The go-wiseplat Authors
+// This file is part of the go-wiseplat library.
+//
+// The go-wiseplat library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-wiseplat library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-wiseplat library. If not, see <http://www.gnu.org/licenses/>.
+
+package fetcher
+
+import (
+	"time"
+
+	"github.com/wiseplat/go-wiseplat/common"
+	"github.com/wiseplat/go-wiseplat/core/types"
+	"github.com/wiseplat/go-wiseplat/log"
+)
+
+const (
+	txArriveTimeout = 500 * time.Millisecond // Time allowance before an announced transaction is explicitly requested
+	txGatherSlack   = 100 * time.Millisecond // Interval used to collate almost-expired announces with fetches
+	txFetchTimeout  = 5 * time.Second        // Maximum allotted time to return an explicitly requested transaction
+	txAnnounceLimit = 4096                   // Maximum number of unique transactions a peer may have announced
+	txFetchLimit    = 256                    // Maximum number of transactions requested from a peer at once
+)
+
+// txKnownFn is a callback type for checking whether a transaction is already
+// known locally.
+type txKnownFn func(common.Hash) bool
+
+// txAddFn is a callback type for adding a batch of transactions to the local pool.
+type txAddFn func([]*types.Transaction) []error
+
+// txRequesterFn is a callback type for sending a transaction retrieval request.
+type txRequesterFn func([]common.Hash) error
+
+// txAnnounce is the hash notification of the availability of a batch of new
+// transactions in the network.
+type txAnnounce struct {
+	origin   string        // Identifier of the peer originating the notification
+	hashes   []common.Hash // Hashes of the transactions being announced
+	time     time.Time     // Timestamp of the announcement
+	fetchTxs txRequesterFn // Fetcher function to retrieve the announced transactions
+}
+
+// txDelivery is the notification of transactions arriving from a peer, either
+// broadcast or as the reply to an explicit request.
+type txDelivery struct {
+	origin string        // Identifier of the peer delivering the transactions
+	hashes []common.Hash // Hashes of the delivered transactions
+	direct bool          // Whether the delivery is the reply to a request
+}
+
+// txRequest is a pending transaction retrieval from a peer.
+type txRequest struct {
+	hashes []common.Hash // Transactions requested from the peer
+	time   time.Time     // Timestamp of the request
+}
+
+// TxFetcher is responsible for retrieving transactions announced by peers which
+// only send out hashes. Transactions are requested after a short delay if they
+// are not broadcast in the meantime, each of them from a single announcer at a
+// time. Peers failing to deliver are skipped in favour of other announcers.
+type TxFetcher struct {
+	// Various event channels
+	notify  chan *txAnnounce
+	deliver chan *txDelivery
+	drop    chan string
+	quit    chan struct{}
+
+	// Announce states
+	announced map[common.Hash]map[string]txRequesterFn // Announcers of unknown transactions
+	announces map[string]map[common.Hash]struct{}      // Per peer announced transactions to prevent memory exhaustion
+	waiting   map[common.Hash]time.Time                // Transactions scheduled for fetching, by scheduled time
+	fetching  map[common.Hash]string                   // Transactions currently fetching, by requested peer
+	requests  map[string]*txRequest                    // Pending requests, at most one per peer
+
+	// Callbacks
+	hasTx  txKnownFn // Checks whether a transaction is already in the local pool
+	addTxs txAddFn   // Injects a batch of transactions into the local pool
+
+	// Testing hooks
+	fetchingHook func(string, []common.Hash) // Method to call upon starting a transaction fetch
+}
+
+// NewTxFetcher creates a transaction fetcher to retrieve transactions based on
+// hash announcements.
+func NewTxFetcher(hasTx txKnownFn, addTxs txAddFn) *TxFetcher {
+	return &TxFetcher{
+		notify:    make(chan *txAnnounce),
+		deliver:   make(chan *txDelivery),
+		drop:      make(chan string),
+		quit:      make(chan struct{}),
+		announced: make(map[common.Hash]map[string]txRequesterFn),
+		announces: make(map[string]map[common.Hash]struct{}),
+		waiting:   make(map[common.Hash]time.Time),
+		fetching:  make(map[common.Hash]string),
+		requests:  make(map[string]*txRequest),
+		hasTx:     hasTx,
+		addTxs:    addTxs,
+	}
+}
+
+// Start boots up the announcement based transaction retrieval.
+func (f *TxFetcher) Start() {
+	go f.loop()
+}
+
+// Stop terminates the announcement based transaction retrieval, canceling all
+// pending operations.
+func (f *TxFetcher) Stop() {
+	close(f.quit)
+}
+
+// Notify announces the fetcher of the potential availability of a batch of new
+// transactions in the network.
+func (f *TxFetcher) Notify(peer string, hashes []common.Hash, time time.Time, fetchTxs txRequesterFn) error {
+	announce := &txAnnounce{
+		origin:   peer,
+		hashes:   hashes,
+		time:     time,
+		fetchTxs: fetchTxs,
+	}
+	select {
+	case f.notify <- announce:
+		return nil
+	case <-f.quit:
+		return errTerminated
+	}
+}
+
+// Enqueue imports a batch of transactions received from a peer into the local
+// pool, and marks them as no longer needing retrieval. Direct deliveries are the
+// replies to requests of the fetcher, requested transactions missing from them
+// are assumed to be unavailable at the peer.
+func (f *TxFetcher) Enqueue(peer string, txs []*types.Transaction, direct bool) error {
+	f.addTxs(txs)
+
+	hashes := make([]common.Hash, len(txs))
+	for i, tx := range txs {
+		hashes[i] = tx.Hash()
+	}
+	select {
+	case f.deliver <- &txDelivery{origin: peer, hashes: hashes, direct: direct}:
+		return nil
+	case <-f.quit:
+		return errTerminated
+	}
+}
+
+// Drop removes all announcements of a peer, rescheduling the retrieval of the
+// transactions it was asked for from other announcers.
+func (f *TxFetcher) Drop(peer string) error {
+	select {
+	case f.drop <- peer:
+		return nil
+	case <-f.quit:
+		return errTerminated
+	}
+}
+
+// loop is the main transaction fetcher loop, checking and processing various
+// notification events.
+func (f *TxFetcher) loop() {
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-f.quit:
+			return
+
+		case announce := <-f.notify:
+			txAnnounceInMeter.Mark(int64(len(announce.hashes)))
+			f.announce(announce)
+
+		case delivery := <-f.deliver:
+			for _, hash := range delivery.hashes {
+				f.forgetTx(hash)
+			}
+			if req := f.requests[delivery.origin]; delivery.direct && req != nil {
+				// Anything requested but not delivered is unavailable at the peer
+				delete(f.requests, delivery.origin)
+				for _, hash := range req.hashes {
+					if f.fetching[hash] == delivery.origin {
+						f.reschedule(hash, delivery.origin)
+					}
+				}
+			}
+
+		case peer := <-f.drop:
+			if req := f.requests[peer]; req != nil {
+				delete(f.requests, peer)
+				for _, hash := range req.hashes {
+					if f.fetching[hash] == peer {
+						f.reschedule(hash, peer)
+					}
+				}
+			}
+			for hash := range f.announces[peer] {
+				f.forgetAnnounce(hash, peer)
+			}
+
+		case <-timer.C:
+			now := time.Now()
+
+			// Give up on requests taking too long, retrying with other announcers
+			for peer, req := range f.requests {
+				if now.Sub(req.time) < txFetchTimeout {
+					continue
+				}
+				log.Debug("Transaction request timed out", "peer", peer, "txs", len(req.hashes))
+				txRequestTimeoutMeter.Mark(1)
+
+				delete(f.requests, peer)
+				for _, hash := range req.hashes {
+					if f.fetching[hash] == peer {
+						f.reschedule(hash, peer)
+					}
+				}
+			}
+			f.schedule(now)
+		}
+		// Wake up for the next scheduled retrieval or request timeout
+		timer.Reset(f.nextEvent(time.Now()))
+	}
+}
+
+// announce records the transactions announced by a peer, scheduling the unknown
+// ones for retrieval.
+func (f *TxFetcher) announce(announce *txAnnounce) {
+	known := f.announces[announce.origin]
+	if known == nil {
+		known = make(map[common.Hash]struct{})
+		f.announces[announce.origin] = known
+	}
+	for _, hash := range announce.hashes {
+		if _, ok := known[hash]; ok || f.hasTx(hash) {
+			continue
+		}
+		if len(known) >= txAnnounceLimit {
+			log.Debug("Peer exceeded outstanding transaction announces", "peer", announce.origin, "limit", txAnnounceLimit)
+			txAnnounceDOSMeter.Mark(1)
+			break
+		}
+		known[hash] = struct{}{}
+
+		announcers := f.announced[hash]
+		if announcers == nil {
+			announcers = make(map[string]txRequesterFn)
+			f.announced[hash] = announcers
+		}
+		announcers[announce.origin] = announce.fetchTxs
+
+		if _, ok := f.fetching[hash]; !ok {
+			if _, ok := f.waiting[hash]; !ok {
+				f.waiting[hash] = announce.time.Add(txArriveTimeout)
+			}
+		}
+	}
+}
+
+// schedule requests the transactions due for retrieval, assigning each one to
+// an announcer without a pending request.
+func (f *TxFetcher) schedule(now time.Time) {
+	var (
+		batches = make(map[string][]common.Hash)
+		fetches = make(map[string]txRequesterFn)
+	)
+	for hash, due := range f.waiting {
+		if due.After(now.Add(txGatherSlack)) {
+			continue
+		}
+		// Prefer announcers already picked in this round to batch up requests
+		var (
+			pick     string
+			fetchTxs txRequesterFn
+		)
+		for peer, fetch := range f.announced[hash] {
+			if f.requests[peer] != nil || len(batches[peer]) >= txFetchLimit {
+				continue
+			}
+			if pick == "" || (len(batches[peer]) > 0 && len(batches[pick]) == 0) {
+				pick, fetchTxs = peer, fetch
+			}
+		}
+		if pick != "" {
+			batches[pick] = append(batches[pick], hash)
+			fetches[pick] = fetchTxs
+		}
+	}
+	for peer, hashes := range batches {
+		f.requests[peer] = &txRequest{hashes: hashes, time: now}
+		for _, hash := range hashes {
+			delete(f.waiting, hash)
+			f.fetching[hash] = peer
+		}
+		if f.fetchingHook != nil {
+			f.fetchingHook(peer, hashes)
+		}
+		log.Trace("Fetching scheduled transactions", "peer", peer, "txs", len(hashes))
+		txRequestOutMeter.Mark(int64(len(hashes)))
+
+		go func(fetchTxs txRequesterFn, hashes []common.Hash) {
+			// Failed requests are retried from other announcers on timeout
+			fetchTxs(hashes)
+		}(fetches[peer], hashes)
+	}
+}
+
+// nextEvent returns the time until the next scheduled retrieval or request
+// timeout. Retrievals blocked by busy announcers are retried periodically.
+func (f *TxFetcher) nextEvent(now time.Time) time.Duration {
+	next := txFetchTimeout
+	for _, due := range f.waiting {
+		if wait := due.Sub(now); wait < next {
+			next = wait
+		}
+	}
+	for _, req := range f.requests {
+		if wait := req.time.Add(txFetchTimeout).Sub(now); wait < next {
+			next = wait
+		}
+	}
+	if next < txGatherSlack {
+		next = txGatherSlack
+	}
+	return next
+}
+
+// reschedule removes the announcement of a transaction by a peer that failed to
+// deliver it, and schedules its immediate retrieval from another announcer.
+func (f *TxFetcher) reschedule(hash common.Hash, peer string) {
+	delete(f.fetching, hash)
+	f.forgetAnnounce(hash, peer)
+	if _, ok := f.announced[hash]; ok {
+		f.waiting[hash] = time.Now()
+	}
+}
+
+// forgetAnnounce removes the announcement of a transaction by a single peer,
+// dropping the transaction altogether if no announcer remains.
+func (f *TxFetcher) forgetAnnounce(hash common.Hash, peer string) {
+	if known := f.announces[peer]; known != nil {
+		delete(known, hash)
+		if len(known) == 0 {
+			delete(f.announces, peer)
+		}
+	}
+	if announcers := f.announced[hash]; announcers != nil {
+		delete(announcers, peer)
+		if len(announcers) == 0 {
+			delete(f.announced, hash)
+			delete(f.waiting, hash)
+			delete(f.fetching, hash)
+		}
+	}
+}
+
+// forgetTx removes all traces of a transaction from the fetcher's internal state.
+func (f *TxFetcher) forgetTx(hash common.Hash) {
+	for peer := range f.announced[hash] {
+		if known := f.announces[peer]; known != nil {
+			delete(known, hash)
+			if len(known) == 0 {
+				delete(f.announces, peer)
+			}
+		}
+	}
+	delete(f.announced, hash)
+	delete(f.waiting, hash)
+	delete(f.fetching, hash)
+}
@@ -0,0 +1,289 @@
+// Copyright 2018 The go-wiseplat Authors
+// This file is part of the go-wiseplat library.
+//
+// The go-wiseplat library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-wiseplat library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-wiseplat library. If not, see <http://www.gnu.org/licenses/>.
+
+package fetcher
+
+import (
+	"math/big"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/wiseplat/go-wiseplat/common"
+	"github.com/wiseplat/go-wiseplat/core/types"
+)
+
+// makeTxs creates n distinct dummy transactions.
+func makeTxs(n int, seed byte) []*types.Transaction {
+	txs := make([]*types.Transaction, n)
+	for i := range txs {
+		txs[i] = types.NewTransaction(uint64(i), common.Address{seed}, big.NewInt(0), big.NewInt(0), big.NewInt(0), nil)
+	}
+	return txs
+}
+
+func txHashes(txs []*types.Transaction) []common.Hash {
+	hashes := make([]common.Hash, len(txs))
+	for i, tx := range txs {
+		hashes[i] = tx.Hash()
+	}
+	return hashes
+}
+
+// txFetcherTester is a test simulator for mocking out the local transaction pool.
+type txFetcherTester struct {
+	fetcher *TxFetcher
+
+	pool map[common.Hash]*types.Transaction // Transactions in the simulated pool
+	lock sync.RWMutex
+}
+
+// newTxTester creates a new transaction fetcher test mocker, reporting the peer
+// and hashes of each started fetch on the returned channel.
+func newTxTester() (*txFetcherTester, chan *txRequestEvent) {
+	tester := &txFetcherTester{pool: make(map[common.Hash]*types.Transaction)}
+	tester.fetcher = NewTxFetcher(tester.hasTx, tester.addTxs)
+
+	fetching := make(chan *txRequestEvent, 16)
+	tester.fetcher.fetchingHook = func(peer string, hashes []common.Hash) {
+		fetching <- &txRequestEvent{peer, hashes}
+	}
+	tester.fetcher.Start()
+	return tester, fetching
+}
+
+type txRequestEvent struct {
+	peer   string
+	hashes []common.Hash
+}
+
+// hasTx checks whether a transaction is in the simulated pool.
+func (f *txFetcherTester) hasTx(hash common.Hash) bool {
+	f.lock.RLock()
+	defer f.lock.RUnlock()
+
+	return f.pool[hash] != nil
+}
+
+// addTxs injects a batch of transactions into the simulated pool.
+func (f *txFetcherTester) addTxs(txs []*types.Transaction) []error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	for _, tx := range txs {
+		f.pool[tx.Hash()] = tx
+	}
+	return make([]error, len(txs))
+}
+
+// makeTxFetcher retrieves a transaction fetcher associated with a simulated peer.
+// The peer delivers the requested transactions it holds.
+func (f *txFetcherTester) makeTxFetcher(peer string, txs []*types.Transaction) txRequesterFn {
+	known := make(map[common.Hash]*types.Transaction)
+	for _, tx := range txs {
+		known[tx.Hash()] = tx
+	}
+	return func(hashes []common.Hash) error {
+		var delivery []*types.Transaction
+		for _, hash := range hashes {
+			if tx := known[hash]; tx != nil {
+				delivery = append(delivery, tx)
+			}
+		}
+		go f.fetcher.Enqueue(peer, delivery, true)
+		return nil
+	}
+}
+
+// makeSilentTxFetcher retrieves a transaction fetcher of a simulated peer that
+// never answers requests.
+func (f *txFetcherTester) makeSilentTxFetcher() txRequesterFn {
+	return func(hashes []common.Hash) error { return nil }
+}
+
+// verifyTxFetch checks that a fetch of the given transactions from the given
+// peer is started.
+func verifyTxFetch(t *testing.T, fetching chan *txRequestEvent, peer string, hashes []common.Hash) {
+	select {
+	case req := <-fetching:
+		if req.peer != peer {
+			t.Fatalf("fetch from wrong peer: have %s, want %s", req.peer, peer)
+		}
+		want := make(map[common.Hash]bool)
+		for _, hash := range hashes {
+			want[hash] = true
+		}
+		if len(req.hashes) != len(want) {
+			t.Fatalf("fetched transaction count mismatch: have %d, want %d", len(req.hashes), len(want))
+		}
+		for _, hash := range req.hashes {
+			if !want[hash] {
+				t.Fatalf("fetched unexpected transaction %x", hash)
+			}
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("fetch timeout")
+	}
+}
+
+// verifyNoTxFetch checks that no fetch is started within the arrival timeout.
+func verifyNoTxFetch(t *testing.T, fetching chan *txRequestEvent) {
+	select {
+	case req := <-fetching:
+		t.Fatalf("unexpected fetch from %s: %d txs", req.peer, len(req.hashes))
+	case <-time.After(txArriveTimeout + 2*txGatherSlack):
+	}
+}
+
+// verifyPooled checks that the transactions have been added to the pool.
+func verifyPooled(t *testing.T, tester *txFetcherTester, txs []*types.Transaction) {
+	deadline := time.Now().Add(time.Second)
+	for _, tx := range txs {
+		for !tester.hasTx(tx.Hash()) {
+			if time.Now().After(deadline) {
+				t.Fatalf("transaction %x not imported", tx.Hash())
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+}
+
+// Tests that announced transactions are retrieved after the arrival timeout.
+func TestTxFetcherRetrieval(t *testing.T) {
+	tester, fetching := newTxTester()
+	defer tester.fetcher.Stop()
+
+	txs := makeTxs(10, 1)
+	tester.fetcher.Notify("A", txHashes(txs), time.Now(), tester.makeTxFetcher("A", txs))
+
+	verifyTxFetch(t, fetching, "A", txHashes(txs))
+	verifyPooled(t, tester, txs)
+}
+
+// Tests that transactions broadcast before the arrival timeout are not requested.
+func TestTxFetcherBroadcastArrival(t *testing.T) {
+	tester, fetching := newTxTester()
+	defer tester.fetcher.Stop()
+
+	txs := makeTxs(10, 1)
+	tester.fetcher.Notify("A", txHashes(txs), time.Now(), tester.makeTxFetcher("A", txs))
+	tester.fetcher.Enqueue("B", txs[:5], false)
+
+	verifyTxFetch(t, fetching, "A", txHashes(txs[5:]))
+	verifyPooled(t, tester, txs)
+}
+
+// Tests that known transactions are not requested at all.
+func TestTxFetcherKnownTransactions(t *testing.T) {
+	tester, fetching := newTxTester()
+	defer tester.fetcher.Stop()
+
+	txs := makeTxs(10, 1)
+	tester.addTxs(txs)
+	tester.fetcher.Notify("A", txHashes(txs), time.Now(), tester.makeTxFetcher("A", txs))
+
+	verifyNoTxFetch(t, fetching)
+}
+
+// Tests that transactions announced by multiple peers are only requested once.
+func TestTxFetcherDeduplication(t *testing.T) {
+	tester, fetching := newTxTester()
+	defer tester.fetcher.Stop()
+
+	txs := makeTxs(10, 1)
+	tester.fetcher.Notify("A", txHashes(txs), time.Now(), tester.makeTxFetcher("A", txs))
+	tester.fetcher.Notify("B", txHashes(txs), time.Now(), tester.makeTxFetcher("B", txs))
+
+	select {
+	case req := <-fetching:
+		if len(req.hashes) != len(txs) {
+			t.Fatalf("fetched transaction count mismatch: have %d, want %d", len(req.hashes), len(txs))
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("fetch timeout")
+	}
+	verifyPooled(t, tester, txs)
+	verifyNoTxFetch(t, fetching)
+}
+
+// Tests that transactions missing from a reply are requested from another
+// announcer.
+func TestTxFetcherMissingDelivery(t *testing.T) {
+	tester, fetching := newTxTester()
+	defer tester.fetcher.Stop()
+
+	txs := makeTxs(10, 1)
+	tester.fetcher.Notify("A", txHashes(txs), time.Now(), tester.makeTxFetcher("A", txs[:5]))
+	verifyTxFetch(t, fetching, "A", txHashes(txs))
+
+	tester.fetcher.Notify("B", txHashes(txs), time.Now(), tester.makeTxFetcher("B", txs))
+	verifyTxFetch(t, fetching, "B", txHashes(txs[5:]))
+	verifyPooled(t, tester, txs)
+}
+
+// Tests that the transactions requested from a dropped peer are requested from
+// another announcer.
+func TestTxFetcherDrop(t *testing.T) {
+	tester, fetching := newTxTester()
+	defer tester.fetcher.Stop()
+
+	txs := makeTxs(10, 1)
+	tester.fetcher.Notify("A", txHashes(txs), time.Now(), tester.makeSilentTxFetcher())
+	verifyTxFetch(t, fetching, "A", txHashes(txs))
+	tester.fetcher.Notify("B", txHashes(txs), time.Now(), tester.makeTxFetcher("B", txs))
+
+	tester.fetcher.Drop("A")
+	verifyTxFetch(t, fetching, "B", txHashes(txs))
+	verifyPooled(t, tester, txs)
+}
+
+// Tests that requests not answered in time are retried from another announcer.
+func TestTxFetcherTimeout(t *testing.T) {
+	tester, fetching := newTxTester()
+	defer tester.fetcher.Stop()
+
+	txs := makeTxs(10, 1)
+	tester.fetcher.Notify("A", txHashes(txs), time.Now(), tester.makeSilentTxFetcher())
+	verifyTxFetch(t, fetching, "A", txHashes(txs))
+	tester.fetcher.Notify("B", txHashes(txs), time.Now(), tester.makeTxFetcher("B", txs))
+
+	select {
+	case req := <-fetching:
+		t.Fatalf("retried from %s before timeout", req.peer)
+	case <-time.After(txFetchTimeout - time.Second):
+	}
+	time.Sleep(time.Second)
+	verifyTxFetch(t, fetching, "B", txHashes(txs))
+	verifyPooled(t, tester, txs)
+}
+
+// Tests that a peer can't make the fetcher track an unbounded number of
+// transactions.
+func TestTxFetcherAnnounceLimit(t *testing.T) {
+	fetcher := NewTxFetcher(func(common.Hash) bool { return false }, nil)
+
+	hashes := make([]common.Hash, txAnnounceLimit+10)
+	for i := range hashes {
+		hashes[i][0], hashes[i][1] = byte(i), byte(i>>8)
+	}
+	fetcher.announce(&txAnnounce{origin: "A", hashes: hashes, time: time.Now()})
+	if n := len(fetcher.announces["A"]); n != txAnnounceLimit {
+		t.Fatalf("announced transaction count mismatch: have %d, want %d", n, txAnnounceLimit)
+	}
+	if n := len(fetcher.waiting); n != txAnnounceLimit {
+		t.Fatalf("scheduled transaction count mismatch: have %d, want %d", n, txAnnounceLimit)
+	}
+}
@@ -0,0 +1,230 @@
+// Copyright 2018 The go-wiseplat Authors
+// This file is part of the go-wiseplat library.
+//
+// The go-wiseplat library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-wiseplat library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-wiseplat library. If not, see <http://www.gnu.org/licenses/>.
+
+// The light client benchmarks live in an external test package, as les depends
+// on the filters package.
+package filters_test
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/wiseplat/go-wiseplat/common"
+	"github.com/wiseplat/go-wiseplat/core"
+	"github.com/wiseplat/go-wiseplat/core/types"
+	"github.com/wiseplat/go-wiseplat/crypto"
+	"github.com/wiseplat/go-wiseplat/les"
+	"github.com/wiseplat/go-wiseplat/light"
+	"github.com/wiseplat/go-wiseplat/node"
+	"github.com/wiseplat/go-wiseplat/p2p"
+	"github.com/wiseplat/go-wiseplat/params"
+	"github.com/wiseplat/go-wiseplat/wsh"
+	"github.com/wiseplat/go-wiseplat/wsh/downloader"
+	"github.com/wiseplat/go-wiseplat/wsh/filters"
+	"github.com/wiseplat/go-wiseplat/wshdb"
+)
+
+// benchLightSections is the number of BloomTrie sections served to the light
+// client, enough for the retrievals to be split across parallel requests.
+const benchLightSections = 8
+
+// benchLightLogEvery is the block interval of the log emitting transactions in
+// the benchmark chain.
+const benchLightLogEvery = 16
+
+var (
+	benchLightKey, _ = crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+	benchLightBank   = crypto.PubkeyToAddress(benchLightKey.PublicKey)
+
+	// benchLightEmitter logs its call data as the only topic:
+	// PUSH1 0 CALLDATALOAD PUSH1 0 PUSH1 0 LOG1 STOP
+	benchLightEmitter     = common.HexToAddress("0x1000")
+	benchLightEmitterCode = common.FromHex("0x60003560006000a100")
+)
+
+// BenchmarkLightBloomBits measures filtering logs on a light client, with the
+// bloom bits retrieved from an in-process les server via BloomTrie proofs. The
+// client starts from a checkpoint, so it has no local bloom bits and the
+// matcher has to fetch every vector through the server.
+func BenchmarkLightBloomBits(b *testing.B) {
+	server, client, lwsh := newLightBloomBench(b, benchLightSections)
+	defer server.Stop()
+	defer client.Stop()
+
+	for _, sections := range []uint64{1, benchLightSections / 2, benchLightSections} {
+		b.Run(fmt.Sprintf("sections-%d", sections), func(b *testing.B) {
+			end := int64(sections*light.BloomTrieFrequency - 1)
+			for i := 0; i < b.N; i++ {
+				b.StopTimer()
+				clearLightBloomBits(b, lwsh.ApiBackend.ChainDb())
+				b.StartTimer()
+
+				// Every topic is logged exactly once, look for a different one each time
+				topic := benchLightTopic(i % int((end-1)/benchLightLogEvery+1))
+				filter := filters.New(lwsh.ApiBackend, 0, end, nil, [][]common.Hash{{topic}})
+
+				ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+				logs, err := filter.Logs(ctx)
+				cancel()
+				if err != nil {
+					b.Fatalf("filter error: %v", err)
+				}
+				if len(logs) != 1 {
+					b.Fatalf("log count mismatch: have %d, want 1", len(logs))
+				}
+			}
+		})
+	}
+}
+
+// benchLightTopic returns the topic logged by the n-th transaction of the
+// benchmark chain.
+func benchLightTopic(n int) common.Hash {
+	return common.BigToHash(big.NewInt(int64(n) + 1))
+}
+
+// newLightBloomBench starts a les server with a chain covering the given number
+// of BloomTrie sections, and a light client connected to it, trusting the last
+// section as a checkpoint.
+func newLightBloomBench(b *testing.B, sections uint64) (*node.Node, *node.Node, *les.LightWiseplat) {
+	gspec := &core.Genesis{
+		Config: params.TestChainConfig,
+		Alloc: core.GenesisAlloc{
+			benchLightBank:    {Balance: big.NewInt(params.Wise)},
+			benchLightEmitter: {Balance: new(big.Int), Code: benchLightEmitterCode},
+		},
+	}
+	db, _ := wshdb.NewMemDatabase()
+	signer := types.NewEIP155Signer(gspec.Config.ChainId)
+	blocks, _ := core.GenerateChain(gspec.Config, gspec.MustCommit(db), db, int(sections*light.BloomTrieFrequency+light.HelperTrieProcessConfirmations+1), func(i int, block *core.BlockGen) {
+		if i%benchLightLogEvery != 0 {
+			return
+		}
+		topic := benchLightTopic(i / benchLightLogEvery)
+		tx, _ := types.SignTx(types.NewTransaction(block.TxNonce(benchLightBank), benchLightEmitter, new(big.Int), big.NewInt(100000), new(big.Int), topic[:]), signer, benchLightKey)
+		block.AddTx(tx)
+	})
+
+	config := wsh.DefaultConfig
+	config.Genesis = gspec
+	config.PowFake = true
+	config.LightServ = 50
+
+	// Start the server and wait until it indexed all the sections
+	server := newLightBenchNode(b, func(ctx *node.ServiceContext) (node.Service, error) {
+		fullNode, err := wsh.New(ctx, &config)
+		if err != nil {
+			return nil, err
+		}
+		ls, err := les.NewLesServer(fullNode, &config)
+		if err != nil {
+			return nil, err
+		}
+		fullNode.AddLesServer(ls)
+		return fullNode, nil
+	})
+	var fullNode *wsh.Wiseplat
+	if err := server.Service(&fullNode); err != nil {
+		b.Fatalf("failed to retrieve full node: %v", err)
+	}
+	if _, err := fullNode.BlockChain().InsertChain(blocks); err != nil {
+		server.Stop()
+		b.Fatalf("failed to import chain: %v", err)
+	}
+	checkpoint := &params.TrustedCheckpoint{
+		Name:         "bench",
+		SectionIndex: sections - 1,
+		SectionHead:  fullNode.BlockChain().GetHeaderByNumber(sections*light.BloomTrieFrequency - 1).Hash(),
+	}
+	for deadline := time.Now().Add(time.Minute); ; {
+		checkpoint.CHTRoot = light.GetChtV2Root(fullNode.ChainDb(), checkpoint.SectionIndex, checkpoint.SectionHead)
+		checkpoint.BloomRoot = light.GetBloomTrieRoot(fullNode.ChainDb(), checkpoint.SectionIndex, checkpoint.SectionHead)
+		if checkpoint.CHTRoot != (common.Hash{}) && checkpoint.BloomRoot != (common.Hash{}) {
+			break
+		}
+		if time.Now().After(deadline) {
+			server.Stop()
+			b.Fatalf("server failed to index %d sections", sections)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	// Start the client from the checkpoint and wait until it synced with the server
+	clientConfig := config
+	clientConfig.SyncMode = downloader.LightSync
+	clientConfig.LightServ = 0
+
+	client := newLightBenchNode(b, func(ctx *node.ServiceContext) (node.Service, error) {
+		return les.New(ctx, &clientConfig)
+	})
+	var lwsh *les.LightWiseplat
+	if err := client.Service(&lwsh); err != nil {
+		b.Fatalf("failed to retrieve light client: %v", err)
+	}
+	lwsh.BlockChain().AddTrustedCheckpoint(checkpoint)
+	client.Server().AddPeer(server.Server().Self())
+
+	head := fullNode.BlockChain().CurrentHeader().Number.Uint64()
+	for deadline := time.Now().Add(time.Minute); lwsh.BlockChain().CurrentHeader().Number.Uint64() < head; {
+		if time.Now().After(deadline) {
+			server.Stop()
+			client.Stop()
+			b.Fatalf("light client failed to sync: have %d, want %d", lwsh.BlockChain().CurrentHeader().Number, head)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	return server, client, lwsh
+}
+
+// newLightBenchNode starts an in-memory node with the given service, reachable
+// on the loopback interface.
+func newLightBenchNode(b *testing.B, constructor node.ServiceConstructor) *node.Node {
+	stack, err := node.New(&node.Config{
+		Name: "bench",
+		P2P: p2p.Config{
+			ListenAddr:  "127.0.0.1:0",
+			NoDiscovery: true,
+			MaxPeers:    10,
+		},
+	})
+	if err != nil {
+		b.Fatalf("failed to create node: %v", err)
+	}
+	if err := stack.Register(constructor); err != nil {
+		b.Fatalf("failed to register service: %v", err)
+	}
+	if err := stack.Start(); err != nil {
+		b.Fatalf("failed to start node: %v", err)
+	}
+	return stack
+}
+
+// clearLightBloomBits deletes the bloom bit vectors retrieved by earlier runs,
+// so that the next run fetches them from the server again.
+func clearLightBloomBits(b *testing.B, db wshdb.Database) {
+	mdb, ok := db.(*wshdb.MemDatabase)
+	if !ok {
+		b.Fatalf("unexpected light client database %T", db)
+	}
+	for _, key := range mdb.Keys() {
+		// bloom bits keys: 'B' + bit (uint16) + section (uint64) + section head
+		if len(key) == 1+2+8+common.HashLength && key[0] == 'B' {
+			mdb.Delete(key)
+		}
+	}
+}
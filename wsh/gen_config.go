@@ -8,6 +8,7 @@ import (
 	"github.com/wiseplat/go-wiseplat/common"
 	"github.com/wiseplat/go-wiseplat/common/hexutil"
 	"github.com/wiseplat/go-wiseplat/core"
+	"github.com/wiseplat/go-wiseplat/params"
 	"github.com/wiseplat/go-wiseplat/wsh/downloader"
 	"github.com/wiseplat/go-wiseplat/wsh/gasprice"
 )
@@ -17,13 +18,18 @@ func (c Config) MarshalTOML() (interface{}, error) {
 		Genesis                 *core.Genesis `toml:",omitempty"`
 		NetworkId               uint64
 		SyncMode                downloader.SyncMode
-		LightServ               int  `toml:",omitempty"`
-		LightPeers              int  `toml:",omitempty"`
-		MaxPeers                int  `toml:"-"`
-		SkipBcVersionCheck      bool `toml:"-"`
-		DatabaseHandles         int  `toml:"-"`
+		SyncFrom                common.Hash                    `toml:",omitempty"`
+		SyncFromTd              *big.Int                       `toml:",omitempty"`
+		NoBackfill              bool                           `toml:",omitempty"`
+		LightServ               int                            `toml:",omitempty"`
+		LightPeers              int                            `toml:",omitempty"`
+		CheckpointOracle        *params.CheckpointOracleConfig `toml:",omitempty"`
+		ULC                     *ULCConfig                     `toml:",omitempty"`
+		MaxPeers                int                            `toml:"-"`
+		SkipBcVersionCheck      bool                           `toml:"-"`
+		DatabaseHandles         int                            `toml:"-"`
 		DatabaseCache           int
-		Wisebase               common.Address `toml:",omitempty"`
+		Wisebase                common.Address `toml:",omitempty"`
 		MinerThreads            int            `toml:",omitempty"`
 		ExtraData               hexutil.Bytes  `toml:",omitempty"`
 		GasPrice                *big.Int
@@ -45,8 +51,13 @@ func (c Config) MarshalTOML() (interface{}, error) {
 	enc.Genesis = c.Genesis
 	enc.NetworkId = c.NetworkId
 	enc.SyncMode = c.SyncMode
+	enc.SyncFrom = c.SyncFrom
+	enc.SyncFromTd = c.SyncFromTd
+	enc.NoBackfill = c.NoBackfill
 	enc.LightServ = c.LightServ
 	enc.LightPeers = c.LightPeers
+	enc.CheckpointOracle = c.CheckpointOracle
+	enc.ULC = c.ULC
 	enc.SkipBcVersionCheck = c.SkipBcVersionCheck
 	enc.DatabaseHandles = c.DatabaseHandles
 	enc.DatabaseCache = c.DatabaseCache
@@ -75,13 +86,18 @@ func (c *Config) UnmarshalTOML(unmarshal func(interface{}) error) error {
 		Genesis                 *core.Genesis `toml:",omitempty"`
 		NetworkId               *uint64
 		SyncMode                *downloader.SyncMode
-		LightServ               *int  `toml:",omitempty"`
-		LightPeers              *int  `toml:",omitempty"`
-		MaxPeers                *int  `toml:"-"`
-		SkipBcVersionCheck      *bool `toml:"-"`
-		DatabaseHandles         *int  `toml:"-"`
+		SyncFrom                *common.Hash                   `toml:",omitempty"`
+		SyncFromTd              *big.Int                       `toml:",omitempty"`
+		NoBackfill              *bool                          `toml:",omitempty"`
+		LightServ               *int                           `toml:",omitempty"`
+		LightPeers              *int                           `toml:",omitempty"`
+		CheckpointOracle        *params.CheckpointOracleConfig `toml:",omitempty"`
+		ULC                     *ULCConfig                     `toml:",omitempty"`
+		MaxPeers                *int                           `toml:"-"`
+		SkipBcVersionCheck      *bool                          `toml:"-"`
+		DatabaseHandles         *int                           `toml:"-"`
 		DatabaseCache           *int
-		Wisebase               *common.Address `toml:",omitempty"`
+		Wisebase                *common.Address `toml:",omitempty"`
 		MinerThreads            *int            `toml:",omitempty"`
 		ExtraData               hexutil.Bytes   `toml:",omitempty"`
 		GasPrice                *big.Int
@@ -112,12 +128,27 @@ func (c *Config) UnmarshalTOML(unmarshal func(interface{}) error) error {
 	if dec.SyncMode != nil {
 		c.SyncMode = *dec.SyncMode
 	}
+	if dec.SyncFrom != nil {
+		c.SyncFrom = *dec.SyncFrom
+	}
+	if dec.SyncFromTd != nil {
+		c.SyncFromTd = dec.SyncFromTd
+	}
+	if dec.NoBackfill != nil {
+		c.NoBackfill = *dec.NoBackfill
+	}
 	if dec.LightServ != nil {
 		c.LightServ = *dec.LightServ
 	}
 	if dec.LightPeers != nil {
 		c.LightPeers = *dec.LightPeers
 	}
+	if dec.CheckpointOracle != nil {
+		c.CheckpointOracle = dec.CheckpointOracle
+	}
+	if dec.ULC != nil {
+		c.ULC = dec.ULC
+	}
 	if dec.SkipBcVersionCheck != nil {
 		c.SkipBcVersionCheck = *dec.SkipBcVersionCheck
 	}
@@ -30,14 +30,17 @@ import (
 	"github.com/wiseplat/go-wiseplat/consensus"
 	"github.com/wiseplat/go-wiseplat/consensus/misc"
 	"github.com/wiseplat/go-wiseplat/core"
+	"github.com/wiseplat/go-wiseplat/core/forkid"
 	"github.com/wiseplat/go-wiseplat/core/types"
 	"github.com/wiseplat/go-wiseplat/wsh/downloader"
 	"github.com/wiseplat/go-wiseplat/wsh/fetcher"
+	"github.com/wiseplat/go-wiseplat/wsh/snap"
 	"github.com/wiseplat/go-wiseplat/wshdb"
 	"github.com/wiseplat/go-wiseplat/event"
 	"github.com/wiseplat/go-wiseplat/log"
 	"github.com/wiseplat/go-wiseplat/p2p"
 	"github.com/wiseplat/go-wiseplat/p2p/discover"
+	"github.com/wiseplat/go-wiseplat/p2p/enr"
 	"github.com/wiseplat/go-wiseplat/params"
 	"github.com/wiseplat/go-wiseplat/rlp"
 )
@@ -64,9 +67,12 @@ func errResp(code errCode, format string, v ...interface{}) error {
 }
 
 type ProtocolManager struct {
-	networkId uint64
+	networkId  uint64
+	forkFilter forkid.Filter // Fork ID filter, constant across the lifetime of the node
 
 	fastSync  uint32 // Flag whether fast sync is enabled (gets disabled if we already have blocks)
+	beamSync  bool   // Flag whether fast sync should import the blocks after the pivot via beam sync
+	backfill  bool   // Flag whether the blocks preceding a sync checkpoint are retrieved once in sync
 	acceptTxs uint32 // Flag whether we're considered synchronised (enables transaction processing)
 
 	txpool      txPool
@@ -77,6 +83,7 @@ type ProtocolManager struct {
 
 	downloader *downloader.Downloader
 	fetcher    *fetcher.Fetcher
+	txFetcher  *fetcher.TxFetcher
 	peers      *peerSet
 
 	SubProtocols []p2p.Protocol
@@ -103,6 +110,7 @@ func NewProtocolManager(config *params.ChainConfig, mode downloader.SyncMode, ne
 	// Create the protocol manager with the base fields
 	manager := &ProtocolManager{
 		networkId:   networkId,
+		forkFilter:  forkid.NewFilter(blockchain),
 		eventMux:    mux,
 		txpool:      txpool,
 		blockchain:  blockchain,
@@ -115,18 +123,19 @@ func NewProtocolManager(config *params.ChainConfig, mode downloader.SyncMode, ne
 		quitSync:    make(chan struct{}),
 	}
 	// Figure out whether to allow fast sync or not
-	if mode == downloader.FastSync && blockchain.CurrentBlock().NumberU64() > 0 {
+	if (mode == downloader.FastSync || mode == downloader.BeamSync) && blockchain.CurrentBlock().NumberU64() > 0 {
 		log.Warn("Blockchain not empty, fast sync disabled")
 		mode = downloader.FullSync
 	}
-	if mode == downloader.FastSync {
+	if mode == downloader.FastSync || mode == downloader.BeamSync {
 		manager.fastSync = uint32(1)
 	}
+	manager.beamSync = mode == downloader.BeamSync
 	// Initiate a sub-protocol for every implemented version we can handle
 	manager.SubProtocols = make([]p2p.Protocol, 0, len(ProtocolVersions))
 	for i, version := range ProtocolVersions {
 		// Skip protocol version if incompatible with the mode of operation
-		if mode == downloader.FastSync && version < wsh63 {
+		if (mode == downloader.FastSync || mode == downloader.BeamSync) && version < wsh63 {
 			continue
 		}
 		// Compatible; initialise the sub-protocol
@@ -155,6 +164,8 @@ func NewProtocolManager(config *params.ChainConfig, mode downloader.SyncMode, ne
 				}
 				return nil
 			},
+			Attributes: []enr.Entry{manager.enrEntry()},
+			DialFilter: manager.filterRecord,
 		})
 	}
 	if len(manager.SubProtocols) == 0 {
@@ -162,6 +173,14 @@ func NewProtocolManager(config *params.ChainConfig, mode downloader.SyncMode, ne
 	}
 	// Construct the different synchronisation mechanisms
 	manager.downloader = downloader.New(mode, chaindb, manager.eventMux, blockchain, nil, manager.removePeer)
+	if manager.beamSync || manager.downloader.ResumeBeamSync() {
+		// Block processing retrieves any state not yet downloaded from the network,
+		// including after a restart interrupting the beam sync state download
+		blockchain.SetMissingStateHook(manager.downloader.FetchState)
+	}
+
+	// Serve and sync state ranges over the snap protocol running side by side with wsh
+	manager.SubProtocols = append(manager.SubProtocols, snap.NewHandler(chaindb, manager.downloader.SnapSyncer).Protocols()...)
 
 	validator := func(header *types.Header) error {
 		return engine.VerifyHeader(blockchain, header, true)
@@ -180,9 +199,22 @@ func NewProtocolManager(config *params.ChainConfig, mode downloader.SyncMode, ne
 	}
 	manager.fetcher = fetcher.New(blockchain.GetBlockByHash, validator, manager.BroadcastBlock, heighter, inserter, manager.removePeer)
 
+	hasTx := func(hash common.Hash) bool {
+		return txpool.Get(hash) != nil
+	}
+	manager.txFetcher = fetcher.NewTxFetcher(hasTx, txpool.AddRemotes)
+
 	return manager, nil
 }
 
+// setCheckpoint configures a trusted block hash (and optionally its total
+// difficulty) to start an empty chain from when fast syncing, and whether to
+// backfill its ancestors once in sync.
+func (pm *ProtocolManager) setCheckpoint(hash common.Hash, td *big.Int, backfill bool) {
+	pm.downloader.SetCheckpoint(hash, td)
+	pm.backfill = backfill
+}
+
 func (pm *ProtocolManager) removePeer(id string) {
 	// Short circuit if the peer was already removed
 	peer := pm.peers.Peer(id)
@@ -193,6 +225,7 @@ func (pm *ProtocolManager) removePeer(id string) {
 
 	// Unregister the peer from the downloader and Wiseplat peer set
 	pm.downloader.UnregisterPeer(id)
+	pm.txFetcher.Drop(id)
 	if err := pm.peers.Unregister(id); err != nil {
 		log.Error("Peer removal failed", "peer", id, "err", err)
 	}
@@ -258,7 +291,8 @@ func (pm *ProtocolManager) handle(p *peer) error {
 
 	// Execute the Wiseplat handshake
 	td, head, genesis := pm.blockchain.Status()
-	if err := p.Handshake(pm.networkId, td, head, genesis); err != nil {
+	forkID := forkid.NewID(pm.blockchain)
+	if err := p.Handshake(pm.networkId, td, head, genesis, forkID, pm.forkFilter); err != nil {
 		p.Log().Debug("Wiseplat handshake failed", "err", err)
 		return err
 	}
@@ -341,6 +375,8 @@ func (pm *ProtocolManager) handleMsg(p *peer) error {
 			bytes   common.StorageSize
 			headers []*types.Header
 			unknown bool
+
+			maxNonCanonical = uint64(100) // Side chain headers to walk before reaching the canonical chain
 		)
 		for !unknown && len(headers) < int(query.Amount) && bytes < softResponseLimit && len(headers) < downloader.MaxHeaderFetch {
 			// Retrieve the next header satisfying the query
@@ -361,14 +397,11 @@ func (pm *ProtocolManager) handleMsg(p *peer) error {
 			switch {
 			case query.Origin.Hash != (common.Hash{}) && query.Reverse:
 				// Hash based traversal towards the genesis block
-				for i := 0; i < int(query.Skip)+1; i++ {
-					if header := pm.blockchain.GetHeader(query.Origin.Hash, number); header != nil {
-						query.Origin.Hash = header.ParentHash
-						number--
-					} else {
-						unknown = true
-						break
-					}
+				if query.Skip >= number {
+					unknown = true
+				} else {
+					query.Origin.Hash, _ = pm.blockchain.GetAncestor(query.Origin.Hash, number, query.Skip+1, &maxNonCanonical)
+					unknown = (query.Origin.Hash == common.Hash{})
 				}
 			case query.Origin.Hash != (common.Hash{}) && !query.Reverse:
 				// Hash based traversal towards the leaf block
@@ -393,7 +426,7 @@ func (pm *ProtocolManager) handleMsg(p *peer) error {
 				}
 			case query.Reverse:
 				// Number based traversal towards the genesis block
-				if query.Origin.Number >= query.Skip+1 {
+				if query.Skip < query.Origin.Number {
 					query.Origin.Number -= (query.Skip + 1)
 				} else {
 					unknown = true
@@ -401,7 +434,12 @@ func (pm *ProtocolManager) handleMsg(p *peer) error {
 
 			case !query.Reverse:
 				// Number based traversal towards the leaf block
-				query.Origin.Number += (query.Skip + 1)
+				next := query.Origin.Number + query.Skip + 1
+				if next <= query.Origin.Number {
+					unknown = true
+				} else {
+					query.Origin.Number = next
+				}
 			}
 		}
 		return p.SendBlockHeaders(headers)
@@ -666,7 +704,77 @@ func (pm *ProtocolManager) handleMsg(p *peer) error {
 			}
 			p.MarkTransaction(tx.Hash())
 		}
-		pm.txpool.AddRemotes(txs)
+		pm.txFetcher.Enqueue(p.id, txs, false)
+
+	case p.version >= wsh64 && msg.Code == NewPooledTransactionHashesMsg:
+		// Transactions were announced, make sure we have a valid and fresh chain to handle them
+		if atomic.LoadUint32(&pm.acceptTxs) == 0 {
+			break
+		}
+		var hashes []common.Hash
+		if err := msg.Decode(&hashes); err != nil {
+			return errResp(ErrDecode, "msg %v: %v", msg, err)
+		}
+		// Schedule all the unknown hashes for retrieval
+		for _, hash := range hashes {
+			p.MarkTransaction(hash)
+		}
+		pm.txFetcher.Notify(p.id, hashes, time.Now(), p.RequestTxs)
+
+	case p.version >= wsh64 && msg.Code == GetPooledTransactionsMsg:
+		// Decode the retrieval message
+		msgStream := rlp.NewStream(msg.Payload, uint64(msg.Size))
+		if _, err := msgStream.List(); err != nil {
+			return err
+		}
+		// Gather transactions until the fetch or network limits is reached
+		var (
+			hash   common.Hash
+			bytes  int
+			hashes []common.Hash
+			txs    []rlp.RawValue
+		)
+		for bytes < softResponseLimit {
+			// Retrieve the hash of the next transaction
+			if err := msgStream.Decode(&hash); err == rlp.EOL {
+				break
+			} else if err != nil {
+				return errResp(ErrDecode, "msg %v: %v", msg, err)
+			}
+			// Retrieve the requested transaction, skipping if unknown to us
+			tx := pm.txpool.Get(hash)
+			if tx == nil {
+				continue
+			}
+			// If known, encode and queue for response packet
+			if encoded, err := rlp.EncodeToBytes(tx); err != nil {
+				log.Error("Failed to encode transaction", "err", err)
+			} else {
+				hashes = append(hashes, hash)
+				txs = append(txs, encoded)
+				bytes += len(encoded)
+			}
+		}
+		return p.SendPooledTransactionsRLP(hashes, txs)
+
+	case p.version >= wsh64 && msg.Code == PooledTransactionsMsg:
+		// Transactions arrived, make sure we have a valid and fresh chain to handle them
+		if atomic.LoadUint32(&pm.acceptTxs) == 0 {
+			break
+		}
+		// Transactions can be processed, parse all of them and deliver to the pool
+		var txs []*types.Transaction
+		if err := msg.Decode(&txs); err != nil {
+			return errResp(ErrDecode, "msg %v: %v", msg, err)
+		}
+		for i, tx := range txs {
+			// Validate and mark the remote transaction
+			if tx == nil {
+				return errResp(ErrDecode, "transaction %d is nil", i)
+			}
+			p.MarkTransaction(tx.Hash())
+		}
+		pm.txFetcher.Enqueue(p.id, txs, true)
 
 	default:
 		return errResp(ErrInvalidMsgCode, "%v", msg.Code)
@@ -708,15 +816,25 @@ func (pm *ProtocolManager) BroadcastBlock(block *types.Block, propagate bool) {
 }
 
 // BroadcastTx will propagate a transaction to all peers which are not known to
-// already have the given transaction.
+// already have the given transaction. The full transaction is sent to a square
+// root subset of the peers, the rest (if running wsh/64) only get an announcement
+// of its hash and can retrieve it on demand.
 func (pm *ProtocolManager) BroadcastTx(hash common.Hash, tx *types.Transaction) {
 	// Broadcast transaction to a batch of peers not knowing about it
 	peers := pm.peers.PeersWithoutTx(hash)
-	//FIXME include this again: peers = peers[:int(math.Sqrt(float64(len(peers))))]
-	for _, peer := range peers {
-		peer.SendTransactions(types.Transactions{tx})
+	direct := int(math.Sqrt(float64(len(peers))))
+
+	var sent, announced int
+	for i, peer := range peers {
+		if i < direct || peer.version < wsh64 {
+			peer.SendTransactions(types.Transactions{tx})
+			sent++
+		} else {
+			peer.SendPooledTransactionHashes([]common.Hash{hash})
+			announced++
+		}
 	}
-	log.Trace("Broadcast transaction", "hash", hash, "recipients", len(peers))
+	log.Trace("Broadcast transaction", "hash", hash, "recipients", sent, "announced", announced)
 }
 
 // Mined broadcast loop
@@ -26,6 +26,7 @@ import (
 	"github.com/wiseplat/go-wiseplat/common"
 	"github.com/wiseplat/go-wiseplat/consensus/wshash"
 	"github.com/wiseplat/go-wiseplat/core"
+	"github.com/wiseplat/go-wiseplat/core/forkid"
 	"github.com/wiseplat/go-wiseplat/core/state"
 	"github.com/wiseplat/go-wiseplat/core/types"
 	"github.com/wiseplat/go-wiseplat/core/vm"
@@ -34,6 +35,7 @@ import (
 	"github.com/wiseplat/go-wiseplat/wshdb"
 	"github.com/wiseplat/go-wiseplat/event"
 	"github.com/wiseplat/go-wiseplat/p2p"
+	"github.com/wiseplat/go-wiseplat/p2p/enr"
 	"github.com/wiseplat/go-wiseplat/params"
 )
 
@@ -47,8 +49,8 @@ func TestProtocolCompatibility(t *testing.T) {
 		mode       downloader.SyncMode
 		compatible bool
 	}{
-		{61, downloader.FullSync, true}, {62, downloader.FullSync, true}, {63, downloader.FullSync, true},
-		{61, downloader.FastSync, false}, {62, downloader.FastSync, false}, {63, downloader.FastSync, true},
+		{61, downloader.FullSync, true}, {62, downloader.FullSync, true}, {63, downloader.FullSync, true}, {64, downloader.FullSync, true}, {65, downloader.FullSync, true},
+		{61, downloader.FastSync, false}, {62, downloader.FastSync, false}, {63, downloader.FastSync, true}, {64, downloader.FastSync, true}, {65, downloader.FastSync, true},
 	}
 	// Make sure anything we screw up is restored
 	backup := ProtocolVersions
@@ -68,9 +70,43 @@ func TestProtocolCompatibility(t *testing.T) {
 	}
 }
 
+// Tests that node records are checked against the served network.
+func TestFilterRecord(t *testing.T) {
+	pm := newTestProtocolManagerMust(t, downloader.FullSync, 0, nil, nil)
+	defer pm.Stop()
+
+	key, _ := crypto.GenerateKey()
+	record := func(entry enr.Entry) *enr.Record {
+		r := new(enr.Record)
+		if entry != nil {
+			r.Set(entry)
+		}
+		r.Sign(key)
+		return r
+	}
+	forkID := forkid.NewID(pm.blockchain)
+	tests := []struct {
+		entry enr.Entry
+		want  bool
+	}{
+		{&enrEntry{NetworkId: pm.networkId, ForkID: forkID}, true},
+		{&enrEntry{NetworkId: pm.networkId + 1, ForkID: forkID}, false},
+		{&enrEntry{NetworkId: pm.networkId, ForkID: forkid.ID{Hash: [4]byte{1}}}, false},
+		{enr.WithEntry("wsh", "invalid"), false},
+		{nil, true},
+	}
+	for i, tt := range tests {
+		if have := pm.filterRecord(record(tt.entry)); have != tt.want {
+			t.Errorf("test %d: filter mismatch: have %v, want %v", i, have, tt.want)
+		}
+	}
+}
+
 // Tests that block headers can be retrieved from a remote chain based on user queries.
 func TestGetBlockHeaders62(t *testing.T) { testGetBlockHeaders(t, 62) }
 func TestGetBlockHeaders63(t *testing.T) { testGetBlockHeaders(t, 63) }
+func TestGetBlockHeaders64(t *testing.T) { testGetBlockHeaders(t, 64) }
+func TestGetBlockHeaders65(t *testing.T) { testGetBlockHeaders(t, 65) }
 
 func testGetBlockHeaders(t *testing.T, protocol int) {
 	pm := newTestProtocolManagerMust(t, downloader.FullSync, downloader.MaxHashFetch+15, nil, nil)
@@ -192,6 +228,33 @@ func testGetBlockHeaders(t *testing.T, protocol int) {
 				pm.blockchain.GetBlockByNumber(1).Hash(),
 			},
 		},
+		// Check a corner case where number based skipping overflow loops back to the same header
+		{
+			&getBlockHeadersData{Origin: hashOrNumber{Number: 1}, Amount: 2, Reverse: false, Skip: math.MaxUint64},
+			[]common.Hash{
+				pm.blockchain.GetBlockByNumber(1).Hash(),
+			},
+		},
+		// Check a corner case where reverse skipping overflow loops back to the same header
+		{
+			&getBlockHeadersData{Origin: hashOrNumber{Number: 3}, Amount: 2, Reverse: true, Skip: math.MaxUint64},
+			[]common.Hash{
+				pm.blockchain.GetBlockByNumber(3).Hash(),
+			},
+		},
+		// Check that hash based reverse skipping past the genesis stops at the origin
+		{
+			&getBlockHeadersData{Origin: hashOrNumber{Hash: pm.blockchain.GetBlockByNumber(3).Hash()}, Amount: 2, Reverse: true, Skip: math.MaxUint64},
+			[]common.Hash{
+				pm.blockchain.GetBlockByNumber(3).Hash(),
+			},
+		}, {
+			&getBlockHeadersData{Origin: hashOrNumber{Hash: pm.blockchain.GetBlockByNumber(4).Hash()}, Amount: 3, Reverse: true, Skip: 3},
+			[]common.Hash{
+				pm.blockchain.GetBlockByNumber(4).Hash(),
+				pm.blockchain.GetBlockByNumber(0).Hash(),
+			},
+		},
 		// Check that non existing headers aren't returned
 		{
 			&getBlockHeadersData{Origin: hashOrNumber{Hash: unknown}, Amount: 1},
@@ -230,6 +293,8 @@ func testGetBlockHeaders(t *testing.T, protocol int) {
 // Tests that block contents can be retrieved from a remote chain based on their hashes.
 func TestGetBlockBodies62(t *testing.T) { testGetBlockBodies(t, 62) }
 func TestGetBlockBodies63(t *testing.T) { testGetBlockBodies(t, 63) }
+func TestGetBlockBodies64(t *testing.T) { testGetBlockBodies(t, 64) }
+func TestGetBlockBodies65(t *testing.T) { testGetBlockBodies(t, 65) }
 
 func testGetBlockBodies(t *testing.T, protocol int) {
 	pm := newTestProtocolManagerMust(t, downloader.FullSync, downloader.MaxBlockFetch+15, nil, nil)
@@ -301,6 +366,8 @@ func testGetBlockBodies(t *testing.T, protocol int) {
 
 // Tests that the node state database can be retrieved based on hashes.
 func TestGetNodeData63(t *testing.T) { testGetNodeData(t, 63) }
+func TestGetNodeData64(t *testing.T) { testGetNodeData(t, 64) }
+func TestGetNodeData65(t *testing.T) { testGetNodeData(t, 65) }
 
 func testGetNodeData(t *testing.T, protocol int) {
 	// Define three accounts to simulate transactions with
@@ -393,6 +460,8 @@ func testGetNodeData(t *testing.T, protocol int) {
 
 // Tests that the transaction receipts can be retrieved based on hashes.
 func TestGetReceipt63(t *testing.T) { testGetReceipt(t, 63) }
+func TestGetReceipt64(t *testing.T) { testGetReceipt(t, 64) }
+func TestGetReceipt65(t *testing.T) { testGetReceipt(t, 65) }
 
 func testGetReceipt(t *testing.T, protocol int) {
 	// Define three accounts to simulate transactions with
@@ -22,38 +22,46 @@ import (
 )
 
 var (
-	propTxnInPacketsMeter     = metrics.NewMeter("wsh/prop/txns/in/packets")
-	propTxnInTrafficMeter     = metrics.NewMeter("wsh/prop/txns/in/traffic")
-	propTxnOutPacketsMeter    = metrics.NewMeter("wsh/prop/txns/out/packets")
-	propTxnOutTrafficMeter    = metrics.NewMeter("wsh/prop/txns/out/traffic")
-	propHashInPacketsMeter    = metrics.NewMeter("wsh/prop/hashes/in/packets")
-	propHashInTrafficMeter    = metrics.NewMeter("wsh/prop/hashes/in/traffic")
-	propHashOutPacketsMeter   = metrics.NewMeter("wsh/prop/hashes/out/packets")
-	propHashOutTrafficMeter   = metrics.NewMeter("wsh/prop/hashes/out/traffic")
-	propBlockInPacketsMeter   = metrics.NewMeter("wsh/prop/blocks/in/packets")
-	propBlockInTrafficMeter   = metrics.NewMeter("wsh/prop/blocks/in/traffic")
-	propBlockOutPacketsMeter  = metrics.NewMeter("wsh/prop/blocks/out/packets")
-	propBlockOutTrafficMeter  = metrics.NewMeter("wsh/prop/blocks/out/traffic")
-	reqHeaderInPacketsMeter   = metrics.NewMeter("wsh/req/headers/in/packets")
-	reqHeaderInTrafficMeter   = metrics.NewMeter("wsh/req/headers/in/traffic")
-	reqHeaderOutPacketsMeter  = metrics.NewMeter("wsh/req/headers/out/packets")
-	reqHeaderOutTrafficMeter  = metrics.NewMeter("wsh/req/headers/out/traffic")
-	reqBodyInPacketsMeter     = metrics.NewMeter("wsh/req/bodies/in/packets")
-	reqBodyInTrafficMeter     = metrics.NewMeter("wsh/req/bodies/in/traffic")
-	reqBodyOutPacketsMeter    = metrics.NewMeter("wsh/req/bodies/out/packets")
-	reqBodyOutTrafficMeter    = metrics.NewMeter("wsh/req/bodies/out/traffic")
-	reqStateInPacketsMeter    = metrics.NewMeter("wsh/req/states/in/packets")
-	reqStateInTrafficMeter    = metrics.NewMeter("wsh/req/states/in/traffic")
-	reqStateOutPacketsMeter   = metrics.NewMeter("wsh/req/states/out/packets")
-	reqStateOutTrafficMeter   = metrics.NewMeter("wsh/req/states/out/traffic")
-	reqReceiptInPacketsMeter  = metrics.NewMeter("wsh/req/receipts/in/packets")
-	reqReceiptInTrafficMeter  = metrics.NewMeter("wsh/req/receipts/in/traffic")
-	reqReceiptOutPacketsMeter = metrics.NewMeter("wsh/req/receipts/out/packets")
-	reqReceiptOutTrafficMeter = metrics.NewMeter("wsh/req/receipts/out/traffic")
-	miscInPacketsMeter        = metrics.NewMeter("wsh/misc/in/packets")
-	miscInTrafficMeter        = metrics.NewMeter("wsh/misc/in/traffic")
-	miscOutPacketsMeter       = metrics.NewMeter("wsh/misc/out/packets")
-	miscOutTrafficMeter       = metrics.NewMeter("wsh/misc/out/traffic")
+	propTxnInPacketsMeter      = metrics.NewMeter("wsh/prop/txns/in/packets")
+	propTxnInTrafficMeter      = metrics.NewMeter("wsh/prop/txns/in/traffic")
+	propTxnOutPacketsMeter     = metrics.NewMeter("wsh/prop/txns/out/packets")
+	propTxnOutTrafficMeter     = metrics.NewMeter("wsh/prop/txns/out/traffic")
+	propTxnHashInPacketsMeter  = metrics.NewMeter("wsh/prop/txhashes/in/packets")
+	propTxnHashInTrafficMeter  = metrics.NewMeter("wsh/prop/txhashes/in/traffic")
+	propTxnHashOutPacketsMeter = metrics.NewMeter("wsh/prop/txhashes/out/packets")
+	propTxnHashOutTrafficMeter = metrics.NewMeter("wsh/prop/txhashes/out/traffic")
+	propHashInPacketsMeter     = metrics.NewMeter("wsh/prop/hashes/in/packets")
+	propHashInTrafficMeter     = metrics.NewMeter("wsh/prop/hashes/in/traffic")
+	propHashOutPacketsMeter    = metrics.NewMeter("wsh/prop/hashes/out/packets")
+	propHashOutTrafficMeter    = metrics.NewMeter("wsh/prop/hashes/out/traffic")
+	propBlockInPacketsMeter    = metrics.NewMeter("wsh/prop/blocks/in/packets")
+	propBlockInTrafficMeter    = metrics.NewMeter("wsh/prop/blocks/in/traffic")
+	propBlockOutPacketsMeter   = metrics.NewMeter("wsh/prop/blocks/out/packets")
+	propBlockOutTrafficMeter   = metrics.NewMeter("wsh/prop/blocks/out/traffic")
+	reqHeaderInPacketsMeter    = metrics.NewMeter("wsh/req/headers/in/packets")
+	reqHeaderInTrafficMeter    = metrics.NewMeter("wsh/req/headers/in/traffic")
+	reqHeaderOutPacketsMeter   = metrics.NewMeter("wsh/req/headers/out/packets")
+	reqHeaderOutTrafficMeter   = metrics.NewMeter("wsh/req/headers/out/traffic")
+	reqBodyInPacketsMeter      = metrics.NewMeter("wsh/req/bodies/in/packets")
+	reqBodyInTrafficMeter      = metrics.NewMeter("wsh/req/bodies/in/traffic")
+	reqBodyOutPacketsMeter     = metrics.NewMeter("wsh/req/bodies/out/packets")
+	reqBodyOutTrafficMeter     = metrics.NewMeter("wsh/req/bodies/out/traffic")
+	reqStateInPacketsMeter     = metrics.NewMeter("wsh/req/states/in/packets")
+	reqStateInTrafficMeter     = metrics.NewMeter("wsh/req/states/in/traffic")
+	reqStateOutPacketsMeter    = metrics.NewMeter("wsh/req/states/out/packets")
+	reqStateOutTrafficMeter    = metrics.NewMeter("wsh/req/states/out/traffic")
+	reqReceiptInPacketsMeter   = metrics.NewMeter("wsh/req/receipts/in/packets")
+	reqReceiptInTrafficMeter   = metrics.NewMeter("wsh/req/receipts/in/traffic")
+	reqReceiptOutPacketsMeter  = metrics.NewMeter("wsh/req/receipts/out/packets")
+	reqReceiptOutTrafficMeter  = metrics.NewMeter("wsh/req/receipts/out/traffic")
+	reqTxnInPacketsMeter       = metrics.NewMeter("wsh/req/txns/in/packets")
+	reqTxnInTrafficMeter       = metrics.NewMeter("wsh/req/txns/in/traffic")
+	reqTxnOutPacketsMeter      = metrics.NewMeter("wsh/req/txns/out/packets")
+	reqTxnOutTrafficMeter      = metrics.NewMeter("wsh/req/txns/out/traffic")
+	miscInPacketsMeter         = metrics.NewMeter("wsh/misc/in/packets")
+	miscInTrafficMeter         = metrics.NewMeter("wsh/misc/in/traffic")
+	miscOutPacketsMeter        = metrics.NewMeter("wsh/misc/out/packets")
+	miscOutTrafficMeter        = metrics.NewMeter("wsh/misc/out/traffic")
 )
 
 // meteredMsgReadWriter is a wrapper around a p2p.MsgReadWriter, capable of
@@ -97,6 +105,11 @@ func (rw *meteredMsgReadWriter) ReadMsg() (p2p.Msg, error) {
 	case rw.version >= wsh63 && msg.Code == ReceiptsMsg:
 		packets, traffic = reqReceiptInPacketsMeter, reqReceiptInTrafficMeter
 
+	case rw.version >= wsh64 && msg.Code == NewPooledTransactionHashesMsg:
+		packets, traffic = propTxnHashInPacketsMeter, propTxnHashInTrafficMeter
+	case rw.version >= wsh64 && msg.Code == PooledTransactionsMsg:
+		packets, traffic = reqTxnInPacketsMeter, reqTxnInTrafficMeter
+
 	case msg.Code == NewBlockHashesMsg:
 		packets, traffic = propHashInPacketsMeter, propHashInTrafficMeter
 	case msg.Code == NewBlockMsg:
@@ -124,6 +137,11 @@ func (rw *meteredMsgReadWriter) WriteMsg(msg p2p.Msg) error {
 	case rw.version >= wsh63 && msg.Code == ReceiptsMsg:
 		packets, traffic = reqReceiptOutPacketsMeter, reqReceiptOutTrafficMeter
 
+	case rw.version >= wsh64 && msg.Code == NewPooledTransactionHashesMsg:
+		packets, traffic = propTxnHashOutPacketsMeter, propTxnHashOutTrafficMeter
+	case rw.version >= wsh64 && msg.Code == PooledTransactionsMsg:
+		packets, traffic = reqTxnOutPacketsMeter, reqTxnOutTrafficMeter
+
 	case msg.Code == NewBlockHashesMsg:
 		packets, traffic = propHashOutPacketsMeter, propHashOutTrafficMeter
 	case msg.Code == NewBlockMsg:
@@ -23,6 +23,7 @@ import (
 
 	"github.com/wiseplat/go-wiseplat/common"
 	"github.com/wiseplat/go-wiseplat/core"
+	"github.com/wiseplat/go-wiseplat/core/forkid"
 	"github.com/wiseplat/go-wiseplat/core/types"
 	"github.com/wiseplat/go-wiseplat/event"
 	"github.com/wiseplat/go-wiseplat/rlp"
@@ -32,16 +33,18 @@ import (
 const (
 	wsh62 = 62
 	wsh63 = 63
+	wsh64 = 64
+	wsh65 = 65
 )
 
 // Official short name of the protocol used during capability negotiation.
 var ProtocolName = "wsh"
 
 // Supported versions of the wsh protocol (first is primary).
-var ProtocolVersions = []uint{wsh63, wsh62}
+var ProtocolVersions = []uint{wsh65, wsh64, wsh63, wsh62}
 
 // Number of implemented message corresponding to different protocol versions.
-var ProtocolLengths = []uint64{17, 8}
+var ProtocolLengths = []uint64{17, 17, 17, 8}
 
 const ProtocolMaxMsgSize = 10 * 1024 * 1024 // Maximum cap on the size of a protocol message
 
@@ -57,6 +60,11 @@ const (
 	BlockBodiesMsg     = 0x06
 	NewBlockMsg        = 0x07
 
+	// Protocol messages belonging to wsh/64
+	NewPooledTransactionHashesMsg = 0x08
+	GetPooledTransactionsMsg      = 0x09
+	PooledTransactionsMsg         = 0x0a
+
 	// Protocol messages belonging to wsh/63
 	GetNodeDataMsg = 0x0d
 	NodeDataMsg    = 0x0e
@@ -76,6 +84,7 @@ const (
 	ErrNoStatusMsg
 	ErrExtraStatusMsg
 	ErrSuspendedPeer
+	ErrForkIDRejected
 )
 
 func (e errCode) String() string {
@@ -93,12 +102,16 @@ var errorToString = map[int]string{
 	ErrNoStatusMsg:             "No status message",
 	ErrExtraStatusMsg:          "Extra status message",
 	ErrSuspendedPeer:           "Suspended peer",
+	ErrForkIDRejected:          "Fork ID rejected",
 }
 
 type txPool interface {
 	// AddRemotes should add the given transactions to the pool.
 	AddRemotes([]*types.Transaction) []error
 
+	// Get should return the transaction with the given hash if it's in the pool.
+	Get(hash common.Hash) *types.Transaction
+
 	// Pending should return pending transactions.
 	// The slice should be modifiable by the caller.
 	Pending() (map[common.Address]types.Transactions, error)
@@ -117,6 +130,17 @@ type statusData struct {
 	GenesisBlock    common.Hash
 }
 
+// statusData65 is the network packet for the status message since wsh/65,
+// extending the original one with the fork identifier of the chain.
+type statusData65 struct {
+	ProtocolVersion uint32
+	NetworkId       uint64
+	TD              *big.Int
+	CurrentBlock    common.Hash
+	GenesisBlock    common.Hash
+	ForkID          forkid.ID
+}
+
 // newBlockHashesData is the network packet for the block announcements.
 type newBlockHashesData []struct {
 	Hash   common.Hash // Hash of one particular block being announced
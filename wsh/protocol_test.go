@@ -23,6 +23,7 @@ import (
 	"time"
 
 	"github.com/wiseplat/go-wiseplat/common"
+	"github.com/wiseplat/go-wiseplat/core/forkid"
 	"github.com/wiseplat/go-wiseplat/core/types"
 	"github.com/wiseplat/go-wiseplat/crypto"
 	"github.com/wiseplat/go-wiseplat/wsh/downloader"
@@ -39,6 +40,7 @@ var testAccount, _ = crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6
 // Tests that handshake failures are detected and reported correctly.
 func TestStatusMsgErrors62(t *testing.T) { testStatusMsgErrors(t, 62) }
 func TestStatusMsgErrors63(t *testing.T) { testStatusMsgErrors(t, 63) }
+func TestStatusMsgErrors64(t *testing.T) { testStatusMsgErrors(t, 64) }
 
 func testStatusMsgErrors(t *testing.T, protocol int) {
 	pm := newTestProtocolManagerMust(t, downloader.FullSync, 0, nil, nil)
@@ -88,9 +90,65 @@ func testStatusMsgErrors(t *testing.T, protocol int) {
 	}
 }
 
+// Tests that handshake failures, including fork ID rejections, are detected and
+// reported correctly since wsh/65.
+func TestStatusMsgErrors65(t *testing.T) {
+	pm := newTestProtocolManagerMust(t, downloader.FullSync, 0, nil, nil)
+	td, currentBlock, genesis := pm.blockchain.Status()
+	defer pm.Stop()
+
+	forkID := forkid.NewID(pm.blockchain)
+	tests := []struct {
+		code      uint64
+		data      interface{}
+		wantError error
+	}{
+		{
+			code: TxMsg, data: []interface{}{},
+			wantError: errResp(ErrNoStatusMsg, "first msg has code 2 (!= 0)"),
+		},
+		{
+			code: StatusMsg, data: statusData65{10, DefaultConfig.NetworkId, td, currentBlock, genesis, forkID},
+			wantError: errResp(ErrProtocolVersionMismatch, "10 (!= %d)", wsh65),
+		},
+		{
+			code: StatusMsg, data: statusData65{wsh65, 999, td, currentBlock, genesis, forkID},
+			wantError: errResp(ErrNetworkIdMismatch, "999 (!= 1)"),
+		},
+		{
+			code: StatusMsg, data: statusData65{wsh65, DefaultConfig.NetworkId, td, currentBlock, common.Hash{3}, forkID},
+			wantError: errResp(ErrGenesisBlockMismatch, "0300000000000000 (!= %x)", genesis[:8]),
+		},
+		{
+			code: StatusMsg, data: statusData65{wsh65, DefaultConfig.NetworkId, td, currentBlock, genesis, forkid.ID{Hash: [4]byte{0x00, 0x01, 0x02, 0x03}}},
+			wantError: errResp(ErrForkIDRejected, "%v", forkid.ErrLocalIncompatibleOrStale),
+		},
+	}
+	for i, test := range tests {
+		p, errc := newTestPeer("peer", wsh65, pm, false)
+		// The send call might hang until reset because
+		// the protocol might not read the payload.
+		go p2p.Send(p.app, test.code, test.data)
+
+		select {
+		case err := <-errc:
+			if err == nil {
+				t.Errorf("test %d: protocol returned nil error, want %q", i, test.wantError)
+			} else if err.Error() != test.wantError.Error() {
+				t.Errorf("test %d: wrong error: got %q, want %q", i, err, test.wantError)
+			}
+		case <-time.After(2 * time.Second):
+			t.Errorf("protocol did not shut down within 2 seconds")
+		}
+		p.close()
+	}
+}
+
 // This test checks that received transactions are added to the local pool.
 func TestRecvTransactions62(t *testing.T) { testRecvTransactions(t, 62) }
 func TestRecvTransactions63(t *testing.T) { testRecvTransactions(t, 63) }
+func TestRecvTransactions64(t *testing.T) { testRecvTransactions(t, 64) }
+func TestRecvTransactions65(t *testing.T) { testRecvTransactions(t, 65) }
 
 func testRecvTransactions(t *testing.T, protocol int) {
 	txAdded := make(chan []*types.Transaction)
@@ -119,6 +177,8 @@ func testRecvTransactions(t *testing.T, protocol int) {
 // This test checks that pending transactions are sent.
 func TestSendTransactions62(t *testing.T) { testSendTransactions(t, 62) }
 func TestSendTransactions63(t *testing.T) { testSendTransactions(t, 63) }
+func TestSendTransactions64(t *testing.T) { testSendTransactions(t, 64) }
+func TestSendTransactions65(t *testing.T) { testSendTransactions(t, 65) }
 
 func testSendTransactions(t *testing.T, protocol int) {
 	pm := newTestProtocolManagerMust(t, downloader.FullSync, 0, nil, nil)
@@ -142,18 +202,29 @@ func testSendTransactions(t *testing.T, protocol int) {
 			seen[tx.Hash()] = false
 		}
 		for n := 0; n < len(alltxs) && !t.Failed(); {
-			var txs []*types.Transaction
+			var hashes []common.Hash
+
 			msg, err := p.app.ReadMsg()
 			if err != nil {
 				t.Errorf("%v: read error: %v", p.Peer, err)
-			} else if msg.Code != TxMsg {
-				t.Errorf("%v: got code %d, want TxMsg", p.Peer, msg.Code)
 			}
-			if err := msg.Decode(&txs); err != nil {
-				t.Errorf("%v: %v", p.Peer, err)
+			switch {
+			case protocol < 64 && msg.Code == TxMsg:
+				var txs []*types.Transaction
+				if err := msg.Decode(&txs); err != nil {
+					t.Errorf("%v: %v", p.Peer, err)
+				}
+				for _, tx := range txs {
+					hashes = append(hashes, tx.Hash())
+				}
+			case protocol >= 64 && msg.Code == NewPooledTransactionHashesMsg:
+				if err := msg.Decode(&hashes); err != nil {
+					t.Errorf("%v: %v", p.Peer, err)
+				}
+			default:
+				t.Errorf("%v: got unexpected code %d", p.Peer, msg.Code)
 			}
-			for _, tx := range txs {
-				hash := tx.Hash()
+			for _, hash := range hashes {
 				seentx, want := seen[hash]
 				if seentx {
 					t.Errorf("%v: got tx more than once: %x", p.Peer, hash)
@@ -174,6 +245,66 @@ func testSendTransactions(t *testing.T, protocol int) {
 	wg.Wait()
 }
 
+// Tests that transaction announcements are retrieved from the announcer and the
+// delivered transactions added to the local pool.
+func TestRecvPooledTransactions64(t *testing.T) {
+	txAdded := make(chan []*types.Transaction)
+	pm := newTestProtocolManagerMust(t, downloader.FullSync, 0, nil, txAdded)
+	pm.acceptTxs = 1 // mark synced to accept transactions
+	p, _ := newTestPeer("peer", 64, pm, true)
+	defer pm.Stop()
+	defer p.close()
+
+	tx := newTestTransaction(testAccount, 0, 0)
+	if err := p2p.Send(p.app, NewPooledTransactionHashesMsg, []common.Hash{tx.Hash()}); err != nil {
+		t.Fatalf("send error: %v", err)
+	}
+	// The announced transaction should be requested from the peer
+	if err := p2p.ExpectMsg(p.app, GetPooledTransactionsMsg, []common.Hash{tx.Hash()}); err != nil {
+		t.Fatalf("transaction request mismatch: %v", err)
+	}
+	if err := p2p.Send(p.app, PooledTransactionsMsg, []*types.Transaction{tx}); err != nil {
+		t.Fatalf("send error: %v", err)
+	}
+	select {
+	case added := <-txAdded:
+		if len(added) != 1 {
+			t.Errorf("wrong number of added transactions: got %d, want 1", len(added))
+		} else if added[0].Hash() != tx.Hash() {
+			t.Errorf("added wrong tx hash: got %v, want %v", added[0].Hash(), tx.Hash())
+		}
+	case <-time.After(2 * time.Second):
+		t.Errorf("no transactions added within 2 seconds")
+	}
+}
+
+// Tests that pooled transactions are served on request, skipping the unknown ones.
+func TestGetPooledTransactions64(t *testing.T) {
+	pm := newTestProtocolManagerMust(t, downloader.FullSync, 0, nil, nil)
+	defer pm.Stop()
+
+	txs := []*types.Transaction{
+		newTestTransaction(testAccount, 0, 0),
+		newTestTransaction(testAccount, 1, 0),
+	}
+	pm.txpool.AddRemotes(txs)
+
+	p, _ := newTestPeer("peer", 64, pm, true)
+	defer p.close()
+
+	// Drain the initial transaction sync announcing the pool content
+	if err := p2p.ExpectMsg(p.app, NewPooledTransactionHashesMsg, []common.Hash{txs[0].Hash(), txs[1].Hash()}); err != nil {
+		t.Fatalf("transaction announcement mismatch: %v", err)
+	}
+	query := []common.Hash{txs[1].Hash(), {0x01}, txs[0].Hash()}
+	if err := p2p.Send(p.app, GetPooledTransactionsMsg, query); err != nil {
+		t.Fatalf("send error: %v", err)
+	}
+	if err := p2p.ExpectMsg(p.app, PooledTransactionsMsg, []*types.Transaction{txs[1], txs[0]}); err != nil {
+		t.Errorf("pooled transactions mismatch: %v", err)
+	}
+}
+
 // Tests that the custom union field encoder and decoder works correctly.
 func TestGetBlockHeadersDataEncodeDecode(t *testing.T) {
 	// Create a "random" hash for testing
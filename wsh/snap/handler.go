@@ -0,0 +1,377 @@
+// Copyright 2018 The go-wiseplat Authors
+// This file is part of the go-wiseplat library.
+//
+// The go-wiseplat library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-wiseplat library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-wiseplat library. If not, see <http://www.gnu.org/licenses/>.
+
+package snap
+
+import (
+	"bytes"
+	"sort"
+
+	"github.com/wiseplat/go-wiseplat/common"
+	"github.com/wiseplat/go-wiseplat/core/state"
+	"github.com/wiseplat/go-wiseplat/log"
+	"github.com/wiseplat/go-wiseplat/p2p"
+	"github.com/wiseplat/go-wiseplat/p2p/discover"
+	"github.com/wiseplat/go-wiseplat/rlp"
+	"github.com/wiseplat/go-wiseplat/trie"
+	"github.com/wiseplat/go-wiseplat/wshdb"
+)
+
+const (
+	// softResponseLimit is the target maximum size of replies to data retrievals.
+	softResponseLimit = 2 * 1024 * 1024
+
+	// maxCodeLookups is the maximum number of bytecodes to serve. This number is
+	// there to limit the number of disk lookups.
+	maxCodeLookups = 1024
+)
+
+// Handler serves the snap protocol out of the local state database and feeds
+// the responses of remote peers into the state syncer.
+type Handler struct {
+	db     wshdb.Database // Database to serve the state from
+	syncer *Syncer        // State syncer to deliver responses to
+}
+
+// NewHandler creates a snap protocol handler serving the state stored in db and
+// delivering retrieved data into syncer.
+func NewHandler(db wshdb.Database, syncer *Syncer) *Handler {
+	return &Handler{
+		db:     db,
+		syncer: syncer,
+	}
+}
+
+// Protocols returns the p2p protocols of the snap handler, to be run next to wsh.
+func (h *Handler) Protocols() []p2p.Protocol {
+	protocols := make([]p2p.Protocol, 0, len(ProtocolVersions))
+	for i, version := range ProtocolVersions {
+		version := version // Closure for the run
+		protocols = append(protocols, p2p.Protocol{
+			Name:    ProtocolName,
+			Version: version,
+			Length:  ProtocolLengths[i],
+			Run: func(p *p2p.Peer, rw p2p.MsgReadWriter) error {
+				return h.handle(newPeer(version, p, rw))
+			},
+			NodeInfo: func() interface{} {
+				return nil
+			},
+			PeerInfo: func(id discover.NodeID) interface{} {
+				return nil
+			},
+		})
+	}
+	return protocols
+}
+
+// handle is the callback invoked to manage the life cycle of a snap peer. When
+// this function terminates, the peer is disconnected.
+func (h *Handler) handle(p *Peer) error {
+	p.Log().Debug("Snapshot peer connected", "name", p.Name())
+
+	if h.syncer != nil {
+		if err := h.syncer.Register(p); err != nil {
+			p.Log().Error("Snapshot peer registration failed", "err", err)
+			return err
+		}
+		defer h.syncer.Unregister(p.id)
+	}
+	for {
+		if err := h.handleMsg(p); err != nil {
+			p.Log().Debug("Snapshot message handling failed", "err", err)
+			return err
+		}
+	}
+}
+
+// handleMsg is invoked whenever an inbound message is received from a remote
+// peer. The remote connection is torn down upon returning any error.
+func (h *Handler) handleMsg(p *Peer) error {
+	// Read the next message from the remote peer, and ensure it's fully consumed
+	msg, err := p.rw.ReadMsg()
+	if err != nil {
+		return err
+	}
+	if msg.Size > ProtocolMaxMsgSize {
+		return errResp(errMsgTooLarge, "%v > %v", msg.Size, ProtocolMaxMsgSize)
+	}
+	defer msg.Discard()
+
+	switch msg.Code {
+	case GetAccountRangeMsg:
+		var req getAccountRangeData
+		if err := msg.Decode(&req); err != nil {
+			return errResp(errDecode, "msg %v: %v", msg, err)
+		}
+		accounts, proof := serviceGetAccountRange(h.db, &req)
+		return p2p.Send(p.rw, AccountRangeMsg, &accountRangeData{
+			ID:       req.ID,
+			Accounts: accounts,
+			Proof:    proof,
+		})
+
+	case AccountRangeMsg:
+		var res accountRangeData
+		if err := msg.Decode(&res); err != nil {
+			return errResp(errDecode, "msg %v: %v", msg, err)
+		}
+		if h.syncer == nil {
+			return nil
+		}
+		hashes := make([]common.Hash, len(res.Accounts))
+		accounts := make([][]byte, len(res.Accounts))
+		for i, acc := range res.Accounts {
+			hashes[i], accounts[i] = acc.Hash, acc.Body
+		}
+		return h.syncer.OnAccounts(p, res.ID, hashes, accounts, res.Proof)
+
+	case GetStorageRangesMsg:
+		var req getStorageRangesData
+		if err := msg.Decode(&req); err != nil {
+			return errResp(errDecode, "msg %v: %v", msg, err)
+		}
+		slots, proof := serviceGetStorageRanges(h.db, &req)
+		return p2p.Send(p.rw, StorageRangesMsg, &storageRangesData{
+			ID:    req.ID,
+			Slots: slots,
+			Proof: proof,
+		})
+
+	case StorageRangesMsg:
+		var res storageRangesData
+		if err := msg.Decode(&res); err != nil {
+			return errResp(errDecode, "msg %v: %v", msg, err)
+		}
+		if h.syncer == nil {
+			return nil
+		}
+		hashes := make([][]common.Hash, len(res.Slots))
+		slots := make([][][]byte, len(res.Slots))
+		for i, set := range res.Slots {
+			hashes[i] = make([]common.Hash, len(set))
+			slots[i] = make([][]byte, len(set))
+			for j, slot := range set {
+				hashes[i][j], slots[i][j] = slot.Hash, slot.Body
+			}
+		}
+		return h.syncer.OnStorage(p, res.ID, hashes, slots, res.Proof)
+
+	case GetByteCodesMsg:
+		var req getByteCodesData
+		if err := msg.Decode(&req); err != nil {
+			return errResp(errDecode, "msg %v: %v", msg, err)
+		}
+		return p2p.Send(p.rw, ByteCodesMsg, &byteCodesData{
+			ID:    req.ID,
+			Codes: serviceGetByteCodes(h.db, &req),
+		})
+
+	case ByteCodesMsg:
+		var res byteCodesData
+		if err := msg.Decode(&res); err != nil {
+			return errResp(errDecode, "msg %v: %v", msg, err)
+		}
+		if h.syncer == nil {
+			return nil
+		}
+		return h.syncer.OnByteCodes(p, res.ID, res.Codes)
+
+	default:
+		return errResp(errInvalidMsgCode, "%v", msg.Code)
+	}
+}
+
+// serviceGetAccountRange assembles the response to an account range query. An
+// empty response without proofs is returned if the requested state is not
+// available locally.
+func serviceGetAccountRange(db wshdb.Database, req *getAccountRangeData) ([]*accountData, [][]byte) {
+	if req.Bytes > softResponseLimit {
+		req.Bytes = softResponseLimit
+	}
+	tr, err := trie.New(req.Root, db)
+	if err != nil {
+		return nil, nil
+	}
+	// Iterate over the requested range and pile accounts up
+	var (
+		accounts []*accountData
+		size     uint64
+	)
+	it := trie.NewIterator(tr.NodeIterator(req.Origin[:]))
+	for it.Next() && size < req.Bytes {
+		hash := common.BytesToHash(it.Key)
+		if bytes.Compare(hash[:], req.Limit[:]) > 0 {
+			break
+		}
+		accounts = append(accounts, &accountData{
+			Hash: hash,
+			Body: common.CopyBytes(it.Value),
+		})
+		size += uint64(common.HashLength + len(it.Value))
+	}
+	if it.Err != nil {
+		log.Debug("Failed to iterate account range", "root", req.Root, "err", it.Err)
+		return nil, nil
+	}
+	// Generate the Merkle proofs for the first and last account
+	proof, _ := wshdb.NewMemDatabase()
+	if err := tr.Prove(req.Origin[:], 0, proof); err != nil {
+		log.Warn("Failed to prove account range", "origin", req.Origin, "err", err)
+		return nil, nil
+	}
+	if len(accounts) > 0 {
+		if err := tr.Prove(accounts[len(accounts)-1].Hash[:], 0, proof); err != nil {
+			log.Warn("Failed to prove account range", "last", accounts[len(accounts)-1].Hash, "err", err)
+			return nil, nil
+		}
+	}
+	return accounts, proofNodes(proof)
+}
+
+// serviceGetStorageRanges assembles the response to a storage ranges query.
+// Proofs are only attached if the last served storage range is not complete.
+func serviceGetStorageRanges(db wshdb.Database, req *getStorageRangesData) ([][]*storageData, [][]byte) {
+	if req.Bytes > softResponseLimit {
+		req.Bytes = softResponseLimit
+	}
+	accTrie, err := trie.New(req.Root, db)
+	if err != nil {
+		return nil, nil
+	}
+	var (
+		slots [][]*storageData
+		proof [][]byte
+		size  uint64
+	)
+	for i, account := range req.Accounts {
+		// If we've exceeded the requested data limit, abort without opening
+		// a new storage range (that we'd need to prove due to exceeded size)
+		if size >= req.Bytes {
+			break
+		}
+		// The first account might start from a different origin and the last
+		// might end prematurely
+		var origin, limit common.Hash
+		if i == 0 && len(req.Origin) > 0 {
+			origin = common.BytesToHash(req.Origin)
+		}
+		limit = maxHash
+		if i == len(req.Accounts)-1 && len(req.Limit) > 0 {
+			limit = common.BytesToHash(req.Limit)
+		}
+		// Resolve the storage trie of the account
+		blob, err := accTrie.TryGet(account[:])
+		if err != nil || blob == nil {
+			break
+		}
+		var acc state.Account
+		if err := rlp.DecodeBytes(blob, &acc); err != nil {
+			break
+		}
+		stTrie, err := trie.New(acc.Root, db)
+		if err != nil {
+			break
+		}
+		// Retrieve the requested state and bail out if the size limit is exceeded
+		var (
+			storage []*storageData
+			abort   bool
+		)
+		it := trie.NewIterator(stTrie.NodeIterator(origin[:]))
+		for it.Next() {
+			if size >= req.Bytes {
+				abort = true
+				break
+			}
+			hash := common.BytesToHash(it.Key)
+			if bytes.Compare(hash[:], limit[:]) > 0 {
+				break
+			}
+			storage = append(storage, &storageData{
+				Hash: hash,
+				Body: common.CopyBytes(it.Value),
+			})
+			size += uint64(common.HashLength + len(it.Value))
+		}
+		if it.Err != nil {
+			break
+		}
+		slots = append(slots, storage)
+
+		// If the storage range was not served in full, generate the proofs of its
+		// boundaries and stop serving
+		if origin != (common.Hash{}) || abort {
+			db, _ := wshdb.NewMemDatabase()
+			if err := stTrie.Prove(origin[:], 0, db); err != nil {
+				log.Warn("Failed to prove storage range", "origin", origin, "err", err)
+				return nil, nil
+			}
+			if len(storage) > 0 {
+				if err := stTrie.Prove(storage[len(storage)-1].Hash[:], 0, db); err != nil {
+					log.Warn("Failed to prove storage range", "last", storage[len(storage)-1].Hash, "err", err)
+					return nil, nil
+				}
+			}
+			proof = proofNodes(db)
+			break
+		}
+	}
+	return slots, proof
+}
+
+// serviceGetByteCodes assembles the response to a bytecode query. Unknown codes
+// are silently skipped.
+func serviceGetByteCodes(db wshdb.Database, req *getByteCodesData) [][]byte {
+	if req.Bytes > softResponseLimit {
+		req.Bytes = softResponseLimit
+	}
+	if len(req.Hashes) > maxCodeLookups {
+		req.Hashes = req.Hashes[:maxCodeLookups]
+	}
+	var (
+		codes [][]byte
+		size  uint64
+	)
+	for _, hash := range req.Hashes {
+		if hash == emptyCode {
+			// Peers should not request the empty code, but if they do, at
+			// least sent them back a correct response without db lookups
+			codes = append(codes, []byte{})
+		} else if blob, err := db.Get(hash[:]); err == nil && len(blob) > 0 {
+			codes = append(codes, blob)
+			size += uint64(len(blob))
+		}
+		if size > req.Bytes {
+			break
+		}
+	}
+	return codes
+}
+
+// proofNodes flattens a proof database into the list of its trie nodes, ordered
+// by hash to keep responses deterministic.
+func proofNodes(db *wshdb.MemDatabase) [][]byte {
+	keys := db.Keys()
+	sort.Slice(keys, func(i, j int) bool { return bytes.Compare(keys[i], keys[j]) < 0 })
+
+	var nodes [][]byte
+	for _, key := range keys {
+		blob, _ := db.Get(key)
+		nodes = append(nodes, blob)
+	}
+	return nodes
+}
@@ -0,0 +1,94 @@
+// Copyright 2018 The go-wiseplat Authors
+// This file is part of the go-wiseplat library.
+//
+// The go-wiseplat library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-wiseplat library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-wiseplat library. If not, see <http://www.gnu.org/licenses/>.
+
+package snap
+
+import (
+	"testing"
+
+	"github.com/wiseplat/go-wiseplat/common"
+	"github.com/wiseplat/go-wiseplat/crypto"
+	"github.com/wiseplat/go-wiseplat/p2p"
+	"github.com/wiseplat/go-wiseplat/p2p/discover"
+)
+
+// newTestHandlerPeer starts serving a snap handler over an in-memory pipe,
+// returning the remote end of the connection and a channel receiving the
+// handler's termination error.
+func newTestHandlerPeer(h *Handler) (*p2p.MsgPipeRW, <-chan error) {
+	app, net := p2p.MsgPipe()
+
+	var id discover.NodeID
+	copy(id[:], crypto.Keccak256([]byte("snap-tester")))
+
+	errc := make(chan error, 1)
+	go func() { errc <- h.handle(newPeer(snap1, p2p.NewPeer(id, "tester", nil), net)) }()
+	return app, errc
+}
+
+// Tests that account range, storage range and bytecode requests are served from
+// the local database.
+func TestHandlerServeRequests(t *testing.T) {
+	db, root := makeTestState()
+
+	app, errc := newTestHandlerPeer(NewHandler(db, nil))
+	defer app.Close()
+
+	// Request an account range and check the response
+	req := &getAccountRangeData{ID: 1, Root: root, Limit: maxHash, Bytes: 4096}
+	if err := p2p.Send(app, GetAccountRangeMsg, req); err != nil {
+		t.Fatalf("failed to send account range request: %v", err)
+	}
+	accounts, proof := serviceGetAccountRange(db, &getAccountRangeData{ID: 1, Root: root, Limit: maxHash, Bytes: 4096})
+	if len(accounts) == 0 || len(proof) == 0 {
+		t.Fatalf("empty account range served: %d accounts, %d proof nodes", len(accounts), len(proof))
+	}
+	if err := p2p.ExpectMsg(app, AccountRangeMsg, &accountRangeData{ID: 1, Accounts: accounts, Proof: proof}); err != nil {
+		t.Fatalf("account range response mismatch: %v", err)
+	}
+	// Request the storage of some accounts and check the response
+	hashes := []common.Hash{accounts[0].Hash, accounts[1].Hash}
+	if err := p2p.Send(app, GetStorageRangesMsg, &getStorageRangesData{ID: 2, Root: root, Accounts: hashes, Bytes: 4096}); err != nil {
+		t.Fatalf("failed to send storage ranges request: %v", err)
+	}
+	slots, proof := serviceGetStorageRanges(db, &getStorageRangesData{ID: 2, Root: root, Accounts: hashes, Bytes: 4096})
+	if err := p2p.ExpectMsg(app, StorageRangesMsg, &storageRangesData{ID: 2, Slots: slots, Proof: proof}); err != nil {
+		t.Fatalf("storage ranges response mismatch: %v", err)
+	}
+	// Request some bytecodes, both known and unknown, and check the response
+	code := []byte("large storage contract")
+	codeHashes := []common.Hash{crypto.Keccak256Hash(code), {0x01}, emptyCode}
+	if err := p2p.Send(app, GetByteCodesMsg, &getByteCodesData{ID: 3, Hashes: codeHashes, Bytes: 4096}); err != nil {
+		t.Fatalf("failed to send bytecodes request: %v", err)
+	}
+	if err := p2p.ExpectMsg(app, ByteCodesMsg, &byteCodesData{ID: 3, Codes: [][]byte{code, {}}}); err != nil {
+		t.Fatalf("bytecodes response mismatch: %v", err)
+	}
+	// Request an account range of an unknown state and check the empty response
+	if err := p2p.Send(app, GetAccountRangeMsg, &getAccountRangeData{ID: 4, Root: common.Hash{0x01}, Limit: maxHash, Bytes: 4096}); err != nil {
+		t.Fatalf("failed to send account range request: %v", err)
+	}
+	if err := p2p.ExpectMsg(app, AccountRangeMsg, &accountRangeData{ID: 4}); err != nil {
+		t.Fatalf("unknown state response mismatch: %v", err)
+	}
+	// Send an invalid message and ensure the peer is disconnected
+	if err := p2p.Send(app, ProtocolLengths[0], struct{}{}); err != nil {
+		t.Fatalf("failed to send invalid message: %v", err)
+	}
+	if err := <-errc; err == nil {
+		t.Fatalf("invalid message accepted")
+	}
+}
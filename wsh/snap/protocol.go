@@ -0,0 +1,132 @@
+// Copyright 2018 The go-wiseplat Authors
+// This file is part of the go-wiseplat library.
+//
+// The go-wiseplat library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-wiseplat library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-wiseplat library. If not, see <http://www.gnu.org/licenses/>.
+
+// Package snap implements the snap protocol, a state synchronisation protocol
+// retrieving contiguous ranges of accounts and storage slots instead of single
+// trie nodes.
+package snap
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/wiseplat/go-wiseplat/common"
+	"github.com/wiseplat/go-wiseplat/rlp"
+)
+
+// Constants to match up protocol versions and messages
+const (
+	snap1 = 1
+)
+
+// ProtocolName is the official short name of the protocol used during capability
+// negotiation.
+var ProtocolName = "snap"
+
+// ProtocolVersions are the supported versions of the snap protocol (first is
+// primary).
+var ProtocolVersions = []uint{snap1}
+
+// ProtocolLengths are the number of implemented messages corresponding to
+// different protocol versions.
+var ProtocolLengths = []uint64{6}
+
+// ProtocolMaxMsgSize is the maximum cap on the size of a protocol message.
+const ProtocolMaxMsgSize = 10 * 1024 * 1024
+
+// snap protocol message codes
+const (
+	GetAccountRangeMsg  = 0x00
+	AccountRangeMsg     = 0x01
+	GetStorageRangesMsg = 0x02
+	StorageRangesMsg    = 0x03
+	GetByteCodesMsg     = 0x04
+	ByteCodesMsg        = 0x05
+)
+
+var (
+	errMsgTooLarge    = errors.New("message too long")
+	errDecode         = errors.New("invalid message")
+	errInvalidMsgCode = errors.New("invalid message code")
+)
+
+// getAccountRangeData is the network packet requesting the accounts of a state
+// trie between origin and limit (inclusive), at most up to bytes in size.
+type getAccountRangeData struct {
+	ID     uint64      // Request ID to match up responses with
+	Root   common.Hash // Root hash of the account trie to serve
+	Origin common.Hash // Hash of the first account to retrieve
+	Limit  common.Hash // Hash of the last account to retrieve
+	Bytes  uint64      // Soft limit at which to stop returning data
+}
+
+// accountRangeData is the network packet answering an account range request,
+// with the Merkle proofs of the origin and the last returned account.
+type accountRangeData struct {
+	ID       uint64         // ID of the request this is a response for
+	Accounts []*accountData // List of consecutive accounts from the trie
+	Proof    [][]byte       // List of trie nodes proving the account range
+}
+
+// accountData represents a single account in a range response.
+type accountData struct {
+	Hash common.Hash  // Hash of the account
+	Body rlp.RawValue // Account body in the trie encoding
+}
+
+// getStorageRangesData is the network packet requesting the storage slots of a
+// batch of accounts. Origin and limit only apply to the first and last account
+// respectively, allowing the continuation of a large storage trie.
+type getStorageRangesData struct {
+	ID       uint64        // Request ID to match up responses with
+	Root     common.Hash   // Root hash of the account trie to serve
+	Accounts []common.Hash // Account hashes of the storage tries to serve
+	Origin   []byte        // Hash of the first storage slot to retrieve (large contract mode)
+	Limit    []byte        // Hash of the last storage slot to retrieve (large contract mode)
+	Bytes    uint64        // Soft limit at which to stop returning data
+}
+
+// storageRangesData is the network packet answering a storage ranges request.
+// If the last storage range is incomplete or started from a non-zero origin, the
+// Merkle proofs of its boundaries are attached.
+type storageRangesData struct {
+	ID    uint64           // ID of the request this is a response for
+	Slots [][]*storageData // Lists of consecutive storage slots for the requested accounts
+	Proof [][]byte         // Merkle proofs for the *last* slot range, if it's incomplete
+}
+
+// storageData represents a single storage slot in a range response.
+type storageData struct {
+	Hash common.Hash // Hash of the storage slot
+	Body []byte      // Data content of the slot in the trie encoding
+}
+
+// getByteCodesData is the network packet requesting a batch of contract codes.
+type getByteCodesData struct {
+	ID     uint64        // Request ID to match up responses with
+	Hashes []common.Hash // Code hashes to retrieve the code for
+	Bytes  uint64        // Soft limit at which to stop returning data
+}
+
+// byteCodesData is the network packet answering a bytecodes request.
+type byteCodesData struct {
+	ID    uint64   // ID of the request this is a response for
+	Codes [][]byte // Requested contract bytecodes
+}
+
+func errResp(err error, format string, v ...interface{}) error {
+	return fmt.Errorf("%v - %v", err, fmt.Sprintf(format, v...))
+}
@@ -0,0 +1,1240 @@
+// Copyright 2018 The go-wiseplat Authors
+// This file is part of the go-wiseplat library.
+//
+// The go-wiseplat library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-wiseplat library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-wiseplat library. If not, see <http://www.gnu.org/licenses/>.
+
+package snap
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/wiseplat/go-wiseplat/common"
+	"github.com/wiseplat/go-wiseplat/core/state"
+	"github.com/wiseplat/go-wiseplat/crypto"
+	"github.com/wiseplat/go-wiseplat/crypto/sha3"
+	"github.com/wiseplat/go-wiseplat/log"
+	"github.com/wiseplat/go-wiseplat/rlp"
+	"github.com/wiseplat/go-wiseplat/trie"
+	"github.com/wiseplat/go-wiseplat/wshdb"
+)
+
+var (
+	// emptyRoot is the known root hash of an empty trie.
+	emptyRoot = common.HexToHash("56e81f171bcc55a6ff8345e692c0f86e5b48e01b996cadc001622fb5e363b421")
+
+	// emptyCode is the known hash of the empty EVM bytecode.
+	emptyCode = crypto.Keccak256Hash(nil)
+
+	// maxHash is the last possible hash, the upper bound of all key ranges.
+	maxHash = common.HexToHash("0xffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff")
+
+	// syncStatusKey is the database key of the progress of an interrupted sync.
+	syncStatusKey = []byte("SnapshotSyncStatus")
+)
+
+const (
+	// maxRequestSize is the maximum number of bytes to request from a remote peer.
+	maxRequestSize = 512 * 1024
+
+	// maxCodeRequestCount is the maximum number of bytecode blobs to request in a
+	// single query.
+	maxCodeRequestCount = 128
+
+	// maxStorageSetRequestCount is the maximum number of contracts to request the
+	// storage of in a single query.
+	maxStorageSetRequestCount = 64
+
+	// requestTimeout is the maximum time a peer is allowed to spend on serving a
+	// single network request.
+	requestTimeout = 10 * time.Second
+
+	// accountConcurrency is the number of chunks to split the account trie into
+	// to allow concurrent retrievals.
+	accountConcurrency = 16
+)
+
+var (
+	errCancelled   = errors.New("sync cancelled")
+	errNoSyncPeers = errors.New("no snapshot peers serving the requested state")
+	errAlreadyReg  = errors.New("peer is already registered")
+)
+
+// SyncPeer abstracts out the methods required for a peer to be synced against
+// with the goal of allowing the construction of mock peers without the full
+// blown networking.
+type SyncPeer interface {
+	// ID retrieves the peer's unique identifier.
+	ID() string
+
+	// RequestAccountRange fetches a batch of accounts rooted in a specific account
+	// trie, starting with the origin.
+	RequestAccountRange(id uint64, root, origin, limit common.Hash, bytes uint64) error
+
+	// RequestStorageRanges fetches a batch of storage slots belonging to one or
+	// more accounts. If slots from only one account is requested, an origin marker
+	// may also be used to retrieve from there.
+	RequestStorageRanges(id uint64, root common.Hash, accounts []common.Hash, origin, limit []byte, bytes uint64) error
+
+	// RequestByteCodes fetches a batch of bytecodes by hash.
+	RequestByteCodes(id uint64, hashes []common.Hash, bytes uint64) error
+
+	// Log retrieves the peer's own contextual logger.
+	Log() log.Logger
+}
+
+// accountRequest tracks a pending account range request to ensure responses are
+// to actual requests and to validate any security constraints.
+type accountRequest struct {
+	peer string // Peer to which this request is assigned
+	id   uint64 // Request ID of this request
+
+	cancel  chan struct{} // Channel to track sync cancellation
+	timeout *time.Timer   // Timer to track delivery timeout
+
+	origin common.Hash  // First account requested to allow continuation checks
+	limit  common.Hash  // Last account requested to allow non-overlapping chunking
+	task   *accountTask // Task which this request is filling
+}
+
+// accountResponse is an already verified remote response to an account range
+// request.
+type accountResponse struct {
+	task *accountTask // Task which this request is filling
+
+	hashes   []common.Hash    // Account hashes in the returned range
+	accounts []*state.Account // Expanded accounts in the returned range
+	raws     [][]byte         // Accounts in their trie encoding
+}
+
+// codeRequest tracks a pending bytecode request.
+type codeRequest struct {
+	peer string // Peer to which this request is assigned
+	id   uint64 // Request ID of this request
+
+	cancel  chan struct{} // Channel to track sync cancellation
+	timeout *time.Timer   // Timer to track delivery timeout
+
+	hashes []common.Hash // Bytecode hashes to validate responses
+}
+
+// codeResponse is an already verified remote response to a bytecode request.
+type codeResponse struct {
+	req   *codeRequest           // Original request this response belongs to
+	codes map[common.Hash][]byte // Delivered bytecodes keyed by their hash
+}
+
+// storageRequest tracks a pending storage ranges request.
+type storageRequest struct {
+	peer string // Peer to which this request is assigned
+	id   uint64 // Request ID of this request
+
+	cancel  chan struct{} // Channel to track sync cancellation
+	timeout *time.Timer   // Timer to track delivery timeout
+
+	accounts []common.Hash // Account hashes to validate responses
+	roots    []common.Hash // Storage roots to validate responses
+	origin   common.Hash   // First storage slot requested (large contract mode)
+	large    *storageTask  // Large contract task being continued, if any
+}
+
+// storageResponse is an already verified remote response to a storage request.
+type storageResponse struct {
+	req *storageRequest // Original request this response belongs to
+
+	hashes [][]common.Hash // Storage slot hashes in the returned ranges
+	slots  [][][]byte      // Storage slot values in the returned ranges
+	cont   bool            // Whether the last storage range has a continuation
+}
+
+// accountTask represents the sync task for a chunk of the account snapshot.
+type accountTask struct {
+	Next common.Hash // Next account to sync in this interval
+	Last common.Hash // Last account to sync in this interval
+
+	req *accountRequest  // Pending request to fill this task
+	res *accountResponse // Validated response waiting on code and storage
+
+	needCode  map[common.Hash]struct{} // Bytecodes still missing from the pending response
+	needState map[common.Hash]struct{} // Storage tries still missing from the pending response
+	needHeal  map[common.Hash]struct{} // Accounts whose storage tries are left for healing
+
+	trie *trie.Trie // Account trie being generated for this chunk
+	done bool       // Flag whether the task has been fully synced
+}
+
+// syncProgress is the database representation of an interrupted sync cycle: the
+// remaining account ranges of the state trie being synced. Code and storage are
+// not tracked, as they are written out before the account ranges advance.
+type syncProgress struct {
+	Root  common.Hash    // State trie root being synced
+	Tasks []*accountTask // Account ranges still to be synced
+}
+
+// storageTask represents the continued sync of a single storage trie too large
+// to fit into a single response.
+type storageTask struct {
+	account common.Hash // Hash of the account owning the storage
+	root    common.Hash // Storage root the retrieved slots must add up to
+	next    common.Hash // Next storage slot to sync
+
+	req  *storageRequest // Pending request to fill this task
+	trie *trie.Trie      // Storage trie being accumulated in memory
+}
+
+// Syncer is a state retriever that downloads the accounts and storage slots of
+// a state trie in contiguous ranges via the snap protocol. Each range is checked
+// against the Merkle proofs of its boundaries and the retrieved data is written
+// out as trie nodes. The trie nodes not reconstructible from the ranges (and any
+// data dishonest peers might have withheld) need to be healed afterwards by the
+// regular node by node state sync.
+type Syncer struct {
+	db wshdb.Database // Database to store the synced state into
+
+	root  common.Hash    // Current state trie root being synced
+	tasks []*accountTask // Current account task set being synced
+
+	update chan struct{}       // Notification channel for possible sync progression
+	peers  map[string]SyncPeer // Currently active peers to download from
+
+	idlers    map[string]struct{} // Peers that aren't serving requests
+	stateless map[string]struct{} // Peers that failed to deliver the current state
+
+	accountReqs map[uint64]*accountRequest // Account requests currently running
+	codeReqs    map[uint64]*codeRequest    // Bytecode requests currently running
+	storageReqs map[uint64]*storageRequest // Storage requests currently running
+
+	codeTasks    map[common.Hash]struct{}     // Bytecodes waiting to be requested
+	storageTasks map[common.Hash]common.Hash  // Small storage tries waiting to be requested
+	largeTasks   map[common.Hash]*storageTask // Large storage tries being continued
+
+	accountResps chan *accountResponse // Validated account ranges to process
+	codeResps    chan *codeResponse    // Validated bytecodes to process
+	storageResps chan *storageResponse // Validated storage ranges to process
+
+	accountReqFails chan *accountRequest // Failed account requests to revert
+	codeReqFails    chan *codeRequest    // Failed bytecode requests to revert
+	storageReqFails chan *storageRequest // Failed storage requests to revert
+
+	accountSynced  uint64             // Number of accounts downloaded
+	accountBytes   common.StorageSize // Number of account trie bytes persisted to disk
+	bytecodeSynced uint64             // Number of bytecodes downloaded
+	bytecodeBytes  common.StorageSize // Number of bytecode bytes downloaded
+	storageSynced  uint64             // Number of storage slots downloaded
+	storageBytes   common.StorageSize // Number of storage trie bytes persisted to disk
+
+	pending int // Number of responses or failures being handed to the event loop
+
+	lock sync.RWMutex // Protects fields that can change outside of sync (peers, reqs, root)
+}
+
+// NewSyncer creates a new snapshot syncer to download the state into db.
+func NewSyncer(db wshdb.Database) *Syncer {
+	return &Syncer{
+		db:              db,
+		update:          make(chan struct{}, 1),
+		peers:           make(map[string]SyncPeer),
+		idlers:          make(map[string]struct{}),
+		stateless:       make(map[string]struct{}),
+		accountReqs:     make(map[uint64]*accountRequest),
+		codeReqs:        make(map[uint64]*codeRequest),
+		storageReqs:     make(map[uint64]*storageRequest),
+		accountResps:    make(chan *accountResponse),
+		codeResps:       make(chan *codeResponse),
+		storageResps:    make(chan *storageResponse),
+		accountReqFails: make(chan *accountRequest),
+		codeReqFails:    make(chan *codeRequest),
+		storageReqFails: make(chan *storageRequest),
+	}
+}
+
+// Register injects a new data source into the syncer's peerset.
+func (s *Syncer) Register(peer SyncPeer) error {
+	id := peer.ID()
+
+	s.lock.Lock()
+	if _, ok := s.peers[id]; ok {
+		s.lock.Unlock()
+		return errAlreadyReg
+	}
+	s.peers[id] = peer
+	s.idlers[id] = struct{}{}
+	s.lock.Unlock()
+
+	// Notify any active syncs that a new peer can be assigned data
+	s.notify()
+	return nil
+}
+
+// Unregister removes a data source from the syncer's peerset. Any requests still
+// pending at the peer are reassigned once they time out.
+func (s *Syncer) Unregister(id string) error {
+	s.lock.Lock()
+	delete(s.peers, id)
+	delete(s.idlers, id)
+	s.lock.Unlock()
+
+	s.notify()
+	return nil
+}
+
+// Sync starts (or resumes a previous) sync cycle to iterate over a state trie
+// with the given root and reconstruct the nodes based on the snapshot leaves.
+// It returns when the whole account range was retrieved, when the sync gets
+// cancelled, or when no peers are left to serve the requested state. The
+// progress of an interrupted cycle is persisted, so a later one for the same
+// root (even after a restart) only retrieves the remaining account ranges.
+func (s *Syncer) Sync(root common.Hash, cancel chan struct{}) error {
+	s.lock.Lock()
+	s.root = root
+	s.tasks = s.loadSyncStatus(root)
+	s.stateless = make(map[string]struct{})
+	s.pending = 0
+	for id := range s.peers {
+		s.idlers[id] = struct{}{}
+	}
+	s.codeTasks = make(map[common.Hash]struct{})
+	s.storageTasks = make(map[common.Hash]common.Hash)
+	s.largeTasks = make(map[common.Hash]*storageTask)
+	s.accountSynced, s.accountBytes = 0, 0
+	s.bytecodeSynced, s.bytecodeBytes = 0, 0
+	s.storageSynced, s.storageBytes = 0, 0
+	s.lock.Unlock()
+
+	defer func() {
+		// Whether sync completed or not, disregard any future packets
+		s.saveSyncStatus()
+		s.lock.Lock()
+		for id, req := range s.accountReqs {
+			req.timeout.Stop()
+			delete(s.accountReqs, id)
+		}
+		for id, req := range s.codeReqs {
+			req.timeout.Stop()
+			delete(s.codeReqs, id)
+		}
+		for id, req := range s.storageReqs {
+			req.timeout.Stop()
+			delete(s.storageReqs, id)
+		}
+		s.lock.Unlock()
+	}()
+	log.Debug("Starting snapshot sync cycle", "root", root)
+	start := time.Now()
+
+	for {
+		// Remove all completed tasks and terminate sync if everything's done
+		s.cleanAccountTasks()
+		if len(s.tasks) == 0 {
+			log.Info("Snapshot sync complete", "root", root, "accounts", s.accountSynced, "accountbytes", s.accountBytes,
+				"codes", s.bytecodeSynced, "codebytes", s.bytecodeBytes, "slots", s.storageSynced, "storagebytes", s.storageBytes,
+				"elapsed", common.PrettyDuration(time.Since(start)))
+			return nil
+		}
+		// Assign all the data retrieval tasks to any free peers
+		s.assignAccountTasks(cancel)
+		s.assignBytecodeTasks(cancel)
+		s.assignStorageTasks(cancel)
+
+		// If nothing's in flight and nobody can take over, give up
+		if !s.progressable() {
+			return errNoSyncPeers
+		}
+		// Wait for something to happen
+		select {
+		case <-s.update:
+			// Something happened (new peer, delivery, timeout), recheck tasks
+		case <-cancel:
+			return errCancelled
+
+		case req := <-s.accountReqFails:
+			s.revertAccountRequest(req)
+		case req := <-s.codeReqFails:
+			s.revertCodeRequest(req)
+		case req := <-s.storageReqFails:
+			s.revertStorageRequest(req)
+
+		case res := <-s.accountResps:
+			s.processAccountResponse(res)
+		case res := <-s.codeResps:
+			s.processBytecodeResponse(res)
+		case res := <-s.storageResps:
+			s.processStorageResponse(res)
+		}
+	}
+}
+
+// loadSyncStatus retrieves the account ranges left by an interrupted sync cycle
+// of the given root, or splits up the entire account hash space if there's none.
+func (s *Syncer) loadSyncStatus(root common.Hash) []*accountTask {
+	if blob, err := s.db.Get(syncStatusKey); err == nil {
+		var progress syncProgress
+		if err := json.Unmarshal(blob, &progress); err != nil {
+			log.Error("Failed to decode snapshot sync status", "err", err)
+		} else if progress.Root == root && len(progress.Tasks) > 0 {
+			// The account tries are rebuilt from the resumed ranges onward, any nodes
+			// crossing the interruption points are fixed up by healing
+			for _, task := range progress.Tasks {
+				task.trie, _ = trie.New(common.Hash{}, s.db)
+			}
+			log.Debug("Resuming snapshot sync cycle", "root", root, "ranges", len(progress.Tasks))
+			return progress.Tasks
+		}
+	}
+	return newAccountTasks(s.db)
+}
+
+// saveSyncStatus persists the account ranges still to be synced, so that an
+// interrupted sync cycle can be resumed, or deletes the status if it completed.
+// Any account range responses not yet written out are retrieved again.
+func (s *Syncer) saveSyncStatus() {
+	s.cleanAccountTasks()
+	if len(s.tasks) == 0 {
+		if err := s.db.Delete(syncStatusKey); err != nil {
+			log.Error("Failed to delete snapshot sync status", "err", err)
+		}
+		return
+	}
+	blob, err := json.Marshal(&syncProgress{Root: s.root, Tasks: s.tasks})
+	if err != nil {
+		log.Crit("Failed to encode snapshot sync status", "err", err)
+	}
+	if err := s.db.Put(syncStatusKey, blob); err != nil {
+		log.Crit("Failed to store snapshot sync status", "err", err)
+	}
+}
+
+// newAccountTasks splits the account hash space into accountConcurrency chunks
+// that can be synced concurrently.
+func newAccountTasks(db wshdb.Database) []*accountTask {
+	var (
+		next  common.Hash
+		tasks []*accountTask
+		step  = new(big.Int).Sub(new(big.Int).Div(new(big.Int).Lsh(common.Big1, 256), big.NewInt(accountConcurrency)), common.Big1)
+	)
+	for i := 0; i < accountConcurrency; i++ {
+		last := common.BigToHash(new(big.Int).Add(next.Big(), step))
+		if i == accountConcurrency-1 {
+			// Make sure we don't overflow if the step is not a proper divisor
+			last = maxHash
+		}
+		tr, _ := trie.New(common.Hash{}, db)
+		tasks = append(tasks, &accountTask{
+			Next: next,
+			Last: last,
+			trie: tr,
+		})
+		next = common.BigToHash(new(big.Int).Add(last.Big(), common.Big1))
+	}
+	return tasks
+}
+
+// cleanAccountTasks removes account range retrieval tasks that have already been
+// completed.
+func (s *Syncer) cleanAccountTasks() {
+	for i := 0; i < len(s.tasks); i++ {
+		if s.tasks[i].done {
+			s.tasks = append(s.tasks[:i], s.tasks[i+1:]...)
+			i--
+		}
+	}
+}
+
+// progressable checks whether there are any requests in flight or any peers that
+// can still be assigned work.
+func (s *Syncer) progressable() bool {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	if len(s.accountReqs) > 0 || len(s.codeReqs) > 0 || len(s.storageReqs) > 0 || s.pending > 0 {
+		return true
+	}
+	return len(s.idlers) > 0
+}
+
+// notify signals the sync loop that something changed which might allow it to
+// make progress.
+func (s *Syncer) notify() {
+	select {
+	case s.update <- struct{}{}:
+	default:
+	}
+}
+
+// delivered marks a response or failure handed to the event loop as consumed and
+// notifies the loop to recheck whether the sync can still progress.
+func (s *Syncer) delivered() {
+	s.lock.Lock()
+	s.pending--
+	s.lock.Unlock()
+
+	s.notify()
+}
+
+// idlePeer picks an idle peer able to serve the current state and marks it busy.
+// The caller must hold the lock.
+func (s *Syncer) idlePeer() SyncPeer {
+	for id := range s.idlers {
+		delete(s.idlers, id)
+		if peer, ok := s.peers[id]; ok {
+			return peer
+		}
+	}
+	return nil
+}
+
+// markIdle marks a peer as available for new requests, unless it already proved
+// unable to serve the current state. The caller must hold the lock.
+func (s *Syncer) markIdle(id string) {
+	if _, ok := s.peers[id]; !ok {
+		return
+	}
+	if _, ok := s.stateless[id]; ok {
+		return
+	}
+	s.idlers[id] = struct{}{}
+}
+
+// markStateless excludes a peer from serving the current sync cycle.
+func (s *Syncer) markStateless(id string) {
+	s.lock.Lock()
+	s.stateless[id] = struct{}{}
+	delete(s.idlers, id)
+	s.lock.Unlock()
+}
+
+// newRequestID generates a request ID unique among the currently running ones.
+// The caller must hold the lock.
+func (s *Syncer) newRequestID() uint64 {
+	for {
+		id := uint64(rand.Int63())
+		if _, ok := s.accountReqs[id]; ok {
+			continue
+		}
+		if _, ok := s.codeReqs[id]; ok {
+			continue
+		}
+		if _, ok := s.storageReqs[id]; ok {
+			continue
+		}
+		return id
+	}
+}
+
+// assignAccountTasks attempts to match idle peers to pending account range
+// retrievals.
+func (s *Syncer) assignAccountTasks(cancel chan struct{}) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	for _, task := range s.tasks {
+		// Skip any tasks already filling or waiting on storage and code
+		if task.req != nil || task.res != nil || task.done {
+			continue
+		}
+		peer := s.idlePeer()
+		if peer == nil {
+			return
+		}
+		req := &accountRequest{
+			peer:   peer.ID(),
+			id:     s.newRequestID(),
+			cancel: cancel,
+			origin: task.Next,
+			limit:  task.Last,
+			task:   task,
+		}
+		req.timeout = time.AfterFunc(requestTimeout, func() {
+			peer.Log().Debug("Account range request timed out", "reqid", req.id)
+			s.markStateless(req.peer)
+			s.scheduleRevertAccountRequest(req)
+		})
+		s.accountReqs[req.id] = req
+		task.req = req
+
+		go func(root common.Hash) {
+			if err := peer.RequestAccountRange(req.id, root, req.origin, req.limit, maxRequestSize); err != nil {
+				peer.Log().Debug("Failed to request account range", "err", err)
+				s.scheduleRevertAccountRequest(req)
+			}
+		}(s.root)
+	}
+}
+
+// assignBytecodeTasks attempts to match idle peers to pending code retrievals.
+func (s *Syncer) assignBytecodeTasks(cancel chan struct{}) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	for len(s.codeTasks) > 0 {
+		peer := s.idlePeer()
+		if peer == nil {
+			return
+		}
+		hashes := make([]common.Hash, 0, maxCodeRequestCount)
+		for hash := range s.codeTasks {
+			delete(s.codeTasks, hash)
+			hashes = append(hashes, hash)
+			if len(hashes) >= maxCodeRequestCount {
+				break
+			}
+		}
+		req := &codeRequest{
+			peer:   peer.ID(),
+			id:     s.newRequestID(),
+			cancel: cancel,
+			hashes: hashes,
+		}
+		req.timeout = time.AfterFunc(requestTimeout, func() {
+			peer.Log().Debug("Bytecode request timed out", "reqid", req.id)
+			s.markStateless(req.peer)
+			s.scheduleRevertCodeRequest(req)
+		})
+		s.codeReqs[req.id] = req
+
+		go func() {
+			if err := peer.RequestByteCodes(req.id, req.hashes, maxRequestSize); err != nil {
+				peer.Log().Debug("Failed to request bytecodes", "err", err)
+				s.scheduleRevertCodeRequest(req)
+			}
+		}()
+	}
+}
+
+// assignStorageTasks attempts to match idle peers to pending storage range
+// retrievals, continuing large storage tries first.
+func (s *Syncer) assignStorageTasks(cancel chan struct{}) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	for _, task := range s.largeTasks {
+		if task.req != nil {
+			continue
+		}
+		peer := s.idlePeer()
+		if peer == nil {
+			return
+		}
+		req := &storageRequest{
+			peer:     peer.ID(),
+			id:       s.newRequestID(),
+			cancel:   cancel,
+			accounts: []common.Hash{task.account},
+			roots:    []common.Hash{task.root},
+			origin:   task.next,
+			large:    task,
+		}
+		s.startStorageRequest(peer, req)
+		task.req = req
+	}
+	for len(s.storageTasks) > 0 {
+		peer := s.idlePeer()
+		if peer == nil {
+			return
+		}
+		req := &storageRequest{
+			peer:   peer.ID(),
+			id:     s.newRequestID(),
+			cancel: cancel,
+		}
+		for account, root := range s.storageTasks {
+			delete(s.storageTasks, account)
+			req.accounts = append(req.accounts, account)
+			req.roots = append(req.roots, root)
+			if len(req.accounts) >= maxStorageSetRequestCount {
+				break
+			}
+		}
+		s.startStorageRequest(peer, req)
+	}
+}
+
+// startStorageRequest tracks and sends out a storage request. The caller must
+// hold the lock.
+func (s *Syncer) startStorageRequest(peer SyncPeer, req *storageRequest) {
+	req.timeout = time.AfterFunc(requestTimeout, func() {
+		peer.Log().Debug("Storage request timed out", "reqid", req.id)
+		s.markStateless(req.peer)
+		s.scheduleRevertStorageRequest(req)
+	})
+	s.storageReqs[req.id] = req
+
+	var origin, limit []byte
+	if req.large != nil {
+		origin, limit = req.origin[:], maxHash[:]
+	}
+	go func(root common.Hash) {
+		if err := peer.RequestStorageRanges(req.id, root, req.accounts, origin, limit, maxRequestSize); err != nil {
+			peer.Log().Debug("Failed to request storage", "err", err)
+			s.scheduleRevertStorageRequest(req)
+		}
+	}(s.root)
+}
+
+// scheduleRevertAccountRequest asks the event loop to clean up an account range
+// request and return all failed retrieval tasks to the scheduler for reassignment.
+func (s *Syncer) scheduleRevertAccountRequest(req *accountRequest) {
+	s.lock.Lock()
+	if _, ok := s.accountReqs[req.id]; !ok {
+		s.lock.Unlock()
+		return // Already delivered or reverted
+	}
+	delete(s.accountReqs, req.id)
+	req.timeout.Stop()
+	s.pending++
+	s.lock.Unlock()
+
+	s.revertAccountLater(req)
+}
+
+// scheduleRevertCodeRequest asks the event loop to clean up a bytecode request
+// and return all failed retrieval tasks to the scheduler for reassignment.
+func (s *Syncer) scheduleRevertCodeRequest(req *codeRequest) {
+	s.lock.Lock()
+	if _, ok := s.codeReqs[req.id]; !ok {
+		s.lock.Unlock()
+		return // Already delivered or reverted
+	}
+	delete(s.codeReqs, req.id)
+	req.timeout.Stop()
+	s.pending++
+	s.lock.Unlock()
+
+	s.revertCodeLater(req)
+}
+
+// scheduleRevertStorageRequest asks the event loop to clean up a storage request
+// and return all failed retrieval tasks to the scheduler for reassignment.
+func (s *Syncer) scheduleRevertStorageRequest(req *storageRequest) {
+	s.lock.Lock()
+	if _, ok := s.storageReqs[req.id]; !ok {
+		s.lock.Unlock()
+		return // Already delivered or reverted
+	}
+	delete(s.storageReqs, req.id)
+	req.timeout.Stop()
+	s.pending++
+	s.lock.Unlock()
+
+	s.revertStorageLater(req)
+}
+
+// revertAccountRequest returns a failed account range to the scheduler.
+func (s *Syncer) revertAccountRequest(req *accountRequest) {
+	if req.task.req == req {
+		req.task.req = nil
+	}
+}
+
+// revertCodeRequest returns the bytecodes of a failed request to the scheduler.
+func (s *Syncer) revertCodeRequest(req *codeRequest) {
+	for _, hash := range req.hashes {
+		s.codeTasks[hash] = struct{}{}
+	}
+}
+
+// revertStorageRequest returns the storage tries of a failed request to the
+// scheduler.
+func (s *Syncer) revertStorageRequest(req *storageRequest) {
+	if req.large != nil {
+		if req.large.req == req {
+			req.large.req = nil
+		}
+		return
+	}
+	for i, account := range req.accounts {
+		s.storageTasks[account] = req.roots[i]
+	}
+}
+
+// processAccountResponse integrates an already validated account range response
+// into the account tasks, scheduling the retrieval of any missing storage tries
+// and bytecodes it references.
+func (s *Syncer) processAccountResponse(res *accountResponse) {
+	task := res.task
+	task.req = nil
+
+	// An empty (but proven) range means there are no more accounts in the chunk
+	if len(res.hashes) == 0 {
+		task.done = true
+		return
+	}
+	s.accountSynced += uint64(len(res.hashes))
+
+	// Gather all the code and storage the accounts depend on
+	task.res = res
+	task.needCode = make(map[common.Hash]struct{})
+	task.needState = make(map[common.Hash]struct{})
+	task.needHeal = make(map[common.Hash]struct{})
+
+	for i, account := range res.accounts {
+		if code := common.BytesToHash(account.CodeHash); code != emptyCode {
+			if ok, _ := s.db.Has(code[:]); !ok {
+				task.needCode[code] = struct{}{}
+				s.codeTasks[code] = struct{}{}
+			}
+		}
+		if account.Root != emptyRoot {
+			if ok, _ := s.db.Has(account.Root[:]); !ok {
+				task.needState[res.hashes[i]] = struct{}{}
+				s.storageTasks[res.hashes[i]] = account.Root
+			}
+		}
+	}
+	s.forwardAccountTask(task)
+}
+
+// processBytecodeResponse persists a batch of delivered bytecodes, returning any
+// undelivered ones to the scheduler.
+func (s *Syncer) processBytecodeResponse(res *codeResponse) {
+	batch := s.db.NewBatch()
+	for _, hash := range res.req.hashes {
+		code, ok := res.codes[hash]
+		if !ok {
+			s.codeTasks[hash] = struct{}{}
+			continue
+		}
+		s.bytecodeSynced++
+		s.bytecodeBytes += common.StorageSize(len(code))
+
+		batch.Put(hash[:], code)
+	}
+	if err := batch.Write(); err != nil {
+		log.Crit("Failed to persist bytecodes", "err", err)
+	}
+	for _, task := range s.tasks {
+		for hash := range res.codes {
+			delete(task.needCode, hash)
+		}
+		s.forwardAccountTask(task)
+	}
+}
+
+// processStorageResponse integrates already validated storage ranges, writing
+// out the storage tries completed and continuing the incomplete ones.
+func (s *Syncer) processStorageResponse(res *storageResponse) {
+	var (
+		req   = res.req
+		batch = s.db.NewBatch()
+		done  []common.Hash
+		heal  []common.Hash
+	)
+	for _, set := range res.hashes {
+		s.storageSynced += uint64(len(set))
+	}
+	if task := req.large; task != nil {
+		// Continuation of a large storage trie, accumulate it and check completion
+		task.req = nil
+		if len(res.hashes) > 0 {
+			for j, hash := range res.hashes[0] {
+				task.trie.Update(hash[:], res.slots[0][j])
+			}
+		}
+		switch {
+		case task.trie.Hash() == task.root:
+			s.commitStorageTrie(task.trie, batch)
+			delete(s.largeTasks, task.account)
+			done = append(done, task.account)
+
+		case !res.cont:
+			// The ranges don't add up to the root. Since the chunks were served by
+			// potentially different peers and proofs don't cover withheld slots,
+			// there's no way to tell who's at fault. Leave the trie to healing.
+			log.Debug("Large storage range doesn't match root, deferring to healing", "account", task.account, "peer", req.peer)
+			delete(s.largeTasks, task.account)
+			heal = append(heal, task.account)
+
+		default:
+			last := res.hashes[0][len(res.hashes[0])-1]
+			task.next = common.BigToHash(new(big.Int).Add(last.Big(), common.Big1))
+		}
+	} else {
+		for i, account := range req.accounts {
+			// Reschedule any storage tries not delivered
+			if i >= len(res.hashes) {
+				s.storageTasks[account] = req.roots[i]
+				continue
+			}
+			tr, _ := trie.New(common.Hash{}, nil)
+			for j, hash := range res.hashes[i] {
+				tr.Update(hash[:], res.slots[i][j])
+			}
+			// If the last storage trie is incomplete, continue it in chunks
+			if i == len(res.hashes)-1 && res.cont && tr.Hash() != req.roots[i] {
+				last := res.hashes[i][len(res.hashes[i])-1]
+				s.largeTasks[account] = &storageTask{
+					account: account,
+					root:    req.roots[i],
+					next:    common.BigToHash(new(big.Int).Add(last.Big(), common.Big1)),
+					trie:    tr,
+				}
+				continue
+			}
+			if tr.Hash() != req.roots[i] {
+				log.Debug("Storage range doesn't match root, rescheduling", "account", account, "peer", req.peer)
+				s.markStateless(req.peer)
+				s.storageTasks[account] = req.roots[i]
+				continue
+			}
+			s.commitStorageTrie(tr, batch)
+			done = append(done, account)
+		}
+	}
+	if err := batch.Write(); err != nil {
+		log.Crit("Failed to persist storage slots", "err", err)
+	}
+	for _, task := range s.tasks {
+		for _, account := range done {
+			delete(task.needState, account)
+		}
+		for _, account := range heal {
+			if _, ok := task.needState[account]; ok {
+				delete(task.needState, account)
+				task.needHeal[account] = struct{}{}
+			}
+		}
+		s.forwardAccountTask(task)
+	}
+}
+
+// commitStorageTrie writes all the nodes of a completed storage trie into batch.
+func (s *Syncer) commitStorageTrie(tr *trie.Trie, batch wshdb.Batch) {
+	size := batch.ValueSize()
+	if _, err := tr.CommitTo(batch); err != nil {
+		log.Crit("Failed to commit storage trie", "err", err)
+	}
+	s.storageBytes += common.StorageSize(batch.ValueSize() - size)
+}
+
+// forwardAccountTask takes a filled account task and persists anything available
+// into the database, after which it forwards the next account marker so that the
+// task's next chunk may be filled.
+func (s *Syncer) forwardAccountTask(task *accountTask) {
+	// Wait until all the storage and code of the accounts have been retrieved,
+	// otherwise the account trie would reference missing data
+	res := task.res
+	if res == nil || len(task.needCode) > 0 || len(task.needState) > 0 {
+		return
+	}
+	heal := task.needHeal
+	task.res, task.needCode, task.needState, task.needHeal = nil, nil, nil, nil
+
+	// Accounts with incomplete storage are left out of the trie so that healing
+	// will descend into their path and retrieve the missing storage nodes too
+	for i, hash := range res.hashes {
+		if _, ok := heal[hash]; ok {
+			continue
+		}
+		task.trie.Update(hash[:], res.raws[i])
+	}
+	batch := s.db.NewBatch()
+	if _, err := task.trie.CommitTo(batch); err != nil {
+		log.Crit("Failed to commit account trie", "err", err)
+	}
+	s.accountBytes += common.StorageSize(batch.ValueSize())
+	if err := batch.Write(); err != nil {
+		log.Crit("Failed to persist accounts", "err", err)
+	}
+	// Advance the marker, or finish the task if the chunk's end was reached
+	last := res.hashes[len(res.hashes)-1]
+	if bytes.Compare(last[:], task.Last[:]) >= 0 {
+		task.done = true
+		return
+	}
+	task.Next = common.BigToHash(new(big.Int).Add(last.Big(), common.Big1))
+}
+
+// OnAccounts is a callback method to invoke when a range of accounts are
+// received from a remote peer.
+func (s *Syncer) OnAccounts(peer SyncPeer, id uint64, hashes []common.Hash, accounts [][]byte, proof [][]byte) error {
+	// Whether or not the response is valid, we can mark the peer as idle and
+	// notify the scheduler to assign a new task
+	s.lock.Lock()
+	s.markIdle(peer.ID())
+	s.notify()
+
+	req, ok := s.accountReqs[id]
+	if !ok {
+		s.lock.Unlock()
+		peer.Log().Warn("Unexpected account range packet", "reqid", id)
+		return nil
+	}
+	delete(s.accountReqs, id)
+	req.timeout.Stop()
+	s.pending++
+	root := s.root
+	s.lock.Unlock()
+
+	// A response without proofs means the peer doesn't have the requested state
+	if len(hashes) == 0 && len(proof) == 0 {
+		peer.Log().Debug("Peer rejected account range request", "root", root)
+		s.markStateless(peer.ID())
+		s.revertAccountLater(req)
+		return nil
+	}
+	if len(hashes) != len(accounts) {
+		s.revertAccountLater(req)
+		return fmt.Errorf("account range mismatch: %d hashes, %d accounts", len(hashes), len(accounts))
+	}
+	// Ensure the range is ordered, within the requested bounds and provably so
+	if err := verifyRangeBoundaries(root, req.origin, req.limit, hashes, accounts, proof); err != nil {
+		peer.Log().Warn("Account range failed verification", "err", err)
+		s.revertAccountLater(req)
+		return err
+	}
+	decoded := make([]*state.Account, len(accounts))
+	for i, blob := range accounts {
+		decoded[i] = new(state.Account)
+		if err := rlp.DecodeBytes(blob, decoded[i]); err != nil {
+			s.revertAccountLater(req)
+			return err
+		}
+	}
+	response := &accountResponse{
+		task:     req.task,
+		hashes:   hashes,
+		accounts: decoded,
+		raws:     accounts,
+	}
+	select {
+	case s.accountResps <- response:
+	case <-req.cancel:
+	}
+	s.delivered()
+	return nil
+}
+
+// OnByteCodes is a callback method to invoke when a batch of contract bytecodes
+// are received from a remote peer.
+func (s *Syncer) OnByteCodes(peer SyncPeer, id uint64, codes [][]byte) error {
+	s.lock.Lock()
+	s.markIdle(peer.ID())
+	s.notify()
+
+	req, ok := s.codeReqs[id]
+	if !ok {
+		s.lock.Unlock()
+		peer.Log().Warn("Unexpected bytecode packet", "reqid", id)
+		return nil
+	}
+	delete(s.codeReqs, id)
+	req.timeout.Stop()
+	s.pending++
+	s.lock.Unlock()
+
+	// An empty response means the peer doesn't have the requested codes
+	if len(codes) == 0 {
+		peer.Log().Debug("Peer rejected bytecode request")
+		s.markStateless(peer.ID())
+		s.revertCodeLater(req)
+		return nil
+	}
+	// Cross reference the requested bytecodes with the response to find gaps
+	// that the serving node is missing
+	requested := make(map[common.Hash]struct{}, len(req.hashes))
+	for _, hash := range req.hashes {
+		requested[hash] = struct{}{}
+	}
+	var (
+		hasher    = sha3.NewKeccak256()
+		delivered = make(map[common.Hash][]byte, len(codes))
+	)
+	for _, code := range codes {
+		hasher.Reset()
+		hasher.Write(code)
+
+		var hash common.Hash
+		hasher.Sum(hash[:0])
+		if _, ok := requested[hash]; !ok {
+			s.revertCodeLater(req)
+			return fmt.Errorf("unrequested bytecode %x", hash)
+		}
+		delivered[hash] = code
+	}
+	response := &codeResponse{
+		req:   req,
+		codes: delivered,
+	}
+	select {
+	case s.codeResps <- response:
+	case <-req.cancel:
+	}
+	s.delivered()
+	return nil
+}
+
+// OnStorage is a callback method to invoke when ranges of storage slots are
+// received from a remote peer.
+func (s *Syncer) OnStorage(peer SyncPeer, id uint64, hashes [][]common.Hash, slots [][][]byte, proof [][]byte) error {
+	s.lock.Lock()
+	s.markIdle(peer.ID())
+	s.notify()
+
+	req, ok := s.storageReqs[id]
+	if !ok {
+		s.lock.Unlock()
+		peer.Log().Warn("Unexpected storage ranges packet", "reqid", id)
+		return nil
+	}
+	delete(s.storageReqs, id)
+	req.timeout.Stop()
+	s.pending++
+	s.lock.Unlock()
+
+	// A response without any data means the peer doesn't have the requested state
+	if len(hashes) == 0 && len(proof) == 0 {
+		peer.Log().Debug("Peer rejected storage request")
+		s.markStateless(peer.ID())
+		s.revertStorageLater(req)
+		return nil
+	}
+	if len(hashes) > len(req.accounts) || len(hashes) != len(slots) {
+		s.revertStorageLater(req)
+		return fmt.Errorf("storage ranges mismatch: %d requested, %d hashes, %d slot sets", len(req.accounts), len(hashes), len(slots))
+	}
+	for i := range hashes {
+		if len(hashes[i]) != len(slots[i]) {
+			s.revertStorageLater(req)
+			return fmt.Errorf("storage range %d mismatch: %d hashes, %d slots", i, len(hashes[i]), len(slots[i]))
+		}
+		// Only the last range may have boundary proofs, the rest just need sorting
+		if i < len(hashes)-1 || len(proof) == 0 {
+			if err := verifyRangeOrder(common.Hash{}, maxHash, hashes[i]); err != nil {
+				s.revertStorageLater(req)
+				return err
+			}
+		}
+	}
+	// If the last range is proven, it's either partial or a continuation
+	var cont bool
+	if len(proof) > 0 {
+		if len(hashes) == 0 {
+			s.revertStorageLater(req)
+			return errors.New("storage proof without ranges")
+		}
+		last := len(hashes) - 1
+		if err := verifyRangeBoundaries(req.roots[last], req.origin, maxHash, hashes[last], slots[last], proof); err != nil {
+			peer.Log().Warn("Storage range failed verification", "err", err)
+			s.revertStorageLater(req)
+			return err
+		}
+		cont = len(hashes[last]) > 0
+	}
+	response := &storageResponse{
+		req:    req,
+		hashes: hashes,
+		slots:  slots,
+		cont:   cont,
+	}
+	select {
+	case s.storageResps <- response:
+	case <-req.cancel:
+	}
+	s.delivered()
+	return nil
+}
+
+// revertAccountLater hands a failed account request back to the event loop for
+// rescheduling.
+func (s *Syncer) revertAccountLater(req *accountRequest) {
+	select {
+	case s.accountReqFails <- req:
+	case <-req.cancel:
+	}
+	s.delivered()
+}
+
+// revertCodeLater hands a failed bytecode request back to the event loop for
+// rescheduling.
+func (s *Syncer) revertCodeLater(req *codeRequest) {
+	select {
+	case s.codeReqFails <- req:
+	case <-req.cancel:
+	}
+	s.delivered()
+}
+
+// revertStorageLater hands a failed storage request back to the event loop for
+// rescheduling.
+func (s *Syncer) revertStorageLater(req *storageRequest) {
+	select {
+	case s.storageReqFails <- req:
+	case <-req.cancel:
+	}
+	s.delivered()
+}
+
+// verifyRangeOrder checks that a list of keys is strictly ascending and within
+// the origin and limit bounds (inclusive).
+func verifyRangeOrder(origin, limit common.Hash, keys []common.Hash) error {
+	for i, key := range keys {
+		if bytes.Compare(key[:], origin[:]) < 0 {
+			return fmt.Errorf("key %d (%x) before origin %x", i, key, origin)
+		}
+		if bytes.Compare(key[:], limit[:]) > 0 {
+			return fmt.Errorf("key %d (%x) after limit %x", i, key, limit)
+		}
+		if i > 0 && bytes.Compare(keys[i-1][:], key[:]) >= 0 {
+			return fmt.Errorf("key %d (%x) not ascending", i, key)
+		}
+	}
+	return nil
+}
+
+// verifyRangeBoundaries checks that a range of key/value pairs is ordered, that
+// the origin is either the first key or absent from the trie, and that the last
+// key and value are part of the trie, all via the attached Merkle proofs.
+//
+// Note, the boundary proofs don't prove the absence of keys inside the range. Any
+// entries withheld by the remote peer result in trie nodes with mismatching hashes,
+// which get retrieved later by healing.
+func verifyRangeBoundaries(root common.Hash, origin, limit common.Hash, keys []common.Hash, values [][]byte, proof [][]byte) error {
+	if err := verifyRangeOrder(origin, limit, keys); err != nil {
+		return err
+	}
+	db, _ := wshdb.NewMemDatabase()
+	for _, node := range proof {
+		db.Put(crypto.Keccak256(node), node)
+	}
+	// Verify the origin: it's either the first key returned, or must be missing
+	value, err, _ := trie.VerifyProof(root, origin[:], db)
+	if err != nil {
+		return fmt.Errorf("invalid origin proof: %v", err)
+	}
+	if len(keys) > 0 && keys[0] == origin {
+		if !bytes.Equal(value, values[0]) {
+			return errors.New("origin value mismatch")
+		}
+	} else if value != nil {
+		return errors.New("origin withheld from range")
+	}
+	// Verify the last key, which must be part of the trie with the same value
+	if len(keys) > 0 {
+		last := len(keys) - 1
+		value, err, _ := trie.VerifyProof(root, keys[last][:], db)
+		if err != nil {
+			return fmt.Errorf("invalid last key proof: %v", err)
+		}
+		if !bytes.Equal(value, values[last]) {
+			return errors.New("last value mismatch")
+		}
+	}
+	return nil
+}
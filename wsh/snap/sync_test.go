@@ -0,0 +1,464 @@
+// Copyright 2018 The go-wiseplat Authors
+// This file is part of the go-wiseplat library.
+//
+// The go-wiseplat library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-wiseplat library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-wiseplat library. If not, see <http://www.gnu.org/licenses/>.
+
+package snap
+
+import (
+	"bytes"
+	"fmt"
+	"math/big"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/wiseplat/go-wiseplat/common"
+	"github.com/wiseplat/go-wiseplat/core/state"
+	"github.com/wiseplat/go-wiseplat/log"
+	"github.com/wiseplat/go-wiseplat/trie"
+	"github.com/wiseplat/go-wiseplat/wshdb"
+)
+
+// makeTestState creates a state with a set of accounts, some of them contracts
+// with code and storage, one of them having a storage too large to be retrieved
+// in a single response.
+func makeTestState() (*wshdb.MemDatabase, common.Hash) {
+	db, _ := wshdb.NewMemDatabase()
+	statedb, _ := state.New(common.Hash{}, state.NewDatabase(db))
+
+	for i := 0; i < 1000; i++ {
+		addr := common.BigToAddress(big.NewInt(int64(i + 1)))
+		statedb.AddBalance(addr, big.NewInt(int64(i+1)))
+		statedb.SetNonce(addr, uint64(i))
+
+		if i%10 == 0 {
+			statedb.SetCode(addr, []byte{byte(i), byte(i >> 8), 0x01, 0x02})
+			for j := 0; j < i%50+1; j++ {
+				statedb.SetState(addr, common.BigToHash(big.NewInt(int64(j))), common.BigToHash(big.NewInt(int64(i*j+1))))
+			}
+		}
+	}
+	large := common.BigToAddress(big.NewInt(0xdeadbeef))
+	statedb.SetCode(large, []byte("large storage contract"))
+	for j := 0; j < 1000; j++ {
+		statedb.SetState(large, common.BigToHash(big.NewInt(int64(j))), common.BigToHash(big.NewInt(int64(j+1))))
+	}
+	root, err := statedb.CommitTo(db, false)
+	if err != nil {
+		panic(err)
+	}
+	return db, root
+}
+
+// testPeer is a snap peer serving requests straight out of a local database and
+// delivering the responses asynchronously to a syncer.
+type testPeer struct {
+	id     string
+	db     wshdb.Database
+	syncer *Syncer
+	limit  uint64 // Maximum number of bytes to serve in a single response
+	logger log.Logger
+
+	mangleAccounts func(hashes []common.Hash, accounts [][]byte, proof [][]byte) ([]common.Hash, [][]byte, [][]byte)
+	mangleStorage  func(hashes [][]common.Hash, slots [][][]byte, proof [][]byte) ([][]common.Hash, [][][]byte, [][]byte)
+}
+
+func newTestPeer(id string, db wshdb.Database, syncer *Syncer, limit uint64) *testPeer {
+	return &testPeer{
+		id:     id,
+		db:     db,
+		syncer: syncer,
+		limit:  limit,
+		logger: log.New("id", id),
+	}
+}
+
+func (p *testPeer) ID() string      { return p.id }
+func (p *testPeer) Log() log.Logger { return p.logger }
+
+func (p *testPeer) RequestAccountRange(id uint64, root, origin, limit common.Hash, bytes uint64) error {
+	if bytes > p.limit {
+		bytes = p.limit
+	}
+	go func() {
+		accounts, proof := serviceGetAccountRange(p.db, &getAccountRangeData{ID: id, Root: root, Origin: origin, Limit: limit, Bytes: bytes})
+
+		hashes := make([]common.Hash, len(accounts))
+		bodies := make([][]byte, len(accounts))
+		for i, acc := range accounts {
+			hashes[i], bodies[i] = acc.Hash, acc.Body
+		}
+		if p.mangleAccounts != nil {
+			hashes, bodies, proof = p.mangleAccounts(hashes, bodies, proof)
+		}
+		if err := p.syncer.OnAccounts(p, id, hashes, bodies, proof); err != nil {
+			p.syncer.Unregister(p.id)
+		}
+	}()
+	return nil
+}
+
+func (p *testPeer) RequestStorageRanges(id uint64, root common.Hash, accounts []common.Hash, origin, limit []byte, bytes uint64) error {
+	if bytes > p.limit {
+		bytes = p.limit
+	}
+	go func() {
+		sets, proof := serviceGetStorageRanges(p.db, &getStorageRangesData{ID: id, Root: root, Accounts: accounts, Origin: origin, Limit: limit, Bytes: bytes})
+
+		hashes := make([][]common.Hash, len(sets))
+		slots := make([][][]byte, len(sets))
+		for i, set := range sets {
+			hashes[i] = make([]common.Hash, len(set))
+			slots[i] = make([][]byte, len(set))
+			for j, slot := range set {
+				hashes[i][j], slots[i][j] = slot.Hash, slot.Body
+			}
+		}
+		if p.mangleStorage != nil {
+			hashes, slots, proof = p.mangleStorage(hashes, slots, proof)
+		}
+		if err := p.syncer.OnStorage(p, id, hashes, slots, proof); err != nil {
+			p.syncer.Unregister(p.id)
+		}
+	}()
+	return nil
+}
+
+func (p *testPeer) RequestByteCodes(id uint64, hashes []common.Hash, bytes uint64) error {
+	if bytes > p.limit {
+		bytes = p.limit
+	}
+	go func() {
+		codes := serviceGetByteCodes(p.db, &getByteCodesData{ID: id, Hashes: hashes, Bytes: bytes})
+		if err := p.syncer.OnByteCodes(p, id, codes); err != nil {
+			p.syncer.Unregister(p.id)
+		}
+	}()
+	return nil
+}
+
+// healState fills the gaps left by a range sync via the node by node state sync,
+// returning the number of trie nodes that needed to be retrieved.
+func healState(t *testing.T, src, dst wshdb.Database, root common.Hash) int {
+	sched := state.NewStateSync(root, dst)
+
+	healed := 0
+	queue := append([]common.Hash{}, sched.Missing(100)...)
+	for len(queue) > 0 {
+		results := make([]trie.SyncResult, len(queue))
+		for i, hash := range queue {
+			data, err := src.Get(hash[:])
+			if err != nil {
+				t.Fatalf("failed to retrieve node data for %x: %v", hash, err)
+			}
+			results[i] = trie.SyncResult{Hash: hash, Data: data}
+		}
+		if _, index, err := sched.Process(results); err != nil {
+			t.Fatalf("failed to process result #%d: %v", index, err)
+		}
+		if index, err := sched.Commit(dst); err != nil {
+			t.Fatalf("failed to commit data #%d: %v", index, err)
+		}
+		healed += len(queue)
+		queue = append(queue[:0], sched.Missing(100)...)
+	}
+	return healed
+}
+
+// checkStateComplete verifies that all the trie nodes and bytecodes of the source
+// database are present in the destination one.
+func checkStateComplete(t *testing.T, src *wshdb.MemDatabase, dst wshdb.Database) {
+	for _, key := range src.Keys() {
+		if len(key) != common.HashLength {
+			continue
+		}
+		want, _ := src.Get(key)
+		have, err := dst.Get(key)
+		if err != nil {
+			t.Fatalf("state entry %x missing: %v", key, err)
+		}
+		if !bytes.Equal(have, want) {
+			t.Fatalf("state entry %x mismatch: have %x, want %x", key, have, want)
+		}
+	}
+}
+
+// syncWithTimeout runs a sync cycle, failing the test if it doesn't terminate.
+func syncWithTimeout(t *testing.T, syncer *Syncer, root common.Hash) error {
+	cancel := make(chan struct{})
+	done := make(chan error, 1)
+	go func() { done <- syncer.Sync(root, cancel) }()
+
+	select {
+	case err := <-done:
+		return err
+	case <-time.After(30 * time.Second):
+		close(cancel)
+		t.Fatalf("sync did not terminate")
+	}
+	return nil
+}
+
+// Tests that a state can be range synced from a single honest peer, leaving only
+// the nodes crossing the chunk boundaries of the account trie to heal.
+func TestSync(t *testing.T) {
+	t.Parallel()
+
+	for _, limit := range []uint64{maxRequestSize, 4096, 512} {
+		src, root := makeTestState()
+		dst, _ := wshdb.NewMemDatabase()
+
+		syncer := NewSyncer(dst)
+		syncer.Register(newTestPeer("honest", src, syncer, limit))
+
+		if err := syncWithTimeout(t, syncer, root); err != nil {
+			t.Fatalf("limit %d: sync failed: %v", limit, err)
+		}
+		if healed := healState(t, src, dst, root); healed > 1 {
+			t.Errorf("limit %d: healed trie nodes mismatch: have %d, want at most 1", limit, healed)
+		}
+		checkStateComplete(t, src, dst)
+	}
+}
+
+// Tests that a state can be range synced concurrently from multiple peers.
+func TestSyncMultiplePeers(t *testing.T) {
+	t.Parallel()
+
+	src, root := makeTestState()
+	dst, _ := wshdb.NewMemDatabase()
+
+	syncer := NewSyncer(dst)
+	for i := 0; i < 4; i++ {
+		syncer.Register(newTestPeer(fmt.Sprintf("honest-%d", i), src, syncer, 1024))
+	}
+	if err := syncWithTimeout(t, syncer, root); err != nil {
+		t.Fatalf("sync failed: %v", err)
+	}
+	if healed := healState(t, src, dst, root); healed > 1 {
+		t.Errorf("healed trie nodes mismatch: have %d, want at most 1", healed)
+	}
+	checkStateComplete(t, src, dst)
+}
+
+// Tests that a sync without any peers fails instead of hanging.
+func TestSyncNoPeers(t *testing.T) {
+	t.Parallel()
+
+	_, root := makeTestState()
+	dst, _ := wshdb.NewMemDatabase()
+
+	if err := syncWithTimeout(t, NewSyncer(dst), root); err != errNoSyncPeers {
+		t.Fatalf("sync error mismatch: have %v, want %v", err, errNoSyncPeers)
+	}
+}
+
+// Tests that peers not having the requested state are excluded from the sync
+// and the sync fails if nobody else can serve it.
+func TestSyncStatelessPeer(t *testing.T) {
+	t.Parallel()
+
+	_, root := makeTestState()
+	empty, _ := wshdb.NewMemDatabase()
+	dst, _ := wshdb.NewMemDatabase()
+
+	syncer := NewSyncer(dst)
+	syncer.Register(newTestPeer("stateless", empty, syncer, maxRequestSize))
+
+	if err := syncWithTimeout(t, syncer, root); err != errNoSyncPeers {
+		t.Fatalf("sync error mismatch: have %v, want %v", err, errNoSyncPeers)
+	}
+}
+
+// Tests that peers delivering invalid or incomplete data are rejected or their
+// data is fixed up by healing, and the state still gets synced in full.
+func TestSyncBadPeers(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name           string
+		mangleAccounts func([]common.Hash, [][]byte, [][]byte) ([]common.Hash, [][]byte, [][]byte)
+		mangleStorage  func([][]common.Hash, [][][]byte, [][]byte) ([][]common.Hash, [][][]byte, [][]byte)
+	}{
+		{
+			name: "no-proof",
+			mangleAccounts: func(hashes []common.Hash, accounts [][]byte, proof [][]byte) ([]common.Hash, [][]byte, [][]byte) {
+				return hashes, accounts, nil
+			},
+		},
+		{
+			name: "corrupt-proof",
+			mangleAccounts: func(hashes []common.Hash, accounts [][]byte, proof [][]byte) ([]common.Hash, [][]byte, [][]byte) {
+				if len(proof) > 0 {
+					proof = append([][]byte{}, proof...)
+					proof[0] = append(common.CopyBytes(proof[0]), 0x00)
+				}
+				return hashes, accounts, proof
+			},
+		},
+		{
+			name: "unordered",
+			mangleAccounts: func(hashes []common.Hash, accounts [][]byte, proof [][]byte) ([]common.Hash, [][]byte, [][]byte) {
+				if len(hashes) > 1 {
+					hashes[0], hashes[1] = hashes[1], hashes[0]
+					accounts[0], accounts[1] = accounts[1], accounts[0]
+				}
+				return hashes, accounts, proof
+			},
+		},
+		{
+			name: "withheld-account",
+			mangleAccounts: func(hashes []common.Hash, accounts [][]byte, proof [][]byte) ([]common.Hash, [][]byte, [][]byte) {
+				if len(hashes) > 2 {
+					hashes = append(hashes[:1], hashes[2:]...)
+					accounts = append(accounts[:1], accounts[2:]...)
+				}
+				return hashes, accounts, proof
+			},
+		},
+		{
+			name: "corrupt-storage",
+			mangleStorage: func(hashes [][]common.Hash, slots [][][]byte, proof [][]byte) ([][]common.Hash, [][][]byte, [][]byte) {
+				for _, set := range slots {
+					for i := range set {
+						set[i] = []byte{0x01}
+					}
+				}
+				return hashes, slots, proof
+			},
+		},
+	}
+	for _, tt := range tests {
+		src, root := makeTestState()
+		dst, _ := wshdb.NewMemDatabase()
+
+		syncer := NewSyncer(dst)
+
+		bad := newTestPeer("bad", src, syncer, 1024)
+		bad.mangleAccounts, bad.mangleStorage = tt.mangleAccounts, tt.mangleStorage
+		syncer.Register(bad)
+		syncer.Register(newTestPeer("honest", src, syncer, 1024))
+
+		if err := syncWithTimeout(t, syncer, root); err != nil {
+			t.Fatalf("%s: sync failed: %v", tt.name, err)
+		}
+		healState(t, src, dst, root)
+		checkStateComplete(t, src, dst)
+	}
+}
+
+// Tests that an interrupted sync cycle is resumed from its persisted progress by
+// a new syncer (e.g. after a restart), instead of retrieving all accounts again.
+func TestSyncResume(t *testing.T) {
+	t.Parallel()
+
+	src, root := makeTestState()
+	dst, _ := wshdb.NewMemDatabase()
+
+	// Sync from a peer dropping the state after a few account ranges
+	syncer := NewSyncer(dst)
+	flaky := newTestPeer("flaky", src, syncer, 512)
+
+	var served int32
+	flaky.mangleAccounts = func(hashes []common.Hash, accounts [][]byte, proof [][]byte) ([]common.Hash, [][]byte, [][]byte) {
+		if atomic.AddInt32(&served, 1) > 20 {
+			return nil, nil, nil
+		}
+		return hashes, accounts, proof
+	}
+	syncer.Register(flaky)
+
+	if err := syncWithTimeout(t, syncer, root); err != errNoSyncPeers {
+		t.Fatalf("interrupted sync error mismatch: have %v, want %v", err, errNoSyncPeers)
+	}
+	if ok, _ := dst.Has(syncStatusKey); !ok {
+		t.Fatalf("interrupted sync status not persisted")
+	}
+	// Resume the sync on a new syncer, only the remaining accounts are needed
+	resumed := NewSyncer(dst)
+	resumed.Register(newTestPeer("honest", src, resumed, 512))
+
+	if err := syncWithTimeout(t, resumed, root); err != nil {
+		t.Fatalf("resumed sync failed: %v", err)
+	}
+	if resumed.accountSynced == 0 || resumed.accountSynced >= 1001 {
+		t.Errorf("resumed sync retrieved accounts mismatch: have %d, want some of 1001", resumed.accountSynced)
+	}
+	if ok, _ := dst.Has(syncStatusKey); ok {
+		t.Errorf("completed sync status not deleted")
+	}
+	healState(t, src, dst, root)
+	checkStateComplete(t, src, dst)
+
+	// A sync of another root starts from scratch
+	other := NewSyncer(dst)
+	other.Register(newTestPeer("honest", src, other, 512))
+	dst.Put(syncStatusKey, []byte(`{"Root":"0x0000000000000000000000000000000000000000000000000000000000000001","Tasks":[{"Next":"0x0000000000000000000000000000000000000000000000000000000000000000","Last":"0x0000000000000000000000000000000000000000000000000000000000000001"}]}`))
+
+	if err := syncWithTimeout(t, other, root); err != nil {
+		t.Fatalf("sync of another root failed: %v", err)
+	}
+	if other.accountSynced != 1001 {
+		t.Errorf("fresh sync retrieved accounts mismatch: have %d, want 1001", other.accountSynced)
+	}
+}
+
+// Tests that the account range boundary verification rejects ranges that are
+// not ordered, exceed the requested bounds, or don't match the proofs.
+func TestVerifyRangeBoundaries(t *testing.T) {
+	src, root := makeTestState()
+
+	var (
+		origin = common.HexToHash("0x1000000000000000000000000000000000000000000000000000000000000000")
+		limit  = common.HexToHash("0x2fffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff")
+	)
+	accounts, proof := serviceGetAccountRange(src, &getAccountRangeData{Root: root, Origin: origin, Limit: limit, Bytes: 2048})
+	if len(accounts) < 3 {
+		t.Fatalf("too few accounts served: %d", len(accounts))
+	}
+	keys := make([]common.Hash, len(accounts))
+	values := make([][]byte, len(accounts))
+	for i, acc := range accounts {
+		keys[i], values[i] = acc.Hash, acc.Body
+	}
+	if err := verifyRangeBoundaries(root, origin, limit, keys, values, proof); err != nil {
+		t.Fatalf("valid range rejected: %v", err)
+	}
+	if err := verifyRangeBoundaries(root, origin, limit, keys[1:], values[1:], proof); err != nil {
+		t.Fatalf("valid range missing the first key rejected: %v", err)
+	}
+	// Ensure tampered ranges are rejected
+	if err := verifyRangeBoundaries(root, keys[1], limit, keys, values, proof); err == nil {
+		t.Errorf("range before origin accepted")
+	}
+	if err := verifyRangeBoundaries(root, origin, keys[0], keys, values, proof); err == nil {
+		t.Errorf("range after limit accepted")
+	}
+	if err := verifyRangeBoundaries(root, origin, limit, keys[:len(keys)-1], values[:len(values)-1], proof); err == nil {
+		t.Errorf("range with unproven last key accepted")
+	}
+	if err := verifyRangeBoundaries(root, origin, limit, keys, append(append([][]byte{}, values[:len(values)-1]...), []byte{0x01}), proof); err == nil {
+		t.Errorf("range with tampered last value accepted")
+	}
+	if err := verifyRangeBoundaries(common.Hash{0x01}, origin, limit, keys, values, proof); err == nil {
+		t.Errorf("range with mismatching root accepted")
+	}
+	// Ensure that a range skipping an existing origin key is rejected
+	origin = keys[0]
+	_, proof = serviceGetAccountRange(src, &getAccountRangeData{Root: root, Origin: origin, Limit: limit, Bytes: 2048})
+	if err := verifyRangeBoundaries(root, origin, limit, keys[1:], values[1:], proof); err == nil {
+		t.Errorf("range withholding the origin accepted")
+	}
+}
@@ -78,7 +78,11 @@ func (pm *ProtocolManager) txsyncLoop() {
 		pack.txs = pack.txs[:0]
 		for i := 0; i < len(s.txs) && size < txsyncPackSize; i++ {
 			pack.txs = append(pack.txs, s.txs[i])
-			size += s.txs[i].Size()
+			if s.p.version >= wsh64 {
+				size += common.HashLength
+			} else {
+				size += s.txs[i].Size()
+			}
 		}
 		// Remove the transactions that will be sent.
 		s.txs = s.txs[:copy(s.txs, s.txs[len(pack.txs):])]
@@ -88,7 +92,16 @@ func (pm *ProtocolManager) txsyncLoop() {
 		// Send the pack in the background.
 		s.p.Log().Trace("Sending batch of transactions", "count", len(pack.txs), "bytes", size)
 		sending = true
-		go func() { done <- pack.p.SendTransactions(pack.txs) }()
+		if s.p.version >= wsh64 {
+			// Newer peers only get the hashes, retrieving what they miss
+			hashes := make([]common.Hash, len(pack.txs))
+			for i, tx := range pack.txs {
+				hashes[i] = tx.Hash()
+			}
+			go func() { done <- pack.p.SendPooledTransactionHashes(hashes) }()
+		} else {
+			go func() { done <- pack.p.SendTransactions(pack.txs) }()
+		}
 	}
 
 	// pick chooses the next pending sync.
@@ -134,7 +147,9 @@ func (pm *ProtocolManager) txsyncLoop() {
 func (pm *ProtocolManager) syncer() {
 	// Start and ensure cleanup of sync mechanisms
 	pm.fetcher.Start()
+	pm.txFetcher.Start()
 	defer pm.fetcher.Stop()
+	defer pm.txFetcher.Stop()
 	defer pm.downloader.Terminate()
 
 	// Wait for different events to fire synchronisation operations
@@ -172,6 +187,10 @@ func (pm *ProtocolManager) synchronise(peer *peer) {
 
 	pHead, pTd := peer.Head()
 	if pTd.Cmp(td) <= 0 {
+		// Nothing to sync, spend the idle time backfilling any checkpoint ancestors
+		if pm.backfill && atomic.LoadUint32(&pm.acceptTxs) == 1 {
+			pm.backfillChain(peer)
+		}
 		return
 	}
 	// Otherwise try to sync with the downloader
@@ -179,6 +198,9 @@ func (pm *ProtocolManager) synchronise(peer *peer) {
 	if atomic.LoadUint32(&pm.fastSync) == 1 {
 		// Fast sync was explicitly requested, and explicitly granted
 		mode = downloader.FastSync
+		if pm.beamSync {
+			mode = downloader.BeamSync
+		}
 	} else if currentBlock.NumberU64() == 0 && pm.blockchain.CurrentFastBlock().NumberU64() > 0 {
 		// The database seems empty as the current block is the genesis. Yet the fast
 		// block is ahead, so fast sync was enabled for this node at a certain point.
@@ -212,3 +234,21 @@ func (pm *ProtocolManager) synchronise(peer *peer) {
 		go pm.BroadcastBlock(head, false)
 	}
 }
+
+// backfillChain retrieves the blocks preceding the sync checkpoint from a peer
+// in batches, until either the chain is linked to the genesis block or the peer
+// announces a better chain to sync instead.
+func (pm *ProtocolManager) backfillChain(peer *peer) {
+	for pm.blockchain.ChainTail() != nil {
+		currentBlock := pm.blockchain.CurrentBlock()
+		td := pm.blockchain.GetTd(currentBlock.Hash(), currentBlock.NumberU64())
+
+		if _, pTd := peer.Head(); pTd.Cmp(td) > 0 {
+			return
+		}
+		if err := pm.downloader.Backfill(peer.id); err != nil {
+			log.Debug("Checkpoint backfill failed", "peer", peer.id, "err", err)
+			return
+		}
+	}
+}
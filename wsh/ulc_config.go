@@ -0,0 +1,27 @@
+// Copyright 2018 The go-wiseplat Authors
+// This file is part of the go-wiseplat library.
+//
+// The go-wiseplat library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-wiseplat library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-wiseplat library. If not, see <http://www.gnu.org/licenses/>.
+
+package wsh
+
+const DefaultULCMinTrustedFraction = 75
+
+// ULCConfig is the configuration of the ultra light client mode, in which the
+// client accepts new heads announced by enough trusted servers instead of
+// downloading and verifying the header chain.
+type ULCConfig struct {
+	TrustedServers     []string `toml:",omitempty"` // Enode URLs of the trusted LES servers
+	MinTrustedFraction int      `toml:",omitempty"` // Minimum percentage of trusted servers announcing a head
+}